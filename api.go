@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+// apiSyncResult is the response to POST /api/v1/sync/{issue}
+type apiSyncResult struct {
+	Repo   string `json:"repo"`
+	Issue  int    `json:"issue"`
+	Key    string `json:"key"`
+	Result string `json:"result"`
+	// Mapping is the mapping after the sync, unless the issue awaits approval
+	Mapping *state.Mapping `json:"mapping,omitempty"`
+}
+
+// apiFailures is the response to GET /api/v1/failures
+type apiFailures struct {
+	// CycleStartedAt is the start of the latest poll cycle, if any
+	CycleStartedAt *time.Time `json:"cycle_started_at,omitempty"`
+	// Failures are the issues that failed in the latest poll cycle
+	Failures []cycleFailure `json:"failures"`
+	// Retries are the failed Jira creations in the retry queue
+	Retries []*state.Retry `json:"retries"`
+}
+
+// apiError is the body of error responses
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// registerAPI adds the REST management API to mux, authenticated with the
+// bearer token
+func (d *dashboard) registerAPI(mux *http.ServeMux, token string) {
+	auth := func(h http.HandlerFunc) http.Handler { return requireBearer(token, h) }
+	mux.Handle("GET /api/v1/mappings", auth(d.apiMappings))
+	mux.Handle("POST /api/v1/sync/{issue}", auth(d.apiSync))
+	mux.Handle("GET /api/v1/failures", auth(d.apiFailures))
+	mux.Handle("GET /api/v1/dead-letters", auth(d.apiDeadLetters))
+	mux.Handle("POST /api/v1/dead-letters/retry", auth(d.apiRetryDeadLetter))
+}
+
+// requireBearer rejects requests without the bearer token
+func requireBearer(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gh-jira"`)
+			writeAPIJSON(w, http.StatusUnauthorized, apiError{Error: "missing or invalid bearer token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiMappings lists the mappings, optionally of a single repository
+// (?repo=owner/name)
+func (d *dashboard) apiMappings(w http.ResponseWriter, r *http.Request) {
+	all, err := store.List(r.Context())
+	if err != nil {
+		writeAPIJSON(w, http.StatusInternalServerError, apiError{Error: err.Error()})
+		return
+	}
+	repo := r.URL.Query().Get("repo")
+	list := mappingList{Mappings: make([]*state.Mapping, 0, len(all))}
+	for _, m := range all {
+		if repo == "" || strings.EqualFold(m.Repo, repo) {
+			list.Mappings = append(list.Mappings, m)
+		}
+	}
+	writeAPIJSON(w, http.StatusOK, list)
+}
+
+// apiSync creates or re-syncs the Jira issue of a GitHub issue of the only
+// configured repository or the one given by ?repo=owner/name
+func (d *dashboard) apiSync(w http.ResponseWriter, r *http.Request) {
+	conf := cfg()
+	number, err := strconv.Atoi(r.PathValue("issue"))
+	if err != nil || number <= 0 {
+		writeAPIJSON(w, http.StatusBadRequest, apiError{Error: "issue must be a GitHub issue number"})
+		return
+	}
+	repoName := r.URL.Query().Get("repo")
+	if repoName == "" {
+		repos := conf.GitHub.WatchedRepos()
+		if len(repos) != 1 {
+			writeAPIJSON(w, http.StatusBadRequest, apiError{Error: "no single repository is configured, pass ?repo=owner/name"})
+			return
+		}
+		repoName = repos[0].FullName()
+	}
+
+	if isFollower() {
+		writeAPIJSON(w, http.StatusServiceUnavailable, apiError{Error: "this replica is not the leader"})
+		return
+	}
+	d.actionMu.Lock()
+	defer d.actionMu.Unlock()
+	ctx, cancel := context.WithTimeout(r.Context(), conf.Summarizer.Timeout+time.Minute)
+	defer cancel()
+	key, msg, err := syncIssueNumber(ctx, repoName, number, d.sum)
+	switch {
+	case errors.Is(err, errIssueNotFound), errors.Is(err, errUnknownRepo):
+		writeAPIJSON(w, http.StatusNotFound, apiError{Error: err.Error()})
+		return
+	case err != nil:
+		log.Printf("API: sync of %s#%d failed: %v", repoName, number, err)
+		writeAPIJSON(w, http.StatusInternalServerError, apiError{Error: err.Error()})
+		return
+	}
+	log.Printf("API: %s", msg)
+
+	result := apiSyncResult{Repo: repoName, Issue: number, Key: key, Result: msg}
+	if m, err := state.Resolve(ctx, store, key); err == nil {
+		result.Mapping = m
+	}
+	writeAPIJSON(w, http.StatusOK, result)
+}
+
+// apiFailures reports the failures of the latest poll cycle and the failed
+// Jira creations
+func (d *dashboard) apiFailures(w http.ResponseWriter, r *http.Request) {
+	out := apiFailures{Failures: []cycleFailure{}, Retries: []*state.Retry{}}
+	if cycles := recentCycles.list(); len(cycles) > 0 {
+		out.CycleStartedAt = &cycles[0].StartedAt
+		out.Failures = append(out.Failures, cycles[0].Failures...)
+	}
+	retries, err := store.ListRetries(r.Context())
+	if err != nil {
+		writeAPIJSON(w, http.StatusInternalServerError, apiError{Error: err.Error()})
+		return
+	}
+	out.Retries = append(out.Retries, retries...)
+	writeAPIJSON(w, http.StatusOK, out)
+}
+
+// writeAPIJSON writes v as the JSON response with the given status
+func writeAPIJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Printf("Failed to write API response: %v", err)
+	}
+}
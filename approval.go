@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/slack"
+	"github.com/savitaashture/gh-jira/pkg/state"
+	"github.com/savitaashture/gh-jira/pkg/summarizer"
+)
+
+// awaitApproval queues the Jira issue of a new GitHub issue for human
+// approval, unless an approval for it is already open
+func awaitApproval(ctx context.Context, repo config.RepoConfig, issue *github.Issue, key string, sum *summarizer.Summarizer, result *cycleResult) {
+	existing, err := findApproval(ctx, key)
+	if err != nil {
+		result.fail(repo.FullName(), issue.GetNumber(), "approval", err)
+		return
+	}
+	if existing != nil {
+		log.Printf("GitHub issue #%d has %s approval %d, skipping", issue.GetNumber(), existing.Status, existing.ID)
+		result.inc(&result.Skipped)
+		return
+	}
+
+	if _, err := queueApproval(ctx, repo, issue, key, sum); err != nil {
+		var stageErr *syncStageError
+		stage := "approval"
+		if errors.As(err, &stageErr) {
+			stage = stageErr.stage
+		}
+		result.fail(repo.FullName(), issue.GetNumber(), stage, err)
+		return
+	}
+	result.inc(&result.Queued)
+}
+
+// findApproval returns the approval of key that is not done yet, or nil
+func findApproval(ctx context.Context, key string) (*state.Approval, error) {
+	approvals, err := store.ListApprovals(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range approvals {
+		if a.Key == key && a.Status != state.ApprovalDone {
+			return a, nil
+		}
+	}
+	return nil, nil
+}
+
+// queueApproval summarizes the issue and stores the resulting Jira payload
+// as a pending approval
+func queueApproval(ctx context.Context, repo config.RepoConfig, issue *github.Issue, key string, sum *summarizer.Summarizer) (*state.Approval, error) {
+	summary, err := summarizeIssue(ctx, sum, repo, issue, cfg().Jira.Route(repo, ruleIssue(issue).Labels).ProjectKey)
+	if err != nil {
+		return nil, &syncStageError{stage: "summarize", err: err}
+	}
+	fields, warnings := jiraIssueFields(repo, issue, summary)
+	warnings = append(warnings, enrichFields(ctx, sum, issue, fields)...)
+
+	a := &state.Approval{
+		Key:         key,
+		Repo:        repo.FullName(),
+		IssueNumber: issue.GetNumber(),
+		Title:       issue.GetTitle(),
+		Summary:     summary,
+		JiraFields:  fields,
+		Warnings:    warnings,
+		Status:      state.ApprovalPending,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if err := store.PutApproval(ctx, a); err != nil {
+		return nil, fmt.Errorf("failed to queue approval: %w", err)
+	}
+	log.Printf("Queued Jira issue for GitHub issue #%d for approval as %d", issue.GetNumber(), a.ID)
+	notifyApproval(ctx, issue, a)
+	return a, nil
+}
+
+// notifyApproval announces a new approval on Slack if configured
+func notifyApproval(ctx context.Context, issue *github.Issue, a *state.Approval) {
+	conf := cfg()
+	if conf.Approval.SlackWebhookURL == "" {
+		return
+	}
+	summary := a.Summary
+	if len(summary) > 500 {
+		summary = summary[:500] + "…"
+	}
+	msg := slack.Message{Text: fmt.Sprintf(
+		"Jira issue awaiting approval for <%s|%s#%d %s>\n>%s\nApprove: `gh-jira approvals approve %d`  Reject: `gh-jira approvals reject %d`",
+		issue.GetHTMLURL(), a.Repo, a.IssueNumber, a.Title, summary, a.ID, a.ID)}
+	if err := slack.Post(ctx, conf.Approval.SlackWebhookURL, msg); err != nil {
+		log.Printf("Failed to notify Slack of approval %d: %v", a.ID, err)
+	}
+}
+
+// createApproved creates the Jira issue of an approved request and
+// completes its sync. It returns no mapping if the issue is being synced
+// elsewhere or was synced meanwhile.
+func createApproved(ctx context.Context, client *github.Client, repo config.RepoConfig, issue *github.Issue, a *state.Approval) (*state.Mapping, error) {
+	ctx, unlock, err := claimIssue(ctx, a.Key)
+	if errors.Is(err, errIssueBusy) || errors.Is(err, errIssueSynced) {
+		log.Printf("Not creating the approved Jira issue of GitHub issue #%d yet: %v", a.IssueNumber, err)
+		return nil, nil
+	} else if err != nil {
+		return nil, &syncStageError{stage: "lock", err: err}
+	}
+	defer unlock()
+	mapping, err := createFromPayload(ctx, repo, issue, a.Key, a.Summary, a.JiraFields)
+	if err != nil {
+		return nil, err
+	}
+	return mapping, publishSync(ctx, client, repo, issue, mapping, a.Warnings)
+}
+
+// processApprovals creates the Jira issues of the approved items of a
+// repository from the payload that was reviewed
+func processApprovals(ctx context.Context, client *github.Client, repo config.RepoConfig, result *cycleResult) error {
+	approvals, err := store.ListApprovals(ctx)
+	if err != nil {
+		result.fail(repo.FullName(), 0, "approval", err)
+		return nil
+	}
+
+	for _, a := range approvals {
+		if a.Status != state.ApprovalApproved || a.Repo != repo.FullName() {
+			continue
+		}
+		log.Printf("Approval %d for GitHub issue #%d was approved by %s", a.ID, a.IssueNumber, a.DecidedBy)
+
+		if err := ghRateLimit.wait(ctx); err != nil {
+			return nil
+		}
+		issue, resp, err := client.Issues.Get(ctx, repo.Owner, repo.Name, a.IssueNumber)
+		ghRateLimit.observe(resp, err)
+		if err != nil {
+			if isAuthError(err) {
+				return fmt.Errorf("GitHub authentication failed: %w", err)
+			}
+			result.fail(repo.FullName(), a.IssueNumber, "approval", err)
+			continue
+		}
+
+		mapping, err := lookupMapping(ctx, a.Key)
+		switch {
+		case err == nil:
+			log.Printf("GitHub issue #%d was already synced to %s", a.IssueNumber, mapping.JiraKey)
+		case errors.Is(err, state.ErrNotFound):
+			// An issue being synced elsewhere is completed on the next poll
+			mapping, err = createApproved(ctx, client, repo, issue, a)
+			if err == nil && mapping != nil {
+				result.inc(&result.Created)
+			}
+		}
+		if mapping != nil {
+			a.Status = state.ApprovalDone
+			a.JiraKey = mapping.JiraKey
+			if err := store.PutApproval(ctx, a); err != nil {
+				log.Printf("Failed to complete approval %d: %v", a.ID, err)
+			}
+		}
+		if err != nil {
+			var fatal *fatalError
+			if errors.As(err, &fatal) {
+				return err
+			}
+			var stageErr *syncStageError
+			stage := "create"
+			if errors.As(err, &stageErr) {
+				stage = stageErr.stage
+			}
+			result.fail(repo.FullName(), a.IssueNumber, stage, err)
+		}
+	}
+	return nil
+}
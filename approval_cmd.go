@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+const approvalsUsage = `Usage: gh-jira approvals <subcommand> [--output table|json|yaml] [flags]
+
+Subcommands:
+  list [--status STATUS]             List approvals, optionally only pending, approved, rejected or done ones
+  show ID                            Show the summary and Jira payload awaiting approval
+  approve [--by NAME] ID...          Approve; the service creates the Jira issues on its next poll
+  reject [--by NAME] [--reason R] ID...  Reject; the issues are not synced
+`
+
+// approvalList is the output of `approvals list`, `approve` and `reject`
+type approvalList struct {
+	Approvals []*state.Approval `json:"approvals"`
+}
+
+// runApprovalsCommand implements `gh-jira approvals`
+func runApprovalsCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, approvalsUsage)
+		return exitFatal
+	}
+
+	fs := flag.NewFlagSet("approvals "+args[0], flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("GH_JIRA_CONFIG"), "Path to an optional YAML configuration file")
+	output := outputFlag(fs)
+	status := fs.String("status", "", "Only list approvals with this status")
+	by := fs.String("by", os.Getenv("USER"), "Name recorded as the decision maker")
+	reason := fs.String("reason", "", "Reason for the rejection")
+	if err := fs.Parse(args[1:]); err != nil {
+		return exitFatal
+	}
+	if err := validOutput(*output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+
+	var ids []int64
+	for _, arg := range fs.Args() {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid approval ID %q\n", arg)
+			return exitFatal
+		}
+		ids = append(ids, id)
+	}
+
+	c, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	s, err := state.Open(c.State.Backend, c.State.DSN)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	defer s.Close()
+
+	ctx := context.Background()
+	switch {
+	case args[0] == "list" && len(ids) == 0:
+		err = listApprovals(ctx, s, *status, *output)
+	case args[0] == "show" && len(ids) == 1:
+		err = showApproval(ctx, s, ids[0], *output)
+	case args[0] == "approve" && len(ids) > 0:
+		err = decideApprovals(ctx, s, ids, state.ApprovalApproved, *by, "", *output)
+	case args[0] == "reject" && len(ids) > 0:
+		err = decideApprovals(ctx, s, ids, state.ApprovalRejected, *by, *reason, *output)
+	default:
+		fmt.Fprint(os.Stderr, approvalsUsage)
+		return exitFatal
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitPartialFailure
+	}
+	return exitOK
+}
+
+func listApprovals(ctx context.Context, s state.Store, status, output string) error {
+	all, err := s.ListApprovals(ctx)
+	if err != nil {
+		return err
+	}
+	list := approvalList{Approvals: make([]*state.Approval, 0, len(all))}
+	for _, a := range all {
+		if status == "" || a.Status == status {
+			list.Approvals = append(list.Approvals, a)
+		}
+	}
+	return writeOutput(os.Stdout, output, list, list.writeTable)
+}
+
+func showApproval(ctx context.Context, s state.Store, id int64, output string) error {
+	a, err := s.GetApproval(ctx, id)
+	if err != nil {
+		return fmt.Errorf("approval %d: %w", id, err)
+	}
+	return writeOutput(os.Stdout, output, a, func(w io.Writer) error {
+		fmt.Fprintf(w, "Approval %d: %s#%d %s\n", a.ID, a.Repo, a.IssueNumber, a.Title)
+		fmt.Fprintf(w, "Status:  %s\n", a.Status)
+		if a.DecidedBy != "" {
+			fmt.Fprintf(w, "Decided: by %s at %s %s\n", a.DecidedBy, a.DecidedAt.Format(time.RFC3339), a.Reason)
+		}
+		if a.JiraKey != "" {
+			fmt.Fprintf(w, "Jira:    %s\n", a.JiraKey)
+		}
+		for _, warning := range a.Warnings {
+			fmt.Fprintf(w, "Warning: %s\n", warning)
+		}
+		fmt.Fprintf(w, "\nGenerated summary:\n%s\n\nJira payload:\n", a.Summary)
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(a.JiraFields)
+	})
+}
+
+// decideApprovals approves or rejects pending approvals
+func decideApprovals(ctx context.Context, s state.Store, ids []int64, status, by, reason, output string) error {
+	list := approvalList{Approvals: make([]*state.Approval, 0, len(ids))}
+	for _, id := range ids {
+		a, err := s.GetApproval(ctx, id)
+		if err != nil {
+			return fmt.Errorf("approval %d: %w", id, err)
+		}
+		if a.Status != state.ApprovalPending {
+			return fmt.Errorf("approval %d is already %s", id, a.Status)
+		}
+		a.Status = status
+		a.DecidedBy = by
+		a.Reason = reason
+		a.DecidedAt = time.Now().UTC()
+		if err := s.PutApproval(ctx, a); err != nil {
+			return err
+		}
+		list.Approvals = append(list.Approvals, a)
+	}
+	return writeOutput(os.Stdout, output, list, list.writeTable)
+}
+
+// writeTable renders the approvals for humans
+func (l approvalList) writeTable(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATUS\tISSUE\tTITLE\tDECIDED BY\tJIRA\tCREATED")
+	for _, a := range l.Approvals {
+		fmt.Fprintf(w, "%d\t%s\t%s#%d\t%s\t%s\t%s\t%s\n", a.ID, a.Status, a.Repo, a.IssueNumber, a.Title,
+			a.DecidedBy, a.JiraKey, a.CreatedAt.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+// attachIssueJSON attaches the GitHub issue as JSON to its newly created
+// Jira issue, so that nothing is lost that the summary left out. Its title
+// is redacted and its body sanitized and redacted like the description.
+// Failures are only logged as the Jira issue was created.
+func attachIssueJSON(ctx context.Context, m *state.Mapping, issue *github.Issue) {
+	if !cfg().Jira.AttachIssueJSON {
+		return
+	}
+	cleaned := *issue
+	cleaned.Title = github.Ptr(redactor.Redact(issue.GetTitle()))
+	cleaned.Body = github.Ptr(redactor.Redact(issueBody(issue)))
+	data, err := json.MarshalIndent(&cleaned, "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode GitHub issue #%d as JSON: %v", issue.GetNumber(), err)
+		return
+	}
+	filename := fmt.Sprintf("github-issue-%d.json", issue.GetNumber())
+	if err := replaceAttachment(ctx, m, filename, data); err != nil {
+		log.Printf("Failed to attach GitHub issue #%d as JSON to Jira issue %s: %v", issue.GetNumber(), m.JiraKey, err)
+	}
+}
+
+// replaceAttachment attaches content as filename to the Jira issue of m,
+// replacing the attachments of that name unless one has the same size
+func replaceAttachment(ctx context.Context, m *state.Mapping, filename string, content []byte) error {
+	jc, err := jiraFor(m.JiraInstance)
+	if err != nil {
+		return err
+	}
+	ji, err := jc.GetIssue(ctx, m.JiraKey, []string{"attachment"})
+	if err != nil {
+		return fmt.Errorf("failed to list the attachments of %s: %w", m.JiraKey, err)
+	}
+	var old []string
+	for _, a := range ji.Fields.Attachments {
+		if a.Filename != filename {
+			continue
+		}
+		if a.Size == int64(len(content)) {
+			log.Printf("Jira issue %s already has %s attached", m.JiraKey, filename)
+			return nil
+		}
+		old = append(old, a.ID)
+	}
+
+	log.Printf("Attaching %s to Jira issue %s", filename, m.JiraKey)
+	created, err := jc.AddAttachment(ctx, m.JiraKey, filename, content)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", filename, err)
+	}
+	e := jiraAudit("add_attachment", m.JiraKey, map[string]interface{}{"attachment_id": created.ID, "filename": filename})
+	e.Repo, e.Issue = m.Repo, m.IssueNumber
+	recordAudit(e)
+
+	for _, id := range old {
+		if err := jc.DeleteAttachment(ctx, id); err != nil {
+			log.Printf("Failed to remove the outdated attachment %s of Jira issue %s: %v", id, m.JiraKey, err)
+			continue
+		}
+		e := jiraAudit("delete_attachment", m.JiraKey, map[string]interface{}{"attachment_id": id, "filename": filename})
+		e.Repo, e.Issue = m.Repo, m.IssueNumber
+		recordAudit(e)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/savitaashture/gh-jira/pkg/audit"
+	"github.com/savitaashture/gh-jira/pkg/config"
+)
+
+// auditLog records the changes made in GitHub and Jira; nil unless an audit
+// file is configured
+var auditLog *audit.Log
+
+// auditActor identifies the configured GitHub and Jira credentials and the
+// host, since the bot account alone doesn't tell instances apart
+func auditActor() string {
+	conf := cfg()
+	gh := "github=token"
+	if app := conf.GitHub.App; app.Enabled() {
+		gh = fmt.Sprintf("github=app:%d/installation:%d", app.AppID, app.InstallationID)
+	}
+	jira := "jira=" + conf.Jira.Username
+	if conf.Jira.OAuth.Enabled() {
+		jira = "jira=oauth:" + conf.Jira.OAuth.ClientID
+	} else if conf.Jira.Username == "" {
+		jira = "jira=personal-access-token"
+	}
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s %s host=%s", gh, jira, host)
+}
+
+// recordAudit appends a change to the audit log. A failed write is logged
+// but doesn't fail the sync since the change was already made.
+func recordAudit(e audit.Entry) {
+	if err := auditLog.Record(e); err != nil {
+		log.Printf("Failed to record %s %s of %s in the audit log: %v", e.System, e.Action, e.Target, err)
+	}
+}
+
+// githubAudit describes a change of a GitHub issue
+func githubAudit(action string, repo config.RepoConfig, number int, details map[string]interface{}) audit.Entry {
+	return audit.Entry{
+		System:  audit.SystemGitHub,
+		Action:  action,
+		Target:  fmt.Sprintf("%s#%d", repo.FullName(), number),
+		Repo:    repo.FullName(),
+		Issue:   number,
+		Details: details,
+	}
+}
+
+// jiraAudit describes a change of a Jira issue
+func jiraAudit(action, jiraKey string, details map[string]interface{}) audit.Entry {
+	return audit.Entry{
+		System:  audit.SystemJira,
+		Action:  action,
+		Target:  jiraKey,
+		JiraKey: jiraKey,
+		Details: details,
+	}
+}
+
+// fieldNames lists the names of Jira fields for audit details
+func fieldNames(fields map[string]interface{}) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,542 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/hooks"
+	"github.com/savitaashture/gh-jira/pkg/jira"
+	"github.com/savitaashture/gh-jira/pkg/state"
+	"github.com/savitaashture/gh-jira/pkg/summarizer"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// backfillProgress counts what the backfill did with the issues of a
+// repository
+type backfillProgress struct {
+	Repo string `json:"repo"`
+	Seen int    `json:"seen"`
+	// Existing counts issues that already have a Jira issue
+	Existing int `json:"existing"`
+	// Missing counts issues without a Jira issue; in a dry run nothing else
+	// is done with them
+	Missing int `json:"missing"`
+	Created int `json:"created"`
+	// Duplicates counts missing issues linked to the Jira issue of a
+	// duplicate instead
+	Duplicates int `json:"duplicates"`
+	// Queued counts issues queued for human approval
+	Queued  int `json:"queued"`
+	Skipped int `json:"skipped"`
+	Failed  int `json:"failed"`
+}
+
+// backfillReport is the output of `backfill`
+type backfillReport struct {
+	Since    time.Time           `json:"since"`
+	DryRun   bool                `json:"dry_run"`
+	Repos    []*backfillProgress `json:"repos"`
+	Failures []cycleFailure      `json:"failures,omitempty"`
+	// Error is set when the backfill stopped before walking all issues
+	Error string `json:"error,omitempty"`
+}
+
+// runBackfillCommand implements `gh-jira backfill`
+func runBackfillCommand(args []string) int {
+	fs := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("GH_JIRA_CONFIG"), "Path to an optional YAML configuration file")
+	since := fs.String("since", "", "Only backfill issues created on or after this date (YYYY-MM-DD or RFC 3339)")
+	repoName := fs.String("repo", "", "Only backfill this owner/name repository")
+	issueState := fs.String("state", "all", "Issues to backfill: open, closed or all")
+	rate := fs.Int("rate", 30, "Maximum Jira create requests per minute, 0 for no limit")
+	batch := fs.Int("batch", jira.MaxBulkIssues, fmt.Sprintf("Jira issues created per bulk request, at most %d; 1 creates them one by one", jira.MaxBulkIssues))
+	dryRun := fs.Bool("dry-run", false, "Only report the issues without a Jira issue")
+	notifyUsers := fs.Bool("notify", false, "Send Jira notifications and keep the automatic watchers")
+	output := outputFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return exitFatal
+	}
+	if err := validOutput(*output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	from, err := parseSince(*since)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	if *issueState != "open" && *issueState != "closed" && *issueState != "all" {
+		fmt.Fprintf(os.Stderr, "Error: invalid --state %q, expected open, closed or all\n", *issueState)
+		return exitFatal
+	}
+	if *rate < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --rate must not be negative\n")
+		return exitFatal
+	}
+	if *batch < 1 || *batch > jira.MaxBulkIssues {
+		fmt.Fprintf(os.Stderr, "Error: --batch must be between 1 and %d\n", jira.MaxBulkIssues)
+		return exitFatal
+	}
+
+	sum, err := setup(*configPath, 0, -1)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	defer store.Close()
+	if !*notifyUsers && !*dryRun {
+		log.Printf("Backfill mode: suppressing Jira notifications and automatic watchers")
+		quietJira()
+	}
+
+	// An interrupted backfill reports its progress; running it again
+	// continues where it stopped, as created issues are in the state store
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// Issues opened meanwhile are summarized first by a service sharing the
+	// models; within the backfill process, all summaries are bulk work
+	ctx = summarizer.WithPriority(ctx, summarizer.PriorityBackground)
+	client := newGitHubClient(ctx)
+	var repos []config.RepoConfig
+	if *repoName != "" {
+		repo, err := selectRepo(*repoName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitFatal
+		}
+		repos = []config.RepoConfig{repo}
+	} else if repos, err = repositories(ctx, client); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to list repositories: %v\n", err)
+		return exitFatal
+	}
+
+	b := &backfill{
+		client:  client,
+		sum:     sum,
+		since:   from,
+		state:   *issueState,
+		dryRun:  *dryRun,
+		batch:   *batch,
+		report:  &backfillReport{Since: from, DryRun: *dryRun, Repos: []*backfillProgress{}},
+		started: time.Now(),
+	}
+	if *rate > 0 && !*dryRun {
+		b.throttle = time.NewTicker(time.Minute / time.Duration(*rate))
+		defer b.throttle.Stop()
+	}
+	for _, repo := range repos {
+		if err := b.run(ctx, repo); err != nil {
+			log.Printf("Backfill stopped: %v", err)
+			b.report.Error = err.Error()
+			break
+		}
+	}
+
+	if err := writeOutput(os.Stdout, *output, b.report, b.report.writeTable); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	switch {
+	case b.report.Error != "":
+		return exitFatal
+	case len(b.report.Failures) > 0:
+		return exitPartialFailure
+	}
+	return exitOK
+}
+
+// parseSince parses the --since date
+func parseSince(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, fmt.Errorf("--since is required")
+	}
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --since %q, expected YYYY-MM-DD or RFC 3339", s)
+	}
+	return t.UTC(), nil
+}
+
+// backfill walks the historical issues of the watched repositories and
+// creates the missing Jira issues
+type backfill struct {
+	client *github.Client
+	sum    *summarizer.Summarizer
+	since  time.Time
+	state  string
+	dryRun bool
+	// batch is the number of Jira issues created per bulk request
+	batch int
+	// pending holds the payloads waiting for the next bulk request
+	pending []*pendingCreate
+	// throttle paces Jira create requests; nil for no limit
+	throttle *time.Ticker
+	report   *backfillReport
+	started  time.Time
+}
+
+// pendingCreate is a prepared Jira payload waiting for a bulk request
+type pendingCreate struct {
+	repo    config.RepoConfig
+	issue   *github.Issue
+	r       *state.Retry
+	p       *backfillProgress
+	mapping *state.Mapping
+	// unlock releases the claim of the issue
+	unlock func()
+}
+
+// run backfills one repository, oldest issues first. It returns an error
+// only when the backfill can't continue.
+func (b *backfill) run(ctx context.Context, repo config.RepoConfig) error {
+	p := &backfillProgress{Repo: repo.FullName()}
+	b.report.Repos = append(b.report.Repos, p)
+	log.Printf("Backfilling %s issues of %s created since %s", b.state, repo.FullName(), b.since.Format(time.DateOnly))
+
+	// Since filters on the update time, which is never before the creation
+	opt := &github.IssueListByRepoOptions{
+		State:       b.state,
+		Sort:        "created",
+		Direction:   "asc",
+		Since:       b.since,
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		if err := ghRateLimit.wait(ctx); err != nil {
+			return err
+		}
+		issues, resp, err := b.client.Issues.ListByRepo(ctx, repo.Owner, repo.Name, opt)
+		ghRateLimit.observe(resp, err)
+		if err != nil {
+			return fmt.Errorf("failed to list issues of %s: %w", repo.FullName(), err)
+		}
+
+		for _, issue := range issues {
+			if issue.IsPullRequest() || issue.GetCreatedAt().Before(b.since) {
+				continue
+			}
+			p.Seen++
+			if err := b.issue(ctx, repo, issue, p); err != nil {
+				if isFatal(ctx, err) {
+					return err
+				}
+				b.fail(repo, issue, p, err)
+			}
+		}
+		if err := b.flush(ctx); err != nil {
+			return err
+		}
+		b.logProgress(p)
+		// Links to issues created on this page are found on the next ones
+		resetMappingIndex()
+
+		if resp.NextPage == 0 {
+			return nil
+		}
+		opt.ListOptions.Page = resp.NextPage
+	}
+}
+
+// issue creates the Jira issue of a GitHub issue that has none
+func (b *backfill) issue(ctx context.Context, repo config.RepoConfig, issue *github.Issue, p *backfillProgress) error {
+	conf := cfg()
+	if conf.GitHub.SkipLabel != "" && hasLabel(issue, conf.GitHub.SkipLabel) {
+		p.Skipped++
+		return nil
+	}
+	key, err := issueKey(repo, issue)
+	if err != nil {
+		return &syncStageError{stage: "key", err: err}
+	}
+	if _, err := lookupMapping(ctx, key); err == nil {
+		p.Existing++
+		return nil
+	} else if !errors.Is(err, state.ErrNotFound) {
+		return &syncStageError{stage: "lookup", err: err}
+	}
+	if skipClosed(issue) {
+		p.Skipped++
+		return nil
+	}
+	if why := filteredOut(repo, issue); why != "" {
+		log.Printf("Skipping GitHub issue %s#%d as %s", repo.FullName(), issue.GetNumber(), why)
+		p.Skipped++
+		return nil
+	}
+	p.Missing++
+
+	// Issues waiting for a retry or an approval are handled by the service
+	if r, err := store.GetRetry(ctx, key); err == nil {
+		log.Printf("GitHub issue %s#%d is queued for retry after %d failed attempts, skipping", repo.FullName(), issue.GetNumber(), r.Attempts)
+		p.Skipped++
+		return nil
+	}
+	if conf.Approval.Required {
+		if a, err := findApproval(ctx, key); err != nil {
+			return &syncStageError{stage: "approval", err: err}
+		} else if a != nil {
+			p.Skipped++
+			return nil
+		}
+	}
+	if b.dryRun {
+		log.Printf("Dry run: GitHub issue %s#%d - %s has no Jira issue", repo.FullName(), issue.GetNumber(), issue.GetTitle())
+		return nil
+	}
+
+	if conf.Approval.Required {
+		if _, err := queueApproval(ctx, repo, issue, key, b.sum); err != nil {
+			return err
+		}
+		p.Queued++
+		return nil
+	}
+	claimed, unlock, err := claimIssue(ctx, key)
+	if errors.Is(err, errIssueBusy) || errors.Is(err, errIssueSynced) {
+		log.Printf("Skipping GitHub issue %s#%d: %v", repo.FullName(), issue.GetNumber(), err)
+		p.Skipped++
+		return nil
+	} else if err != nil {
+		return &syncStageError{stage: "lock", err: err}
+	}
+	// Sinks have no bulk API
+	if b.batch == 1 || repo.Sink != "" {
+		defer unlock()
+		if err := b.wait(claimed); err != nil {
+			return err
+		}
+		m, err := createAndRecord(claimed, b.client, repo, issue, key, b.sum)
+		if err != nil {
+			return err
+		}
+		if m.MergedInto != "" {
+			p.Duplicates++
+		} else {
+			p.Created++
+		}
+		return nil
+	}
+
+	r, dup, err := preparePayload(claimed, b.client, repo, issue, key, b.sum)
+	if err != nil || dup != nil {
+		unlock()
+		if dup != nil {
+			p.Duplicates++
+		}
+		return err
+	}
+	b.pending = append(b.pending, &pendingCreate{repo: repo, issue: issue, r: r, p: p, unlock: unlock})
+	if len(b.pending) >= b.batch {
+		return b.flush(ctx)
+	}
+	return nil
+}
+
+// wait paces Jira create requests
+func (b *backfill) wait(ctx context.Context) error {
+	if b.throttle == nil {
+		return nil
+	}
+	select {
+	case <-b.throttle.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flush creates the Jira issues of the pending payloads with one bulk
+// request per Jira instance. It returns an error only when the backfill
+// can't continue; failed issues are queued for retry.
+func (b *backfill) flush(ctx context.Context) error {
+	var instances []string
+	byInstance := make(map[string][]*pendingCreate)
+	for _, pc := range b.pending {
+		instance := cfg().Jira.Route(pc.repo, ruleIssue(pc.issue).Labels).Instance
+		if _, ok := byInstance[instance]; !ok {
+			instances = append(instances, instance)
+		}
+		byInstance[instance] = append(byInstance[instance], pc)
+	}
+	pending := b.pending
+	b.pending = nil
+	defer func() {
+		for _, pc := range pending {
+			pc.unlock()
+		}
+	}()
+	for _, instance := range instances {
+		if err := b.createBulk(ctx, instance, byInstance[instance]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createBulk creates the Jira issues of pending payloads of one Jira
+// instance in a bulk request and completes their syncs
+func (b *backfill) createBulk(ctx context.Context, instance string, items []*pendingCreate) error {
+	jc, err := jiraFor(instance)
+	if err != nil {
+		for _, pc := range items {
+			b.fail(pc.repo, pc.issue, pc.p, err)
+		}
+		return nil
+	}
+	var batch []*pendingCreate
+	var fieldsList []map[string]interface{}
+	for _, pc := range items {
+		fields, err := beforeJiraCreate(ctx, pc.repo, pc.issue, pc.r.Summary, pc.r.JiraFields)
+		if err != nil {
+			b.fail(pc.repo, pc.issue, pc.p, &syncStageError{stage: "hook", err: err})
+			continue
+		}
+		limitDescription(pc.issue, fields)
+		pc.r.JiraFields = fields
+		pc.mapping = newPendingMapping(pc.repo, pc.issue, pc.r.Key)
+		if jiraKey, err := recoverCreated(ctx, pc.mapping); err != nil {
+			b.fail(pc.repo, pc.issue, pc.p, err)
+			continue
+		} else if jiraKey != "" {
+			b.complete(ctx, pc, jiraKey)
+			continue
+		}
+		marked, err := recordPending(ctx, pc.mapping, pc.r.JiraFields)
+		if err != nil {
+			b.fail(pc.repo, pc.issue, pc.p, err)
+			continue
+		}
+		batch = append(batch, pc)
+		fieldsList = append(fieldsList, marked)
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	if err := b.wait(ctx); err != nil {
+		for _, pc := range batch {
+			dropPending(ctx, pc.r.Key)
+		}
+		return err
+	}
+
+	log.Printf("Creating %d Jira issues in one bulk request", len(batch))
+	jiraCtx, span := startSpan(ctx, "create_jira_issues", attribute.Int("jira.issues", len(batch)))
+	results, err := jc.CreateIssues(jiraCtx, fieldsList)
+	endSpan(span, err)
+	if err != nil {
+		for _, pc := range batch {
+			abandonPending(ctx, pc.mapping, err)
+		}
+		if isAuthError(err) {
+			return &fatalError{err: err}
+		}
+		for _, pc := range batch {
+			retryFailed(ctx, pc.issue, pc.r, err)
+			b.fail(pc.repo, pc.issue, pc.p, err)
+		}
+		return nil
+	}
+
+	for i, res := range results {
+		pc := batch[i]
+		if res.Err != nil {
+			var jerr *jira.Error
+			if errors.As(res.Err, &jerr) {
+				log.Printf("Jira rejected the issue of GitHub issue %s#%d: %s", pc.repo.FullName(), pc.issue.GetNumber(), jerr.Body)
+			}
+			dropPending(ctx, pc.r.Key)
+			retryFailed(ctx, pc.issue, pc.r, res.Err)
+			b.fail(pc.repo, pc.issue, pc.p, res.Err)
+			continue
+		}
+		b.complete(ctx, pc, res.Issue.Key)
+	}
+	return nil
+}
+
+// complete records the Jira issue created for a pending payload and
+// completes its sync
+func (b *backfill) complete(ctx context.Context, pc *pendingCreate, jiraKey string) {
+	if err := recordCreated(ctx, pc.repo, pc.issue, pc.mapping, jiraKey, pc.r.Summary, pc.r.JiraFields); err != nil {
+		b.fail(pc.repo, pc.issue, pc.p, err)
+		return
+	}
+	retrySucceeded(ctx, pc.r)
+	if err := publishSync(ctx, b.client, pc.repo, pc.issue, pc.mapping, pc.r.Warnings); err != nil {
+		b.fail(pc.repo, pc.issue, pc.p, err)
+		return
+	}
+	pc.p.Created++
+}
+
+// isFatal reports whether an error stops the backfill
+func isFatal(ctx context.Context, err error) bool {
+	var fatal *fatalError
+	return errors.As(err, &fatal) || isAuthError(err) || ctx.Err() != nil
+}
+
+// fail records the failed backfill of an issue; issues vetoed by a hook
+// are skipped
+func (b *backfill) fail(repo config.RepoConfig, issue *github.Issue, p *backfillProgress, err error) {
+	if errors.Is(err, hooks.ErrVeto) {
+		log.Printf("Skipping GitHub issue %s#%d: %v", repo.FullName(), issue.GetNumber(), err)
+		p.Skipped++
+		return
+	}
+	var stageErr *syncStageError
+	stage := "create"
+	if errors.As(err, &stageErr) {
+		stage = stageErr.stage
+	}
+	log.Printf("Failed to backfill GitHub issue %s#%d: %v", repo.FullName(), issue.GetNumber(), err)
+	p.Failed++
+	b.report.Failures = append(b.report.Failures, cycleFailure{Repo: repo.FullName(), Issue: issue.GetNumber(), Stage: stage, Error: err.Error()})
+}
+
+// logProgress logs the progress of a repository after each page of issues
+func (b *backfill) logProgress(p *backfillProgress) {
+	log.Printf("Backfill progress of %s after %s: %d issues seen, %d already synced, %d missing, %d created, %d duplicates, %d queued, %d skipped, %d failed",
+		p.Repo, time.Since(b.started).Round(time.Second), p.Seen, p.Existing, p.Missing, p.Created, p.Duplicates, p.Queued, p.Skipped, p.Failed)
+}
+
+// writeTable renders the backfill report for humans
+func (r *backfillReport) writeTable(out io.Writer) error {
+	if r.DryRun {
+		fmt.Fprintf(out, "Dry run of the backfill of issues created since %s\n\n", r.Since.Format(time.DateOnly))
+	} else {
+		fmt.Fprintf(out, "Backfill of issues created since %s\n\n", r.Since.Format(time.DateOnly))
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "REPO\tSEEN\tSYNCED\tMISSING\tCREATED\tDUPLICATES\tQUEUED\tSKIPPED\tFAILED")
+	for _, p := range r.Repos {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n",
+			p.Repo, p.Seen, p.Existing, p.Missing, p.Created, p.Duplicates, p.Queued, p.Skipped, p.Failed)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if len(r.Failures) > 0 {
+		fmt.Fprintln(out, "\nFailures:")
+		for _, f := range r.Failures {
+			fmt.Fprintf(out, "  %s#%d (%s): %s\n", f.Repo, f.Issue, f.Stage, f.Error)
+		}
+	}
+	if r.Error != "" {
+		fmt.Fprintf(out, "\nStopped early: %s\n", r.Error)
+	}
+	return nil
+}
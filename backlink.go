@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+// statusCommentMarker identifies the bot-managed sync status comment
+const statusCommentMarker = "<!-- gh-jira:sync-status -->"
+
+// backlinkMarker identifies the Jira link footer of an issue body
+const backlinkMarker = "<!-- gh-jira:backlink -->"
+
+// backlinkFooter matches the Jira link footers of an issue body, marked or
+// written before the marker was introduced, so that they are replaced
+// rather than stacked
+var backlinkFooter = regexp.MustCompile(`\s*(?:` + regexp.QuoteMeta(backlinkMarker) + `\s*)?---\r?\nLinked Jira Issue: \[[^\]\n]*\]\([^)\n]*\)`)
+
+// syncStatus is the information published to GitHub about a synced issue
+type syncStatus struct {
+	State    string
+	Warnings []string
+}
+
+// writeBacklink publishes the Jira link and sync status on the GitHub issue
+// using the backlink mode of its repository
+func writeBacklink(ctx context.Context, client *github.Client, repo config.RepoConfig, issue *github.Issue, m *state.Mapping, status syncStatus) error {
+	switch repo.BacklinkMode(cfg().GitHub.Backlink) {
+	case "none":
+		return nil
+	case "body":
+		return updateGitHubIssueWithJiraLink(ctx, client, repo, issue, m)
+	default:
+		return upsertStatusComment(ctx, client, repo, issue, m, status)
+	}
+}
+
+// markSyncedIssue applies the synced label and the Jira key title prefix to
+// the GitHub issue so that synced issues can be found by search and on
+// dashboards without opening them. Issues of restricted repositories
+// without back-links are left alone, as both show the Jira key.
+func markSyncedIssue(ctx context.Context, client *github.Client, repo config.RepoConfig, issue *github.Issue, jiraKey string) error {
+	conf := cfg()
+	if repo.Restricted() && repo.BacklinkMode(conf.GitHub.Backlink) == "none" {
+		return nil
+	}
+	if label := conf.GitHub.SyncedLabelFor(jiraKey); label != "" && !hasLabel(issue, label) {
+		if err := ghRateLimit.wait(ctx); err != nil {
+			return err
+		}
+		log.Printf("Adding label %q to GitHub issue #%d", label, issue.GetNumber())
+		_, resp, err := client.Issues.AddLabelsToIssue(ctx, repo.Owner, repo.Name, issue.GetNumber(), []string{label})
+		ghRateLimit.observe(resp, err)
+		if err != nil {
+			return fmt.Errorf("failed to add label %q: %w", label, err)
+		}
+		recordAudit(githubAudit("add_label", repo, issue.GetNumber(), map[string]interface{}{"label": label}))
+	}
+
+	prefix := "[" + jiraKey + "]"
+	if conf.GitHub.KeyInTitle && !strings.HasPrefix(issue.GetTitle(), prefix) {
+		title := prefix + " " + issue.GetTitle()
+		if err := ghRateLimit.wait(ctx); err != nil {
+			return err
+		}
+		log.Printf("Prefixing title of GitHub issue #%d with %s", issue.GetNumber(), prefix)
+		_, resp, err := client.Issues.Edit(ctx, repo.Owner, repo.Name, issue.GetNumber(), &github.IssueRequest{Title: &title})
+		ghRateLimit.observe(resp, err)
+		if err != nil {
+			return fmt.Errorf("failed to update title: %w", err)
+		}
+		recordAudit(githubAudit("edit_issue", repo, issue.GetNumber(), map[string]interface{}{"title": title}))
+	}
+	return nil
+}
+
+// renderStatusComment builds the body of the sync status comment
+func renderStatusComment(m *state.Mapping, status syncStatus) string {
+	var b strings.Builder
+	b.WriteString(statusCommentMarker + "\n")
+	fmt.Fprintf(&b, "### %s sync status\n\n", trackerName(m.JiraInstance))
+	b.WriteString("| | |\n|---|---|\n")
+	fmt.Fprintf(&b, "| %s issue | [%s](%s) |\n", trackerName(m.JiraInstance), m.JiraKey, jiraBrowseURL(m.JiraInstance, m.JiraKey))
+	fmt.Fprintf(&b, "| Status | %s |\n", status.State)
+	fmt.Fprintf(&b, "| Last sync | %s |\n", time.Now().UTC().Format("2006-01-02 15:04 MST"))
+	if len(status.Warnings) > 0 {
+		b.WriteString("\n**Warnings**\n\n")
+		for _, w := range status.Warnings {
+			fmt.Fprintf(&b, "- %s\n", w)
+		}
+	}
+	b.WriteString("\n<sub>This comment is maintained by gh-jira and updated in place.</sub>\n")
+	return b.String()
+}
+
+// upsertStatusComment creates or edits the single sync status comment on the
+// issue. The comment is found through the ID recorded in the mapping or,
+// failing that, by scanning the issue comments for the marker.
+func upsertStatusComment(ctx context.Context, client *github.Client, repo config.RepoConfig, issue *github.Issue, m *state.Mapping, status syncStatus) error {
+	body := renderStatusComment(m, status)
+	comment := &github.IssueComment{Body: &body}
+
+	commentID := m.StatusCommentID
+	if commentID == 0 {
+		id, err := findStatusComment(ctx, client, repo, issue.GetNumber())
+		if err != nil {
+			return err
+		}
+		commentID = id
+	}
+
+	if err := ghRateLimit.wait(ctx); err != nil {
+		return err
+	}
+	if commentID != 0 {
+		log.Printf("Updating sync status comment on GitHub issue #%d", issue.GetNumber())
+		_, resp, err := client.Issues.EditComment(ctx, repo.Owner, repo.Name, commentID, comment)
+		ghRateLimit.observe(resp, err)
+		if err == nil {
+			recordAudit(githubAudit("edit_comment", repo, issue.GetNumber(), map[string]interface{}{"comment_id": commentID}))
+			return recordStatusComment(ctx, m, commentID)
+		}
+		if resp == nil || resp.StatusCode != 404 {
+			return fmt.Errorf("failed to update sync status comment: %w", err)
+		}
+		log.Printf("Sync status comment on GitHub issue #%d was deleted, creating a new one", issue.GetNumber())
+	}
+
+	log.Printf("Creating sync status comment on GitHub issue #%d", issue.GetNumber())
+	created, resp, err := client.Issues.CreateComment(ctx, repo.Owner, repo.Name, issue.GetNumber(), comment)
+	ghRateLimit.observe(resp, err)
+	if err != nil {
+		return fmt.Errorf("failed to create sync status comment: %w", err)
+	}
+	recordAudit(githubAudit("create_comment", repo, issue.GetNumber(), map[string]interface{}{"comment_id": created.GetID()}))
+	return recordStatusComment(ctx, m, created.GetID())
+}
+
+// findStatusComment returns the ID of an existing sync status comment, or 0
+func findStatusComment(ctx context.Context, client *github.Client, repo config.RepoConfig, number int) (int64, error) {
+	opt := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		if err := ghRateLimit.wait(ctx); err != nil {
+			return 0, err
+		}
+		comments, resp, err := client.Issues.ListComments(ctx, repo.Owner, repo.Name, number, opt)
+		ghRateLimit.observe(resp, err)
+		if err != nil {
+			return 0, fmt.Errorf("failed to list comments: %w", err)
+		}
+		for _, c := range comments {
+			if strings.HasPrefix(c.GetBody(), statusCommentMarker) {
+				return c.GetID(), nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return 0, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// recordStatusComment stores the status comment ID in the mapping
+func recordStatusComment(ctx context.Context, m *state.Mapping, commentID int64) error {
+	if m.StatusCommentID == commentID {
+		return nil
+	}
+	m.StatusCommentID = commentID
+	m.UpdatedAt = time.Now().UTC()
+	return store.Put(ctx, m)
+}
+
+// withJiraLink returns body ending with the Jira link footer of m, replacing
+// any footer it already has
+func withJiraLink(body string, m *state.Mapping) string {
+	body = strings.TrimRight(backlinkFooter.ReplaceAllString(body, ""), " \t\r\n")
+	if body != "" {
+		body += "\n\n"
+	}
+	return body + fmt.Sprintf("%s\n---\nLinked Jira Issue: [%s](%s)", backlinkMarker, m.JiraKey, jiraBrowseURL(m.JiraInstance, m.JiraKey))
+}
+
+// updateGitHubIssueWithJiraLink adds the Jira link to the issue description,
+// replacing the link of an earlier sync
+func updateGitHubIssueWithJiraLink(ctx context.Context, client *github.Client, repo config.RepoConfig, issue *github.Issue, m *state.Mapping) error {
+	jiraKey := m.JiraKey
+	newDescription := withJiraLink(issue.GetBody(), m)
+	if newDescription == issue.GetBody() {
+		log.Printf("GitHub issue #%d already links to Jira issue %s", issue.GetNumber(), jiraKey)
+		return nil
+	}
+	log.Printf("Updating GitHub issue #%d with Jira issue link %s", issue.GetNumber(), jiraKey)
+
+	// Update the GitHub issue
+	updatedIssue := &github.IssueRequest{
+		Body: &newDescription,
+	}
+
+	if err := ghRateLimit.wait(ctx); err != nil {
+		return err
+	}
+	log.Printf("Sending update request to GitHub for issue #%d", issue.GetNumber())
+	_, resp, err := client.Issues.Edit(ctx, repo.Owner, repo.Name, issue.GetNumber(), updatedIssue)
+	ghRateLimit.observe(resp, err)
+	if err != nil {
+		log.Printf("Failed to update GitHub issue #%d: %v", issue.GetNumber(), err)
+		return fmt.Errorf("failed to update GitHub issue: %w", err)
+	}
+	recordAudit(githubAudit("edit_issue", repo, issue.GetNumber(), map[string]interface{}{"body": "linked to " + jiraKey}))
+
+	log.Printf("Successfully updated GitHub issue #%d with Jira link", issue.GetNumber())
+	return nil
+}
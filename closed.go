@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+// skipClosed reports whether the closed issue policy skips the issue
+func skipClosed(issue *github.Issue) bool {
+	return issue.GetState() == "closed" && cfg().GitHub.ClosedIssues == config.ClosedSkip
+}
+
+// closeJiraIssue moves the Jira issue created for a closed GitHub issue to a
+// done status if the closed issue policy asks for it
+func closeJiraIssue(ctx context.Context, repo config.RepoConfig, issue *github.Issue, m *state.Mapping) error {
+	conf := cfg()
+	if issue.GetState() != "closed" || conf.GitHub.ClosedIssues != config.ClosedDone {
+		return nil
+	}
+	jc, err := jiraFor(m.JiraInstance)
+	if err != nil {
+		return err
+	}
+	t, err := transitionToCategory(ctx, jc, repo, issue, m.JiraKey, "done", conf.GitHub.ClosedResolution)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return fmt.Errorf("Jira issue %s has no transition to a done status", m.JiraKey)
+	}
+	log.Printf("Moved Jira issue %s of closed GitHub issue #%d to %s", m.JiraKey, issue.GetNumber(), t.To.Name)
+	return nil
+}
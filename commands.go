@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// command is a gh-jira subcommand. It receives the arguments following the
+// subcommand name and returns the process exit code.
+type command struct {
+	description string
+	run         func(args []string) int
+}
+
+var commands = map[string]command{
+	"approvals":     {"Review, approve or reject Jira issues awaiting approval", runApprovalsCommand},
+	"backfill":      {"Create Jira issues for historical GitHub issues", runBackfillCommand},
+	"reconcile":     {"Detect and repair drift between GitHub, Jira and the sync state", runReconcileCommand},
+	"release-notes": {"Generate release notes from merged pull requests", runReleaseNotesCommand},
+	"retries":       {"List, retry or drop Jira creations that failed", runRetriesCommand},
+	"rules":         {"Evaluate the field-mapping rules file against fixture issues", runRulesCommand},
+	"snapshots":     {"Show what each sync action wrote to Jira and how it changed", runSnapshotsCommand},
+	"state":         {"Inspect the GitHub to Jira mappings and merge duplicates", runStateCommand},
+	"summarize":     {"Print the AI summary of an issue without touching Jira", runSummarizeCommand},
+	"validate":      {"Check the configuration, templates and credentials", runValidateCommand},
+}
+
+// dispatch runs the subcommand named by args[0]. It reports false if args
+// does not start with a known subcommand, in which case the sync service
+// should be started.
+func dispatch(args []string) (int, bool) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return 0, false
+	}
+	if args[0] == "help" {
+		printUsage()
+		return exitOK, true
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+		printUsage()
+		return exitFatal, true
+	}
+	return cmd.run(args[1:]), true
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: gh-jira [flags]          run the sync service\n")
+	fmt.Fprintf(os.Stderr, "       gh-jira <command> [args]\n\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", name, commands[name].description)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/jira"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+// jiraCommentMarker starts the GitHub comments mirrored from Jira
+const jiraCommentMarker = "<!-- gh-jira:jira-comment -->"
+
+// githubCommentPrefix starts the Jira comments mirrored from GitHub. Jira
+// has no hidden markup, so the marker is the visible attribution line.
+const githubCommentPrefix = "Mirrored from GitHub: "
+
+// mirroredComments records the comments of a mapping seen in each system.
+// Comment IDs grow in both systems, so comments with higher IDs are new.
+type mirroredComments struct {
+	GitHub int64 `json:"github"`
+	Jira   int64 `json:"jira"`
+}
+
+// commentsCursor returns the cursor of the mirrored comments of a mapping
+func commentsCursor(key string) string {
+	return "comments:" + key
+}
+
+// syncComments mirrors the comments added to a GitHub issue to its Jira
+// issue and the other way round. Comments written by gh-jira are never
+// mirrored: they carry a marker, and on Jira are also told apart by their
+// author, so mirrored comments don't bounce between the systems. When a
+// mapping is first seen, only comments added from then on are mirrored.
+func syncComments(ctx context.Context, client *github.Client, repo config.RepoConfig, issue *github.Issue, m *state.Mapping) error {
+	cc := cfg().Jira.Comments
+	if !cc.Enabled || m.JiraKey == "" {
+		return nil
+	}
+	jc, err := jiraFor(m.JiraInstance)
+	if err != nil {
+		return err
+	}
+	var seen mirroredComments
+	stored, err := store.GetCursor(ctx, commentsCursor(m.Key))
+	if err != nil {
+		return err
+	}
+	if stored != "" {
+		if err := json.Unmarshal([]byte(stored), &seen); err != nil {
+			return fmt.Errorf("invalid mirrored comments of %s: %w", m.Key, err)
+		}
+	}
+	save := func() error {
+		data, _ := json.Marshal(seen)
+		return store.SetCursor(ctx, commentsCursor(m.Key), string(data))
+	}
+
+	var ghComments []*github.IssueComment
+	if issue.GetComments() > 0 {
+		if ghComments, err = listComments(ctx, client, repo, issue.GetNumber()); err != nil {
+			return err
+		}
+	}
+	// Comments mirrored to Jira below are listed on the next poll, and
+	// skipped like any other comment of gh-jira
+	jiraComments, err := jc.Comments(ctx, m.JiraKey)
+	if err != nil {
+		return fmt.Errorf("failed to list comments of %s: %w", m.JiraKey, err)
+	}
+	if stored == "" {
+		for _, c := range ghComments {
+			seen.GitHub = max(seen.GitHub, c.GetID())
+		}
+		for _, c := range jiraComments {
+			seen.Jira = max(seen.Jira, jiraCommentID(c))
+		}
+		return save()
+	}
+
+	for _, c := range ghComments {
+		if c.GetID() <= seen.GitHub {
+			continue
+		}
+		if cc.ToJira() && !isBotComment(c.GetBody()) {
+			if err := mirrorToJira(ctx, jc, repo, issue, m, c); err != nil {
+				return err
+			}
+		}
+		seen.GitHub = c.GetID()
+		if err := save(); err != nil {
+			return err
+		}
+	}
+
+	me, err := jc.Myself(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get the Jira user of gh-jira: %w", err)
+	}
+	for _, c := range jiraComments {
+		id := jiraCommentID(c)
+		if id <= seen.Jira {
+			continue
+		}
+		if cc.ToGitHub() && !isOwnJiraComment(c, me) {
+			if err := mirrorToGitHub(ctx, client, repo, issue, m, c); err != nil {
+				return err
+			}
+		}
+		seen.Jira = id
+		if err := save(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// botMarkerPrefix starts the hidden markers of all comments gh-jira writes
+// on GitHub, such as jiraCommentMarker and statusCommentMarker
+const botMarkerPrefix = "<!-- gh-jira:"
+
+// isBotComment reports whether a GitHub comment was written by gh-jira or
+// is a comment command addressed to it
+func isBotComment(body string) bool {
+	return strings.HasPrefix(body, botMarkerPrefix) || isCommand(body)
+}
+
+// isOwnJiraComment reports whether a Jira comment was written by gh-jira,
+// authenticated as me
+func isOwnJiraComment(c *jira.Comment, me *jira.User) bool {
+	if strings.HasPrefix(c.Body, githubCommentPrefix) {
+		return true
+	}
+	if c.Author == nil || me == nil {
+		return false
+	}
+	if me.AccountID != "" {
+		return c.Author.AccountID == me.AccountID
+	}
+	return me.Name != "" && c.Author.Name == me.Name
+}
+
+// jiraCommentID returns the numeric ID of a Jira comment
+func jiraCommentID(c *jira.Comment) int64 {
+	id, _ := strconv.ParseInt(c.ID, 10, 64)
+	return id
+}
+
+// mirrorToJira adds a GitHub comment to the Jira issue of its issue
+func mirrorToJira(ctx context.Context, jc *jira.Client, repo config.RepoConfig, issue *github.Issue, m *state.Mapping, c *github.IssueComment) error {
+	body := fmt.Sprintf("%s[comment by @%s|%s]\n\n%s", githubCommentPrefix, c.GetUser().GetLogin(), c.GetHTMLURL(),
+		mentionsToJira(jc, redactor.Redact(c.GetBody())))
+	log.Printf("Mirroring comment %d of GitHub issue #%d to Jira issue %s", c.GetID(), issue.GetNumber(), m.JiraKey)
+	id, err := jc.AddComment(ctx, m.JiraKey, body)
+	if err != nil {
+		return fmt.Errorf("failed to mirror GitHub comment %d to %s: %w", c.GetID(), m.JiraKey, err)
+	}
+	e := jiraAudit("create_comment", m.JiraKey, map[string]interface{}{"comment_id": id, "github_comment_id": c.GetID()})
+	e.Repo, e.Issue = repo.FullName(), issue.GetNumber()
+	recordAudit(e)
+	return nil
+}
+
+// mirrorToGitHub adds a Jira comment to the GitHub issue of its Jira issue
+func mirrorToGitHub(ctx context.Context, client *github.Client, repo config.RepoConfig, issue *github.Issue, m *state.Mapping, c *jira.Comment) error {
+	author := "Someone"
+	if c.Author != nil && c.Author.DisplayName != "" {
+		author = c.Author.DisplayName
+	}
+	body := fmt.Sprintf("%s\n**%s** commented on [%s](%s):\n\n%s", jiraCommentMarker, author, m.JiraKey,
+		jiraBrowseURL(m.JiraInstance, m.JiraKey), mentionsToGitHub(c.Body))
+	log.Printf("Mirroring comment %s of Jira issue %s to GitHub issue #%d", c.ID, m.JiraKey, issue.GetNumber())
+	if err := ghRateLimit.wait(ctx); err != nil {
+		return err
+	}
+	created, resp, err := client.Issues.CreateComment(ctx, repo.Owner, repo.Name, issue.GetNumber(), &github.IssueComment{Body: &body})
+	ghRateLimit.observe(resp, err)
+	if err != nil {
+		return fmt.Errorf("failed to mirror Jira comment %s to GitHub issue #%d: %w", c.ID, issue.GetNumber(), err)
+	}
+	recordAudit(githubAudit("create_comment", repo, issue.GetNumber(), map[string]interface{}{"comment_id": created.GetID(), "jira_comment_id": c.ID}))
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/hooks"
+	"github.com/savitaashture/gh-jira/pkg/jira"
+	"github.com/savitaashture/gh-jira/pkg/sink"
+)
+
+// Exit codes used in --once mode so CI wrappers can branch on the outcome
+const (
+	exitOK             = 0
+	exitPartialFailure = 1
+	exitFatal          = 2
+)
+
+// Cycle status values reported in the JSON result summary
+const (
+	statusSuccess        = "success"
+	statusPartialFailure = "partial_failure"
+	statusFatal          = "fatal"
+)
+
+// cycleFailure describes a single issue that could not be synced
+type cycleFailure struct {
+	Repo  string `json:"repo,omitempty"`
+	Issue int    `json:"issue,omitempty"`
+	Stage string `json:"stage"`
+	Error string `json:"error"`
+}
+
+// cycleResult collects the outcome of a single poll cycle. The pipeline
+// stages update it concurrently, so counters are changed through inc and
+// failures through fail.
+type cycleResult struct {
+	mu sync.Mutex
+
+	Status     string    `json:"status"`
+	ExitCode   int       `json:"exit_code"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	IssuesSeen int       `json:"issues_seen"`
+	Created    int       `json:"created"`
+	Skipped    int       `json:"skipped"`
+	// Queued counts issues queued for human approval
+	Queued int `json:"queued"`
+	// Published counts the Jira issues published to GitHub
+	Published int `json:"published,omitempty"`
+	// Transferred counts the synced issues found transferred to another
+	// repository, whose mappings were moved
+	Transferred int `json:"transferred,omitempty"`
+	// Retried counts the created issues that had failed before, and
+	// PermanentlyFailed the issues that ran out of retries
+	Retried           int            `json:"retried"`
+	PermanentlyFailed int            `json:"permanently_failed"`
+	Failed            int            `json:"failed"`
+	Failures          []cycleFailure `json:"failures,omitempty"`
+	Error             string         `json:"error,omitempty"`
+}
+
+func newCycleResult() *cycleResult {
+	return &cycleResult{StartedAt: time.Now().UTC()}
+}
+
+// inc increments one of the counters of r
+func (r *cycleResult) inc(counter *int) {
+	r.add(counter, 1)
+}
+
+// add adds n to one of the counters of r
+func (r *cycleResult) add(counter *int, n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	*counter += n
+}
+
+// fail records a per-issue failure. Issues vetoed by a hook are counted as
+// skipped instead.
+func (r *cycleResult) fail(repo string, issue int, stage string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if errors.Is(err, hooks.ErrVeto) {
+		log.Printf("Skipping GitHub issue %s#%d: %v", repo, issue, err)
+		r.Skipped++
+		return
+	}
+	r.Failed++
+	r.Failures = append(r.Failures, cycleFailure{Repo: repo, Issue: issue, Stage: stage, Error: err.Error()})
+}
+
+// fatal marks the whole cycle as failed because of a config or auth problem
+func (r *cycleResult) fatal(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Error = err.Error()
+	r.Status = statusFatal
+}
+
+// finish computes the final status and exit code
+func (r *cycleResult) finish() *cycleResult {
+	r.FinishedAt = time.Now().UTC()
+	switch {
+	case r.Status == statusFatal:
+		r.ExitCode = exitFatal
+	case r.Failed > 0:
+		r.Status = statusPartialFailure
+		r.ExitCode = exitPartialFailure
+	default:
+		r.Status = statusSuccess
+		r.ExitCode = exitOK
+	}
+	return r
+}
+
+// writeJSON prints the machine-readable result summary
+func (r *cycleResult) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// fatalError wraps errors that should abort the cycle instead of being
+// counted as per-issue failures
+type fatalError struct {
+	err error
+}
+
+func (e *fatalError) Error() string { return e.err.Error() }
+func (e *fatalError) Unwrap() error { return e.err }
+
+// isAuthError reports whether err is an authentication or authorization
+// failure from GitHub, Jira or a sink
+func isAuthError(err error) bool {
+	var ghErr *github.ErrorResponse
+	if errors.As(err, &ghErr) && ghErr.Response != nil {
+		return ghErr.Response.StatusCode == http.StatusUnauthorized || ghErr.Response.StatusCode == http.StatusForbidden
+	}
+	var jiraErr *jira.Error
+	if errors.As(err, &jiraErr) {
+		return jiraErr.StatusCode == http.StatusUnauthorized || jiraErr.StatusCode == http.StatusForbidden
+	}
+	return sink.IsAuthError(err)
+}
+
+// logCycleResult writes a one-line summary of the cycle to the log
+func logCycleResult(r *cycleResult) {
+	log.Printf("Cycle finished with status %s: %d seen, %d created (%d retried), %d skipped, %d queued, %d failed, %d permanently failing",
+		r.Status, r.IssuesSeen, r.Created, r.Retried, r.Skipped, r.Queued, r.Failed, r.PermanentlyFailed)
+}
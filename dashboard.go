@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/savitaashture/gh-jira/pkg/state"
+	"github.com/savitaashture/gh-jira/pkg/summarizer"
+)
+
+// cycleHistorySize is the number of poll cycles shown on the dashboard
+const cycleHistorySize = 50
+
+// cycleHistory keeps the results of the latest poll cycles
+type cycleHistory struct {
+	mu      sync.Mutex
+	results []*cycleResult
+}
+
+// recentCycles is filled by the poll loop and shown on the dashboard
+var recentCycles = &cycleHistory{}
+
+// add records a finished cycle, dropping the oldest beyond cycleHistorySize
+func (h *cycleHistory) add(r *cycleResult) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.results = append(h.results, r)
+	if len(h.results) > cycleHistorySize {
+		h.results = h.results[len(h.results)-cycleHistorySize:]
+	}
+}
+
+// list returns the recorded cycles, newest first
+func (h *cycleHistory) list() []*cycleResult {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]*cycleResult, len(h.results))
+	for i, r := range h.results {
+		out[len(out)-1-i] = r
+	}
+	return out
+}
+
+// dashboardStatus is the document served at /status.json
+type dashboardStatus struct {
+	// Role is "leader" or "follower" with leader election, otherwise empty
+	Role string `json:"role,omitempty"`
+	// Cycles are the latest poll cycles, newest first
+	Cycles []*cycleResult `json:"cycles"`
+	// Failures are the issues that failed in the latest cycle
+	Failures []cycleFailure `json:"failures"`
+	// Retries are the Jira creations waiting to be retried or given up on
+	Retries []*state.Retry `json:"retries"`
+	// Mappings are the synced issues, most recently synced first
+	Mappings []*state.Mapping `json:"mappings"`
+	// Models are the generation statistics of the summarizer models
+	Models []summarizer.ModelMetrics `json:"models"`
+}
+
+// dashboard serves the web UI of the sync service
+type dashboard struct {
+	sum *summarizer.Summarizer
+	// actionMu serializes retries and re-syncs started from the UI
+	actionMu sync.Mutex
+}
+
+// serveDashboard serves the dashboard if a dashboard token is configured,
+// and the REST management API if an API token is configured, on addr until
+// the process exits
+func serveDashboard(addr string, sum *summarizer.Summarizer) {
+	conf := cfg()
+	d := &dashboard{sum: sum}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", d.handleMetrics)
+	if conf.Server.DashboardToken != "" {
+		auth := func(h http.HandlerFunc) http.Handler { return requireDashboardToken(conf.Server.DashboardToken, h) }
+		mux.Handle("GET /{$}", auth(d.handleIndex))
+		mux.Handle("GET /status.json", auth(d.handleStatus))
+		mux.Handle("POST /retry", auth(d.handleRetry))
+		mux.Handle("POST /resync", auth(d.handleResync))
+	} else {
+		log.Printf("No dashboard token configured, serving only the metrics, webhooks and APIs")
+	}
+	for _, src := range conf.Sources {
+		if src.WebhookSecret != "" {
+			mux.HandleFunc("POST /webhooks/{source}", d.handleSourceWebhook)
+			log.Printf("Receiving webhooks of sources under /webhooks")
+			break
+		}
+	}
+	if conf.Server.APIToken != "" {
+		d.registerAPI(mux, conf.Server.APIToken)
+		log.Printf("Serving the REST management API under /api/v1")
+	}
+	if conf.Server.DebugToken != "" {
+		d.registerDebug(mux, conf.Server.DebugToken)
+		log.Printf("Serving the debug endpoints under /debug")
+	}
+
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	log.Printf("Serving the dashboard on %s", addr)
+	if err := srv.ListenAndServe(); err != nil {
+		log.Printf("Dashboard server stopped: %v", err)
+	}
+}
+
+// status collects the current state of the sync service
+func (d *dashboard) status(ctx context.Context) (*dashboardStatus, error) {
+	st := &dashboardStatus{Cycles: recentCycles.list(), Failures: []cycleFailure{}, Models: d.sum.Metrics()}
+	switch {
+	case isFollower():
+		st.Role = "follower"
+	case elector != nil:
+		st.Role = "leader"
+	}
+	if len(st.Cycles) > 0 && st.Cycles[0].Failures != nil {
+		st.Failures = st.Cycles[0].Failures
+	}
+
+	var err error
+	if st.Retries, err = store.ListRetries(ctx); err != nil {
+		return nil, err
+	}
+	mappings, err := store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	st.Mappings = make([]*state.Mapping, 0, len(mappings))
+	for _, m := range mappings {
+		if m.MergedInto == "" {
+			st.Mappings = append(st.Mappings, m)
+		}
+	}
+	sort.Slice(st.Mappings, func(i, j int) bool { return st.Mappings[i].LastSyncedAt.After(st.Mappings[j].LastSyncedAt) })
+	return st, nil
+}
+
+func (d *dashboard) handleStatus(w http.ResponseWriter, r *http.Request) {
+	st, err := d.status(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(st); err != nil {
+		log.Printf("Failed to write dashboard status: %v", err)
+	}
+}
+
+func (d *dashboard) handleIndex(w http.ResponseWriter, r *http.Request) {
+	st, err := d.status(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := struct {
+		*dashboardStatus
+		Message string
+	}{st, r.URL.Query().Get("msg")}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, data); err != nil {
+		log.Printf("Failed to render dashboard: %v", err)
+	}
+}
+
+// handleRetry makes a failed Jira creation due immediately
+func (d *dashboard) handleRetry(w http.ResponseWriter, r *http.Request) {
+	if !sameOrigin(r) {
+		http.Error(w, "cross-origin request refused", http.StatusForbidden)
+		return
+	}
+	key := r.FormValue("key")
+	d.actionMu.Lock()
+	defer d.actionMu.Unlock()
+	msg := fmt.Sprintf("Queued %s for retry in the next poll cycle.", key)
+	if _, err := resetRetry(r.Context(), store, key); err != nil {
+		msg = fmt.Sprintf("Retry of %s failed: %v", key, err)
+	}
+	log.Printf("Dashboard: %s", msg)
+	redirectWithMessage(w, r, msg)
+}
+
+// handleResync creates or re-syncs the Jira issue of an issue right away
+func (d *dashboard) handleResync(w http.ResponseWriter, r *http.Request) {
+	if !sameOrigin(r) {
+		http.Error(w, "cross-origin request refused", http.StatusForbidden)
+		return
+	}
+	key := r.FormValue("key")
+	if isFollower() {
+		redirectWithMessage(w, r, fmt.Sprintf("Re-sync of %s refused: this replica is not the leader.", key))
+		return
+	}
+	d.actionMu.Lock()
+	defer d.actionMu.Unlock()
+	ctx, cancel := context.WithTimeout(r.Context(), cfg().Summarizer.Timeout+time.Minute)
+	defer cancel()
+	msg, err := d.resync(ctx, key)
+	if err != nil {
+		msg = fmt.Sprintf("Re-sync of %s failed: %v", key, err)
+	}
+	log.Printf("Dashboard: %s", msg)
+	redirectWithMessage(w, r, msg)
+}
+
+// resync looks up the GitHub issue of key in the mappings or the retry
+// queue and syncs it on demand
+func (d *dashboard) resync(ctx context.Context, key string) (string, error) {
+	var repoName string
+	var number int
+	if m, err := state.Resolve(ctx, store, key); err == nil {
+		if isDiscussion(m) || fromSource(m.Repo) {
+			return "", fmt.Errorf("%s is not a GitHub issue, only GitHub issues can be re-synced", key)
+		}
+		repoName, number = m.Repo, m.IssueNumber
+	} else if !errors.Is(err, state.ErrNotFound) {
+		return "", err
+	} else if rt, err := store.GetRetry(ctx, key); err == nil {
+		repoName, number = rt.Repo, rt.IssueNumber
+	} else {
+		return "", fmt.Errorf("no mapping or retry of %s: %w", key, err)
+	}
+
+	_, msg, err := syncIssueNumber(ctx, repoName, number, d.sum)
+	return msg, err
+}
+
+// errIssueNotFound is returned for GitHub issues that don't exist
+var errIssueNotFound = errors.New("GitHub issue not found")
+
+// syncIssueNumber creates or re-syncs the Jira issue of an issue of the
+// repository named owner/name on demand. It returns the canonical key of the
+// issue and a description of the outcome.
+func syncIssueNumber(ctx context.Context, repoName string, number int, sum *summarizer.Summarizer) (string, string, error) {
+	client := newGitHubClient(ctx)
+	repo, err := findRepo(ctx, client, repoName)
+	if err != nil {
+		return "", "", err
+	}
+	if err := ghRateLimit.wait(ctx); err != nil {
+		return "", "", err
+	}
+	issue, resp, err := client.Issues.Get(ctx, repo.Owner, repo.Name, number)
+	ghRateLimit.observe(resp, err)
+	if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone) {
+		return "", "", fmt.Errorf("%w: %s#%d", errIssueNotFound, repo.FullName(), number)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get issue #%d of %s: %w", number, repo.FullName(), err)
+	}
+	if issue.IsPullRequest() {
+		return "", "", fmt.Errorf("%w: %s#%d is a pull request", errIssueNotFound, repo.FullName(), number)
+	}
+	key, err := issueKey(repo, issue)
+	if err != nil {
+		return "", "", err
+	}
+	log.Printf("Syncing %s#%d on request", repo.FullName(), number)
+	reply, err := syncOnDemand(ctx, client, repo, issue, key, sum, newCycleResult())
+	if err != nil {
+		return key, "", err
+	}
+	return key, markdownLinkPattern.ReplaceAllString(reply, "$1"), nil
+}
+
+// markdownLinkPattern matches the Markdown links of command replies
+var markdownLinkPattern = regexp.MustCompile(`\[([^\]]+)\]\([^)]+\)`)
+
+// requireDashboardToken rejects requests that don't send the dashboard
+// token, either as a bearer token or as the password of basic auth so that
+// browsers can prompt for it
+func requireDashboardToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			_, got, ok = r.BasicAuth()
+		}
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="gh-jira dashboard"`)
+			http.Error(w, "missing or invalid dashboard token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sameOrigin refuses form posts from other sites, which could otherwise
+// trigger actions through the browser of an operator
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return r.Header.Get("Sec-Fetch-Site") != "cross-site"
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// redirectWithMessage sends the browser back to the dashboard showing msg
+func redirectWithMessage(w http.ResponseWriter, r *http.Request, msg string) {
+	http.Redirect(w, r, "/?msg="+url.QueryEscape(msg), http.StatusSeeOther)
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"time": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.Local().Format("2006-01-02 15:04:05")
+	},
+	"browse": jiraBrowseURL,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="60">
+<title>gh-jira</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+.msg { background: #eef; padding: 8px; }
+.fatal, .partial_failure, .failed { color: #b00; }
+form { display: inline; }
+</style>
+</head>
+<body>
+<h1>gh-jira</h1>
+{{with .Message}}<p class="msg">{{.}}</p>{{end}}
+
+<h2>Poll cycles</h2>
+<table>
+<tr><th>Started</th><th>Status</th><th>Seen</th><th>Created</th><th>Skipped</th><th>Queued</th><th>Retried</th><th>Failed</th><th>Error</th></tr>
+{{range .Cycles}}<tr><td>{{time .StartedAt}}</td><td class="{{.Status}}">{{.Status}}</td><td>{{.IssuesSeen}}</td><td>{{.Created}}</td><td>{{.Skipped}}</td><td>{{.Queued}}</td><td>{{.Retried}}</td><td>{{.Failed}}</td><td>{{.Error}}</td></tr>
+{{else}}<tr><td colspan="9">No poll cycle has finished yet</td></tr>
+{{end}}</table>
+
+<h2>Failures in the latest cycle</h2>
+<table>
+<tr><th>Issue</th><th>Stage</th><th>Error</th></tr>
+{{range .Failures}}<tr><td>{{.Repo}}#{{.Issue}}</td><td>{{.Stage}}</td><td>{{.Error}}</td></tr>
+{{else}}<tr><td colspan="3">None</td></tr>
+{{end}}</table>
+
+<h2>Retry queue</h2>
+<table>
+<tr><th>Issue</th><th>Status</th><th>Attempts</th><th>Next attempt</th><th>Last error</th><th></th></tr>
+{{range .Retries}}<tr><td>{{.Repo}}#{{.IssueNumber}} {{.Title}}</td><td class="{{.Status}}">{{.Status}}</td><td>{{.Attempts}}</td><td>{{time .NextAttemptAt}}</td><td>{{.LastError}}</td>
+<td><form method="post" action="/retry"><input type="hidden" name="key" value="{{.Key}}"><button>Retry</button></form>
+<form method="post" action="/resync"><input type="hidden" name="key" value="{{.Key}}"><button>Sync now</button></form></td></tr>
+{{else}}<tr><td colspan="6">Empty</td></tr>
+{{end}}</table>
+
+<h2>Models</h2>
+<table>
+<tr><th>Model</th><th>Generations</th><th>Failures</th><th>Tokens/s</th><th>Running</th><th>Waiting</th></tr>
+{{range .Models}}<tr><td>{{.Model}}</td><td>{{.Generations}}</td><td>{{.Failures}}</td><td>{{printf "%.1f" .TokensPerSecond}}</td><td>{{.Running}}</td><td>{{.Waiting}}</td></tr>
+{{else}}<tr><td colspan="6">No summary generated yet</td></tr>
+{{end}}</table>
+
+<h2>Mappings</h2>
+<table>
+<tr><th>Issue</th><th>Jira</th><th>Status</th><th>Last synced</th><th></th></tr>
+{{range .Mappings}}<tr><td>{{.Repo}}#{{.IssueNumber}}</td><td>{{if .JiraKey}}<a href="{{browse .JiraInstance .JiraKey}}">{{.JiraKey}}</a>{{end}}</td><td>{{.SyncStatus}}</td><td>{{time .LastSyncedAt}}</td>
+<td><form method="post" action="/resync"><input type="hidden" name="key" value="{{.Key}}"><button>Re-sync</button></form></td></tr>
+{{else}}<tr><td colspan="5">No issues synced yet</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
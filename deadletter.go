@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+// deadLetterMarker identifies the comment explaining why an issue stopped
+// syncing
+const deadLetterMarker = "<!-- gh-jira:dead-letter -->"
+
+// apiDeadLetters is the response to GET /api/v1/dead-letters
+type apiDeadLetters struct {
+	// DeadLetters are the Jira creations that ran out of attempts
+	DeadLetters []*state.Retry `json:"dead_letters"`
+}
+
+// deadLetters returns the retries that ran out of attempts
+func deadLetters(ctx context.Context) ([]*state.Retry, error) {
+	retries, err := store.ListRetries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var dead []*state.Retry
+	for _, r := range retries {
+		if r.Status == state.RetryFailed {
+			dead = append(dead, r)
+		}
+	}
+	return dead, nil
+}
+
+// markDeadLetter labels the GitHub issue of a retry that ran out of
+// attempts with the failed label and explains the error in a comment.
+// Failures are only logged as the retry is recorded either way.
+func markDeadLetter(ctx context.Context, issue *github.Issue, r *state.Retry) {
+	label := cfg().Retry.FailedLabel
+	if label == "" {
+		return
+	}
+	client := newGitHubClient(ctx)
+	repo, err := findRepo(ctx, client, r.Repo)
+	if err != nil {
+		log.Printf("Failed to label permanently failing GitHub issue #%d: %v", r.IssueNumber, err)
+		return
+	}
+	if !hasLabel(issue, label) {
+		if err := ghRateLimit.wait(ctx); err != nil {
+			return
+		}
+		log.Printf("Adding label %q to permanently failing GitHub issue #%d", label, r.IssueNumber)
+		_, resp, err := client.Issues.AddLabelsToIssue(ctx, repo.Owner, repo.Name, r.IssueNumber, []string{label})
+		ghRateLimit.observe(resp, err)
+		if err != nil {
+			log.Printf("Failed to add label %q to GitHub issue #%d: %v", label, r.IssueNumber, err)
+			return
+		}
+		recordAudit(githubAudit("add_label", repo, r.IssueNumber, map[string]interface{}{"label": label}))
+	}
+
+	body := fmt.Sprintf("%s\nThis issue could not be synced to Jira after %d attempts and is no longer retried automatically.\n\n"+
+		"**Last error**\n\n```\n%s\n```\n\nA maintainer can retry it from the gh-jira dashboard, the management API or with `gh-jira retries retry`.",
+		deadLetterMarker, r.Attempts, r.LastError)
+	if err := ghRateLimit.wait(ctx); err != nil {
+		return
+	}
+	log.Printf("Commenting the sync failure on GitHub issue #%d", r.IssueNumber)
+	created, resp, err := client.Issues.CreateComment(ctx, repo.Owner, repo.Name, r.IssueNumber, &github.IssueComment{Body: &body})
+	ghRateLimit.observe(resp, err)
+	if err != nil {
+		log.Printf("Failed to comment the sync failure on GitHub issue #%d: %v", r.IssueNumber, err)
+		return
+	}
+	recordAudit(githubAudit("create_comment", repo, r.IssueNumber, map[string]interface{}{"comment_id": created.GetID()}))
+}
+
+// clearDeadLetter removes the failed label from a GitHub issue once it was
+// synced
+func clearDeadLetter(ctx context.Context, client *github.Client, repo config.RepoConfig, issue *github.Issue) {
+	label := cfg().Retry.FailedLabel
+	if label == "" || !hasLabel(issue, label) {
+		return
+	}
+	if err := ghRateLimit.wait(ctx); err != nil {
+		return
+	}
+	log.Printf("Removing label %s from GitHub issue #%d", label, issue.GetNumber())
+	resp, err := client.Issues.RemoveLabelForIssue(ctx, repo.Owner, repo.Name, issue.GetNumber(), label)
+	ghRateLimit.observe(resp, err)
+	if err != nil {
+		log.Printf("Failed to remove label %s from GitHub issue #%d: %v", label, issue.GetNumber(), err)
+		return
+	}
+	recordAudit(githubAudit("remove_label", repo, issue.GetNumber(), map[string]interface{}{"label": label}))
+}
+
+// apiDeadLetters lists the Jira creations that ran out of attempts
+func (d *dashboard) apiDeadLetters(w http.ResponseWriter, r *http.Request) {
+	dead, err := deadLetters(r.Context())
+	if err != nil {
+		writeAPIJSON(w, http.StatusInternalServerError, apiError{Error: err.Error()})
+		return
+	}
+	out := apiDeadLetters{DeadLetters: []*state.Retry{}}
+	out.DeadLetters = append(out.DeadLetters, dead...)
+	writeAPIJSON(w, http.StatusOK, out)
+}
+
+// apiRetryDeadLetter queues the dead letter of ?key= for retry in the next
+// poll cycle with all attempts available
+func (d *dashboard) apiRetryDeadLetter(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		writeAPIJSON(w, http.StatusBadRequest, apiError{Error: "key must be the mapping key of a dead letter"})
+		return
+	}
+	d.actionMu.Lock()
+	defer d.actionMu.Unlock()
+	retry, err := resetRetry(r.Context(), store, key)
+	switch {
+	case errors.Is(err, state.ErrNotFound):
+		writeAPIJSON(w, http.StatusNotFound, apiError{Error: err.Error()})
+		return
+	case err != nil:
+		writeAPIJSON(w, http.StatusInternalServerError, apiError{Error: err.Error()})
+		return
+	}
+	log.Printf("API: queued %s for retry in the next poll cycle", key)
+	writeAPIJSON(w, http.StatusOK, retry)
+}
+
+// writeDeadLetterMetrics writes the number of dead letters in the
+// Prometheus text format
+func writeDeadLetterMetrics(ctx context.Context, out io.Writer) error {
+	dead, err := deadLetters(ctx)
+	if err != nil {
+		return err
+	}
+	const name = "gh_jira_dead_letters"
+	_, err = fmt.Fprintf(out, "# HELP %s Issues whose Jira creation ran out of attempts\n# TYPE %s gauge\n%s %d\n", name, name, name, len(dead))
+	return err
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/savitaashture/gh-jira/pkg/httpclient"
+	"github.com/savitaashture/gh-jira/pkg/summarizer"
+)
+
+// debugState is the response to GET /debug/state
+type debugState struct {
+	Time       time.Time `json:"time"`
+	Goroutines int       `json:"goroutines"`
+	// HeapBytes is the memory of the live and not yet collected objects
+	HeapBytes uint64 `json:"heap_bytes"`
+	// MappingCache holds the mappings cached for issue links by
+	// owner/name#number, with their Jira key; nil when nothing is cached
+	MappingCache map[string]string `json:"mapping_cache"`
+	// Pipeline are the queues of the sync pipeline of the running poll
+	// cycle, if any
+	Pipeline []debugQueue `json:"pipeline"`
+	// Models include the generations running and waiting for each model
+	Models    []summarizer.ModelMetrics `json:"models"`
+	RateLimit *rateLimitStatus          `json:"github_rate_limit,omitempty"`
+	// ReloadPending is set while a configuration reload waits for the poll
+	// cycle to finish
+	ReloadPending bool `json:"reload_pending"`
+	// HTTPDebug is set while outbound requests and responses are logged
+	HTTPDebug bool   `json:"http_debug"`
+	UserAgent string `json:"user_agent"`
+}
+
+// debugHTTP is the body of PUT /debug/http and its response
+type debugHTTP struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// debugQueue is the input queue of a pipeline stage
+type debugQueue struct {
+	Stage    string `json:"stage"`
+	Length   int    `json:"length"`
+	Capacity int    `json:"capacity"`
+}
+
+// registerDebug adds the pprof profiles, the state dump and the HTTP debug
+// logging switch to mux, authenticated with the bearer token
+func (d *dashboard) registerDebug(mux *http.ServeMux, token string) {
+	auth := func(h http.HandlerFunc) http.Handler { return requireBearer(token, h) }
+	mux.Handle("GET /debug/pprof/", auth(pprof.Index))
+	mux.Handle("GET /debug/pprof/cmdline", auth(pprof.Cmdline))
+	mux.Handle("GET /debug/pprof/profile", auth(pprof.Profile))
+	mux.Handle("GET /debug/pprof/symbol", auth(pprof.Symbol))
+	mux.Handle("GET /debug/pprof/trace", auth(pprof.Trace))
+	mux.Handle("GET /debug/state", auth(d.handleDebugState))
+	mux.Handle("PUT /debug/http", auth(d.handleDebugHTTP))
+}
+
+// handleDebugHTTP turns the logging of outbound requests and responses on
+// or off until the next restart or configuration reload
+func (d *dashboard) handleDebugHTTP(w http.ResponseWriter, r *http.Request) {
+	var body debugHTTP
+	if v := r.URL.Query().Get("enabled"); v != "" {
+		on, err := strconv.ParseBool(v)
+		if err != nil {
+			writeAPIJSON(w, http.StatusBadRequest, apiError{Error: fmt.Sprintf("invalid enabled %q", v)})
+			return
+		}
+		body.Enabled = &on
+	} else if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeAPIJSON(w, http.StatusBadRequest, apiError{Error: "invalid body: " + err.Error()})
+		return
+	}
+	if body.Enabled == nil {
+		writeAPIJSON(w, http.StatusBadRequest, apiError{Error: `pass {"enabled": true} or ?enabled=true`})
+		return
+	}
+	httpclient.SetDebug(*body.Enabled)
+	on := httpclient.Debug()
+	writeAPIJSON(w, http.StatusOK, debugHTTP{Enabled: &on})
+}
+
+// handleDebugState dumps the in-memory state of the service
+func (d *dashboard) handleDebugState(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	st := debugState{
+		Time:          time.Now(),
+		Goroutines:    runtime.NumGoroutine(),
+		HeapBytes:     mem.HeapAlloc,
+		Pipeline:      []debugQueue{},
+		Models:        d.sum.Metrics(),
+		RateLimit:     ghRateLimit.status(),
+		ReloadPending: len(reloader.pending()) > 0,
+		HTTPDebug:     httpclient.Debug(),
+		UserAgent:     userAgent(),
+	}
+
+	mappingIndex.mu.Lock()
+	if mappingIndex.byRef != nil {
+		st.MappingCache = make(map[string]string, len(mappingIndex.byRef))
+		for ref, m := range mappingIndex.byRef {
+			st.MappingCache[ref] = m.JiraKey
+		}
+	}
+	mappingIndex.mu.Unlock()
+
+	if p := activePipeline.Load(); p != nil {
+		for _, q := range p.queues {
+			st.Pipeline = append(st.Pipeline, debugQueue{Stage: q.stage, Length: len(q.ch), Capacity: cap(q.ch)})
+		}
+	}
+	writeAPIJSON(w, http.StatusOK, st)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+// fullBodyFilename is the name of the attachment holding the body of a
+// GitHub issue whose Jira description was truncated
+func fullBodyFilename(issue *github.Issue) string {
+	return fmt.Sprintf("github-issue-%d.md", issue.GetNumber())
+}
+
+// truncationNote ends a truncated Jira description, pointing at the full
+// content
+func truncationNote(issue *github.Issue) string {
+	if cfg().Jira.DescriptionLimit.AttachFullBody {
+		return fmt.Sprintf("\n\n----\n_Description truncated, the full content is attached as %s._", fullBodyFilename(issue))
+	}
+	return fmt.Sprintf("\n\n----\n_Description truncated, the full content is on GitHub: %s_", issue.GetHTMLURL())
+}
+
+// limitDescription truncates the description in fields to the configured
+// maximum length, at a line break where possible, and ends it with the
+// truncation note. It reports whether the description was truncated.
+func limitDescription(issue *github.Issue, fields map[string]interface{}) bool {
+	limit := cfg().Jira.DescriptionLimit.MaxLength
+	desc, ok := fields["description"].(string)
+	if limit <= 0 || !ok || utf8.RuneCountInString(desc) <= limit {
+		return false
+	}
+	note := truncationNote(issue)
+	kept := string([]rune(desc)[:limit-utf8.RuneCountInString(note)])
+	// Don't cut a line in half unless that drops more than a tenth
+	if i := strings.LastIndexByte(kept, '\n'); i > len(kept)*9/10 {
+		kept = kept[:i]
+	}
+	log.Printf("Truncating the Jira description of GitHub issue #%d from %d to %d characters", issue.GetNumber(), utf8.RuneCountInString(desc), limit)
+	fields["description"] = strings.TrimRight(kept, " \t\r\n") + note
+	return true
+}
+
+// descriptionTruncated reports whether limitDescription truncated the
+// description in fields
+func descriptionTruncated(issue *github.Issue, fields map[string]interface{}) bool {
+	desc, _ := fields["description"].(string)
+	return strings.HasSuffix(desc, truncationNote(issue))
+}
+
+// attachFullBody attaches the sanitized and redacted GitHub issue body to
+// the Jira issue of m if its description in fields was truncated. An
+// attachment of an earlier sync is replaced when the body changed. Failures are only logged as the
+// description itself was written.
+func attachFullBody(ctx context.Context, m *state.Mapping, issue *github.Issue, fields map[string]interface{}) {
+	if !cfg().Jira.DescriptionLimit.AttachFullBody || !descriptionTruncated(issue, fields) {
+		return
+	}
+	if err := replaceAttachment(ctx, m, fullBodyFilename(issue), []byte(redactor.Redact(issueBody(issue)))); err != nil {
+		log.Printf("Failed to attach the body of GitHub issue #%d to Jira issue %s: %v", issue.GetNumber(), m.JiraKey, err)
+	}
+}
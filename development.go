@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+// devPull is a pull request in the development property
+type devPull struct {
+	Repo   string `json:"repo"`
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	URL    string `json:"url"`
+	State  string `json:"state"`
+	Branch string `json:"branch,omitempty"`
+}
+
+// devCommit is a commit in the development property
+type devCommit struct {
+	Repo    string    `json:"repo"`
+	SHA     string    `json:"sha"`
+	URL     string    `json:"url"`
+	Message string    `json:"message,omitempty"`
+	Date    time.Time `json:"date"`
+}
+
+// development is the Jira issue property describing the GitHub development
+// activity of a synced issue
+type development struct {
+	Issue struct {
+		Repo   string `json:"repo"`
+		Number int    `json:"number"`
+		URL    string `json:"url"`
+	} `json:"issue"`
+	PullRequests []devPull   `json:"pullRequests"`
+	Branches     []string    `json:"branches"`
+	Commits      []devCommit `json:"commits"`
+	UpdatedAt    time.Time   `json:"updatedAt"`
+}
+
+// developmentCursor names the state cursor holding the hash of the
+// development property last written for a synced issue
+func developmentCursor(key string) string {
+	return "development:" + key
+}
+
+// newDevelopment returns the development property of an issue from the
+// references on its timeline. A pull request or commit referencing the
+// issue several times is listed once, in its latest state.
+func newDevelopment(repo config.RepoConfig, issue *github.Issue, t *issueTimeline) *development {
+	d := &development{PullRequests: []devPull{}, Branches: []string{}, Commits: []devCommit{}}
+	d.Issue.Repo, d.Issue.Number, d.Issue.URL = repo.FullName(), issue.GetNumber(), issue.GetHTMLURL()
+	pulls := make(map[string]int)
+	for _, p := range t.Pulls {
+		pull := devPull{Repo: p.Repo, Number: p.Number, Title: p.Title, URL: p.URL, State: p.State, Branch: p.Branch}
+		if i, ok := pulls[p.ref()]; ok {
+			d.PullRequests[i] = pull
+			continue
+		}
+		pulls[p.ref()] = len(d.PullRequests)
+		d.PullRequests = append(d.PullRequests, pull)
+	}
+	branches := make(map[string]bool)
+	for _, p := range d.PullRequests {
+		if p.Branch != "" && !branches[p.Branch] {
+			branches[p.Branch] = true
+			d.Branches = append(d.Branches, p.Branch)
+		}
+	}
+	commits := make(map[string]bool)
+	for _, c := range t.Commits {
+		if !commits[c.SHA] {
+			commits[c.SHA] = true
+			d.Commits = append(d.Commits, devCommit{Repo: c.Repo, SHA: c.SHA, URL: c.URL, Message: c.Message, Date: c.Date})
+		}
+	}
+	return d
+}
+
+// hash identifies the content of the property, ignoring when it was
+// written
+func (d *development) hash() string {
+	c := *d
+	c.UpdatedAt = time.Time{}
+	data, _ := json.Marshal(c)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// syncDevelopment writes the pull requests, branches and commits
+// referencing a synced issue to the development property of its Jira
+// issue whenever they changed
+func syncDevelopment(ctx context.Context, client *github.Client, repo config.RepoConfig, issue *github.Issue, m *state.Mapping) error {
+	dc := cfg().Jira.Development
+	if !dc.Enabled || m.JiraKey == "" {
+		return nil
+	}
+	timeline, err := listTimeline(ctx, client, repo, issue)
+	if err != nil {
+		return err
+	}
+	dev := newDevelopment(repo, issue, timeline)
+	hash := dev.hash()
+	last, err := store.GetCursor(ctx, developmentCursor(m.Key))
+	if err != nil {
+		return err
+	}
+	if last == hash {
+		return nil
+	}
+	if last == "" && len(dev.PullRequests) == 0 && len(dev.Commits) == 0 {
+		// Nothing to show yet
+		return nil
+	}
+
+	jc, err := jiraFor(m.JiraInstance)
+	if err != nil {
+		return err
+	}
+	dev.UpdatedAt = time.Now().UTC()
+	if err := jc.SetIssueProperty(ctx, m.JiraKey, dc.Property, dev); err != nil {
+		return fmt.Errorf("failed to set the development property of %s: %w", m.JiraKey, err)
+	}
+	log.Printf("Updated the development property of %s with %d pull requests, %d branches and %d commits of GitHub issue #%d",
+		m.JiraKey, len(dev.PullRequests), len(dev.Branches), len(dev.Commits), issue.GetNumber())
+	e := jiraAudit("set_property", m.JiraKey, map[string]interface{}{
+		"property": dc.Property, "pull_requests": len(dev.PullRequests), "commits": len(dev.Commits),
+	})
+	e.Repo, e.Issue = repo.FullName(), issue.GetNumber()
+	recordAudit(e)
+	return store.SetCursor(ctx, developmentCursor(m.Key), hash)
+}
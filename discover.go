@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+)
+
+// repositories returns the repositories to poll in this cycle: the
+// statically configured ones plus, if enabled, those discovered in the
+// organization. Explicitly configured repositories take precedence so their
+// namespace settings are kept.
+func repositories(ctx context.Context, client *github.Client) ([]config.RepoConfig, error) {
+	conf := cfg()
+	repos := conf.GitHub.WatchedRepos()
+	org := conf.GitHub.Org
+	if org.Name == "" {
+		return repos, nil
+	}
+
+	seen := make(map[string]bool)
+	for _, r := range repos {
+		seen[strings.ToLower(r.FullName())] = true
+	}
+
+	discovered, err := discoverOrgRepos(ctx, client, org)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range discovered {
+		if !seen[strings.ToLower(r.FullName())] {
+			repos = append(repos, r)
+		}
+	}
+	return repos, nil
+}
+
+// selectRepo returns the repository named owner/name, with its settings if
+// it is configured, or the only configured one if name is empty
+func selectRepo(name string) (config.RepoConfig, error) {
+	conf := cfg()
+	if name == "" {
+		repos := conf.GitHub.WatchedRepos()
+		if len(repos) != 1 {
+			return config.RepoConfig{}, fmt.Errorf("%d repositories are configured, select one with --repo", len(repos))
+		}
+		return repos[0], nil
+	}
+	owner, repo, ok := strings.Cut(name, "/")
+	if !ok || owner == "" || repo == "" {
+		return config.RepoConfig{}, fmt.Errorf("invalid repository %q, expected owner/name", name)
+	}
+	for _, r := range conf.GitHub.WatchedRepos() {
+		if strings.EqualFold(r.FullName(), name) {
+			return r, nil
+		}
+	}
+	r := config.RepoConfig{Owner: owner, Name: repo}
+	if strings.EqualFold(owner, conf.GitHub.Org.Name) {
+		r.Jira = conf.GitHub.Org.Jira
+	}
+	return r, nil
+}
+
+// errUnknownRepo is returned for repositories that are neither configured
+// nor discovered
+var errUnknownRepo = errors.New("repository is not configured")
+
+// findRepo returns the configured or discovered repository named owner/name
+func findRepo(ctx context.Context, client *github.Client, fullName string) (config.RepoConfig, error) {
+	repos, err := repositories(ctx, client)
+	if err != nil {
+		return config.RepoConfig{}, err
+	}
+	for _, r := range repos {
+		if strings.EqualFold(r.FullName(), fullName) {
+			return r, nil
+		}
+	}
+	return config.RepoConfig{}, fmt.Errorf("%w: %s", errUnknownRepo, fullName)
+}
+
+// discoverOrgRepos lists the repositories of an organization matching the
+// configured filters
+func discoverOrgRepos(ctx context.Context, client *github.Client, org config.OrgConfig) ([]config.RepoConfig, error) {
+	var pattern *regexp.Regexp
+	if org.NamePattern != "" {
+		// Validated at startup
+		pattern = regexp.MustCompile(org.NamePattern)
+	}
+
+	log.Printf("Discovering repositories in organization %s", org.Name)
+	opt := &github.RepositoryListByOrgOptions{
+		Type:        "all",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	var repos []config.RepoConfig
+	for {
+		if err := ghRateLimit.wait(ctx); err != nil {
+			return nil, err
+		}
+		page, resp, err := client.Repositories.ListByOrg(ctx, org.Name, opt)
+		ghRateLimit.observe(resp, err)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range page {
+			switch {
+			case !r.GetHasIssues():
+				continue
+			case r.GetFork() && !org.IncludeForks:
+				continue
+			case r.GetArchived() && !org.IncludeArchived:
+				continue
+			case pattern != nil && !pattern.MatchString(r.GetName()):
+				continue
+			case len(org.Topics) > 0 && !hasAnyTopic(r.Topics, org.Topics):
+				continue
+			}
+			repos = append(repos, config.RepoConfig{Owner: org.Name, Name: r.GetName(), Jira: org.Jira})
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	log.Printf("Discovered %d matching repositories in organization %s", len(repos), org.Name)
+	return repos, nil
+}
+
+func hasAnyTopic(topics, wanted []string) bool {
+	for _, t := range topics {
+		for _, w := range wanted {
+			if strings.EqualFold(t, w) {
+				return true
+			}
+		}
+	}
+	return false
+}
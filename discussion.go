@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/state"
+	"github.com/savitaashture/gh-jira/pkg/summarizer"
+)
+
+// discussionHeading starts the discussion summary in Jira. Everything from
+// its last occurrence to the end of the description is replaced on updates.
+const discussionHeading = "h3. Discussion Summary"
+
+// discussion is the last discussion summary of a synced issue
+type discussion struct {
+	// Comments is the number of comments the summary was generated from
+	Comments int    `json:"comments"`
+	Summary  string `json:"summary"`
+	// CommentID is the Jira comment holding the summary, if posted as one
+	CommentID string `json:"comment_id,omitempty"`
+}
+
+// discussionCursor names the state cursor holding the discussion summary of
+// a synced issue as JSON
+func discussionCursor(key string) string {
+	return "discussion:" + key
+}
+
+// syncDiscussion summarizes the comment thread of a busy issue into its Jira
+// issue once it reached the configured number of comments, and again
+// whenever comments were added since
+func syncDiscussion(ctx context.Context, client *github.Client, repo config.RepoConfig, issue *github.Issue, m *state.Mapping, sum *summarizer.Summarizer) error {
+	conf := cfg()
+	dc := conf.Summarizer.Discussion
+	if dc.MinComments <= 0 || m.JiraKey == "" || issue.GetComments() < dc.MinComments {
+		return nil
+	}
+	var last discussion
+	if stored, err := store.GetCursor(ctx, discussionCursor(m.Key)); err != nil {
+		return err
+	} else if stored != "" {
+		if err := json.Unmarshal([]byte(stored), &last); err != nil {
+			return fmt.Errorf("invalid discussion summary of %s: %w", m.Key, err)
+		}
+	}
+	if issue.GetComments() <= last.Comments {
+		return nil
+	}
+
+	comments, err := listComments(ctx, client, repo, issue.GetNumber())
+	if err != nil {
+		return err
+	}
+	if len(comments) > dc.MaxComments {
+		comments = comments[len(comments)-dc.MaxComments:]
+	}
+	log.Printf("Summarizing the discussion of GitHub issue #%d from %d comments", issue.GetNumber(), len(comments))
+	project, _, _ := strings.Cut(m.JiraKey, "-")
+	summary, err := summarizeDiscussion(ctx, sum.WithLanguage(conf.Summarizer.LanguageFor(project)), repo, issue, comments)
+	if err != nil {
+		return fmt.Errorf("failed to summarize the discussion: %w", err)
+	}
+
+	jc, err := jiraFor(m.JiraInstance)
+	if err != nil {
+		return err
+	}
+	summary = mentionsToJira(jc, summary)
+	next := discussion{Comments: issue.GetComments(), Summary: summary, CommentID: last.CommentID}
+	text := discussionHeading + "\n" + summary
+	switch {
+	case dc.Target == config.DiscussionDescription:
+		ji, err := jc.GetIssue(ctx, m.JiraKey, []string{"description"})
+		if err != nil {
+			return fmt.Errorf("failed to read the description of %s: %w", m.JiraKey, err)
+		}
+		fields := map[string]interface{}{"description": withDiscussion(ji.Fields.Description, summary)}
+		limitDescription(issue, fields)
+		if err := jc.UpdateIssue(ctx, m.JiraKey, fields); err != nil {
+			return fmt.Errorf("failed to update the discussion summary of %s: %w", m.JiraKey, err)
+		}
+		attachFullBody(ctx, m, issue, fields)
+		e := jiraAudit("update_issue", m.JiraKey, map[string]interface{}{"fields": fieldNames(fields), "comments": next.Comments})
+		e.Repo, e.Issue = repo.FullName(), issue.GetNumber()
+		recordAudit(e)
+	case last.CommentID != "":
+		if err := jc.UpdateComment(ctx, m.JiraKey, last.CommentID, text); err != nil {
+			return fmt.Errorf("failed to update the discussion summary of %s: %w", m.JiraKey, err)
+		}
+		e := jiraAudit("edit_comment", m.JiraKey, map[string]interface{}{"comment_id": last.CommentID, "comments": next.Comments})
+		e.Repo, e.Issue = repo.FullName(), issue.GetNumber()
+		recordAudit(e)
+	default:
+		id, err := jc.AddComment(ctx, m.JiraKey, text)
+		if err != nil {
+			return fmt.Errorf("failed to post the discussion summary to %s: %w", m.JiraKey, err)
+		}
+		next.CommentID = id
+		e := jiraAudit("create_comment", m.JiraKey, map[string]interface{}{"comment_id": id, "comments": next.Comments})
+		e.Repo, e.Issue = repo.FullName(), issue.GetNumber()
+		recordAudit(e)
+	}
+	log.Printf("Updated the discussion summary of %s from %d comments", m.JiraKey, next.Comments)
+
+	data, _ := json.Marshal(next)
+	return store.SetCursor(ctx, discussionCursor(m.Key), string(data))
+}
+
+// storedDiscussion returns the last discussion summary of a mapping that
+// belongs into the Jira description, or ""
+func storedDiscussion(ctx context.Context, m *state.Mapping) string {
+	conf := cfg()
+	if conf.Summarizer.Discussion.MinComments <= 0 || conf.Summarizer.Discussion.Target != config.DiscussionDescription {
+		return ""
+	}
+	stored, err := store.GetCursor(ctx, discussionCursor(m.Key))
+	if err != nil || stored == "" {
+		return ""
+	}
+	var d discussion
+	if err := json.Unmarshal([]byte(stored), &d); err != nil {
+		return ""
+	}
+	return d.Summary
+}
+
+// withDiscussion replaces the discussion summary at the end of a Jira
+// description
+func withDiscussion(description, summary string) string {
+	if i := strings.LastIndex(description, discussionHeading); i >= 0 {
+		description = strings.TrimRight(description[:i], "\n")
+	}
+	if summary == "" {
+		return description
+	}
+	return description + "\n\n" + discussionHeading + "\n" + summary
+}
+
+// listComments returns all comments of an issue, oldest first, without the
+// sync status comment. Comments fetched with the issue in this poll are
+// used without asking GitHub again.
+func listComments(ctx context.Context, client *github.Client, repo config.RepoConfig, number int) ([]*github.IssueComment, error) {
+	var all []*github.IssueComment
+	if fetched, ok := fetchedIssues.comments(repo.FullName(), number); ok {
+		for _, c := range fetched {
+			if !strings.HasPrefix(c.GetBody(), statusCommentMarker) {
+				all = append(all, c)
+			}
+		}
+		return all, nil
+	}
+	opt := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		if err := ghRateLimit.wait(ctx); err != nil {
+			return nil, err
+		}
+		comments, resp, err := client.Issues.ListComments(ctx, repo.Owner, repo.Name, number, opt)
+		ghRateLimit.observe(resp, err)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list comments: %w", err)
+		}
+		for _, c := range comments {
+			if !strings.HasPrefix(c.GetBody(), statusCommentMarker) {
+				all = append(all, c)
+			}
+		}
+		if resp.NextPage == 0 {
+			return all, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// summarizeDiscussion generates the discussion summary of an issue from its
+// comments
+func summarizeDiscussion(ctx context.Context, sum *summarizer.Summarizer, repo config.RepoConfig, issue *github.Issue, comments []*github.IssueComment) (summary string, err error) {
+	var thread strings.Builder
+	fmt.Fprintf(&thread, "Issue: %s\n\n%s\n", issue.GetTitle(), issueBody(issue))
+	writeComments(&thread, comments)
+	ctx, span := startSpan(ctx, "summarize_discussion", issueAttrs(repo.FullName(), issue.GetNumber())...)
+	defer func() { endSpan(span, err) }()
+	return sum.SummarizeDiscussion(ctx, redactor.Redact(thread.String()))
+}
+
+// writeComments appends comments to a thread to summarize, with their
+// author and date
+func writeComments(thread *strings.Builder, comments []*github.IssueComment) {
+	for _, c := range comments {
+		fmt.Fprintf(thread, "\n---\n@%s on %s:\n%s\n", c.GetUser().GetLogin(), c.GetCreatedAt().Format("2006-01-02"), c.GetBody())
+	}
+}
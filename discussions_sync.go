@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/idmap"
+	"github.com/savitaashture/gh-jira/pkg/state"
+	"github.com/savitaashture/gh-jira/pkg/summarizer"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// discussionsPerPoll is the number of most recent discussions each poll
+// looks at
+const discussionsPerPoll = 50
+
+// discussionNamespace is appended to the namespace of the repository in the
+// mapping keys of discussions, which are numbered like issues
+const discussionNamespace = "/discussions"
+
+const discussionsQuery = `query($owner: String!, $name: String!, $first: Int!) {
+  repository(owner: $owner, name: $name) {
+    hasDiscussionsEnabled
+    discussions(first: $first, orderBy: {field: CREATED_AT, direction: DESC}) {
+      nodes {
+        id
+        databaseId
+        number
+        title
+        body
+        url
+        closed
+        author { login }
+        category { name slug }
+        labels(first: 20) { nodes { name } }
+      }
+    }
+  }
+}`
+
+const addDiscussionCommentMutation = `mutation($id: ID!, $body: String!) {
+  addDiscussionComment(input: {discussionId: $id, body: $body}) {
+    comment { databaseId }
+  }
+}`
+
+const updateDiscussionCommentMutation = `mutation($id: ID!, $body: String!) {
+  updateDiscussionComment(input: {commentId: $id, body: $body}) {
+    comment { databaseId }
+  }
+}`
+
+// discussionCommentsQuery pages through the comments of a discussion to find
+// the sync status comment
+const discussionCommentsQuery = `query($id: ID!, $after: String) {
+  node(id: $id) {
+    ... on Discussion {
+      comments(first: 100, after: $after) {
+        nodes { id databaseId body }
+        pageInfo { hasNextPage endCursor }
+      }
+    }
+  }
+}`
+
+const updateDiscussionMutation = `mutation($id: ID!, $body: String!) {
+  updateDiscussion(input: {discussionId: $id, body: $body}) {
+    discussion { id }
+  }
+}`
+
+// ghDiscussion is a GitHub Discussion as returned by discussionsQuery
+type ghDiscussion struct {
+	ID         string `json:"id"`
+	DatabaseID int64  `json:"databaseId"`
+	Number     int    `json:"number"`
+	Title      string `json:"title"`
+	Body       string `json:"body"`
+	URL        string `json:"url"`
+	Closed     bool   `json:"closed"`
+	Author     *struct {
+		Login string `json:"login"`
+	} `json:"author"`
+	Category struct {
+		Name string `json:"name"`
+		Slug string `json:"slug"`
+	} `json:"category"`
+	Labels struct {
+		Nodes []struct {
+			Name string `json:"name"`
+		} `json:"nodes"`
+	} `json:"labels"`
+}
+
+// issue returns d as a GitHub issue, so that it is summarized and mapped to
+// Jira fields like one
+func (d *ghDiscussion) issue() *github.Issue {
+	state := "open"
+	if d.Closed {
+		state = "closed"
+	}
+	issue := &github.Issue{
+		ID:      github.Ptr(d.DatabaseID),
+		NodeID:  github.Ptr(d.ID),
+		Number:  github.Ptr(d.Number),
+		Title:   github.Ptr(d.Title),
+		Body:    github.Ptr(d.Body),
+		HTMLURL: github.Ptr(d.URL),
+		State:   github.Ptr(state),
+	}
+	if d.Author != nil {
+		issue.User = &github.User{Login: github.Ptr(d.Author.Login)}
+	}
+	for _, l := range d.Labels.Nodes {
+		issue.Labels = append(issue.Labels, &github.Label{Name: github.Ptr(l.Name)})
+	}
+	return issue
+}
+
+// listGitHubDiscussions returns the most recent discussions of a
+// repository, or none if it has discussions disabled
+func listGitHubDiscussions(ctx context.Context, client *github.Client, repo config.RepoConfig) ([]*ghDiscussion, error) {
+	var data struct {
+		Repository *struct {
+			HasDiscussionsEnabled bool `json:"hasDiscussionsEnabled"`
+			Discussions           struct {
+				Nodes []*ghDiscussion `json:"nodes"`
+			} `json:"discussions"`
+		} `json:"repository"`
+	}
+	log.Printf("Fetching discussions from GitHub repository %s", repo.FullName())
+	err := graphQL(ctx, client, discussionsQuery, map[string]interface{}{
+		"owner": repo.Owner,
+		"name":  repo.Name,
+		"first": discussionsPerPoll,
+	}, &data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list discussions of %s: %w", repo.FullName(), err)
+	}
+	if data.Repository == nil || !data.Repository.HasDiscussionsEnabled {
+		return nil, nil
+	}
+	return data.Repository.Discussions.Nodes, nil
+}
+
+// discussionKey returns the canonical mapping key of a discussion
+func discussionKey(repo config.RepoConfig, issue *github.Issue) (string, error) {
+	namespace := repo.NamespaceName()
+	return idmap.Key(namespace+discussionNamespace, cfg().GitHub.IDStrategy(namespace), idmap.Issue{
+		Repo:   repo.FullName(),
+		Number: issue.GetNumber(),
+		ID:     issue.GetID(),
+		NodeID: issue.GetNodeID(),
+	})
+}
+
+// isDiscussion reports whether a mapping is the one of a discussion
+func isDiscussion(m *state.Mapping) bool {
+	return strings.Contains(m.Key, discussionNamespace+"/")
+}
+
+// syncGitHubDiscussions creates the Jira issues of the new discussions of a
+// repository in the configured categories. Discussions go through the
+// filters, hooks and templates of issues, but not the approval gate or the
+// retry queue: a failed creation is attempted again on the next poll.
+func syncGitHubDiscussions(ctx context.Context, client *github.Client, repo config.RepoConfig, sum *summarizer.Summarizer, result *cycleResult) error {
+	ctx, span := startSpan(ctx, "poll_discussions", attribute.String("github.repo", repo.FullName()))
+	defer span.End()
+
+	discussions, err := listGitHubDiscussions(ctx, client, repo)
+	if err != nil {
+		log.Printf("Error fetching GitHub discussions: %v", err)
+		if isAuthError(err) {
+			return fmt.Errorf("GitHub authentication failed: %w", err)
+		}
+		result.fail(repo.FullName(), 0, "discussions", err)
+		return nil
+	}
+	log.Printf("Found %d discussions in %s", len(discussions), repo.FullName())
+	for _, d := range discussions {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if !cfg().GitHub.Discussions.SyncsCategory(d.Category.Name, d.Category.Slug) {
+			continue
+		}
+		result.inc(&result.IssuesSeen)
+		created, err := syncGitHubDiscussion(ctx, client, repo, d, sum)
+		switch {
+		case err != nil:
+			var fatal *fatalError
+			if errors.As(err, &fatal) {
+				return err
+			}
+			stage := "create"
+			var stageErr *syncStageError
+			if errors.As(err, &stageErr) {
+				stage = stageErr.stage
+			}
+			result.fail(repo.FullName(), d.Number, stage, err)
+		case created:
+			result.inc(&result.Created)
+		}
+	}
+	return nil
+}
+
+// syncGitHubDiscussion creates the Jira issue of a discussion unless it was
+// already synced or is excluded, and reports whether it did
+func syncGitHubDiscussion(ctx context.Context, client *github.Client, repo config.RepoConfig, d *ghDiscussion, sum *summarizer.Summarizer) (bool, error) {
+	conf := cfg()
+	issue := d.issue()
+	if conf.GitHub.SkipLabel != "" && hasLabel(issue, conf.GitHub.SkipLabel) {
+		return false, nil
+	}
+	key, err := discussionKey(repo, issue)
+	if err != nil {
+		return false, &syncStageError{stage: "key", err: err}
+	}
+	if _, err := lookupMapping(ctx, key); err == nil {
+		return false, nil
+	} else if !errors.Is(err, state.ErrNotFound) {
+		return false, &syncStageError{stage: "lookup", err: err}
+	}
+	if d.Closed {
+		return false, nil
+	}
+	if why := filteredOut(repo, issue); why != "" {
+		log.Printf("Skipping discussion %s#%d as %s", repo.FullName(), d.Number, why)
+		return false, nil
+	}
+	log.Printf("New GitHub discussion detected: %s#%d - %s", repo.FullName(), d.Number, d.Title)
+
+	ctx, unlock, err := claimIssue(ctx, key)
+	if errors.Is(err, errIssueBusy) || errors.Is(err, errIssueSynced) {
+		log.Printf("Skipping GitHub discussion %s#%d: %v", repo.FullName(), d.Number, err)
+		return false, nil
+	} else if err != nil {
+		return false, &syncStageError{stage: "lock", err: err}
+	}
+	defer unlock()
+	ctx, span := startSpan(ctx, "sync_discussion", issueAttrs(repo.FullName(), d.Number)...)
+	defer span.End()
+	mapping, warnings, err := createDirect(ctx, repo, issue, key, sum)
+	if err != nil {
+		return false, err
+	}
+	if err := writeDiscussionBacklink(ctx, client, repo, d, mapping, warnings); err != nil {
+		log.Printf("Failed to write back-link for GitHub discussion %s#%d: %v", repo.FullName(), d.Number, err)
+		return true, &syncStageError{stage: "backlink", err: err}
+	}
+	afterSync(ctx, repo, issue, mapping)
+	return true, nil
+}
+
+// writeDiscussionBacklink publishes the Jira link on a discussion: as a sync
+// status comment, or appended to its body in the body backlink mode
+func writeDiscussionBacklink(ctx context.Context, client *github.Client, repo config.RepoConfig, d *ghDiscussion, m *state.Mapping, warnings []string) error {
+	switch repo.BacklinkMode(cfg().GitHub.Backlink) {
+	case "none":
+		return nil
+	case "body":
+		body := withJiraLink(d.Body, m)
+		if body == d.Body {
+			log.Printf("GitHub discussion %s#%d already links to Jira issue %s", repo.FullName(), d.Number, m.JiraKey)
+			return nil
+		}
+		log.Printf("Updating GitHub discussion %s#%d with Jira issue link %s", repo.FullName(), d.Number, m.JiraKey)
+		if err := graphQL(ctx, client, updateDiscussionMutation, map[string]interface{}{"id": d.ID, "body": body}, nil); err != nil {
+			return fmt.Errorf("failed to update discussion: %w", err)
+		}
+		recordAudit(githubAudit("edit_discussion", repo, d.Number, map[string]interface{}{"body": "linked to " + m.JiraKey}))
+		return nil
+	}
+
+	body := renderStatusComment(m, syncStatus{State: "Synced", Warnings: warnings})
+	existing, err := findDiscussionStatusComment(ctx, client, d.ID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		log.Printf("Updating sync status comment on GitHub discussion %s#%d", repo.FullName(), d.Number)
+		if err := graphQL(ctx, client, updateDiscussionCommentMutation, map[string]interface{}{"id": existing.ID, "body": body}, nil); err != nil {
+			return fmt.Errorf("failed to update sync status comment: %w", err)
+		}
+		recordAudit(githubAudit("edit_discussion_comment", repo, d.Number, map[string]interface{}{"comment_id": existing.DatabaseID}))
+		return recordStatusComment(ctx, m, existing.DatabaseID)
+	}
+
+	var data struct {
+		AddDiscussionComment struct {
+			Comment struct {
+				DatabaseID int64 `json:"databaseId"`
+			} `json:"comment"`
+		} `json:"addDiscussionComment"`
+	}
+	log.Printf("Creating sync status comment on GitHub discussion %s#%d", repo.FullName(), d.Number)
+	if err := graphQL(ctx, client, addDiscussionCommentMutation, map[string]interface{}{"id": d.ID, "body": body}, &data); err != nil {
+		return fmt.Errorf("failed to create sync status comment: %w", err)
+	}
+	commentID := data.AddDiscussionComment.Comment.DatabaseID
+	recordAudit(githubAudit("create_discussion_comment", repo, d.Number, map[string]interface{}{"comment_id": commentID}))
+	return recordStatusComment(ctx, m, commentID)
+}
+
+// discussionComment is a comment of a discussion as returned by
+// discussionCommentsQuery
+type discussionComment struct {
+	ID         string `json:"id"`
+	DatabaseID int64  `json:"databaseId"`
+	Body       string `json:"body"`
+}
+
+// findDiscussionStatusComment returns the sync status comment of a
+// discussion, or nil if it has none
+func findDiscussionStatusComment(ctx context.Context, client *github.Client, discussionID string) (*discussionComment, error) {
+	var after interface{}
+	for {
+		var data struct {
+			Node struct {
+				Comments struct {
+					Nodes    []discussionComment `json:"nodes"`
+					PageInfo struct {
+						HasNextPage bool   `json:"hasNextPage"`
+						EndCursor   string `json:"endCursor"`
+					} `json:"pageInfo"`
+				} `json:"comments"`
+			} `json:"node"`
+		}
+		if err := graphQL(ctx, client, discussionCommentsQuery, map[string]interface{}{"id": discussionID, "after": after}, &data); err != nil {
+			return nil, fmt.Errorf("failed to list discussion comments: %w", err)
+		}
+		for i, c := range data.Node.Comments.Nodes {
+			if strings.HasPrefix(c.Body, statusCommentMarker) {
+				return &data.Node.Comments.Nodes[i], nil
+			}
+		}
+		if !data.Node.Comments.PageInfo.HasNextPage {
+			return nil, nil
+		}
+		after = data.Node.Comments.PageInfo.EndCursor
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/state"
+	"github.com/savitaashture/gh-jira/pkg/summarizer"
+)
+
+// embeddingCursorPrefix starts the names of the state cursors holding the
+// summary embeddings of synced issues as JSON
+const embeddingCursorPrefix = "embedding:"
+
+// duplicate is an already synced issue similar to a new one
+type duplicate struct {
+	Mapping    *state.Mapping
+	Similarity float64
+}
+
+// findDuplicate embeds the summary of a new issue, records the embedding
+// under key and returns the most similar synced issue above the threshold,
+// or nil
+func findDuplicate(ctx context.Context, sum *summarizer.Summarizer, key, summary string) (*duplicate, error) {
+	conf := cfg()
+	// An empty summary would be similar to anything
+	if !conf.Summarizer.Duplicates.Enabled || strings.TrimSpace(summary) == "" {
+		return nil, nil
+	}
+	ctx, span := startSpan(ctx, "embed")
+	embedding, err := sum.Embed(ctx, summary)
+	endSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+
+	cursors, err := store.ListCursors(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var best *duplicate
+	var bestKey string
+	for name, value := range cursors {
+		other, ok := strings.CutPrefix(name, embeddingCursorPrefix)
+		if !ok || other == key {
+			continue
+		}
+		var e []float64
+		if err := json.Unmarshal([]byte(value), &e); err != nil {
+			log.Printf("Ignoring invalid embedding of %s: %v", other, err)
+			continue
+		}
+		if s := summarizer.Similarity(embedding, e); s >= conf.Summarizer.Duplicates.Threshold && (best == nil || s > best.Similarity) {
+			best, bestKey = &duplicate{Similarity: s}, other
+		}
+	}
+
+	data, _ := json.Marshal(embedding)
+	if err := store.SetCursor(ctx, embeddingCursorPrefix+key, string(data)); err != nil {
+		log.Printf("Failed to record the embedding of %s: %v", key, err)
+	}
+	if best == nil {
+		return nil, nil
+	}
+	m, err := state.Resolve(ctx, store, bestKey)
+	if err != nil || m.JiraKey == "" {
+		// The similar issue was never synced or is gone
+		return nil, nil
+	}
+	best.Mapping = m
+	return best, nil
+}
+
+// linkDuplicate records the new GitHub issue of key as a duplicate of an
+// already synced issue, sharing its Jira issue, and writes the back-link
+func linkDuplicate(ctx context.Context, client *github.Client, repo config.RepoConfig, issue *github.Issue, key string, dup *duplicate) (*state.Mapping, error) {
+	target := dup.Mapping
+	log.Printf("GitHub issue #%d is %.0f%% similar to %s#%d, linking it to %s instead of creating a Jira issue",
+		issue.GetNumber(), dup.Similarity*100, target.Repo, target.IssueNumber, target.JiraKey)
+	now := time.Now().UTC()
+	m := &state.Mapping{
+		Key:          key,
+		Namespace:    repo.NamespaceName(),
+		Repo:         repo.FullName(),
+		IssueNumber:  issue.GetNumber(),
+		IssueID:      issue.GetID(),
+		NodeID:       issue.GetNodeID(),
+		JiraKey:      target.JiraKey,
+		JiraInstance: target.JiraInstance,
+		SyncStatus:   state.StatusSynced,
+		BodyHash:     bodyHash(issue),
+		LastSyncedAt: now,
+		MergedInto:   target.Key,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := store.Put(ctx, m); err != nil {
+		return nil, &syncStageError{stage: "record", err: err}
+	}
+
+	status := syncStatus{
+		State: "Duplicate",
+		Warnings: []string{fmt.Sprintf("This issue looks like a duplicate of %s#%d (%.0f%% similar) and was linked to its Jira issue.",
+			target.Repo, target.IssueNumber, dup.Similarity*100)},
+	}
+	if err := writeBacklink(ctx, client, repo, issue, m, status); err != nil {
+		return m, &syncStageError{stage: "backlink", err: err}
+	}
+	if err := markSyncedIssue(ctx, client, repo, issue, target.JiraKey); err != nil {
+		return m, &syncStageError{stage: "label", err: err}
+	}
+	return m, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/leader"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+// elector tracks the leadership of this replica; nil without leader election
+var elector *leader.Elector
+
+// startElection starts competing for leadership if leader election is
+// enabled
+func startElection(ctx context.Context) error {
+	conf := cfg()
+	lc := conf.Leader
+	if !lc.Enabled {
+		return nil
+	}
+	var lock leader.Lock
+	if lc.Backend == config.LeaderKubernetes {
+		l, err := leader.NewKubernetesLock(lc.Namespace, lc.Name)
+		if err != nil {
+			return err
+		}
+		lock = l
+	} else {
+		locker, ok := store.(state.Locker)
+		if !ok {
+			return fmt.Errorf("the %q state backend can't hold the leader lock of several replicas, use sqlite, postgres, redis or the kubernetes backend", conf.State.Backend)
+		}
+		lock = leader.NewStoreLock(locker, lc.Name)
+	}
+
+	identity := lc.Identity
+	if identity == "" {
+		identity = leader.DefaultIdentity()
+	}
+	log.Printf("Starting leader election for the %s lock %s as %s", lc.Backend, lc.Name, identity)
+	elector = leader.NewElector(lock, identity, lc.LeaseDuration)
+	elector.Start(ctx)
+	return nil
+}
+
+// stopElection releases the leadership of this replica, if any
+func stopElection() {
+	if elector != nil {
+		elector.Stop()
+	}
+}
+
+// leading returns the context of a poll cycle, which is cancelled when this
+// replica loses the leadership, or false if another replica is the leader
+func leading(ctx context.Context) (context.Context, context.CancelFunc, bool) {
+	if elector == nil {
+		ctx, cancel := context.WithCancel(ctx)
+		return ctx, cancel, true
+	}
+	return elector.Leading(ctx)
+}
+
+// isFollower reports whether another replica is the leader, so this one
+// must not change GitHub or Jira
+func isFollower() bool {
+	return elector != nil && !elector.IsLeader()
+}
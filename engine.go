@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/summarizer"
+	issuesync "github.com/savitaashture/gh-jira/pkg/sync"
+)
+
+// newEngine returns the sync engine over the shared Jira clients, state
+// store and rate limiter, calling GitHub with client and summarizing with
+// sum. Either may be nil when the steps used don't need it.
+func newEngine(client *github.Client, sum *summarizer.Summarizer) *issuesync.Engine {
+	conf := cfg()
+	var gh issuesync.GitHub
+	if client != nil {
+		gh = client.Issues
+	}
+	var s issuesync.Summarizer
+	if sum != nil {
+		s = sum
+	}
+	return issuesync.New(gh, issuesync.JiraClientsFunc(engineJira), s, store, issuesync.Options{
+		IssueState:  conf.GitHub.IssueState,
+		ForceLabel:  conf.GitHub.ForceLabel,
+		RateLimiter: engineRateLimit{ghRateLimit},
+		Redact:      redactor.Redact,
+		MarkerLabel: conf.Jira.MarkerLabel,
+	})
+}
+
+// engineJira returns the client of a Jira instance or sink to the sync
+// engine
+func engineJira(instance string) (issuesync.Jira, error) {
+	t, err := trackerFor(instance)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// engineRateLimit paces the GitHub calls of the sync engine with the shared
+// rate limiter
+type engineRateLimit struct {
+	*rateLimiter
+}
+
+func (r engineRateLimit) Wait(ctx context.Context) error { return r.wait(ctx) }
+
+func (r engineRateLimit) Observe(resp *github.Response, err error) { r.observe(resp, err) }
+
+// engineError converts the errors of the sync engine to those of the sync
+// cycle: failed steps become *syncStageError and authentication failures
+// *fatalError
+func engineError(err error) error {
+	var stageErr *issuesync.StageError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &stageErr):
+		return &syncStageError{stage: stageErr.Stage, err: stageErr.Err}
+	case isAuthError(err):
+		return &fatalError{err: err}
+	}
+	return err
+}
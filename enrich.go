@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/summarizer"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// enrichFields adds the acceptance criteria and story points proposed by
+// the model to the configured Jira fields, unless the field-mapping rules
+// already set them. Enrichment is best effort: problems are returned as
+// warnings.
+func enrichFields(ctx context.Context, sum *summarizer.Summarizer, issue *github.Issue, fields map[string]interface{}) []string {
+	ec := cfg().Summarizer.Enrichment
+	if !ec.Enabled {
+		return nil
+	}
+	ctx, span := startSpan(ctx, "enrich", attribute.Int("github.issue", issue.GetNumber()))
+	e, err := sum.Enrich(ctx, redactor.Redact(fmt.Sprintf("%s\n\n%s", issue.GetTitle(), issueBody(issue))))
+	endSpan(span, err)
+	if err != nil {
+		log.Printf("Failed to generate acceptance criteria and estimate for issue #%d: %v", issue.GetNumber(), err)
+		return []string{fmt.Sprintf("Acceptance criteria and story points could not be generated: %v", err)}
+	}
+
+	if f := ec.AcceptanceCriteriaField; f != "" && fields[f] == nil && len(e.AcceptanceCriteria) > 0 {
+		var b strings.Builder
+		for _, c := range e.AcceptanceCriteria {
+			fmt.Fprintf(&b, "* %s\n", strings.TrimSpace(c))
+		}
+		fields[f] = strings.TrimSuffix(b.String(), "\n")
+	}
+	if f := ec.StoryPointsField; f != "" && fields[f] == nil && e.StoryPoints > 0 {
+		fields[f] = e.StoryPoints
+	}
+	log.Printf("Proposed %d acceptance criteria and %g story points for issue #%d", len(e.AcceptanceCriteria), e.StoryPoints, issue.GetNumber())
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/jira"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+// epicCursor names the state cursor holding the Jira epic of a milestone of
+// a repository in a Jira project
+func epicCursor(instance, project, repo string, milestone int) string {
+	return fmt.Sprintf("epic:%s/%s:%s#%d", instance, project, repo, milestone)
+}
+
+// epicMemberCursor names the state cursor holding the epic a synced issue
+// was last linked to
+func epicMemberCursor(key string) string {
+	return "epic-member:" + key
+}
+
+// syncEpic links the Jira issue of a mapping to the epic of the milestone of
+// the GitHub issue, creating the epic if needed, and unlinks it when the
+// issue left its milestone
+func syncEpic(ctx context.Context, repo config.RepoConfig, issue *github.Issue, m *state.Mapping) error {
+	conf := cfg()
+	if !conf.Jira.Epics.Enabled || m.JiraKey == "" {
+		return nil
+	}
+	current, err := store.GetCursor(ctx, epicMemberCursor(m.Key))
+	if err != nil {
+		return err
+	}
+	jc, err := jiraFor(m.JiraInstance)
+	if err != nil {
+		return err
+	}
+
+	var want string
+	if ms := issue.GetMilestone(); ms != nil {
+		project, _, _ := strings.Cut(m.JiraKey, "-")
+		if want, err = milestoneEpic(ctx, jc, m.JiraInstance, project, repo, ms); err != nil {
+			return err
+		}
+	}
+	if want == current {
+		return nil
+	}
+
+	var link interface{}
+	switch {
+	case want == "":
+		log.Printf("GitHub issue #%d left its milestone, removing %s from epic %s", issue.GetNumber(), m.JiraKey, current)
+	case conf.Jira.Epics.LinkField == "parent":
+		link = map[string]string{"key": want}
+	default:
+		link = want
+	}
+	if want != "" {
+		log.Printf("Adding %s to epic %s of milestone %s", m.JiraKey, want, issue.GetMilestone().GetTitle())
+	}
+	fields := map[string]interface{}{conf.Jira.Epics.LinkField: link}
+	if err := jc.UpdateIssue(ctx, m.JiraKey, fields); err != nil {
+		return fmt.Errorf("failed to link %s to epic %q: %w", m.JiraKey, want, err)
+	}
+	e := jiraAudit("update_issue", m.JiraKey, map[string]interface{}{"fields": fieldNames(fields), "epic": want})
+	e.Repo, e.Issue = repo.FullName(), issue.GetNumber()
+	recordAudit(e)
+	return store.SetCursor(ctx, epicMemberCursor(m.Key), want)
+}
+
+// milestoneEpic returns the key of the epic of a milestone in a Jira
+// project. An epic named like the milestone is adopted; otherwise one is
+// created.
+func milestoneEpic(ctx context.Context, jc *jira.Client, instance, project string, repo config.RepoConfig, ms *github.Milestone) (string, error) {
+	conf := cfg()
+	cursor := epicCursor(instance, project, repo.FullName(), ms.GetNumber())
+	if key, err := store.GetCursor(ctx, cursor); err != nil || key != "" {
+		return key, err
+	}
+
+	key, err := findEpic(ctx, jc, project, ms.GetTitle())
+	if err != nil {
+		return "", err
+	}
+	if key != "" {
+		log.Printf("Using existing epic %s for milestone %s of %s", key, ms.GetTitle(), repo.FullName())
+	} else {
+		fields := map[string]interface{}{
+			"project":     map[string]string{"key": project},
+			"issuetype":   map[string]string{"name": conf.Jira.Epics.IssueType},
+			"summary":     ms.GetTitle(),
+			"description": fmt.Sprintf("Milestone of GitHub repository %s: %s\n\n%s", repo.FullName(), ms.GetHTMLURL(), ms.GetDescription()),
+		}
+		if conf.Jira.Epics.NameField != "" {
+			fields[conf.Jira.Epics.NameField] = ms.GetTitle()
+		}
+		created, err := jc.CreateIssue(ctx, fields)
+		if err != nil {
+			return "", fmt.Errorf("failed to create epic for milestone %s: %w", ms.GetTitle(), err)
+		}
+		key = created.Key
+		log.Printf("Created epic %s for milestone %s of %s", key, ms.GetTitle(), repo.FullName())
+		e := jiraAudit("create_issue", key, map[string]interface{}{"fields": fieldNames(fields), "milestone": ms.GetTitle()})
+		e.Repo = repo.FullName()
+		recordAudit(e)
+	}
+	return key, store.SetCursor(ctx, cursor, key)
+}
+
+// errEpicFound stops the epic search at the first match
+var errEpicFound = errors.New("epic found")
+
+// findEpic returns the key of the epic of a project with exactly the given
+// summary, or "" if there is none
+func findEpic(ctx context.Context, jc *jira.Client, project, summary string) (string, error) {
+	jql := fmt.Sprintf(`project = %s AND issuetype = %s AND summary ~ %s`,
+		jqlString(project), jqlString(cfg().Jira.Epics.IssueType), jqlString(jqlString(summary)))
+	var key string
+	err := jc.Search(ctx, jql, []string{"summary"}, func(ji *jira.Issue) error {
+		if ji.Fields.Summary != summary {
+			return nil
+		}
+		key = ji.Key
+		return errEpicFound
+	})
+	if err != nil && !errors.Is(err, errEpicFound) {
+		return "", fmt.Errorf("failed to search epic %q: %w", summary, err)
+	}
+	return key, nil
+}
+
+// jqlString quotes s as a JQL string literal
+func jqlString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
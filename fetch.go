@@ -0,0 +1,455 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+)
+
+// issuesPerPoll is the number of most recent issues each poll looks at,
+// the page size of the REST listing, so both fetch modes see the same
+// issues
+const issuesPerPoll = 30
+
+// forcedPerPoll is the number of issues carrying the force-sync label each
+// poll looks at
+const forcedPerPoll = 100
+
+// commentsPerIssue is the number of most recent comments fetched with each
+// issue; the comments of issues with more are listed through REST
+const commentsPerIssue = 100
+
+// referencesPerIssue is the number of most recent pull request and commit
+// references fetched with each issue
+const referencesPerIssue = 50
+
+const issuesQuery = `query($owner: String!, $name: String!, $first: Int!, $states: [IssueState!], $labels: [String!], $order: IssueOrderField!, $comments: Int!, $references: Int!, $timeline: Boolean!) {
+  repository(owner: $owner, name: $name) {
+    issues(first: $first, states: $states, labels: $labels, orderBy: {field: $order, direction: DESC}) {
+      nodes {
+        id
+        databaseId
+        number
+        title
+        body
+        url
+        state
+        createdAt
+        updatedAt
+        closedAt
+        author { login }
+        labels(first: 100) { nodes { name } }
+        assignees(first: 20) { nodes { login } }
+        milestone { number title }
+        reactions(content: THUMBS_UP) { totalCount }
+        comments(last: $comments) {
+          totalCount
+          nodes {
+            id
+            databaseId
+            body
+            url
+            createdAt
+            updatedAt
+            author { login }
+          }
+        }
+        timelineItems(last: $references, itemTypes: [CROSS_REFERENCED_EVENT, REFERENCED_EVENT]) @include(if: $timeline) {
+          totalCount
+          nodes {
+            ... on CrossReferencedEvent {
+              source {
+                ... on PullRequest {
+                  number
+                  title
+                  url
+                  state
+                  headRefName
+                  repository { nameWithOwner }
+                }
+              }
+            }
+            ... on ReferencedEvent {
+              commit {
+                oid
+                url
+                messageHeadline
+                committedDate
+                repository { nameWithOwner }
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+// ghComment is an issue comment as returned by issuesQuery
+type ghComment struct {
+	ID         string    `json:"id"`
+	DatabaseID int64     `json:"databaseId"`
+	Body       string    `json:"body"`
+	URL        string    `json:"url"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+	Author     *struct {
+		Login string `json:"login"`
+	} `json:"author"`
+}
+
+// ghIssue is a GitHub issue as returned by issuesQuery
+type ghIssue struct {
+	ID         string     `json:"id"`
+	DatabaseID int64      `json:"databaseId"`
+	Number     int        `json:"number"`
+	Title      string     `json:"title"`
+	Body       string     `json:"body"`
+	URL        string     `json:"url"`
+	State      string     `json:"state"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+	ClosedAt   *time.Time `json:"closedAt"`
+	Author     *struct {
+		Login string `json:"login"`
+	} `json:"author"`
+	Labels struct {
+		Nodes []struct {
+			Name string `json:"name"`
+		} `json:"nodes"`
+	} `json:"labels"`
+	Assignees struct {
+		Nodes []struct {
+			Login string `json:"login"`
+		} `json:"nodes"`
+	} `json:"assignees"`
+	Milestone *struct {
+		Number int    `json:"number"`
+		Title  string `json:"title"`
+	} `json:"milestone"`
+	Reactions struct {
+		TotalCount int `json:"totalCount"`
+	} `json:"reactions"`
+	Comments struct {
+		TotalCount int          `json:"totalCount"`
+		Nodes      []*ghComment `json:"nodes"`
+	} `json:"comments"`
+	// TimelineItems are the pull request and commit references, only
+	// fetched when they are synced to Jira
+	TimelineItems *struct {
+		TotalCount int `json:"totalCount"`
+		Nodes      []struct {
+			Source *struct {
+				// Number is 0 unless the source is a pull request
+				Number      int    `json:"number"`
+				Title       string `json:"title"`
+				URL         string `json:"url"`
+				State       string `json:"state"`
+				HeadRefName string `json:"headRefName"`
+				Repository  struct {
+					NameWithOwner string `json:"nameWithOwner"`
+				} `json:"repository"`
+			} `json:"source"`
+			Commit *struct {
+				OID             string    `json:"oid"`
+				URL             string    `json:"url"`
+				MessageHeadline string    `json:"messageHeadline"`
+				CommittedDate   time.Time `json:"committedDate"`
+				Repository      struct {
+					NameWithOwner string `json:"nameWithOwner"`
+				} `json:"repository"`
+			} `json:"commit"`
+		} `json:"nodes"`
+	} `json:"timelineItems"`
+}
+
+// issue returns i as the REST API would, for the repository at repoURL
+func (i *ghIssue) issue(repoURL string) *github.Issue {
+	issue := &github.Issue{
+		ID:            github.Ptr(i.DatabaseID),
+		NodeID:        github.Ptr(i.ID),
+		Number:        github.Ptr(i.Number),
+		Title:         github.Ptr(i.Title),
+		Body:          github.Ptr(i.Body),
+		HTMLURL:       github.Ptr(i.URL),
+		RepositoryURL: github.Ptr(repoURL),
+		State:         github.Ptr(strings.ToLower(i.State)),
+		CreatedAt:     &github.Timestamp{Time: i.CreatedAt},
+		UpdatedAt:     &github.Timestamp{Time: i.UpdatedAt},
+		Comments:      github.Ptr(i.Comments.TotalCount),
+		Reactions:     &github.Reactions{PlusOne: github.Ptr(i.Reactions.TotalCount)},
+	}
+	if i.ClosedAt != nil {
+		issue.ClosedAt = &github.Timestamp{Time: *i.ClosedAt}
+	}
+	if i.Author != nil {
+		issue.User = &github.User{Login: github.Ptr(i.Author.Login)}
+	}
+	for _, l := range i.Labels.Nodes {
+		issue.Labels = append(issue.Labels, &github.Label{Name: github.Ptr(l.Name)})
+	}
+	for _, a := range i.Assignees.Nodes {
+		issue.Assignees = append(issue.Assignees, &github.User{Login: github.Ptr(a.Login)})
+	}
+	if len(issue.Assignees) > 0 {
+		issue.Assignee = issue.Assignees[0]
+	}
+	if i.Milestone != nil {
+		issue.Milestone = &github.Milestone{Number: github.Ptr(i.Milestone.Number), Title: github.Ptr(i.Milestone.Title)}
+	}
+	return issue
+}
+
+// comments returns the comments of i as the REST API would, or false if
+// not all of them were fetched
+func (i *ghIssue) comments() ([]*github.IssueComment, bool) {
+	if len(i.Comments.Nodes) < i.Comments.TotalCount {
+		return nil, false
+	}
+	comments := make([]*github.IssueComment, 0, len(i.Comments.Nodes))
+	for _, c := range i.Comments.Nodes {
+		comment := &github.IssueComment{
+			ID:        github.Ptr(c.DatabaseID),
+			NodeID:    github.Ptr(c.ID),
+			Body:      github.Ptr(c.Body),
+			HTMLURL:   github.Ptr(c.URL),
+			CreatedAt: &github.Timestamp{Time: c.CreatedAt},
+			UpdatedAt: &github.Timestamp{Time: c.UpdatedAt},
+		}
+		if c.Author != nil {
+			comment.User = &github.User{Login: github.Ptr(c.Author.Login)}
+		}
+		comments = append(comments, comment)
+	}
+	return comments, true
+}
+
+// timeline returns the pull requests and commits referencing i, or false
+// if they weren't fetched or not all of them were
+func (i *ghIssue) timeline() (*issueTimeline, bool) {
+	if i.TimelineItems == nil || len(i.TimelineItems.Nodes) < i.TimelineItems.TotalCount {
+		return nil, false
+	}
+	t := &issueTimeline{}
+	for _, n := range i.TimelineItems.Nodes {
+		switch src, c := n.Source, n.Commit; {
+		case src != nil && src.Number != 0:
+			t.Pulls = append(t.Pulls, linkedPull{
+				Repo:   src.Repository.NameWithOwner,
+				Number: src.Number,
+				Title:  src.Title,
+				URL:    src.URL,
+				State:  strings.ToLower(src.State),
+				Branch: src.HeadRefName,
+			})
+		case c != nil:
+			t.Commits = append(t.Commits, linkedCommit{
+				Repo:    c.Repository.NameWithOwner,
+				SHA:     c.OID,
+				URL:     c.URL,
+				Message: c.MessageHeadline,
+				Date:    c.CommittedDate,
+			})
+		}
+	}
+	return t, true
+}
+
+// fetchedIssue is what was fetched with an issue besides the issue itself
+type fetchedIssue struct {
+	// comments are set if all comments were fetched
+	comments    []*github.IssueComment
+	hasComments bool
+	// timeline is set if all referencing pull requests and commits were
+	// fetched
+	timeline *issueTimeline
+}
+
+// issueCache holds what was fetched with the issues of each repository in
+// the current poll cycle, so that it isn't requested again for each issue
+type issueCache struct {
+	mu sync.Mutex
+	// byRepo holds the fetched data by issue number, by repository
+	byRepo map[string]map[int]*fetchedIssue
+}
+
+// fetchedIssues is what was fetched with the issues of the last poll of
+// each repository
+var fetchedIssues = &issueCache{byRepo: map[string]map[int]*fetchedIssue{}}
+
+// replace sets the fetched data of a repository, dropping that of its last
+// poll
+func (c *issueCache) replace(repo string, issues map[int]*fetchedIssue) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(issues) == 0 {
+		delete(c.byRepo, repo)
+		return
+	}
+	c.byRepo[repo] = issues
+}
+
+// comments returns the fetched comments of an issue, if all were fetched
+func (c *issueCache) comments(repo string, number int) ([]*github.IssueComment, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if f := c.byRepo[repo][number]; f != nil && f.hasComments {
+		return f.comments, true
+	}
+	return nil, false
+}
+
+// timeline returns the fetched pull requests and commits referencing an
+// issue, if all were fetched
+func (c *issueCache) timeline(repo string, number int) (*issueTimeline, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if f := c.byRepo[repo][number]; f != nil && f.timeline != nil {
+		return f.timeline, true
+	}
+	return nil, false
+}
+
+// setTimeline keeps the references of an issue listed through REST until
+// the next poll of its repository
+func (c *issueCache) setTimeline(repo string, number int, t *issueTimeline) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.byRepo[repo] == nil {
+		c.byRepo[repo] = map[int]*fetchedIssue{}
+	}
+	if c.byRepo[repo][number] == nil {
+		c.byRepo[repo][number] = &fetchedIssue{}
+	}
+	c.byRepo[repo][number].timeline = t
+}
+
+// graphQLFetchFailed is set once fetching issues through GraphQL failed, so
+// the following polls use REST right away
+var graphQLFetchFailed atomic.Bool
+
+// fetchIssues lists the issues of a repository for a poll with the
+// configured fetch mode. Should GitHub reject the GraphQL query, as
+// GitHub Enterprise Server versions whose schema lacks a field or that
+// don't serve GraphQL do, gh-jira falls back to REST until it is restarted.
+func fetchIssues(ctx context.Context, client *github.Client, repo config.RepoConfig) ([]*github.Issue, error) {
+	if cfg().GitHub.Fetch == config.FetchGraphQL && !graphQLFetchFailed.Load() {
+		issues, err := fetchIssuesGraphQL(ctx, client, repo)
+		if !graphQLUnsupported(err) {
+			return issues, err
+		}
+		log.Printf("Failed to fetch issues through GraphQL, falling back to REST: %v", err)
+		graphQLFetchFailed.Store(true)
+	}
+	fetchedIssues.replace(repo.FullName(), nil)
+	return newEngine(client, nil).ListIssues(ctx, repo)
+}
+
+// graphQLUnsupported reports whether err shows that GitHub can't answer the
+// issues query, rather than that the repository is missing or the request
+// failed
+func graphQLUnsupported(err error) bool {
+	var gqlErr *graphQLError
+	if errors.As(err, &gqlErr) {
+		return !slices.Contains(gqlErr.Types, "NOT_FOUND")
+	}
+	var respErr *github.ErrorResponse
+	return errors.As(err, &respErr) && respErr.Response.StatusCode == http.StatusNotFound
+}
+
+// fetchIssuesGraphQL lists the most recent issues of a repository like the
+// REST listing, plus any issue carrying the force-sync label, with their
+// comments, 👍 reactions and, if synced to Jira, the pull requests and
+// commits referencing them in one query each. The comments and references
+// are kept for listComments and listTimeline.
+func fetchIssuesGraphQL(ctx context.Context, client *github.Client, repo config.RepoConfig) ([]*github.Issue, error) {
+	conf := cfg()
+	var states []string
+	order := "CREATED_AT"
+	switch conf.GitHub.IssueState {
+	case config.IssuesOpen:
+		states = []string{"OPEN"}
+	case config.IssuesClosed:
+		states = []string{"CLOSED"}
+	}
+	if conf.GitHub.IssueState != config.IssuesOpen {
+		// Recently closed issues first, as with REST
+		order = "UPDATED_AT"
+	}
+	log.Printf("Fetching %s issues from GitHub repository %s through GraphQL", conf.GitHub.IssueState, repo.FullName())
+	fetched, err := queryIssues(ctx, client, repo, issuesPerPoll, states, nil, order)
+	if err != nil {
+		return nil, err
+	}
+	if conf.GitHub.ForceLabel != "" {
+		log.Printf("Fetching issues labelled %s from GitHub repository %s through GraphQL", conf.GitHub.ForceLabel, repo.FullName())
+		forced, err := queryIssues(ctx, client, repo, forcedPerPoll, nil, []string{conf.GitHub.ForceLabel}, "CREATED_AT")
+		if err != nil {
+			return nil, err
+		}
+		fetched = append(fetched, forced...)
+	}
+
+	repoURL := client.BaseURL.String() + "repos/" + repo.FullName()
+	seen := make(map[int64]bool, len(fetched))
+	extra := make(map[int]*fetchedIssue, len(fetched))
+	var issues []*github.Issue
+	for _, i := range fetched {
+		if seen[i.DatabaseID] {
+			continue
+		}
+		seen[i.DatabaseID] = true
+		issues = append(issues, i.issue(repoURL))
+		f := &fetchedIssue{}
+		f.comments, f.hasComments = i.comments()
+		f.timeline, _ = i.timeline()
+		extra[i.Number] = f
+	}
+	fetchedIssues.replace(repo.FullName(), extra)
+	return issues, nil
+}
+
+// queryIssues runs issuesQuery for the issues of a repository in states
+// (all if empty) with all of labels
+func queryIssues(ctx context.Context, client *github.Client, repo config.RepoConfig, first int, states, labels []string, order string) ([]*ghIssue, error) {
+	conf := cfg()
+	var data struct {
+		Repository *struct {
+			Issues struct {
+				Nodes []*ghIssue `json:"nodes"`
+			} `json:"issues"`
+		} `json:"repository"`
+	}
+	vars := map[string]interface{}{
+		"owner":      repo.Owner,
+		"name":       repo.Name,
+		"first":      first,
+		"order":      order,
+		"comments":   commentsPerIssue,
+		"references": referencesPerIssue,
+		"timeline":   conf.Jira.PullRequests.Enabled || conf.Jira.Development.Enabled,
+	}
+	if len(states) > 0 {
+		vars["states"] = states
+	}
+	if len(labels) > 0 {
+		vars["labels"] = labels
+	}
+	if err := graphQL(ctx, client, issuesQuery, vars, &data); err != nil {
+		return nil, err
+	}
+	if data.Repository == nil {
+		return nil, fmt.Errorf("repository %s not found", repo.FullName())
+	}
+	return data.Repository.Issues.Nodes, nil
+}
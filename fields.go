@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+// fieldSnapshot holds the GitHub issue attributes last written to the Jira
+// fields of a synced issue
+type fieldSnapshot struct {
+	// Labels are the GitHub labels as Jira labels, sorted
+	Labels []string `json:"labels"`
+	// Assignee is the Jira user of the first GitHub assignee mapped to one
+	Assignee  string `json:"assignee,omitempty"`
+	Milestone string `json:"milestone,omitempty"`
+}
+
+// fieldDiff is what changed between two field snapshots
+type fieldDiff struct {
+	AddedLabels   []string
+	RemovedLabels []string
+	// Assignee and Milestone are set to the new value when it changed
+	Assignee  *string
+	Milestone *string
+}
+
+// fieldSnapshotCursor names the state cursor holding the field snapshot of
+// a synced issue as JSON
+func fieldSnapshotCursor(key string) string {
+	return "fields:" + key
+}
+
+// currentFields returns the field snapshot of a GitHub issue
+func currentFields(issue *github.Issue) fieldSnapshot {
+	var snap fieldSnapshot
+	for _, l := range issue.Labels {
+		// Jira labels can't contain spaces
+		if name := strings.Join(strings.Fields(l.GetName()), "-"); name != "" {
+			snap.Labels = append(snap.Labels, name)
+		}
+	}
+	slices.Sort(snap.Labels)
+	snap.Labels = slices.Compact(snap.Labels)
+	for _, a := range issue.Assignees {
+		if user := cfg().JiraUser(a.GetLogin()); user != "" {
+			snap.Assignee = user
+			break
+		}
+	}
+	snap.Milestone = issue.GetMilestone().GetTitle()
+	return snap
+}
+
+// diffFields compares the field snapshot last written with the current one
+func diffFields(prev, cur fieldSnapshot) fieldDiff {
+	var d fieldDiff
+	for _, l := range cur.Labels {
+		if !slices.Contains(prev.Labels, l) {
+			d.AddedLabels = append(d.AddedLabels, l)
+		}
+	}
+	for _, l := range prev.Labels {
+		if !slices.Contains(cur.Labels, l) {
+			d.RemovedLabels = append(d.RemovedLabels, l)
+		}
+	}
+	if prev.Assignee != cur.Assignee {
+		d.Assignee = &cur.Assignee
+	}
+	if prev.Milestone != cur.Milestone {
+		d.Milestone = &cur.Milestone
+	}
+	return d
+}
+
+// empty reports whether nothing changed
+func (d fieldDiff) empty() bool {
+	return len(d.AddedLabels) == 0 && len(d.RemovedLabels) == 0 && d.Assignee == nil && d.Milestone == nil
+}
+
+// String describes the changes for the logs, e.g.
+// "labels +bug -triage, assignee alice, milestone none"
+func (d fieldDiff) String() string {
+	var parts []string
+	if len(d.AddedLabels) > 0 || len(d.RemovedLabels) > 0 {
+		var ls []string
+		for _, l := range d.AddedLabels {
+			ls = append(ls, "+"+l)
+		}
+		for _, l := range d.RemovedLabels {
+			ls = append(ls, "-"+l)
+		}
+		parts = append(parts, "labels "+strings.Join(ls, " "))
+	}
+	for _, c := range []struct {
+		name  string
+		value *string
+	}{{"assignee", d.Assignee}, {"milestone", d.Milestone}} {
+		switch {
+		case c.value == nil:
+		case *c.value == "":
+			parts = append(parts, c.name+" none")
+		default:
+			parts = append(parts, c.name+" "+*c.value)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// syncFields writes the label, assignee and milestone changes of a synced
+// GitHub issue since the last poll to its Jira issue. Only the changed
+// fields are updated, and labels are added and removed one by one so that
+// labels set in Jira are kept. Before the first snapshot of an issue every
+// field counts as changed.
+func syncFields(ctx context.Context, repo config.RepoConfig, issue *github.Issue, m *state.Mapping) error {
+	fs := cfg().Jira.FieldSync
+	if !fs.Enabled || m.JiraKey == "" {
+		return nil
+	}
+	var prev fieldSnapshot
+	if stored, err := store.GetCursor(ctx, fieldSnapshotCursor(m.Key)); err != nil {
+		return err
+	} else if stored != "" {
+		if err := json.Unmarshal([]byte(stored), &prev); err != nil {
+			return fmt.Errorf("invalid field snapshot of %s: %w", m.Key, err)
+		}
+	}
+	cur := currentFields(issue)
+	diff := diffFields(prev, cur)
+	if diff.empty() {
+		return nil
+	}
+
+	fields := map[string]interface{}{}
+	update := map[string][]map[string]interface{}{}
+	for _, l := range diff.AddedLabels {
+		update["labels"] = append(update["labels"], map[string]interface{}{"add": l})
+	}
+	for _, l := range diff.RemovedLabels {
+		update["labels"] = append(update["labels"], map[string]interface{}{"remove": l})
+	}
+	if diff.Assignee != nil {
+		if *diff.Assignee == "" {
+			fields["assignee"] = nil
+		} else {
+			fields["assignee"] = *diff.Assignee
+		}
+	}
+	if diff.Milestone != nil && fs.MilestoneField != "" {
+		fields[fs.MilestoneField] = *diff.Milestone
+	}
+
+	log.Printf("Fields of GitHub issue #%d changed: %s", issue.GetNumber(), diff)
+	if len(fields) > 0 || len(update) > 0 {
+		jc, err := jiraFor(m.JiraInstance)
+		if err != nil {
+			return err
+		}
+		if err := jc.EditIssue(ctx, m.JiraKey, fields, update); err != nil {
+			return fmt.Errorf("failed to update the fields of %s: %w", m.JiraKey, err)
+		}
+		names := fieldNames(fields)
+		if len(update) > 0 {
+			names = append(names, "labels")
+		}
+		e := jiraAudit("update_issue", m.JiraKey, map[string]interface{}{"fields": names, "changes": diff.String()})
+		e.Repo, e.Issue = repo.FullName(), issue.GetNumber()
+		recordAudit(e)
+	}
+	fieldChanges.record(diff)
+
+	data, _ := json.Marshal(cur)
+	return store.SetCursor(ctx, fieldSnapshotCursor(m.Key), string(data))
+}
+
+// fieldChangeCounter counts the changes found by syncFields, by field
+type fieldChangeCounter struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+// fieldChanges are the changes found since the start, served at /metrics
+var fieldChanges = &fieldChangeCounter{counts: map[string]int64{}}
+
+// record counts the changes of a diff
+func (c *fieldChangeCounter) record(d fieldDiff) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts["labels"] += int64(len(d.AddedLabels) + len(d.RemovedLabels))
+	if d.Assignee != nil {
+		c.counts["assignee"]++
+	}
+	if d.Milestone != nil {
+		c.counts["milestone"]++
+	}
+}
+
+// write writes the counts in the Prometheus text format
+func (c *fieldChangeCounter) write(out io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	const name = "gh_jira_field_changes_total"
+	if _, err := fmt.Fprintf(out, "# HELP %s Label, assignee and milestone changes of synced GitHub issues\n# TYPE %s counter\n", name, name); err != nil {
+		return err
+	}
+	for _, field := range []string{"labels", "assignee", "milestone"} {
+		if _, err := fmt.Fprintf(out, "%s{field=%q} %d\n", name, field, c.counts[field]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
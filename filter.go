@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/filter"
+)
+
+// loadFilters parses the filter expressions of the settings
+func loadFilters(s *settings) error {
+	f := s.cfg.GitHub.Filter
+	s.issueFilter, s.repoFilters = nil, map[string]*filter.Expr{}
+	if f.Expr != "" {
+		expr, err := filter.Parse(f.Expr)
+		if err != nil {
+			return fmt.Errorf("invalid GitHub filter: %w", err)
+		}
+		s.issueFilter = expr
+		log.Printf("Only syncing issues matching %s", f.Expr)
+	}
+	if len(f.Authors) > 0 {
+		log.Printf("Only syncing issues opened by %s", strings.Join(f.Authors, ", "))
+	}
+	if len(f.ExcludeAuthors) > 0 {
+		log.Printf("Never syncing issues opened by %s", strings.Join(f.ExcludeAuthors, ", "))
+	}
+	for _, r := range s.cfg.GitHub.Repos {
+		if r.Filter == "" {
+			continue
+		}
+		expr, err := filter.Parse(r.Filter)
+		if err != nil {
+			return fmt.Errorf("invalid filter of repository %s: %w", r.FullName(), err)
+		}
+		s.repoFilters[r.FullName()] = expr
+		log.Printf("Only syncing issues of %s matching %s", r.FullName(), r.Filter)
+	}
+	return nil
+}
+
+// filterIssue returns the filter issue of issue
+func filterIssue(repo config.RepoConfig, issue *github.Issue) filter.Issue {
+	fi := filter.Issue{
+		Repo:   repo.FullName(),
+		Number: issue.GetNumber(),
+		Title:  issue.GetTitle(),
+		Body:   issue.GetBody(),
+		Author: issue.GetUser().GetLogin(),
+		State:  issue.GetState(),
+	}
+	for _, l := range issue.Labels {
+		fi.Labels = append(fi.Labels, l.GetName())
+	}
+	if issue.Milestone != nil {
+		fi.Milestone = issue.Milestone.GetTitle()
+	}
+	return fi
+}
+
+// filteredOut returns why the filters exclude an issue of repo, or "" if
+// it is synced
+func filteredOut(repo config.RepoConfig, issue *github.Issue) string {
+	s := current()
+	f := s.cfg.GitHub.Filter
+	author := issue.GetUser().GetLogin()
+	equalFold := func(login string) bool { return strings.EqualFold(login, author) }
+	switch {
+	case len(f.Authors) > 0 && !slices.ContainsFunc(f.Authors, equalFold):
+		return fmt.Sprintf("its author %s is not allowed", author)
+	case slices.ContainsFunc(f.ExcludeAuthors, equalFold):
+		return fmt.Sprintf("its author %s is excluded", author)
+	}
+	fi := filterIssue(repo, issue)
+	if !s.issueFilter.Match(fi) {
+		return fmt.Sprintf("it does not match %s", s.issueFilter)
+	}
+	if expr := s.repoFilters[repo.FullName()]; !expr.Match(fi) {
+		return fmt.Sprintf("it does not match %s", expr)
+	}
+	return ""
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/rules"
+)
+
+// formFields sets the Jira fields configured for the `### Heading` sections
+// of an issue form body. Sections that don't fit their field are returned
+// as warnings.
+func formFields(issue *github.Issue, fields map[string]interface{}) []string {
+	conf := cfg()
+	if len(conf.Jira.FormFields) == 0 {
+		return nil
+	}
+	sections := rules.ParseSections(redactor.Redact(issue.GetBody()))
+	var warnings []string
+	copied := 0
+	for _, f := range conf.Jira.FormFields {
+		value := rules.Section(sections, f.Heading)
+		if value == "" {
+			continue
+		}
+		switch f.Type {
+		case config.FormOption:
+			fields[f.Field] = map[string]string{"value": value}
+		case config.FormNumber:
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("%q is not a number for the Jira field of the %s section", value, f.Heading))
+				continue
+			}
+			fields[f.Field] = n
+		case config.FormLabels:
+			labels, _ := fields[f.Field].([]string)
+			for _, l := range strings.Split(value, ",") {
+				// Jira labels can't contain spaces
+				if l = strings.Join(strings.Fields(l), "-"); l != "" {
+					labels = append(labels, l)
+				}
+			}
+			fields[f.Field] = labels
+		default:
+			fields[f.Field] = value
+		}
+		copied++
+	}
+	if copied > 0 {
+		log.Printf("Copied %d issue form sections of GitHub issue #%d to Jira fields", copied, issue.GetNumber())
+	}
+	return warnings
+}
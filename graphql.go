@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/google/go-github/v75/github"
+)
+
+// graphQLPath is the GraphQL endpoint relative to the REST API URL: /graphql
+// on GitHub.com and /api/graphql on GitHub Enterprise Server
+const graphQLPath = "../graphql"
+
+// graphQLError is returned for a GraphQL query or mutation GitHub rejected
+type graphQLError struct {
+	Messages []string
+	// Types are the error types GitHub reported, such as NOT_FOUND
+	Types []string
+}
+
+func (e *graphQLError) Error() string {
+	return "GitHub GraphQL error: " + strings.Join(e.Messages, "; ")
+}
+
+// graphQL runs a GitHub GraphQL query or mutation and decodes its data into
+// out
+func graphQL(ctx context.Context, client *github.Client, query string, vars map[string]interface{}, out interface{}) error {
+	if err := ghRateLimit.wait(ctx); err != nil {
+		return err
+	}
+	req, err := client.NewRequest("POST", graphQLPath, map[string]interface{}{"query": query, "variables": vars})
+	if err != nil {
+		return err
+	}
+	var res struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+		} `json:"errors"`
+	}
+	resp, err := client.Do(ctx, req, &res)
+	ghRateLimit.observe(resp, err)
+	if err != nil {
+		return err
+	}
+	if len(res.Errors) > 0 {
+		gqlErr := &graphQLError{}
+		for _, e := range res.Errors {
+			gqlErr.Messages = append(gqlErr.Messages, e.Message)
+			if e.Type != "" {
+				gqlErr.Types = append(gqlErr.Types, e.Type)
+			}
+		}
+		return gqlErr
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(res.Data, out)
+}
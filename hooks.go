@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/hooks"
+	"github.com/savitaashture/gh-jira/pkg/state"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// syncHooks runs the configured hooks; nil when there are none
+var syncHooks *hooks.Runner
+
+// loadHooks opens the configured plugins and registers all hooks
+func loadHooks() error {
+	conf := cfg()
+	if len(conf.Hooks) == 0 {
+		return nil
+	}
+	r := &hooks.Runner{}
+	for _, h := range conf.Hooks {
+		var hook hooks.Hook
+		if h.Plugin != "" {
+			var err error
+			if hook, err = hooks.OpenPlugin(h.Plugin); err != nil {
+				return err
+			}
+		} else {
+			hook = &hooks.Exec{Path: h.Exec, Args: h.Args, Timeout: h.Timeout, Env: h.Env}
+		}
+		r.Add(h.Name, h.Stages, hook)
+		stages := h.Stages
+		if len(stages) == 0 {
+			stages = hooks.Stages
+		}
+		log.Printf("Running hook %s at %s", h.Name, strings.Join(stages, ", "))
+	}
+	syncHooks = r
+	return nil
+}
+
+// hookPayload returns the payload of the hooks of an issue of repo
+func hookPayload(repo config.RepoConfig, issue *github.Issue) *hooks.Payload {
+	return &hooks.Payload{
+		Repo: repo.FullName(),
+		Issue: hooks.Issue{
+			Number: issue.GetNumber(),
+			Title:  issue.GetTitle(),
+			Body:   issue.GetBody(),
+			URL:    issue.GetHTMLURL(),
+			Author: issue.GetUser().GetLogin(),
+			State:  issue.GetState(),
+			Labels: ruleIssue(issue).Labels,
+		},
+	}
+}
+
+// runHooks runs the hooks of a stage on p
+func runHooks(ctx context.Context, stage string, p *hooks.Payload) (err error) {
+	ctx, span := startSpan(ctx, "hooks", attribute.String("gh_jira.hook_stage", stage), attribute.Int("github.issue", p.Issue.Number))
+	defer func() { endSpan(span, err) }()
+	return syncHooks.Run(ctx, stage, p)
+}
+
+// beforeSummarize returns the text to summarize an issue from, as changed by
+// the BeforeSummarize hooks
+func beforeSummarize(ctx context.Context, repo config.RepoConfig, issue *github.Issue) (string, error) {
+	if syncHooks.Len() == 0 {
+		return issueBody(issue), nil
+	}
+	p := hookPayload(repo, issue)
+	p.Text = issueBody(issue)
+	if err := runHooks(ctx, hooks.BeforeSummarize, p); err != nil {
+		return "", err
+	}
+	return p.Text, nil
+}
+
+// beforeJiraCreate returns the fields of a new Jira issue as changed by the
+// BeforeJiraCreate hooks
+func beforeJiraCreate(ctx context.Context, repo config.RepoConfig, issue *github.Issue, summary string, fields map[string]interface{}) (map[string]interface{}, error) {
+	if syncHooks.Len() == 0 {
+		return fields, nil
+	}
+	p := hookPayload(repo, issue)
+	p.Summary, p.Fields = summary, fields
+	if err := runHooks(ctx, hooks.BeforeJiraCreate, p); err != nil {
+		return nil, err
+	}
+	return p.Fields, nil
+}
+
+// afterSync runs the AfterSync hooks of a synced issue. Failures are only
+// logged as the sync itself succeeded.
+func afterSync(ctx context.Context, repo config.RepoConfig, issue *github.Issue, m *state.Mapping) {
+	if syncHooks.Len() == 0 {
+		return
+	}
+	p := hookPayload(repo, issue)
+	p.JiraKey = m.JiraKey
+	if err := runHooks(ctx, hooks.AfterSync, p); err != nil {
+		log.Printf("Failed to run the after sync hooks of GitHub issue #%d: %v", issue.GetNumber(), err)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/jira"
+)
+
+// jiraClients holds the clients of all Jira instances by name, "" being the
+// main instance
+var jiraClients map[string]*jira.Client
+
+// newJiraInstances creates the clients of the further Jira instances next to
+// the main client
+func newJiraInstances() {
+	conf := cfg()
+	jiraClients = map[string]*jira.Client{"": jiraClient}
+	for _, inst := range conf.Jira.Instances {
+		conn := inst.Connection(conf.Jira)
+		jiraClients[inst.Name] = jira.New(jira.Config{
+			BaseURL:    conn.BaseURL,
+			Deployment: conn.DeploymentType(),
+			Username:   conn.Username,
+			APIToken:   conn.APIToken,
+			HTTPClient: jiraHTTP,
+		})
+		log.Printf("Using Jira instance %s, the %s API at %s (project %s)", inst.Name, conn.DeploymentType(), conn.BaseURL, conn.ProjectKey)
+	}
+}
+
+// quietJira makes all Jira clients avoid notifying users
+func quietJira() {
+	for name, c := range jiraClients {
+		jiraClients[name] = c.Quiet()
+	}
+	jiraClient = jiraClients[""]
+}
+
+// jiraInstanceNames lists the Jira instances, the main one ("") first
+func jiraInstanceNames() []string {
+	names := []string{""}
+	for _, inst := range cfg().Jira.Instances {
+		names = append(names, inst.Name)
+	}
+	return names
+}
+
+// jiraFor returns the client of the named Jira instance
+func jiraFor(instance string) (*jira.Client, error) {
+	c, ok := jiraClients[instance]
+	if !ok {
+		return nil, fmt.Errorf("unknown Jira instance %q", instance)
+	}
+	return c, nil
+}
+
+// jiraBrowseURL returns the web URL of a Jira issue of an instance or of an
+// issue of a sink, or "" if the instance is no longer configured
+func jiraBrowseURL(instance, key string) string {
+	c, err := trackerFor(instance)
+	if err != nil {
+		return ""
+	}
+	return c.BrowseURL(key)
+}
+
+// jiraTargets returns the Jira projects issues are created in
+func jiraTargets() []config.JiraTarget {
+	conf := cfg()
+	var targets []config.JiraTarget
+	seen := map[config.JiraTarget]bool{}
+	add := func(instance, project string) {
+		if project == "" {
+			inst, _ := conf.Jira.Instance(instance)
+			project = inst.ProjectKey
+		}
+		t := config.JiraTarget{Instance: instance, ProjectKey: project}
+		if !seen[t] {
+			seen[t] = true
+			targets = append(targets, t)
+		}
+	}
+	add("", conf.Jira.ProjectKey)
+	for _, inst := range conf.Jira.Instances {
+		add(inst.Name, "")
+	}
+	for _, r := range conf.Jira.Routes {
+		add(r.Instance, r.ProjectKey)
+	}
+	return targets
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/savitaashture/gh-jira/pkg/leader"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+// issueLeasePrefix prefixes the names of the state store leases of issues
+// being synced
+const issueLeasePrefix = "sync:"
+
+var (
+	// errIssueBusy is returned when another worker or replica is syncing
+	// the issue
+	errIssueBusy = errors.New("the issue is being synced by another worker or replica")
+	// errIssueSynced is returned when the issue was synced since it was
+	// looked up
+	errIssueSynced = errors.New("the issue was synced meanwhile")
+)
+
+// issueLocks are the keys of the issues this process is creating the Jira
+// issues of
+var issueLocks = struct {
+	sync.Mutex
+	held map[string]bool
+}{held: map[string]bool{}}
+
+// lockHolder identifies this process in the leases of issues
+var lockHolder = sync.OnceValue(func() string {
+	if cfg().Leader.Identity != "" {
+		return cfg().Leader.Identity
+	}
+	return leader.DefaultIdentity()
+})
+
+// claimIssue locks the creation of the Jira issue of the issue of key, so
+// that the pipeline workers, webhooks, commands and retries of this and
+// other replicas don't create it twice, and looks its mapping up again. A
+// state store shared by replicas also holds a lease of the issue, renewed
+// while the lock is held; the returned context is cancelled if the lease is
+// lost. It returns errIssueBusy if the issue is locked elsewhere and
+// errIssueSynced if it was synced since the caller looked it up. Otherwise
+// the caller must call unlock when done.
+func claimIssue(ctx context.Context, key string) (context.Context, func(), error) {
+	issueLocks.Lock()
+	if issueLocks.held[key] {
+		issueLocks.Unlock()
+		return nil, nil, errIssueBusy
+	}
+	issueLocks.held[key] = true
+	issueLocks.Unlock()
+	release := func() {
+		issueLocks.Lock()
+		delete(issueLocks.held, key)
+		issueLocks.Unlock()
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	unlock := func() {
+		cancel(nil)
+		release()
+	}
+	if locker, ok := store.(state.Locker); ok {
+		stop, err := holdLease(ctx, cancel, locker, issueLeasePrefix+key)
+		if err != nil {
+			unlock()
+			return nil, nil, err
+		}
+		unlock = func() {
+			stop()
+			cancel(nil)
+			release()
+		}
+	}
+
+	if m, err := lookupMapping(ctx, key); err == nil {
+		log.Printf("Issue %s was synced to %s meanwhile", key, m.JiraKey)
+		unlock()
+		return nil, nil, errIssueSynced
+	} else if !errors.Is(err, state.ErrNotFound) {
+		unlock()
+		return nil, nil, err
+	}
+	return ctx, sync.OnceFunc(unlock), nil
+}
+
+// holdLease acquires the named lease and renews it until stop is called,
+// cancelling the lock context with cancel if it can't be renewed in time.
+// stop releases the lease.
+func holdLease(ctx context.Context, cancel context.CancelCauseFunc, locker state.Locker, name string) (stop func(), err error) {
+	ttl, holder := cfg().State.LockTTL, lockHolder()
+	ok, err := locker.AcquireLease(ctx, name, holder, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errIssueBusy
+	}
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		renewed := time.Now()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			ok, err := locker.AcquireLease(context.Background(), name, holder, ttl)
+			switch {
+			case err == nil && ok:
+				renewed = time.Now()
+				continue
+			case err == nil:
+				err = fmt.Errorf("lease %s was taken over by another replica", name)
+			case time.Since(renewed) < ttl-ttl/3:
+				// The lease survives until the next renewal attempt
+				log.Printf("Failed to renew lease %s: %v", name, err)
+				continue
+			}
+			log.Printf("Lost lease %s, abandoning the sync: %v", name, err)
+			cancel(err)
+			return
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-finished
+		ctx, cancelRelease := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancelRelease()
+		if err := locker.ReleaseLease(ctx, name, holder); err != nil {
+			log.Printf("Failed to release lease %s: %v", name, err)
+		}
+	}, nil
+}
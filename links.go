@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/jira"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+// issueRefPattern matches references to GitHub issues such as #12,
+// owner/name#12 and https://github.com/owner/name/issues/12
+var issueRefPattern = regexp.MustCompile(`(?:^|[^\w/&#])(?:([\w.-]+/[\w.-]+))?#(\d+)\b|https://github\.com/([\w.-]+/[\w.-]+)/issues/(\d+)\b`)
+
+// parseIssueRefs returns the issues referenced by an issue body of repo as
+// sorted owner/name#number strings, ignoring code blocks and inline code
+func parseIssueRefs(repo, body string) []string {
+	seen := make(map[string]bool)
+	inCode := false
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+		for _, m := range issueRefPattern.FindAllStringSubmatch(stripInlineCode(line), -1) {
+			name, number := m[1], m[2]
+			if m[4] != "" {
+				name, number = m[3], m[4]
+			}
+			if name == "" {
+				name = repo
+			}
+			seen[strings.ToLower(name)+"#"+number] = true
+		}
+	}
+	refs := make([]string, 0, len(seen))
+	for ref := range seen {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+// stripInlineCode removes `code` spans from a line
+func stripInlineCode(line string) string {
+	parts := strings.Split(line, "`")
+	for i := 1; i < len(parts); i += 2 {
+		parts[i] = ""
+	}
+	return strings.Join(parts, " ")
+}
+
+// linksCursor names the state cursor holding the Jira issues linked to the
+// Jira issue of a synced issue, as JSON mapping each reference to its key
+func linksCursor(key string) string {
+	return "links:" + key
+}
+
+// mappingIndex caches the mappings by owner/name#number for a poll cycle
+var mappingIndex struct {
+	mu    sync.Mutex
+	byRef map[string]*state.Mapping
+}
+
+// resetMappingIndex drops the cached mappings so the next lookup sees the
+// mappings created since
+func resetMappingIndex() {
+	mappingIndex.mu.Lock()
+	mappingIndex.byRef = nil
+	mappingIndex.mu.Unlock()
+}
+
+// mappingByRef returns the mapping of an owner/name#number reference, or nil
+func mappingByRef(ctx context.Context, ref string) (*state.Mapping, error) {
+	mappingIndex.mu.Lock()
+	defer mappingIndex.mu.Unlock()
+	if mappingIndex.byRef == nil {
+		all, err := store.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		mappingIndex.byRef = make(map[string]*state.Mapping, len(all))
+		for _, m := range all {
+			// Discussions share the numbers of issues
+			if isDiscussion(m) {
+				continue
+			}
+			mappingIndex.byRef[strings.ToLower(m.Repo)+"#"+strconv.Itoa(m.IssueNumber)] = m
+		}
+	}
+	m := mappingIndex.byRef[ref]
+	if m == nil || m.MergedInto == "" {
+		return m, nil
+	}
+	m, err := state.Resolve(ctx, store, m.MergedInto)
+	if err == state.ErrNotFound {
+		return nil, nil
+	}
+	return m, err
+}
+
+// syncLinks links the Jira issue of a mapping to the Jira issues of the
+// GitHub issues its body references, and removes the links of references
+// that were edited out. References to issues without a Jira issue on the
+// same instance are retried on later syncs.
+func syncLinks(ctx context.Context, repo config.RepoConfig, issue *github.Issue, m *state.Mapping) error {
+	conf := cfg()
+	if !conf.Jira.Links.Enabled || m.JiraKey == "" {
+		return nil
+	}
+	self := strings.ToLower(repo.FullName()) + "#" + strconv.Itoa(issue.GetNumber())
+	var refs []string
+	for _, ref := range parseIssueRefs(repo.FullName(), issue.GetBody()) {
+		if ref != self {
+			refs = append(refs, ref)
+		}
+	}
+	stored, err := store.GetCursor(ctx, linksCursor(m.Key))
+	if err != nil {
+		return err
+	}
+	linked := make(map[string]string)
+	if stored != "" {
+		if err := json.Unmarshal([]byte(stored), &linked); err != nil {
+			return fmt.Errorf("invalid links of %s: %w", m.Key, err)
+		}
+	}
+
+	wanted := make(map[string]bool, len(refs))
+	var add []string
+	for _, ref := range refs {
+		wanted[ref] = true
+		if _, ok := linked[ref]; !ok {
+			add = append(add, ref)
+		}
+	}
+	var remove []string
+	for ref := range linked {
+		if !wanted[ref] {
+			remove = append(remove, ref)
+		}
+	}
+	if len(add) == 0 && len(remove) == 0 {
+		return nil
+	}
+	sort.Strings(remove)
+	jc, err := jiraFor(m.JiraInstance)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	defer func() {
+		if !changed {
+			return
+		}
+		data, _ := json.Marshal(linked)
+		if err := store.SetCursor(ctx, linksCursor(m.Key), string(data)); err != nil {
+			log.Printf("Failed to record links of %s: %v", m.JiraKey, err)
+		}
+	}()
+
+	for _, ref := range add {
+		other, err := mappingByRef(ctx, ref)
+		if err != nil {
+			return err
+		}
+		if other == nil || other.JiraKey == "" || other.JiraKey == m.JiraKey || other.JiraInstance != m.JiraInstance {
+			continue
+		}
+		if err := jc.LinkIssues(ctx, conf.Jira.Links.Type, other.JiraKey, m.JiraKey); err != nil {
+			return fmt.Errorf("failed to link %s to %s: %w", m.JiraKey, other.JiraKey, err)
+		}
+		log.Printf("Linked %s to %s for the reference of GitHub issue #%d to %s", m.JiraKey, other.JiraKey, issue.GetNumber(), ref)
+		e := jiraAudit("create_link", m.JiraKey, map[string]interface{}{"type": conf.Jira.Links.Type, "linked": other.JiraKey, "reference": ref})
+		e.Repo, e.Issue = repo.FullName(), issue.GetNumber()
+		recordAudit(e)
+		linked[ref] = other.JiraKey
+		changed = true
+	}
+
+	if len(remove) == 0 {
+		return nil
+	}
+	ji, err := jc.GetIssue(ctx, m.JiraKey, []string{"issuelinks"})
+	if err != nil {
+		return fmt.Errorf("failed to read the links of %s: %w", m.JiraKey, err)
+	}
+	for _, ref := range remove {
+		if err := unlinkIssue(ctx, jc, repo, issue, m, ji.Fields.IssueLinks, linked[ref]); err != nil {
+			return err
+		}
+		delete(linked, ref)
+		changed = true
+	}
+	return nil
+}
+
+// unlinkIssue removes the links of the configured type between the Jira
+// issue of a mapping and another Jira issue
+func unlinkIssue(ctx context.Context, jc *jira.Client, repo config.RepoConfig, issue *github.Issue, m *state.Mapping, links []*jira.IssueLink, otherKey string) error {
+	for _, l := range links {
+		if !strings.EqualFold(l.Type.Name, cfg().Jira.Links.Type) || l.Other(m.JiraKey) != otherKey {
+			continue
+		}
+		if err := jc.DeleteIssueLink(ctx, l.ID); err != nil {
+			return fmt.Errorf("failed to unlink %s from %s: %w", m.JiraKey, otherKey, err)
+		}
+		log.Printf("Unlinked %s from %s, GitHub issue #%d no longer references it", m.JiraKey, otherKey, issue.GetNumber())
+		e := jiraAudit("delete_link", m.JiraKey, map[string]interface{}{"type": l.Type.Name, "linked": otherKey})
+		e.Repo, e.Issue = repo.FullName(), issue.GetNumber()
+		recordAudit(e)
+	}
+	return nil
+}
@@ -2,100 +2,720 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
+	"runtime/debug"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/google/go-github/github"
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/audit"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/githubapp"
+	"github.com/savitaashture/gh-jira/pkg/httpclient"
+	"github.com/savitaashture/gh-jira/pkg/idmap"
+	"github.com/savitaashture/gh-jira/pkg/jira"
+	"github.com/savitaashture/gh-jira/pkg/notify"
+	"github.com/savitaashture/gh-jira/pkg/redact"
+	"github.com/savitaashture/gh-jira/pkg/sanitize"
+	"github.com/savitaashture/gh-jira/pkg/state"
 	"github.com/savitaashture/gh-jira/pkg/summarizer"
+	issuesync "github.com/savitaashture/gh-jira/pkg/sync"
+	"github.com/savitaashture/gh-jira/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/oauth2"
 )
 
 var (
-	githubOwner       = os.Getenv("GH_OWNER")
-	githubRepo        = os.Getenv("GH_REPO")
-	githubToken       = os.Getenv("GH_TOKEN")
-	jiraUsername      = os.Getenv("JIRA_USERNAME")
-	jiraAPIToken      = os.Getenv("JIRA_API_TOKEN")
-	jiraBaseURL       = os.Getenv("JIRA_BASE_URL")
-	jiraProjectKey    = "GT"
-	jiraIssueType     = "Task"
-	processedIssueIDs = make(map[int64]bool)
+	// redactor masks secrets in issue text sent to the model and Jira; nil
+	// when redaction is disabled
+	redactor *redact.Redactor
+	// sanitizer removes the template noise from issue bodies sent to the
+	// model and Jira; nil when sanitization is disabled
+	sanitizer   *sanitize.Sanitizer
+	ghRateLimit *rateLimiter
+	jiraClient  *jira.Client
+	store       state.Store
+	// ghTokens authenticates GitHub requests; it is shared by all clients so
+	// GitHub App installation tokens are reused until they expire
+	ghTokens oauth2.TokenSource
+	// ghHTTP carries the TLS settings of the GitHub server
+	ghHTTP *http.Client
+	// jiraHTTP carries the timeout of Jira requests
+	jiraHTTP *http.Client
 )
 
 func init() {
 	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds | log.Lshortfile)
-	log.Printf("Starting application with configuration:")
-	log.Printf("GitHub Owner: %s", githubOwner)
-	log.Printf("GitHub Repo: %s", githubRepo)
-	log.Printf("Jira Base URL: %s", jiraBaseURL)
-	log.Printf("Jira Project Key: %s", jiraProjectKey)
-	log.Printf("Jira Issue Type: %s", jiraIssueType)
 }
 
 func main() {
-	log.Printf("Initializing Ollama summarizer with mistral model")
-	var err error
+	if code, ok := dispatch(os.Args[1:]); ok {
+		os.Exit(code)
+	}
+
+	configPath := flag.String("config", os.Getenv("GH_JIRA_CONFIG"), "Path to an optional YAML configuration file")
+	once := flag.Bool("once", false, "Run a single poll cycle, print a JSON result summary to stdout and exit")
+	interval := flag.Duration("interval", 0, "Base time between poll cycles (overrides config and POLL_INTERVAL)")
+	jitter := flag.Float64("jitter", -1, "Maximum fraction of the interval added as random jitter (overrides config and POLL_JITTER)")
+	backfill := flag.Bool("backfill", false, "Treat this run as a backfill: suppress Jira notifications and automatic watchers")
+	flag.Parse()
+
+	sum, err := setup(*configPath, *interval, *jitter)
+	if err == nil {
+		err = preflight(context.Background(), sum)
+	}
+	if err == nil && cfg().Jira.Transitions.Enabled() {
+		err = validateTransitions(context.Background())
+	}
+	if err == nil && *backfill {
+		log.Printf("Backfill mode: suppressing Jira notifications and automatic watchers")
+		quietJira()
+	}
+	if err != nil {
+		if *once {
+			exitWithResult(newCycleResult(), err)
+		}
+		log.Fatalf("Startup failed: %v", err)
+	}
+	defer store.Close()
+
+	flushTraces, err := initTracing()
+	if err != nil {
+		if *once {
+			exitWithResult(newCycleResult(), err)
+		}
+		log.Fatalf("Startup failed: %v", err)
+	}
+
+	if err := startElection(context.Background()); err != nil {
+		if *once {
+			exitWithResult(newCycleResult(), err)
+		}
+		log.Fatalf("Startup failed: %v", err)
+	}
+
+	if *once {
+		result := newCycleResult()
+		if ctx, cancel, ok := leading(context.Background()); ok {
+			log.Printf("Running a single poll cycle")
+			result = pollGitHub(ctx, sum)
+			cancel()
+		} else {
+			log.Printf("Another replica is the leader, skipping the poll cycle")
+		}
+		stopElection()
+		result.finish()
+		logCycleResult(result)
+		if err := result.writeJSON(os.Stdout); err != nil {
+			log.Printf("Failed to write result summary: %v", err)
+		}
+		flushTraces()
+		os.Exit(result.ExitCode)
+	}
+
+	if cfg().Server.Addr != "" {
+		go serveDashboard(cfg().Server.Addr, sum)
+	}
+	notifyOnStop(flushTraces)
+	reloader = newConfigReloader(*configPath, *interval, *jitter)
+	reloader.watch()
+	sendNotification(context.Background(), notify.Event{Kind: notify.EventStarted})
+	runDaemon(sum)
+}
+
+// runDaemon runs the poll loop forever, supervised by the watchdog if enabled
+func runDaemon(sum *summarizer.Summarizer) {
+	if cfg().Poll.WatchdogMultiplier <= 0 {
+		runPollLoop(context.Background(), sum, nil)
+		return
+	}
+
+	timeout := cfg().Poll.Interval * time.Duration(cfg().Poll.WatchdogMultiplier)
+	log.Printf("Starting watchdog with a %s timeout (restart: %v)", timeout, cfg().Poll.WatchdogRestart)
+	wd := newWatchdog(timeout)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := startPollLoop(ctx, sum, wd.newLoop())
+
+	wd.run(context.Background(), func(stalledFor time.Duration) {
+		if !cfg().Poll.WatchdogRestart {
+			return
+		}
+		log.Printf("Watchdog: cancelling the stalled poll loop and starting a new one")
+		cancel()
+		go awaitLoopExit(done)
+		ctx, cancel = context.WithCancel(context.Background())
+		done = startPollLoop(ctx, sum, wd.newLoop())
+	})
+}
+
+// loopExitGrace is how long a cancelled poll loop may take to return before
+// it is reported as still running
+const loopExitGrace = time.Minute
+
+// startPollLoop runs the poll loop in the background and returns a channel
+// closed when it returns
+func startPollLoop(ctx context.Context, sum *summarizer.Summarizer, wd *watchedLoop) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runPollLoop(ctx, sum, wd)
+	}()
+	return done
+}
+
+// awaitLoopExit logs if the cancelled poll loop of done hasn't returned
+// after loopExitGrace, and when it finally does
+func awaitLoopExit(done <-chan struct{}) {
+	start := time.Now()
+	select {
+	case <-done:
+		return
+	case <-time.After(loopExitGrace):
+	}
+	log.Printf("Watchdog: the cancelled poll loop is still running after %s; it may hold a hanging request", loopExitGrace)
+	<-done
+	log.Printf("Watchdog: the cancelled poll loop returned after %s", time.Since(start).Round(time.Second))
+}
+
+// runPollLoop polls GitHub until ctx is cancelled, reporting progress to wd
+func runPollLoop(ctx context.Context, sum *summarizer.Summarizer, wd *watchedLoop) {
+	log.Printf("Starting initial GitHub poll")
+	for {
+		if wd != nil {
+			wd.expect(0)
+		}
+		if cycleCtx, cancel, ok := leading(ctx); ok {
+			result := pollGitHub(cycleCtx, sum).finish()
+			cancel()
+			recentCycles.add(result)
+			pace.observe(result)
+			logCycleResult(result)
+			recordHealth(ctx)
+		} else {
+			log.Printf("Another replica is the leader, skipping the poll cycle")
+		}
+
+		if !waitForNextPoll(ctx, wd) {
+			log.Printf("Poll loop stopped: %v", ctx.Err())
+			return
+		}
+		log.Printf("Polling GitHub for new issues")
+	}
+}
+
+// recordHealth appends the sync health after a poll cycle to the health
+// snapshots if reporting is enabled
+func recordHealth(ctx context.Context) {
+	if !cfg().State.Reporting {
+		return
+	}
+	if err := store.(state.Reporter).RecordHealth(ctx); err != nil {
+		log.Printf("Failed to record a health snapshot: %v", err)
+	}
+}
+
+// waitForNextPoll waits until the next poll cycle is due, reloading the
+// configuration when requested, and returns false if ctx is cancelled
+// first. A reload reschedules the next poll if the poll interval changed,
+// but doesn't poll early.
+func waitForNextPoll(ctx context.Context, wd *watchedLoop) bool {
+	waitStart := time.Now()
+	delay := ghRateLimit.adjustDelay(pace.nextDelay())
+	for {
+		if wd != nil {
+			wd.expect(time.Until(waitStart.Add(delay)))
+		}
+		log.Printf("Next poll in %s", time.Until(waitStart.Add(delay)).Round(time.Second))
+		timer := time.NewTimer(time.Until(waitStart.Add(delay)))
+		select {
+		case <-timer.C:
+			return true
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		case reason := <-reloader.pending():
+			timer.Stop()
+			prev := cfg().Poll
+			if err := reloader.reload(reason); err != nil {
+				log.Printf("Failed to reload the configuration, keeping the current one: %v", err)
+				continue
+			}
+			if poll := cfg().Poll; poll.Interval != prev.Interval || poll.Jitter != prev.Jitter || poll.Adaptive != prev.Adaptive {
+				delay = ghRateLimit.adjustDelay(pace.nextDelay())
+			}
+		}
+	}
+}
+
+// setup loads the configuration and initializes the shared clients and state
+func setup(configPath string, interval time.Duration, jitter float64) (*summarizer.Summarizer, error) {
+	c, err := config.Load(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if interval > 0 {
+		c.Poll.Interval = interval
+	}
+	if jitter >= 0 {
+		c.Poll.Jitter = jitter
+	}
+	// The settings are completed below, before anything reads them
+	// concurrently
+	active.Store(&settings{cfg: c})
+	// The Ollama, Slack and Vault clients use http.DefaultClient, so it
+	// carries the proxy and TLS settings too
+	if http.DefaultClient, err = httpclient.New(httpOptions()); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	httpclient.SetDebug(cfg().HTTP.Debug)
+	if cfg().HTTP.Proxy != "" {
+		log.Printf("Using proxy %s for outbound requests (no proxy for %q)", cfg().HTTP.Proxy, cfg().HTTP.NoProxy)
+	}
+	secretsCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := cfg().ResolveSecrets(secretsCtx); err != nil {
+		return nil, err
+	}
+	if err := cfg().Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	log.Printf("Starting gh-jira %s with configuration:", buildVersion())
+	for _, repo := range cfg().GitHub.WatchedRepos() {
+		strategy := cfg().GitHub.IDStrategy(repo.NamespaceName())
+		log.Printf("GitHub Repo: %s (namespace %s, ID strategy %s)", repo.FullName(), repo.NamespaceName(), strategy)
+		if _, err := idmap.Lookup(strategy); err != nil {
+			return nil, fmt.Errorf("invalid configuration: %w", err)
+		}
+	}
+	if org := cfg().GitHub.Org; org.Name != "" {
+		log.Printf("GitHub Org: %s (topics %v, name pattern %q)", org.Name, org.Topics, org.NamePattern)
+	}
+	log.Printf("Jira Base URL: %s", cfg().Jira.BaseURL)
+	log.Printf("Jira Project Key: %s", cfg().Jira.ProjectKey)
+	log.Printf("Jira Issue Type: %s", cfg().Jira.IssueType)
+	for _, r := range cfg().Jira.Routes {
+		log.Printf("Jira Route: label %s -> project %s", r.Label, r.ProjectKey)
+	}
+	log.Printf("Poll Interval: %s (jitter %.0f%%)", cfg().Poll.Interval, cfg().Poll.Jitter*100)
+	if cfg().Poll.AdaptiveEnabled() {
+		a := cfg().Poll.Adaptive
+		log.Printf("Adaptive polling: up to every %s after %d cycles without new issues (factor %g)", a.MaxInterval, a.QuietCycles, a.Factor)
+	}
+	log.Printf("Timeouts: GitHub %s, Jira %s, summary generation %s", cfg().GitHub.Timeout, cfg().Jira.Timeout, cfg().Summarizer.Timeout)
+
+	ghRateLimit = newRateLimiter(cfg().GitHub.RateLimitThreshold)
+	if cfg().GitHub.BaseURL != "" {
+		log.Printf("GitHub Enterprise Server: %s (uploads %s)", cfg().GitHub.BaseURL, cfg().GitHub.EnterpriseUploadURL())
+		if _, err := github.NewClient(nil).WithEnterpriseURLs(cfg().GitHub.BaseURL, cfg().GitHub.EnterpriseUploadURL()); err != nil {
+			return nil, fmt.Errorf("invalid configuration: %w", err)
+		}
+	}
+	ghOptions := httpOptions()
+	ghOptions.Timeout = cfg().GitHub.Timeout
+	if cfg().GitHub.CAFile != "" {
+		ghOptions.CAFiles = append(ghOptions.CAFiles, cfg().GitHub.CAFile)
+	}
+	if ghHTTP, err = httpclient.New(ghOptions); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if ghTokens, err = newGitHubTokenSource(); err != nil {
+		return nil, err
+	}
+
+	s, err := loadSettings(c)
+	if err != nil {
+		return nil, err
+	}
+	active.Store(s)
+	if err := loadHooks(); err != nil {
+		return nil, err
+	}
+	if err := loadSources(); err != nil {
+		return nil, err
+	}
+	if err := loadSinks(); err != nil {
+		return nil, err
+	}
+	if cfg().Redaction.Enabled {
+		if redactor, err = redact.New(cfg().Redaction.Builtins, cfg().Redaction.Patterns, cfg().Redaction.Replacement); err != nil {
+			return nil, err
+		}
+		log.Printf("Redacting %s and %d custom patterns from issues", strings.Join(cfg().Redaction.Builtins, ", "), len(cfg().Redaction.Patterns))
+	}
+	if sc := cfg().Sanitization; sc.Enabled {
+		if sanitizer, err = sanitize.New(sc.Boilerplate, sc.KeepEmptySections); err != nil {
+			return nil, err
+		}
+		log.Printf("Removing HTML comments, placeholders and %d boilerplate patterns from issue bodies", len(sc.Boilerplate))
+	}
+
+	log.Printf("Initializing Ollama summarizer with %s model", cfg().Summarizer.Model)
 	sum, err := summarizer.New(summarizer.Config{
-		Model: "mistral", // Using mistral model
+		Model:            cfg().Summarizer.Model,
+		Fallbacks:        cfg().Summarizer.Fallbacks,
+		EmbeddingModel:   cfg().Summarizer.Duplicates.EmbeddingModel,
+		AutoPull:         cfg().Summarizer.AutoPull,
+		MaxLength:        cfg().Summarizer.MaxLength,
+		MaxTokens:        cfg().Summarizer.MaxTokens,
+		Language:         cfg().Summarizer.Language,
+		Timeout:          cfg().Summarizer.Timeout,
+		Concurrency:      cfg().Summarizer.Concurrency,
+		ModelConcurrency: cfg().Summarizer.ModelConcurrency,
 	})
 	if err != nil {
-		log.Fatalf("Failed to initialize summarizer: %v", err)
+		return nil, fmt.Errorf("failed to initialize summarizer: %w", err)
 	}
 	log.Printf("Summarizer initialized successfully")
 
-	ticker := time.NewTicker(1 * time.Minute)
-	defer ticker.Stop()
+	store, err = state.Open(cfg().State.Backend, cfg().State.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state store: %w", err)
+	}
+	if cfg().State.Reporting {
+		if err := store.(state.Reporter).CreateReports(context.Background()); err != nil {
+			return nil, err
+		}
+		log.Printf("Reporting views enabled in the reporting schema")
+	}
+	if cfg().Audit.File != "" {
+		if auditLog, err = audit.Open(cfg().Audit.File, auditActor()); err != nil {
+			return nil, err
+		}
+		log.Printf("Recording changes in audit log %s", cfg().Audit.File)
+	}
+	if cfg().Notifications.Enabled() {
+		if notifier, err = newNotifier(); err != nil {
+			return nil, fmt.Errorf("invalid configuration: %w", err)
+		}
+	}
+
+	jiraOptions := httpOptions()
+	jiraOptions.Timeout = cfg().Jira.Timeout
+	if jiraHTTP, err = httpclient.New(jiraOptions); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	jiraCfg := jira.Config{
+		BaseURL:    cfg().Jira.BaseURL,
+		APIURL:     cfg().Jira.OAuth.APIURL(),
+		Deployment: cfg().Jira.DeploymentType(),
+		Username:   cfg().Jira.Username,
+		APIToken:   cfg().Jira.APIToken,
+		HTTPClient: jiraHTTP,
+	}
+	if cfg().Jira.OAuth.Enabled() {
+		if jiraCfg.TokenSource, err = newJiraTokenSource(context.Background(), jiraHTTP); err != nil {
+			return nil, err
+		}
+	}
+	jiraClient = jira.New(jiraCfg)
+	log.Printf("Using the Jira %s API at %s", jiraClient.Deployment(), cfg().Jira.BaseURL)
+	newJiraInstances()
+	return sum, nil
+}
 
-	log.Printf("Starting initial GitHub poll")
-	pollGitHub(sum)
+// jiraOAuthCursor is the state cursor holding the latest Jira refresh token
+const jiraOAuthCursor = "jira:oauth"
 
-	log.Printf("Entering main polling loop")
-	for range ticker.C {
-		log.Printf("Polling GitHub for new issues")
-		pollGitHub(sum)
+// jiraOAuthState is the value of jiraOAuthCursor. Origin identifies the
+// configured refresh token the stored one was rotated from, so that a newly
+// configured token takes precedence over an older stored one.
+type jiraOAuthState struct {
+	Origin       string `json:"origin"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// newJiraTokenSource returns the OAuth token source of the Jira client.
+// Rotated refresh tokens are kept in the state store so that they survive
+// restarts.
+func newJiraTokenSource(ctx context.Context, httpClient *http.Client) (oauth2.TokenSource, error) {
+	o := cfg().Jira.OAuth
+	oauthCfg := jira.OAuthConfig{
+		ClientID:     o.ClientID,
+		ClientSecret: o.ClientSecret,
+		TokenURL:     o.TokenURL,
+		RefreshToken: o.RefreshToken,
+		Scopes:       o.Scopes,
+		HTTPClient:   httpClient,
+	}
+	if o.RefreshToken == "" {
+		log.Printf("Authenticating with Jira using OAuth client credentials")
+		return jira.NewOAuthTokenSource(oauthCfg), nil
+	}
+
+	log.Printf("Authenticating with Jira using an OAuth refresh token")
+	origin := sha256.Sum256([]byte(o.RefreshToken))
+	st := jiraOAuthState{Origin: hex.EncodeToString(origin[:])}
+	v, err := store.GetCursor(ctx, jiraOAuthCursor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Jira OAuth state: %w", err)
+	}
+	var stored jiraOAuthState
+	if v != "" && json.Unmarshal([]byte(v), &stored) == nil && stored.Origin == st.Origin {
+		log.Printf("Using the rotated Jira refresh token from the state store")
+		oauthCfg.RefreshToken = stored.RefreshToken
+	}
+
+	oauthCfg.OnRefreshTokenChange = func(refreshToken string) {
+		st.RefreshToken = refreshToken
+		data, err := json.Marshal(st)
+		if err == nil {
+			err = store.SetCursor(context.Background(), jiraOAuthCursor, string(data))
+		}
+		if err != nil {
+			log.Printf("Failed to store the rotated Jira refresh token: %v", err)
+			return
+		}
+		log.Printf("Stored the rotated Jira refresh token")
+	}
+	return jira.NewOAuthTokenSource(oauthCfg), nil
+}
+
+// exitWithResult prints a fatal result summary and exits
+func exitWithResult(result *cycleResult, err error) {
+	log.Printf("Fatal error: %v", err)
+	result.fatal(err)
+	result.finish()
+	if werr := result.writeJSON(os.Stdout); werr != nil {
+		log.Printf("Failed to write result summary: %v", werr)
+	}
+	os.Exit(result.ExitCode)
+}
+
+// version is the release of gh-jira, set when building a release with
+// -ldflags "-X main.version=v1.2.3"
+var version string
+
+// buildVersion returns the release of gh-jira, the module version for
+// binaries built with go install, or "dev"
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
+
+// userAgent returns the User-Agent of outbound requests
+func userAgent() string {
+	conf := cfg()
+	if conf.HTTP.UserAgent != "" {
+		return conf.HTTP.UserAgent
+	}
+	return "gh-jira/" + buildVersion() + " (+https://github.com/savitaashture/gh-jira)"
+}
+
+// httpOptions returns the configured proxy, TLS and User-Agent settings of
+// outbound HTTP clients
+func httpOptions() httpclient.Options {
+	conf := cfg()
+	opts := httpclient.Options{
+		Proxy:              conf.HTTP.Proxy,
+		NoProxy:            conf.HTTP.NoProxy,
+		InsecureSkipVerify: conf.HTTP.InsecureSkipVerify,
+		UserAgent:          userAgent(),
+	}
+	if conf.HTTP.CAFile != "" {
+		opts.CAFiles = []string{conf.HTTP.CAFile}
 	}
+	return opts
 }
 
-func pollGitHub(sum *summarizer.Summarizer) {
+// newGitHubClient creates a GitHub API client authenticated with the
+// configured token or GitHub App
+func newGitHubClient(ctx context.Context) *github.Client {
+	conf := cfg()
 	log.Printf("Creating GitHub client")
-	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: githubToken},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-	client := github.NewClient(tc)
-
-	log.Printf("Fetching open issues from GitHub")
-	issues, _, err := client.Issues.ListByRepo(ctx, githubOwner, githubRepo, &github.IssueListByRepoOptions{
-		State: "open",
-		Sort:  "created",
+	httpClient := oauth2.NewClient(context.WithValue(ctx, oauth2.HTTPClient, ghHTTP), ghTokens)
+	if conf.GitHub.BaseURL == "" {
+		return github.NewClient(httpClient)
+	}
+	// The URLs were validated by setup
+	client, _ := github.NewClient(httpClient).WithEnterpriseURLs(conf.GitHub.BaseURL, conf.GitHub.EnterpriseUploadURL())
+	return client
+}
+
+// newGitHubTokenSource returns the token source of the configured GitHub
+// authentication
+func newGitHubTokenSource() (oauth2.TokenSource, error) {
+	conf := cfg()
+	app := conf.GitHub.App
+	if !app.Enabled() {
+		return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: conf.GitHub.Token}), nil
+	}
+	log.Printf("Authenticating as GitHub App %d, installation %d", app.AppID, app.InstallationID)
+	ts, err := githubapp.NewTokenSource(githubapp.Config{
+		AppID:          app.AppID,
+		InstallationID: app.InstallationID,
+		PrivateKey:     []byte(app.PrivateKey),
+		BaseURL:        conf.GitHub.BaseURL,
+		HTTPClient:     ghHTTP,
 	})
 	if err != nil {
-		log.Printf("Error fetching GitHub issues: %v", err)
-		return
+		return nil, fmt.Errorf("invalid configuration: %w", err)
 	}
-	log.Printf("Found %d issues", len(issues))
+	return ts, nil
+}
 
-	for _, issue := range issues {
-		if issue.IsPullRequest() {
-			log.Printf("Skipping PR #%d", *issue.Number)
-			break
+func pollGitHub(ctx context.Context, sum *summarizer.Summarizer) *cycleResult {
+	conf := cfg()
+	result := newCycleResult()
+	defer ghRateLimit.endCycle()
+	ctx, span := startSpan(ctx, "poll_cycle")
+	defer func() {
+		span.SetAttributes(
+			attribute.Int("gh_jira.issues_seen", result.IssuesSeen),
+			attribute.Int("gh_jira.created", result.Created),
+			attribute.Int("gh_jira.failed", result.Failed),
+		)
+		if result.Error != "" {
+			tracing.Fail(span, errors.New(result.Error))
 		}
+		span.End()
+	}()
 
-		log.Printf("Processing issue #%d: %s", *issue.Number, *issue.Title)
+	client := newGitHubClient(ctx)
+	resetMappingIndex()
 
-		// Create a context with a longer timeout for model generation
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-		log.Printf("Starting summary generation for issue #%d", *issue.Number)
+	repos, err := repositories(ctx, client)
+	if err != nil {
+		log.Printf("Error listing repositories: %v", err)
+		if isAuthError(err) {
+			result.fatal(fmt.Errorf("GitHub authentication failed: %w", err))
+		} else {
+			result.fail("", 0, "discover", err)
+		}
+		return result
+	}
 
-		// Generate the summary
-		summary, err := sum.SummarizeWithCustomPrompt(ctx, *issue.Body, fmt.Sprintf(`Please analyze this GitHub issue description and create a clear, concise summary with necessary code snippet:
+	if err := runPipeline(ctx, client, repos, sum, result); err != nil {
+		result.fatal(err)
+		return result
+	}
+	if conf.GitHub.Discussions.Enabled {
+		for _, repo := range repos {
+			if err := syncGitHubDiscussions(ctx, client, repo, sum, result); err != nil {
+				result.fatal(err)
+				return result
+			}
+		}
+	}
+	if conf.Jira.Releases.Enabled {
+		for _, repo := range repos {
+			if err := syncReleases(ctx, client, repo, sum, result); err != nil {
+				result.fatal(err)
+				return result
+			}
+		}
+	}
+	if conf.Jira.Transitions.Enabled() {
+		for _, repo := range repos {
+			if err := syncTransitions(ctx, client, repo, result); err != nil {
+				result.fatal(err)
+				return result
+			}
+		}
+	}
+	syncSources(ctx, sum, result)
+	if conf.Jira.Triage.Enabled {
+		checkTriage(ctx, client, result)
+	}
+	if conf.Jira.Publish.Enabled {
+		if err := publishJiraIssues(ctx, client, sum, result); err != nil {
+			result.fatal(err)
+			return result
+		}
+	}
+	log.Printf("Finished processing all issues")
+	return result
+}
+
+// listRepoIssues fetches the issues of a repository in the configured state
+// and, regardless of their age or state, the issues labelled for forced sync
+func listRepoIssues(ctx context.Context, client *github.Client, repo config.RepoConfig) ([]*github.Issue, error) {
+	return fetchIssues(ctx, client, repo)
+}
+
+// lookupMapping returns the synced mapping of key. Mappings left pending by
+// an interrupted sync are reported as ErrNotFound so the sync is retried.
+func lookupMapping(ctx context.Context, key string) (*state.Mapping, error) {
+	return newEngine(nil, nil).Lookup(ctx, key)
+}
+
+// bodyHash identifies the version of an issue body that was synced
+func bodyHash(issue *github.Issue) string {
+	sum := sha256.Sum256([]byte(issue.GetBody()))
+	return hex.EncodeToString(sum[:])
+}
+
+// syncStageError records which step of the sync failed
+type syncStageError struct {
+	stage string
+	err   error
+}
+
+func (e *syncStageError) Error() string { return e.err.Error() }
+func (e *syncStageError) Unwrap() error { return e.err }
+
+// issueKey returns the canonical mapping key of a GitHub issue
+func issueKey(repo config.RepoConfig, issue *github.Issue) (string, error) {
+	namespace := repo.NamespaceName()
+	return idmap.Key(namespace, cfg().GitHub.IDStrategy(namespace), idmap.Issue{
+		Repo:   repo.FullName(),
+		Number: issue.GetNumber(),
+		ID:     issue.GetID(),
+		NodeID: issue.GetNodeID(),
+	})
+}
+
+// summarizeIssue generates the AI summary of a GitHub issue with the prompt
+// of its repository, in the language of the Jira project it goes to
+func summarizeIssue(ctx context.Context, sum *summarizer.Summarizer, repo config.RepoConfig, issue *github.Issue, project string) (string, error) {
+	return summarizeIssueThread(ctx, sum, repo, issue, project, nil)
+}
+
+// summarizeIssueThread generates the AI summary of a GitHub issue like
+// summarizeIssue, from its description followed by comments
+func summarizeIssueThread(ctx context.Context, sum *summarizer.Summarizer, repo config.RepoConfig, issue *github.Issue, project string, comments []*github.IssueComment) (string, error) {
+	body, err := beforeSummarize(ctx, repo, issue)
+	if err != nil {
+		return "", err
+	}
+	if len(comments) > 0 && strings.TrimSpace(body) != "" {
+		var thread strings.Builder
+		thread.WriteString(body)
+		writeComments(&thread, comments)
+		body = thread.String()
+	}
+	prompt, body := issueSummaryInput(repo, issue, body)
+	if body == "" {
+		log.Printf("Issue #%d has neither a description nor a title, leaving its summary empty", issue.GetNumber())
+		return "", nil
+	}
+	log.Printf("Starting summary generation for issue #%d", issue.GetNumber())
+	summary, err := summarizeText(ctx, sum.WithLanguage(cfg().Summarizer.LanguageFor(project)), prompt, body, nil)
+	if err != nil {
+		log.Printf("Failed to generate summary for issue #%d: %v", issue.GetNumber(), err)
+		return "", err
+	}
+	log.Printf("Successfully generated summary for issue #%d", issue.GetNumber())
+	return summary, nil
+}
+
+// issuePrompt asks for the summary of an issue description
+const issuePrompt = `Please analyze this GitHub issue description and create a clear, concise summary with necessary code snippet:
 
 %s
 
@@ -103,141 +723,434 @@ Please format the response as follows:
 1. Brief overview (1-2 sentences)
 2. Key points (bullet points)
 3. Technical details (if any)
-4. Impact and dependencies (if mentioned)`, *issue.Body))
+4. Impact and dependencies (if mentioned)`
 
-		// Cancel the context after we're done with the API call
-		cancel()
+// titlePrompt asks for the summary of an issue without a description
+const titlePrompt = `This GitHub issue has no description, only a title:
 
-		if err != nil {
-			log.Printf("Failed to generate summary for issue #%d: %v", *issue.Number, err)
-			continue
-		}
-		log.Printf("Successfully generated summary for issue #%d", *issue.Number)
-
-		if !processedIssueIDs[*issue.ID] {
-			log.Printf("New GitHub issue detected: #%d - %s", *issue.Number, *issue.Title)
-			log.Printf("Creating Jira issue for GitHub issue #%d", *issue.Number)
-			err := createJiraIssue(issue, summary)
-			if err == nil {
-				log.Printf("Successfully created Jira issue for GitHub issue #%d", *issue.Number)
-				processedIssueIDs[*issue.ID] = true
-			} else {
-				log.Printf("Failed to create Jira issue for GitHub issue #%d: %v", *issue.Number, err)
-			}
-		} else {
-			log.Printf("Issue #%d already processed, skipping", *issue.Number)
-		}
+%s
+
+Please restate in 1-2 sentences what the issue asks for, without adding details the title doesn't give.`
+
+// issueBody returns the body of an issue without the HTML comments,
+// placeholders and boilerplate of issue templates, as sent to the model and
+// Jira
+func issueBody(issue *github.Issue) string {
+	return sanitizer.Clean(issue.GetBody())
+}
+
+// issueSummaryInput returns the prompt and text summarizing an issue with
+// the description body. Issues without a description are summarized from
+// their title alone; text is empty if the title is empty too.
+func issueSummaryInput(repo config.RepoConfig, issue *github.Issue, body string) (prompt, text string) {
+	if strings.TrimSpace(body) != "" {
+		return issuePromptFor(repo), body
 	}
-	log.Printf("Finished processing all issues")
+	log.Printf("Issue #%d has no description, summarizing its title only", issue.GetNumber())
+	return titlePrompt, strings.TrimSpace(issue.GetTitle())
 }
 
-func createJiraIssue(issue *github.Issue, summary string) error {
-	log.Printf("Preparing Jira issue payload for GitHub issue #%d", *issue.Number)
-	jiraURL := fmt.Sprintf("%s/rest/api/2/issue", jiraBaseURL)
-
-	payload := map[string]interface{}{
-		"fields": map[string]interface{}{
-			"project": map[string]string{
-				"key": jiraProjectKey,
-			},
-			"summary":     fmt.Sprintf("GitHub Issue #%d: %s", *issue.Number, *issue.Title),
-			"description": fmt.Sprintf("Imported from GitHub: %s\n\nSummarized Description:\n%s", *issue.HTMLURL, summary),
-			"issuetype": map[string]string{
-				"name": jiraIssueType,
-			},
-		},
+// summarizeText generates the AI summary of an issue description with
+// prompt. onChunk, if not nil, receives the summary while it is generated.
+func summarizeText(ctx context.Context, sum *summarizer.Summarizer, prompt, body string, onChunk func(string) error) (summary string, err error) {
+	ctx, span := startSpan(ctx, "summarize", attribute.Int("gh_jira.input_length", len(body)))
+	defer func() { endSpan(span, err) }()
+	return newEngine(nil, sum).Summarize(ctx, prompt, body, onChunk)
+}
+
+// createAndRecord summarizes the issue, creates its Jira issue, records the
+// mapping under key and writes the back-link to GitHub. If an earlier
+// creation failed, the summary queued with its retry is reused. The caller
+// claims the issue.
+func createAndRecord(ctx context.Context, client *github.Client, repo config.RepoConfig, issue *github.Issue, key string, sum *summarizer.Summarizer) (*state.Mapping, error) {
+	r, dup, err := preparePayload(ctx, client, repo, issue, key, sum)
+	if err != nil || dup != nil {
+		return dup, err
 	}
+	return createWithRetry(ctx, client, repo, issue, r)
+}
 
-	jsonData, err := json.Marshal(payload)
+// createDirect summarizes an issue and creates its Jira issue, bypassing the
+// approval gate and the retry queue, which fetch issues from GitHub by
+// number. It returns the mapping and the warnings of the Jira payload.
+func createDirect(ctx context.Context, repo config.RepoConfig, issue *github.Issue, key string, sum *summarizer.Summarizer) (*state.Mapping, []string, error) {
+	summary, err := summarizeIssue(ctx, sum, repo, issue, cfg().Jira.Route(repo, ruleIssue(issue).Labels).ProjectKey)
 	if err != nil {
-		log.Printf("Failed to marshal Jira payload for issue #%d: %v", *issue.Number, err)
-		return err
+		return nil, nil, &syncStageError{stage: "summarize", err: err}
 	}
-	log.Printf("Jira payload prepared for issue #%d", *issue.Number)
-
-	req, err := http.NewRequest("POST", jiraURL, strings.NewReader(string(jsonData)))
+	fields, warnings := jiraIssueFields(repo, issue, summary)
+	warnings = append(warnings, enrichFields(ctx, sum, issue, fields)...)
+	mapping, err := createFromPayload(ctx, repo, issue, key, summary, fields)
 	if err != nil {
-		log.Printf("Failed to create HTTP request for issue #%d: %v", *issue.Number, err)
-		return err
+		return nil, nil, err
+	}
+	if isSink(mapping.JiraInstance) {
+		return mapping, warnings, nil
+	}
+	if err := assignSprint(ctx, repo, issue, mapping); err != nil {
+		log.Printf("Failed to add Jira issue %s to the active sprint: %v", mapping.JiraKey, err)
+	}
+	return mapping, warnings, nil
+}
+
+// preparePayload summarizes the issue into the Jira payload of its creation,
+// or reuses the payload queued by an earlier failed creation. An issue found
+// to duplicate a synced one is linked to its Jira issue instead, and the
+// resulting mapping returned.
+func preparePayload(ctx context.Context, client *github.Client, repo config.RepoConfig, issue *github.Issue, key string, sum *summarizer.Summarizer) (*state.Retry, *state.Mapping, error) {
+	r, err := store.GetRetry(ctx, key)
+	switch {
+	case err == nil:
+		log.Printf("Reusing the summary of GitHub issue #%d from %d failed attempts", issue.GetNumber(), r.Attempts)
+		return r, nil, nil
+	case !errors.Is(err, state.ErrNotFound):
+		return nil, nil, &syncStageError{stage: "retry", err: err}
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.SetBasicAuth(jiraUsername, jiraAPIToken)
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("User-Agent", "jira-client/1.0")
+	summary, err := summarizeIssue(ctx, sum, repo, issue, cfg().Jira.Route(repo, ruleIssue(issue).Labels).ProjectKey)
+	if err != nil {
+		return nil, nil, &syncStageError{stage: "summarize", err: err}
+	}
+	dup, err := findDuplicate(ctx, sum, key, summary)
+	if err != nil {
+		log.Printf("Failed to check GitHub issue #%d for duplicates: %v", issue.GetNumber(), err)
+	} else if dup != nil {
+		m, err := linkDuplicate(ctx, client, repo, issue, key, dup)
+		return nil, m, err
+	}
+	fields, warnings := jiraIssueFields(repo, issue, summary)
+	warnings = append(warnings, enrichFields(ctx, sum, issue, fields)...)
+	return newRetry(repo, issue, key, summary, fields, warnings), nil, nil
+}
 
-	log.Printf("Sending request to Jira API for issue #%d", *issue.Number)
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// createFromPayload creates the Jira issue from prepared fields and records
+// the mapping under key. publishSync completes the sync.
+func createFromPayload(ctx context.Context, repo config.RepoConfig, issue *github.Issue, key, summary string, fields map[string]interface{}) (*state.Mapping, error) {
+	fields, err := beforeJiraCreate(ctx, repo, issue, summary, fields)
 	if err != nil {
-		log.Printf("HTTP request failed for issue #%d: %v", *issue.Number, err)
-		return err
+		return nil, &syncStageError{stage: "hook", err: err}
+	}
+	limitDescription(issue, fields)
+	mapping := newPendingMapping(repo, issue, key)
+	log.Printf("Creating Jira issue for GitHub issue #%d", issue.GetNumber())
+	jiraCtx, span := startSpan(ctx, "create_jira_issue", issueAttrs(repo.FullName(), issue.GetNumber())...)
+	jiraKey, err := newEngine(nil, nil).Create(jiraCtx, mapping, fields, bodyHash(issue))
+	span.SetAttributes(attribute.String("jira.key", jiraKey))
+	endSpan(span, err)
+	if jiraKey != "" {
+		announceCreated(ctx, repo, issue, mapping, jiraKey, fields)
+	}
+	if err != nil {
+		return nil, engineError(err)
+	}
+	recordSnapshot(ctx, mapping, issue, "create", summary, fields)
+	if !isSink(mapping.JiraInstance) {
+		attachFullBody(ctx, mapping, issue, fields)
+		attachIssueJSON(ctx, mapping, issue)
+	}
+	log.Printf("Successfully created %s issue %s for GitHub issue #%d", trackerName(mapping.JiraInstance), jiraKey, issue.GetNumber())
+	return mapping, nil
+}
+
+// newPendingMapping returns the mapping of an issue whose Jira issue is
+// about to be created
+func newPendingMapping(repo config.RepoConfig, issue *github.Issue, key string) *state.Mapping {
+	if repo.Sink != "" {
+		return issuesync.PendingMapping(repo, issue, key, repo.Sink)
+	}
+	// The payload was routed to the same instance, unless the labels
+	// changed while it waited for approval or a retry
+	return issuesync.PendingMapping(repo, issue, key, cfg().Jira.Route(repo, ruleIssue(issue).Labels).Instance)
+}
+
+// recordPending records the mapping of an issue whose Jira issue is about to
+// be created, so that a sync interrupted by a crash can be told apart from
+// an issue that was never synced. It returns the fields marked with the
+// marker label of the issue.
+func recordPending(ctx context.Context, mapping *state.Mapping, fields map[string]interface{}) (map[string]interface{}, error) {
+	e := newEngine(nil, nil)
+	if err := e.RecordPending(ctx, mapping); err != nil {
+		return nil, engineError(err)
 	}
-	defer resp.Body.Close()
+	return e.Mark(mapping, fields), nil
+}
+
+// recoverCreated returns the key of the Jira issue created for a pending
+// mapping by an interrupted sync, or "" if there is none
+func recoverCreated(ctx context.Context, mapping *state.Mapping) (string, error) {
+	jiraKey, err := newEngine(nil, nil).Recover(ctx, mapping)
+	return jiraKey, engineError(err)
+}
 
-	body, _ := io.ReadAll(resp.Body)
-	log.Printf("Jira API response for issue #%d - Status: %s, Body: %s", *issue.Number, resp.Status, string(body))
+// dropPending removes the pending mapping of a failed creation
+func dropPending(ctx context.Context, key string) {
+	newEngine(nil, nil).DropPending(ctx, key)
+}
+
+// abandonPending removes the pending mapping of a failed creation unless
+// the Jira issue may have been created nonetheless
+func abandonPending(ctx context.Context, mapping *state.Mapping, err error) {
+	newEngine(nil, nil).Abandon(ctx, mapping, err)
+}
+
+// recordCreated audits and announces the Jira issue created for a pending
+// mapping and records the mapping as synced
+func recordCreated(ctx context.Context, repo config.RepoConfig, issue *github.Issue, mapping *state.Mapping, jiraKey, summary string, fields map[string]interface{}) error {
+	announceCreated(ctx, repo, issue, mapping, jiraKey, fields)
+	if err := newEngine(nil, nil).RecordSynced(ctx, mapping, jiraKey, bodyHash(issue)); err != nil {
+		return engineError(err)
+	}
+	recordSnapshot(ctx, mapping, issue, "create", summary, fields)
+	if !isSink(mapping.JiraInstance) {
+		attachFullBody(ctx, mapping, issue, fields)
+		attachIssueJSON(ctx, mapping, issue)
+	}
+	log.Printf("Successfully created %s issue %s for GitHub issue #%d", trackerName(mapping.JiraInstance), jiraKey, issue.GetNumber())
+	return nil
+}
+
+// announceCreated audits and notifies the creation of the Jira issue of a
+// mapping
+func announceCreated(ctx context.Context, repo config.RepoConfig, issue *github.Issue, mapping *state.Mapping, jiraKey string, fields map[string]interface{}) {
+	e := jiraAudit("create_issue", jiraKey, map[string]interface{}{"fields": fieldNames(fields)})
+	e.Repo, e.Issue = repo.FullName(), issue.GetNumber()
+	if mapping.JiraInstance != "" {
+		e.Details["instance"] = mapping.JiraInstance
+	}
+	recordAudit(e)
+	sendNotification(ctx, notify.Event{
+		Kind:     notify.EventCreated,
+		Repo:     repo.FullName(),
+		Issue:    issue.GetNumber(),
+		IssueURL: issue.GetHTMLURL(),
+		Title:    issue.GetTitle(),
+		JiraKey:  jiraKey,
+		JiraURL:  jiraBrowseURL(mapping.JiraInstance, jiraKey),
+	})
+}
+
+// publishSync completes the sync of a newly created Jira issue: it adds the
+// issue to its epic and sprint, creates its subtasks and links, and writes
+// the back-link to GitHub. Issues of sinks only get the back-link.
+func publishSync(ctx context.Context, client *github.Client, repo config.RepoConfig, issue *github.Issue, mapping *state.Mapping, warnings []string) error {
+	if !isSink(mapping.JiraInstance) {
+		publishJira(ctx, repo, issue, mapping)
+	}
+	clearDeadLetter(ctx, client, repo, issue)
 
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		// Parse the Jira response to get the issue key
-		var jiraResponse struct {
-			Key string `json:"key"`
+	ghCtx, span := startSpan(ctx, "update_github", issueAttrs(repo.FullName(), issue.GetNumber())...)
+	defer span.End()
+	if err := writeBacklink(ghCtx, client, repo, issue, mapping, syncStatus{State: "Synced", Warnings: warnings}); err != nil {
+		log.Printf("Failed to write back-link for GitHub issue #%d: %v", issue.GetNumber(), err)
+		tracing.Fail(span, err)
+		return &syncStageError{stage: "backlink", err: err}
+	}
+	if err := markSyncedIssue(ghCtx, client, repo, issue, mapping.JiraKey); err != nil {
+		log.Printf("Failed to mark GitHub issue #%d as synced: %v", issue.GetNumber(), err)
+		tracing.Fail(span, err)
+		return &syncStageError{stage: "label", err: err}
+	}
+	afterSync(ctx, repo, issue, mapping)
+	return nil
+}
+
+// publishJira adds a newly created Jira issue to its epic and sprint,
+// creates its subtasks and links, and moves it to done if its GitHub issue
+// is closed
+func publishJira(ctx context.Context, repo config.RepoConfig, issue *github.Issue, mapping *state.Mapping) {
+	if err := syncEpic(ctx, repo, issue, mapping); err != nil {
+		log.Printf("Failed to add Jira issue %s to the epic of its milestone: %v", mapping.JiraKey, err)
+	}
+	if err := assignSprint(ctx, repo, issue, mapping); err != nil {
+		log.Printf("Failed to add Jira issue %s to the active sprint: %v", mapping.JiraKey, err)
+	}
+	if err := syncSubtasks(ctx, repo, issue, mapping); err != nil {
+		log.Printf("Failed to create the subtasks of Jira issue %s: %v", mapping.JiraKey, err)
+	}
+	if err := syncLinks(ctx, repo, issue, mapping); err != nil {
+		log.Printf("Failed to link Jira issue %s to the issues it references: %v", mapping.JiraKey, err)
+	}
+	if err := syncReactions(ctx, repo, issue, mapping); err != nil {
+		log.Printf("Failed to sync the reactions of GitHub issue #%d to Jira issue %s: %v", issue.GetNumber(), mapping.JiraKey, err)
+	}
+	if err := closeJiraIssue(ctx, repo, issue, mapping); err != nil {
+		log.Printf("Failed to move Jira issue %s of closed GitHub issue #%d to done: %v", mapping.JiraKey, issue.GetNumber(), err)
+	}
+}
+
+// resyncIssue regenerates the summary of an already synced issue, from its
+// description and the given comments, and updates the Jira description and
+// the GitHub back-link
+func resyncIssue(ctx context.Context, client *github.Client, repo config.RepoConfig, issue *github.Issue, mapping *state.Mapping, sum *summarizer.Summarizer, comments []*github.IssueComment) error {
+	project, _, _ := strings.Cut(mapping.JiraKey, "-")
+	summary, err := summarizeIssueThread(ctx, sum, repo, issue, project, comments)
+	if err != nil {
+		return &syncStageError{stage: "summarize", err: err}
+	}
+
+	tracker, err := trackerFor(mapping.JiraInstance)
+	if err != nil {
+		return &syncStageError{stage: "update", err: err}
+	}
+	log.Printf("Updating %s issue %s for GitHub issue #%d", trackerName(mapping.JiraInstance), mapping.JiraKey, issue.GetNumber())
+	fields := map[string]interface{}{"description": current().jiraDescription(repo, issue, summary)}
+	if jc, ok := tracker.(*jira.Client); ok {
+		fields["description"] = withDiscussion(mentionsToJira(jc, fields["description"].(string)), storedDiscussion(ctx, mapping))
+		if reporter := cfg().JiraUser(issue.GetUser().GetLogin()); reporter != "" {
+			fields["reporter"] = reporter
 		}
-		if err := json.Unmarshal(body, &jiraResponse); err != nil {
-			log.Printf("Failed to parse Jira response for issue #%d: %v", *issue.Number, err)
-			return err
+		if repo.Restricted() {
+			fields["security"] = securityLevel(repo.Security.Level)
 		}
+		for _, w := range formFields(issue, fields) {
+			log.Printf("Warning for Jira issue %s: %s", mapping.JiraKey, w)
+		}
+	}
+	limitDescription(issue, fields)
+	jiraCtx, span := startSpan(ctx, "update_jira_issue", attribute.String("jira.key", mapping.JiraKey))
+	err = tracker.UpdateIssue(jiraCtx, mapping.JiraKey, fields)
+	endSpan(span, err)
+	if err != nil {
+		if isAuthError(err) {
+			return &fatalError{err: err}
+		}
+		return &syncStageError{stage: "update", err: err}
+	}
+	e := jiraAudit("update_issue", mapping.JiraKey, map[string]interface{}{"fields": fieldNames(fields)})
+	e.Repo, e.Issue = repo.FullName(), issue.GetNumber()
+	if mapping.JiraInstance != "" {
+		e.Details["instance"] = mapping.JiraInstance
+	}
+	recordAudit(e)
 
-		log.Printf("Jira issue %s created successfully for GitHub issue #%d", jiraResponse.Key, *issue.Number)
+	mapping.SyncStatus = state.StatusSynced
+	mapping.BodyHash = bodyHash(issue)
+	mapping.LastSyncedAt = time.Now().UTC()
+	mapping.UpdatedAt = mapping.LastSyncedAt
+	if err := store.Put(ctx, mapping); err != nil {
+		return &syncStageError{stage: "record", err: err}
+	}
+	recordSnapshot(ctx, mapping, issue, "update", summary, fields)
+	recordSummaryRefresh(ctx, mapping, issue)
+	if !isSink(mapping.JiraInstance) {
+		attachFullBody(ctx, mapping, issue, fields)
+	}
+	ghCtx, span := startSpan(ctx, "update_github", issueAttrs(repo.FullName(), issue.GetNumber())...)
+	err = writeBacklink(ghCtx, client, repo, issue, mapping, syncStatus{State: "Re-synced"})
+	endSpan(span, err)
+	if err != nil {
+		return &syncStageError{stage: "backlink", err: err}
+	}
+	afterSync(ctx, repo, issue, mapping)
+	return nil
+}
 
-		// Update GitHub issue with Jira link
-		err = updateGitHubIssueWithJiraLink(issue, jiraResponse.Key)
-		if err != nil {
-			log.Printf("Failed to update GitHub issue #%d with Jira link: %v", *issue.Number, err)
-			return err
+// hasLabel reports whether the issue carries the named label
+func hasLabel(issue *github.Issue, name string) bool {
+	for _, l := range issue.Labels {
+		if strings.EqualFold(l.GetName(), name) {
+			return true
 		}
-
-		return nil
 	}
+	return false
+}
 
-	err = fmt.Errorf("Jira API responded with status %s", resp.Status)
-	log.Printf("Failed to create Jira issue for GitHub issue #%d: %v", *issue.Number, err)
-	return err
+// removeForceLabel removes the force-sync label once the issue was handled,
+// so it is only processed once
+func removeForceLabel(ctx context.Context, client *github.Client, repo config.RepoConfig, issue *github.Issue) {
+	conf := cfg()
+	if err := ghRateLimit.wait(ctx); err != nil {
+		return
+	}
+	log.Printf("Removing label %s from GitHub issue #%d", conf.GitHub.ForceLabel, issue.GetNumber())
+	resp, err := client.Issues.RemoveLabelForIssue(ctx, repo.Owner, repo.Name, issue.GetNumber(), conf.GitHub.ForceLabel)
+	ghRateLimit.observe(resp, err)
+	if err != nil {
+		log.Printf("Failed to remove label %s from GitHub issue #%d: %v", conf.GitHub.ForceLabel, issue.GetNumber(), err)
+		return
+	}
+	recordAudit(githubAudit("remove_label", repo, issue.GetNumber(), map[string]interface{}{"label": conf.GitHub.ForceLabel}))
 }
 
-func updateGitHubIssueWithJiraLink(issue *github.Issue, jiraKey string) error {
-	log.Printf("Updating GitHub issue #%d with Jira issue link %s", *issue.Number, jiraKey)
+// jiraIssueFields builds the fields of the Jira issue for a GitHub issue.
+// Problems that don't prevent the creation are returned as warnings.
+func jiraIssueFields(repo config.RepoConfig, issue *github.Issue, summary string) (map[string]interface{}, []string) {
+	var warnings []string
 
-	// Create GitHub client
-	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: githubToken},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-	client := github.NewClient(tc)
+	log.Printf("Preparing Jira issue payload for GitHub issue #%d", issue.GetNumber())
 
-	// Construct the Jira issue URL
-	jiraIssueURL := fmt.Sprintf("%s/browse/%s", jiraBaseURL, jiraKey)
+	s := current()
+	target := s.cfg.Jira.Route(repo, ruleIssue(issue).Labels)
+	if target.Instance != "" {
+		log.Printf("Routing GitHub issue #%d to Jira project %s of instance %s as %s", issue.GetNumber(), target.ProjectKey, target.Instance, target.IssueType)
+	} else {
+		log.Printf("Routing GitHub issue #%d to Jira project %s as %s", issue.GetNumber(), target.ProjectKey, target.IssueType)
+	}
 
-	// Append Jira link to existing description
-	newDescription := *issue.Body
-	if newDescription != "" {
-		newDescription += "\n\n"
+	description := s.jiraDescription(repo, issue, summary)
+	if jc, err := jiraFor(target.Instance); err == nil {
+		description = mentionsToJira(jc, description)
 	}
-	newDescription += fmt.Sprintf("---\nLinked Jira Issue: [%s](%s)", jiraKey, jiraIssueURL)
+	fields := map[string]interface{}{
+		"project": map[string]string{
+			"key": target.ProjectKey,
+		},
+		"summary":     s.jiraSummary(repo, issue, summary),
+		"description": description,
+		"issuetype": map[string]string{
+			"name": target.IssueType,
+		},
+	}
+	if reporter := s.cfg.JiraUser(issue.GetUser().GetLogin()); reporter != "" {
+		log.Printf("Setting the reporter of GitHub issue #%d to the Jira user of @%s", issue.GetNumber(), issue.GetUser().GetLogin())
+		fields["reporter"] = reporter
+	}
+	if repo.Restricted() {
+		log.Printf("Restricting the Jira issue of GitHub issue #%d to security level %s", issue.GetNumber(), repo.Security.Level)
+		fields["security"] = securityLevel(repo.Security.Level)
+	}
+	warnings = append(warnings, formFields(issue, fields)...)
 
-	// Update the GitHub issue
-	updatedIssue := &github.IssueRequest{
-		Body: &newDescription,
+	if s.rules != nil {
+		res, err := s.rules.Evaluate(ruleIssue(issue))
+		if err != nil {
+			log.Printf("Failed to evaluate field-mapping rules for issue #%d: %v", issue.GetNumber(), err)
+			warnings = append(warnings, fmt.Sprintf("Field-mapping rules could not be applied: %v", err))
+		} else {
+			log.Printf("Field-mapping rules matched for issue #%d: %v", issue.GetNumber(), res.Matched)
+			for name, value := range res.JiraFields() {
+				fields[name] = value
+			}
+		}
 	}
+	return fields, warnings
+}
 
-	log.Printf("Sending update request to GitHub for issue #%d", *issue.Number)
-	_, _, err := client.Issues.Edit(ctx, githubOwner, githubRepo, *issue.Number, updatedIssue)
-	if err != nil {
-		log.Printf("Failed to update GitHub issue #%d: %v", *issue.Number, err)
-		return fmt.Errorf("failed to update GitHub issue: %w", err)
+// securityLevel returns the value of the Jira security field for a
+// security level given by ID or name
+func securityLevel(level string) map[string]string {
+	if _, err := strconv.Atoi(level); err == nil {
+		return map[string]string{"id": level}
 	}
+	return map[string]string{"name": level}
+}
 
-	log.Printf("Successfully updated GitHub issue #%d with Jira link", *issue.Number)
-	return nil
+// recordSnapshot stores what a sync action wrote to Jira. Failures are only
+// logged as the action itself succeeded.
+func recordSnapshot(ctx context.Context, m *state.Mapping, issue *github.Issue, action, summary string, fields map[string]interface{}) {
+	snap := &state.Snapshot{
+		Key:             m.Key,
+		Repo:            m.Repo,
+		IssueNumber:     m.IssueNumber,
+		JiraKey:         m.JiraKey,
+		Action:          action,
+		GitHubBody:      issue.GetBody(),
+		GitHubUpdatedAt: issue.GetUpdatedAt().Time,
+		Summary:         summary,
+		JiraFields:      fields,
+		CreatedAt:       time.Now().UTC(),
+	}
+	if err := store.AddSnapshot(ctx, snap); err != nil {
+		log.Printf("Failed to record snapshot of %s on %s: %v", action, m.JiraKey, err)
+	}
 }
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/savitaashture/gh-jira/pkg/jira"
+)
+
+// githubMentionPattern matches @login mentions of GitHub users. The
+// character before the @ keeps email addresses out; a trailing / marks a
+// team mention such as @org/team, which is left alone.
+var githubMentionPattern = regexp.MustCompile(`(^|[^\w@.` + "`" + `/-])@([A-Za-z0-9](?:[A-Za-z0-9]|-[A-Za-z0-9]){0,38})\b(/?)`)
+
+// jiraMentionPattern matches [~accountid:ID] and [~username] mentions of
+// Jira users
+var jiraMentionPattern = regexp.MustCompile(`\[~(?:accountid:)?([^\]\s]+)\]`)
+
+// mentionsToJira rewrites the @login mentions of mapped GitHub users in text
+// copied to a Jira instance into mentions of their Jira users. Mentions in
+// code blocks and of unmapped users are left unchanged.
+func mentionsToJira(jc *jira.Client, text string) string {
+	conf := cfg()
+	if len(conf.Users) == 0 || !strings.Contains(text, "@") {
+		return text
+	}
+	return outsideCode(text, func(line string) string {
+		return githubMentionPattern.ReplaceAllStringFunc(line, func(match string) string {
+			m := githubMentionPattern.FindStringSubmatch(match)
+			if m[3] != "" {
+				return match
+			}
+			user := conf.JiraUser(m[2])
+			if user == "" {
+				return match
+			}
+			return m[1] + jc.Mention(user)
+		})
+	})
+}
+
+// mentionsToGitHub rewrites the mentions of mapped Jira users in text copied
+// from Jira into @login mentions. Mentions of unmapped users are left
+// unchanged.
+func mentionsToGitHub(text string) string {
+	conf := cfg()
+	if len(conf.Users) == 0 || !strings.Contains(text, "[~") {
+		return text
+	}
+	return jiraMentionPattern.ReplaceAllStringFunc(text, func(match string) string {
+		login := conf.GitHubLogin(jiraMentionPattern.FindStringSubmatch(match)[1])
+		if login == "" {
+			return match
+		}
+		return "@" + login
+	})
+}
+
+// outsideCode applies fn to the lines of a Markdown text that aren't in code
+// blocks, and to the parts of them outside inline code
+func outsideCode(text string, fn func(string) string) string {
+	lines := strings.Split(text, "\n")
+	inCode := false
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+		parts := strings.Split(line, "`")
+		for j := 0; j < len(parts); j += 2 {
+			parts[j] = fn(parts[j])
+		}
+		lines[i] = strings.Join(parts, "`")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/savitaashture/gh-jira/pkg/summarizer"
+)
+
+// modelMetric is a summarizer metric exported for each model
+type modelMetric struct {
+	name, kind, help string
+	value            func(m summarizer.ModelMetrics) float64
+}
+
+// modelMetrics are the summarizer metrics served at /metrics. Throughput is
+// gh_jira_summarizer_tokens_total over gh_jira_summarizer_eval_seconds_total.
+var modelMetrics = []modelMetric{
+	{"gh_jira_summarizer_generations_total", "counter", "Finished generations",
+		func(m summarizer.ModelMetrics) float64 { return float64(m.Generations) }},
+	{"gh_jira_summarizer_failures_total", "counter", "Failed generations",
+		func(m summarizer.ModelMetrics) float64 { return float64(m.Failures) }},
+	{"gh_jira_summarizer_generation_seconds_total", "counter", "Total duration of the generations",
+		func(m summarizer.ModelMetrics) float64 { return m.GenerationSeconds }},
+	{"gh_jira_summarizer_queue_wait_seconds_total", "counter", "Total time generations waited for the model",
+		func(m summarizer.ModelMetrics) float64 { return m.QueueWaitSeconds }},
+	{"gh_jira_summarizer_prompt_tokens_total", "counter", "Prompt tokens read by the model",
+		func(m summarizer.ModelMetrics) float64 { return float64(m.PromptTokens) }},
+	{"gh_jira_summarizer_tokens_total", "counter", "Tokens generated by the model",
+		func(m summarizer.ModelMetrics) float64 { return float64(m.Tokens) }},
+	{"gh_jira_summarizer_eval_seconds_total", "counter", "Time the model spent generating tokens",
+		func(m summarizer.ModelMetrics) float64 { return m.EvalSeconds }},
+	{"gh_jira_summarizer_running", "gauge", "Generations in progress",
+		func(m summarizer.ModelMetrics) float64 { return float64(m.Running) }},
+	{"gh_jira_summarizer_queue_depth", "gauge", "Generations waiting for the model",
+		func(m summarizer.ModelMetrics) float64 { return float64(m.Waiting) }},
+}
+
+// handleMetrics serves the summarizer, field sync, dead letter and poll
+// interval metrics in the Prometheus text format
+func (d *dashboard) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := writeModelMetrics(w, d.sum.Metrics()); err != nil {
+		log.Printf("Failed to write metrics: %v", err)
+		return
+	}
+	if err := fieldChanges.write(w); err != nil {
+		log.Printf("Failed to write metrics: %v", err)
+		return
+	}
+	if err := writeDeadLetterMetrics(r.Context(), w); err != nil {
+		log.Printf("Failed to write metrics: %v", err)
+		return
+	}
+	if err := pace.writeMetrics(w); err != nil {
+		log.Printf("Failed to write metrics: %v", err)
+	}
+}
+
+// writeModelMetrics writes the metrics of each model in the Prometheus text
+// format
+func writeModelMetrics(out io.Writer, models []summarizer.ModelMetrics) error {
+	for _, metric := range modelMetrics {
+		if _, err := fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", metric.name, metric.help, metric.name, metric.kind); err != nil {
+			return err
+		}
+		for _, m := range models {
+			if _, err := fmt.Fprintf(out, "%s{model=%q} %g\n", metric.name, m.Model, metric.value(m)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/savitaashture/gh-jira/pkg/notify"
+)
+
+// notifyTimeout limits the delivery of a notification, so a slow webhook
+// doesn't hold up the poll cycle
+const notifyTimeout = 10 * time.Second
+
+// notifier posts events to the configured chat webhooks; nil unless a
+// webhook is configured
+var notifier *notify.Dispatcher
+
+// newNotifier creates the dispatcher of the configured webhooks
+func newNotifier() (*notify.Dispatcher, error) {
+	n := cfg().Notifications
+	var notifiers []notify.Notifier
+	if n.SlackWebhookURL != "" {
+		notifiers = append(notifiers, &notify.Slack{WebhookURL: n.SlackWebhookURL})
+	}
+	if n.TeamsWebhookURL != "" {
+		notifiers = append(notifiers, &notify.Teams{WebhookURL: n.TeamsWebhookURL})
+	}
+	return notify.New(notifiers, n.Events, n.Templates)
+}
+
+// sendNotification posts e; failures are logged since notifications are best
+// effort
+func sendNotification(ctx context.Context, e notify.Event) {
+	if notifier == nil {
+		return
+	}
+	if e.Host == "" {
+		e.Host, _ = os.Hostname()
+	}
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	if err := notifier.Send(ctx, e); err != nil {
+		log.Printf("Failed to send %s notification: %v", e.Kind, err)
+	}
+}
+
+// notifyOnStop sends the stopped notification and flushes the traces when
+// the service is interrupted or terminated, then exits
+func notifyOnStop(flushTraces func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Printf("Received %s, stopping", sig)
+		sendNotification(context.Background(), notify.Event{Kind: notify.EventStopped, Error: "received " + sig.String()})
+		stopElection()
+		flushTraces()
+		os.Exit(exitOK)
+	}()
+}
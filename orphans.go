@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+// orphanCursor names the state cursor recording the actions taken on the
+// Jira issue of a mapping whose GitHub issue is gone
+func orphanCursor(key string) string {
+	return "orphan:" + key
+}
+
+// transferredTo returns the owner/name of the repository a GitHub issue
+// fetched from repo lives in now, or "" if it is still in repo. GitHub
+// redirects requests for transferred issues to their new location.
+func transferredTo(repo string, issue *github.Issue) string {
+	_, current, ok := strings.Cut(issue.GetRepositoryURL(), "/repos/")
+	if !ok || strings.EqualFold(current, repo) {
+		return ""
+	}
+	return current
+}
+
+// handleOrphan applies the configured orphan actions to the Jira issue of a
+// mapping whose GitHub issue was deleted or transferred, as described by
+// reason. It returns the names of the actions taken so far. Deleting the
+// Jira issue also removes the mapping; other actions are recorded so that
+// each is taken once.
+func handleOrphan(ctx context.Context, m *state.Mapping, reason string) ([]string, error) {
+	o := cfg().Jira.Orphans
+	stored, err := store.GetCursor(ctx, orphanCursor(m.Key))
+	if err != nil {
+		return nil, err
+	}
+	var taken []string
+	if stored != "" {
+		taken = strings.Split(stored, ",")
+	}
+	jc, err := jiraFor(m.JiraInstance)
+	if err != nil {
+		return nil, err
+	}
+	owner, name, _ := strings.Cut(m.Repo, "/")
+	repo := config.RepoConfig{Owner: owner, Name: name}
+
+	if o.Has(config.OrphanDelete) {
+		log.Printf("Deleting Jira issue %s: GitHub issue %s#%d was %s", m.JiraKey, m.Repo, m.IssueNumber, reason)
+		if err := jc.DeleteIssue(ctx, m.JiraKey); err != nil {
+			return nil, fmt.Errorf("failed to delete %s: %w", m.JiraKey, err)
+		}
+		e := jiraAudit("delete_issue", m.JiraKey, map[string]interface{}{"reason": reason})
+		e.Repo, e.Issue = m.Repo, m.IssueNumber
+		recordAudit(e)
+		if err := store.Delete(ctx, m.Key); err != nil {
+			return nil, fmt.Errorf("failed to remove mapping %s: %w", m.Key, err)
+		}
+		return o.Actions, nil
+	}
+
+	for _, action := range []string{config.OrphanComment, config.OrphanLabel, config.OrphanTransition} {
+		if !o.Has(action) || slices.Contains(taken, action) {
+			continue
+		}
+		switch action {
+		case config.OrphanComment:
+			body := fmt.Sprintf("The GitHub issue %s#%d this issue was imported from was %s.", m.Repo, m.IssueNumber, reason)
+			id, err := jc.AddComment(ctx, m.JiraKey, body)
+			if err != nil {
+				return taken, fmt.Errorf("failed to comment on %s: %w", m.JiraKey, err)
+			}
+			e := jiraAudit("create_comment", m.JiraKey, map[string]interface{}{"comment_id": id})
+			e.Repo, e.Issue = m.Repo, m.IssueNumber
+			recordAudit(e)
+		case config.OrphanLabel:
+			if err := jc.AddLabels(ctx, m.JiraKey, o.Label); err != nil {
+				return taken, fmt.Errorf("failed to label %s: %w", m.JiraKey, err)
+			}
+			e := jiraAudit("add_label", m.JiraKey, map[string]interface{}{"label": o.Label})
+			e.Repo, e.Issue = m.Repo, m.IssueNumber
+			recordAudit(e)
+		case config.OrphanTransition:
+			tr, err := transitionByName(ctx, jc, repo, &github.Issue{Number: github.Ptr(m.IssueNumber)}, m.JiraKey, o.Transition)
+			if err != nil {
+				return taken, err
+			}
+			if tr == nil {
+				log.Printf("Jira issue %s has no transition %q in its current status, leaving it unchanged", m.JiraKey, o.Transition.Name)
+			}
+		}
+		log.Printf("Took orphan action %s on Jira issue %s: GitHub issue %s#%d was %s", action, m.JiraKey, m.Repo, m.IssueNumber, reason)
+		// Recorded one by one, so a failed action doesn't repeat the others
+		taken = append(taken, action)
+		if err := store.SetCursor(ctx, orphanCursor(m.Key), strings.Join(taken, ",")); err != nil {
+			return taken, err
+		}
+	}
+	return taken, nil
+}
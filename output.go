@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats supported by the CLI commands
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// outputFlag registers the --output flag shared by all commands
+func outputFlag(fs *flag.FlagSet) *string {
+	return fs.String("output", outputTable, "Output format: table, json or yaml")
+}
+
+// validOutput checks the value of an --output flag
+func validOutput(format string) error {
+	switch format {
+	case outputTable, outputJSON, outputYAML:
+		return nil
+	default:
+		return fmt.Errorf("invalid output format %q, must be table, json or yaml", format)
+	}
+}
+
+// writeOutput writes v in the requested format. The JSON and YAML documents
+// share the schema given by the json tags of v; table calls the
+// human-readable renderer of the command.
+func writeOutput(w io.Writer, format string, v interface{}, table func(w io.Writer) error) error {
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case outputYAML:
+		// Round-trip through JSON so that both formats use the same field names
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		var doc interface{}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err != nil {
+			return err
+		}
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(yamlNumbers(doc)); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		return table(w)
+	}
+}
+
+// yamlNumbers converts json.Number values so that YAML renders them as
+// numbers rather than strings
+func yamlNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = yamlNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = yamlNumbers(e)
+		}
+	}
+	return v
+}
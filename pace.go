@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// pollPace lengthens the poll interval while poll cycles find no new
+// issues, as configured by poll.adaptive
+type pollPace struct {
+	mu sync.Mutex
+	// quiet counts the consecutive poll cycles without new issues
+	quiet int
+	// interval is the backed-off interval; 0 is the base interval
+	interval time.Duration
+}
+
+// pace is the pollPace of the poll loop
+var pace = &pollPace{}
+
+// observe backs the interval off after a cycle without new issues, or
+// resets it after one with new issues. Cycles that failed as a whole say
+// nothing about activity and leave it unchanged.
+func (p *pollPace) observe(r *cycleResult) {
+	conf := cfg()
+	if r.Status == statusFatal {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if r.Created+r.Queued+r.Retried+r.Published > 0 {
+		if p.interval > conf.Poll.Interval {
+			log.Printf("Found new issues, polling every %s again", conf.Poll.Interval)
+		}
+		p.quiet, p.interval = 0, 0
+		return
+	}
+	p.quiet++
+	ac := conf.Poll.Adaptive
+	if !conf.Poll.AdaptiveEnabled() || p.quiet < ac.QuietCycles {
+		return
+	}
+	current := p.current()
+	next := min(time.Duration(float64(current)*ac.Factor), ac.MaxInterval)
+	if next != current {
+		log.Printf("No new issues for %d poll cycles, polling every %s", p.quiet, next)
+	}
+	p.interval = next
+}
+
+// current returns the poll interval, within the configured bounds in case
+// they changed since the back-off. p.mu must be held.
+func (p *pollPace) current() time.Duration {
+	conf := cfg()
+	if !conf.Poll.AdaptiveEnabled() || p.interval < conf.Poll.Interval {
+		return conf.Poll.Interval
+	}
+	return min(p.interval, conf.Poll.Adaptive.MaxInterval)
+}
+
+// nextDelay returns the wait before the next poll cycle: the current
+// interval with the configured jitter
+func (p *pollPace) nextDelay() time.Duration {
+	p.mu.Lock()
+	pc := cfg().Poll
+	pc.Interval = p.current()
+	p.mu.Unlock()
+	return pc.NextPollDelay()
+}
+
+// writeMetrics writes the poll interval and the quiet cycles in the
+// Prometheus text format
+func (p *pollPace) writeMetrics(out io.Writer) error {
+	p.mu.Lock()
+	interval, quiet := p.current(), p.quiet
+	p.mu.Unlock()
+	_, err := fmt.Fprintf(out, "# HELP %[1]s Current time between poll cycles\n# TYPE %[1]s gauge\n%[1]s %[2]g\n"+
+		"# HELP %[3]s Consecutive poll cycles without new issues\n# TYPE %[3]s gauge\n%[3]s %[4]d\n",
+		"gh_jira_poll_interval_seconds", interval.Seconds(), "gh_jira_poll_quiet_cycles", quiet)
+	return err
+}
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/state"
+	"github.com/savitaashture/gh-jira/pkg/summarizer"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// syncItem is a GitHub issue moving through the sync pipeline
+type syncItem struct {
+	// ctx carries the sync_issue span of the issue
+	ctx    context.Context
+	span   trace.Span
+	repo   config.RepoConfig
+	issue  *github.Issue
+	key    string
+	forced bool
+	// existing is the mapping of an issue that was already synced
+	existing *state.Mapping
+	// payload is the Jira creation prepared by the summarize stage
+	payload *state.Retry
+	// mapping is the mapping recorded by the create stage
+	mapping *state.Mapping
+	// unlock releases the claim of a new issue taken by the dedupe stage
+	unlock func()
+}
+
+// done ends the span of an item leaving the pipeline and releases its claim
+func (it *syncItem) done(err error) {
+	if it.unlock != nil {
+		it.unlock()
+	}
+	endSpan(it.span, err)
+}
+
+// repoRun is a repository fetched in a poll cycle. Its poll_repo span ends
+// after the follow-up work of the repository, once the pipeline drained.
+type repoRun struct {
+	repo    config.RepoConfig
+	ctx     context.Context
+	span    trace.Span
+	fetched bool
+}
+
+// syncPipeline syncs the issues of a poll cycle through stages connected by
+// queues: fetch → dedupe → summarize → create → backlink. Each stage runs in
+// its own goroutines, so a slow model doesn't hold up fetching from GitHub
+// or creating the Jira issues that are already summarized.
+type syncPipeline struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	client *github.Client
+	sum    *summarizer.Summarizer
+	result *cycleResult
+
+	// repos is only written by the fetch stage
+	repos []*repoRun
+	// inFlight holds the keys the dedupe stage passed on, so the same
+	// logical issue seen in two repositories is created once
+	inFlight map[string]bool
+
+	// queues are the input queues of the stages, by stage
+	queues []pipelineQueue
+
+	abortOnce sync.Once
+	err       error
+}
+
+// pipelineQueue is the input queue of a pipeline stage
+type pipelineQueue struct {
+	stage string
+	ch    <-chan *syncItem
+}
+
+// activePipeline is the pipeline of the running poll cycle, if any, for
+// /debug/state
+var activePipeline atomic.Pointer[syncPipeline]
+
+// stageFunc processes an item in a pipeline stage. It reports whether the
+// item moves on to the next stage; a returned error is recorded as a failure
+// of the issue, or aborts the cycle if it is fatal.
+type stageFunc func(it *syncItem) (bool, error)
+
+// runPipeline syncs the issues of repos and then processes the comment
+// commands, retries and approvals of each repository. It only returns an
+// error for fatal problems that should abort the whole cycle.
+func runPipeline(ctx context.Context, client *github.Client, repos []config.RepoConfig, sum *summarizer.Summarizer, result *cycleResult) error {
+	pc := cfg().Poll.Pipeline
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	p := &syncPipeline{
+		ctx:      ctx,
+		cancel:   cancel,
+		client:   client,
+		sum:      sum,
+		result:   result,
+		inFlight: make(map[string]bool),
+	}
+	log.Printf("Syncing %d repositories with %d summarize and %d create workers", len(repos), pc.SummarizeWorkers, pc.CreateWorkers)
+
+	fetched := make(chan *syncItem, pc.QueueSize)
+	go p.fetch(repos, fetched)
+	deduped := p.stage("dedupe", 1, fetched, p.dedupe)
+	prepared := p.stage("summarize", pc.SummarizeWorkers, deduped, p.summarize)
+	created := p.stage("create", pc.CreateWorkers, prepared, p.create)
+	backlinked := p.stage("backlink", 1, created, p.backlink)
+	activePipeline.Store(p)
+	defer activePipeline.Store(nil)
+	for range backlinked {
+	}
+
+	var err error
+	for _, run := range p.repos {
+		if p.err == nil && err == nil && run.fetched {
+			err = processQueues(run.ctx, client, run.repo, sum, result)
+		}
+		run.span.End()
+	}
+	if p.err != nil {
+		return p.err
+	}
+	return err
+}
+
+// processQueues processes the comment commands, the due retries and the
+// approved items of a repository
+func processQueues(ctx context.Context, client *github.Client, repo config.RepoConfig, sum *summarizer.Summarizer, result *cycleResult) error {
+	if err := processCommands(ctx, client, repo, sum, result); err != nil {
+		return err
+	}
+	if err := processRetries(ctx, client, repo, result); err != nil {
+		return err
+	}
+	if cfg().Approval.Required {
+		return processApprovals(ctx, client, repo, result)
+	}
+	return nil
+}
+
+// abort cancels the pipeline because of a fatal error
+func (p *syncPipeline) abort(err error) {
+	p.abortOnce.Do(func() {
+		p.err = err
+		p.cancel()
+	})
+}
+
+// stage runs fn on the items of in with the given number of workers and
+// passes the items it accepts on to the returned queue
+func (p *syncPipeline) stage(name string, workers int, in <-chan *syncItem, fn stageFunc) <-chan *syncItem {
+	out := make(chan *syncItem, cfg().Poll.Pipeline.QueueSize)
+	p.queues = append(p.queues, pipelineQueue{stage: name, ch: in})
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for it := range in {
+				if err := p.ctx.Err(); err != nil {
+					// Drain the queue once the cycle is aborted
+					it.done(err)
+					continue
+				}
+				next, err := fn(it)
+				if err != nil {
+					p.failed(name, it, err)
+				}
+				if next {
+					out <- it
+				} else {
+					it.done(err)
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// failed records the error of an item in a stage
+func (p *syncPipeline) failed(stage string, it *syncItem, err error) {
+	var fatal *fatalError
+	if errors.As(err, &fatal) {
+		p.abort(err)
+		return
+	}
+	if p.ctx.Err() != nil {
+		// Canceled by another stage's fatal error or a shutdown
+		return
+	}
+	var stageErr *syncStageError
+	if errors.As(err, &stageErr) {
+		stage = stageErr.stage
+	}
+	p.result.fail(it.repo.FullName(), it.issue.GetNumber(), stage, err)
+}
+
+// fetch lists the issues of each repository, plus any issue carrying the
+// force-sync label, into out
+func (p *syncPipeline) fetch(repos []config.RepoConfig, out chan<- *syncItem) {
+	defer close(out)
+	for _, repo := range repos {
+		if p.ctx.Err() != nil {
+			return
+		}
+		ctx, span := startSpan(p.ctx, "poll_repo", attribute.String("github.repo", repo.FullName()))
+		run := &repoRun{repo: repo, ctx: ctx, span: span}
+		p.repos = append(p.repos, run)
+
+		issues, err := listRepoIssues(ctx, p.client, repo)
+		if err != nil {
+			log.Printf("Error fetching GitHub issues: %v", err)
+			if isAuthError(err) {
+				p.abort(fmt.Errorf("GitHub authentication failed: %w", err))
+				return
+			}
+			p.result.fail(repo.FullName(), 0, "fetch", err)
+			continue
+		}
+		log.Printf("Found %d issues in %s", len(issues), repo.FullName())
+		p.result.add(&p.result.IssuesSeen, len(issues))
+		run.fetched = true
+
+		for _, issue := range issues {
+			issueCtx, span := startSpan(ctx, "sync_issue", issueAttrs(repo.FullName(), issue.GetNumber())...)
+			out <- &syncItem{ctx: issueCtx, span: span, repo: repo, issue: issue}
+		}
+	}
+}
+
+// dedupe passes on the issues that need a Jira issue or have one to keep up
+// to date, and skips excluded issues and those already synced elsewhere
+func (p *syncPipeline) dedupe(it *syncItem) (bool, error) {
+	conf := cfg()
+	ctx, issue := it.ctx, it.issue
+	if issue.IsPullRequest() {
+		log.Printf("Skipping PR #%d", issue.GetNumber())
+		p.result.inc(&p.result.Skipped)
+		return false, nil
+	}
+	if conf.GitHub.SkipLabel != "" && hasLabel(issue, conf.GitHub.SkipLabel) {
+		log.Printf("Skipping issue #%d labelled %s", issue.GetNumber(), conf.GitHub.SkipLabel)
+		p.result.inc(&p.result.Skipped)
+		return false, nil
+	}
+	it.forced = conf.GitHub.ForceLabel != "" && hasLabel(issue, conf.GitHub.ForceLabel)
+	if !conf.GitHub.AutoSync && !it.forced {
+		log.Printf("Automatic sync disabled, skipping issue #%d", issue.GetNumber())
+		p.result.inc(&p.result.Skipped)
+		return false, nil
+	}
+
+	key, err := issueKey(it.repo, issue)
+	if err != nil {
+		log.Printf("Failed to derive canonical key for issue #%d: %v", issue.GetNumber(), err)
+		return false, err
+	}
+	it.key = key
+	if p.inFlight[key] {
+		log.Printf("Issue %s#%d is the same logical issue (%s) as an issue synced in this cycle, skipping", it.repo.FullName(), issue.GetNumber(), key)
+		p.result.inc(&p.result.Skipped)
+		return false, nil
+	}
+
+	existing, err := lookupMapping(ctx, key)
+	if errors.Is(err, state.ErrNotFound) {
+		// The key of a transferred issue changes with its namespace
+		existing, err = findTransferred(ctx, it.repo, issue)
+		if err == nil && existing == nil {
+			err = state.ErrNotFound
+		}
+	}
+	if err == nil && isTransferOf(existing, it.repo, issue) {
+		if existing, err = moveTransferred(ctx, it.repo, issue, key, existing); err != nil {
+			return false, err
+		}
+		p.result.inc(&p.result.Transferred)
+	}
+	switch {
+	case err == nil && (existing.Repo != it.repo.FullName() || existing.IssueNumber != issue.GetNumber()):
+		log.Printf("Issue %s#%d is the same logical issue as %s#%d (%s), already synced to %s, skipping",
+			it.repo.FullName(), issue.GetNumber(), existing.Repo, existing.IssueNumber, key, existing.JiraKey)
+		p.result.inc(&p.result.Skipped)
+		p.dropForceLabel(it)
+		return false, nil
+	case err == nil:
+		log.Printf("Issue #%d already processed as %s, skipping", issue.GetNumber(), existing.JiraKey)
+		it.existing = existing
+	case !errors.Is(err, state.ErrNotFound):
+		log.Printf("Failed to look up mapping for issue #%d: %v", issue.GetNumber(), err)
+		return false, err
+	case it.forced:
+		log.Printf("Forced sync requested for GitHub issue #%d - %s", issue.GetNumber(), issue.GetTitle())
+	default:
+		log.Printf("New GitHub issue detected: #%d - %s", issue.GetNumber(), issue.GetTitle())
+	}
+
+	if it.existing == nil && !it.forced && skipClosed(issue) {
+		log.Printf("Skipping closed issue #%d", issue.GetNumber())
+		p.result.inc(&p.result.Skipped)
+		return false, nil
+	}
+	// Filtered issues are dropped before anything is summarized
+	if it.existing == nil && !it.forced {
+		if why := filteredOut(it.repo, issue); why != "" {
+			log.Printf("Skipping issue #%d as %s", issue.GetNumber(), why)
+			p.result.inc(&p.result.Skipped)
+			return false, nil
+		}
+	}
+
+	// Failed creations are retried with backoff by processRetries, unless
+	// the sync is forced
+	if it.existing == nil && !it.forced {
+		if r, err := store.GetRetry(ctx, key); err == nil {
+			log.Printf("GitHub issue #%d is queued for retry after %d failed attempts, skipping", issue.GetNumber(), r.Attempts)
+			p.result.inc(&p.result.Skipped)
+			return false, nil
+		}
+	}
+	if it.existing == nil {
+		claimed, unlock, err := claimIssue(ctx, key)
+		switch {
+		case errors.Is(err, errIssueBusy), errors.Is(err, errIssueSynced):
+			log.Printf("Skipping GitHub issue #%d: %v", issue.GetNumber(), err)
+			p.result.inc(&p.result.Skipped)
+			return false, nil
+		case err != nil:
+			return false, &syncStageError{stage: "lock", err: err}
+		}
+		it.ctx, it.unlock = claimed, unlock
+	}
+	p.inFlight[key] = true
+	return true, nil
+}
+
+// summarize keeps the Jira issue of an already synced issue up to date, or
+// prepares the Jira payload of a new one: queued for approval if required,
+// otherwise passed on for creation
+func (p *syncPipeline) summarize(it *syncItem) (bool, error) {
+	it.ctx = summarizer.WithPriority(it.ctx, summaryPriority(it))
+	if it.existing != nil {
+		p.refresh(it)
+		return false, nil
+	}
+	if cfg().Approval.Required {
+		awaitApproval(it.ctx, it.repo, it.issue, it.key, p.sum, p.result)
+		p.dropForceLabel(it)
+		return false, nil
+	}
+
+	payload, dup, err := preparePayload(it.ctx, p.client, it.repo, it.issue, it.key, p.sum)
+	if err != nil {
+		return false, err
+	}
+	if dup != nil {
+		// Linked to the Jira issue of a duplicate
+		p.result.inc(&p.result.Skipped)
+		p.dropForceLabel(it)
+		return false, nil
+	}
+	it.payload = payload
+	return true, nil
+}
+
+// summaryPriority returns the priority of the summaries of an item. Only
+// new issues opened within the realtime age go ahead of bulk work such as the first import of a repository or the
+// discussion summaries of synced issues.
+func summaryPriority(it *syncItem) summarizer.Priority {
+	if it.existing != nil || time.Since(it.issue.GetCreatedAt().Time) > cfg().Summarizer.RealtimeAge {
+		return summarizer.PriorityBackground
+	}
+	return summarizer.PriorityRealtime
+}
+
+// refresh syncs the changed fields, epic, subtasks, links, pull requests,
+// development activity, reactions, discussion summary, stale summary and
+// comments of an already synced issue. The issues of sinks only get their
+// stale summary refreshed.
+func (p *syncPipeline) refresh(it *syncItem) {
+	ctx, repo, issue, m := it.ctx, it.repo, it.issue, it.existing
+	if isSink(m.JiraInstance) {
+		if err := refreshSummary(ctx, p.client, repo, issue, m, p.sum); err != nil {
+			log.Printf("Failed to refresh the summary of %s issue %s: %v", trackerName(m.JiraInstance), m.JiraKey, err)
+			p.result.fail(repo.FullName(), issue.GetNumber(), "refresh", err)
+		}
+		p.result.inc(&p.result.Skipped)
+		p.dropForceLabel(it)
+		return
+	}
+	if err := syncFields(ctx, repo, issue, m); err != nil {
+		log.Printf("Failed to sync the fields of Jira issue %s: %v", m.JiraKey, err)
+		p.result.fail(repo.FullName(), issue.GetNumber(), "fields", err)
+	}
+	if err := syncEpic(ctx, repo, issue, m); err != nil {
+		log.Printf("Failed to sync the epic of Jira issue %s: %v", m.JiraKey, err)
+		p.result.fail(repo.FullName(), issue.GetNumber(), "epic", err)
+	}
+	if err := syncSubtasks(ctx, repo, issue, m); err != nil {
+		log.Printf("Failed to sync the subtasks of Jira issue %s: %v", m.JiraKey, err)
+		p.result.fail(repo.FullName(), issue.GetNumber(), "subtasks", err)
+	}
+	if err := syncLinks(ctx, repo, issue, m); err != nil {
+		log.Printf("Failed to sync the links of Jira issue %s: %v", m.JiraKey, err)
+		p.result.fail(repo.FullName(), issue.GetNumber(), "links", err)
+	}
+	if err := syncPullRequests(ctx, p.client, repo, issue, m); err != nil {
+		log.Printf("Failed to sync the pull requests of Jira issue %s: %v", m.JiraKey, err)
+		p.result.fail(repo.FullName(), issue.GetNumber(), "pulls", err)
+	}
+	if err := syncDevelopment(ctx, p.client, repo, issue, m); err != nil {
+		log.Printf("Failed to sync the development activity of Jira issue %s: %v", m.JiraKey, err)
+		p.result.fail(repo.FullName(), issue.GetNumber(), "development", err)
+	}
+	if err := syncReactions(ctx, repo, issue, m); err != nil {
+		log.Printf("Failed to sync the reactions of Jira issue %s: %v", m.JiraKey, err)
+		p.result.fail(repo.FullName(), issue.GetNumber(), "reactions", err)
+	}
+	if err := syncDiscussion(ctx, p.client, repo, issue, m, p.sum); err != nil {
+		log.Printf("Failed to sync the discussion summary of Jira issue %s: %v", m.JiraKey, err)
+		p.result.fail(repo.FullName(), issue.GetNumber(), "discussion", err)
+	}
+	if err := refreshSummary(ctx, p.client, repo, issue, m, p.sum); err != nil {
+		log.Printf("Failed to refresh the summary of Jira issue %s: %v", m.JiraKey, err)
+		p.result.fail(repo.FullName(), issue.GetNumber(), "refresh", err)
+	}
+	if err := syncComments(ctx, p.client, repo, issue, m); err != nil {
+		log.Printf("Failed to mirror the comments of GitHub issue #%d and Jira issue %s: %v", issue.GetNumber(), m.JiraKey, err)
+		p.result.fail(repo.FullName(), issue.GetNumber(), "comments", err)
+	}
+	p.result.inc(&p.result.Skipped)
+	p.dropForceLabel(it)
+}
+
+// create creates and records the Jira issue of a prepared payload. Failed
+// creations are queued for retry.
+func (p *syncPipeline) create(it *syncItem) (bool, error) {
+	m, err := attemptCreate(it.ctx, it.repo, it.issue, it.payload)
+	if err != nil {
+		return false, err
+	}
+	it.mapping = m
+	return true, nil
+}
+
+// backlink completes the sync of a newly created Jira issue
+func (p *syncPipeline) backlink(it *syncItem) (bool, error) {
+	if err := publishSync(it.ctx, p.client, it.repo, it.issue, it.mapping, it.payload.Warnings); err != nil {
+		return false, err
+	}
+	p.result.inc(&p.result.Created)
+	p.dropForceLabel(it)
+	return false, nil
+}
+
+// dropForceLabel removes the force-sync label of an item once it is handled
+func (p *syncPipeline) dropForceLabel(it *syncItem) {
+	if it.forced {
+		removeForceLabel(it.ctx, p.client, it.repo, it.issue)
+	}
+}
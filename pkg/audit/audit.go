@@ -0,0 +1,86 @@
+// Package audit writes an append-only log of the changes gh-jira makes in
+// GitHub and Jira.
+//
+// Entries are JSON objects, one per line, appended to a file that is never
+// rewritten, so the log can be shipped to a SIEM or reviewed with jq.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Systems changed by gh-jira
+const (
+	SystemGitHub = "github"
+	SystemGitLab = "gitlab"
+	SystemJira   = "jira"
+)
+
+// Entry is a single change
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Actor identifies the configured credentials the change was made with
+	Actor string `json:"actor"`
+	// System is SystemGitHub, SystemGitLab or SystemJira
+	System string `json:"system"`
+	// Action is what was done, such as create_issue or edit_comment
+	Action string `json:"action"`
+	// Target is the changed object, such as owner/name#12 or PROJ-34
+	Target  string `json:"target"`
+	Repo    string `json:"repo,omitempty"`
+	Issue   int    `json:"issue,omitempty"`
+	JiraKey string `json:"jira_key,omitempty"`
+	// Details holds action specific data, such as the changed fields
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Log appends entries to a file. The zero value and a nil *Log discard them.
+type Log struct {
+	mu    sync.Mutex
+	f     *os.File
+	actor string
+}
+
+// Open opens the audit log at path for appending, creating it if needed.
+// Entries are attributed to actor.
+func Open(path, actor string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &Log{f: f, actor: actor}, nil
+}
+
+// Record appends e, setting its time and actor. The entry is synced to disk
+// before Record returns.
+func (l *Log) Record(e Entry) error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	e.Time = time.Now().UTC()
+	e.Actor = l.actor
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.f.Write(data); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return l.f.Sync()
+}
+
+// Close closes the file
+func (l *Log) Close() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	return l.f.Close()
+}
@@ -0,0 +1,2481 @@
+// Package config loads the gh-jira configuration from an optional YAML file
+// and environment variables.
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/savitaashture/gh-jira/pkg/filter"
+	"github.com/savitaashture/gh-jira/pkg/hooks"
+	"github.com/savitaashture/gh-jira/pkg/secrets"
+	"gopkg.in/yaml.v3"
+)
+
+// Default values used when neither the config file nor the environment sets them
+const (
+	DefaultPollInterval   = 1 * time.Minute
+	DefaultPollJitter     = 0.1
+	DefaultRateLimit      = 100
+	DefaultWatchdog       = 5
+	DefaultQueueSize      = 10
+	DefaultQuietCycles    = 3
+	DefaultBackoffFactor  = 2
+	DefaultLeaderLock     = "gh-jira"
+	DefaultLeaseTTL       = 15 * time.Second
+	DefaultIssueLockTTL   = 2 * time.Minute
+	DefaultPreflight      = 2 * time.Minute
+	DefaultSkipLabel      = "no-jira"
+	DefaultForceLabel     = "jira-sync"
+	DefaultCommand        = "/jira"
+	DefaultProjectKey     = "GT"
+	DefaultIssueType      = "Task"
+	DefaultEpicType       = "Epic"
+	DefaultEpicLink       = "parent"
+	DefaultSubtaskType    = "Sub-task"
+	DefaultLinkType       = "Relates"
+	DefaultDevProperty    = "gh-jira.development"
+	DefaultReleaseVersion = "{tag}"
+	DefaultTriageSLA      = 48 * time.Hour
+	DefaultTriageJQL      = "statusCategory = \"To Do\""
+	DefaultPublishJQL     = `labels = "to-github" AND statusCategory != Done`
+	DefaultOrphanLabel    = "github-orphaned"
+	DefaultMarkerLabel    = "gh-jira"
+	DefaultOrphanStatus   = "Orphaned"
+	DefaultMaxComments    = 100
+	DefaultRealtimeAge    = time.Hour
+	DefaultDupThreshold   = 0.92
+	DefaultModel          = "mistral"
+	DefaultMaxAttempts    = 5
+	DefaultBackoff        = 5 * time.Minute
+	DefaultMaxBackoff     = 6 * time.Hour
+	DefaultHTTPTimeout    = 30 * time.Second
+	DefaultGenTimeout     = 5 * time.Minute
+	// DefaultDescriptionLength stays below the 32767 characters Jira accepts
+	// in text fields
+	DefaultDescriptionLength = 32000
+	// MinDescriptionLength leaves room for the summary next to the
+	// truncation notice
+	MinDescriptionLength = 1000
+)
+
+// DefaultCommandAssociations are the author associations allowed to use the
+// comment command by default: the repository's owner, the members of its
+// organization and its collaborators
+var DefaultCommandAssociations = []string{"OWNER", "MEMBER", "COLLABORATOR"}
+
+// commandAssociations are the author associations GitHub reports
+var commandAssociations = map[string]bool{
+	"OWNER": true, "MEMBER": true, "COLLABORATOR": true, "CONTRIBUTOR": true,
+	"FIRST_TIME_CONTRIBUTOR": true, "FIRST_TIMER": true, "MANNEQUIN": true, "NONE": true,
+}
+
+// DefaultSummaryTemplate and DefaultDescriptionTemplate are the Go templates
+// of the summary and description of the Jira issues created for GitHub
+// issues
+const (
+	DefaultSummaryTemplate     = "{{.Source}} Issue #{{.Number}}: {{.Title}}"
+	DefaultDescriptionTemplate = `Imported from {{.Source}}: {{.URL}}
+
+{{if and .Author (not .AuthorInJira)}}Reported by @{{.Author}}
+
+{{end}}Summarized Description:
+{{.Summary}}`
+)
+
+// Config holds the full application configuration
+type Config struct {
+	GitHub GitHubConfig `yaml:"github"`
+	Jira   JiraConfig   `yaml:"jira"`
+	Poll   PollConfig   `yaml:"poll"`
+	State  StateConfig  `yaml:"state"`
+	// Leader enables leader election between replicas
+	Leader LeaderConfig `yaml:"leader"`
+	// Preflight checks the access to GitHub, Jira and Ollama at startup
+	Preflight PreflightConfig `yaml:"preflight"`
+	// Approval gates the creation of Jira issues behind a human decision
+	Approval ApprovalConfig `yaml:"approval"`
+	// Retry controls how failed Jira creations are retried
+	Retry RetryConfig `yaml:"retry"`
+	// Secrets configures the providers secret references are resolved with
+	Secrets SecretsConfig `yaml:"secrets"`
+	// HTTP holds the proxy and TLS settings of all outbound connections
+	HTTP HTTPConfig `yaml:"http"`
+	// Summarizer configures the AI summaries
+	Summarizer SummarizerConfig `yaml:"summarizer"`
+	// Server configures the built-in web dashboard
+	Server ServerConfig `yaml:"server"`
+	// Tracing configures the export of OpenTelemetry traces
+	Tracing TracingConfig `yaml:"tracing"`
+	// Audit configures the log of changes made in GitHub and Jira
+	Audit AuditConfig `yaml:"audit"`
+	// Notifications configures the Slack and Teams notifications
+	Notifications NotificationsConfig `yaml:"notifications"`
+	// Redaction masks secrets in issues before they reach the model and
+	// Jira
+	Redaction RedactionConfig `yaml:"redaction"`
+	// Sanitization cleans the template noise out of issue bodies before they
+	// reach the model and Jira
+	Sanitization SanitizationConfig `yaml:"sanitization"`
+	// Hooks run Go plugins or external commands at stages of each sync
+	Hooks []HookConfig `yaml:"hooks"`
+	// Sources are issue trackers other than GitHub whose issues are synced
+	// too
+	Sources []SourceConfig `yaml:"sources"`
+	// Sinks are trackers other than Jira that repositories can sync their
+	// issues to instead
+	Sinks []SinkConfig `yaml:"sinks"`
+	// Users maps GitHub logins to Jira users: account IDs on Jira Cloud,
+	// usernames on Jira Server and Data Center
+	Users map[string]string `yaml:"users"`
+
+	// RulesFile is the path to the declarative field-mapping rules
+	RulesFile string `yaml:"rulesFile"`
+}
+
+// GitHubConfig holds the GitHub connection settings
+type GitHubConfig struct {
+	Owner string `yaml:"owner"`
+	Repo  string `yaml:"repo"`
+	Token string `yaml:"token"`
+	// App authenticates as a GitHub App installation instead of with Token
+	App GitHubAppConfig `yaml:"app"`
+	// BaseURL is the REST API URL of a GitHub Enterprise Server, e.g.
+	// https://github.example.com/api/v3/; empty uses GitHub.com
+	BaseURL string `yaml:"baseURL"`
+	// UploadURL defaults to the uploads API next to BaseURL
+	UploadURL string `yaml:"uploadURL"`
+	// CAFile is a PEM bundle of the CAs that signed the server certificate
+	// of a GitHub Enterprise Server with an internal CA
+	CAFile string `yaml:"caFile"`
+	// Timeout limits each GitHub API request
+	Timeout time.Duration `yaml:"timeout"`
+	// RateLimitThreshold is the number of remaining API calls below which
+	// polling pauses until the rate limit resets
+	RateLimitThreshold int `yaml:"rateLimitThreshold"`
+	// Repos lists the repositories to watch; if empty, Owner/Repo is watched
+	Repos []RepoConfig `yaml:"repos"`
+	// Namespaces configures how issues are identified within each namespace
+	Namespaces map[string]NamespaceConfig `yaml:"namespaces"`
+	// Org enables discovery of all repositories in an organization
+	Org OrgConfig `yaml:"org"`
+	// Backlink selects how the Jira link is written back to GitHub: "comment"
+	// (a single bot-managed sync status comment, the default), "body"
+	// (appended to the issue description) or "none"
+	Backlink string `yaml:"backlink"`
+	// SkipLabel excludes issues from syncing
+	SkipLabel string `yaml:"skipLabel"`
+	// ForceLabel makes the next poll process the issue even if it is old or
+	// closed; the label is removed once the issue was handled
+	ForceLabel string `yaml:"forceLabel"`
+	// IssueState selects the issues each poll lists: IssuesOpen (the
+	// default), IssuesClosed or IssuesAll
+	IssueState string `yaml:"issueState"`
+	// Fetch is how each poll fetches the issues: FetchGraphQL (the
+	// default) with their comments in one query per repository, or
+	// FetchREST
+	Fetch string `yaml:"fetch"`
+	// ClosedIssues is the policy for closed GitHub issues without a Jira
+	// issue: ClosedCreate, ClosedDone or ClosedSkip
+	ClosedIssues string `yaml:"closedIssues"`
+	// ClosedResolution is set on Jira issues created as done, if the done
+	// transition asks for a resolution
+	ClosedResolution string `yaml:"closedResolution"`
+	// AutoSync mirrors every new issue; when disabled only issues with the
+	// force label or a Command comment are synced
+	AutoSync bool `yaml:"autoSync"`
+	// Command is the issue comment command that creates or re-syncs the
+	// Jira issue on demand; empty disables comment commands
+	Command string `yaml:"command"`
+	// CommandAssociations are the author associations with the repository
+	// (e.g. OWNER, MEMBER, COLLABORATOR) allowed to use Command
+	CommandAssociations []string `yaml:"commandAssociations"`
+	// SyncedLabel is added to issues once their Jira issue was created;
+	// "{key}" is replaced by the Jira key, e.g. "jira:{key}". Empty disables it.
+	SyncedLabel string `yaml:"syncedLabel"`
+	// KeyInTitle prefixes the title of synced issues with "[JIRA-KEY]"
+	KeyInTitle bool `yaml:"keyInTitle"`
+	// Filter selects the new issues to sync before they are summarized
+	Filter FilterConfig `yaml:"filter"`
+	// Discussions also syncs new GitHub Discussions of the watched
+	// repositories
+	Discussions GitHubDiscussionsConfig `yaml:"discussions"`
+}
+
+// GitHubDiscussionsConfig configures the sync of GitHub Discussions
+type GitHubDiscussionsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Categories lists the names or slugs of the discussion categories to
+	// sync, all if empty
+	Categories []string `yaml:"categories"`
+}
+
+// SyncsCategory reports whether discussions of a category are synced
+func (d GitHubDiscussionsConfig) SyncsCategory(name, slug string) bool {
+	if len(d.Categories) == 0 {
+		return true
+	}
+	for _, c := range d.Categories {
+		if strings.EqualFold(c, name) || strings.EqualFold(c, slug) {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterConfig selects the issues to sync. Issues must satisfy Expr, be
+// opened by one of Authors if set and by none of ExcludeAuthors.
+type FilterConfig struct {
+	// Expr is a filter expression, e.g.
+	// labels contains "bug" && !title startsWith "[wip]"
+	Expr string `yaml:"expr"`
+	// Authors lists the GitHub logins whose issues are synced, all if empty
+	Authors []string `yaml:"authors"`
+	// ExcludeAuthors lists the GitHub logins whose issues are never synced,
+	// such as bots
+	ExcludeAuthors []string `yaml:"excludeAuthors"`
+}
+
+// Enabled reports whether the filter excludes any issue
+func (f FilterConfig) Enabled() bool {
+	return f.Expr != "" || len(f.Authors) > 0 || len(f.ExcludeAuthors) > 0
+}
+
+// EnterpriseUploadURL returns the upload URL of a GitHub Enterprise Server
+func (g GitHubConfig) EnterpriseUploadURL() string {
+	if g.UploadURL != "" || g.BaseURL == "" {
+		return g.UploadURL
+	}
+	base := strings.TrimRight(g.BaseURL, "/")
+	if strings.HasSuffix(base, "/api/v3") {
+		return strings.TrimSuffix(base, "/api/v3") + "/api/uploads/"
+	}
+	return base + "/api/uploads/"
+}
+
+// GitHubAppConfig identifies a GitHub App installation
+type GitHubAppConfig struct {
+	AppID          int64 `yaml:"appID"`
+	InstallationID int64 `yaml:"installationID"`
+	// PrivateKey is the PEM encoded private key of the App
+	PrivateKey string `yaml:"privateKey"`
+}
+
+// Enabled reports whether GitHub App authentication is configured
+func (a GitHubAppConfig) Enabled() bool {
+	return a.AppID != 0
+}
+
+// SyncedLabelFor returns the synced label for a Jira issue, or "" if disabled
+func (g GitHubConfig) SyncedLabelFor(jiraKey string) string {
+	return strings.ReplaceAll(g.SyncedLabel, "{key}", jiraKey)
+}
+
+// OrgConfig configures organization-wide repository discovery. Discovered
+// repositories are watched in addition to the ones listed in Repos.
+type OrgConfig struct {
+	Name string `yaml:"name"`
+	// Topics restricts discovery to repositories with at least one of the topics
+	Topics []string `yaml:"topics"`
+	// NamePattern is a regular expression the repository name must match
+	NamePattern string `yaml:"namePattern"`
+	// IncludeForks and IncludeArchived also sync forks and archived repositories
+	IncludeForks    bool `yaml:"includeForks"`
+	IncludeArchived bool `yaml:"includeArchived"`
+	// Jira names the Jira instance of the discovered repositories
+	Jira string `yaml:"jira"`
+}
+
+// RepoConfig identifies a watched GitHub repository
+type RepoConfig struct {
+	Owner string `yaml:"owner"`
+	Name  string `yaml:"name"`
+	// Namespace groups repositories holding the same logical issues, such
+	// as a repository and its mirror. Defaults to owner/name.
+	Namespace string `yaml:"namespace"`
+	// Jira names the Jira instance the issues are synced to; empty uses the
+	// main one
+	Jira string `yaml:"jira"`
+	// Sink names the sink the issues are synced to instead of Jira
+	Sink string `yaml:"sink"`
+	// PromptFile holds the prompt summarizing the issues of the repository
+	// instead of the built-in one; %s is replaced by the issue description
+	PromptFile string `yaml:"promptFile"`
+	// DescriptionTemplate is a file with the Go template of the Jira
+	// descriptions of the issues of the repository
+	DescriptionTemplate string `yaml:"descriptionTemplate"`
+	// IssueTypes maps GitHub labels to the Jira issue type of the issues of
+	// the repository, e.g. bug: Bug. Routes with an issue type take
+	// precedence.
+	IssueTypes map[string]string `yaml:"issueTypes"`
+	// Filter is a filter expression the issues of the repository must
+	// satisfy in addition to the global filter
+	Filter string `yaml:"filter"`
+	// Security restricts who sees the Jira issues of a repository holding
+	// sensitive reports
+	Security SecurityConfig `yaml:"security"`
+}
+
+// SecurityConfig restricts the visibility of the Jira issues of a
+// repository
+type SecurityConfig struct {
+	// Level is the name or ID of the Jira issue security level set on the
+	// Jira issues
+	Level string `yaml:"level"`
+	// Backlink overrides GitHubConfig.Backlink; it defaults to "none" when
+	// Level is set, so that the Jira keys aren't posted to GitHub
+	Backlink string `yaml:"backlink"`
+}
+
+// Restricted reports whether the Jira issues of the repository have a
+// security level
+func (r RepoConfig) Restricted() bool {
+	return r.Security.Level != ""
+}
+
+// BacklinkMode returns how the Jira links of the issues of the repository
+// are written back to GitHub, given the global mode
+func (r RepoConfig) BacklinkMode(global string) string {
+	switch {
+	case r.Security.Backlink != "":
+		return r.Security.Backlink
+	case r.Restricted():
+		return "none"
+	}
+	return global
+}
+
+// IssueTypeFor returns the issue type mapped to the first of labels with
+// one, or ""
+func (r RepoConfig) IssueTypeFor(labels []string) string {
+	for _, l := range labels {
+		for label, issueType := range r.IssueTypes {
+			if strings.EqualFold(l, label) {
+				return issueType
+			}
+		}
+	}
+	return ""
+}
+
+// FullName returns the owner/name form of the repository
+func (r RepoConfig) FullName() string {
+	return r.Owner + "/" + r.Name
+}
+
+// NamespaceName returns the ID-mapping namespace of the repository
+func (r RepoConfig) NamespaceName() string {
+	if r.Namespace != "" {
+		return r.Namespace
+	}
+	return r.FullName()
+}
+
+// NamespaceConfig configures an ID-mapping namespace
+type NamespaceConfig struct {
+	// IDStrategy names the idmap strategy used to identify issues
+	IDStrategy string `yaml:"idStrategy"`
+}
+
+// WatchedRepos returns the statically configured repositories to poll,
+// excluding any discovered through Org
+func (g GitHubConfig) WatchedRepos() []RepoConfig {
+	if len(g.Repos) > 0 {
+		return g.Repos
+	}
+	if g.Owner == "" || g.Repo == "" {
+		return nil
+	}
+	return []RepoConfig{{Owner: g.Owner, Name: g.Repo}}
+}
+
+// IDStrategy returns the ID strategy configured for namespace
+func (g GitHubConfig) IDStrategy(namespace string) string {
+	if s := g.Namespaces[namespace].IDStrategy; s != "" {
+		return s
+	}
+	return "node"
+}
+
+// StateConfig selects where sync state is stored
+type StateConfig struct {
+	// Backend is one of "memory", "file", "sqlite", "postgres" or "redis"
+	Backend string `yaml:"backend"`
+	// DSN is the backend specific location, e.g. the state file path or
+	// the database URL
+	DSN string `yaml:"dsn"`
+	// LockTTL is how long the lease of an issue being synced outlives a
+	// replica that stopped renewing it
+	LockTTL time.Duration `yaml:"lockTTL"`
+	// Reporting creates the reporting views for BI tools and records a
+	// health snapshot after each poll cycle; postgres only
+	Reporting bool `yaml:"reporting"`
+}
+
+// sharedStateBackends are the state backends that several processes can
+// use at the same time
+var sharedStateBackends = map[string]bool{"sqlite": true, "postgres": true, "redis": true}
+
+// Issue states listed by the poller
+const (
+	IssuesOpen   = "open"
+	IssuesClosed = "closed"
+	IssuesAll    = "all"
+)
+
+// Ways of fetching issues
+const (
+	// FetchGraphQL fetches the issues with their comments through the
+	// GitHub GraphQL API, falling back to FetchREST if the query fails
+	FetchGraphQL = "graphql"
+	// FetchREST lists the issues through the REST API and their comments
+	// with a request per issue
+	FetchREST = "rest"
+)
+
+// Policies for closed GitHub issues
+const (
+	// ClosedCreate creates the Jira issue like for an open issue
+	ClosedCreate = "create"
+	// ClosedDone creates the Jira issue and moves it to a done status
+	ClosedDone = "done"
+	// ClosedSkip doesn't sync closed issues unless they are force-synced
+	ClosedSkip = "skip"
+)
+
+// Leader election backends
+const (
+	// LeaderStore holds the leader lock in the shared state store
+	LeaderStore = "store"
+	// LeaderKubernetes holds the leader lock in a Kubernetes Lease
+	LeaderKubernetes = "kubernetes"
+)
+
+// PreflightConfig controls the checks of the GitHub token, the Jira
+// projects and issue types, and the Ollama models run before the first poll
+// cycle
+type PreflightConfig struct {
+	// Enabled refuses to start when a check fails
+	Enabled bool `yaml:"enabled"`
+	// Timeout limits all checks together
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// LeaderConfig enables leader election, so that of several replicas only
+// the leader polls GitHub and changes GitHub and Jira
+type LeaderConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Backend is LeaderStore or LeaderKubernetes
+	Backend string `yaml:"backend"`
+	// Name is the name of the lock or the Lease
+	Name string `yaml:"name"`
+	// Namespace is the namespace of the Lease; empty is the namespace of
+	// the pod
+	Namespace string `yaml:"namespace"`
+	// Identity identifies this replica; empty is the host name and process
+	// ID
+	Identity string `yaml:"identity"`
+	// LeaseDuration is how long the lock stays valid without renewal; the
+	// leader renews it every third of the duration
+	LeaseDuration time.Duration `yaml:"leaseDuration"`
+}
+
+// JiraConfig holds the Jira connection settings
+type JiraConfig struct {
+	BaseURL string `yaml:"baseURL"`
+	// Deployment is "cloud" for Jira Cloud or "server" for Jira Server and
+	// Data Center; empty detects it from the base URL
+	Deployment string `yaml:"deployment"`
+	// Username and APIToken authenticate with basic auth. On Jira Server
+	// and Data Center, APIToken alone is a personal access token.
+	Username   string `yaml:"username"`
+	APIToken   string `yaml:"apiToken"`
+	ProjectKey string `yaml:"projectKey"`
+	IssueType  string `yaml:"issueType"`
+	// Routes send issues with specific labels to other projects; issues
+	// matching no route use ProjectKey and IssueType
+	Routes []RouteConfig `yaml:"routes"`
+	// Instances are further Jira sites that repositories and routes can
+	// send issues to by name
+	Instances []JiraInstanceConfig `yaml:"instances"`
+	// Epics groups the issues of each GitHub milestone under a Jira epic
+	Epics EpicsConfig `yaml:"epics"`
+	// Subtasks creates a subtask for each task list item of an issue
+	Subtasks SubtasksConfig `yaml:"subtasks"`
+	// Links links the Jira issues of GitHub issues referencing each other
+	Links LinksConfig `yaml:"links"`
+	// PullRequests adds remote links to the pull requests referencing
+	// synced issues
+	PullRequests PullRequestsConfig `yaml:"pullRequests"`
+	// Development stores the pull requests, branches and commits of synced
+	// issues in a Jira issue property
+	Development DevelopmentConfig `yaml:"development"`
+	// Reactions carries the 👍 reactions of GitHub issues over to Jira
+	Reactions ReactionsConfig `yaml:"reactions"`
+	// Transitions moves Jira issues through their workflow as their GitHub
+	// issues are closed and reopened
+	Transitions TransitionsConfig `yaml:"transitions"`
+	// Triage flags synced issues left untouched in Jira for too long
+	Triage TriageConfig `yaml:"triage"`
+	// Sprints places new Jira issues in the active sprint of a board
+	Sprints SprintsConfig `yaml:"sprints"`
+	// Releases releases the Jira versions of published GitHub releases
+	Releases ReleasesConfig `yaml:"releases"`
+	// Comments mirrors comments between GitHub issues and their Jira issues
+	Comments CommentsConfig `yaml:"comments"`
+	// Publish creates GitHub issues for the Jira issues matching a query
+	Publish PublishConfig `yaml:"publish"`
+	// Orphans decides what reconciliation does with the Jira issues of
+	// GitHub issues that were deleted or transferred away
+	Orphans OrphansConfig `yaml:"orphans"`
+	// FormFields copies sections of issue form bodies to Jira fields
+	FormFields []FormFieldConfig `yaml:"formFields"`
+	// OAuth authenticates with OAuth 2.0 instead of Username and APIToken
+	OAuth JiraOAuthConfig `yaml:"oauth"`
+	// Timeout limits each Jira API request
+	Timeout time.Duration `yaml:"timeout"`
+	// SummaryTemplate is the Go template of the summary of the Jira issues
+	SummaryTemplate string `yaml:"summaryTemplate"`
+	// DescriptionTemplate is the Go template of their description;
+	// repositories can override it with a template file
+	DescriptionTemplate string `yaml:"descriptionTemplate"`
+	// DescriptionLimit keeps descriptions within the length Jira accepts
+	DescriptionLimit DescriptionLimitConfig `yaml:"descriptionLimit"`
+	// AttachIssueJSON attaches the GitHub issue as returned by the API to
+	// the Jira issues created for it
+	AttachIssueJSON bool `yaml:"attachIssueJSON"`
+	// MarkerLabel prefixes the label marking each created Jira issue with
+	// the ID of its GitHub issue, which finds the Jira issue of a sync
+	// interrupted before recording it; empty doesn't mark issues
+	MarkerLabel string `yaml:"markerLabel"`
+	// FieldSync mirrors label, assignee and milestone changes of synced
+	// issues
+	FieldSync FieldSyncConfig `yaml:"fieldSync"`
+}
+
+// DeploymentType returns the configured deployment type, or "cloud" for
+// Atlassian hosted sites and OAuth apps with a cloud ID and "server"
+// otherwise
+func (j JiraConfig) DeploymentType() string {
+	if j.Deployment != "" {
+		return j.Deployment
+	}
+	if j.OAuth.CloudID != "" {
+		return "cloud"
+	}
+	if u, err := url.Parse(j.BaseURL); err == nil && strings.HasSuffix(u.Hostname(), ".atlassian.net") {
+		return "cloud"
+	}
+	return "server"
+}
+
+// JiraOAuthConfig configures OAuth 2.0 authentication with Jira. With a
+// RefreshToken the refresh token flow is used, otherwise client credentials.
+type JiraOAuthConfig struct {
+	ClientID     string `yaml:"clientID"`
+	ClientSecret string `yaml:"clientSecret"`
+	RefreshToken string `yaml:"refreshToken"`
+	// TokenURL defaults to the Atlassian Cloud token endpoint
+	TokenURL string   `yaml:"tokenURL"`
+	Scopes   []string `yaml:"scopes"`
+	// CloudID routes API requests through api.atlassian.com, as required
+	// for OAuth apps on Jira Cloud
+	CloudID string `yaml:"cloudID"`
+}
+
+// Enabled reports whether OAuth authentication is configured
+func (o JiraOAuthConfig) Enabled() bool {
+	return o.ClientID != ""
+}
+
+// APIURL returns the REST API URL for the cloud ID, or "" to use the base URL
+func (o JiraOAuthConfig) APIURL() string {
+	if o.CloudID == "" {
+		return ""
+	}
+	return "https://api.atlassian.com/ex/jira/" + o.CloudID
+}
+
+// EpicsConfig configures the Jira epics created for GitHub milestones
+type EpicsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// IssueType is the issue type of epics
+	IssueType string `yaml:"issueType"`
+	// LinkField links an issue to its epic: "parent" on Jira Cloud, or the
+	// Epic Link custom field, such as customfield_10008, on Jira Server and
+	// Data Center
+	LinkField string `yaml:"linkField"`
+	// NameField is the Epic Name custom field that Jira Server and Data
+	// Center require when creating epics
+	NameField string `yaml:"nameField"`
+}
+
+// SubtasksConfig configures the Jira subtasks created from the task lists
+// of GitHub issues
+type SubtasksConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// IssueType is the subtask issue type
+	IssueType string `yaml:"issueType"`
+	// Resolution is set when a subtask is completed, if the done
+	// transition asks for one
+	Resolution string `yaml:"resolution"`
+}
+
+// LinksConfig configures the Jira issue links created for references
+// between GitHub issues
+type LinksConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Type is the name of the Jira issue link type
+	Type string `yaml:"type"`
+}
+
+// PullRequestsConfig configures the Jira remote links added for the pull
+// requests that reference synced issues, as found on the issue timeline
+type PullRequestsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Transition is applied once to the Jira issue when an open pull
+	// request references its GitHub issue, such as "In Review"; empty
+	// leaves the status unchanged
+	Transition TransitionConfig `yaml:"transition"`
+}
+
+// DevelopmentConfig configures the Jira issue property holding the GitHub
+// development activity of synced issues
+type DevelopmentConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Property is the key of the issue property
+	Property string `yaml:"property"`
+}
+
+// DescriptionLimitConfig configures how Jira descriptions longer than Jira
+// accepts are shortened
+type DescriptionLimitConfig struct {
+	// MaxLength is the longest description written to Jira in characters;
+	// longer ones are truncated. 0 disables the limit.
+	MaxLength int `yaml:"maxLength"`
+	// AttachFullBody uploads the GitHub issue body as a Markdown attachment
+	// of the Jira issue when its description was truncated
+	AttachFullBody bool `yaml:"attachFullBody"`
+}
+
+// FieldSyncConfig configures which changes of the labels, assignees and
+// milestone of synced GitHub issues are written to their Jira issues. Only
+// the fields that changed since the last poll are updated.
+type FieldSyncConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// MilestoneField is the Jira text field holding the milestone title, if
+	// any; epics follow milestones with Epics
+	MilestoneField string `yaml:"milestoneField"`
+}
+
+// ReactionsConfig configures how the 👍 reactions of GitHub issues show in
+// Jira. Both are updated on every poll.
+type ReactionsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Field is the numeric Jira field holding the 👍 count, if any
+	Field string `yaml:"field"`
+	// Threshold is the 👍 count at which the Jira issue is raised to
+	// Priority; 0 never changes the priority
+	Threshold int    `yaml:"threshold"`
+	Priority  string `yaml:"priority"`
+}
+
+// TransitionsConfig names the Jira transitions applied when GitHub issues
+// change state. Events without a transition leave Jira issues unchanged.
+type TransitionsConfig struct {
+	// Closed applies when an issue is closed as completed, and NotPlanned
+	// when it is closed as not planned; NotPlanned defaults to Closed
+	Closed     TransitionConfig `yaml:"closed"`
+	NotPlanned TransitionConfig `yaml:"notPlanned"`
+	Reopened   TransitionConfig `yaml:"reopened"`
+}
+
+// Enabled reports whether a transition is configured for any event
+func (t TransitionsConfig) Enabled() bool {
+	return t.Closed.Name != "" || t.NotPlanned.Name != "" || t.Reopened.Name != ""
+}
+
+// TransitionConfig names a Jira workflow transition
+type TransitionConfig struct {
+	// Name is the name of the transition or of the status it leads to,
+	// matched case-insensitively
+	Name string `yaml:"name"`
+	// Resolution is set if the transition screen asks for one
+	Resolution string `yaml:"resolution"`
+}
+
+// TriageConfig configures the time-to-triage watcher, which flags the Jira
+// issues of synced issues that had no Jira activity within the SLA. Each
+// issue is flagged once.
+type TriageConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// SLA is the time within which Jira issues are expected to be updated
+	SLA time.Duration `yaml:"sla"`
+	// JQL narrows down the watched Jira issues, such as to those still to
+	// do; empty watches all issues of the Jira projects
+	JQL string `yaml:"jql"`
+	// Comment posts a comment on the GitHub issue of a flagged issue
+	Comment bool `yaml:"comment"`
+}
+
+// SprintsConfig configures the placement of new Jira issues in the active
+// sprint of a Jira Software board. Issues go to the backlog when the board
+// has no active sprint.
+type SprintsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Board is the ID of the board of the projects without one in Boards
+	Board int `yaml:"board"`
+	// Boards maps Jira project keys to the IDs of their boards
+	Boards map[string]int `yaml:"boards"`
+}
+
+// BoardFor returns the ID of the board of a Jira project, or 0 if it has
+// none
+func (s SprintsConfig) BoardFor(project string) int {
+	if id, ok := s.Boards[project]; ok {
+		return id
+	}
+	return s.Board
+}
+
+// ReleasesConfig configures the release of Jira versions when GitHub
+// releases are published. The version is looked up in the Jira project of
+// the repository.
+type ReleasesConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Version is the name of the Jira version of a release, in which
+	// "{tag}" is replaced by the tag of the release and "{version}" by the
+	// tag without a leading v
+	Version string `yaml:"version"`
+	// Notes sets release notes generated from the merged pull requests as
+	// the description of the version
+	Notes bool `yaml:"notes"`
+}
+
+// VersionName returns the name of the Jira version of a release tag
+func (r ReleasesConfig) VersionName(tag string) string {
+	return strings.NewReplacer("{tag}", tag, "{version}", strings.TrimPrefix(tag, "v")).Replace(r.Version)
+}
+
+// Directions in which comments are mirrored
+const (
+	CommentsBoth     = "both"
+	CommentsToJira   = "github-to-jira"
+	CommentsToGitHub = "jira-to-github"
+)
+
+// CommentsConfig configures the mirroring of comments between GitHub issues
+// and their Jira issues. Comments are mirrored once, when they are first
+// seen; later edits are not.
+type CommentsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Direction is CommentsBoth, CommentsToJira or CommentsToGitHub
+	Direction string `yaml:"direction"`
+}
+
+// ToJira reports whether GitHub comments are mirrored to Jira
+func (c CommentsConfig) ToJira() bool {
+	return c.Enabled && c.Direction != CommentsToGitHub
+}
+
+// ToGitHub reports whether Jira comments are mirrored to GitHub
+func (c CommentsConfig) ToGitHub() bool {
+	return c.Enabled && c.Direction != CommentsToJira
+}
+
+// Actions taken on the Jira issues of deleted or transferred GitHub issues
+const (
+	OrphanComment    = "comment"
+	OrphanLabel      = "label"
+	OrphanTransition = "transition"
+	OrphanDelete     = "delete"
+)
+
+// OrphansConfig configures what `reconcile --repair` does with a Jira issue
+// whose GitHub issue was deleted or transferred to another repository.
+// Without actions, such issues are only reported.
+type OrphansConfig struct {
+	// Actions are OrphanComment, OrphanLabel and OrphanTransition, applied
+	// in that order, or OrphanDelete alone
+	Actions []string `yaml:"actions"`
+	// Label is added by OrphanLabel
+	Label string `yaml:"label"`
+	// Transition is applied by OrphanTransition
+	Transition TransitionConfig `yaml:"transition"`
+}
+
+// Has reports whether an action is configured
+func (o OrphansConfig) Has(action string) bool {
+	return slices.Contains(o.Actions, action)
+}
+
+// PublishConfig configures the publishing of Jira issues to GitHub, for
+// teams that plan in Jira first. Each matching Jira issue is published once.
+type PublishConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// JQL selects the Jira issues to publish
+	JQL string `yaml:"jql"`
+	// Repo is the owner/name of the repository the issues are created in;
+	// it can be left empty when a single repository is watched
+	Repo string `yaml:"repo"`
+	// Labels are added to the created GitHub issues
+	Labels []string `yaml:"labels"`
+}
+
+// Types of the Jira fields issue form sections are copied to
+const (
+	// FormText sets the section as text
+	FormText = "text"
+	// FormOption sets the option of a select list field named like the
+	// section
+	FormOption = "option"
+	// FormNumber sets the section as a number
+	FormNumber = "number"
+	// FormLabels adds the comma-separated values of the section as labels
+	FormLabels = "labels"
+)
+
+// FormFieldConfig copies the `### Heading` section of issue form bodies to
+// a Jira field
+type FormFieldConfig struct {
+	// Heading is the label of the form input, matched case-insensitively
+	Heading string `yaml:"heading"`
+	// Field is the Jira field, e.g. environment or customfield_10080
+	Field string `yaml:"field"`
+	// Type is FormText (default), FormOption, FormNumber or FormLabels
+	Type string `yaml:"type"`
+}
+
+// JiraInstanceConfig is a further Jira site. It authenticates with a
+// username and API token or a personal access token; OAuth is only
+// supported for the main instance.
+type JiraInstanceConfig struct {
+	// Name identifies the instance in repositories and routes
+	Name       string `yaml:"name"`
+	BaseURL    string `yaml:"baseURL"`
+	Deployment string `yaml:"deployment"`
+	Username   string `yaml:"username"`
+	APIToken   string `yaml:"apiToken"`
+	// ProjectKey and IssueType default to those of the main instance
+	ProjectKey string `yaml:"projectKey"`
+	IssueType  string `yaml:"issueType"`
+}
+
+// Connection returns the instance as a JiraConfig without routes
+func (i JiraInstanceConfig) Connection(main JiraConfig) JiraConfig {
+	c := JiraConfig{
+		BaseURL:    i.BaseURL,
+		Deployment: i.Deployment,
+		Username:   i.Username,
+		APIToken:   i.APIToken,
+		ProjectKey: i.ProjectKey,
+		IssueType:  i.IssueType,
+		Timeout:    main.Timeout,
+	}
+	if c.ProjectKey == "" {
+		c.ProjectKey = main.ProjectKey
+	}
+	if c.IssueType == "" {
+		c.IssueType = main.IssueType
+	}
+	return c
+}
+
+// Instance returns the connection settings of the named instance; "" is
+// the main instance
+func (j JiraConfig) Instance(name string) (JiraConfig, bool) {
+	if name == "" {
+		return j, true
+	}
+	for _, i := range j.Instances {
+		if i.Name == name {
+			return i.Connection(j), true
+		}
+	}
+	return JiraConfig{}, false
+}
+
+// RouteConfig routes GitHub issues carrying Label to a Jira project
+type RouteConfig struct {
+	Label      string `yaml:"label"`
+	ProjectKey string `yaml:"projectKey"`
+	// IssueType defaults to the issue type of the instance
+	IssueType string `yaml:"issueType"`
+	// Instance names the Jira instance of the project; empty keeps the
+	// instance of the repository
+	Instance string `yaml:"instance"`
+}
+
+// JiraTarget is where the Jira issue of a GitHub issue is created
+type JiraTarget struct {
+	// Instance is the name of the Jira instance, "" for the main one
+	Instance   string
+	ProjectKey string
+	IssueType  string
+}
+
+// Route returns the Jira instance, project key and issue type for an issue
+// of repo with the given labels. The first route matching any label wins;
+// otherwise the issue goes to the default project of the instance of repo.
+// Unless the route sets one, the issue type is mapped from the labels by
+// repo, or else the issue type of the instance.
+func (j JiraConfig) Route(repo RepoConfig, labels []string) JiraTarget {
+	for _, r := range j.Routes {
+		for _, l := range labels {
+			if strings.EqualFold(l, r.Label) {
+				t := JiraTarget{Instance: r.Instance, ProjectKey: r.ProjectKey, IssueType: r.IssueType}
+				if t.Instance == "" {
+					t.Instance = repo.Jira
+				}
+				if t.IssueType == "" {
+					t.IssueType = repo.IssueTypeFor(labels)
+				}
+				if t.IssueType == "" {
+					inst, _ := j.Instance(t.Instance)
+					t.IssueType = inst.IssueType
+				}
+				return t
+			}
+		}
+	}
+	inst, _ := j.Instance(repo.Jira)
+	t := JiraTarget{Instance: repo.Jira, ProjectKey: inst.ProjectKey, IssueType: repo.IssueTypeFor(labels)}
+	if t.IssueType == "" {
+		t.IssueType = inst.IssueType
+	}
+	return t
+}
+
+// ApprovalConfig configures the human-approval gate. When Required, the
+// generated Jira issues are queued and only created once approved with
+// `gh-jira approvals approve`.
+type ApprovalConfig struct {
+	Required bool `yaml:"required"`
+	// SlackWebhookURL is an incoming webhook notified of new approvals
+	SlackWebhookURL string `yaml:"slackWebhookURL"`
+}
+
+// SummarizerConfig configures the Ollama summarizer
+type SummarizerConfig struct {
+	// Model is the Ollama model generating summaries
+	Model string `yaml:"model"`
+	// Fallbacks are the models tried in order when Model fails or isn't
+	// available
+	Fallbacks []string `yaml:"fallbacks"`
+	// AutoPull pulls missing models at startup
+	AutoPull bool `yaml:"autoPull"`
+	// MaxLength limits summaries to this many characters, truncating longer
+	// ones; 0 is unlimited
+	MaxLength int `yaml:"maxLength"`
+	// MaxTokens stops generating summaries after this many tokens; 0 is
+	// unlimited
+	MaxTokens int `yaml:"maxTokens"`
+	// Language is the language summaries are written in, such as Japanese;
+	// empty leaves it to the model
+	Language string `yaml:"language"`
+	// Languages overrides Language by Jira project key
+	Languages map[string]string `yaml:"languages"`
+	// Timeout limits the generation of a single summary with a model, not
+	// counting the wait for the model
+	Timeout time.Duration `yaml:"timeout"`
+	// Concurrency limits the generations running at once on each model, 0
+	// being unlimited. Generations for newly opened issues wait ahead of
+	// those of backfills and other bulk work.
+	Concurrency int `yaml:"concurrency"`
+	// ModelConcurrency overrides Concurrency by model name
+	ModelConcurrency map[string]int `yaml:"modelConcurrency"`
+	// RealtimeAge is the age up to which issues found by polling count as
+	// newly opened; older ones are summarized as bulk work
+	RealtimeAge time.Duration `yaml:"realtimeAge"`
+	// Discussion summarizes the comment threads of busy issues
+	Discussion DiscussionConfig `yaml:"discussion"`
+	// Refresh regenerates the summaries of synced issues whose discussion
+	// moved on
+	Refresh RefreshConfig `yaml:"refresh"`
+	// Enrichment proposes acceptance criteria and story points
+	Enrichment EnrichmentConfig `yaml:"enrichment"`
+	// Duplicates detects new issues similar to already synced ones
+	Duplicates DuplicatesConfig `yaml:"duplicates"`
+}
+
+// DuplicatesConfig configures the embedding-based duplicate detection
+type DuplicatesConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Threshold is the cosine similarity of summaries from which a new issue
+	// is linked to an existing Jira issue instead of getting its own
+	Threshold float64 `yaml:"threshold"`
+	// EmbeddingModel computes the embeddings, such as nomic-embed-text;
+	// empty uses the summarization model
+	EmbeddingModel string `yaml:"embeddingModel"`
+}
+
+// EnrichmentConfig configures the acceptance criteria and story points the
+// model proposes for new Jira issues
+type EnrichmentConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// AcceptanceCriteriaField is the Jira field the acceptance criteria are
+	// written to, such as customfield_10050; empty skips them
+	AcceptanceCriteriaField string `yaml:"acceptanceCriteriaField"`
+	// StoryPointsField is the Jira field the estimate is written to, such
+	// as customfield_10016; empty skips it
+	StoryPointsField string `yaml:"storyPointsField"`
+}
+
+// Targets of discussion summaries
+const (
+	DiscussionDescription = "description"
+	DiscussionComment     = "comment"
+)
+
+// DiscussionConfig configures the summaries of comment threads
+type DiscussionConfig struct {
+	// MinComments is the number of comments from which the discussion of an
+	// issue is summarized; 0 disables discussion summaries
+	MinComments int `yaml:"minComments"`
+	// MaxComments limits the summarized comments to the most recent ones
+	MaxComments int `yaml:"maxComments"`
+	// Target is DiscussionDescription to append the summary to the Jira
+	// description or DiscussionComment to post it as a Jira comment
+	Target string `yaml:"target"`
+}
+
+// RefreshConfig configures when the summary of a synced issue is stale and
+// regenerated from its description and recent comments. Both thresholds
+// being 0 disables refreshes.
+type RefreshConfig struct {
+	// NewComments is the number of comments added since the last summary
+	// that makes it stale
+	NewComments int `yaml:"newComments"`
+	// MaxAge is the age from which a summary is stale once any comment was
+	// added since, such as 168h
+	MaxAge time.Duration `yaml:"maxAge"`
+}
+
+// Enabled reports whether summaries are refreshed
+func (r RefreshConfig) Enabled() bool {
+	return r.NewComments > 0 || r.MaxAge > 0
+}
+
+// LanguageFor returns the summary language of a Jira project
+func (s SummarizerConfig) LanguageFor(projectKey string) string {
+	if l, ok := s.Languages[projectKey]; ok {
+		return l
+	}
+	return s.Language
+}
+
+// ServerConfig configures the HTTP server of the sync service
+type ServerConfig struct {
+	// Addr is the address the server listens on, such as 127.0.0.1:8080;
+	// empty disables the server
+	Addr string `yaml:"addr"`
+	// APIToken is the bearer token of the REST management API; empty
+	// disables the API
+	APIToken string `yaml:"apiToken"`
+	// DebugToken is the bearer token of the /debug/pprof and /debug/state
+	// endpoints; empty disables them
+	DebugToken string `yaml:"debugToken"`
+	// DashboardToken authenticates the dashboard pages, /status.json and
+	// the dashboard actions, as a bearer token or a basic auth password;
+	// empty disables them
+	DashboardToken string `yaml:"dashboardToken"`
+}
+
+// TracingConfig configures the export of OpenTelemetry traces
+type TracingConfig struct {
+	// Endpoint is the base URL of an OTLP/HTTP collector, such as
+	// http://otel-collector:4318. The standard OTEL_EXPORTER_OTLP_*
+	// environment variables work too.
+	Endpoint string `yaml:"endpoint"`
+	// SampleRatio is the fraction of poll cycles traced
+	SampleRatio float64 `yaml:"sampleRatio"`
+}
+
+// AuditConfig configures the audit log
+type AuditConfig struct {
+	// File is the JSONL file every GitHub and Jira change is appended to;
+	// empty disables the audit log
+	File string `yaml:"file"`
+}
+
+// RedactionConfig configures the masking of credentials and personal data
+// in issue titles, bodies and comments
+type RedactionConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Builtins names the built-in pattern sets: tokens, emails and ips
+	Builtins []string `yaml:"builtins"`
+	// Patterns are further regular expressions to mask
+	Patterns []string `yaml:"patterns"`
+	// Replacement is written instead of the masked text
+	Replacement string `yaml:"replacement"`
+}
+
+// SanitizationConfig configures the removal of HTML comments, placeholders
+// and boilerplate left by issue templates from issue bodies
+type SanitizationConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Boilerplate are regular expressions of further lines to remove, such
+	// as the checklist items of an issue template
+	Boilerplate []string `yaml:"boilerplate"`
+	// KeepEmptySections keeps the headings of sections without content
+	KeepEmptySections bool `yaml:"keepEmptySections"`
+}
+
+// HookConfig runs a Go plugin or an external command at stages of each
+// sync
+type HookConfig struct {
+	Name string `yaml:"name"`
+	// Exec is the command run with Args; Plugin the path of a Go plugin
+	Exec   string   `yaml:"exec"`
+	Args   []string `yaml:"args"`
+	Plugin string   `yaml:"plugin"`
+	// Stages are the stages the hook runs at, all if empty
+	Stages []string `yaml:"stages"`
+	// Timeout limits each run of Exec
+	Timeout time.Duration `yaml:"timeout"`
+	// Env names the environment variables passed on to Exec besides PATH
+	// and HOME
+	Env []string `yaml:"env"`
+}
+
+// Source types
+const (
+	SourceGitLab = "gitlab"
+)
+
+// SourceConfig is an issue tracker other than GitHub whose issues are
+// summarized and synced to Jira
+type SourceConfig struct {
+	// Name identifies the source in logs, mappings and its webhook URL
+	Name string `yaml:"name"`
+	// Type is the kind of tracker; only SourceGitLab is supported
+	Type string `yaml:"type"`
+	// BaseURL is the URL of a self-managed instance; empty uses the public
+	// service
+	BaseURL string `yaml:"baseURL"`
+	Token   string `yaml:"token"`
+	// WebhookSecret authenticates webhook deliveries; empty disables the
+	// webhook
+	WebhookSecret string `yaml:"webhookSecret"`
+	// Projects lists the paths of the watched projects, e.g. group/project
+	Projects []string `yaml:"projects"`
+	// Jira names the Jira instance the issues are synced to; empty uses
+	// the main one
+	Jira string `yaml:"jira"`
+}
+
+// Sink types
+const (
+	SinkLinear      = "linear"
+	SinkAzureDevOps = "azureDevOps"
+	SinkYouTrack    = "youtrack"
+)
+
+// SinkConfig is a tracker other than Jira that issues are created in
+type SinkConfig struct {
+	// Name identifies the sink in repositories, mappings and logs
+	Name string `yaml:"name"`
+	// Type is SinkLinear, SinkAzureDevOps or SinkYouTrack
+	Type string `yaml:"type"`
+	// BaseURL is the URL of the API of Linear, of an Azure DevOps Server or
+	// of the YouTrack instance; empty uses the public service, which
+	// YouTrack hasn't
+	BaseURL string `yaml:"baseURL"`
+	Token   string `yaml:"token"`
+	// Team is the key of the Linear team issues are created in
+	Team string `yaml:"team"`
+	// Workspace is the URL key of the Linear workspace, looked up if empty
+	Workspace string `yaml:"workspace"`
+	// Organization and Project are the Azure DevOps project work items are
+	// created in; Project alone is the short name of the YouTrack project
+	Organization string `yaml:"organization"`
+	Project      string `yaml:"project"`
+	// WorkItemType is the type of the created Azure DevOps work items,
+	// Task if empty
+	WorkItemType string `yaml:"workItemType"`
+	// IssueTypes maps the Jira issue types of the payloads to the values of
+	// the Type field of YouTrack issues, e.g. Story: Feature; IssueType is
+	// the value of unmapped types. The project default applies if neither
+	// is set.
+	IssueTypes map[string]string `yaml:"issueTypes"`
+	IssueType  string            `yaml:"issueType"`
+}
+
+// Sink returns the sink of a name
+func (c *Config) Sink(name string) (SinkConfig, bool) {
+	for _, s := range c.Sinks {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return SinkConfig{}, false
+}
+
+// NotificationsConfig configures the chat notifications of created Jira
+// issues, permanently failing syncs and starts and stops of the service
+type NotificationsConfig struct {
+	SlackWebhookURL string `yaml:"slackWebhookURL"`
+	TeamsWebhookURL string `yaml:"teamsWebhookURL"`
+	// Events are the kinds of events posted: created, failed, overdue,
+	// started and stopped; empty posts all of them
+	Events []string `yaml:"events"`
+	// Templates override the Go template of the message of an event kind
+	Templates map[string]string `yaml:"templates"`
+}
+
+// Enabled reports whether a webhook is configured
+func (n NotificationsConfig) Enabled() bool {
+	return n.SlackWebhookURL != "" || n.TeamsWebhookURL != ""
+}
+
+// HTTPConfig holds the proxy and TLS settings applied to the GitHub, Jira,
+// Ollama, Slack and Vault clients
+type HTTPConfig struct {
+	// Proxy is the HTTP(S) proxy URL; empty uses the standard HTTPS_PROXY,
+	// HTTP_PROXY and NO_PROXY environment variables
+	Proxy string `yaml:"proxy"`
+	// NoProxy lists hosts, domains and CIDR ranges reached directly
+	NoProxy string `yaml:"noProxy"`
+	// CAFile is a PEM bundle of internal CAs trusted in addition to the
+	// system ones
+	CAFile string `yaml:"caFile"`
+	// InsecureSkipVerify disables certificate verification; only meant
+	// for testing
+	InsecureSkipVerify bool `yaml:"insecureSkipVerify"`
+	// UserAgent identifies gh-jira in outbound requests; empty uses
+	// "gh-jira/<version>"
+	UserAgent string `yaml:"userAgent"`
+	// Debug logs every outbound request and response with credentials
+	// masked, for troubleshooting rejected API calls
+	Debug bool `yaml:"debug"`
+}
+
+// SecretsConfig configures the secret providers. Secret settings such as
+// github.token may hold a reference like "file:/run/secrets/gh-token" or
+// "vault:secret/data/gh-jira#github_token" instead of the value.
+type SecretsConfig struct {
+	Vault VaultConfig `yaml:"vault"`
+}
+
+// VaultConfig configures the HashiCorp Vault secret provider
+type VaultConfig struct {
+	Address   string `yaml:"address"`
+	Token     string `yaml:"token"`
+	Namespace string `yaml:"namespace"`
+}
+
+// RetryConfig controls the retry queue of failed Jira creations
+type RetryConfig struct {
+	// MaxAttempts is the number of failed creations after which an issue is
+	// marked as permanently failing
+	MaxAttempts int `yaml:"maxAttempts"`
+	// Backoff is the delay before the first retry; it doubles with every
+	// further failure up to MaxBackoff
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"maxBackoff"`
+	// FailedLabel labels GitHub issues that ran out of attempts, which also
+	// get a comment with the error; empty leaves them alone
+	FailedLabel string `yaml:"failedLabel"`
+}
+
+// Delay returns the time to wait before retrying after the given number of
+// failed attempts
+func (r RetryConfig) Delay(attempts int) time.Duration {
+	d := r.Backoff
+	for i := 1; i < attempts && d < r.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > r.MaxBackoff {
+		d = r.MaxBackoff
+	}
+	return d
+}
+
+// PollConfig controls how often GitHub is polled
+type PollConfig struct {
+	// Interval is the base time between two poll cycles
+	Interval time.Duration `yaml:"interval"`
+	// Jitter is the maximum fraction of Interval randomly added to each
+	// wait so that multiple instances don't poll in lockstep
+	Jitter float64 `yaml:"jitter"`
+	// WatchdogMultiplier raises an alert when a poll cycle hasn't completed
+	// within this many intervals; 0 disables the watchdog
+	WatchdogMultiplier int `yaml:"watchdogMultiplier"`
+	// WatchdogRestart cancels a stalled poll loop and starts a new one
+	WatchdogRestart bool `yaml:"watchdogRestart"`
+	// Pipeline sizes the stages issues are synced through
+	Pipeline PipelineConfig `yaml:"pipeline"`
+	// Adaptive lengthens the interval while no new issues are found
+	Adaptive AdaptiveConfig `yaml:"adaptive"`
+}
+
+// AdaptiveConfig backs off the poll interval of quiet repositories. After
+// QuietCycles cycles without new issues the interval is multiplied by
+// Factor after each further quiet cycle, up to MaxInterval, and it returns
+// to the base interval as soon as a cycle finds a new issue.
+type AdaptiveConfig struct {
+	// MaxInterval is the longest interval; 0, or not more than the base
+	// interval, disables the back-off
+	MaxInterval time.Duration `yaml:"maxInterval"`
+	// QuietCycles is the number of cycles without new issues before the
+	// interval grows
+	QuietCycles int `yaml:"quietCycles"`
+	// Factor is what the interval is multiplied with on each back-off
+	Factor float64 `yaml:"factor"`
+}
+
+// AdaptiveEnabled reports whether the poll interval backs off while no new issues
+// are found
+func (p PollConfig) AdaptiveEnabled() bool {
+	return p.Adaptive.MaxInterval > p.Interval
+}
+
+// PipelineConfig sizes the stages of the sync pipeline
+type PipelineConfig struct {
+	// SummarizeWorkers is the number of issues summarized in parallel
+	SummarizeWorkers int `yaml:"summarizeWorkers"`
+	// CreateWorkers is the number of Jira issues created in parallel
+	CreateWorkers int `yaml:"createWorkers"`
+	// QueueSize is the number of issues buffered between two stages
+	QueueSize int `yaml:"queueSize"`
+}
+
+// Default returns a Config populated with default values
+func Default() *Config {
+	return &Config{
+		GitHub: GitHubConfig{
+			RateLimitThreshold:  DefaultRateLimit,
+			SkipLabel:           DefaultSkipLabel,
+			ForceLabel:          DefaultForceLabel,
+			IssueState:          IssuesOpen,
+			Fetch:               FetchGraphQL,
+			ClosedIssues:        ClosedCreate,
+			AutoSync:            true,
+			Command:             DefaultCommand,
+			CommandAssociations: append([]string(nil), DefaultCommandAssociations...),
+			Timeout:             DefaultHTTPTimeout,
+		},
+		Jira: JiraConfig{
+			ProjectKey:          DefaultProjectKey,
+			IssueType:           DefaultIssueType,
+			Timeout:             DefaultHTTPTimeout,
+			SummaryTemplate:     DefaultSummaryTemplate,
+			DescriptionTemplate: DefaultDescriptionTemplate,
+			MarkerLabel:         DefaultMarkerLabel,
+			DescriptionLimit: DescriptionLimitConfig{
+				MaxLength:      DefaultDescriptionLength,
+				AttachFullBody: true,
+			},
+			Development: DevelopmentConfig{
+				Property: DefaultDevProperty,
+			},
+			Epics: EpicsConfig{
+				IssueType: DefaultEpicType,
+				LinkField: DefaultEpicLink,
+			},
+			Subtasks: SubtasksConfig{
+				IssueType: DefaultSubtaskType,
+			},
+			Links: LinksConfig{
+				Type: DefaultLinkType,
+			},
+			Triage: TriageConfig{
+				SLA:     DefaultTriageSLA,
+				JQL:     DefaultTriageJQL,
+				Comment: true,
+			},
+			Releases: ReleasesConfig{
+				Version: DefaultReleaseVersion,
+				Notes:   true,
+			},
+			Comments: CommentsConfig{
+				Direction: CommentsBoth,
+			},
+			Publish: PublishConfig{
+				JQL: DefaultPublishJQL,
+			},
+			Orphans: OrphansConfig{
+				Label:      DefaultOrphanLabel,
+				Transition: TransitionConfig{Name: DefaultOrphanStatus},
+			},
+		},
+		Summarizer: SummarizerConfig{
+			Model:       DefaultModel,
+			Timeout:     DefaultGenTimeout,
+			RealtimeAge: DefaultRealtimeAge,
+			Discussion: DiscussionConfig{
+				MaxComments: DefaultMaxComments,
+				Target:      DiscussionDescription,
+			},
+			Duplicates: DuplicatesConfig{
+				Threshold: DefaultDupThreshold,
+			},
+		},
+		State: StateConfig{
+			LockTTL: DefaultIssueLockTTL,
+		},
+		Leader: LeaderConfig{
+			Backend:       LeaderStore,
+			Name:          DefaultLeaderLock,
+			LeaseDuration: DefaultLeaseTTL,
+		},
+		Preflight: PreflightConfig{
+			Enabled: true,
+			Timeout: DefaultPreflight,
+		},
+		Tracing: TracingConfig{
+			SampleRatio: 1,
+		},
+		Redaction: RedactionConfig{
+			Builtins: []string{"tokens", "emails", "ips"},
+		},
+		Sanitization: SanitizationConfig{
+			Enabled: true,
+		},
+		Poll: PollConfig{
+			Interval:           DefaultPollInterval,
+			Jitter:             DefaultPollJitter,
+			WatchdogMultiplier: DefaultWatchdog,
+			Pipeline: PipelineConfig{
+				SummarizeWorkers: 1,
+				CreateWorkers:    1,
+				QueueSize:        DefaultQueueSize,
+			},
+			Adaptive: AdaptiveConfig{
+				QuietCycles: DefaultQuietCycles,
+				Factor:      DefaultBackoffFactor,
+			},
+		},
+		Retry: RetryConfig{
+			MaxAttempts: DefaultMaxAttempts,
+			Backoff:     DefaultBackoff,
+			MaxBackoff:  DefaultMaxBackoff,
+		},
+	}
+}
+
+// Load builds the configuration from defaults, the YAML file at path (if
+// non-empty) and environment variables, in increasing order of precedence
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		log.Printf("Loading configuration file %s", path)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config file: %w", err)
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// CheckSchema reports the first setting of a YAML configuration file that
+// is unknown or has the wrong type. Load ignores unknown settings.
+func CheckSchema(data []byte) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(Default()); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// JiraUser returns the Jira user mapped to a GitHub login, or "" if the
+// login isn't mapped. Logins are matched case-insensitively.
+func (c *Config) JiraUser(login string) string {
+	if user, ok := c.Users[login]; ok {
+		return user
+	}
+	for l, user := range c.Users {
+		if strings.EqualFold(l, login) {
+			return user
+		}
+	}
+	return ""
+}
+
+// GitHubLogin returns the GitHub login mapped to a Jira user, or "" if the
+// user isn't mapped. Users are matched case-insensitively; of several
+// logins mapped to the same user the first in sort order wins.
+func (c *Config) GitHubLogin(user string) string {
+	var found string
+	for login, u := range c.Users {
+		if strings.EqualFold(u, user) && (found == "" || login < found) {
+			found = login
+		}
+	}
+	return found
+}
+
+// applyEnv overrides settings with values from environment variables
+func (c *Config) applyEnv() error {
+	setString(&c.GitHub.Owner, "GH_OWNER")
+	setString(&c.GitHub.Repo, "GH_REPO")
+	if err := setSecret(&c.GitHub.Token, "GH_TOKEN"); err != nil {
+		return err
+	}
+	if err := setSecret(&c.GitHub.App.PrivateKey, "GH_APP_PRIVATE_KEY"); err != nil {
+		return err
+	}
+	if v := os.Getenv("GH_APP_ID"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid GH_APP_ID %q: %w", v, err)
+		}
+		c.GitHub.App.AppID = n
+	}
+	if v := os.Getenv("GH_APP_INSTALLATION_ID"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid GH_APP_INSTALLATION_ID %q: %w", v, err)
+		}
+		c.GitHub.App.InstallationID = n
+	}
+	setString(&c.GitHub.BaseURL, "GH_BASE_URL")
+	setString(&c.GitHub.UploadURL, "GH_UPLOAD_URL")
+	setString(&c.GitHub.CAFile, "GH_CA_FILE")
+	setString(&c.GitHub.Org.Name, "GH_ORG")
+	setString(&c.GitHub.Backlink, "GH_BACKLINK")
+	setString(&c.GitHub.SkipLabel, "GH_SKIP_LABEL")
+	setString(&c.GitHub.ForceLabel, "GH_FORCE_LABEL")
+	setString(&c.GitHub.IssueState, "GH_ISSUE_STATE")
+	setString(&c.GitHub.Fetch, "GH_FETCH")
+	setString(&c.GitHub.ClosedIssues, "GH_CLOSED_ISSUES")
+	setString(&c.GitHub.ClosedResolution, "GH_CLOSED_RESOLUTION")
+	setString(&c.GitHub.Command, "GH_COMMAND")
+	if v := os.Getenv("GH_COMMAND_ASSOCIATIONS"); v != "" {
+		c.GitHub.CommandAssociations = strings.FieldsFunc(strings.ToUpper(v), func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	setString(&c.GitHub.SyncedLabel, "GH_SYNCED_LABEL")
+	setString(&c.GitHub.Filter.Expr, "GH_FILTER")
+	if err := setBool(&c.GitHub.Discussions.Enabled, "GH_DISCUSSIONS"); err != nil {
+		return err
+	}
+	if v := os.Getenv("GH_DISCUSSION_CATEGORIES"); v != "" {
+		c.GitHub.Discussions.Categories = strings.Split(v, ",")
+		for i, cat := range c.GitHub.Discussions.Categories {
+			c.GitHub.Discussions.Categories[i] = strings.TrimSpace(cat)
+		}
+	}
+	if v := os.Getenv("GH_FILTER_AUTHORS"); v != "" {
+		c.GitHub.Filter.Authors = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	if v := os.Getenv("GH_FILTER_EXCLUDE_AUTHORS"); v != "" {
+		c.GitHub.Filter.ExcludeAuthors = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	if err := setBool(&c.GitHub.AutoSync, "GH_AUTO_SYNC"); err != nil {
+		return err
+	}
+	if err := setBool(&c.GitHub.KeyInTitle, "GH_KEY_IN_TITLE"); err != nil {
+		return err
+	}
+	if err := setSecret(&c.Jira.Username, "JIRA_USERNAME"); err != nil {
+		return err
+	}
+	if err := setSecret(&c.Jira.APIToken, "JIRA_API_TOKEN"); err != nil {
+		return err
+	}
+	setString(&c.Jira.OAuth.ClientID, "JIRA_OAUTH_CLIENT_ID")
+	setString(&c.Jira.OAuth.TokenURL, "JIRA_OAUTH_TOKEN_URL")
+	setString(&c.Jira.OAuth.CloudID, "JIRA_CLOUD_ID")
+	if err := setSecret(&c.Jira.OAuth.ClientSecret, "JIRA_OAUTH_CLIENT_SECRET"); err != nil {
+		return err
+	}
+	if err := setSecret(&c.Jira.OAuth.RefreshToken, "JIRA_OAUTH_REFRESH_TOKEN"); err != nil {
+		return err
+	}
+	if v := os.Getenv("JIRA_OAUTH_SCOPES"); v != "" {
+		c.Jira.OAuth.Scopes = strings.Fields(v)
+	}
+	setString(&c.Jira.BaseURL, "JIRA_BASE_URL")
+	setString(&c.Jira.Deployment, "JIRA_DEPLOYMENT")
+	setString(&c.Jira.SummaryTemplate, "JIRA_SUMMARY_TEMPLATE")
+	setString(&c.Jira.DescriptionTemplate, "JIRA_DESCRIPTION_TEMPLATE")
+	if v := os.Getenv("JIRA_DESCRIPTION_MAX_LENGTH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid JIRA_DESCRIPTION_MAX_LENGTH %q: %w", v, err)
+		}
+		c.Jira.DescriptionLimit.MaxLength = n
+	}
+	if err := setBool(&c.Jira.DescriptionLimit.AttachFullBody, "JIRA_ATTACH_FULL_BODY"); err != nil {
+		return err
+	}
+	if err := setBool(&c.Jira.FieldSync.Enabled, "JIRA_FIELD_SYNC"); err != nil {
+		return err
+	}
+	setString(&c.Jira.FieldSync.MilestoneField, "JIRA_MILESTONE_FIELD")
+	if err := setBool(&c.Jira.AttachIssueJSON, "JIRA_ATTACH_ISSUE_JSON"); err != nil {
+		return err
+	}
+	if err := setBool(&c.Jira.Epics.Enabled, "JIRA_EPICS"); err != nil {
+		return err
+	}
+	setString(&c.Jira.Epics.LinkField, "JIRA_EPIC_LINK_FIELD")
+	setString(&c.Jira.Epics.NameField, "JIRA_EPIC_NAME_FIELD")
+	if err := setBool(&c.Jira.Subtasks.Enabled, "JIRA_SUBTASKS"); err != nil {
+		return err
+	}
+	setString(&c.Jira.Subtasks.IssueType, "JIRA_SUBTASK_TYPE")
+	setString(&c.Jira.Subtasks.Resolution, "JIRA_SUBTASK_RESOLUTION")
+	if err := setBool(&c.Jira.Links.Enabled, "JIRA_LINKS"); err != nil {
+		return err
+	}
+	setString(&c.Jira.Links.Type, "JIRA_LINK_TYPE")
+	if err := setBool(&c.Jira.PullRequests.Enabled, "JIRA_PULL_REQUESTS"); err != nil {
+		return err
+	}
+	setString(&c.Jira.PullRequests.Transition.Name, "JIRA_PULL_REQUEST_TRANSITION")
+	if err := setBool(&c.Jira.Development.Enabled, "JIRA_DEVELOPMENT"); err != nil {
+		return err
+	}
+	setString(&c.Jira.Development.Property, "JIRA_DEVELOPMENT_PROPERTY")
+	if err := setBool(&c.Jira.Reactions.Enabled, "JIRA_REACTIONS"); err != nil {
+		return err
+	}
+	setString(&c.Jira.Reactions.Field, "JIRA_REACTIONS_FIELD")
+	if v := os.Getenv("JIRA_REACTIONS_THRESHOLD"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid JIRA_REACTIONS_THRESHOLD %q: %w", v, err)
+		}
+		c.Jira.Reactions.Threshold = n
+	}
+	setString(&c.Jira.Reactions.Priority, "JIRA_REACTIONS_PRIORITY")
+	if err := setBool(&c.Jira.Triage.Enabled, "JIRA_TRIAGE"); err != nil {
+		return err
+	}
+	if v := os.Getenv("JIRA_TRIAGE_SLA"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid JIRA_TRIAGE_SLA %q: %w", v, err)
+		}
+		c.Jira.Triage.SLA = d
+	}
+	setString(&c.Jira.Triage.JQL, "JIRA_TRIAGE_JQL")
+	if err := setBool(&c.Jira.Triage.Comment, "JIRA_TRIAGE_COMMENT"); err != nil {
+		return err
+	}
+	if err := setBool(&c.Jira.Sprints.Enabled, "JIRA_SPRINTS"); err != nil {
+		return err
+	}
+	if v := os.Getenv("JIRA_SPRINT_BOARD"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid JIRA_SPRINT_BOARD %q: %w", v, err)
+		}
+		c.Jira.Sprints.Board = n
+	}
+	if err := setBool(&c.Jira.Releases.Enabled, "JIRA_RELEASES"); err != nil {
+		return err
+	}
+	setString(&c.Jira.Releases.Version, "JIRA_RELEASE_VERSION")
+	if err := setBool(&c.Jira.Releases.Notes, "JIRA_RELEASE_NOTES"); err != nil {
+		return err
+	}
+	setString(&c.Jira.Transitions.Closed.Name, "JIRA_TRANSITION_CLOSED")
+	setString(&c.Jira.Transitions.NotPlanned.Name, "JIRA_TRANSITION_NOT_PLANNED")
+	setString(&c.Jira.Transitions.Reopened.Name, "JIRA_TRANSITION_REOPENED")
+	if err := setBool(&c.Jira.Comments.Enabled, "JIRA_COMMENTS"); err != nil {
+		return err
+	}
+	setString(&c.Jira.Comments.Direction, "JIRA_COMMENTS_DIRECTION")
+	if err := setBool(&c.Jira.Publish.Enabled, "JIRA_PUBLISH"); err != nil {
+		return err
+	}
+	setString(&c.Jira.Publish.JQL, "JIRA_PUBLISH_JQL")
+	setString(&c.Jira.Publish.Repo, "JIRA_PUBLISH_REPO")
+	if v := os.Getenv("JIRA_PUBLISH_LABELS"); v != "" {
+		c.Jira.Publish.Labels = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	if v := os.Getenv("JIRA_ORPHAN_ACTIONS"); v != "" {
+		c.Jira.Orphans.Actions = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	setString(&c.Jira.Orphans.Label, "JIRA_ORPHAN_LABEL")
+	setString(&c.Jira.Orphans.Transition.Name, "JIRA_ORPHAN_TRANSITION")
+	setString(&c.Jira.MarkerLabel, "JIRA_MARKER_LABEL")
+	setString(&c.Jira.ProjectKey, "JIRA_PROJECT_KEY")
+	setString(&c.Jira.IssueType, "JIRA_ISSUE_TYPE")
+	setString(&c.RulesFile, "RULES_FILE")
+	setString(&c.State.Backend, "STATE_BACKEND")
+	setString(&c.State.DSN, "STATE_DSN")
+	if err := setBool(&c.State.Reporting, "STATE_REPORTING"); err != nil {
+		return err
+	}
+	if err := setBool(&c.Leader.Enabled, "LEADER_ELECTION"); err != nil {
+		return err
+	}
+	setString(&c.Leader.Backend, "LEADER_BACKEND")
+	if err := setBool(&c.Preflight.Enabled, "PREFLIGHT"); err != nil {
+		return err
+	}
+	setString(&c.Leader.Name, "LEADER_NAME")
+	setString(&c.Leader.Namespace, "LEADER_NAMESPACE")
+	setString(&c.Leader.Identity, "LEADER_IDENTITY")
+	if err := setSecret(&c.Approval.SlackWebhookURL, "APPROVAL_SLACK_WEBHOOK_URL"); err != nil {
+		return err
+	}
+	if err := setSecret(&c.Notifications.SlackWebhookURL, "NOTIFY_SLACK_WEBHOOK_URL"); err != nil {
+		return err
+	}
+	if err := setSecret(&c.Notifications.TeamsWebhookURL, "NOTIFY_TEAMS_WEBHOOK_URL"); err != nil {
+		return err
+	}
+	if v := os.Getenv("NOTIFY_EVENTS"); v != "" {
+		c.Notifications.Events = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	setString(&c.HTTP.Proxy, "GH_JIRA_PROXY")
+	setString(&c.HTTP.NoProxy, "GH_JIRA_NO_PROXY")
+	setString(&c.HTTP.CAFile, "GH_JIRA_CA_FILE")
+	if err := setBool(&c.HTTP.InsecureSkipVerify, "GH_JIRA_INSECURE_SKIP_VERIFY"); err != nil {
+		return err
+	}
+	setString(&c.HTTP.UserAgent, "GH_JIRA_USER_AGENT")
+	if err := setBool(&c.HTTP.Debug, "GH_JIRA_HTTP_DEBUG"); err != nil {
+		return err
+	}
+	setString(&c.Server.Addr, "SERVER_ADDR")
+	if err := setSecret(&c.Server.APIToken, "SERVER_API_TOKEN"); err != nil {
+		return err
+	}
+	if err := setSecret(&c.Server.DebugToken, "SERVER_DEBUG_TOKEN"); err != nil {
+		return err
+	}
+	if err := setSecret(&c.Server.DashboardToken, "SERVER_DASHBOARD_TOKEN"); err != nil {
+		return err
+	}
+	setString(&c.Secrets.Vault.Address, "VAULT_ADDR")
+	setString(&c.Secrets.Vault.Namespace, "VAULT_NAMESPACE")
+	if err := setSecret(&c.Secrets.Vault.Token, "VAULT_TOKEN"); err != nil {
+		return err
+	}
+	if err := setBool(&c.Approval.Required, "APPROVAL_REQUIRED"); err != nil {
+		return err
+	}
+
+	if v := os.Getenv("GH_RATE_LIMIT_THRESHOLD"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid GH_RATE_LIMIT_THRESHOLD %q: %w", v, err)
+		}
+		c.GitHub.RateLimitThreshold = n
+	}
+	if v := os.Getenv("POLL_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid POLL_INTERVAL %q: %w", v, err)
+		}
+		c.Poll.Interval = d
+	}
+	if v := os.Getenv("WATCHDOG_MULTIPLIER"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid WATCHDOG_MULTIPLIER %q: %w", v, err)
+		}
+		c.Poll.WatchdogMultiplier = n
+	}
+	if err := setBool(&c.Poll.WatchdogRestart, "WATCHDOG_RESTART"); err != nil {
+		return err
+	}
+	for _, t := range []struct {
+		env string
+		dst *int
+	}{
+		{"POLL_SUMMARIZE_WORKERS", &c.Poll.Pipeline.SummarizeWorkers},
+		{"POLL_CREATE_WORKERS", &c.Poll.Pipeline.CreateWorkers},
+		{"POLL_QUEUE_SIZE", &c.Poll.Pipeline.QueueSize},
+		{"POLL_QUIET_CYCLES", &c.Poll.Adaptive.QuietCycles},
+	} {
+		if v := os.Getenv(t.env); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q: %w", t.env, v, err)
+			}
+			*t.dst = n
+		}
+	}
+	setString(&c.Tracing.Endpoint, "TRACING_ENDPOINT")
+	setString(&c.Audit.File, "AUDIT_FILE")
+	if err := setBool(&c.Redaction.Enabled, "REDACTION"); err != nil {
+		return err
+	}
+	if v := os.Getenv("REDACTION_BUILTINS"); v != "" {
+		c.Redaction.Builtins = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	setString(&c.Redaction.Replacement, "REDACTION_REPLACEMENT")
+	if err := setBool(&c.Sanitization.Enabled, "SANITIZATION"); err != nil {
+		return err
+	}
+	if v := os.Getenv("TRACING_SAMPLE_RATIO"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid TRACING_SAMPLE_RATIO %q: %w", v, err)
+		}
+		c.Tracing.SampleRatio = f
+	}
+	if v := os.Getenv("POLL_JITTER"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid POLL_JITTER %q: %w", v, err)
+		}
+		c.Poll.Jitter = f
+	}
+	if v := os.Getenv("POLL_BACKOFF_FACTOR"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid POLL_BACKOFF_FACTOR %q: %w", v, err)
+		}
+		c.Poll.Adaptive.Factor = f
+	}
+	for _, t := range []struct {
+		env string
+		dst *time.Duration
+	}{
+		{"GH_TIMEOUT", &c.GitHub.Timeout},
+		{"JIRA_TIMEOUT", &c.Jira.Timeout},
+		{"SUMMARIZER_TIMEOUT", &c.Summarizer.Timeout},
+		{"SUMMARIZER_REALTIME_AGE", &c.Summarizer.RealtimeAge},
+		{"SUMMARIZER_REFRESH_MAX_AGE", &c.Summarizer.Refresh.MaxAge},
+		{"LEADER_LEASE_DURATION", &c.Leader.LeaseDuration},
+		{"PREFLIGHT_TIMEOUT", &c.Preflight.Timeout},
+		{"STATE_LOCK_TTL", &c.State.LockTTL},
+		{"POLL_MAX_INTERVAL", &c.Poll.Adaptive.MaxInterval},
+	} {
+		if v := os.Getenv(t.env); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q: %w", t.env, v, err)
+			}
+			*t.dst = d
+		}
+	}
+	setString(&c.Summarizer.Model, "SUMMARIZER_MODEL")
+	if v := os.Getenv("SUMMARIZER_FALLBACK_MODELS"); v != "" {
+		c.Summarizer.Fallbacks = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	if err := setBool(&c.Summarizer.AutoPull, "SUMMARIZER_AUTO_PULL"); err != nil {
+		return err
+	}
+	setString(&c.Summarizer.Language, "SUMMARIZER_LANGUAGE")
+	if v := os.Getenv("SUMMARIZER_MAX_LENGTH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid SUMMARIZER_MAX_LENGTH %q: %w", v, err)
+		}
+		c.Summarizer.MaxLength = n
+	}
+	if v := os.Getenv("SUMMARIZER_MAX_TOKENS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid SUMMARIZER_MAX_TOKENS %q: %w", v, err)
+		}
+		c.Summarizer.MaxTokens = n
+	}
+	if v := os.Getenv("SUMMARIZER_CONCURRENCY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid SUMMARIZER_CONCURRENCY %q: %w", v, err)
+		}
+		c.Summarizer.Concurrency = n
+	}
+	if v := os.Getenv("SUMMARIZER_DISCUSSION_MIN_COMMENTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid SUMMARIZER_DISCUSSION_MIN_COMMENTS %q: %w", v, err)
+		}
+		c.Summarizer.Discussion.MinComments = n
+	}
+	setString(&c.Summarizer.Discussion.Target, "SUMMARIZER_DISCUSSION_TARGET")
+	if v := os.Getenv("SUMMARIZER_REFRESH_NEW_COMMENTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid SUMMARIZER_REFRESH_NEW_COMMENTS %q: %w", v, err)
+		}
+		c.Summarizer.Refresh.NewComments = n
+	}
+	if err := setBool(&c.Summarizer.Enrichment.Enabled, "SUMMARIZER_ENRICHMENT"); err != nil {
+		return err
+	}
+	setString(&c.Summarizer.Enrichment.AcceptanceCriteriaField, "JIRA_ACCEPTANCE_CRITERIA_FIELD")
+	setString(&c.Summarizer.Enrichment.StoryPointsField, "JIRA_STORY_POINTS_FIELD")
+	if err := setBool(&c.Summarizer.Duplicates.Enabled, "SUMMARIZER_DUPLICATES"); err != nil {
+		return err
+	}
+	if v := os.Getenv("SUMMARIZER_DUPLICATE_THRESHOLD"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid SUMMARIZER_DUPLICATE_THRESHOLD %q: %w", v, err)
+		}
+		c.Summarizer.Duplicates.Threshold = f
+	}
+	setString(&c.Summarizer.Duplicates.EmbeddingModel, "SUMMARIZER_EMBEDDING_MODEL")
+	if v := os.Getenv("RETRY_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid RETRY_MAX_ATTEMPTS %q: %w", v, err)
+		}
+		c.Retry.MaxAttempts = n
+	}
+	if v := os.Getenv("RETRY_BACKOFF"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid RETRY_BACKOFF %q: %w", v, err)
+		}
+		c.Retry.Backoff = d
+	}
+	if v := os.Getenv("RETRY_MAX_BACKOFF"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid RETRY_MAX_BACKOFF %q: %w", v, err)
+		}
+		c.Retry.MaxBackoff = d
+	}
+	setString(&c.Retry.FailedLabel, "RETRY_FAILED_LABEL")
+	return nil
+}
+
+// ResolveSecrets replaces secret references in the secret settings with the
+// secrets they refer to. It must be called before the secrets are used.
+func (c *Config) ResolveSecrets(ctx context.Context) error {
+	token, err := secrets.Resolve(ctx, c.Secrets.Vault.Token)
+	if err != nil {
+		return fmt.Errorf("secrets.vault.token: %w", err)
+	}
+	secrets.Register("vault", &secrets.Vault{
+		Address:   c.Secrets.Vault.Address,
+		Token:     token,
+		Namespace: c.Secrets.Vault.Namespace,
+	})
+
+	type setting struct {
+		name  string
+		value *string
+	}
+	settings := []setting{
+		{"github.token", &c.GitHub.Token},
+		{"github.app.privateKey", &c.GitHub.App.PrivateKey},
+		{"jira.username", &c.Jira.Username},
+		{"jira.apiToken", &c.Jira.APIToken},
+		{"jira.oauth.clientSecret", &c.Jira.OAuth.ClientSecret},
+		{"jira.oauth.refreshToken", &c.Jira.OAuth.RefreshToken},
+		{"approval.slackWebhookURL", &c.Approval.SlackWebhookURL},
+		{"notifications.slackWebhookURL", &c.Notifications.SlackWebhookURL},
+		{"notifications.teamsWebhookURL", &c.Notifications.TeamsWebhookURL},
+		{"server.apiToken", &c.Server.APIToken},
+		{"server.debugToken", &c.Server.DebugToken},
+	}
+	for i := range c.Sources {
+		src := &c.Sources[i]
+		settings = append(settings,
+			setting{"sources." + src.Name + ".token", &src.Token},
+			setting{"sources." + src.Name + ".webhookSecret", &src.WebhookSecret})
+	}
+	for i := range c.Sinks {
+		sink := &c.Sinks[i]
+		settings = append(settings, setting{"sinks." + sink.Name + ".token", &sink.Token})
+	}
+	for i := range c.Jira.Instances {
+		inst := &c.Jira.Instances[i]
+		settings = append(settings,
+			setting{"jira.instances." + inst.Name + ".username", &inst.Username},
+			setting{"jira.instances." + inst.Name + ".apiToken", &inst.APIToken})
+	}
+	for _, s := range settings {
+		if !secrets.IsReference(*s.value) {
+			continue
+		}
+		scheme, _, _ := strings.Cut(*s.value, ":")
+		v, err := secrets.Resolve(ctx, *s.value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.name, err)
+		}
+		log.Printf("Resolved %s from %s", s.name, scheme)
+		*s.value = v
+	}
+	return nil
+}
+
+// Validate checks that all required settings are present and consistent
+func (c *Config) Validate() error {
+	required := []struct{ name, value string }{
+		{"JIRA_BASE_URL", c.Jira.BaseURL},
+	}
+	if c.Jira.OAuth.Enabled() {
+		required = append(required,
+			struct{ name, value string }{"JIRA_OAUTH_CLIENT_SECRET", c.Jira.OAuth.ClientSecret})
+	} else if c.Jira.DeploymentType() == "server" {
+		// A personal access token needs no username
+		required = append(required,
+			struct{ name, value string }{"JIRA_API_TOKEN", c.Jira.APIToken})
+	} else {
+		required = append(required,
+			struct{ name, value string }{"JIRA_USERNAME", c.Jira.Username},
+			struct{ name, value string }{"JIRA_API_TOKEN", c.Jira.APIToken})
+	}
+	// Only syncing other sources needs no GitHub settings
+	gitHubUsed := len(c.Sources) == 0 || len(c.GitHub.Repos) > 0 || c.GitHub.Org.Name != "" || c.GitHub.Owner != "" || c.GitHub.Repo != ""
+	switch {
+	case !gitHubUsed && !c.Jira.Publish.Enabled:
+	case c.GitHub.App.Enabled():
+		required = append(required,
+			struct{ name, value string }{"GH_APP_PRIVATE_KEY", c.GitHub.App.PrivateKey})
+		if c.GitHub.App.InstallationID == 0 {
+			required = append(required, struct{ name, value string }{"GH_APP_INSTALLATION_ID", ""})
+		}
+	default:
+		required = append(required, struct{ name, value string }{"GH_TOKEN", c.GitHub.Token})
+	}
+	if gitHubUsed && len(c.GitHub.Repos) == 0 && c.GitHub.Org.Name == "" {
+		required = append(required,
+			struct{ name, value string }{"GH_OWNER", c.GitHub.Owner},
+			struct{ name, value string }{"GH_REPO", c.GitHub.Repo})
+	}
+	var missing []string
+	for _, r := range required {
+		if r.value == "" {
+			missing = append(missing, r.name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required settings: %s", strings.Join(missing, ", "))
+	}
+
+	for _, r := range c.GitHub.Repos {
+		if r.Owner == "" || r.Name == "" {
+			return fmt.Errorf("watched repositories need both owner and name, got %q", r.FullName())
+		}
+		for label, issueType := range r.IssueTypes {
+			if issueType == "" {
+				return fmt.Errorf("repository %s maps label %q to an empty issue type", r.FullName(), label)
+			}
+		}
+		switch r.Security.Backlink {
+		case "", "comment", "body", "none":
+		default:
+			return fmt.Errorf("invalid backlink mode %q of repository %s, must be comment, body or none", r.Security.Backlink, r.FullName())
+		}
+		if r.Filter != "" {
+			if _, err := filter.Parse(r.Filter); err != nil {
+				return fmt.Errorf("invalid filter of repository %s: %w", r.FullName(), err)
+			}
+		}
+	}
+	for _, a := range c.GitHub.CommandAssociations {
+		if !commandAssociations[strings.ToUpper(a)] {
+			return fmt.Errorf("invalid command author association %q", a)
+		}
+	}
+	if c.GitHub.Filter.Expr != "" {
+		if _, err := filter.Parse(c.GitHub.Filter.Expr); err != nil {
+			return fmt.Errorf("invalid GitHub filter: %w", err)
+		}
+	}
+	if c.GitHub.BaseURL != "" {
+		if u, err := url.Parse(c.GitHub.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid GitHub base URL %q", c.GitHub.BaseURL)
+		}
+	}
+	switch c.GitHub.Backlink {
+	case "", "comment", "body", "none":
+	default:
+		return fmt.Errorf("invalid backlink mode %q, must be comment, body or none", c.GitHub.Backlink)
+	}
+	if strings.ContainsAny(c.Jira.MarkerLabel, " \t") {
+		return fmt.Errorf("invalid Jira marker label %q, labels can't contain spaces", c.Jira.MarkerLabel)
+	}
+	if strings.TrimSpace(c.Jira.SummaryTemplate) == "" || strings.TrimSpace(c.Jira.DescriptionTemplate) == "" {
+		return fmt.Errorf("the Jira summary and description templates must not be empty")
+	}
+	switch c.GitHub.IssueState {
+	case IssuesOpen, IssuesClosed, IssuesAll:
+	default:
+		return fmt.Errorf("invalid issue state %q, must be open, closed or all", c.GitHub.IssueState)
+	}
+	switch c.GitHub.Fetch {
+	case FetchGraphQL, FetchREST:
+	default:
+		return fmt.Errorf("invalid fetch mode %q, must be graphql or rest", c.GitHub.Fetch)
+	}
+	switch c.GitHub.ClosedIssues {
+	case ClosedCreate, ClosedDone, ClosedSkip:
+	default:
+		return fmt.Errorf("invalid closed issue policy %q, must be create, done or skip", c.GitHub.ClosedIssues)
+	}
+	if c.GitHub.Org.NamePattern != "" {
+		if _, err := regexp.Compile(c.GitHub.Org.NamePattern); err != nil {
+			return fmt.Errorf("invalid org name pattern: %w", err)
+		}
+	}
+	switch c.Jira.Deployment {
+	case "", "cloud", "server":
+	default:
+		return fmt.Errorf("invalid Jira deployment %q, must be cloud or server", c.Jira.Deployment)
+	}
+	if c.Jira.OAuth.CloudID != "" && c.Jira.DeploymentType() == "server" {
+		return fmt.Errorf("a Jira cloud ID only applies to Jira Cloud")
+	}
+	if c.Jira.Epics.Enabled && (c.Jira.Epics.IssueType == "" || c.Jira.Epics.LinkField == "") {
+		return fmt.Errorf("Jira epics need an issue type and a link field")
+	}
+	if c.Jira.Subtasks.Enabled && c.Jira.Subtasks.IssueType == "" {
+		return fmt.Errorf("Jira subtasks need an issue type")
+	}
+	if c.Jira.Development.Enabled && c.Jira.Development.Property == "" {
+		return fmt.Errorf("the development issue property needs a key")
+	}
+	if c.Jira.Links.Enabled && c.Jira.Links.Type == "" {
+		return fmt.Errorf("Jira links need a link type")
+	}
+	if r := c.Jira.Reactions; r.Enabled {
+		if r.Threshold < 0 {
+			return fmt.Errorf("the reaction threshold must not be negative")
+		}
+		if r.Threshold > 0 && r.Priority == "" {
+			return fmt.Errorf("a reaction threshold needs a Jira priority")
+		}
+		if r.Field == "" && r.Threshold == 0 {
+			return fmt.Errorf("Jira reactions need a field or a threshold")
+		}
+	}
+	if t := c.Jira.Triage; t.Enabled && t.SLA < time.Minute {
+		return fmt.Errorf("the triage SLA must be at least a minute")
+	}
+	if sp := c.Jira.Sprints; sp.Enabled {
+		if sp.Board == 0 && len(sp.Boards) == 0 {
+			return fmt.Errorf("Jira sprints need a board")
+		}
+		for project, id := range sp.Boards {
+			if id <= 0 {
+				return fmt.Errorf("invalid board %d of Jira project %s", id, project)
+			}
+		}
+		if sp.Board < 0 {
+			return fmt.Errorf("invalid board %d", sp.Board)
+		}
+	}
+	if r := c.Jira.Releases; r.Enabled && !strings.Contains(r.Version, "{tag}") && !strings.Contains(r.Version, "{version}") {
+		return fmt.Errorf("the Jira version of releases must contain {tag} or {version}")
+	}
+	if cc := c.Jira.Comments; cc.Enabled {
+		switch cc.Direction {
+		case CommentsBoth, CommentsToJira, CommentsToGitHub:
+		default:
+			return fmt.Errorf("invalid comment direction %q, expected %s, %s or %s",
+				cc.Direction, CommentsBoth, CommentsToJira, CommentsToGitHub)
+		}
+	}
+	if p := c.Jira.Publish; p.Enabled {
+		if p.JQL == "" {
+			return fmt.Errorf("publishing Jira issues needs a JQL query")
+		}
+		if p.Repo != "" {
+			if owner, name, ok := strings.Cut(p.Repo, "/"); !ok || owner == "" || name == "" {
+				return fmt.Errorf("invalid publish repository %q, expected owner/name", p.Repo)
+			}
+		}
+	}
+	if o := c.Jira.Orphans; len(o.Actions) > 0 {
+		for _, a := range o.Actions {
+			switch a {
+			case OrphanComment, OrphanLabel, OrphanTransition, OrphanDelete:
+			default:
+				return fmt.Errorf("invalid orphan action %q, expected %s, %s, %s or %s",
+					a, OrphanComment, OrphanLabel, OrphanTransition, OrphanDelete)
+			}
+		}
+		if o.Has(OrphanDelete) && len(o.Actions) > 1 {
+			return fmt.Errorf("the orphan action %s cannot be combined with other actions", OrphanDelete)
+		}
+		if o.Has(OrphanLabel) && o.Label == "" {
+			return fmt.Errorf("the orphan action %s needs a label", OrphanLabel)
+		}
+		if o.Has(OrphanTransition) && o.Transition.Name == "" {
+			return fmt.Errorf("the orphan action %s needs a transition", OrphanTransition)
+		}
+	}
+	for login, user := range c.Users {
+		if login == "" || user == "" {
+			return fmt.Errorf("invalid user mapping %q: %q", login, user)
+		}
+	}
+	names := make(map[string]bool)
+	for i, inst := range c.Jira.Instances {
+		if inst.Name == "" || inst.BaseURL == "" || inst.APIToken == "" {
+			return fmt.Errorf("Jira instance %d needs a name, baseURL and apiToken", i+1)
+		}
+		if names[inst.Name] {
+			return fmt.Errorf("duplicate Jira instance %q", inst.Name)
+		}
+		names[inst.Name] = true
+		switch inst.Deployment {
+		case "", "cloud", "server":
+		default:
+			return fmt.Errorf("invalid deployment %q of Jira instance %q, must be cloud or server", inst.Deployment, inst.Name)
+		}
+		if inst.Username == "" && inst.Connection(c.Jira).DeploymentType() == "cloud" {
+			return fmt.Errorf("Jira instance %q needs a username, Jira Cloud has no personal access tokens", inst.Name)
+		}
+	}
+	for i, r := range c.Jira.Routes {
+		if r.Label == "" || r.ProjectKey == "" {
+			return fmt.Errorf("Jira route %d needs both a label and a projectKey", i+1)
+		}
+		if r.Instance != "" && !names[r.Instance] {
+			return fmt.Errorf("Jira route %d uses unknown Jira instance %q", i+1, r.Instance)
+		}
+	}
+	for i, h := range c.Hooks {
+		if h.Name == "" {
+			return fmt.Errorf("hook %d needs a name", i+1)
+		}
+		if (h.Exec == "") == (h.Plugin == "") {
+			return fmt.Errorf("hook %s needs either exec or plugin", h.Name)
+		}
+		for _, stage := range h.Stages {
+			if !slices.Contains(hooks.Stages, stage) {
+				return fmt.Errorf("invalid stage %q of hook %s, must be one of %s", stage, h.Name, strings.Join(hooks.Stages, ", "))
+			}
+		}
+	}
+	for i, f := range c.Jira.FormFields {
+		if f.Heading == "" || f.Field == "" {
+			return fmt.Errorf("Jira form field %d needs both a heading and a field", i+1)
+		}
+		switch f.Type {
+		case "", FormText, FormOption, FormNumber, FormLabels:
+		default:
+			return fmt.Errorf("invalid type %q of Jira form field %q, must be text, option, number or labels", f.Type, f.Heading)
+		}
+	}
+	for _, r := range c.GitHub.Repos {
+		if r.Jira != "" && !names[r.Jira] {
+			return fmt.Errorf("repository %s uses unknown Jira instance %q", r.FullName(), r.Jira)
+		}
+	}
+	if c.GitHub.Org.Jira != "" && !names[c.GitHub.Org.Jira] {
+		return fmt.Errorf("organization %s uses unknown Jira instance %q", c.GitHub.Org.Name, c.GitHub.Org.Jira)
+	}
+	sources := make(map[string]bool, len(c.Sources))
+	for i, src := range c.Sources {
+		switch {
+		case src.Name == "":
+			return fmt.Errorf("source %d needs a name", i+1)
+		case strings.ContainsAny(src.Name, ":/"):
+			return fmt.Errorf("source name %q must not contain : or /", src.Name)
+		case sources[src.Name]:
+			return fmt.Errorf("duplicate source %q", src.Name)
+		case src.Type != SourceGitLab:
+			return fmt.Errorf("invalid type %q of source %s, must be gitlab", src.Type, src.Name)
+		case src.Token == "":
+			return fmt.Errorf("source %s needs a token", src.Name)
+		case len(src.Projects) == 0:
+			return fmt.Errorf("source %s needs at least one project", src.Name)
+		case src.Jira != "" && !names[src.Jira]:
+			return fmt.Errorf("source %s uses unknown Jira instance %q", src.Name, src.Jira)
+		}
+		sources[src.Name] = true
+		if src.BaseURL != "" {
+			if u, err := url.Parse(src.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+				return fmt.Errorf("invalid base URL %q of source %s", src.BaseURL, src.Name)
+			}
+		}
+		for _, p := range src.Projects {
+			if !strings.Contains(p, "/") {
+				return fmt.Errorf("invalid project %q of source %s, expected group/project", p, src.Name)
+			}
+		}
+	}
+	sinks := make(map[string]bool, len(c.Sinks))
+	for i, sink := range c.Sinks {
+		switch {
+		case sink.Name == "":
+			return fmt.Errorf("sink %d needs a name", i+1)
+		case sinks[sink.Name] || names[sink.Name]:
+			return fmt.Errorf("duplicate sink %q, sink names must differ from each other and from Jira instance names", sink.Name)
+		case sink.Token == "":
+			return fmt.Errorf("sink %s needs a token", sink.Name)
+		}
+		sinks[sink.Name] = true
+		switch sink.Type {
+		case SinkLinear:
+			if sink.Team == "" {
+				return fmt.Errorf("Linear sink %s needs a team", sink.Name)
+			}
+		case SinkAzureDevOps:
+			if sink.Organization == "" || sink.Project == "" {
+				return fmt.Errorf("Azure DevOps sink %s needs an organization and a project", sink.Name)
+			}
+		case SinkYouTrack:
+			if sink.BaseURL == "" || sink.Project == "" {
+				return fmt.Errorf("YouTrack sink %s needs a baseURL and a project", sink.Name)
+			}
+		default:
+			return fmt.Errorf("invalid type %q of sink %s, must be %s, %s or %s", sink.Type, sink.Name, SinkLinear, SinkAzureDevOps, SinkYouTrack)
+		}
+		if sink.BaseURL != "" {
+			if u, err := url.Parse(sink.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+				return fmt.Errorf("invalid base URL %q of sink %s", sink.BaseURL, sink.Name)
+			}
+		}
+	}
+	for _, r := range c.GitHub.Repos {
+		if r.Sink != "" && !sinks[r.Sink] {
+			return fmt.Errorf("repository %s uses unknown sink %q", r.FullName(), r.Sink)
+		}
+	}
+	if c.GitHub.RateLimitThreshold < 0 {
+		return fmt.Errorf("GitHub rate limit threshold must not be negative, got %d", c.GitHub.RateLimitThreshold)
+	}
+	if c.Poll.Interval <= 0 {
+		return fmt.Errorf("poll interval must be positive, got %s", c.Poll.Interval)
+	}
+	if c.Poll.Jitter < 0 || c.Poll.Jitter > 1 {
+		return fmt.Errorf("poll jitter must be between 0 and 1, got %v", c.Poll.Jitter)
+	}
+	if p := c.Poll.Pipeline; p.SummarizeWorkers < 1 || p.CreateWorkers < 1 {
+		return fmt.Errorf("pipeline needs at least one summarize and one create worker, got %d and %d", p.SummarizeWorkers, p.CreateWorkers)
+	}
+	if a := c.Poll.Adaptive; c.Poll.AdaptiveEnabled() && (a.QuietCycles < 1 || a.Factor <= 1) {
+		return fmt.Errorf("adaptive polling needs at least 1 quiet cycle and a factor above 1, got %d and %v", a.QuietCycles, a.Factor)
+	}
+	if c.Poll.Pipeline.QueueSize < 0 {
+		return fmt.Errorf("pipeline queue size must not be negative, got %d", c.Poll.Pipeline.QueueSize)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return fmt.Errorf("tracing sample ratio must be between 0 and 1, got %v", c.Tracing.SampleRatio)
+	}
+	if n := c.Jira.DescriptionLimit.MaxLength; n != 0 && n < MinDescriptionLength {
+		return fmt.Errorf("Jira description limit must be 0 or at least %d characters, got %d", MinDescriptionLength, n)
+	}
+	if c.GitHub.Timeout < 0 || c.Jira.Timeout < 0 {
+		return fmt.Errorf("GitHub and Jira timeouts must not be negative, got %s and %s", c.GitHub.Timeout, c.Jira.Timeout)
+	}
+	if c.State.LockTTL < time.Second {
+		return fmt.Errorf("state lock TTL must be at least 1s, got %s", c.State.LockTTL)
+	}
+	if c.State.Reporting && c.State.Backend != "postgres" {
+		return fmt.Errorf("state reporting requires the postgres state backend, got %q", c.State.Backend)
+	}
+	if c.Preflight.Timeout < 0 {
+		return fmt.Errorf("preflight timeout must not be negative, got %s", c.Preflight.Timeout)
+	}
+	if d := c.Summarizer.Discussion; d.MinComments > 0 {
+		if d.Target != DiscussionDescription && d.Target != DiscussionComment {
+			return fmt.Errorf("invalid discussion summary target %q, expected %s or %s", d.Target, DiscussionDescription, DiscussionComment)
+		}
+		if d.MaxComments <= 0 {
+			return fmt.Errorf("discussion summaries need a positive maximum of comments, got %d", d.MaxComments)
+		}
+	}
+	if r := c.Summarizer.Refresh; r.NewComments < 0 || r.MaxAge < 0 {
+		return fmt.Errorf("summary refresh thresholds must not be negative, got %d comments and %s", r.NewComments, r.MaxAge)
+	}
+	if r := c.Summarizer.Refresh; r.Enabled() && c.Summarizer.Discussion.MaxComments <= 0 {
+		return fmt.Errorf("summary refreshes need a positive maximum of discussion comments, got %d", c.Summarizer.Discussion.MaxComments)
+	}
+	if e := c.Summarizer.Enrichment; e.Enabled && e.AcceptanceCriteriaField == "" && e.StoryPointsField == "" {
+		return fmt.Errorf("enrichment needs an acceptance criteria or story points field")
+	}
+	if d := c.Summarizer.Duplicates; d.Enabled && (d.Threshold <= 0 || d.Threshold > 1) {
+		return fmt.Errorf("duplicate threshold must be in (0, 1], got %g", d.Threshold)
+	}
+	if c.Summarizer.Model == "" {
+		return fmt.Errorf("summarizer model must not be empty")
+	}
+	if c.Summarizer.MaxLength < 0 || c.Summarizer.MaxTokens < 0 {
+		return fmt.Errorf("summary length limits must not be negative")
+	}
+	if c.Summarizer.Timeout <= 0 {
+		return fmt.Errorf("summarizer timeout must be positive, got %s", c.Summarizer.Timeout)
+	}
+	if c.Summarizer.Concurrency < 0 {
+		return fmt.Errorf("summarizer concurrency must not be negative, got %d", c.Summarizer.Concurrency)
+	}
+	for model, n := range c.Summarizer.ModelConcurrency {
+		if n < 0 {
+			return fmt.Errorf("concurrency of model %s must not be negative, got %d", model, n)
+		}
+	}
+	if c.Retry.MaxAttempts < 1 {
+		return fmt.Errorf("retry max attempts must be at least 1, got %d", c.Retry.MaxAttempts)
+	}
+	if c.Retry.Backoff <= 0 || c.Retry.MaxBackoff < c.Retry.Backoff {
+		return fmt.Errorf("retry backoff must be positive and at most the max backoff, got %s and %s", c.Retry.Backoff, c.Retry.MaxBackoff)
+	}
+	if l := c.Leader; l.Enabled {
+		if l.Backend != LeaderStore && l.Backend != LeaderKubernetes {
+			return fmt.Errorf("invalid leader election backend %q, expected %s or %s", l.Backend, LeaderStore, LeaderKubernetes)
+		}
+		if l.Name == "" {
+			return fmt.Errorf("leader election requires a lock name")
+		}
+		if l.LeaseDuration < time.Second {
+			return fmt.Errorf("leader lease duration must be at least 1s, got %s", l.LeaseDuration)
+		}
+	}
+	if c.Approval.Required && !sharedStateBackends[c.State.Backend] {
+		// Approvals are decided by the CLI, which must see the service's state
+		return fmt.Errorf("approval requires a state backend shared with the CLI, e.g. sqlite, postgres or redis, got %q", c.State.Backend)
+	}
+	return nil
+}
+
+// NextPollDelay returns the poll interval plus a random jitter of up to
+// Jitter * Interval
+func (p PollConfig) NextPollDelay() time.Duration {
+	if p.Jitter <= 0 {
+		return p.Interval
+	}
+	return p.Interval + time.Duration(rand.Float64()*p.Jitter*float64(p.Interval))
+}
+
+func setString(dst *string, env string) {
+	if v := os.Getenv(env); v != "" {
+		*dst = v
+	}
+}
+
+// setBool sets *dst from the boolean environment variable env if it is set
+func setBool(dst *bool, env string) error {
+	if v := os.Getenv(env); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %w", env, v, err)
+		}
+		*dst = b
+	}
+	return nil
+}
+
+// setSecret is setString for secrets, which may also be read from the file
+// named by the env_FILE variable so they don't show up in the environment
+func setSecret(dst *string, env string) error {
+	setString(dst, env)
+	if path := os.Getenv(env + "_FILE"); path != "" {
+		v, err := secrets.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s_FILE: %w", env, err)
+		}
+		*dst = v
+	}
+	return nil
+}
@@ -0,0 +1,399 @@
+// Package filter implements the expressions selecting the GitHub issues to
+// sync, e.g.
+//
+//	labels contains "bug" && !title startsWith "[wip]"
+//
+// A comparison is a field, an operator and a value. Comparisons combine with
+// && (and), || (or), ! (not) and parentheses; ! binds tightest and && binds
+// tighter than ||.
+//
+// String fields are title, body, author, state, milestone and repo; labels is
+// a list and number is a number. Strings compare case-insensitively with ==,
+// !=, contains, startsWith, endsWith and in, and match a regular expression
+// with matches. On labels the operators hold if they hold for any label.
+// Numbers compare with ==, !=, <, <=, >, >= and in.
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Issue is what an expression is evaluated against
+type Issue struct {
+	Repo      string
+	Number    int
+	Title     string
+	Body      string
+	Author    string
+	State     string
+	Milestone string
+	Labels    []string
+}
+
+// Expr is a parsed filter expression
+type Expr struct {
+	src  string
+	root node
+}
+
+// Parse parses a filter expression
+func Parse(src string) (*Expr, error) {
+	p := &parser{lex: lexer{src: src}}
+	p.next()
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// Match reports whether issue satisfies the expression. A nil Expr matches
+// every issue.
+func (e *Expr) Match(issue Issue) bool {
+	if e == nil {
+		return true
+	}
+	return e.root.eval(&issue)
+}
+
+// String returns the source of the expression
+func (e *Expr) String() string {
+	if e == nil {
+		return ""
+	}
+	return e.src
+}
+
+type node interface {
+	eval(issue *Issue) bool
+}
+
+type andNode struct{ left, right node }
+
+func (n andNode) eval(issue *Issue) bool { return n.left.eval(issue) && n.right.eval(issue) }
+
+type orNode struct{ left, right node }
+
+func (n orNode) eval(issue *Issue) bool { return n.left.eval(issue) || n.right.eval(issue) }
+
+type notNode struct{ operand node }
+
+func (n notNode) eval(issue *Issue) bool { return !n.operand.eval(issue) }
+
+// fieldKind is the type of the values of a field
+type fieldKind int
+
+const (
+	kindString fieldKind = iota
+	kindList
+	kindNumber
+)
+
+var fields = map[string]fieldKind{
+	"repo":      kindString,
+	"title":     kindString,
+	"body":      kindString,
+	"author":    kindString,
+	"state":     kindString,
+	"milestone": kindString,
+	"labels":    kindList,
+	"number":    kindNumber,
+}
+
+// value is the right-hand side of a comparison
+type value struct {
+	str    string
+	num    float64
+	list   []string
+	nums   []float64
+	re     *regexp.Regexp
+	isList bool
+	isNum  bool
+}
+
+type compareNode struct {
+	field string
+	op    string
+	value value
+}
+
+func (n compareNode) eval(issue *Issue) bool {
+	switch n.field {
+	case "number":
+		return n.compareNumber(float64(issue.Number))
+	case "labels":
+		for _, l := range issue.Labels {
+			if n.compareString(l) {
+				return true
+			}
+		}
+		return false
+	}
+	var s string
+	switch n.field {
+	case "repo":
+		s = issue.Repo
+	case "title":
+		s = issue.Title
+	case "body":
+		s = issue.Body
+	case "author":
+		s = issue.Author
+	case "state":
+		s = issue.State
+	case "milestone":
+		s = issue.Milestone
+	}
+	return n.compareString(s)
+}
+
+func (n compareNode) compareString(s string) bool {
+	v := n.value
+	switch n.op {
+	case "==", "contains":
+		if n.op == "==" || n.field == "labels" {
+			return strings.EqualFold(s, v.str)
+		}
+		return strings.Contains(strings.ToLower(s), strings.ToLower(v.str))
+	case "!=":
+		return !strings.EqualFold(s, v.str)
+	case "startsWith":
+		return strings.HasPrefix(strings.ToLower(s), strings.ToLower(v.str))
+	case "endsWith":
+		return strings.HasSuffix(strings.ToLower(s), strings.ToLower(v.str))
+	case "matches":
+		return v.re.MatchString(s)
+	case "in":
+		return slices.ContainsFunc(v.list, func(x string) bool { return strings.EqualFold(s, x) })
+	}
+	return false
+}
+
+func (n compareNode) compareNumber(x float64) bool {
+	v := n.value
+	switch n.op {
+	case "==":
+		return x == v.num
+	case "!=":
+		return x != v.num
+	case "<":
+		return x < v.num
+	case "<=":
+		return x <= v.num
+	case ">":
+		return x > v.num
+	case ">=":
+		return x >= v.num
+	case "in":
+		return slices.Contains(v.nums, x)
+	}
+	return false
+}
+
+// operators lists the operators valid on each kind of field
+var operators = map[fieldKind][]string{
+	kindString: {"==", "!=", "contains", "startsWith", "endsWith", "matches", "in"},
+	kindList:   {"contains", "startsWith", "endsWith", "matches", "in"},
+	kindNumber: {"==", "!=", "<", "<=", ">", ">=", "in"},
+}
+
+type parser struct {
+	lex lexer
+	tok token
+	err error
+}
+
+func (p *parser) next() {
+	if p.err != nil {
+		return
+	}
+	p.tok, p.err = p.lex.next()
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return p.errorAt(p.tok.pos, format, args...)
+}
+
+// errorAt reports an error at offset pos, for errors found after the
+// offending token was consumed
+func (p *parser) errorAt(pos int, format string, args ...interface{}) error {
+	return fmt.Errorf("filter %q at offset %d: %s", p.lex.src, pos, fmt.Sprintf(format, args...))
+}
+
+// or parses a sequence of ands joined by ||
+func (p *parser) or() (node, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && p.tok.text == "||" {
+		p.next()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+// and parses a sequence of unary expressions joined by &&
+func (p *parser) and() (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && p.tok.text == "&&" {
+		p.next()
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+// unary parses a negation, a parenthesized expression or a comparison
+func (p *parser) unary() (node, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	switch {
+	case p.tok.kind == tokOp && p.tok.text == "!":
+		p.next()
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand}, nil
+	case p.tok.kind == tokOp && p.tok.text == "(":
+		p.next()
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.err != nil {
+			return nil, p.err
+		}
+		if p.tok.kind != tokOp || p.tok.text != ")" {
+			return nil, p.errorf("expected ), got %s", p.tok)
+		}
+		p.next()
+		return inner, nil
+	}
+	return p.comparison()
+}
+
+// comparison parses field op value
+func (p *parser) comparison() (node, error) {
+	if p.tok.kind != tokIdent {
+		return nil, p.errorf("expected a field, got %s", p.tok)
+	}
+	field := p.tok.text
+	kind, ok := fields[field]
+	if !ok {
+		return nil, p.errorf("unknown field %q", field)
+	}
+	p.next()
+	if p.err != nil {
+		return nil, p.err
+	}
+	if p.tok.kind != tokOp && p.tok.kind != tokIdent {
+		return nil, p.errorf("expected an operator after %s, got %s", field, p.tok)
+	}
+	op := p.tok.text
+	if !slices.Contains(operators[kind], op) {
+		return nil, p.errorf("operator %s does not apply to %s", op, field)
+	}
+	p.next()
+	at := p.tok.pos
+	v, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case op == "in" && !v.isList:
+		return nil, p.errorAt(at, "%s in needs a list", field)
+	case op != "in" && v.isList:
+		return nil, p.errorAt(at, "%s %s needs a single value, not a list", field, op)
+	case kind == kindNumber && !v.isNum:
+		return nil, p.errorAt(at, "%s needs a number", field)
+	case kind != kindNumber && v.isNum:
+		return nil, p.errorAt(at, "%s needs a string", field)
+	}
+	if op == "matches" {
+		if v.re, err = regexp.Compile(v.str); err != nil {
+			return nil, p.errorAt(at, "invalid regular expression: %v", err)
+		}
+	}
+	return compareNode{field: field, op: op, value: v}, nil
+}
+
+// value parses a string, a number or a list of either
+func (p *parser) value() (value, error) {
+	if p.err != nil {
+		return value{}, p.err
+	}
+	if p.tok.kind == tokOp && p.tok.text == "[" {
+		p.next()
+		v := value{isList: true}
+		for first := true; ; first = false {
+			if p.err != nil {
+				return value{}, p.err
+			}
+			if p.tok.kind == tokOp && p.tok.text == "]" {
+				p.next()
+				return v, nil
+			}
+			if !first {
+				if p.tok.kind != tokOp || p.tok.text != "," {
+					return value{}, p.errorf("expected , or ], got %s", p.tok)
+				}
+				p.next()
+			}
+			at := p.tok.pos
+			elem, err := p.value()
+			if err != nil {
+				return value{}, err
+			}
+			switch {
+			case elem.isList:
+				return value{}, p.errorAt(at, "lists cannot be nested")
+			case len(v.list)+len(v.nums) > 0 && elem.isNum != v.isNum:
+				return value{}, p.errorAt(at, "lists cannot mix strings and numbers")
+			case elem.isNum:
+				v.isNum = true
+				v.nums = append(v.nums, elem.num)
+			default:
+				v.list = append(v.list, elem.str)
+			}
+		}
+	}
+
+	tok := p.tok
+	switch tok.kind {
+	case tokString:
+		p.next()
+		return value{str: tok.text}, nil
+	case tokNumber:
+		n, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return value{}, p.errorf("invalid number %s", tok.text)
+		}
+		p.next()
+		return value{num: n, isNum: true}, nil
+	}
+	return value{}, p.errorf("expected a value, got %s", tok)
+}
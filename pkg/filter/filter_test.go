@@ -0,0 +1,151 @@
+package filter
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var issue = Issue{
+	Repo:      "acme/widgets",
+	Number:    42,
+	Title:     `Crash on "save"`,
+	Body:      "first line\nsecond line",
+	Author:    "octocat",
+	State:     "open",
+	Milestone: "v1.2",
+	Labels:    []string{"bug", "area/ui"},
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		// precedence: ! binds tightest, && tighter than ||
+		{`!state == "closed"`, true},
+		{`!state == "open" && number == 42`, false},
+		{`state == "closed" && number == 1 || number == 42`, true},
+		{`number == 42 || state == "closed" && number == 1`, true},
+		{`(number == 42 || state == "closed") && number == 1`, false},
+		{`!(number == 42 || state == "closed")`, false},
+		{`!!state == "open"`, true},
+
+		// string escapes
+		{`title == "Crash on \"save\""`, true},
+		{`title contains "\"save\""`, true},
+		{`body contains "line\nsecond"`, true},
+		{`body contains "line\\nsecond"`, false},
+		{`milestone == "v1.2"`, true},
+
+		// negative numbers
+		{`number > -1`, true},
+		{`number >= -42`, true},
+		{`number < -1`, false},
+		{`number != -42`, true},
+		{`number in [-1, 42]`, true},
+
+		// in lists
+		{`state in ["closed", "OPEN"]`, true},
+		{`state in ["closed"]`, false},
+		{`state in []`, false},
+		{`labels in ["enhancement", "BUG"]`, true},
+		{`labels in ["enhancement"]`, false},
+		{`number in [1, 2, 42.0]`, true},
+		{`number in [1, 2]`, false},
+
+		// strings compare case-insensitively
+		{`author == "OctoCat"`, true},
+		{`author != "OCTOCAT"`, false},
+		{`title startsWith "crash"`, true},
+		{`milestone endsWith "1.2"`, true},
+		{`repo contains "WIDGET"`, true},
+
+		// labels hold if any label holds, and contains is an exact match
+		{`labels contains "area/ui"`, true},
+		{`labels contains "area"`, false},
+		{`labels startsWith "area/"`, true},
+		{`labels endsWith "UG"`, true},
+		{`labels matches "^area/"`, true},
+
+		// matches is a case-sensitive regular expression
+		{`title matches "^Crash"`, true},
+		{`title matches "^crash"`, false},
+		{`title matches "(?i)^crash"`, true},
+
+		// numbers
+		{`number == 42`, true},
+		{`number <= 41.5`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			e, err := Parse(tt.src)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if got := e.Match(issue); got != tt.want {
+				t.Errorf("Match = %v, want %v", got, tt.want)
+			}
+			if e.String() != tt.src {
+				t.Errorf("String = %q, want %q", e.String(), tt.src)
+			}
+		})
+	}
+}
+
+func TestMatchNil(t *testing.T) {
+	var e *Expr
+	if !e.Match(issue) {
+		t.Error("nil expression doesn't match")
+	}
+	if e.String() != "" {
+		t.Errorf("String = %q, want empty", e.String())
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src    string
+		offset int
+		msg    string
+	}{
+		{`title == "open`, 9, "unterminated string"},
+		{`title == "a\qb"`, 9, "invalid string"},
+		{`title == 'a'`, 9, "unexpected character '\\''"},
+		{`titel == "a"`, 0, `unknown field "titel"`},
+		{`state == "open" && 42`, 19, "expected a field, got 42"},
+		{`state "open"`, 6, `expected an operator after state, got "open"`},
+		{`number contains "4"`, 7, "operator contains does not apply to number"},
+		{`labels == "bug"`, 7, "operator == does not apply to labels"},
+		{`(state == "open"`, 16, "expected ), got end of filter"},
+		{`state == "open")`, 15, "unexpected )"},
+		{`state ==`, 8, "expected a value, got end of filter"},
+		{`number == -`, 10, "invalid number -"},
+		{`number == 1.2.3`, 10, "invalid number 1.2.3"},
+		{`number == "42"`, 10, "number needs a number"},
+		{`state == 1 && number == 1`, 9, "state needs a string"},
+		{`title matches "("`, 14, "invalid regular expression"},
+
+		// in lists
+		{`state in "open" && number == 1`, 9, "state in needs a list"},
+		{`state == ["open"]`, 9, "state == needs a single value, not a list"},
+		{`state in ["open", ["closed"]]`, 18, "lists cannot be nested"},
+		{`number in [1, "2"]`, 14, "lists cannot mix strings and numbers"},
+		{`state in ["open" "closed"]`, 17, `expected , or ], got "closed"`},
+		{`state in ["open",]`, 17, "expected a value, got ]"},
+		{`state in ["open"`, 16, "expected , or ], got end of filter"},
+		{`number in ["1"]`, 10, "number needs a number"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			_, err := Parse(tt.src)
+			if err == nil {
+				t.Fatal("Parse succeeded")
+			}
+			want := "at offset " + strconv.Itoa(tt.offset) + ": " + tt.msg
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("error = %q, want %q", err, want)
+			}
+		})
+	}
+}
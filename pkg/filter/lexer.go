@@ -0,0 +1,98 @@
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of filter"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return t.text
+}
+
+// lexer splits a filter expression into tokens
+type lexer struct {
+	src string
+	pos int
+}
+
+// operators made of symbols, longest first
+var symbols = []string{"&&", "||", "==", "!=", "<=", ">=", "!", "<", ">", "(", ")", "[", "]", ","}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.src) && unicode.IsSpace(rune(l.src[l.pos])) {
+		l.pos++
+	}
+	start := l.pos
+	if start == len(l.src) {
+		return token{kind: tokEOF, pos: start}, nil
+	}
+	rest := l.src[start:]
+
+	switch c := rest[0]; {
+	case c == '"':
+		end := 1
+		for ; end < len(rest); end++ {
+			if rest[end] == '\\' {
+				end++
+				continue
+			}
+			if rest[end] == '"' {
+				break
+			}
+		}
+		if end >= len(rest) {
+			return token{}, fmt.Errorf("filter %q at offset %d: unterminated string", l.src, start)
+		}
+		s, err := strconv.Unquote(rest[:end+1])
+		if err != nil {
+			return token{}, fmt.Errorf("filter %q at offset %d: invalid string: %w", l.src, start, err)
+		}
+		l.pos += end + 1
+		return token{kind: tokString, text: s, pos: start}, nil
+	case c >= '0' && c <= '9' || c == '-':
+		end := 1
+		for end < len(rest) && (rest[end] >= '0' && rest[end] <= '9' || rest[end] == '.') {
+			end++
+		}
+		l.pos += end
+		return token{kind: tokNumber, text: rest[:end], pos: start}, nil
+	case c == '_' || unicode.IsLetter(rune(c)):
+		end := 1
+		for end < len(rest) && (rest[end] == '_' || unicode.IsLetter(rune(rest[end])) || unicode.IsDigit(rune(rest[end]))) {
+			end++
+		}
+		l.pos += end
+		return token{kind: tokIdent, text: rest[:end], pos: start}, nil
+	}
+	for _, s := range symbols {
+		if strings.HasPrefix(rest, s) {
+			l.pos += len(s)
+			return token{kind: tokOp, text: s, pos: start}, nil
+		}
+	}
+	return token{}, fmt.Errorf("filter %q at offset %d: unexpected character %q", l.src, start, rest[0])
+}
@@ -0,0 +1,154 @@
+// Package githubapp authenticates as a GitHub App installation.
+//
+// The App's private key signs a short-lived JWT, which is exchanged for an
+// installation access token. Installation tokens expire after an hour; the
+// token source returned by NewTokenSource fetches a new one shortly before.
+package githubapp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// DefaultBaseURL is the GitHub.com REST API
+const DefaultBaseURL = "https://api.github.com/"
+
+// Config identifies the App installation
+type Config struct {
+	AppID          int64
+	InstallationID int64
+	// PrivateKey is the PEM encoded private key of the App
+	PrivateKey []byte
+	// BaseURL is the REST API URL; defaults to DefaultBaseURL
+	BaseURL string
+	// HTTPClient is used to request tokens; defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// installationTokens requests installation tokens
+type installationTokens struct {
+	cfg Config
+	key *rsa.PrivateKey
+}
+
+// NewTokenSource returns a token source of installation access tokens that
+// reuses each token until shortly before it expires
+func NewTokenSource(cfg Config) (oauth2.TokenSource, error) {
+	if cfg.AppID == 0 || cfg.InstallationID == 0 {
+		return nil, fmt.Errorf("GitHub App authentication requires an app ID and an installation ID")
+	}
+	key, err := parsePrivateKey(cfg.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultBaseURL
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	return oauth2.ReuseTokenSource(nil, &installationTokens{cfg: cfg, key: key}), nil
+}
+
+// parsePrivateKey decodes a PKCS #1 or PKCS #8 RSA private key
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("GitHub App private key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GitHub App private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("GitHub App private key is not an RSA key")
+	}
+	return key, nil
+}
+
+// Token implements oauth2.TokenSource
+func (t *installationTokens) Token() (*oauth2.Token, error) {
+	jwt, err := t.jwt(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%sapp/installations/%d/access_tokens", strings.TrimRight(t.cfg.BaseURL, "/")+"/", t.cfg.InstallationID)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create installation token request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	log.Printf("Requesting a GitHub App installation token for installation %d", t.cfg.InstallationID)
+	resp, err := t.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request installation token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("GitHub responded to the installation token request with status %s: %s", resp.Status, body)
+	}
+
+	var out struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("failed to decode installation token: %w", err)
+	}
+	log.Printf("Got a GitHub App installation token valid until %s", out.ExpiresAt.Format(time.RFC3339))
+	return &oauth2.Token{
+		AccessToken: out.Token,
+		// Refresh a minute early so requests in flight don't use an
+		// expired token
+		Expiry: out.ExpiresAt.Add(-time.Minute),
+	}, nil
+}
+
+// jwt returns the RS256 signed JWT authenticating as the App
+func (t *installationTokens) jwt(now time.Time) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	// Backdate the issue time to allow for clock drift; GitHub accepts
+	// tokens valid for at most ten minutes
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": strconv.FormatInt(t.cfg.AppID, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, t.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign GitHub App JWT: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
@@ -0,0 +1,92 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout limits external hook commands without a timeout
+const DefaultTimeout = 30 * time.Second
+
+// Exec is a hook running an external command. The payload is written to
+// its standard input as JSON; the command may print the members it changes
+// as a JSON object, or nothing to keep the payload. A non-zero exit status
+// fails the sync.
+type Exec struct {
+	Path    string
+	Args    []string
+	Timeout time.Duration
+	// Env names the environment variables passed on to the command besides
+	// PATH and HOME. The rest of the environment, which holds the
+	// credentials of the service, is withheld.
+	Env []string
+}
+
+// baseEnv are the environment variables every command gets
+var baseEnv = []string{"PATH", "HOME"}
+
+// BeforeSummarize implements Hook
+func (e *Exec) BeforeSummarize(ctx context.Context, p *Payload) error { return e.run(ctx, p) }
+
+// BeforeJiraCreate implements Hook
+func (e *Exec) BeforeJiraCreate(ctx context.Context, p *Payload) error { return e.run(ctx, p) }
+
+// AfterSync implements Hook
+func (e *Exec) AfterSync(ctx context.Context, p *Payload) error { return e.run(ctx, p) }
+
+// environ returns the environment of the command run at stage
+func (e *Exec) environ(stage string) []string {
+	env := []string{"GH_JIRA_HOOK_STAGE=" + stage}
+	for _, name := range append(baseEnv, e.Env...) {
+		if v, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+v)
+		}
+	}
+	return env
+}
+
+// run passes p to the command and reads back its changes
+func (e *Exec) run(ctx context.Context, p *Payload) error {
+	in, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, e.Path, e.Args...)
+	cmd.Env = e.environ(p.Stage)
+	cmd.Stdin = bytes.NewReader(in)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %w: %s", e.Path, err, msg)
+		}
+		return fmt.Errorf("%s: %w", e.Path, err)
+	}
+
+	out := bytes.TrimSpace(stdout.Bytes())
+	if len(out) == 0 {
+		return nil
+	}
+	// Members left out of the output keep their values
+	stage := p.Stage
+	changed := *p
+	if err := json.Unmarshal(out, &changed); err != nil {
+		return fmt.Errorf("%s printed an invalid payload: %w", e.Path, err)
+	}
+	*p = changed
+	p.Stage = stage
+	return nil
+}
@@ -0,0 +1,153 @@
+// Package hooks runs user-provided code at fixed points of a sync. Go
+// plugins and external commands can change what is summarized and created
+// in Jira, or veto the sync of an issue, without forking gh-jira.
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// Stages a hook can run at
+const (
+	// BeforeSummarize runs before the AI summary of an issue is generated;
+	// hooks can change Payload.Text
+	BeforeSummarize = "beforeSummarize"
+	// BeforeJiraCreate runs right before a Jira issue is created; hooks can
+	// change Payload.Fields
+	BeforeJiraCreate = "beforeJiraCreate"
+	// AfterSync runs once a Jira issue was created or updated; changes and
+	// vetoes are ignored
+	AfterSync = "afterSync"
+)
+
+// Stages lists all stages in the order of a sync
+var Stages = []string{BeforeSummarize, BeforeJiraCreate, AfterSync}
+
+// ErrVeto matches the errors of syncs vetoed by a hook
+var ErrVeto = errors.New("sync vetoed by hook")
+
+// VetoError is returned when a hook vetoed the sync of an issue
+type VetoError struct {
+	Hook   string
+	Reason string
+}
+
+func (e *VetoError) Error() string {
+	return fmt.Sprintf("sync vetoed by hook %s: %s", e.Hook, e.Reason)
+}
+
+// Is makes VetoError match ErrVeto
+func (e *VetoError) Is(target error) bool {
+	return target == ErrVeto
+}
+
+// Issue is the GitHub issue a payload is about
+type Issue struct {
+	Number int      `json:"number"`
+	Title  string   `json:"title"`
+	Body   string   `json:"body"`
+	URL    string   `json:"url"`
+	Author string   `json:"author"`
+	State  string   `json:"state"`
+	Labels []string `json:"labels"`
+}
+
+// Payload is what hooks see and may change at each stage
+type Payload struct {
+	Stage string `json:"stage"`
+	// Repo is the owner/name of the repository
+	Repo  string `json:"repo"`
+	Issue Issue  `json:"issue"`
+	// Text is the text the summary is generated from
+	Text string `json:"text,omitempty"`
+	// Summary is the AI summary, from BeforeJiraCreate on
+	Summary string `json:"summary,omitempty"`
+	// Fields are the fields of the Jira issue to create
+	Fields map[string]interface{} `json:"fields,omitempty"`
+	// JiraKey is the synced Jira issue in AfterSync
+	JiraKey string `json:"jira_key,omitempty"`
+	// Veto, set by a hook, stops the sync of the issue with this reason.
+	// The issue is skipped, not failed, and considered again next time.
+	Veto string `json:"veto,omitempty"`
+}
+
+// Hook is implemented by Go plugins. Each method may change p or set
+// p.Veto; an error fails the sync of the issue.
+type Hook interface {
+	BeforeSummarize(ctx context.Context, p *Payload) error
+	BeforeJiraCreate(ctx context.Context, p *Payload) error
+	AfterSync(ctx context.Context, p *Payload) error
+}
+
+// registered is a hook with the stages it runs at
+type registered struct {
+	name   string
+	stages map[string]bool
+	hook   Hook
+}
+
+// Runner runs the registered hooks in order. A nil Runner runs none.
+type Runner struct {
+	hooks []registered
+}
+
+// Add registers a hook running at the given stages, or all stages if none
+// are given
+func (r *Runner) Add(name string, stages []string, h Hook) {
+	if len(stages) == 0 {
+		stages = Stages
+	}
+	set := make(map[string]bool, len(stages))
+	for _, s := range stages {
+		set[s] = true
+	}
+	r.hooks = append(r.hooks, registered{name: name, stages: set, hook: h})
+}
+
+// Len returns the number of registered hooks
+func (r *Runner) Len() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.hooks)
+}
+
+// Run runs the hooks registered for stage on p, in order. It stops at the
+// first error or veto, which is returned as a *VetoError.
+func (r *Runner) Run(ctx context.Context, stage string, p *Payload) error {
+	if r == nil {
+		return nil
+	}
+	p.Stage = stage
+	for _, h := range r.hooks {
+		if !h.stages[stage] {
+			continue
+		}
+		var err error
+		switch stage {
+		case BeforeSummarize:
+			err = h.hook.BeforeSummarize(ctx, p)
+		case BeforeJiraCreate:
+			err = h.hook.BeforeJiraCreate(ctx, p)
+		case AfterSync:
+			err = h.hook.AfterSync(ctx, p)
+		default:
+			return fmt.Errorf("unknown hook stage %q", stage)
+		}
+		if err != nil {
+			return fmt.Errorf("hook %s failed at %s: %w", h.name, stage, err)
+		}
+		if p.Veto != "" {
+			if stage == AfterSync {
+				log.Printf("Ignoring the veto of hook %s after the sync of %s#%d", h.name, p.Repo, p.Issue.Number)
+				p.Veto = ""
+				continue
+			}
+			return &VetoError{Hook: h.name, Reason: p.Veto}
+		}
+	}
+	return nil
+}
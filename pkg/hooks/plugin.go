@@ -0,0 +1,33 @@
+package hooks
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// OpenPlugin loads the hook a Go plugin exports as its Hook symbol, e.g.
+//
+//	var Hook hooks.Hook = triage{}
+//
+// The plugin must be built with `go build -buildmode=plugin` against the
+// same version of gh-jira and its dependencies.
+func OpenPlugin(path string) (Hook, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open hook plugin %s: %w", path, err)
+	}
+	sym, err := p.Lookup("Hook")
+	if err != nil {
+		return nil, fmt.Errorf("hook plugin %s: %w", path, err)
+	}
+	switch h := sym.(type) {
+	case *Hook:
+		if *h == nil {
+			return nil, fmt.Errorf("hook plugin %s exports a nil Hook", path)
+		}
+		return *h, nil
+	case Hook:
+		return h, nil
+	}
+	return nil, fmt.Errorf("Hook of plugin %s is a %T, not a hooks.Hook", path, sym)
+}
@@ -0,0 +1,195 @@
+package httpclient
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/savitaashture/gh-jira/pkg/redact"
+)
+
+// maxLoggedBody is the number of bytes of a request or response body logged
+// in debug mode
+const maxLoggedBody = 4096
+
+// debug enables the request and response logging of all clients
+var debug atomic.Bool
+
+// SetDebug turns the request and response logging of all clients on or off
+func SetDebug(on bool) {
+	if debug.Swap(on) == on {
+		return
+	}
+	if on {
+		log.Printf("HTTP request logging enabled; credentials are redacted, but bodies may hold personal data")
+	} else {
+		log.Printf("HTTP request logging disabled")
+	}
+}
+
+// Debug reports whether requests and responses are logged
+func Debug() bool {
+	return debug.Load()
+}
+
+// secretHeaders are the headers whose values are never logged
+var secretHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Vault-Token":       true,
+	"X-Api-Key":           true,
+	"Private-Token":       true,
+}
+
+// secretParam matches the names of query and form parameters holding
+// credentials, such as client_secret, refresh_token and access_token
+var secretParam = regexp.MustCompile(`(?i)(token|secret|password|passwd|key|signature|code|assertion)$`)
+
+// bodyRedactor masks credentials in logged bodies. Unlike the builtin
+// patterns it also masks suffixed names such as refresh_token=...
+var bodyRedactor, _ = redact.New([]string{"tokens"}, []string{
+	`(?i)(?:token|secret|password|assertion)["']?\s*[:=]\s*["']?(?P<secret>[^\s"'&,;]{4,})`,
+}, "")
+
+// transport sets the User-Agent of requests and logs them in debug mode
+type transport struct {
+	base      http.RoundTripper
+	userAgent string
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.userAgent != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+	if !debug.Load() {
+		return t.base.RoundTrip(req)
+	}
+
+	target := redactURL(req.URL)
+	log.Printf("HTTP request %s %s\n  headers: %s\n  body: %s", req.Method, target, redactHeaders(req.Header), requestBody(req))
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		log.Printf("HTTP request %s %s failed after %s: %v", req.Method, target, time.Since(start).Round(time.Millisecond), err)
+		return nil, err
+	}
+	// The body is logged once read, so that streamed responses aren't held
+	// back
+	resp.Body = &loggedBody{
+		ReadCloser: resp.Body,
+		prefix: fmt.Sprintf("HTTP response %s %s: %s in %s\n  headers: %s", req.Method, target, resp.Status,
+			time.Since(start).Round(time.Millisecond), redactHeaders(resp.Header)),
+	}
+	return resp, nil
+}
+
+// loggedBody logs the start of a response body when it is closed
+type loggedBody struct {
+	io.ReadCloser
+	prefix string
+	buf    bytes.Buffer
+	total  int
+	logged bool
+}
+
+func (b *loggedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.total += n
+	if room := maxLoggedBody - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(n, room)])
+	}
+	return n, err
+}
+
+func (b *loggedBody) Close() error {
+	if !b.logged {
+		b.logged = true
+		log.Printf("%s\n  body: %s", b.prefix, formatBody(b.buf.Bytes(), b.total))
+	}
+	return b.ReadCloser.Close()
+}
+
+// requestBody returns the body of a request for the log, without consuming
+// it
+func requestBody(req *http.Request) string {
+	if req.Body == nil || req.Body == http.NoBody {
+		return "(none)"
+	}
+	if req.GetBody == nil {
+		return "(not replayable)"
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return "(unavailable)"
+	}
+	defer body.Close()
+	data, _ := io.ReadAll(io.LimitReader(body, maxLoggedBody))
+	total := len(data)
+	if req.ContentLength > int64(total) {
+		total = int(req.ContentLength)
+	}
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/") {
+		return fmt.Sprintf("(multipart, %d bytes)", total)
+	}
+	return formatBody(data, total)
+}
+
+// formatBody returns the logged start of a body with credentials masked
+func formatBody(data []byte, total int) string {
+	if total == 0 {
+		return "(empty)"
+	}
+	s := bodyRedactor.Redact(string(data))
+	if total > len(data) {
+		s += fmt.Sprintf("... (%d more bytes)", total-len(data))
+	}
+	return s
+}
+
+// redactHeaders formats headers for the log with credentials masked
+func redactHeaders(h http.Header) string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		value := strings.Join(h.Values(name), ", ")
+		if secretHeaders[http.CanonicalHeaderKey(name)] {
+			value = redact.DefaultReplacement
+		}
+		parts = append(parts, name+": "+value)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// redactURL formats a URL for the log with credentials in the user info and
+// the query masked
+func redactURL(u *url.URL) string {
+	c := *u
+	if c.User != nil {
+		c.User = url.User(c.User.Username())
+	}
+	if c.RawQuery != "" {
+		q := c.Query()
+		for name := range q {
+			if secretParam.MatchString(name) {
+				q.Set(name, redact.DefaultReplacement)
+			}
+		}
+		c.RawQuery = q.Encode()
+	}
+	return c.String()
+}
@@ -0,0 +1,142 @@
+// Package httpclient builds the HTTP clients used to talk to external
+// services, applying the proxy and TLS settings of corporate networks.
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Options configures a client
+type Options struct {
+	// Proxy is the URL of the HTTP(S) proxy used for all requests; empty
+	// uses the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables
+	Proxy string
+	// NoProxy lists hosts, domains (".example.com") and CIDR ranges reached
+	// without Proxy, separated by commas
+	NoProxy string
+	// CAFiles are PEM bundles of certificate authorities trusted in addition
+	// to the system ones, for servers with certificates of an internal CA
+	CAFiles []string
+	// InsecureSkipVerify disables TLS certificate verification
+	InsecureSkipVerify bool
+	// Timeout limits each request including reading the response; zero
+	// means no limit
+	Timeout time.Duration
+	// UserAgent replaces the User-Agent header of every request; empty
+	// keeps the header set by the caller
+	UserAgent string
+}
+
+// New returns an HTTP client for opts. Its requests are logged while
+// SetDebug is on.
+func New(opts Options) (*http.Client, error) {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+
+	if opts.Proxy != "" {
+		proxy, err := url.Parse(opts.Proxy)
+		if err != nil || proxy.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", opts.Proxy)
+		}
+		noProxy := parseNoProxy(opts.NoProxy)
+		base.Proxy = func(req *http.Request) (*url.URL, error) {
+			if noProxy.matches(req.URL.Hostname()) {
+				return nil, nil
+			}
+			return proxy, nil
+		}
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(opts.CAFiles) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, path := range opts.CAFiles {
+			pem, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("CA bundle %s holds no PEM certificates", path)
+			}
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if opts.InsecureSkipVerify {
+		log.Printf("WARNING: TLS certificate verification is DISABLED for outbound requests; " +
+			"connections can be intercepted and credentials stolen. Configure a CA bundle instead.")
+		tlsConfig.InsecureSkipVerify = true
+	}
+	base.TLSClientConfig = tlsConfig
+
+	return &http.Client{Transport: &transport{base: base, userAgent: opts.UserAgent}, Timeout: opts.Timeout}, nil
+}
+
+// noProxyList holds the parsed NoProxy entries
+type noProxyList struct {
+	all     bool
+	hosts   []string
+	domains []string
+	nets    []*net.IPNet
+}
+
+func parseNoProxy(s string) noProxyList {
+	var l noProxyList
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if h, _, err := net.SplitHostPort(entry); err == nil {
+			entry = h
+		}
+		switch {
+		case entry == "":
+		case entry == "*":
+			l.all = true
+		case strings.Contains(entry, "/"):
+			if _, n, err := net.ParseCIDR(entry); err == nil {
+				l.nets = append(l.nets, n)
+			}
+		case strings.HasPrefix(entry, "."):
+			l.domains = append(l.domains, entry)
+		default:
+			l.hosts = append(l.hosts, entry)
+		}
+	}
+	return l
+}
+
+// matches reports whether host is reached without the proxy. Like curl, a
+// plain host entry also matches its subdomains.
+func (l noProxyList) matches(host string) bool {
+	if l.all {
+		return true
+	}
+	host = strings.ToLower(host)
+	if ip := net.ParseIP(host); ip != nil {
+		for _, n := range l.nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+	}
+	for _, h := range l.hosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	for _, d := range l.domains {
+		if strings.HasSuffix(host, d) || host == d[1:] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+// Package idmap derives the canonical identity of a GitHub issue.
+//
+// Every watched repository belongs to a namespace. Repositories sharing a
+// namespace (for example an upstream repository and its mirror) are treated
+// as one logical source, and the namespace's strategy decides how issues
+// from them are identified, so that the same logical issue maps to a single
+// Jira ticket.
+package idmap
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Issue holds the issue attributes strategies can use
+type Issue struct {
+	Repo   string
+	Number int
+	ID     int64
+	NodeID string
+}
+
+// Strategy derives the namespace-local identifier of an issue
+type Strategy interface {
+	ID(issue Issue) (string, error)
+}
+
+// StrategyFunc adapts a function to the Strategy interface
+type StrategyFunc func(issue Issue) (string, error)
+
+// ID implements Strategy
+func (f StrategyFunc) ID(issue Issue) (string, error) { return f(issue) }
+
+// DefaultStrategy is used for namespaces that don't configure one
+const DefaultStrategy = "node"
+
+var (
+	mu         sync.RWMutex
+	strategies = map[string]Strategy{
+		// node identifies issues by their global GraphQL node ID, so issues
+		// are only deduplicated if they really are the same GitHub object
+		"node": StrategyFunc(func(issue Issue) (string, error) {
+			if issue.NodeID == "" {
+				return "", fmt.Errorf("issue %s#%d has no node ID", issue.Repo, issue.Number)
+			}
+			return issue.NodeID, nil
+		}),
+		// number identifies issues by their number, for mirrors that
+		// preserve issue numbering
+		"number": StrategyFunc(func(issue Issue) (string, error) {
+			return "#" + strconv.Itoa(issue.Number), nil
+		}),
+	}
+)
+
+// Register makes a strategy available under name, replacing any existing one
+func Register(name string, s Strategy) {
+	mu.Lock()
+	defer mu.Unlock()
+	strategies[name] = s
+}
+
+// Strategies returns the names of all registered strategies
+func Strategies() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup returns the strategy registered under name
+func Lookup(name string) (Strategy, error) {
+	if name == "" {
+		name = DefaultStrategy
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	s, ok := strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown ID strategy %q", name)
+	}
+	return s, nil
+}
+
+// Key returns the canonical key of issue within namespace
+func Key(namespace, strategy string, issue Issue) (string, error) {
+	s, err := Lookup(strategy)
+	if err != nil {
+		return "", err
+	}
+	id, err := s.ID(issue)
+	if err != nil {
+		return "", err
+	}
+	return namespace + "/" + id, nil
+}
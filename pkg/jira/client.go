@@ -0,0 +1,855 @@
+// Package jira provides a minimal client for the Jira REST API v2.
+package jira
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// Deployment types of Jira
+const (
+	// DeploymentCloud is Jira Cloud
+	DeploymentCloud = "cloud"
+	// DeploymentServer is Jira Server and Jira Data Center
+	DeploymentServer = "server"
+)
+
+// userFields are the system fields referencing a user. String values are
+// converted to the user reference of the deployment.
+var userFields = []string{"assignee", "reporter"}
+
+// Config holds the connection settings of a Client
+type Config struct {
+	// BaseURL is the URL of the Jira site, used for browse links and, unless
+	// APIURL is set, API requests
+	BaseURL string
+	// APIURL is the REST API URL if it differs from BaseURL, such as
+	// https://api.atlassian.com/ex/jira/{cloudId} for OAuth apps on Jira Cloud
+	APIURL string
+	// Deployment is DeploymentCloud (the default) or DeploymentServer
+	Deployment string
+	// Username and APIToken authenticate with basic auth. On Jira Server
+	// and Data Center an APIToken without Username is sent as a personal
+	// access token.
+	Username string
+	APIToken string
+	// TokenSource authenticates with OAuth 2.0 bearer tokens instead of
+	// Username and APIToken, see NewOAuthTokenSource
+	TokenSource oauth2.TokenSource
+	// HTTPClient is used for all requests; defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// Client talks to a single Jira instance
+type Client struct {
+	baseURL    string
+	apiURL     string
+	server     bool
+	username   string
+	apiToken   string
+	tokens     oauth2.TokenSource
+	httpClient *http.Client
+	// quiet suppresses notifications and automatic watchers
+	quiet bool
+
+	myselfOnce sync.Once
+	myself     *User
+	myselfErr  error
+}
+
+// Error is returned when the Jira API responds with a non-2xx status
+type Error struct {
+	Status     string
+	StatusCode int
+	Body       string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Jira API responded with status %s", e.Status)
+}
+
+// User is a Jira user. Jira Cloud identifies users by AccountID, Jira Server
+// and Data Center by Name.
+type User struct {
+	AccountID    string `json:"accountId,omitempty"`
+	Name         string `json:"name,omitempty"`
+	DisplayName  string `json:"displayName,omitempty"`
+	EmailAddress string `json:"emailAddress,omitempty"`
+}
+
+// CreatedIssue is the response to an issue creation
+type CreatedIssue struct {
+	ID   string `json:"id"`
+	Key  string `json:"key"`
+	Self string `json:"self"`
+}
+
+// Issue is an issue as returned by the Jira API
+type Issue struct {
+	ID     string      `json:"id"`
+	Key    string      `json:"key"`
+	Self   string      `json:"self"`
+	Fields IssueFields `json:"fields"`
+}
+
+// IssueFields holds the issue fields used by gh-jira
+type IssueFields struct {
+	Summary     string `json:"summary"`
+	Description string `json:"description"`
+	Status      *struct {
+		Name           string `json:"name"`
+		StatusCategory struct {
+			// Key is "new", "indeterminate" or "done"
+			Key string `json:"key"`
+		} `json:"statusCategory"`
+	} `json:"status,omitempty"`
+	IssueLinks  []*IssueLink  `json:"issuelinks,omitempty"`
+	Attachments []*Attachment `json:"attachment,omitempty"`
+}
+
+// Attachment is a file attached to an issue
+type Attachment struct {
+	ID       string `json:"id"`
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+}
+
+// IssueLink links two issues. Of the linked issues only the other one is
+// set when the link is read from an issue.
+type IssueLink struct {
+	ID   string `json:"id,omitempty"`
+	Type struct {
+		Name string `json:"name"`
+	} `json:"type"`
+	InwardIssue  *LinkedIssue `json:"inwardIssue,omitempty"`
+	OutwardIssue *LinkedIssue `json:"outwardIssue,omitempty"`
+}
+
+// LinkedIssue is the issue at one end of a link
+type LinkedIssue struct {
+	Key string `json:"key"`
+}
+
+// Other returns the key of the linked issue that is not key
+func (l *IssueLink) Other(key string) string {
+	if l.InwardIssue != nil && l.InwardIssue.Key != key {
+		return l.InwardIssue.Key
+	}
+	if l.OutwardIssue != nil && l.OutwardIssue.Key != key {
+		return l.OutwardIssue.Key
+	}
+	return ""
+}
+
+// RemoteLink links an issue to a page outside Jira
+type RemoteLink struct {
+	// GlobalID identifies the link; adding a link with the GlobalID of an
+	// existing one updates it
+	GlobalID string
+	URL      string
+	Title    string
+	Summary  string
+	// Resolved strikes the link through, as for merged pull requests
+	Resolved bool
+}
+
+// Comment is a comment of an issue
+type Comment struct {
+	ID      string `json:"id"`
+	Body    string `json:"body"`
+	Author  *User  `json:"author,omitempty"`
+	Created string `json:"created"`
+}
+
+// Project is a Jira project with the issue types it offers
+type Project struct {
+	ID         string       `json:"id"`
+	Key        string       `json:"key"`
+	Name       string       `json:"name"`
+	IssueTypes []*IssueType `json:"issueTypes"`
+}
+
+// IssueType is an issue type of a project
+type IssueType struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Subtask bool   `json:"subtask"`
+}
+
+// Field is a system or custom issue field
+type Field struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Custom bool   `json:"custom"`
+}
+
+// Version is a project version (release)
+type Version struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Released    bool   `json:"released"`
+	// ReleaseDate is formatted as 2006-01-02
+	ReleaseDate string `json:"releaseDate,omitempty"`
+}
+
+// Sprint is a sprint of a Jira Software board
+type Sprint struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	// State is "future", "active" or "closed"
+	State     string `json:"state"`
+	StartDate string `json:"startDate,omitempty"`
+}
+
+// Transition is a workflow transition available for an issue
+type Transition struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	To   struct {
+		Name           string `json:"name"`
+		StatusCategory struct {
+			// Key is "new", "indeterminate" or "done"
+			Key string `json:"key"`
+		} `json:"statusCategory"`
+	} `json:"to"`
+}
+
+// searchPageSize is the number of issues requested per search page
+const searchPageSize = 100
+
+// New creates a client for the configured Jira instance
+func New(cfg Config) *Client {
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	apiURL := cfg.APIURL
+	if apiURL == "" {
+		apiURL = cfg.BaseURL
+	}
+	return &Client{
+		baseURL:    strings.TrimRight(cfg.BaseURL, "/"),
+		apiURL:     strings.TrimRight(apiURL, "/"),
+		server:     cfg.Deployment == DeploymentServer,
+		username:   cfg.Username,
+		apiToken:   cfg.APIToken,
+		tokens:     cfg.TokenSource,
+		httpClient: httpClient,
+	}
+}
+
+// Quiet returns a client that avoids notifying users: edits are sent with
+// notifyUsers=false (honoured by Jira only for admins and project admins)
+// and the bot stops watching the issues it creates. Use it for backfills.
+func (c *Client) Quiet() *Client {
+	return &Client{
+		baseURL:    c.baseURL,
+		apiURL:     c.apiURL,
+		server:     c.server,
+		username:   c.username,
+		apiToken:   c.apiToken,
+		tokens:     c.tokens,
+		httpClient: c.httpClient,
+		quiet:      true,
+	}
+}
+
+// IsQuiet reports whether notifications are suppressed
+func (c *Client) IsQuiet() bool {
+	return c.quiet
+}
+
+// Deployment returns DeploymentCloud or DeploymentServer
+func (c *Client) Deployment() string {
+	if c.server {
+		return DeploymentServer
+	}
+	return DeploymentCloud
+}
+
+// UserRef returns the reference to a user in issue fields: the account ID
+// on Jira Cloud and the username on Jira Server and Data Center
+func (c *Client) UserRef(id string) map[string]string {
+	if c.server {
+		return map[string]string{"name": id}
+	}
+	return map[string]string{"accountId": id}
+}
+
+// Mention returns the wiki markup mentioning a user: [~accountid:ID] on
+// Jira Cloud and [~username] on Jira Server and Data Center
+func (c *Client) Mention(id string) string {
+	if c.server {
+		return "[~" + id + "]"
+	}
+	return "[~accountid:" + id + "]"
+}
+
+// userRefs converts the user fields given as plain strings into user
+// references; other fields are passed on unchanged
+func (c *Client) userRefs(fields map[string]interface{}) map[string]interface{} {
+	var out map[string]interface{}
+	for _, name := range userFields {
+		id, ok := fields[name].(string)
+		if !ok || id == "" {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]interface{}, len(fields))
+			for k, v := range fields {
+				out[k] = v
+			}
+		}
+		out[name] = c.UserRef(id)
+	}
+	if out == nil {
+		return fields
+	}
+	return out
+}
+
+// BaseURL returns the base URL of the Jira instance
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+// BrowseURL returns the web URL of an issue
+func (c *Client) BrowseURL(key string) string {
+	return fmt.Sprintf("%s/browse/%s", c.baseURL, key)
+}
+
+// CreateIssue creates an issue with the given fields
+func (c *Client) CreateIssue(ctx context.Context, fields map[string]interface{}) (*CreatedIssue, error) {
+	var created CreatedIssue
+	if err := c.do(ctx, http.MethodPost, "/rest/api/2/issue", nil, map[string]interface{}{"fields": c.userRefs(fields)}, &created); err != nil {
+		return nil, err
+	}
+
+	if c.quiet {
+		// Jira adds the reporter as a watcher automatically, which makes
+		// every later change send mail to the bot account
+		if err := c.unwatch(ctx, created.Key); err != nil {
+			log.Printf("Failed to remove automatic watcher from %s: %v", created.Key, err)
+		}
+	}
+	return &created, nil
+}
+
+// MaxBulkIssues is the most issues Jira creates in one bulk request
+const MaxBulkIssues = 50
+
+// BulkResult is the outcome of one issue of a bulk creation: the created
+// issue or the error Jira reported for it
+type BulkResult struct {
+	Issue *CreatedIssue
+	Err   error
+}
+
+// bulkResponse is the response to a bulk creation. Jira lists the created
+// issues in request order and reports each failed one by its index.
+type bulkResponse struct {
+	Issues []*CreatedIssue `json:"issues"`
+	Errors []struct {
+		Status              int             `json:"status"`
+		ElementErrors       json.RawMessage `json:"elementErrors"`
+		FailedElementNumber int             `json:"failedElementNumber"`
+	} `json:"errors"`
+}
+
+// CreateIssues creates up to MaxBulkIssues issues in one request. The
+// results are in the order of fieldsList; an error is only returned when
+// the request as a whole failed.
+func (c *Client) CreateIssues(ctx context.Context, fieldsList []map[string]interface{}) ([]BulkResult, error) {
+	if len(fieldsList) > MaxBulkIssues {
+		return nil, fmt.Errorf("at most %d issues can be created in bulk, got %d", MaxBulkIssues, len(fieldsList))
+	}
+	updates := make([]map[string]interface{}, len(fieldsList))
+	for i, fields := range fieldsList {
+		updates[i] = map[string]interface{}{"fields": c.userRefs(fields)}
+	}
+	var resp bulkResponse
+	err := c.do(ctx, http.MethodPost, "/rest/api/2/issue/bulk", nil, map[string]interface{}{"issueUpdates": updates}, &resp)
+	if err != nil {
+		// Jira answers 400 with the errors of each issue when none was
+		// created
+		var jerr *Error
+		if !errors.As(err, &jerr) || jerr.StatusCode != http.StatusBadRequest || json.Unmarshal([]byte(jerr.Body), &resp) != nil || len(resp.Errors) == 0 {
+			return nil, err
+		}
+	}
+
+	results := make([]BulkResult, len(fieldsList))
+	for _, e := range resp.Errors {
+		if e.FailedElementNumber < 0 || e.FailedElementNumber >= len(results) {
+			continue
+		}
+		results[e.FailedElementNumber].Err = &Error{Status: fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status)), StatusCode: e.Status, Body: string(e.ElementErrors)}
+	}
+	created := resp.Issues
+	for i := range results {
+		if results[i].Err != nil {
+			continue
+		}
+		if len(created) == 0 {
+			results[i].Err = fmt.Errorf("Jira reported neither an issue nor an error for bulk item %d", i)
+			continue
+		}
+		results[i].Issue, created = created[0], created[1:]
+		if c.quiet {
+			if err := c.unwatch(ctx, results[i].Issue.Key); err != nil {
+				log.Printf("Failed to remove automatic watcher from %s: %v", results[i].Issue.Key, err)
+			}
+		}
+	}
+	return results, nil
+}
+
+// UpdateIssue edits the fields of an existing issue
+func (c *Client) UpdateIssue(ctx context.Context, key string, fields map[string]interface{}) error {
+	return c.do(ctx, http.MethodPut, "/rest/api/2/issue/"+url.PathEscape(key), c.notifyQuery(), map[string]interface{}{"fields": c.userRefs(fields)}, nil)
+}
+
+// EditIssue sets fields of an issue and applies update operations such as
+// {"labels": [{"add": "bug"}]} to others; either may be nil
+func (c *Client) EditIssue(ctx context.Context, key string, fields map[string]interface{}, update map[string][]map[string]interface{}) error {
+	body := map[string]interface{}{}
+	if len(fields) > 0 {
+		body["fields"] = c.userRefs(fields)
+	}
+	if len(update) > 0 {
+		body["update"] = update
+	}
+	return c.do(ctx, http.MethodPut, "/rest/api/2/issue/"+url.PathEscape(key), c.notifyQuery(), body, nil)
+}
+
+// AddLabels adds labels to an issue, keeping its other labels
+func (c *Client) AddLabels(ctx context.Context, key string, labels ...string) error {
+	ops := make([]map[string]string, len(labels))
+	for i, l := range labels {
+		ops[i] = map[string]string{"add": l}
+	}
+	body := map[string]interface{}{"update": map[string]interface{}{"labels": ops}}
+	return c.do(ctx, http.MethodPut, "/rest/api/2/issue/"+url.PathEscape(key), c.notifyQuery(), body, nil)
+}
+
+// AddAttachment uploads content as a file attached to an issue
+func (c *Client) AddAttachment(ctx context.Context, key, filename string, content []byte) (*Attachment, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("file", filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode attachment: %w", err)
+	}
+	part.Write(content)
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode attachment: %w", err)
+	}
+	var created []*Attachment
+	path := "/rest/api/2/issue/" + url.PathEscape(key) + "/attachments"
+	if err := c.send(ctx, http.MethodPost, path, nil, &body, w.FormDataContentType(), &created); err != nil {
+		return nil, err
+	}
+	if len(created) == 0 {
+		return nil, errors.New("Jira returned no attachment")
+	}
+	return created[0], nil
+}
+
+// DeleteAttachment removes a file attached to an issue
+func (c *Client) DeleteAttachment(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/rest/api/2/attachment/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// DeleteIssue deletes an issue together with its subtasks
+func (c *Client) DeleteIssue(ctx context.Context, key string) error {
+	return c.do(ctx, http.MethodDelete, "/rest/api/2/issue/"+url.PathEscape(key), url.Values{"deleteSubtasks": []string{"true"}}, nil, nil)
+}
+
+// AddComment adds a comment to an issue and returns its ID
+func (c *Client) AddComment(ctx context.Context, key, body string) (string, error) {
+	var created struct {
+		ID string `json:"id"`
+	}
+	path := "/rest/api/2/issue/" + url.PathEscape(key) + "/comment"
+	if err := c.do(ctx, http.MethodPost, path, nil, map[string]string{"body": body}, &created); err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+// Comments returns the comments of an issue, oldest first
+func (c *Client) Comments(ctx context.Context, key string) ([]*Comment, error) {
+	var all []*Comment
+	for startAt := 0; ; {
+		var page struct {
+			StartAt  int        `json:"startAt"`
+			Total    int        `json:"total"`
+			Comments []*Comment `json:"comments"`
+		}
+		q := url.Values{
+			"orderBy":    []string{"created"},
+			"startAt":    []string{strconv.Itoa(startAt)},
+			"maxResults": []string{strconv.Itoa(searchPageSize)},
+		}
+		if err := c.do(ctx, http.MethodGet, "/rest/api/2/issue/"+url.PathEscape(key)+"/comment", q, nil, &page); err != nil {
+			return nil, err
+		}
+		all = append(all, page.Comments...)
+		startAt = page.StartAt + len(page.Comments)
+		if len(page.Comments) == 0 || startAt >= page.Total {
+			return all, nil
+		}
+	}
+}
+
+// UpdateComment replaces the body of a comment
+func (c *Client) UpdateComment(ctx context.Context, key, id, body string) error {
+	path := "/rest/api/2/issue/" + url.PathEscape(key) + "/comment/" + url.PathEscape(id)
+	return c.do(ctx, http.MethodPut, path, c.notifyQuery(), map[string]string{"body": body}, nil)
+}
+
+// LinkIssues links outwardKey to inwardKey with the named link type, such
+// as "Relates"
+func (c *Client) LinkIssues(ctx context.Context, linkType, inwardKey, outwardKey string) error {
+	link := map[string]interface{}{
+		"type":         map[string]string{"name": linkType},
+		"inwardIssue":  map[string]string{"key": inwardKey},
+		"outwardIssue": map[string]string{"key": outwardKey},
+	}
+	return c.do(ctx, http.MethodPost, "/rest/api/2/issueLink", nil, link, nil)
+}
+
+// AddRemoteLink links an issue to a page outside Jira, or updates the link
+// with the same global ID
+func (c *Client) AddRemoteLink(ctx context.Context, key string, link RemoteLink) error {
+	object := map[string]interface{}{
+		"url":    link.URL,
+		"title":  link.Title,
+		"status": map[string]bool{"resolved": link.Resolved},
+	}
+	if link.Summary != "" {
+		object["summary"] = link.Summary
+	}
+	body := map[string]interface{}{"globalId": link.GlobalID, "object": object}
+	return c.do(ctx, http.MethodPost, "/rest/api/2/issue/"+url.PathEscape(key)+"/remotelink", nil, body, nil)
+}
+
+// SetIssueProperty stores value as JSON in the named property of an issue,
+// replacing its previous value
+func (c *Client) SetIssueProperty(ctx context.Context, key, property string, value interface{}) error {
+	path := "/rest/api/2/issue/" + url.PathEscape(key) + "/properties/" + url.PathEscape(property)
+	return c.do(ctx, http.MethodPut, path, nil, value, nil)
+}
+
+// DeleteIssueLink removes a link between two issues
+func (c *Client) DeleteIssueLink(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/rest/api/2/issueLink/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// Transitions returns the transitions currently available for an issue
+func (c *Client) Transitions(ctx context.Context, key string) ([]*Transition, error) {
+	var resp struct {
+		Transitions []*Transition `json:"transitions"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/rest/api/2/issue/"+url.PathEscape(key)+"/transitions", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Transitions, nil
+}
+
+// TransitionIssue moves an issue through a transition, setting the fields
+// of the transition screen, such as the resolution
+func (c *Client) TransitionIssue(ctx context.Context, key, transitionID string, fields map[string]interface{}) error {
+	body := map[string]interface{}{"transition": map[string]string{"id": transitionID}}
+	if len(fields) > 0 {
+		body["fields"] = fields
+	}
+	return c.do(ctx, http.MethodPost, "/rest/api/2/issue/"+url.PathEscape(key)+"/transitions", c.notifyQuery(), body, nil)
+}
+
+// GetIssue returns the issue with the given key. Only the listed fields are
+// fetched; nil fetches all of them.
+func (c *Client) GetIssue(ctx context.Context, key string, fields []string) (*Issue, error) {
+	var q url.Values
+	if fields != nil {
+		q = url.Values{"fields": []string{strings.Join(fields, ",")}}
+	}
+	var issue Issue
+	if err := c.do(ctx, http.MethodGet, "/rest/api/2/issue/"+url.PathEscape(key), q, nil, &issue); err != nil {
+		return nil, err
+	}
+	return &issue, nil
+}
+
+// Search calls fn for every issue matching jql, fetching the listed fields
+func (c *Client) Search(ctx context.Context, jql string, fields []string, fn func(*Issue) error) error {
+	if !c.server {
+		return c.searchJQL(ctx, jql, fields, fn)
+	}
+	for startAt := 0; ; {
+		var page struct {
+			StartAt    int      `json:"startAt"`
+			MaxResults int      `json:"maxResults"`
+			Total      int      `json:"total"`
+			Issues     []*Issue `json:"issues"`
+		}
+		req := map[string]interface{}{
+			"jql":        jql,
+			"startAt":    startAt,
+			"maxResults": searchPageSize,
+			"fields":     fields,
+		}
+		if err := c.do(ctx, http.MethodPost, "/rest/api/2/search", nil, req, &page); err != nil {
+			return err
+		}
+		for _, issue := range page.Issues {
+			if err := fn(issue); err != nil {
+				return err
+			}
+		}
+		startAt += len(page.Issues)
+		if len(page.Issues) == 0 || startAt >= page.Total {
+			return nil
+		}
+	}
+}
+
+// searchJQL implements Search with the token paginated search of Jira Cloud,
+// which replaced the offset paginated one
+func (c *Client) searchJQL(ctx context.Context, jql string, fields []string, fn func(*Issue) error) error {
+	for token := ""; ; {
+		var page struct {
+			Issues        []*Issue `json:"issues"`
+			NextPageToken string   `json:"nextPageToken"`
+			IsLast        bool     `json:"isLast"`
+		}
+		req := map[string]interface{}{
+			"jql":        jql,
+			"maxResults": searchPageSize,
+			"fields":     fields,
+		}
+		if token != "" {
+			req["nextPageToken"] = token
+		}
+		if err := c.do(ctx, http.MethodPost, "/rest/api/2/search/jql", nil, req, &page); err != nil {
+			return err
+		}
+		for _, issue := range page.Issues {
+			if err := fn(issue); err != nil {
+				return err
+			}
+		}
+		if page.IsLast || page.NextPageToken == "" {
+			return nil
+		}
+		token = page.NextPageToken
+	}
+}
+
+// Project returns a project with its issue types
+func (c *Client) Project(ctx context.Context, projectKey string) (*Project, error) {
+	var p Project
+	if err := c.do(ctx, http.MethodGet, "/rest/api/2/project/"+url.PathEscape(projectKey), nil, nil, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// MyPermissions reports which of the given permissions, such as
+// CREATE_ISSUES, the authenticated user has in a project
+func (c *Client) MyPermissions(ctx context.Context, projectKey string, permissions ...string) (map[string]bool, error) {
+	query := url.Values{"projectKey": {projectKey}, "permissions": {strings.Join(permissions, ",")}}
+	var out struct {
+		Permissions map[string]struct {
+			HavePermission bool `json:"havePermission"`
+		} `json:"permissions"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/rest/api/2/mypermissions", query, nil, &out); err != nil {
+		return nil, err
+	}
+	have := make(map[string]bool, len(permissions))
+	for _, p := range permissions {
+		have[p] = out.Permissions[p].HavePermission
+	}
+	return have, nil
+}
+
+// Fields returns the system and custom fields of the site
+func (c *Client) Fields(ctx context.Context) ([]*Field, error) {
+	var fields []*Field
+	if err := c.do(ctx, http.MethodGet, "/rest/api/2/field", nil, nil, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// ProjectVersions returns the versions of a project
+func (c *Client) ProjectVersions(ctx context.Context, projectKey string) ([]*Version, error) {
+	var versions []*Version
+	if err := c.do(ctx, http.MethodGet, "/rest/api/2/project/"+url.PathEscape(projectKey)+"/versions", nil, nil, &versions); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// UpdateVersion edits the fields of a version, such as its description
+func (c *Client) UpdateVersion(ctx context.Context, id string, fields map[string]interface{}) error {
+	return c.do(ctx, http.MethodPut, "/rest/api/2/version/"+url.PathEscape(id), nil, fields, nil)
+}
+
+// ActiveSprints returns the active sprints of a board of Jira Software
+func (c *Client) ActiveSprints(ctx context.Context, boardID int) ([]*Sprint, error) {
+	var all []*Sprint
+	for startAt := 0; ; {
+		var page struct {
+			IsLast bool      `json:"isLast"`
+			Values []*Sprint `json:"values"`
+		}
+		q := url.Values{"state": []string{"active"}, "startAt": []string{strconv.Itoa(startAt)}}
+		if err := c.do(ctx, http.MethodGet, "/rest/agile/1.0/board/"+strconv.Itoa(boardID)+"/sprint", q, nil, &page); err != nil {
+			return nil, err
+		}
+		all = append(all, page.Values...)
+		if page.IsLast || len(page.Values) == 0 {
+			return all, nil
+		}
+		startAt += len(page.Values)
+	}
+}
+
+// MoveToSprint moves issues to a sprint
+func (c *Client) MoveToSprint(ctx context.Context, sprintID int, keys ...string) error {
+	path := "/rest/agile/1.0/sprint/" + strconv.Itoa(sprintID) + "/issue"
+	return c.do(ctx, http.MethodPost, path, nil, map[string][]string{"issues": keys}, nil)
+}
+
+// MoveToBacklog moves issues to the backlog of their boards, out of any
+// sprint
+func (c *Client) MoveToBacklog(ctx context.Context, keys ...string) error {
+	return c.do(ctx, http.MethodPost, "/rest/agile/1.0/backlog/issue", nil, map[string][]string{"issues": keys}, nil)
+}
+
+// Myself returns the user the client is authenticated as
+func (c *Client) Myself(ctx context.Context) (*User, error) {
+	c.myselfOnce.Do(func() {
+		var u User
+		if err := c.do(ctx, http.MethodGet, "/rest/api/2/myself", nil, nil, &u); err != nil {
+			c.myselfErr = err
+			return
+		}
+		c.myself = &u
+	})
+	return c.myself, c.myselfErr
+}
+
+// RemoveWatcher stops user from watching the issue
+func (c *Client) RemoveWatcher(ctx context.Context, key string, user *User) error {
+	q := url.Values{}
+	if user.AccountID != "" {
+		q.Set("accountId", user.AccountID)
+	} else {
+		q.Set("username", user.Name)
+	}
+	return c.do(ctx, http.MethodDelete, "/rest/api/2/issue/"+url.PathEscape(key)+"/watchers", q, nil, nil)
+}
+
+// unwatch removes the authenticated user from the watchers of an issue
+func (c *Client) unwatch(ctx context.Context, key string) error {
+	me, err := c.Myself(ctx)
+	if err != nil {
+		return err
+	}
+	return c.RemoveWatcher(ctx, key, me)
+}
+
+// notifyQuery returns the query parameters controlling notifications
+func (c *Client) notifyQuery() url.Values {
+	if !c.quiet {
+		return nil
+	}
+	return url.Values{"notifyUsers": []string{"false"}}
+}
+
+// do sends a request to the Jira API, encoding in as the JSON body and
+// decoding the JSON response into out when they are non-nil
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to marshal Jira request: %w", err)
+		}
+		body, contentType = bytes.NewReader(data), "application/json"
+	}
+	return c.send(ctx, method, path, query, body, contentType, out)
+}
+
+// send sends a request with a body of contentType to the Jira API and
+// decodes the JSON response into out
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body io.Reader, contentType string, out interface{}) error {
+	u := c.apiURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return fmt.Errorf("failed to create Jira request: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if strings.HasPrefix(contentType, "multipart/") {
+		// Jira rejects uploads without it as cross-site requests
+		req.Header.Set("X-Atlassian-Token", "no-check")
+	}
+	if c.tokens != nil {
+		token, err := c.tokens.Token()
+		if err != nil {
+			return fmt.Errorf("failed to get Jira OAuth token: %w", err)
+		}
+		token.SetAuthHeader(req)
+	} else if c.server && c.username == "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiToken)
+	} else {
+		req.SetBasicAuth(c.username, c.apiToken)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	log.Printf("Sending %s %s to Jira API", method, path)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	// The body is part of the returned error; successful responses are
+	// logged in full by the HTTP debug mode
+	log.Printf("Jira API response for %s %s - Status: %s", method, path, resp.Status)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &Error{Status: resp.Status, StatusCode: resp.StatusCode, Body: string(data)}
+	}
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("failed to parse Jira response: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package jira
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// DefaultTokenURL is the Atlassian Cloud OAuth 2.0 token endpoint
+const DefaultTokenURL = "https://auth.atlassian.com/oauth/token"
+
+// OAuthConfig configures OAuth 2.0 authentication. With a RefreshToken,
+// obtained once through the authorization code (3LO) flow, access tokens are
+// refreshed with it; otherwise the client credentials flow is used.
+type OAuthConfig struct {
+	ClientID     string
+	ClientSecret string
+	// TokenURL defaults to DefaultTokenURL
+	TokenURL     string
+	RefreshToken string
+	Scopes       []string
+	// OnRefreshTokenChange is called with the new refresh token when the
+	// token endpoint rotates it, so it can be persisted. The previous one
+	// stops working soon after.
+	OnRefreshTokenChange func(refreshToken string)
+	// HTTPClient is used to request tokens; defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// NewOAuthTokenSource returns a token source that requests and refreshes
+// access tokens as configured. Pass it as Config.TokenSource.
+func NewOAuthTokenSource(cfg OAuthConfig) oauth2.TokenSource {
+	tokenURL := cfg.TokenURL
+	if tokenURL == "" {
+		tokenURL = DefaultTokenURL
+	}
+	ctx := context.Background()
+	if cfg.HTTPClient != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, cfg.HTTPClient)
+	}
+
+	if cfg.RefreshToken == "" {
+		cc := &clientcredentials.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			TokenURL:     tokenURL,
+			Scopes:       cfg.Scopes,
+		}
+		return cc.TokenSource(ctx)
+	}
+
+	oc := &oauth2.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		Endpoint:     oauth2.Endpoint{TokenURL: tokenURL, AuthStyle: oauth2.AuthStyleInParams},
+		Scopes:       cfg.Scopes,
+	}
+	return &rotationNotifier{
+		src:          oc.TokenSource(ctx, &oauth2.Token{RefreshToken: cfg.RefreshToken}),
+		refreshToken: cfg.RefreshToken,
+		notify:       cfg.OnRefreshTokenChange,
+	}
+}
+
+// rotationNotifier reports rotated refresh tokens of the wrapped source
+type rotationNotifier struct {
+	src    oauth2.TokenSource
+	notify func(string)
+
+	mu           sync.Mutex
+	refreshToken string
+}
+
+// Token implements oauth2.TokenSource
+func (r *rotationNotifier) Token() (*oauth2.Token, error) {
+	t, err := r.src.Token()
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t.RefreshToken != "" && t.RefreshToken != r.refreshToken {
+		r.refreshToken = t.RefreshToken
+		if r.notify != nil {
+			r.notify(t.RefreshToken)
+		}
+	}
+	return t, nil
+}
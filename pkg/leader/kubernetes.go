@@ -0,0 +1,220 @@
+package leader
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// serviceAccountDir holds the credentials Kubernetes mounts into pods
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// microTime is the timestamp format of Lease times
+const microTime = "2006-01-02T15:04:05.000000Z07:00"
+
+// errConflict is returned when a Lease was changed by another replica
+// between reading and writing it
+var errConflict = errors.New("lease was changed concurrently")
+
+// lease is a coordination.k8s.io/v1 Lease
+type lease struct {
+	APIVersion string        `json:"apiVersion"`
+	Kind       string        `json:"kind"`
+	Metadata   leaseMetadata `json:"metadata"`
+	Spec       leaseSpec     `json:"spec"`
+}
+
+type leaseMetadata struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+}
+
+// expired reports whether the holder of the Lease failed to renew it
+func (s leaseSpec) expired(now time.Time) bool {
+	renewed, err := time.Parse(microTime, s.RenewTime)
+	if err != nil {
+		return true
+	}
+	return now.After(renewed.Add(time.Duration(s.LeaseDurationSeconds) * time.Second))
+}
+
+// kubernetesLock holds the lock in a Lease object, using the in-cluster
+// service account of the pod
+type kubernetesLock struct {
+	namespace string
+	name      string
+	baseURL   string
+	client    *http.Client
+}
+
+// NewKubernetesLock returns the lock held in the named Lease. An empty
+// namespace is the namespace of the pod. The service account of the pod
+// needs permission to get, create and update Leases.
+func NewKubernetesLock(namespace, name string) (Lock, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("Kubernetes leader election requires running in a pod")
+	}
+	if namespace == "" {
+		data, err := os.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the namespace of the pod: %w", err)
+		}
+		namespace = strings.TrimSpace(string(data))
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the Kubernetes CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates found in the Kubernetes CA")
+	}
+	return &kubernetesLock{
+		namespace: namespace,
+		name:      name,
+		baseURL:   "https://" + net.JoinHostPort(host, port),
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}},
+		},
+	}, nil
+}
+
+func (k *kubernetesLock) TryAcquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	l, err := k.get(ctx)
+	if err != nil {
+		return false, err
+	}
+	if l == nil {
+		l = &lease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata:   leaseMetadata{Name: k.name, Namespace: k.namespace},
+		}
+	}
+	if l.Spec.HolderIdentity != "" && l.Spec.HolderIdentity != holder && !l.Spec.expired(now) {
+		return false, nil
+	}
+	if l.Spec.HolderIdentity != holder {
+		l.Spec.AcquireTime = now.UTC().Format(microTime)
+		if l.Metadata.ResourceVersion != "" {
+			l.Spec.LeaseTransitions++
+		}
+	}
+	l.Spec.HolderIdentity = holder
+	l.Spec.LeaseDurationSeconds = int((ttl + time.Second - 1) / time.Second)
+	l.Spec.RenewTime = now.UTC().Format(microTime)
+
+	err = k.put(ctx, l)
+	if errors.Is(err, errConflict) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (k *kubernetesLock) Release(ctx context.Context, holder string) error {
+	l, err := k.get(ctx)
+	if err != nil || l == nil || l.Spec.HolderIdentity != holder {
+		return err
+	}
+	l.Spec.HolderIdentity = ""
+	l.Spec.LeaseDurationSeconds = 1
+	l.Spec.RenewTime = time.Now().UTC().Format(microTime)
+	return k.put(ctx, l)
+}
+
+// leasesURL returns the URL of the Leases of the namespace
+func (k *kubernetesLock) leasesURL() string {
+	return fmt.Sprintf("%s/apis/coordination.k8s.io/v1/namespaces/%s/leases", k.baseURL, k.namespace)
+}
+
+// get returns the Lease, or nil if it doesn't exist
+func (k *kubernetesLock) get(ctx context.Context) (*lease, error) {
+	var l lease
+	status, err := k.do(ctx, http.MethodGet, k.leasesURL()+"/"+k.name, nil, &l)
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// put creates the Lease, or updates it if it was read from the API server.
+// The resource version makes the update fail with errConflict if another
+// replica changed the Lease in between.
+func (k *kubernetesLock) put(ctx context.Context, l *lease) error {
+	method, url := http.MethodPut, k.leasesURL()+"/"+k.name
+	if l.Metadata.ResourceVersion == "" {
+		method, url = http.MethodPost, k.leasesURL()
+	}
+	status, err := k.do(ctx, method, url, l, nil)
+	if status == http.StatusConflict {
+		return errConflict
+	}
+	return err
+}
+
+// do sends an API request authenticated with the service account token,
+// which is read on every request because Kubernetes rotates it
+func (k *kubernetesLock) do(ctx context.Context, method, url string, in, out interface{}) (int, error) {
+	token, err := os.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the service account token: %w", err)
+	}
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return 0, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("Kubernetes API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return resp.StatusCode, fmt.Errorf("Kubernetes API %s %s returned %s: %s", method, url, resp.Status, bytes.TrimSpace(msg))
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("invalid Kubernetes API response: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
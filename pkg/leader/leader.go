@@ -0,0 +1,196 @@
+// Package leader elects one of several replicas as the leader.
+//
+// The replicas compete for a lock with an expiry, held in the shared state
+// store or in a Kubernetes Lease. The leader renews the lock every third of
+// its duration and steps down if it can't renew it before two thirds have
+// passed, so it has stopped before another replica can take over.
+package leader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+// Lock is a lock with an expiry that replicas compete for
+type Lock interface {
+	// TryAcquire acquires the lock for holder, or renews it if holder
+	// already has it, for ttl. It reports false if another holder has an
+	// unexpired lock.
+	TryAcquire(ctx context.Context, holder string, ttl time.Duration) (bool, error)
+	// Release gives up the lock if holder has it
+	Release(ctx context.Context, holder string) error
+}
+
+// storeLock holds the lock as a lease in the state store
+type storeLock struct {
+	locker state.Locker
+	name   string
+}
+
+// NewStoreLock returns the lock held as the named lease in a state store
+// shared by the replicas
+func NewStoreLock(locker state.Locker, name string) Lock {
+	return &storeLock{locker: locker, name: name}
+}
+
+func (l *storeLock) TryAcquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	return l.locker.AcquireLease(ctx, l.name, holder, ttl)
+}
+
+func (l *storeLock) Release(ctx context.Context, holder string) error {
+	return l.locker.ReleaseLease(ctx, l.name, holder)
+}
+
+// DefaultIdentity identifies the replica by its host name, which is the pod
+// name in Kubernetes, and its process ID
+func DefaultIdentity() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// Elector keeps trying to acquire a lock and tracks whether this replica
+// is the leader
+type Elector struct {
+	lock     Lock
+	identity string
+	ttl      time.Duration
+
+	mu sync.Mutex
+	// term is cancelled when the leadership ends; nil while not leading
+	term      context.Context
+	endTerm   context.CancelFunc
+	renewedAt time.Time
+
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// NewElector returns an elector competing for lock as identity
+func NewElector(lock Lock, identity string, ttl time.Duration) *Elector {
+	return &Elector{lock: lock, identity: identity, ttl: ttl}
+}
+
+// Identity returns the identity the elector competes as
+func (e *Elector) Identity() string {
+	return e.identity
+}
+
+// Start makes a first attempt to acquire the lock and then keeps acquiring
+// or renewing it in the background until Stop is called
+func (e *Elector) Start(ctx context.Context) {
+	ctx, e.stop = context.WithCancel(ctx)
+	e.done = make(chan struct{})
+	e.attempt(ctx)
+	go func() {
+		defer close(e.done)
+		ticker := time.NewTicker(e.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				e.attempt(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops competing for the lock and releases it if this replica is the
+// leader
+func (e *Elector) Stop() {
+	if e.stop == nil {
+		return
+	}
+	e.stop()
+	<-e.done
+
+	e.mu.Lock()
+	leading := e.term != nil
+	e.mu.Unlock()
+	e.step(false)
+	if !leading {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), e.ttl/3)
+	defer cancel()
+	if err := e.lock.Release(ctx, e.identity); err != nil {
+		log.Printf("Leader election: failed to release the lock: %v", err)
+		return
+	}
+	log.Printf("Leader election: released the lock")
+}
+
+// IsLeader reports whether this replica is the leader
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.term != nil
+}
+
+// Leading returns a context of parent that is also cancelled when the
+// leadership ends, or false if this replica isn't the leader
+func (e *Elector) Leading(parent context.Context) (context.Context, context.CancelFunc, bool) {
+	e.mu.Lock()
+	term := e.term
+	e.mu.Unlock()
+	if term == nil {
+		return nil, nil, false
+	}
+	ctx, cancel := context.WithCancel(parent)
+	stop := context.AfterFunc(term, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}, true
+}
+
+// attempt acquires or renews the lock once. A leader that fails to renew
+// keeps leading until two thirds of the lock duration passed.
+func (e *Elector) attempt(ctx context.Context) {
+	reqCtx, cancel := context.WithTimeout(ctx, e.ttl/3)
+	defer cancel()
+	ok, err := e.lock.TryAcquire(reqCtx, e.identity, e.ttl)
+	if ctx.Err() != nil {
+		// Stopping
+		return
+	}
+	if err != nil {
+		log.Printf("Leader election: failed to acquire the lock: %v", err)
+		e.mu.Lock()
+		expired := time.Since(e.renewedAt) > e.ttl*2/3
+		e.mu.Unlock()
+		if expired {
+			e.step(false)
+		}
+		return
+	}
+	e.step(ok)
+}
+
+// step records the outcome of an attempt, starting or ending the term
+func (e *Elector) step(leading bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if leading {
+		e.renewedAt = time.Now()
+	}
+	switch {
+	case leading && e.term == nil:
+		e.term, e.endTerm = context.WithCancel(context.Background())
+		log.Printf("Leader election: %s became the leader", e.identity)
+	case !leading && e.term != nil:
+		e.endTerm()
+		e.term, e.endTerm = nil, nil
+		log.Printf("Leader election: %s is no longer the leader", e.identity)
+	}
+}
@@ -0,0 +1,146 @@
+// Package notify posts gh-jira events to Slack and Microsoft Teams.
+//
+// Messages are Go templates rendered per event kind. Templates format links
+// with the link function, which uses the markup of each chat service.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"text/template"
+)
+
+// Event kinds
+const (
+	// EventCreated is sent when a Jira issue was created from a GitHub issue
+	EventCreated = "created"
+	// EventFailed is sent when a GitHub issue permanently failed to sync
+	EventFailed = "failed"
+	// EventOverdue is sent when a synced issue had no Jira activity within
+	// the triage SLA
+	EventOverdue = "overdue"
+	// EventStarted is sent when the sync service starts
+	EventStarted = "started"
+	// EventStopped is sent when the sync service stops
+	EventStopped = "stopped"
+)
+
+// Kinds lists the event kinds
+var Kinds = []string{EventCreated, EventFailed, EventOverdue, EventStarted, EventStopped}
+
+// DefaultTemplates are the messages of the event kinds
+var DefaultTemplates = map[string]string{
+	EventCreated: `Created {{link .JiraURL .JiraKey}} from {{link .IssueURL (printf "%s#%d" .Repo .Issue)}} {{.Title}}`,
+	EventFailed:  `Failed to sync {{link .IssueURL (printf "%s#%d" .Repo .Issue)}} {{.Title}} after {{.Attempts}} attempts: {{.Error}}`,
+	EventOverdue: `{{link .JiraURL .JiraKey}} of {{link .IssueURL (printf "%s#%d" .Repo .Issue)}} {{.Title}} has had no Jira activity for {{.Idle}}`,
+	EventStarted: `gh-jira started on {{.Host}}`,
+	EventStopped: `gh-jira stopped on {{.Host}}{{if .Error}}: {{.Error}}{{end}}`,
+}
+
+// Event is something to notify of. Its fields are available to the
+// templates; fields that don't apply to the kind are empty.
+type Event struct {
+	Kind     string
+	Repo     string
+	Issue    int
+	IssueURL string
+	Title    string
+	JiraKey  string
+	JiraURL  string
+	Attempts int
+	// Idle is how long an overdue issue had no Jira activity, such as 48h
+	Idle  string
+	Error string
+	Host  string
+}
+
+// Notifier posts messages to a chat service
+type Notifier interface {
+	// Name identifies the notifier in errors
+	Name() string
+	// Link formats a link in the markup of the chat service
+	Link(url, text string) string
+	// Notify posts text
+	Notify(ctx context.Context, text string) error
+}
+
+// Dispatcher renders events and posts them to the notifiers
+type Dispatcher struct {
+	targets []target
+	enabled map[string]bool
+}
+
+// target is a notifier with the templates bound to its link markup
+type target struct {
+	notifier  Notifier
+	templates map[string]*template.Template
+}
+
+// New creates a dispatcher posting the given event kinds, or all kinds if
+// empty, to the notifiers. templates override DefaultTemplates by kind.
+func New(notifiers []Notifier, kinds []string, templates map[string]string) (*Dispatcher, error) {
+	if len(kinds) == 0 {
+		kinds = Kinds
+	}
+	d := &Dispatcher{enabled: make(map[string]bool)}
+	for _, k := range kinds {
+		if _, ok := DefaultTemplates[k]; !ok {
+			return nil, fmt.Errorf("unknown notification event %q, expected one of %v", k, Kinds)
+		}
+		d.enabled[k] = true
+	}
+	for k := range templates {
+		if _, ok := DefaultTemplates[k]; !ok {
+			return nil, fmt.Errorf("template of unknown notification event %q", k)
+		}
+	}
+
+	for _, n := range notifiers {
+		t := target{notifier: n, templates: make(map[string]*template.Template)}
+		for kind, text := range DefaultTemplates {
+			if custom, ok := templates[kind]; ok {
+				text = custom
+			}
+			tmpl, err := template.New(kind).Funcs(template.FuncMap{"link": link(n)}).Parse(text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s notification template: %w", kind, err)
+			}
+			t.templates[kind] = tmpl
+		}
+		d.targets = append(d.targets, t)
+	}
+	return d, nil
+}
+
+// link returns the template function formatting links for n. Links without
+// a URL are rendered as their text.
+func link(n Notifier) func(url, text string) string {
+	return func(url, text string) string {
+		if url == "" {
+			return text
+		}
+		return n.Link(url, text)
+	}
+}
+
+// Send posts e to every notifier unless its kind is disabled. A nil
+// Dispatcher sends nothing.
+func (d *Dispatcher) Send(ctx context.Context, e Event) error {
+	if d == nil || !d.enabled[e.Kind] {
+		return nil
+	}
+	var errs []error
+	for _, t := range d.targets {
+		var buf bytes.Buffer
+		if err := t.templates[e.Kind].Execute(&buf, e); err != nil {
+			errs = append(errs, fmt.Errorf("%s: failed to render %s message: %w", t.notifier.Name(), e.Kind, err))
+			continue
+		}
+		if err := t.notifier.Notify(ctx, buf.String()); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", t.notifier.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,26 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/savitaashture/gh-jira/pkg/slack"
+)
+
+// Slack posts to a Slack incoming webhook
+type Slack struct {
+	WebhookURL string
+}
+
+// Name implements Notifier
+func (s *Slack) Name() string { return "slack" }
+
+// Link implements Notifier with Slack's mrkdwn links
+func (s *Slack) Link(url, text string) string {
+	return fmt.Sprintf("<%s|%s>", url, text)
+}
+
+// Notify implements Notifier
+func (s *Slack) Notify(ctx context.Context, text string) error {
+	return slack.Post(ctx, s.WebhookURL, slack.Message{Text: text})
+}
@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Teams posts to a Microsoft Teams incoming webhook, either an Office 365
+// connector or a Workflows webhook. Both accept an Adaptive Card.
+type Teams struct {
+	WebhookURL string
+}
+
+// teamsMessage is a message with a single Adaptive Card
+type teamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+type teamsAttachment struct {
+	ContentType string    `json:"contentType"`
+	Content     teamsCard `json:"content"`
+}
+
+type teamsCard struct {
+	Schema  string           `json:"$schema"`
+	Type    string           `json:"type"`
+	Version string           `json:"version"`
+	Body    []teamsTextBlock `json:"body"`
+}
+
+type teamsTextBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+	Wrap bool   `json:"wrap"`
+}
+
+// Name implements Notifier
+func (t *Teams) Name() string { return "teams" }
+
+// Link implements Notifier with Markdown links
+func (t *Teams) Link(url, text string) string {
+	return fmt.Sprintf("[%s](%s)", text, url)
+}
+
+// Notify implements Notifier
+func (t *Teams) Notify(ctx context.Context, text string) error {
+	msg := teamsMessage{
+		Type: "message",
+		Attachments: []teamsAttachment{{
+			ContentType: "application/vnd.microsoft.card.adaptive",
+			Content: teamsCard{
+				Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+				Type:    "AdaptiveCard",
+				Version: "1.4",
+				Body:    []teamsTextBlock{{Type: "TextBlock", Text: text, Wrap: true}},
+			},
+		}},
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.WebhookURL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create Teams request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Connectors answer 200 and Workflows 202
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("Teams webhook responded with status %s: %s", resp.Status, body)
+	}
+	return nil
+}
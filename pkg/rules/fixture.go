@@ -0,0 +1,74 @@
+package rules
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Fixture is a sample issue used to exercise a rules file, optionally with
+// the result it is expected to produce. Only the expectations that are set
+// are checked.
+type Fixture struct {
+	Issue  Issue   `yaml:"issue"`
+	Expect *Result `yaml:"expect"`
+}
+
+// LoadFixture reads a fixture from a YAML or JSON file
+func LoadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+	var f Fixture
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture %s: %w", path, err)
+	}
+	return &f, nil
+}
+
+// Check compares res against the fixture expectations and returns a
+// description of every mismatch
+func (f *Fixture) Check(res *Result) []string {
+	if f.Expect == nil {
+		return nil
+	}
+	want := f.Expect
+	var problems []string
+
+	if want.Matched != nil && !equalStrings(want.Matched, res.Matched) {
+		problems = append(problems, fmt.Sprintf("matched rules: want [%s], got [%s]",
+			strings.Join(want.Matched, ", "), strings.Join(res.Matched, ", ")))
+	}
+	if want.Priority != "" && want.Priority != res.Priority {
+		problems = append(problems, fmt.Sprintf("priority: want %q, got %q", want.Priority, res.Priority))
+	}
+	if want.FixVersions != nil && !equalStrings(want.FixVersions, res.FixVersions) {
+		problems = append(problems, fmt.Sprintf("fixVersions: want [%s], got [%s]",
+			strings.Join(want.FixVersions, ", "), strings.Join(res.FixVersions, ", ")))
+	}
+	if want.Labels != nil && !equalStrings(want.Labels, res.Labels) {
+		problems = append(problems, fmt.Sprintf("labels: want [%s], got [%s]",
+			strings.Join(want.Labels, ", "), strings.Join(res.Labels, ", ")))
+	}
+	for name, v := range want.Fields {
+		if got := res.Fields[name]; got != v {
+			problems = append(problems, fmt.Sprintf("field %s: want %q, got %q", name, v, got))
+		}
+	}
+	return problems
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,372 @@
+// Package rules implements the declarative mapping from GitHub issue
+// attributes (labels, milestone, issue template sections) to Jira fields.
+//
+// Rules are evaluated in file order and every matching rule is applied.
+// Scalar values (priority, fix version, custom fields) set by a later rule
+// override earlier ones, while labels accumulate.
+package rules
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Issue is the view of a GitHub issue that rules are evaluated against
+type Issue struct {
+	Number    int      `yaml:"number" json:"number"`
+	Title     string   `yaml:"title" json:"title"`
+	Body      string   `yaml:"body" json:"body"`
+	Labels    []string `yaml:"labels" json:"labels"`
+	Milestone string   `yaml:"milestone" json:"milestone"`
+	Author    string   `yaml:"author" json:"author"`
+}
+
+// File is the on-disk representation of a rules file
+type File struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule maps issues satisfying Match to the Jira values in Set
+type Rule struct {
+	Name  string `yaml:"name"`
+	Match Match  `yaml:"match"`
+	Set   Set    `yaml:"set"`
+}
+
+// Match lists the conditions an issue must satisfy. All non-empty
+// conditions must hold for the rule to match.
+type Match struct {
+	// LabelsAny matches if the issue has at least one of the labels
+	LabelsAny []string `yaml:"labelsAny"`
+	// LabelsAll matches if the issue has every one of the labels
+	LabelsAll []string `yaml:"labelsAll"`
+	// Milestone is a glob matched against the milestone title
+	Milestone string `yaml:"milestone"`
+	// Title is a regular expression matched against the issue title
+	Title string `yaml:"title"`
+	// Sections lists issue template headings that must be present and non-empty
+	Sections []string `yaml:"sections"`
+}
+
+// Set holds the Jira values applied by a rule. Every value is a Go
+// template rendered with the issue as data, e.g. `{{.Milestone}}` or
+// `{{.Section "Version"}}`. Values rendering to an empty string are ignored.
+type Set struct {
+	Priority   string            `yaml:"priority"`
+	FixVersion string            `yaml:"fixVersion"`
+	Labels     []string          `yaml:"labels"`
+	Fields     map[string]string `yaml:"fields"`
+}
+
+// Result is the outcome of evaluating all rules against an issue
+type Result struct {
+	Matched     []string          `yaml:"matched" json:"matched"`
+	Priority    string            `yaml:"priority,omitempty" json:"priority,omitempty"`
+	FixVersions []string          `yaml:"fixVersions,omitempty" json:"fixVersions,omitempty"`
+	Labels      []string          `yaml:"labels,omitempty" json:"labels,omitempty"`
+	Fields      map[string]string `yaml:"fields,omitempty" json:"fields,omitempty"`
+}
+
+// Engine evaluates a compiled set of rules
+type Engine struct {
+	rules []compiledRule
+}
+
+type compiledRule struct {
+	Rule
+	title      *regexp.Regexp
+	priority   *template.Template
+	fixVersion *template.Template
+	labels     []*template.Template
+	fields     map[string]*template.Template
+}
+
+// Load reads and compiles the rules file at path
+func Load(path string) (*Engine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules file: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse compiles rules from YAML data
+func Parse(data []byte) (*Engine, error) {
+	var f File
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse rules: %w", err)
+	}
+
+	e := &Engine{}
+	for i, r := range f.Rules {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		cr, err := compile(r)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+		e.rules = append(e.rules, cr)
+	}
+	return e, nil
+}
+
+func compile(r Rule) (compiledRule, error) {
+	cr := compiledRule{Rule: r, fields: make(map[string]*template.Template)}
+
+	var err error
+	if r.Match.Title != "" {
+		if cr.title, err = regexp.Compile(r.Match.Title); err != nil {
+			return cr, fmt.Errorf("invalid title pattern: %w", err)
+		}
+	}
+	if r.Match.Milestone != "" {
+		if _, err := path.Match(r.Match.Milestone, ""); err != nil {
+			return cr, fmt.Errorf("invalid milestone pattern: %w", err)
+		}
+	}
+	if cr.priority, err = parseValue("priority", r.Set.Priority); err != nil {
+		return cr, err
+	}
+	if cr.fixVersion, err = parseValue("fixVersion", r.Set.FixVersion); err != nil {
+		return cr, err
+	}
+	for _, l := range r.Set.Labels {
+		t, err := parseValue("labels", l)
+		if err != nil {
+			return cr, err
+		}
+		cr.labels = append(cr.labels, t)
+	}
+	for name, v := range r.Set.Fields {
+		t, err := parseValue(name, v)
+		if err != nil {
+			return cr, err
+		}
+		cr.fields[name] = t
+	}
+	return cr, nil
+}
+
+func parseValue(name, value string) (*template.Template, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := template.New(name).Option("missingkey=zero").Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template for %s: %w", name, err)
+	}
+	return t, nil
+}
+
+// Rules returns the names of all loaded rules in evaluation order
+func (e *Engine) Rules() []string {
+	names := make([]string, len(e.rules))
+	for i, r := range e.rules {
+		names[i] = r.Name
+	}
+	return names
+}
+
+// Evaluate applies all matching rules to issue
+func (e *Engine) Evaluate(issue Issue) (*Result, error) {
+	data := templateData{Issue: issue, sections: ParseSections(issue.Body)}
+	res := &Result{Matched: []string{}, Fields: make(map[string]string)}
+
+	for _, r := range e.rules {
+		if !r.matches(data) {
+			continue
+		}
+		res.Matched = append(res.Matched, r.Name)
+
+		if v, err := render(r.priority, data); err != nil {
+			return nil, fmt.Errorf("rule %q: %w", r.Name, err)
+		} else if v != "" {
+			res.Priority = v
+		}
+		if v, err := render(r.fixVersion, data); err != nil {
+			return nil, fmt.Errorf("rule %q: %w", r.Name, err)
+		} else if v != "" {
+			res.FixVersions = []string{v}
+		}
+		for _, t := range r.labels {
+			v, err := render(t, data)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: %w", r.Name, err)
+			}
+			if v != "" && !contains(res.Labels, v) {
+				res.Labels = append(res.Labels, v)
+			}
+		}
+		for name, t := range r.fields {
+			v, err := render(t, data)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: %w", r.Name, err)
+			}
+			if v != "" {
+				res.Fields[name] = v
+			}
+		}
+	}
+	return res, nil
+}
+
+func (r compiledRule) matches(data templateData) bool {
+	m := r.Match
+	if len(m.LabelsAny) > 0 {
+		found := false
+		for _, l := range m.LabelsAny {
+			if contains(data.Labels, l) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, l := range m.LabelsAll {
+		if !contains(data.Labels, l) {
+			return false
+		}
+	}
+	if m.Milestone != "" {
+		if data.Milestone == "" {
+			return false
+		}
+		if ok, _ := path.Match(m.Milestone, data.Milestone); !ok {
+			return false
+		}
+	}
+	if r.title != nil && !r.title.MatchString(data.Title) {
+		return false
+	}
+	for _, s := range m.Sections {
+		if data.Section(s) == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// JiraFields converts the result into Jira REST API issue fields
+func (r *Result) JiraFields() map[string]interface{} {
+	fields := make(map[string]interface{})
+	if r.Priority != "" {
+		fields["priority"] = map[string]string{"name": r.Priority}
+	}
+	if len(r.FixVersions) > 0 {
+		versions := make([]map[string]string, len(r.FixVersions))
+		for i, v := range r.FixVersions {
+			versions[i] = map[string]string{"name": v}
+		}
+		fields["fixVersions"] = versions
+	}
+	if len(r.Labels) > 0 {
+		fields["labels"] = r.Labels
+	}
+	for name, v := range r.Fields {
+		fields[name] = v
+	}
+	return fields
+}
+
+// templateData is passed to value templates
+type templateData struct {
+	Issue
+	sections map[string]string
+}
+
+// Section returns the content of the issue template section with the given
+// heading, or an empty string if it is absent
+func (d templateData) Section(name string) string {
+	return Section(d.sections, name)
+}
+
+func render(t *template.Template, data templateData) (string, error) {
+	if t == nil {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// ParseSections splits a Markdown issue body into sections keyed by their
+// normalized `##`/`###` heading. Issue form placeholders such as
+// "_No response_" are treated as empty, and headings in code blocks are
+// part of the section.
+func ParseSections(body string) map[string]string {
+	sections := make(map[string]string)
+	var current string
+	var buf []string
+	flush := func() {
+		if current == "" {
+			return
+		}
+		content := strings.TrimSpace(strings.Join(buf, "\n"))
+		if content == "_No response_" {
+			content = ""
+		}
+		sections[current] = content
+	}
+
+	inCode := false
+	for _, line := range strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inCode = !inCode
+		}
+		if !inCode && strings.HasPrefix(trimmed, "##") {
+			heading := strings.TrimLeft(trimmed, "#")
+			if heading != "" && heading[0] == ' ' {
+				flush()
+				current = normalizeHeading(heading)
+				buf = nil
+				continue
+			}
+		}
+		buf = append(buf, line)
+	}
+	flush()
+	return sections
+}
+
+// Section returns the content of the section of sections with the given
+// heading, matched like ParseSections normalizes headings
+func Section(sections map[string]string, name string) string {
+	return sections[normalizeHeading(name)]
+}
+
+// SectionNames returns the sorted headings found in body
+func SectionNames(body string) []string {
+	var names []string
+	for name := range ParseSections(body) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func normalizeHeading(h string) string {
+	return strings.ToLower(strings.TrimSpace(h))
+}
+
+func contains(list []string, v string) bool {
+	for _, l := range list {
+		if strings.EqualFold(l, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,190 @@
+// Package sanitize removes what GitHub issue templates leave behind in issue
+// bodies, such as HTML comments with instructions for the reporter,
+// placeholder answers and the headings of sections left empty, before a body
+// is summarized or copied to Jira.
+//
+// Fenced code blocks are kept as they are, so that logs and snippets pasted
+// into an issue reach the model and Jira unchanged.
+package sanitize
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// NoResponse is what GitHub issue forms write for optional fields left
+// empty; it is always removed
+const NoResponse = "_No response_"
+
+var (
+	comment = regexp.MustCompile(`(?s)<!--.*?-->`)
+	heading = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]|$)`)
+	fence   = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+)
+
+// Sanitizer cleans issue bodies. A nil Sanitizer returns bodies unchanged.
+type Sanitizer struct {
+	boilerplate       []*regexp.Regexp
+	keepEmptySections bool
+}
+
+// New compiles the boilerplate patterns, which are matched against each line
+// of a body without its surrounding whitespace. keepEmptySections keeps the
+// headings of sections without content.
+func New(boilerplate []string, keepEmptySections bool) (*Sanitizer, error) {
+	s := &Sanitizer{keepEmptySections: keepEmptySections}
+	for _, p := range boilerplate {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid boilerplate pattern %q: %w", p, err)
+		}
+		s.boilerplate = append(s.boilerplate, re)
+	}
+	return s, nil
+}
+
+// line is a line of a body
+type line struct {
+	text string
+	// code is set for the lines of fenced code blocks, including the fences
+	code bool
+}
+
+// Clean returns body without HTML comments, boilerplate lines, NoResponse
+// placeholders and, unless kept, the headings of empty sections, with runs
+// of blank lines collapsed
+func (s *Sanitizer) Clean(body string) string {
+	if s == nil || body == "" {
+		return body
+	}
+	var lines []line
+	for _, l := range split(body) {
+		if !l.code && s.isBoilerplate(l.text) {
+			continue
+		}
+		lines = append(lines, l)
+	}
+	if !s.keepEmptySections {
+		lines = dropEmptySections(lines)
+	}
+	return join(lines)
+}
+
+// isBoilerplate reports whether a line outside code blocks is removed
+func (s *Sanitizer) isBoilerplate(text string) bool {
+	text = strings.TrimSpace(text)
+	if text == NoResponse {
+		return true
+	}
+	for _, re := range s.boilerplate {
+		if re.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// split returns the lines of body with the HTML comments outside code blocks
+// removed. A comment only spanning prose is removed even across lines; an
+// unterminated one is kept.
+func split(body string) []line {
+	var lines []line
+	var prose []string
+	flush := func() {
+		if len(prose) == 0 {
+			return
+		}
+		text := comment.ReplaceAllString(strings.Join(prose, "\n"), "")
+		for _, t := range strings.Split(text, "\n") {
+			lines = append(lines, line{text: t})
+		}
+		prose = prose[:0]
+	}
+
+	var open string
+	for _, t := range strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n") {
+		m := fence.FindStringSubmatch(t)
+		switch {
+		case open == "" && m != nil:
+			flush()
+			open = m[1]
+			lines = append(lines, line{text: t, code: true})
+		case open != "":
+			// A fence is closed by one of the same character at least as long
+			if m != nil && m[1][0] == open[0] && len(m[1]) >= len(open) && strings.TrimSpace(t[len(m[0]):]) == "" {
+				open = ""
+			}
+			lines = append(lines, line{text: t, code: true})
+		default:
+			prose = append(prose, t)
+		}
+	}
+	flush()
+	return lines
+}
+
+// headingLevel returns the level of a Markdown heading, or 0 if the line
+// isn't one
+func headingLevel(l line) int {
+	if l.code {
+		return 0
+	}
+	m := heading.FindStringSubmatch(l.text)
+	if m == nil {
+		return 0
+	}
+	return len(m[1])
+}
+
+// dropEmptySections removes the headings followed by nothing but blank
+// lines before the next heading of the same or a higher level. Walking
+// backwards also drops a heading whose subsections were all empty.
+func dropEmptySections(lines []line) []line {
+	kept := make([]line, 0, len(lines))
+	// next is the level of the heading the following content starts with,
+	// 0 if it starts with other content; the end of the body closes all
+	// sections like a first-level heading
+	next := 1
+	for i := len(lines) - 1; i >= 0; i-- {
+		l := lines[i]
+		level := headingLevel(l)
+		switch {
+		case level > 0 && next > 0 && next <= level:
+			continue
+		case level > 0:
+			next = level
+		case l.code || strings.TrimSpace(l.text) != "":
+			next = 0
+		}
+		kept = append(kept, l)
+	}
+	for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+		kept[i], kept[j] = kept[j], kept[i]
+	}
+	return kept
+}
+
+// join returns the lines as text, with runs of blank lines outside code
+// blocks collapsed into one and without leading or trailing blank lines
+func join(lines []line) string {
+	var b strings.Builder
+	blank := false
+	for _, l := range lines {
+		if !l.code && strings.TrimSpace(l.text) == "" {
+			blank = b.Len() > 0
+			continue
+		}
+		if blank {
+			b.WriteString("\n")
+			blank = false
+		}
+		if l.code {
+			b.WriteString(l.text)
+		} else {
+			b.WriteString(strings.TrimRight(l.text, " \t"))
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,109 @@
+// Package secrets resolves secret references in configuration values.
+//
+// A reference has the form "scheme:ref", e.g. "file:/run/secrets/token" or
+// "vault:secret/data/gh-jira#github_token". The scheme selects a Provider;
+// values without a registered scheme are used literally.
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Provider looks up secrets in one backend
+type Provider interface {
+	// Get returns the secret identified by ref, the part of the reference
+	// after the scheme
+	Get(ctx context.Context, ref string) (string, error)
+}
+
+// ProviderFunc adapts a function to the Provider interface
+type ProviderFunc func(ctx context.Context, ref string) (string, error)
+
+// Get implements Provider
+func (f ProviderFunc) Get(ctx context.Context, ref string) (string, error) { return f(ctx, ref) }
+
+var (
+	mu        sync.RWMutex
+	providers = map[string]Provider{
+		// file reads the secret from a file, such as a mounted Kubernetes
+		// secret
+		"file": ProviderFunc(func(_ context.Context, ref string) (string, error) {
+			return ReadFile(ref)
+		}),
+		// env reads the secret from another environment variable
+		"env": ProviderFunc(func(_ context.Context, ref string) (string, error) {
+			v, ok := os.LookupEnv(ref)
+			if !ok {
+				return "", fmt.Errorf("environment variable %s is not set", ref)
+			}
+			return v, nil
+		}),
+	}
+)
+
+// Register makes a provider available under scheme, replacing any existing one
+func Register(scheme string, p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	providers[scheme] = p
+}
+
+// Schemes returns the names of all registered providers
+func Schemes() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookup returns the provider of the scheme of value, if any
+func lookup(value string) (Provider, string, bool) {
+	scheme, ref, ok := strings.Cut(value, ":")
+	if !ok {
+		return nil, "", false
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	p, ok := providers[scheme]
+	return p, ref, ok
+}
+
+// IsReference reports whether value refers to a secret of a registered provider
+func IsReference(value string) bool {
+	_, _, ok := lookup(value)
+	return ok
+}
+
+// Resolve returns the secret value references, or value itself if it is
+// not a reference
+func Resolve(ctx context.Context, value string) (string, error) {
+	p, ref, ok := lookup(value)
+	if !ok {
+		return value, nil
+	}
+	secret, err := p.Get(ctx, ref)
+	if err != nil {
+		scheme, _, _ := strings.Cut(value, ":")
+		return "", fmt.Errorf("failed to resolve %s secret %s: %w", scheme, ref, err)
+	}
+	return secret, nil
+}
+
+// ReadFile reads a secret from a file, dropping the trailing newline most
+// tools add
+func ReadFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
@@ -0,0 +1,104 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Vault reads secrets from the HashiCorp Vault KV secrets engine. References
+// have the form "path#key", e.g. "secret/data/gh-jira#github_token" for a KV
+// version 2 mount at secret/. Each path is read once and cached.
+type Vault struct {
+	// Address is the Vault server URL, e.g. https://vault.example.com:8200
+	Address string
+	// Token authenticates the requests
+	Token string
+	// Namespace is the Vault Enterprise namespace, if any
+	Namespace  string
+	HTTPClient *http.Client
+
+	mu    sync.Mutex
+	cache map[string]map[string]interface{}
+}
+
+// Get implements Provider
+func (v *Vault) Get(ctx context.Context, ref string) (string, error) {
+	if v.Address == "" {
+		return "", fmt.Errorf("no Vault address configured")
+	}
+	path, key, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || key == "" {
+		return "", fmt.Errorf("Vault reference %q must have the form path#key", ref)
+	}
+
+	data, err := v.read(ctx, strings.Trim(path, "/"))
+	if err != nil {
+		return "", err
+	}
+	value, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("Vault secret %s has no key %q", path, key)
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("Vault secret %s key %q is not a string", path, key)
+	}
+	return s, nil
+}
+
+// read returns the data of the secret at path
+func (v *Vault) read(ctx context.Context, path string) (map[string]interface{}, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if data, ok := v.cache[path]; ok {
+		return data, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(v.Address, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+
+	client := v.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("Vault responded with status %s: %s", resp.Status, body)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, fmt.Errorf("failed to decode Vault response: %w", err)
+	}
+	data := secret.Data
+	// KV version 2 nests the secret in data.data next to its metadata
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, versioned := data["metadata"]; versioned {
+			data = nested
+		}
+	}
+
+	if v.cache == nil {
+		v.cache = make(map[string]map[string]interface{})
+	}
+	v.cache[path] = data
+	return data, nil
+}
@@ -0,0 +1,196 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/savitaashture/gh-jira/pkg/jira"
+)
+
+// DefaultAzureDevOpsURL is the URL of Azure DevOps Services
+const DefaultAzureDevOpsURL = "https://dev.azure.com"
+
+// DefaultWorkItemType is the type of the work items created by AzureDevOps
+const DefaultWorkItemType = "Task"
+
+// azureAPIVersion is the version of the REST API called
+const azureAPIVersion = "7.1"
+
+// AzureDevOps creates work items in a project of Azure DevOps Services or
+// Azure DevOps Server. Work items are identified by their ID.
+type AzureDevOps struct {
+	// URL is the URL of the server, DefaultAzureDevOpsURL if empty
+	URL          string
+	Organization string
+	Project      string
+	// WorkItemType is the type of the created work items,
+	// DefaultWorkItemType if empty
+	WorkItemType string
+	// Token is a personal access token with the Work Items (Read & Write)
+	// scope
+	Token      string
+	HTTPClient *http.Client
+}
+
+// patchOp is an operation of a JSON Patch document
+type patchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// workItem is a work item as returned by the Azure DevOps API
+type workItem struct {
+	ID    int    `json:"id"`
+	URL   string `json:"url"`
+	Links struct {
+		HTML struct {
+			Href string `json:"href"`
+		} `json:"html"`
+	} `json:"_links"`
+}
+
+// Check implements Checker by reading the project
+func (a *AzureDevOps) Check(ctx context.Context) error {
+	path := "/" + url.PathEscape(a.Organization) + "/_apis/projects/" + url.PathEscape(a.Project)
+	return a.do(ctx, http.MethodGet, path, nil, nil)
+}
+
+// BaseURL implements Sink
+func (a *AzureDevOps) BaseURL() string {
+	return a.projectURL()
+}
+
+// BrowseURL implements Sink
+func (a *AzureDevOps) BrowseURL(key string) string {
+	return a.projectURL() + "/_workitems/edit/" + key
+}
+
+// CreateIssue implements Sink. The labels become tags.
+func (a *AzureDevOps) CreateIssue(ctx context.Context, fields map[string]interface{}) (*jira.CreatedIssue, error) {
+	item := ItemFromFields(fields)
+	ops := []patchOp{
+		{Op: "add", Path: "/fields/System.Title", Value: item.Title},
+		{Op: "add", Path: "/fields/System.Description", Value: descriptionHTML(item.Description)},
+	}
+	if len(item.Labels) > 0 {
+		ops = append(ops, patchOp{Op: "add", Path: "/fields/System.Tags", Value: strings.Join(item.Labels, "; ")})
+	}
+	typ := a.WorkItemType
+	if typ == "" {
+		typ = DefaultWorkItemType
+	}
+	var created workItem
+	if err := a.do(ctx, http.MethodPost, a.workItemsPath()+"/$"+url.PathEscape(typ), ops, &created); err != nil {
+		return nil, err
+	}
+	key := strconv.Itoa(created.ID)
+	return &jira.CreatedIssue{ID: key, Key: key, Self: created.URL}, nil
+}
+
+// UpdateIssue implements Sink for the summary and description
+func (a *AzureDevOps) UpdateIssue(ctx context.Context, key string, fields map[string]interface{}) error {
+	var ops []patchOp
+	if title, ok := fields["summary"].(string); ok {
+		ops = append(ops, patchOp{Op: "add", Path: "/fields/System.Title", Value: title})
+	}
+	if description, ok := fields["description"].(string); ok {
+		ops = append(ops, patchOp{Op: "add", Path: "/fields/System.Description", Value: descriptionHTML(description)})
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+	return a.do(ctx, http.MethodPatch, a.workItemsPath()+"/"+url.PathEscape(key), ops, nil)
+}
+
+// descriptionHTML returns a plain text description as the HTML the
+// description field of work items holds
+func descriptionHTML(text string) string {
+	return strings.ReplaceAll(html.EscapeString(text), "\n", "<br>")
+}
+
+func (a *AzureDevOps) baseURL() string {
+	base := strings.TrimRight(a.URL, "/")
+	if base == "" {
+		base = DefaultAzureDevOpsURL
+	}
+	return base
+}
+
+// projectURL returns the web URL of the project
+func (a *AzureDevOps) projectURL() string {
+	return a.baseURL() + "/" + url.PathEscape(a.Organization) + "/" + url.PathEscape(a.Project)
+}
+
+// workItemsPath returns the API path of the work items of the project
+func (a *AzureDevOps) workItemsPath() string {
+	return "/" + url.PathEscape(a.Organization) + "/" + url.PathEscape(a.Project) + "/_apis/wit/workitems"
+}
+
+func (a *AzureDevOps) do(ctx context.Context, method, path string, ops []patchOp, out interface{}) error {
+	u := a.baseURL() + path + "?api-version=" + azureAPIVersion
+
+	var body io.Reader
+	if ops != nil {
+		data, err := json.Marshal(ops)
+		if err != nil {
+			return fmt.Errorf("failed to marshal Azure DevOps request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return fmt.Errorf("failed to create Azure DevOps request: %w", err)
+	}
+	if ops != nil {
+		req.Header.Set("Content-Type", "application/json-patch+json")
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(":"+a.Token)))
+
+	client := a.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	log.Printf("Sending %s %s to Azure DevOps API", method, path)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Printf("Azure DevOps API response for %s %s - Status: %s, Body: %s", method, path, resp.Status, string(data))
+		e := &Error{Sink: "Azure DevOps", Status: resp.Status, StatusCode: resp.StatusCode, Body: string(data)}
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil {
+			e.Message = apiErr.Message
+		}
+		return e
+	}
+	// Rejected credentials get a sign-in page rather than a 401
+	if resp.StatusCode == http.StatusNonAuthoritativeInfo || strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		log.Printf("Azure DevOps API response for %s %s - Status: %s, sign-in page", method, path, resp.Status)
+		return &Error{Sink: "Azure DevOps", Status: "401 Unauthorized", StatusCode: http.StatusUnauthorized,
+			Message: "the personal access token was rejected"}
+	}
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("failed to decode Azure DevOps response: %w", err)
+		}
+	}
+	return nil
+}
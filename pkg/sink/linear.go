@@ -0,0 +1,295 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/savitaashture/gh-jira/pkg/jira"
+)
+
+// DefaultLinearURL is the URL of the GraphQL API of Linear
+const DefaultLinearURL = "https://api.linear.app/graphql"
+
+// Linear creates issues in a team of Linear through its GraphQL API
+type Linear struct {
+	// APIURL is the URL of the GraphQL API, DefaultLinearURL if empty
+	APIURL string
+	// Token is a personal API key or an OAuth access token
+	Token string
+	// Team is the key of the team issues are created in, such as ENG
+	Team string
+	// Workspace is the URL key of the workspace, looked up if empty
+	Workspace  string
+	HTTPClient *http.Client
+
+	mu     sync.Mutex
+	teamID string
+	labels map[string]string
+}
+
+// Check implements Checker by looking up the team
+func (l *Linear) Check(ctx context.Context) error {
+	_, err := l.team(ctx)
+	return err
+}
+
+// BaseURL implements Sink
+func (l *Linear) BaseURL() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.Workspace == "" {
+		return "https://linear.app"
+	}
+	return "https://linear.app/" + l.Workspace
+}
+
+// BrowseURL implements Sink. It is empty until the workspace is known.
+func (l *Linear) BrowseURL(key string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.Workspace == "" {
+		return ""
+	}
+	return "https://linear.app/" + l.Workspace + "/issue/" + key
+}
+
+// CreateIssue implements Sink. Labels are applied if the team or the
+// workspace has labels of that name.
+func (l *Linear) CreateIssue(ctx context.Context, fields map[string]interface{}) (*jira.CreatedIssue, error) {
+	teamID, err := l.team(ctx)
+	if err != nil {
+		return nil, err
+	}
+	item := ItemFromFields(fields)
+	input := map[string]interface{}{
+		"teamId":      teamID,
+		"title":       item.Title,
+		"description": item.Description,
+	}
+	if ids := l.labelIDs(item.Labels); len(ids) > 0 {
+		input["labelIds"] = ids
+	}
+	var out struct {
+		IssueCreate struct {
+			Success bool `json:"success"`
+			Issue   struct {
+				ID         string `json:"id"`
+				Identifier string `json:"identifier"`
+				URL        string `json:"url"`
+			} `json:"issue"`
+		} `json:"issueCreate"`
+	}
+	const mutation = `mutation($input: IssueCreateInput!) {
+  issueCreate(input: $input) { success issue { id identifier url } }
+}`
+	if err := l.do(ctx, mutation, map[string]interface{}{"input": input}, &out); err != nil {
+		return nil, err
+	}
+	if !out.IssueCreate.Success {
+		return nil, errors.New("Linear did not create the issue")
+	}
+	issue := out.IssueCreate.Issue
+	return &jira.CreatedIssue{ID: issue.ID, Key: issue.Identifier, Self: issue.URL}, nil
+}
+
+// UpdateIssue implements Sink for the summary and description
+func (l *Linear) UpdateIssue(ctx context.Context, key string, fields map[string]interface{}) error {
+	if _, err := l.team(ctx); err != nil {
+		return err
+	}
+	input := map[string]interface{}{}
+	if title, ok := fields["summary"].(string); ok {
+		input["title"] = title
+	}
+	if description, ok := fields["description"].(string); ok {
+		input["description"] = description
+	}
+	if len(input) == 0 {
+		return nil
+	}
+	var out struct {
+		IssueUpdate struct {
+			Success bool `json:"success"`
+		} `json:"issueUpdate"`
+	}
+	const mutation = `mutation($id: String!, $input: IssueUpdateInput!) {
+  issueUpdate(id: $id, input: $input) { success }
+}`
+	if err := l.do(ctx, mutation, map[string]interface{}{"id": key, "input": input}, &out); err != nil {
+		return err
+	}
+	if !out.IssueUpdate.Success {
+		return fmt.Errorf("Linear did not update issue %s", key)
+	}
+	return nil
+}
+
+// team returns the ID of the team, looking it up with the workspace and
+// the labels on first use
+func (l *Linear) team(ctx context.Context) (string, error) {
+	l.mu.Lock()
+	id := l.teamID
+	l.mu.Unlock()
+	if id != "" {
+		return id, nil
+	}
+
+	type labels struct {
+		Nodes []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"nodes"`
+	}
+	var out struct {
+		Organization struct {
+			URLKey string `json:"urlKey"`
+		} `json:"organization"`
+		Teams struct {
+			Nodes []struct {
+				ID     string `json:"id"`
+				Labels labels `json:"labels"`
+			} `json:"nodes"`
+		} `json:"teams"`
+		IssueLabels labels `json:"issueLabels"`
+	}
+	const query = `query($key: String!) {
+  organization { urlKey }
+  teams(filter: { key: { eq: $key } }) { nodes { id labels(first: 250) { nodes { id name } } } }
+  issueLabels(first: 250, filter: { team: { null: true } }) { nodes { id name } }
+}`
+	if err := l.do(ctx, query, map[string]interface{}{"key": l.Team}, &out); err != nil {
+		return "", err
+	}
+	if len(out.Teams.Nodes) == 0 {
+		return "", fmt.Errorf("Linear team %s not found", l.Team)
+	}
+	team := out.Teams.Nodes[0]
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.teamID = team.ID
+	if l.Workspace == "" {
+		l.Workspace = out.Organization.URLKey
+	}
+	// Team labels take precedence over workspace labels of the same name
+	l.labels = map[string]string{}
+	for _, list := range []labels{out.IssueLabels, team.Labels} {
+		for _, n := range list.Nodes {
+			l.labels[strings.ToLower(n.Name)] = n.ID
+		}
+	}
+	log.Printf("Using Linear team %s of workspace %s with %d labels", l.Team, l.Workspace, len(l.labels))
+	return l.teamID, nil
+}
+
+// labelIDs returns the IDs of the known labels among names
+func (l *Linear) labelIDs(names []string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var ids []string
+	for _, name := range names {
+		if id, ok := l.labels[strings.ToLower(name)]; ok {
+			ids = append(ids, id)
+		} else {
+			log.Printf("Skipping label %q unknown to Linear team %s", name, l.Team)
+		}
+	}
+	return ids
+}
+
+// linearError is an error of a GraphQL response of Linear
+type linearError struct {
+	Message    string `json:"message"`
+	Extensions struct {
+		Code string `json:"code"`
+	} `json:"extensions"`
+}
+
+func (l *Linear) do(ctx context.Context, query string, variables map[string]interface{}, out interface{}) error {
+	u := l.APIURL
+	if u == "" {
+		u = DefaultLinearURL
+	}
+	data, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return fmt.Errorf("failed to marshal Linear request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create Linear request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	// Personal API keys are sent as they are, OAuth tokens as bearer tokens
+	if strings.HasPrefix(l.Token, "lin_api_") {
+		req.Header.Set("Authorization", l.Token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+l.Token)
+	}
+
+	client := l.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	log.Printf("Sending request to Linear API")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []linearError   `json:"errors"`
+	}
+	decodeErr := json.Unmarshal(body, &result)
+	if len(result.Errors) > 0 {
+		log.Printf("Linear API response - Status: %s, Body: %s", resp.Status, string(body))
+		return graphQLError(resp, string(body), result.Errors)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Printf("Linear API response - Status: %s, Body: %s", resp.Status, string(body))
+		return &Error{Sink: "Linear", Status: resp.Status, StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("failed to decode Linear response: %w", decodeErr)
+	}
+	if out != nil && len(result.Data) > 0 {
+		if err := json.Unmarshal(result.Data, out); err != nil {
+			return fmt.Errorf("failed to decode Linear response: %w", err)
+		}
+	}
+	return nil
+}
+
+// graphQLError returns the errors of a Linear response as *Error. Linear
+// reports rejected credentials as errors rather than with a status, so
+// they are given the status of one.
+func graphQLError(resp *http.Response, body string, errs []linearError) error {
+	e := &Error{Sink: "Linear", Status: resp.Status, StatusCode: resp.StatusCode, Body: body}
+	messages := make([]string, len(errs))
+	for i, le := range errs {
+		messages[i] = le.Message
+		switch le.Extensions.Code {
+		case "AUTHENTICATION_ERROR":
+			e.StatusCode = http.StatusUnauthorized
+		case "FORBIDDEN":
+			e.StatusCode = http.StatusForbidden
+		}
+	}
+	e.Message = strings.Join(messages, "; ")
+	if e.StatusCode != resp.StatusCode {
+		e.Status = strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode)
+	}
+	return e
+}
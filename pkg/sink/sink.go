@@ -0,0 +1,91 @@
+// Package sink abstracts the trackers synced issues are created in. Jira is
+// one; the others are given the payloads gh-jira builds for Jira, of which
+// they use the summary, description and, where they support them, the
+// labels and issue type.
+package sink
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/savitaashture/gh-jira/pkg/jira"
+)
+
+// Sink is a tracker issues are created in. Issues are identified by the
+// key of the created issue, such as ENG-42 or a work item ID.
+type Sink interface {
+	// BaseURL returns the URL of the tracker
+	BaseURL() string
+	// CreateIssue creates an issue from Jira fields
+	CreateIssue(ctx context.Context, fields map[string]interface{}) (*jira.CreatedIssue, error)
+	// UpdateIssue updates an issue with Jira fields
+	UpdateIssue(ctx context.Context, key string, fields map[string]interface{}) error
+	// BrowseURL returns the web URL of an issue, or "" if unknown
+	BrowseURL(key string) string
+}
+
+var _ Sink = (*jira.Client)(nil)
+
+// Checker is implemented by sinks that can verify their configuration and
+// credentials
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// Item is what a sink takes from Jira fields
+type Item struct {
+	Title       string
+	Description string
+	Labels      []string
+}
+
+// ItemFromFields returns the summary, description and labels of Jira
+// fields. Labels are []string when built and []interface{} when read back
+// from a queued payload.
+func ItemFromFields(fields map[string]interface{}) Item {
+	item := Item{}
+	item.Title, _ = fields["summary"].(string)
+	item.Description, _ = fields["description"].(string)
+	switch labels := fields["labels"].(type) {
+	case []string:
+		item.Labels = labels
+	case []interface{}:
+		for _, l := range labels {
+			if s, ok := l.(string); ok {
+				item.Labels = append(item.Labels, s)
+			}
+		}
+	}
+	return item
+}
+
+// Error is returned when the API of a sink responds with an error
+type Error struct {
+	Sink       string
+	Status     string
+	StatusCode int
+	Body       string
+	// Message summarizes the errors of the response, if known
+	Message string
+}
+
+func (e *Error) Error() string {
+	msg := e.Sink + " API responded with status " + e.Status
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// IsNotFound reports whether err is a 404 response of a sink
+func IsNotFound(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == http.StatusNotFound
+}
+
+// IsAuthError reports whether err is a sink rejecting its credentials
+func IsAuthError(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && (e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden)
+}
@@ -0,0 +1,201 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/savitaashture/gh-jira/pkg/jira"
+)
+
+// youTrackTypeField is the name of the field holding the type of YouTrack
+// issues
+const youTrackTypeField = "Type"
+
+// YouTrack creates issues in a project of YouTrack through its REST API
+type YouTrack struct {
+	// URL is the URL of the instance, e.g. https://example.youtrack.cloud
+	URL string
+	// Token is a permanent token of a user who can create issues in the
+	// project
+	Token string
+	// Project is the short name of the project, such as ABC
+	Project string
+	// IssueTypes maps the Jira issue types of payloads to the values of the
+	// Type field; IssueType is the value of unmapped types. The project
+	// default applies if neither is set.
+	IssueTypes map[string]string
+	IssueType  string
+	HTTPClient *http.Client
+
+	mu        sync.Mutex
+	projectID string
+}
+
+// Check implements Checker by looking up the project
+func (y *YouTrack) Check(ctx context.Context) error {
+	_, err := y.project(ctx)
+	return err
+}
+
+// BaseURL implements Sink
+func (y *YouTrack) BaseURL() string {
+	return strings.TrimRight(y.URL, "/")
+}
+
+// BrowseURL implements Sink
+func (y *YouTrack) BrowseURL(key string) string {
+	return y.BaseURL() + "/issue/" + key
+}
+
+// CreateIssue implements Sink. The Jira issue type sets the Type field.
+func (y *YouTrack) CreateIssue(ctx context.Context, fields map[string]interface{}) (*jira.CreatedIssue, error) {
+	projectID, err := y.project(ctx)
+	if err != nil {
+		return nil, err
+	}
+	item := ItemFromFields(fields)
+	in := map[string]interface{}{
+		"project":     map[string]string{"id": projectID},
+		"summary":     item.Title,
+		"description": item.Description,
+	}
+	if typ := y.issueType(fields["issuetype"]); typ != "" {
+		in["customFields"] = []map[string]interface{}{{
+			"name":  youTrackTypeField,
+			"$type": "SingleEnumIssueCustomField",
+			"value": map[string]string{"name": typ},
+		}}
+	}
+	var created struct {
+		ID         string `json:"id"`
+		IDReadable string `json:"idReadable"`
+	}
+	query := url.Values{"fields": {"id,idReadable"}}
+	if err := y.do(ctx, http.MethodPost, "/issues", query, in, &created); err != nil {
+		return nil, err
+	}
+	return &jira.CreatedIssue{ID: created.ID, Key: created.IDReadable, Self: y.BrowseURL(created.IDReadable)}, nil
+}
+
+// UpdateIssue implements Sink for the summary and description
+func (y *YouTrack) UpdateIssue(ctx context.Context, key string, fields map[string]interface{}) error {
+	in := map[string]interface{}{}
+	if summary, ok := fields["summary"].(string); ok {
+		in["summary"] = summary
+	}
+	if description, ok := fields["description"].(string); ok {
+		in["description"] = description
+	}
+	if len(in) == 0 {
+		return nil
+	}
+	return y.do(ctx, http.MethodPost, "/issues/"+url.PathEscape(key), nil, in, nil)
+}
+
+// issueType returns the value of the Type field for the issuetype field of
+// a payload, a map when built and read back from a queued payload alike
+func (y *YouTrack) issueType(field interface{}) string {
+	var name string
+	switch t := field.(type) {
+	case map[string]string:
+		name = t["name"]
+	case map[string]interface{}:
+		name, _ = t["name"].(string)
+	}
+	if typ, ok := y.IssueTypes[name]; ok {
+		return typ
+	}
+	return y.IssueType
+}
+
+// project returns the ID of the project, looking it up on first use
+func (y *YouTrack) project(ctx context.Context) (string, error) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if y.projectID != "" {
+		return y.projectID, nil
+	}
+	var projects []struct {
+		ID        string `json:"id"`
+		ShortName string `json:"shortName"`
+	}
+	query := url.Values{"fields": {"id,shortName"}, "$top": {"-1"}}
+	if err := y.do(ctx, http.MethodGet, "/admin/projects", query, nil, &projects); err != nil {
+		return "", err
+	}
+	for _, p := range projects {
+		if strings.EqualFold(p.ShortName, y.Project) {
+			y.projectID = p.ID
+			log.Printf("Using YouTrack project %s (%s)", y.Project, p.ID)
+			return p.ID, nil
+		}
+	}
+	return "", fmt.Errorf("YouTrack project %s not found", y.Project)
+}
+
+func (y *YouTrack) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	u := y.BaseURL() + "/api" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to marshal YouTrack request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return fmt.Errorf("failed to create YouTrack request: %w", err)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+y.Token)
+
+	client := y.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	log.Printf("Sending %s %s to YouTrack API", method, path)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Printf("YouTrack API response for %s %s - Status: %s, Body: %s", method, path, resp.Status, string(data))
+		e := &Error{Sink: "YouTrack", Status: resp.Status, StatusCode: resp.StatusCode, Body: string(data)}
+		var apiErr struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil {
+			e.Message = apiErr.Description
+			if e.Message == "" {
+				e.Message = apiErr.Error
+			}
+		}
+		return e
+	}
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("failed to decode YouTrack response: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+// Package slack posts messages to Slack incoming webhooks.
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Message is the payload of an incoming webhook. Text supports Slack's
+// mrkdwn formatting.
+type Message struct {
+	Text string `json:"text"`
+}
+
+// Post sends msg to the incoming webhook at webhookURL
+func Post(ctx context.Context, webhookURL string, msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create Slack request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("Slack webhook responded with status %s: %s", resp.Status, body)
+	}
+	return nil
+}
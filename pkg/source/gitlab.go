@@ -0,0 +1,206 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultGitLabURL is the URL of GitLab.com
+const DefaultGitLabURL = "https://gitlab.com"
+
+// GitLab reads issues from the REST API of GitLab.com or a self-managed
+// GitLab instance
+type GitLab struct {
+	// BaseURL is the URL of the instance, DefaultGitLabURL if empty
+	BaseURL string
+	// Token is a personal, group or project access token with the api scope
+	Token      string
+	HTTPClient *http.Client
+}
+
+// gitlabIssue is an issue as returned by the GitLab API
+type gitlabIssue struct {
+	ID          int64    `json:"id"`
+	IID         int      `json:"iid"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	State       string   `json:"state"`
+	WebURL      string   `json:"web_url"`
+	Labels      []string `json:"labels"`
+	Author      struct {
+		Username string `json:"username"`
+	} `json:"author"`
+	Milestone *struct {
+		Title string `json:"title"`
+	} `json:"milestone"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (i *gitlabIssue) issue() *Issue {
+	issue := &Issue{
+		ID:        i.ID,
+		GlobalID:  "gid://gitlab/Issue/" + strconv.FormatInt(i.ID, 10),
+		Number:    i.IID,
+		Title:     i.Title,
+		Body:      i.Description,
+		URL:       i.WebURL,
+		Author:    i.Author.Username,
+		State:     "open",
+		Labels:    i.Labels,
+		CreatedAt: i.CreatedAt,
+	}
+	if i.State == "closed" {
+		issue.State = "closed"
+	}
+	if i.Milestone != nil {
+		issue.Milestone = i.Milestone.Title
+	}
+	return issue
+}
+
+// ListIssues implements Provider
+func (g *GitLab) ListIssues(ctx context.Context, project string) ([]*Issue, error) {
+	query := url.Values{
+		"state":    {"opened"},
+		"order_by": {"created_at"},
+		"sort":     {"desc"},
+		"per_page": {"100"},
+	}
+	var list []*gitlabIssue
+	if err := g.do(ctx, http.MethodGet, projectPath(project)+"/issues", query, nil, &list); err != nil {
+		return nil, err
+	}
+	issues := make([]*Issue, len(list))
+	for i, issue := range list {
+		issues[i] = issue.issue()
+	}
+	return issues, nil
+}
+
+// GetIssue implements Provider
+func (g *GitLab) GetIssue(ctx context.Context, project string, number int) (*Issue, error) {
+	var issue gitlabIssue
+	if err := g.do(ctx, http.MethodGet, fmt.Sprintf("%s/issues/%d", projectPath(project), number), nil, nil, &issue); err != nil {
+		return nil, err
+	}
+	return issue.issue(), nil
+}
+
+// CreateComment implements Provider
+func (g *GitLab) CreateComment(ctx context.Context, project string, number int, body string) (int64, error) {
+	var note struct {
+		ID int64 `json:"id"`
+	}
+	path := fmt.Sprintf("%s/issues/%d/notes", projectPath(project), number)
+	if err := g.do(ctx, http.MethodPost, path, nil, map[string]string{"body": body}, &note); err != nil {
+		return 0, err
+	}
+	return note.ID, nil
+}
+
+// EditComment implements Provider
+func (g *GitLab) EditComment(ctx context.Context, project string, number int, id int64, body string) error {
+	path := fmt.Sprintf("%s/issues/%d/notes/%d", projectPath(project), number, id)
+	return g.do(ctx, http.MethodPut, path, nil, map[string]string{"body": body}, nil)
+}
+
+// ParseWebhook implements Webhooks for the issue events of GitLab project
+// and group webhooks
+func (g *GitLab) ParseWebhook(r *http.Request, secret string) (*Event, error) {
+	token := r.Header.Get("X-Gitlab-Token")
+	if secret == "" || subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+		return nil, errors.New("invalid GitLab webhook token")
+	}
+	if r.Header.Get("X-Gitlab-Event") != "Issue Hook" {
+		return nil, nil
+	}
+	var payload struct {
+		ObjectKind string `json:"object_kind"`
+		Project    struct {
+			PathWithNamespace string `json:"path_with_namespace"`
+		} `json:"project"`
+		ObjectAttributes struct {
+			IID    int    `json:"iid"`
+			Action string `json:"action"`
+		} `json:"object_attributes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("invalid GitLab webhook payload: %w", err)
+	}
+	if payload.ObjectKind != "issue" {
+		return nil, nil
+	}
+	return &Event{
+		Project: payload.Project.PathWithNamespace,
+		Number:  payload.ObjectAttributes.IID,
+		Action:  payload.ObjectAttributes.Action,
+	}, nil
+}
+
+// projectPath returns the API path of a project
+func projectPath(project string) string {
+	return "/projects/" + url.PathEscape(project)
+}
+
+func (g *GitLab) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	base := strings.TrimRight(g.BaseURL, "/")
+	if base == "" {
+		base = DefaultGitLabURL
+	}
+	u := base + "/api/v4" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to marshal GitLab request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return fmt.Errorf("failed to create GitLab request: %w", err)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("PRIVATE-TOKEN", g.Token)
+	req.Header.Set("Accept", "application/json")
+
+	client := g.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	log.Printf("Sending %s %s to GitLab API", method, path)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Printf("GitLab API response for %s %s - Status: %s, Body: %s", method, path, resp.Status, string(data))
+		return &Error{Source: "GitLab", Status: resp.Status, StatusCode: resp.StatusCode, Body: string(data)}
+	}
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("failed to decode GitLab response: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+// Package source abstracts the issue trackers other than GitHub whose issues
+// gh-jira bridges to Jira
+package source
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Issue is an issue of a source
+type Issue struct {
+	// ID identifies the issue across projects of the source
+	ID int64
+	// GlobalID is the ID of the issue in the GraphQL API of the source
+	GlobalID string
+	// Number identifies the issue within its project
+	Number    int
+	Title     string
+	Body      string
+	URL       string
+	Author    string
+	State     string // "open" or "closed"
+	Labels    []string
+	Milestone string
+	CreatedAt time.Time
+}
+
+// Provider is an issue tracker issues are synced from. Projects are given
+// by their path, such as group/project.
+type Provider interface {
+	// ListIssues returns the open issues of a project, newest first
+	ListIssues(ctx context.Context, project string) ([]*Issue, error)
+	// GetIssue returns an issue of a project
+	GetIssue(ctx context.Context, project string, number int) (*Issue, error)
+	// CreateComment comments on an issue and returns the ID of the comment
+	CreateComment(ctx context.Context, project string, number int, body string) (int64, error)
+	// EditComment replaces the body of a comment
+	EditComment(ctx context.Context, project string, number int, id int64, body string) error
+}
+
+// Event is an issue change delivered by a webhook
+type Event struct {
+	Project string
+	Number  int
+	// Action is "open", "reopen", "update" or "close"
+	Action string
+}
+
+// Webhooks is implemented by providers that push issue changes
+type Webhooks interface {
+	// ParseWebhook authenticates a webhook delivery with secret and returns
+	// the issue change it carries, or nil for other events
+	ParseWebhook(r *http.Request, secret string) (*Event, error)
+}
+
+// Error is returned when the API of a source responds with an error
+type Error struct {
+	Source     string
+	Status     string
+	StatusCode int
+	Body       string
+}
+
+func (e *Error) Error() string {
+	return e.Source + " API responded with status " + e.Status
+}
+
+// IsNotFound reports whether err is a 404 response of a source
+func IsNotFound(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == http.StatusNotFound
+}
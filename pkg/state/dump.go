@@ -0,0 +1,155 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DumpVersion is the version of the Dump format
+const DumpVersion = 1
+
+// Dump is a backend independent copy of a store, used for backups and to
+// migrate between backends. The history of mappings is not included; the
+// import records each imported mapping as a new history entry.
+type Dump struct {
+	Version    int               `json:"version"`
+	ExportedAt time.Time         `json:"exported_at"`
+	Mappings   []*Mapping        `json:"mappings"`
+	Cursors    map[string]string `json:"cursors,omitempty"`
+	Snapshots  []*Snapshot       `json:"snapshots,omitempty"`
+	Approvals  []*Approval       `json:"approvals,omitempty"`
+	Retries    []*Retry          `json:"retries,omitempty"`
+}
+
+// ImportStats counts what an import changed
+type ImportStats struct {
+	Mappings         int `json:"mappings"`
+	SkippedMappings  int `json:"skipped_mappings"`
+	Cursors          int `json:"cursors"`
+	Snapshots        int `json:"snapshots"`
+	Approvals        int `json:"approvals"`
+	Retries          int `json:"retries"`
+	SkippedSnapshots int `json:"skipped_snapshots"`
+	SkippedApprovals int `json:"skipped_approvals"`
+}
+
+// Export copies the content of s into a Dump
+func Export(ctx context.Context, s Store) (*Dump, error) {
+	d := &Dump{Version: DumpVersion, ExportedAt: time.Now().UTC()}
+	var err error
+	if d.Mappings, err = s.List(ctx); err != nil {
+		return nil, err
+	}
+	if d.Cursors, err = s.ListCursors(ctx); err != nil {
+		return nil, err
+	}
+	if d.Snapshots, err = s.ListSnapshots(ctx, ""); err != nil {
+		return nil, err
+	}
+	if d.Approvals, err = s.ListApprovals(ctx); err != nil {
+		return nil, err
+	}
+	if d.Retries, err = s.ListRetries(ctx); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Import writes the content of d into s. Existing mappings, cursors and
+// retries are kept unless overwrite is set. Snapshots and approvals get new
+// IDs and are only imported into a store that has none, so importing twice
+// doesn't duplicate them. With dryRun nothing is written.
+func Import(ctx context.Context, s Store, d *Dump, overwrite, dryRun bool) (*ImportStats, error) {
+	if d.Version > DumpVersion {
+		return nil, fmt.Errorf("unsupported dump version %d, this build supports up to %d", d.Version, DumpVersion)
+	}
+	stats := &ImportStats{}
+
+	for _, m := range d.Mappings {
+		if m.Key == "" {
+			return nil, fmt.Errorf("mapping of %s#%d has no key", m.Repo, m.IssueNumber)
+		}
+		if !overwrite {
+			if _, err := s.Get(ctx, m.Key); err == nil {
+				stats.SkippedMappings++
+				continue
+			}
+		}
+		if !dryRun {
+			if err := s.Put(ctx, m); err != nil {
+				return stats, err
+			}
+		}
+		stats.Mappings++
+	}
+
+	existing, err := s.ListCursors(ctx)
+	if err != nil {
+		return stats, err
+	}
+	for name, v := range d.Cursors {
+		if _, ok := existing[name]; ok && !overwrite {
+			continue
+		}
+		if !dryRun {
+			if err := s.SetCursor(ctx, name, v); err != nil {
+				return stats, err
+			}
+		}
+		stats.Cursors++
+	}
+
+	snaps, err := s.ListSnapshots(ctx, "")
+	if err != nil {
+		return stats, err
+	}
+	if len(snaps) > 0 {
+		stats.SkippedSnapshots = len(d.Snapshots)
+	} else {
+		for _, snap := range d.Snapshots {
+			c := *snap
+			c.ID = 0
+			if !dryRun {
+				if err := s.AddSnapshot(ctx, &c); err != nil {
+					return stats, err
+				}
+			}
+			stats.Snapshots++
+		}
+	}
+
+	approvals, err := s.ListApprovals(ctx)
+	if err != nil {
+		return stats, err
+	}
+	if len(approvals) > 0 {
+		stats.SkippedApprovals = len(d.Approvals)
+	} else {
+		for _, a := range d.Approvals {
+			c := *a
+			c.ID = 0
+			if !dryRun {
+				if err := s.PutApproval(ctx, &c); err != nil {
+					return stats, err
+				}
+			}
+			stats.Approvals++
+		}
+	}
+
+	for _, r := range d.Retries {
+		if !overwrite {
+			if _, err := s.GetRetry(ctx, r.Key); err == nil {
+				continue
+			}
+		}
+		if !dryRun {
+			if err := s.PutRetry(ctx, r); err != nil {
+				return stats, err
+			}
+		}
+		stats.Retries++
+	}
+	return stats, nil
+}
@@ -0,0 +1,426 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// MemoryStore keeps mappings in memory only; they are lost on restart
+type MemoryStore struct {
+	mu       sync.RWMutex
+	mappings map[string]*Mapping
+	cursors  map[string]string
+	// history and snapshots are ordered by ID
+	history   []*HistoryEntry
+	snapshots []*Snapshot
+	approvals []*Approval
+	retries   map[string]*Retry
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		mappings: make(map[string]*Mapping),
+		cursors:  make(map[string]string),
+		retries:  make(map[string]*Retry),
+	}
+}
+
+// Get implements Store
+func (s *MemoryStore) Get(_ context.Context, key string) (*Mapping, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.mappings[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c := *m
+	return &c, nil
+}
+
+// Put implements Store
+func (s *MemoryStore) Put(_ context.Context, m *Mapping) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := *m
+	s.mappings[m.Key] = &c
+	h := historyEntry(m)
+	h.ID = 1
+	if n := len(s.history); n > 0 {
+		h.ID = s.history[n-1].ID + 1
+	}
+	s.history = append(s.history, h)
+	return nil
+}
+
+// Delete implements Store
+func (s *MemoryStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.mappings, key)
+	return nil
+}
+
+// List implements Store
+func (s *MemoryStore) List(_ context.Context) ([]*Mapping, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ms := make([]*Mapping, 0, len(s.mappings))
+	for _, m := range s.mappings {
+		c := *m
+		ms = append(ms, &c)
+	}
+	sortMappings(ms)
+	return ms, nil
+}
+
+// History implements Store
+func (s *MemoryStore) History(_ context.Context, key string) ([]*HistoryEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	hs := make([]*HistoryEntry, 0)
+	for _, h := range s.history {
+		if key == "" || h.Key == key {
+			c := *h
+			hs = append(hs, &c)
+		}
+	}
+	return hs, nil
+}
+
+// GetCursor implements Store
+func (s *MemoryStore) GetCursor(_ context.Context, name string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cursors[name], nil
+}
+
+// SetCursor implements Store
+func (s *MemoryStore) SetCursor(_ context.Context, name, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cursors[name] = value
+	return nil
+}
+
+// ListCursors implements Store
+func (s *MemoryStore) ListCursors(_ context.Context) (map[string]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cursors := make(map[string]string, len(s.cursors))
+	for name, v := range s.cursors {
+		cursors[name] = v
+	}
+	return cursors, nil
+}
+
+// AddSnapshot implements Store
+func (s *MemoryStore) AddSnapshot(_ context.Context, snap *Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap.ID = 1
+	if n := len(s.snapshots); n > 0 {
+		snap.ID = s.snapshots[n-1].ID + 1
+	}
+	c := *snap
+	s.snapshots = append(s.snapshots, &c)
+	return nil
+}
+
+// GetSnapshot implements Store
+func (s *MemoryStore) GetSnapshot(_ context.Context, id int64) (*Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, snap := range s.snapshots {
+		if snap.ID == id {
+			c := *snap
+			return &c, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// ListSnapshots implements Store
+func (s *MemoryStore) ListSnapshots(_ context.Context, key string) ([]*Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snaps := make([]*Snapshot, 0)
+	for _, snap := range s.snapshots {
+		if key == "" || snap.Key == key {
+			c := *snap
+			snaps = append(snaps, &c)
+		}
+	}
+	return snaps, nil
+}
+
+// PutApproval implements Store
+func (s *MemoryStore) PutApproval(_ context.Context, a *Approval) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := *a
+	if a.ID != 0 {
+		for i, existing := range s.approvals {
+			if existing.ID == a.ID {
+				s.approvals[i] = &c
+				return nil
+			}
+		}
+		return ErrNotFound
+	}
+	a.ID = 1
+	if n := len(s.approvals); n > 0 {
+		a.ID = s.approvals[n-1].ID + 1
+	}
+	c.ID = a.ID
+	s.approvals = append(s.approvals, &c)
+	return nil
+}
+
+// GetApproval implements Store
+func (s *MemoryStore) GetApproval(_ context.Context, id int64) (*Approval, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, a := range s.approvals {
+		if a.ID == id {
+			c := *a
+			return &c, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// ListApprovals implements Store
+func (s *MemoryStore) ListApprovals(_ context.Context) ([]*Approval, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	as := make([]*Approval, 0, len(s.approvals))
+	for _, a := range s.approvals {
+		c := *a
+		as = append(as, &c)
+	}
+	return as, nil
+}
+
+// PutRetry implements Store
+func (s *MemoryStore) PutRetry(_ context.Context, r *Retry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := *r
+	s.retries[r.Key] = &c
+	return nil
+}
+
+// GetRetry implements Store
+func (s *MemoryStore) GetRetry(_ context.Context, key string) (*Retry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.retries[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c := *r
+	return &c, nil
+}
+
+// DeleteRetry implements Store
+func (s *MemoryStore) DeleteRetry(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.retries, key)
+	return nil
+}
+
+// ListRetries implements Store
+func (s *MemoryStore) ListRetries(_ context.Context) ([]*Retry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rs := make([]*Retry, 0, len(s.retries))
+	for _, r := range s.retries {
+		c := *r
+		rs = append(rs, &c)
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i].Key < rs[j].Key })
+	return rs, nil
+}
+
+// Close implements Store
+func (s *MemoryStore) Close() error { return nil }
+
+// FileStore is a MemoryStore that is persisted to a JSON file after every
+// change, so mappings survive restarts
+type FileStore struct {
+	*MemoryStore
+	path string
+	// writeMu serializes changes so the file always reflects the latest one
+	writeMu sync.Mutex
+}
+
+// OpenFileStore loads the state file at path, creating it on first write
+func OpenFileStore(path string) (*FileStore, error) {
+	s := &FileStore{MemoryStore: NewMemoryStore(), path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	var f stateFile
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		// Older state files only held the list of mappings
+		err = json.Unmarshal(data, &f.Mappings)
+	} else {
+		err = json.Unmarshal(data, &f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse state file: %w", err)
+	}
+	for _, m := range f.Mappings {
+		s.mappings[m.Key] = m
+	}
+	for name, v := range f.Cursors {
+		s.cursors[name] = v
+	}
+	s.history = f.History
+	s.snapshots = f.Snapshots
+	s.approvals = f.Approvals
+	for _, r := range f.Retries {
+		s.retries[r.Key] = r
+	}
+	return s, nil
+}
+
+// stateFile is the on-disk format of the file store
+type stateFile struct {
+	Mappings  []*Mapping        `json:"mappings"`
+	Cursors   map[string]string `json:"cursors,omitempty"`
+	History   []*HistoryEntry   `json:"history,omitempty"`
+	Snapshots []*Snapshot       `json:"snapshots,omitempty"`
+	Approvals []*Approval       `json:"approvals,omitempty"`
+	Retries   []*Retry          `json:"retries,omitempty"`
+}
+
+// Put implements Store
+func (s *FileStore) Put(ctx context.Context, m *Mapping) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if err := s.MemoryStore.Put(ctx, m); err != nil {
+		return err
+	}
+	return s.save(ctx)
+}
+
+// Delete implements Store
+func (s *FileStore) Delete(ctx context.Context, key string) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if err := s.MemoryStore.Delete(ctx, key); err != nil {
+		return err
+	}
+	return s.save(ctx)
+}
+
+// SetCursor implements Store
+func (s *FileStore) SetCursor(ctx context.Context, name, value string) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if err := s.MemoryStore.SetCursor(ctx, name, value); err != nil {
+		return err
+	}
+	return s.save(ctx)
+}
+
+// AddSnapshot implements Store
+func (s *FileStore) AddSnapshot(ctx context.Context, snap *Snapshot) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if err := s.MemoryStore.AddSnapshot(ctx, snap); err != nil {
+		return err
+	}
+	return s.save(ctx)
+}
+
+// PutApproval implements Store
+func (s *FileStore) PutApproval(ctx context.Context, a *Approval) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if err := s.MemoryStore.PutApproval(ctx, a); err != nil {
+		return err
+	}
+	return s.save(ctx)
+}
+
+// PutRetry implements Store
+func (s *FileStore) PutRetry(ctx context.Context, r *Retry) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if err := s.MemoryStore.PutRetry(ctx, r); err != nil {
+		return err
+	}
+	return s.save(ctx)
+}
+
+// DeleteRetry implements Store
+func (s *FileStore) DeleteRetry(ctx context.Context, key string) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if err := s.MemoryStore.DeleteRetry(ctx, key); err != nil {
+		return err
+	}
+	return s.save(ctx)
+}
+
+// save atomically rewrites the state file
+func (s *FileStore) save(ctx context.Context) error {
+	ms, err := s.MemoryStore.List(ctx)
+	if err != nil {
+		return err
+	}
+	rs, err := s.MemoryStore.ListRetries(ctx)
+	if err != nil {
+		return err
+	}
+	s.mu.RLock()
+	f := stateFile{Mappings: ms, Cursors: make(map[string]string, len(s.cursors))}
+	for name, v := range s.cursors {
+		f.Cursors[name] = v
+	}
+	f.History = s.history
+	f.Snapshots = s.snapshots
+	f.Approvals = s.approvals
+	f.Retries = rs
+	s.mu.RUnlock()
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,521 @@
+package state
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	// Registers the "pgx" database/sql driver
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// postgresSchema creates the tables of the PostgreSQL store. Like the SQLite
+// schema, columns are only ever added.
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS mappings (
+	key               TEXT PRIMARY KEY,
+	namespace         TEXT NOT NULL DEFAULT '',
+	repo              TEXT NOT NULL,
+	issue_number      INTEGER NOT NULL,
+	gh_issue_id       BIGINT NOT NULL DEFAULT 0,
+	node_id           TEXT NOT NULL DEFAULT '',
+	jira_key          TEXT NOT NULL DEFAULT '',
+	sync_status       TEXT NOT NULL DEFAULT '',
+	body_hash         TEXT NOT NULL DEFAULT '',
+	last_synced_at    TIMESTAMPTZ,
+	status_comment_id BIGINT NOT NULL DEFAULT 0,
+	merged_into       TEXT NOT NULL DEFAULT '',
+	created_at        TIMESTAMPTZ NOT NULL,
+	updated_at        TIMESTAMPTZ NOT NULL,
+	jira_instance     TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS mappings_jira_key ON mappings (jira_key);
+
+CREATE TABLE IF NOT EXISTS mapping_history (
+	id          BIGSERIAL PRIMARY KEY,
+	key         TEXT NOT NULL,
+	jira_key    TEXT NOT NULL,
+	sync_status TEXT NOT NULL,
+	body_hash   TEXT NOT NULL,
+	merged_into TEXT NOT NULL,
+	changed_at  TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS mapping_history_key ON mapping_history (key);
+
+CREATE TABLE IF NOT EXISTS cursors (
+	name  TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS snapshots (
+	id                BIGSERIAL PRIMARY KEY,
+	key               TEXT NOT NULL,
+	repo              TEXT NOT NULL,
+	issue_number      INTEGER NOT NULL,
+	jira_key          TEXT NOT NULL,
+	action            TEXT NOT NULL,
+	github_body       TEXT NOT NULL,
+	github_updated_at TIMESTAMPTZ,
+	summary           TEXT NOT NULL,
+	jira_fields       TEXT NOT NULL,
+	created_at        TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS snapshots_key ON snapshots (key);
+
+CREATE TABLE IF NOT EXISTS approvals (
+	id           BIGSERIAL PRIMARY KEY,
+	key          TEXT NOT NULL,
+	repo         TEXT NOT NULL,
+	issue_number INTEGER NOT NULL,
+	title        TEXT NOT NULL,
+	summary      TEXT NOT NULL,
+	jira_fields  TEXT NOT NULL,
+	warnings     TEXT NOT NULL,
+	status       TEXT NOT NULL,
+	decided_by   TEXT NOT NULL DEFAULT '',
+	reason       TEXT NOT NULL DEFAULT '',
+	jira_key     TEXT NOT NULL DEFAULT '',
+	created_at   TIMESTAMPTZ NOT NULL,
+	decided_at   TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS approvals_status ON approvals (status);
+
+CREATE TABLE IF NOT EXISTS retries (
+	key             TEXT PRIMARY KEY,
+	repo            TEXT NOT NULL,
+	issue_number    INTEGER NOT NULL,
+	title           TEXT NOT NULL,
+	summary         TEXT NOT NULL,
+	jira_fields     TEXT NOT NULL,
+	warnings        TEXT NOT NULL,
+	status          TEXT NOT NULL,
+	attempts        INTEGER NOT NULL,
+	last_error      TEXT NOT NULL,
+	next_attempt_at TIMESTAMPTZ NOT NULL,
+	created_at      TIMESTAMPTZ NOT NULL,
+	updated_at      TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS leases (
+	name       TEXT PRIMARY KEY,
+	holder     TEXT NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+`
+
+// postgresReportSchema creates the read-only reporting views and the
+// health snapshot table in the reporting schema. Their columns are a stable
+// interface for BI tools: columns are only ever added, never renamed or
+// removed.
+const postgresReportSchema = `
+CREATE SCHEMA IF NOT EXISTS reporting;
+
+CREATE OR REPLACE VIEW reporting.mappings AS
+SELECT key, namespace, repo, issue_number, jira_instance, jira_key, sync_status,
+	merged_into <> '' AS duplicate, merged_into, last_synced_at, created_at, updated_at
+FROM mappings;
+
+CREATE OR REPLACE VIEW reporting.history AS
+SELECT id, key, jira_key, sync_status, merged_into, changed_at
+FROM mapping_history;
+
+CREATE OR REPLACE VIEW reporting.daily_throughput AS
+SELECT date_trunc('day', created_at) AS day, repo,
+	count(*) FILTER (WHERE merged_into = '') AS created,
+	count(*) FILTER (WHERE merged_into <> '') AS duplicates
+FROM mappings
+WHERE jira_key <> ''
+GROUP BY 1, 2;
+
+CREATE OR REPLACE VIEW reporting.sync_health AS
+SELECT now() AS measured_at,
+	(SELECT count(*) FROM mappings WHERE jira_key <> '' AND merged_into = '') AS synced,
+	(SELECT count(*) FROM mappings WHERE jira_key = '') AS interrupted,
+	(SELECT count(*) FROM retries WHERE status = 'pending') AS retries_pending,
+	(SELECT count(*) FROM retries WHERE status = 'failed') AS retries_failed,
+	(SELECT count(*) FROM approvals WHERE status IN ('pending', 'approved')) AS approvals_open,
+	(SELECT max(last_synced_at) FROM mappings) AS last_synced_at;
+
+CREATE TABLE IF NOT EXISTS reporting.health_snapshots (
+	measured_at     TIMESTAMPTZ PRIMARY KEY,
+	synced          BIGINT NOT NULL,
+	interrupted     BIGINT NOT NULL,
+	retries_pending BIGINT NOT NULL,
+	retries_failed  BIGINT NOT NULL,
+	approvals_open  BIGINT NOT NULL,
+	last_synced_at  TIMESTAMPTZ
+);
+`
+
+// PostgresStore keeps the state in a PostgreSQL database shared by several
+// replicas
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// OpenPostgresStore connects to the PostgreSQL database of dsn, a URL or
+// key=value connection string, and creates the schema
+func OpenPostgresStore(dsn string) (*PostgresStore, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PostgreSQL state database: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, postgresSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create PostgreSQL schema: %w", err)
+	}
+	return &PostgresStore{db: db}, nil
+}
+
+// CreateReports implements Reporter
+func (s *PostgresStore) CreateReports(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, postgresReportSchema); err != nil {
+		return fmt.Errorf("failed to create PostgreSQL reporting views: %w", err)
+	}
+	return nil
+}
+
+// RecordHealth implements Reporter
+func (s *PostgresStore) RecordHealth(ctx context.Context) error {
+	const columns = "measured_at, synced, interrupted, retries_pending, retries_failed, approvals_open, last_synced_at"
+	_, err := s.db.ExecContext(ctx, `INSERT INTO reporting.health_snapshots (`+columns+`)
+		SELECT `+columns+` FROM reporting.sync_health ON CONFLICT (measured_at) DO NOTHING`)
+	return err
+}
+
+// Get implements Store
+func (s *PostgresStore) Get(ctx context.Context, key string) (*Mapping, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+mappingColumns+" FROM mappings WHERE key = $1", key)
+	m, err := scanMapping(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return m, err
+}
+
+// Put implements Store
+func (s *PostgresStore) Put(ctx context.Context, m *Mapping) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO mappings (`+mappingColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		ON CONFLICT (key) DO UPDATE SET
+			namespace = excluded.namespace, repo = excluded.repo,
+			issue_number = excluded.issue_number, gh_issue_id = excluded.gh_issue_id,
+			node_id = excluded.node_id, jira_key = excluded.jira_key,
+			sync_status = excluded.sync_status, body_hash = excluded.body_hash,
+			last_synced_at = excluded.last_synced_at, status_comment_id = excluded.status_comment_id,
+			merged_into = excluded.merged_into, created_at = excluded.created_at,
+			updated_at = excluded.updated_at, jira_instance = excluded.jira_instance`,
+		m.Key, m.Namespace, m.Repo, m.IssueNumber, m.IssueID, m.NodeID, m.JiraKey,
+		m.SyncStatus, m.BodyHash, nullTime(m.LastSyncedAt), m.StatusCommentID, m.MergedInto,
+		m.CreatedAt.UTC(), m.UpdatedAt.UTC(), m.JiraInstance)
+	if err != nil {
+		return fmt.Errorf("failed to store mapping %s: %w", m.Key, err)
+	}
+
+	h := historyEntry(m)
+	_, err = tx.ExecContext(ctx, `INSERT INTO mapping_history (key, jira_key, sync_status, body_hash, merged_into, changed_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`, h.Key, h.JiraKey, h.SyncStatus, h.BodyHash, h.MergedInto, h.ChangedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record history of %s: %w", m.Key, err)
+	}
+	return tx.Commit()
+}
+
+// Delete implements Store
+func (s *PostgresStore) Delete(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM mappings WHERE key = $1", key)
+	return err
+}
+
+// List implements Store
+func (s *PostgresStore) List(ctx context.Context) ([]*Mapping, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+mappingColumns+" FROM mappings ORDER BY key")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ms := make([]*Mapping, 0)
+	for rows.Next() {
+		m, err := scanMapping(rows)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+	return ms, rows.Err()
+}
+
+// History implements Store
+func (s *PostgresStore) History(ctx context.Context, key string) ([]*HistoryEntry, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, key, jira_key, sync_status, body_hash, merged_into, changed_at
+		FROM mapping_history WHERE $1::text = '' OR key = $1 ORDER BY id`, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hs := make([]*HistoryEntry, 0)
+	for rows.Next() {
+		var h HistoryEntry
+		if err := rows.Scan(&h.ID, &h.Key, &h.JiraKey, &h.SyncStatus, &h.BodyHash, &h.MergedInto, &h.ChangedAt); err != nil {
+			return nil, err
+		}
+		hs = append(hs, &h)
+	}
+	return hs, rows.Err()
+}
+
+// GetCursor implements Store
+func (s *PostgresStore) GetCursor(ctx context.Context, name string) (string, error) {
+	var value string
+	err := s.db.QueryRowContext(ctx, "SELECT value FROM cursors WHERE name = $1", name).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return value, err
+}
+
+// SetCursor implements Store
+func (s *PostgresStore) SetCursor(ctx context.Context, name, value string) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO cursors (name, value) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET value = excluded.value`, name, value)
+	return err
+}
+
+// ListCursors implements Store
+func (s *PostgresStore) ListCursors(ctx context.Context) (map[string]string, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT name, value FROM cursors")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cursors := make(map[string]string)
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		cursors[name] = value
+	}
+	return cursors, rows.Err()
+}
+
+// AcquireLease implements Locker. Expiry is checked against the database
+// clock, so the clocks of the replicas don't matter.
+func (s *PostgresStore) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `INSERT INTO leases (name, holder, expires_at)
+		VALUES ($1, $2, now() + $3 * interval '1 millisecond')
+		ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, expires_at = excluded.expires_at
+		WHERE leases.holder = excluded.holder OR leases.expires_at < now()`,
+		name, holder, ttl.Milliseconds())
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lease %s: %w", name, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// ReleaseLease implements Locker
+func (s *PostgresStore) ReleaseLease(ctx context.Context, name, holder string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM leases WHERE name = $1 AND holder = $2", name, holder)
+	return err
+}
+
+// AddSnapshot implements Store
+func (s *PostgresStore) AddSnapshot(ctx context.Context, snap *Snapshot) error {
+	fields, err := json.Marshal(snap.JiraFields)
+	if err != nil {
+		return err
+	}
+	err = s.db.QueryRowContext(ctx, `INSERT INTO snapshots
+		(key, repo, issue_number, jira_key, action, github_body, github_updated_at, summary, jira_fields, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`,
+		snap.Key, snap.Repo, snap.IssueNumber, snap.JiraKey, snap.Action, snap.GitHubBody,
+		nullTime(snap.GitHubUpdatedAt), snap.Summary, string(fields), snap.CreatedAt.UTC()).Scan(&snap.ID)
+	if err != nil {
+		return fmt.Errorf("failed to store snapshot: %w", err)
+	}
+	return nil
+}
+
+// GetSnapshot implements Store
+func (s *PostgresStore) GetSnapshot(ctx context.Context, id int64) (*Snapshot, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+snapshotColumns+" FROM snapshots WHERE id = $1", id)
+	snap, err := scanSnapshot(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return snap, err
+}
+
+// ListSnapshots implements Store
+func (s *PostgresStore) ListSnapshots(ctx context.Context, key string) ([]*Snapshot, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+snapshotColumns+" FROM snapshots WHERE $1::text = '' OR key = $1 ORDER BY id", key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snaps := make([]*Snapshot, 0)
+	for rows.Next() {
+		snap, err := scanSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		snaps = append(snaps, snap)
+	}
+	return snaps, rows.Err()
+}
+
+// PutApproval implements Store
+func (s *PostgresStore) PutApproval(ctx context.Context, a *Approval) error {
+	fields, err := json.Marshal(a.JiraFields)
+	if err != nil {
+		return err
+	}
+	warnings, err := json.Marshal(a.Warnings)
+	if err != nil {
+		return err
+	}
+
+	if a.ID == 0 {
+		err := s.db.QueryRowContext(ctx, `INSERT INTO approvals
+			(key, repo, issue_number, title, summary, jira_fields, warnings, status, decided_by, reason, jira_key, created_at, decided_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING id`,
+			a.Key, a.Repo, a.IssueNumber, a.Title, a.Summary, string(fields), string(warnings), a.Status,
+			a.DecidedBy, a.Reason, a.JiraKey, a.CreatedAt.UTC(), nullTime(a.DecidedAt)).Scan(&a.ID)
+		if err != nil {
+			return fmt.Errorf("failed to store approval: %w", err)
+		}
+		return nil
+	}
+
+	res, err := s.db.ExecContext(ctx, `UPDATE approvals SET
+		key = $1, repo = $2, issue_number = $3, title = $4, summary = $5, jira_fields = $6, warnings = $7, status = $8,
+		decided_by = $9, reason = $10, jira_key = $11, created_at = $12, decided_at = $13
+		WHERE id = $14`,
+		a.Key, a.Repo, a.IssueNumber, a.Title, a.Summary, string(fields), string(warnings), a.Status,
+		a.DecidedBy, a.Reason, a.JiraKey, a.CreatedAt.UTC(), nullTime(a.DecidedAt), a.ID)
+	if err != nil {
+		return fmt.Errorf("failed to store approval %d: %w", a.ID, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetApproval implements Store
+func (s *PostgresStore) GetApproval(ctx context.Context, id int64) (*Approval, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+approvalColumns+" FROM approvals WHERE id = $1", id)
+	a, err := scanApproval(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return a, err
+}
+
+// ListApprovals implements Store
+func (s *PostgresStore) ListApprovals(ctx context.Context) ([]*Approval, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+approvalColumns+" FROM approvals ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	as := make([]*Approval, 0)
+	for rows.Next() {
+		a, err := scanApproval(rows)
+		if err != nil {
+			return nil, err
+		}
+		as = append(as, a)
+	}
+	return as, rows.Err()
+}
+
+// PutRetry implements Store
+func (s *PostgresStore) PutRetry(ctx context.Context, r *Retry) error {
+	fields, err := json.Marshal(r.JiraFields)
+	if err != nil {
+		return err
+	}
+	warnings, err := json.Marshal(r.Warnings)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO retries (`+retryColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (key) DO UPDATE SET
+			repo = excluded.repo, issue_number = excluded.issue_number, title = excluded.title,
+			summary = excluded.summary, jira_fields = excluded.jira_fields, warnings = excluded.warnings,
+			status = excluded.status, attempts = excluded.attempts, last_error = excluded.last_error,
+			next_attempt_at = excluded.next_attempt_at, created_at = excluded.created_at,
+			updated_at = excluded.updated_at`,
+		r.Key, r.Repo, r.IssueNumber, r.Title, r.Summary, string(fields), string(warnings), r.Status,
+		r.Attempts, r.LastError, r.NextAttemptAt.UTC(), r.CreatedAt.UTC(), r.UpdatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to store retry of %s: %w", r.Key, err)
+	}
+	return nil
+}
+
+// GetRetry implements Store
+func (s *PostgresStore) GetRetry(ctx context.Context, key string) (*Retry, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+retryColumns+" FROM retries WHERE key = $1", key)
+	r, err := scanRetry(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return r, err
+}
+
+// DeleteRetry implements Store
+func (s *PostgresStore) DeleteRetry(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM retries WHERE key = $1", key)
+	return err
+}
+
+// ListRetries implements Store
+func (s *PostgresStore) ListRetries(ctx context.Context) ([]*Retry, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+retryColumns+" FROM retries ORDER BY key")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rs := make([]*Retry, 0)
+	for rows.Next() {
+		r, err := scanRetry(rows)
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, r)
+	}
+	return rs, rows.Err()
+}
+
+// Close implements Store
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,374 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisPrefix starts the names of all keys of the Redis store
+const redisPrefix = "gh-jira:"
+
+// Keys of the Redis store. Mappings, cursors, snapshots, approvals and
+// retries are hashes of JSON documents; the history and the snapshots of
+// each mapping key are lists.
+const (
+	redisMappings   = redisPrefix + "mappings"
+	redisHistory    = redisPrefix + "history"
+	redisHistoryID  = redisPrefix + "history:id"
+	redisCursors    = redisPrefix + "cursors"
+	redisSnapshots  = redisPrefix + "snapshots"
+	redisSnapshotID = redisPrefix + "snapshots:id"
+	redisApprovals  = redisPrefix + "approvals"
+	redisApprovalID = redisPrefix + "approvals:id"
+	redisRetries    = redisPrefix + "retries"
+	redisLease      = redisPrefix + "lease:"
+)
+
+// acquireLeaseScript sets the lease to the holder unless another holder has
+// it; expired leases are removed by Redis
+var acquireLeaseScript = redis.NewScript(`
+local holder = redis.call('GET', KEYS[1])
+if holder and holder ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1
+`)
+
+// releaseLeaseScript deletes the lease if the holder has it
+var releaseLeaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// RedisStore keeps the state in Redis, shared by several replicas
+type RedisStore struct {
+	client *redis.Client
+}
+
+// OpenRedisStore connects to the Redis server of dsn, a redis:// or
+// rediss:// URL
+func OpenRedisStore(dsn string) (*RedisStore, error) {
+	opts, err := redis.ParseURL(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	return &RedisStore{client: client}, nil
+}
+
+// Get implements Store
+func (s *RedisStore) Get(ctx context.Context, key string) (*Mapping, error) {
+	var m Mapping
+	if err := s.hget(ctx, redisMappings, key, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Put implements Store
+func (s *RedisStore) Put(ctx context.Context, m *Mapping) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	h := historyEntry(m)
+	if h.ID, err = s.client.Incr(ctx, redisHistoryID).Result(); err != nil {
+		return fmt.Errorf("failed to record history of %s: %w", m.Key, err)
+	}
+	entry, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.HSet(ctx, redisMappings, m.Key, data)
+		p.RPush(ctx, redisHistory, entry)
+		p.RPush(ctx, redisHistory+":"+m.Key, entry)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store mapping %s: %w", m.Key, err)
+	}
+	return nil
+}
+
+// Delete implements Store
+func (s *RedisStore) Delete(ctx context.Context, key string) error {
+	return s.client.HDel(ctx, redisMappings, key).Err()
+}
+
+// List implements Store
+func (s *RedisStore) List(ctx context.Context) ([]*Mapping, error) {
+	ms := make([]*Mapping, 0)
+	err := s.hgetall(ctx, redisMappings, func(data []byte) error {
+		var m Mapping
+		if err := json.Unmarshal(data, &m); err != nil {
+			return err
+		}
+		ms = append(ms, &m)
+		return nil
+	})
+	sortMappings(ms)
+	return ms, err
+}
+
+// History implements Store
+func (s *RedisStore) History(ctx context.Context, key string) ([]*HistoryEntry, error) {
+	list := redisHistory
+	if key != "" {
+		list += ":" + key
+	}
+	entries, err := s.client.LRange(ctx, list, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	hs := make([]*HistoryEntry, 0, len(entries))
+	for _, e := range entries {
+		var h HistoryEntry
+		if err := json.Unmarshal([]byte(e), &h); err != nil {
+			return nil, fmt.Errorf("invalid history entry: %w", err)
+		}
+		hs = append(hs, &h)
+	}
+	return hs, nil
+}
+
+// GetCursor implements Store
+func (s *RedisStore) GetCursor(ctx context.Context, name string) (string, error) {
+	value, err := s.client.HGet(ctx, redisCursors, name).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	return value, err
+}
+
+// SetCursor implements Store
+func (s *RedisStore) SetCursor(ctx context.Context, name, value string) error {
+	return s.client.HSet(ctx, redisCursors, name, value).Err()
+}
+
+// ListCursors implements Store
+func (s *RedisStore) ListCursors(ctx context.Context) (map[string]string, error) {
+	return s.client.HGetAll(ctx, redisCursors).Result()
+}
+
+// AcquireLease implements Locker. Redis expires the lease after ttl.
+func (s *RedisStore) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	n, err := acquireLeaseScript.Run(ctx, s.client, []string{redisLease + name}, holder, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lease %s: %w", name, err)
+	}
+	return n == 1, nil
+}
+
+// ReleaseLease implements Locker
+func (s *RedisStore) ReleaseLease(ctx context.Context, name, holder string) error {
+	return releaseLeaseScript.Run(ctx, s.client, []string{redisLease + name}, holder).Err()
+}
+
+// AddSnapshot implements Store
+func (s *RedisStore) AddSnapshot(ctx context.Context, snap *Snapshot) error {
+	id, err := s.client.Incr(ctx, redisSnapshotID).Result()
+	if err != nil {
+		return fmt.Errorf("failed to store snapshot: %w", err)
+	}
+	snap.ID = id
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	field := strconv.FormatInt(id, 10)
+	_, err = s.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.HSet(ctx, redisSnapshots, field, data)
+		p.RPush(ctx, redisSnapshots+":"+snap.Key, field)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store snapshot: %w", err)
+	}
+	return nil
+}
+
+// GetSnapshot implements Store
+func (s *RedisStore) GetSnapshot(ctx context.Context, id int64) (*Snapshot, error) {
+	var snap Snapshot
+	if err := s.hget(ctx, redisSnapshots, strconv.FormatInt(id, 10), &snap); err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+// ListSnapshots implements Store
+func (s *RedisStore) ListSnapshots(ctx context.Context, key string) ([]*Snapshot, error) {
+	snaps := make([]*Snapshot, 0)
+	add := func(data []byte) error {
+		var snap Snapshot
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return err
+		}
+		snaps = append(snaps, &snap)
+		return nil
+	}
+
+	if key == "" {
+		if err := s.hgetall(ctx, redisSnapshots, add); err != nil {
+			return nil, err
+		}
+	} else {
+		ids, err := s.client.LRange(ctx, redisSnapshots+":"+key, 0, -1).Result()
+		if err != nil || len(ids) == 0 {
+			return snaps, err
+		}
+		values, err := s.client.HMGet(ctx, redisSnapshots, ids...).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range values {
+			if data, ok := v.(string); ok {
+				if err := add([]byte(data)); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].ID < snaps[j].ID })
+	return snaps, nil
+}
+
+// PutApproval implements Store
+func (s *RedisStore) PutApproval(ctx context.Context, a *Approval) error {
+	if a.ID == 0 {
+		id, err := s.client.Incr(ctx, redisApprovalID).Result()
+		if err != nil {
+			return fmt.Errorf("failed to store approval: %w", err)
+		}
+		a.ID = id
+	} else if ok, err := s.client.HExists(ctx, redisApprovals, strconv.FormatInt(a.ID, 10)).Result(); err != nil {
+		return fmt.Errorf("failed to store approval %d: %w", a.ID, err)
+	} else if !ok {
+		return ErrNotFound
+	}
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	if err := s.client.HSet(ctx, redisApprovals, strconv.FormatInt(a.ID, 10), data).Err(); err != nil {
+		return fmt.Errorf("failed to store approval %d: %w", a.ID, err)
+	}
+	return nil
+}
+
+// GetApproval implements Store
+func (s *RedisStore) GetApproval(ctx context.Context, id int64) (*Approval, error) {
+	var a Approval
+	if err := s.hget(ctx, redisApprovals, strconv.FormatInt(id, 10), &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// ListApprovals implements Store
+func (s *RedisStore) ListApprovals(ctx context.Context) ([]*Approval, error) {
+	as := make([]*Approval, 0)
+	err := s.hgetall(ctx, redisApprovals, func(data []byte) error {
+		var a Approval
+		if err := json.Unmarshal(data, &a); err != nil {
+			return err
+		}
+		as = append(as, &a)
+		return nil
+	})
+	sort.Slice(as, func(i, j int) bool { return as[i].ID < as[j].ID })
+	return as, err
+}
+
+// PutRetry implements Store
+func (s *RedisStore) PutRetry(ctx context.Context, r *Retry) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err := s.client.HSet(ctx, redisRetries, r.Key, data).Err(); err != nil {
+		return fmt.Errorf("failed to store retry of %s: %w", r.Key, err)
+	}
+	return nil
+}
+
+// GetRetry implements Store
+func (s *RedisStore) GetRetry(ctx context.Context, key string) (*Retry, error) {
+	var r Retry
+	if err := s.hget(ctx, redisRetries, key, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// DeleteRetry implements Store
+func (s *RedisStore) DeleteRetry(ctx context.Context, key string) error {
+	return s.client.HDel(ctx, redisRetries, key).Err()
+}
+
+// ListRetries implements Store
+func (s *RedisStore) ListRetries(ctx context.Context) ([]*Retry, error) {
+	rs := make([]*Retry, 0)
+	err := s.hgetall(ctx, redisRetries, func(data []byte) error {
+		var r Retry
+		if err := json.Unmarshal(data, &r); err != nil {
+			return err
+		}
+		rs = append(rs, &r)
+		return nil
+	})
+	sort.Slice(rs, func(i, j int) bool { return rs[i].Key < rs[j].Key })
+	return rs, err
+}
+
+// Close implements Store
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
+
+// hget decodes the JSON document in a field of a hash, or returns
+// ErrNotFound
+func (s *RedisStore) hget(ctx context.Context, hash, field string, v interface{}) error {
+	data, err := s.client.HGet(ctx, hash, field).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid %s entry %s: %w", hash, field, err)
+	}
+	return nil
+}
+
+// hgetall passes the JSON documents of all fields of a hash to fn
+func (s *RedisStore) hgetall(ctx context.Context, hash string, fn func(data []byte) error) error {
+	values, err := s.client.HGetAll(ctx, hash).Result()
+	if err != nil {
+		return err
+	}
+	for field, v := range values {
+		if err := fn([]byte(v)); err != nil {
+			return fmt.Errorf("invalid %s entry %s: %w", hash, field, err)
+		}
+	}
+	return nil
+}
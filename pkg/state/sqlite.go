@@ -0,0 +1,575 @@
+package state
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	// Registers the pure Go "sqlite" driver, so no cgo toolchain is needed
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema creates the tables of the SQLite store. Columns are only ever
+// added, so existing databases keep working after an upgrade.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS mappings (
+	key               TEXT PRIMARY KEY,
+	namespace         TEXT NOT NULL DEFAULT '',
+	repo              TEXT NOT NULL,
+	issue_number      INTEGER NOT NULL,
+	gh_issue_id       INTEGER NOT NULL DEFAULT 0,
+	node_id           TEXT NOT NULL DEFAULT '',
+	jira_key          TEXT NOT NULL DEFAULT '',
+	sync_status       TEXT NOT NULL DEFAULT '',
+	body_hash         TEXT NOT NULL DEFAULT '',
+	last_synced_at    TIMESTAMP,
+	status_comment_id INTEGER NOT NULL DEFAULT 0,
+	merged_into       TEXT NOT NULL DEFAULT '',
+	created_at        TIMESTAMP NOT NULL,
+	updated_at        TIMESTAMP NOT NULL,
+	jira_instance     TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS mappings_jira_key ON mappings (jira_key);
+
+CREATE TABLE IF NOT EXISTS mapping_history (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	key         TEXT NOT NULL,
+	jira_key    TEXT NOT NULL,
+	sync_status TEXT NOT NULL,
+	body_hash   TEXT NOT NULL,
+	merged_into TEXT NOT NULL,
+	changed_at  TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS mapping_history_key ON mapping_history (key);
+
+CREATE TABLE IF NOT EXISTS cursors (
+	name  TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS snapshots (
+	id                INTEGER PRIMARY KEY AUTOINCREMENT,
+	key               TEXT NOT NULL,
+	repo              TEXT NOT NULL,
+	issue_number      INTEGER NOT NULL,
+	jira_key          TEXT NOT NULL,
+	action            TEXT NOT NULL,
+	github_body       TEXT NOT NULL,
+	github_updated_at TIMESTAMP,
+	summary           TEXT NOT NULL,
+	jira_fields       TEXT NOT NULL,
+	created_at        TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS snapshots_key ON snapshots (key);
+
+CREATE TABLE IF NOT EXISTS approvals (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	key          TEXT NOT NULL,
+	repo         TEXT NOT NULL,
+	issue_number INTEGER NOT NULL,
+	title        TEXT NOT NULL,
+	summary      TEXT NOT NULL,
+	jira_fields  TEXT NOT NULL,
+	warnings     TEXT NOT NULL,
+	status       TEXT NOT NULL,
+	decided_by   TEXT NOT NULL DEFAULT '',
+	reason       TEXT NOT NULL DEFAULT '',
+	jira_key     TEXT NOT NULL DEFAULT '',
+	created_at   TIMESTAMP NOT NULL,
+	decided_at   TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS approvals_status ON approvals (status);
+
+CREATE TABLE IF NOT EXISTS retries (
+	key             TEXT PRIMARY KEY,
+	repo            TEXT NOT NULL,
+	issue_number    INTEGER NOT NULL,
+	title           TEXT NOT NULL,
+	summary         TEXT NOT NULL,
+	jira_fields     TEXT NOT NULL,
+	warnings        TEXT NOT NULL,
+	status          TEXT NOT NULL,
+	attempts        INTEGER NOT NULL,
+	last_error      TEXT NOT NULL,
+	next_attempt_at TIMESTAMP NOT NULL,
+	created_at      TIMESTAMP NOT NULL,
+	updated_at      TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS leases (
+	name       TEXT PRIMARY KEY,
+	holder     TEXT NOT NULL,
+	expires_at INTEGER NOT NULL
+);
+`
+
+// sqliteColumns are the columns added after the first release, which
+// CREATE TABLE IF NOT EXISTS doesn't add to existing tables
+var sqliteColumns = []struct{ table, column, definition string }{
+	{"mappings", "jira_instance", "TEXT NOT NULL DEFAULT ''"},
+}
+
+const mappingColumns = `key, namespace, repo, issue_number, gh_issue_id, node_id, jira_key,
+	sync_status, body_hash, last_synced_at, status_comment_id, merged_into, created_at, updated_at,
+	jira_instance`
+
+// SQLiteStore keeps the state in a SQLite database. Every change is a
+// transaction, so the database stays consistent if the process crashes.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// OpenSQLiteStore opens or creates the SQLite database at path
+func OpenSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_time_format=sqlite")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite state database: %w", err)
+	}
+	// SQLite allows a single writer; serializing in the pool avoids SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create SQLite schema: %w", err)
+	}
+	if err := addSQLiteColumns(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to upgrade SQLite schema: %w", err)
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// addSQLiteColumns adds the missing sqliteColumns to databases created by
+// earlier versions
+func addSQLiteColumns(db *sql.DB) error {
+	for _, c := range sqliteColumns {
+		var n int
+		err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", c.table, c.column).Scan(&n)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.column, c.definition)); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", c.table, c.column, err)
+		}
+	}
+	return nil
+}
+
+// Get implements Store
+func (s *SQLiteStore) Get(ctx context.Context, key string) (*Mapping, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+mappingColumns+" FROM mappings WHERE key = ?", key)
+	m, err := scanMapping(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return m, err
+}
+
+// Put implements Store
+func (s *SQLiteStore) Put(ctx context.Context, m *Mapping) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO mappings (`+mappingColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			namespace = excluded.namespace, repo = excluded.repo,
+			issue_number = excluded.issue_number, gh_issue_id = excluded.gh_issue_id,
+			node_id = excluded.node_id, jira_key = excluded.jira_key,
+			sync_status = excluded.sync_status, body_hash = excluded.body_hash,
+			last_synced_at = excluded.last_synced_at, status_comment_id = excluded.status_comment_id,
+			merged_into = excluded.merged_into, created_at = excluded.created_at,
+			updated_at = excluded.updated_at, jira_instance = excluded.jira_instance`,
+		m.Key, m.Namespace, m.Repo, m.IssueNumber, m.IssueID, m.NodeID, m.JiraKey,
+		m.SyncStatus, m.BodyHash, nullTime(m.LastSyncedAt), m.StatusCommentID, m.MergedInto,
+		m.CreatedAt.UTC(), m.UpdatedAt.UTC(), m.JiraInstance)
+	if err != nil {
+		return fmt.Errorf("failed to store mapping %s: %w", m.Key, err)
+	}
+
+	h := historyEntry(m)
+	_, err = tx.ExecContext(ctx, `INSERT INTO mapping_history (key, jira_key, sync_status, body_hash, merged_into, changed_at)
+		VALUES (?, ?, ?, ?, ?, ?)`, h.Key, h.JiraKey, h.SyncStatus, h.BodyHash, h.MergedInto, h.ChangedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record history of %s: %w", m.Key, err)
+	}
+	return tx.Commit()
+}
+
+// Delete implements Store
+func (s *SQLiteStore) Delete(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM mappings WHERE key = ?", key)
+	return err
+}
+
+// List implements Store
+func (s *SQLiteStore) List(ctx context.Context) ([]*Mapping, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+mappingColumns+" FROM mappings ORDER BY key")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ms := make([]*Mapping, 0)
+	for rows.Next() {
+		m, err := scanMapping(rows)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+	return ms, rows.Err()
+}
+
+// History implements Store
+func (s *SQLiteStore) History(ctx context.Context, key string) ([]*HistoryEntry, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, key, jira_key, sync_status, body_hash, merged_into, changed_at
+		FROM mapping_history WHERE ? = '' OR key = ? ORDER BY id`, key, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hs := make([]*HistoryEntry, 0)
+	for rows.Next() {
+		var h HistoryEntry
+		if err := rows.Scan(&h.ID, &h.Key, &h.JiraKey, &h.SyncStatus, &h.BodyHash, &h.MergedInto, &h.ChangedAt); err != nil {
+			return nil, err
+		}
+		hs = append(hs, &h)
+	}
+	return hs, rows.Err()
+}
+
+// GetCursor implements Store
+func (s *SQLiteStore) GetCursor(ctx context.Context, name string) (string, error) {
+	var value string
+	err := s.db.QueryRowContext(ctx, "SELECT value FROM cursors WHERE name = ?", name).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return value, err
+}
+
+// SetCursor implements Store
+func (s *SQLiteStore) SetCursor(ctx context.Context, name, value string) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO cursors (name, value) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET value = excluded.value`, name, value)
+	return err
+}
+
+// ListCursors implements Store
+func (s *SQLiteStore) ListCursors(ctx context.Context) (map[string]string, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT name, value FROM cursors")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cursors := make(map[string]string)
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		cursors[name] = value
+	}
+	return cursors, rows.Err()
+}
+
+// AcquireLease implements Locker. Expiry times are Unix milliseconds, so
+// they compare correctly across processes.
+func (s *SQLiteStore) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	res, err := s.db.ExecContext(ctx, `INSERT INTO leases (name, holder, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, expires_at = excluded.expires_at
+		WHERE leases.holder = excluded.holder OR leases.expires_at < ?`,
+		name, holder, now.Add(ttl).UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lease %s: %w", name, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// ReleaseLease implements Locker
+func (s *SQLiteStore) ReleaseLease(ctx context.Context, name, holder string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM leases WHERE name = ? AND holder = ?", name, holder)
+	return err
+}
+
+// AddSnapshot implements Store
+func (s *SQLiteStore) AddSnapshot(ctx context.Context, snap *Snapshot) error {
+	fields, err := json.Marshal(snap.JiraFields)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx, `INSERT INTO snapshots
+		(key, repo, issue_number, jira_key, action, github_body, github_updated_at, summary, jira_fields, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		snap.Key, snap.Repo, snap.IssueNumber, snap.JiraKey, snap.Action, snap.GitHubBody,
+		nullTime(snap.GitHubUpdatedAt), snap.Summary, string(fields), snap.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to store snapshot: %w", err)
+	}
+	snap.ID, err = res.LastInsertId()
+	return err
+}
+
+const snapshotColumns = `id, key, repo, issue_number, jira_key, action, github_body, github_updated_at,
+	summary, jira_fields, created_at`
+
+// GetSnapshot implements Store
+func (s *SQLiteStore) GetSnapshot(ctx context.Context, id int64) (*Snapshot, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+snapshotColumns+" FROM snapshots WHERE id = ?", id)
+	snap, err := scanSnapshot(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return snap, err
+}
+
+// ListSnapshots implements Store
+func (s *SQLiteStore) ListSnapshots(ctx context.Context, key string) ([]*Snapshot, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+snapshotColumns+" FROM snapshots WHERE ? = '' OR key = ? ORDER BY id", key, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snaps := make([]*Snapshot, 0)
+	for rows.Next() {
+		snap, err := scanSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		snaps = append(snaps, snap)
+	}
+	return snaps, rows.Err()
+}
+
+const approvalColumns = `id, key, repo, issue_number, title, summary, jira_fields, warnings, status,
+	decided_by, reason, jira_key, created_at, decided_at`
+
+// PutApproval implements Store
+func (s *SQLiteStore) PutApproval(ctx context.Context, a *Approval) error {
+	fields, err := json.Marshal(a.JiraFields)
+	if err != nil {
+		return err
+	}
+	warnings, err := json.Marshal(a.Warnings)
+	if err != nil {
+		return err
+	}
+
+	if a.ID == 0 {
+		res, err := s.db.ExecContext(ctx, `INSERT INTO approvals
+			(key, repo, issue_number, title, summary, jira_fields, warnings, status, decided_by, reason, jira_key, created_at, decided_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			a.Key, a.Repo, a.IssueNumber, a.Title, a.Summary, string(fields), string(warnings), a.Status,
+			a.DecidedBy, a.Reason, a.JiraKey, a.CreatedAt.UTC(), nullTime(a.DecidedAt))
+		if err != nil {
+			return fmt.Errorf("failed to store approval: %w", err)
+		}
+		a.ID, err = res.LastInsertId()
+		return err
+	}
+
+	res, err := s.db.ExecContext(ctx, `UPDATE approvals SET
+		key = ?, repo = ?, issue_number = ?, title = ?, summary = ?, jira_fields = ?, warnings = ?, status = ?,
+		decided_by = ?, reason = ?, jira_key = ?, created_at = ?, decided_at = ?
+		WHERE id = ?`,
+		a.Key, a.Repo, a.IssueNumber, a.Title, a.Summary, string(fields), string(warnings), a.Status,
+		a.DecidedBy, a.Reason, a.JiraKey, a.CreatedAt.UTC(), nullTime(a.DecidedAt), a.ID)
+	if err != nil {
+		return fmt.Errorf("failed to store approval %d: %w", a.ID, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetApproval implements Store
+func (s *SQLiteStore) GetApproval(ctx context.Context, id int64) (*Approval, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+approvalColumns+" FROM approvals WHERE id = ?", id)
+	a, err := scanApproval(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return a, err
+}
+
+// ListApprovals implements Store
+func (s *SQLiteStore) ListApprovals(ctx context.Context) ([]*Approval, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+approvalColumns+" FROM approvals ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	as := make([]*Approval, 0)
+	for rows.Next() {
+		a, err := scanApproval(rows)
+		if err != nil {
+			return nil, err
+		}
+		as = append(as, a)
+	}
+	return as, rows.Err()
+}
+
+const retryColumns = `key, repo, issue_number, title, summary, jira_fields, warnings, status,
+	attempts, last_error, next_attempt_at, created_at, updated_at`
+
+// PutRetry implements Store
+func (s *SQLiteStore) PutRetry(ctx context.Context, r *Retry) error {
+	fields, err := json.Marshal(r.JiraFields)
+	if err != nil {
+		return err
+	}
+	warnings, err := json.Marshal(r.Warnings)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO retries (`+retryColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			repo = excluded.repo, issue_number = excluded.issue_number, title = excluded.title,
+			summary = excluded.summary, jira_fields = excluded.jira_fields, warnings = excluded.warnings,
+			status = excluded.status, attempts = excluded.attempts, last_error = excluded.last_error,
+			next_attempt_at = excluded.next_attempt_at, created_at = excluded.created_at,
+			updated_at = excluded.updated_at`,
+		r.Key, r.Repo, r.IssueNumber, r.Title, r.Summary, string(fields), string(warnings), r.Status,
+		r.Attempts, r.LastError, r.NextAttemptAt.UTC(), r.CreatedAt.UTC(), r.UpdatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to store retry of %s: %w", r.Key, err)
+	}
+	return nil
+}
+
+// GetRetry implements Store
+func (s *SQLiteStore) GetRetry(ctx context.Context, key string) (*Retry, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+retryColumns+" FROM retries WHERE key = ?", key)
+	r, err := scanRetry(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return r, err
+}
+
+// DeleteRetry implements Store
+func (s *SQLiteStore) DeleteRetry(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM retries WHERE key = ?", key)
+	return err
+}
+
+// ListRetries implements Store
+func (s *SQLiteStore) ListRetries(ctx context.Context) ([]*Retry, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+retryColumns+" FROM retries ORDER BY key")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rs := make([]*Retry, 0)
+	for rows.Next() {
+		r, err := scanRetry(rows)
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, r)
+	}
+	return rs, rows.Err()
+}
+
+// Close implements Store
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// scanner is implemented by *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanMapping(row scanner) (*Mapping, error) {
+	var m Mapping
+	var lastSynced sql.NullTime
+	err := row.Scan(&m.Key, &m.Namespace, &m.Repo, &m.IssueNumber, &m.IssueID, &m.NodeID, &m.JiraKey,
+		&m.SyncStatus, &m.BodyHash, &lastSynced, &m.StatusCommentID, &m.MergedInto, &m.CreatedAt, &m.UpdatedAt,
+		&m.JiraInstance)
+	if err != nil {
+		return nil, err
+	}
+	m.LastSyncedAt = lastSynced.Time
+	return &m, nil
+}
+
+func scanSnapshot(row scanner) (*Snapshot, error) {
+	var snap Snapshot
+	var updated sql.NullTime
+	var fields string
+	err := row.Scan(&snap.ID, &snap.Key, &snap.Repo, &snap.IssueNumber, &snap.JiraKey, &snap.Action,
+		&snap.GitHubBody, &updated, &snap.Summary, &fields, &snap.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	snap.GitHubUpdatedAt = updated.Time
+	if err := json.Unmarshal([]byte(fields), &snap.JiraFields); err != nil {
+		return nil, fmt.Errorf("snapshot %d: invalid Jira fields: %w", snap.ID, err)
+	}
+	return &snap, nil
+}
+
+func scanApproval(row scanner) (*Approval, error) {
+	var a Approval
+	var decided sql.NullTime
+	var fields, warnings string
+	err := row.Scan(&a.ID, &a.Key, &a.Repo, &a.IssueNumber, &a.Title, &a.Summary, &fields, &warnings, &a.Status,
+		&a.DecidedBy, &a.Reason, &a.JiraKey, &a.CreatedAt, &decided)
+	if err != nil {
+		return nil, err
+	}
+	a.DecidedAt = decided.Time
+	if err := json.Unmarshal([]byte(fields), &a.JiraFields); err != nil {
+		return nil, fmt.Errorf("approval %d: invalid Jira fields: %w", a.ID, err)
+	}
+	if err := json.Unmarshal([]byte(warnings), &a.Warnings); err != nil {
+		return nil, fmt.Errorf("approval %d: invalid warnings: %w", a.ID, err)
+	}
+	return &a, nil
+}
+
+func scanRetry(row scanner) (*Retry, error) {
+	var r Retry
+	var fields, warnings string
+	err := row.Scan(&r.Key, &r.Repo, &r.IssueNumber, &r.Title, &r.Summary, &fields, &warnings, &r.Status,
+		&r.Attempts, &r.LastError, &r.NextAttemptAt, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(fields), &r.JiraFields); err != nil {
+		return nil, fmt.Errorf("retry of %s: invalid Jira fields: %w", r.Key, err)
+	}
+	if err := json.Unmarshal([]byte(warnings), &r.Warnings); err != nil {
+		return nil, fmt.Errorf("retry of %s: invalid warnings: %w", r.Key, err)
+	}
+	return &r, nil
+}
+
+// nullTime stores zero times as NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
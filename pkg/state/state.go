@@ -0,0 +1,293 @@
+// Package state persists the mapping between GitHub issues and the Jira
+// issues created for them.
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// ErrNotFound is returned when no mapping or snapshot exists for a key
+var ErrNotFound = errors.New("not found")
+
+// Sync statuses of a mapping
+const (
+	// StatusPending marks a mapping recorded before its Jira issue is
+	// created. A pending mapping without JiraKey was left behind by an
+	// interrupted sync.
+	StatusPending = "pending"
+	// StatusSynced marks a mapping whose Jira issue reflects BodyHash
+	StatusSynced = "synced"
+)
+
+// Mapping links a logical GitHub issue to its Jira issue
+type Mapping struct {
+	// Key is the canonical identity of the issue, see package idmap
+	Key         string `json:"key"`
+	Namespace   string `json:"namespace"`
+	Repo        string `json:"repo"`
+	IssueNumber int    `json:"issue_number"`
+	IssueID     int64  `json:"issue_id"`
+	NodeID      string `json:"node_id"`
+	JiraKey     string `json:"jira_key"`
+	// JiraInstance names the Jira instance holding JiraKey; empty is the
+	// main instance
+	JiraInstance string `json:"jira_instance,omitempty"`
+	// SyncStatus is StatusPending or StatusSynced
+	SyncStatus string `json:"sync_status,omitempty"`
+	// BodyHash is the hash of the GitHub issue body last synced to Jira
+	BodyHash     string    `json:"body_hash,omitempty"`
+	LastSyncedAt time.Time `json:"last_synced_at"`
+	// StatusCommentID is the GitHub comment holding the sync status
+	StatusCommentID int64 `json:"status_comment_id,omitempty"`
+	// MergedInto is set when this mapping was merged into another one as
+	// a duplicate; lookups follow it to the surviving mapping
+	MergedInto string    `json:"merged_into,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// HistoryEntry is a recorded change of a mapping
+type HistoryEntry struct {
+	ID         int64     `json:"id"`
+	Key        string    `json:"key"`
+	JiraKey    string    `json:"jira_key"`
+	SyncStatus string    `json:"sync_status"`
+	BodyHash   string    `json:"body_hash"`
+	MergedInto string    `json:"merged_into,omitempty"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+// Snapshot records the input and output of a sync action, so that review
+// tools can audit exactly what was written to Jira for which GitHub content
+type Snapshot struct {
+	ID          int64  `json:"id"`
+	Key         string `json:"key"`
+	Repo        string `json:"repo"`
+	IssueNumber int    `json:"issue_number"`
+	JiraKey     string `json:"jira_key"`
+	// Action is the sync action, e.g. "create" or "update"
+	Action string `json:"action"`
+	// GitHubBody is the issue body the summary was generated from and
+	// GitHubUpdatedAt the version of the issue it was read at
+	GitHubBody      string    `json:"github_body"`
+	GitHubUpdatedAt time.Time `json:"github_updated_at"`
+	Summary         string    `json:"summary"`
+	// JiraFields is the payload sent to Jira
+	JiraFields map[string]interface{} `json:"jira_fields"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
+
+// Approval statuses
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+	// ApprovalDone marks an approved item whose Jira issue was created
+	ApprovalDone = "done"
+)
+
+// Approval is a Jira issue waiting for a human decision before it is
+// created. It holds the generated summary and payload so that exactly what
+// was reviewed is written to Jira.
+type Approval struct {
+	ID          int64                  `json:"id"`
+	Key         string                 `json:"key"`
+	Repo        string                 `json:"repo"`
+	IssueNumber int                    `json:"issue_number"`
+	Title       string                 `json:"title"`
+	Summary     string                 `json:"summary"`
+	JiraFields  map[string]interface{} `json:"jira_fields"`
+	Warnings    []string               `json:"warnings,omitempty"`
+	Status      string                 `json:"status"`
+	// DecidedBy and Reason describe the approval or rejection
+	DecidedBy string    `json:"decided_by,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	JiraKey   string    `json:"jira_key,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	DecidedAt time.Time `json:"decided_at"`
+}
+
+// Retry statuses
+const (
+	RetryPending = "pending"
+	// RetryFailed marks a retry that ran out of attempts; it is only
+	// retried again on request
+	RetryFailed = "failed"
+)
+
+// Retry is a Jira issue whose creation failed. It keeps the generated
+// summary and payload so that retries don't summarize the issue again.
+type Retry struct {
+	// Key is the mapping key of the GitHub issue
+	Key         string                 `json:"key"`
+	Repo        string                 `json:"repo"`
+	IssueNumber int                    `json:"issue_number"`
+	Title       string                 `json:"title"`
+	Summary     string                 `json:"summary"`
+	JiraFields  map[string]interface{} `json:"jira_fields"`
+	Warnings    []string               `json:"warnings,omitempty"`
+	Status      string                 `json:"status"`
+	// Attempts counts the failed creations and LastError is the latest error
+	Attempts      int       `json:"attempts"`
+	LastError     string    `json:"last_error"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Store is implemented by the state backends
+type Store interface {
+	// Get returns the mapping stored under key or ErrNotFound
+	Get(ctx context.Context, key string) (*Mapping, error)
+	// Put creates or replaces a mapping and records the change in its history
+	Put(ctx context.Context, m *Mapping) error
+	// Delete removes a mapping
+	Delete(ctx context.Context, key string) error
+	// List returns all mappings ordered by key
+	List(ctx context.Context) ([]*Mapping, error)
+	// History returns the recorded changes of a mapping key, or of all keys
+	// if key is empty, oldest first
+	History(ctx context.Context, key string) ([]*HistoryEntry, error)
+	// GetCursor returns the named progress marker, or "" if it was never set
+	GetCursor(ctx context.Context, name string) (string, error)
+	// SetCursor stores a named progress marker
+	SetCursor(ctx context.Context, name, value string) error
+	// ListCursors returns all progress markers by name
+	ListCursors(ctx context.Context) (map[string]string, error)
+	// AddSnapshot records a sync action and assigns its ID
+	AddSnapshot(ctx context.Context, snap *Snapshot) error
+	// GetSnapshot returns the snapshot with the given ID or ErrNotFound
+	GetSnapshot(ctx context.Context, id int64) (*Snapshot, error)
+	// ListSnapshots returns the snapshots of a mapping key, or of all keys if
+	// key is empty, oldest first
+	ListSnapshots(ctx context.Context, key string) ([]*Snapshot, error)
+	// PutApproval creates an approval, assigning its ID, or replaces the
+	// approval with the same ID
+	PutApproval(ctx context.Context, a *Approval) error
+	// GetApproval returns the approval with the given ID or ErrNotFound
+	GetApproval(ctx context.Context, id int64) (*Approval, error)
+	// ListApprovals returns all approvals, oldest first
+	ListApprovals(ctx context.Context) ([]*Approval, error)
+	// PutRetry creates or replaces the retry of a mapping key
+	PutRetry(ctx context.Context, r *Retry) error
+	// GetRetry returns the retry of a mapping key or ErrNotFound
+	GetRetry(ctx context.Context, key string) (*Retry, error)
+	// DeleteRetry removes the retry of a mapping key
+	DeleteRetry(ctx context.Context, key string) error
+	// ListRetries returns all retries ordered by key
+	ListRetries(ctx context.Context) ([]*Retry, error)
+	// Close releases resources held by the store
+	Close() error
+}
+
+// Locker is implemented by the backends that several processes can share.
+// It holds named leases, e.g. the leader election lock.
+type Locker interface {
+	// AcquireLease acquires the named lease for holder, or renews it if
+	// holder already has it, for ttl. It reports false if another holder
+	// has an unexpired lease.
+	AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+	// ReleaseLease gives up the named lease if holder has it
+	ReleaseLease(ctx context.Context, name, holder string) error
+}
+
+// Reporter is implemented by stores offering reporting views to BI tools
+type Reporter interface {
+	// CreateReports creates the reporting views and tables, or updates
+	// them to the current schema
+	CreateReports(ctx context.Context) error
+	// RecordHealth appends the current sync health to the health snapshots
+	RecordHealth(ctx context.Context) error
+}
+
+// Open creates the store for the given backend. dsn is backend specific;
+// for the file backend it is the path of the JSON state file, for the sqlite
+// backend the path of the database, for the postgres backend a connection
+// string and for the redis backend a redis:// URL.
+func Open(backend, dsn string) (Store, error) {
+	log.Printf("Opening %s state store", backend)
+	switch backend {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	case "file":
+		if dsn == "" {
+			return nil, fmt.Errorf("file state backend requires a path")
+		}
+		return OpenFileStore(dsn)
+	case "sqlite":
+		if dsn == "" {
+			return nil, fmt.Errorf("sqlite state backend requires a database path")
+		}
+		return OpenSQLiteStore(dsn)
+	case "postgres":
+		if dsn == "" {
+			return nil, fmt.Errorf("postgres state backend requires a connection string")
+		}
+		return OpenPostgresStore(dsn)
+	case "redis":
+		if dsn == "" {
+			return nil, fmt.Errorf("redis state backend requires a URL")
+		}
+		return OpenRedisStore(dsn)
+	default:
+		return nil, fmt.Errorf("unknown state backend %q", backend)
+	}
+}
+
+// Resolve returns the mapping for key, following MergedInto links to the
+// surviving mapping
+func Resolve(ctx context.Context, s Store, key string) (*Mapping, error) {
+	seen := make(map[string]bool)
+	for {
+		m, err := s.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if m.MergedInto == "" {
+			return m, nil
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("merge cycle detected at %s", key)
+		}
+		seen[key] = true
+		key = m.MergedInto
+	}
+}
+
+// PreviousSnapshot returns the snapshot recorded for the same key before
+// snap, or nil if snap is the first one
+func PreviousSnapshot(ctx context.Context, s Store, snap *Snapshot) (*Snapshot, error) {
+	snaps, err := s.ListSnapshots(ctx, snap.Key)
+	if err != nil {
+		return nil, err
+	}
+	var prev *Snapshot
+	for _, sn := range snaps {
+		if sn.ID >= snap.ID {
+			break
+		}
+		prev = sn
+	}
+	return prev, nil
+}
+
+// historyEntry returns the history record of a change to m
+func historyEntry(m *Mapping) *HistoryEntry {
+	return &HistoryEntry{
+		Key:        m.Key,
+		JiraKey:    m.JiraKey,
+		SyncStatus: m.SyncStatus,
+		BodyHash:   m.BodyHash,
+		MergedInto: m.MergedInto,
+		ChangedAt:  time.Now().UTC(),
+	}
+}
+
+func sortMappings(ms []*Mapping) {
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Key < ms[j].Key })
+}
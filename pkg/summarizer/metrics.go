@@ -0,0 +1,116 @@
+package summarizer
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// ModelMetrics are the statistics of the requests to a model since the
+// summarizer was created. Embeddings count as generations without tokens.
+type ModelMetrics struct {
+	Model string `json:"model"`
+	// Generations counts the finished generations, Failures those that
+	// failed
+	Generations int64 `json:"generations"`
+	Failures    int64 `json:"failures"`
+	// GenerationSeconds is the total duration of the generations, from the
+	// request to the last token
+	GenerationSeconds float64 `json:"generation_seconds"`
+	// QueueWaitSeconds is the total time generations waited for the model
+	QueueWaitSeconds float64 `json:"queue_wait_seconds"`
+	// PromptTokens and Tokens count the tokens read and generated, and
+	// EvalSeconds is the time Ollama spent generating Tokens
+	PromptTokens int64   `json:"prompt_tokens"`
+	Tokens       int64   `json:"tokens"`
+	EvalSeconds  float64 `json:"eval_seconds"`
+	// TokensPerSecond is the generation throughput of the model
+	TokensPerSecond float64 `json:"tokens_per_second"`
+	// Running and Waiting are the generations in progress and waiting for
+	// the model now
+	Running int `json:"running"`
+	Waiting int `json:"waiting"`
+}
+
+// metrics collects the ModelMetrics of each model
+type metrics struct {
+	mu      sync.Mutex
+	byModel map[string]*ModelMetrics
+}
+
+// model returns the metrics of model, creating them. m.mu must be held.
+func (m *metrics) model(model string) *ModelMetrics {
+	mm, ok := m.byModel[model]
+	if !ok {
+		if m.byModel == nil {
+			m.byModel = make(map[string]*ModelMetrics)
+		}
+		mm = &ModelMetrics{Model: model}
+		m.byModel[model] = mm
+	}
+	return mm
+}
+
+// started records the start of a generation that waited for its model
+func (m *metrics) started(model string, wait time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mm := m.model(model)
+	mm.Running++
+	mm.QueueWaitSeconds += wait.Seconds()
+}
+
+// finished records the end of a generation
+func (m *metrics) finished(model string, took time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mm := m.model(model)
+	mm.Running--
+	mm.Generations++
+	mm.GenerationSeconds += took.Seconds()
+	if err != nil {
+		mm.Failures++
+	}
+}
+
+// observeEval records the token counts Ollama reports with the last chunk
+// of a generation
+func (m *metrics) observeEval(model string, em api.Metrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mm := m.model(model)
+	mm.PromptTokens += int64(em.PromptEvalCount)
+	mm.Tokens += int64(em.EvalCount)
+	mm.EvalSeconds += em.EvalDuration.Seconds()
+}
+
+// snapshot returns a copy of the metrics of each model, by model name
+func (m *metrics) snapshot() []ModelMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]ModelMetrics, 0, len(m.byModel))
+	for _, mm := range m.byModel {
+		c := *mm
+		if c.EvalSeconds > 0 {
+			c.TokensPerSecond = float64(c.Tokens) / c.EvalSeconds
+		}
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Model < out[j].Model })
+	return out
+}
+
+// Metrics returns the statistics of each model used so far, by model name
+func (s *Summarizer) Metrics() []ModelMetrics {
+	out := s.queues.stats.snapshot()
+	for i := range out {
+		if q := s.queues.queue(out[i].Model); q != nil {
+			q.mu.Lock()
+			out[i].Waiting = q.waitingLocked()
+			q.mu.Unlock()
+		}
+	}
+	return out
+}
@@ -0,0 +1,87 @@
+package summarizer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// pullModels pulls the configured models that are missing on the Ollama
+// host, logging the download progress
+func (s *Summarizer) pullModels(ctx context.Context) error {
+	missing, err := s.MissingModels(ctx)
+	if err != nil {
+		return err
+	}
+	for _, model := range missing {
+		log.Printf("Model %s is not available on the Ollama host, pulling it", model)
+		if err := s.pull(ctx, model); err != nil {
+			return fmt.Errorf("failed to pull model %s: %w", model, err)
+		}
+		log.Printf("Pulled model %s", model)
+	}
+	return nil
+}
+
+// MissingModels returns the configured models, fallbacks and embedding
+// model that are not available on the Ollama host
+func (s *Summarizer) MissingModels(ctx context.Context) ([]string, error) {
+	list, err := s.client.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Ollama models: %w", err)
+	}
+	present := make(map[string]bool, len(list.Models))
+	for _, m := range list.Models {
+		present[modelTag(m.Name)] = true
+		present[modelTag(m.Model)] = true
+	}
+
+	models := s.models()
+	if s.config.EmbeddingModel != "" {
+		models = append(models, s.config.EmbeddingModel)
+	}
+	var missing []string
+	for _, model := range models {
+		if !present[modelTag(model)] {
+			missing = append(missing, model)
+			present[modelTag(model)] = true
+		}
+	}
+	return missing, nil
+}
+
+// pull downloads a model, logging each status and every 10% of each layer
+func (s *Summarizer) pull(ctx context.Context, model string) error {
+	var status string
+	var digest string
+	lastPercent := -1
+	return s.client.Pull(ctx, &api.PullRequest{Model: model}, func(p api.ProgressResponse) error {
+		if p.Digest != digest {
+			digest, lastPercent = p.Digest, -1
+		}
+		if p.Total > 0 {
+			percent := int(p.Completed * 100 / p.Total)
+			if percent/10 != lastPercent/10 {
+				lastPercent = percent
+				log.Printf("Pulling %s: %s %d%%", model, p.Status, percent)
+			}
+			return nil
+		}
+		if p.Status != status {
+			status = p.Status
+			log.Printf("Pulling %s: %s", model, status)
+		}
+		return nil
+	})
+}
+
+// modelTag adds the default tag to a model name without one
+func modelTag(name string) string {
+	if name == "" || strings.Contains(name, ":") {
+		return name
+	}
+	return name + ":latest"
+}
@@ -0,0 +1,176 @@
+package summarizer
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Priority orders the generations waiting for a model. Lower values go
+// first.
+type Priority int
+
+const (
+	// PriorityRealtime is the priority of newly opened issues, and of any
+	// generation without a priority
+	PriorityRealtime Priority = iota
+	// PriorityBackground is the priority of backfills and other bulk work,
+	// which only gets a model when no realtime generation is waiting
+	PriorityBackground
+	numPriorities
+)
+
+// String returns the name of p for logs
+func (p Priority) String() string {
+	if p == PriorityBackground {
+		return "background"
+	}
+	return "realtime"
+}
+
+type priorityKey struct{}
+
+// WithPriority returns a context whose generations wait for a model with
+// priority p
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFrom returns the priority of the generations of ctx
+func PriorityFrom(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok && p >= 0 && p < numPriorities {
+		return p
+	}
+	return PriorityRealtime
+}
+
+// modelQueue limits the concurrent generations of a model. Generations over
+// the limit wait in one queue per priority, and a freed slot goes to the
+// oldest waiter of the highest priority.
+type modelQueue struct {
+	mu      sync.Mutex
+	limit   int
+	running int
+	waiting [numPriorities][]chan struct{}
+}
+
+// acquire waits for a slot, or until ctx is done
+func (q *modelQueue) acquire(ctx context.Context, model string) error {
+	p := PriorityFrom(ctx)
+	q.mu.Lock()
+	if q.running < q.limit {
+		q.running++
+		q.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	q.waiting[p] = append(q.waiting[p], ready)
+	log.Printf("Waiting for model %s with %s priority: %d generations running, %d waiting", model, p, q.running, q.waitingLocked())
+	q.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		for i, c := range q.waiting[p] {
+			if c == ready {
+				q.waiting[p] = append(q.waiting[p][:i], q.waiting[p][i+1:]...)
+				return ctx.Err()
+			}
+		}
+		// The slot was handed over while ctx was done; pass it on
+		q.releaseLocked()
+		return ctx.Err()
+	}
+}
+
+// release frees the slot of a finished generation
+func (q *modelQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.releaseLocked()
+}
+
+// releaseLocked hands the slot over to the next waiter, if any
+func (q *modelQueue) releaseLocked() {
+	for p := range q.waiting {
+		if len(q.waiting[p]) > 0 {
+			next := q.waiting[p][0]
+			q.waiting[p] = q.waiting[p][1:]
+			close(next)
+			return
+		}
+	}
+	q.running--
+}
+
+// waitingLocked returns the number of waiting generations
+func (q *modelQueue) waitingLocked() int {
+	n := 0
+	for _, w := range q.waiting {
+		n += len(w)
+	}
+	return n
+}
+
+// queues holds the queue of each model with a concurrency limit and the
+// metrics of all models. It is shared by the copies of a Summarizer.
+type queues struct {
+	mu      sync.Mutex
+	limits  map[string]int
+	def     int
+	timeout time.Duration
+	models  map[string]*modelQueue
+	stats   metrics
+}
+
+// newQueues limits each model to def concurrent generations, or to its
+// limit in limits; a limit of 0 or less is unlimited. Generations are
+// limited to timeout once started.
+func newQueues(def int, limits map[string]int, timeout time.Duration) *queues {
+	return &queues{limits: limits, def: def, timeout: timeout, models: make(map[string]*modelQueue)}
+}
+
+// run calls fn once a generation with model may start, with a context
+// limited to the generation timeout, and records its metrics
+func (qs *queues) run(ctx context.Context, model string, fn func(ctx context.Context) (string, error)) (string, error) {
+	queued := time.Now()
+	if q := qs.queue(model); q != nil {
+		if err := q.acquire(ctx, model); err != nil {
+			return "", err
+		}
+		defer q.release()
+	}
+	if qs.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, qs.timeout)
+		defer cancel()
+	}
+	started := time.Now()
+	qs.stats.started(model, started.Sub(queued))
+	out, err := fn(ctx)
+	qs.stats.finished(model, time.Since(started), err)
+	return out, err
+}
+
+// queue returns the queue of model, or nil if it is unlimited
+func (qs *queues) queue(model string) *modelQueue {
+	limit, ok := qs.limits[model]
+	if !ok {
+		limit = qs.def
+	}
+	if limit <= 0 {
+		return nil
+	}
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	q, ok := qs.models[model]
+	if !ok {
+		q = &modelQueue{limit: limit}
+		qs.models[model] = q
+	}
+	return q
+}
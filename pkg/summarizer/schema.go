@@ -0,0 +1,128 @@
+package summarizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Schema describes the JSON a model must answer with. It is a subset of JSON
+// Schema: types, object properties, required properties, array items, enums
+// and numeric bounds.
+type Schema struct {
+	// Type is object, array, string, number, integer or boolean
+	Type        string             `json:"type"`
+	Description string             `json:"description,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Enum        []interface{}      `json:"enum,omitempty"`
+	Minimum     *float64           `json:"minimum,omitempty"`
+	Maximum     *float64           `json:"maximum,omitempty"`
+	MinItems    int                `json:"minItems,omitempty"`
+	MaxItems    int                `json:"maxItems,omitempty"`
+}
+
+// Validate checks a decoded JSON value against the schema
+func (s *Schema) Validate(v interface{}) error {
+	return s.validate(v, "$")
+}
+
+func (s *Schema) validate(v interface{}, path string) error {
+	if s == nil {
+		return nil
+	}
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s must be an object", path)
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s.%s is required", path, name)
+			}
+		}
+		names := make([]string, 0, len(s.Properties))
+		for name := range s.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if pv, ok := obj[name]; ok {
+				if err := s.Properties[name].validate(pv, path+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	case "array":
+		arr, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s must be an array", path)
+		}
+		if len(arr) < s.MinItems {
+			return fmt.Errorf("%s must have at least %d items", path, s.MinItems)
+		}
+		if s.MaxItems > 0 && len(arr) > s.MaxItems {
+			return fmt.Errorf("%s must have at most %d items", path, s.MaxItems)
+		}
+		for i, item := range arr {
+			if err := s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		if _, ok := v.(string); !ok {
+			return fmt.Errorf("%s must be a string", path)
+		}
+	case "number", "integer":
+		n, ok := v.(float64)
+		if !ok {
+			return fmt.Errorf("%s must be a number", path)
+		}
+		if s.Type == "integer" && n != math.Trunc(n) {
+			return fmt.Errorf("%s must be an integer", path)
+		}
+		if s.Minimum != nil && n < *s.Minimum {
+			return fmt.Errorf("%s must be at least %g", path, *s.Minimum)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			return fmt.Errorf("%s must be at most %g", path, *s.Maximum)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s must be a boolean", path)
+		}
+	case "":
+	default:
+		return fmt.Errorf("%s has unsupported schema type %q", path, s.Type)
+	}
+	if len(s.Enum) > 0 && !inEnum(s.Enum, v) {
+		data, _ := json.Marshal(s.Enum)
+		return fmt.Errorf("%s must be one of %s", path, data)
+	}
+	return nil
+}
+
+// inEnum reports whether v equals one of the enum values, comparing numbers
+// by value
+func inEnum(enum []interface{}, v interface{}) bool {
+	for _, e := range enum {
+		switch ev := e.(type) {
+		case int:
+			if n, ok := v.(float64); ok && n == float64(ev) {
+				return true
+			}
+		case float64:
+			if n, ok := v.(float64); ok && n == ev {
+				return true
+			}
+		default:
+			if e == v {
+				return true
+			}
+		}
+	}
+	return false
+}
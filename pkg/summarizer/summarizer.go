@@ -4,23 +4,68 @@ package summarizer
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"strings"
+	"time"
 
-	"github.com/jmorganca/ollama/api"
+	"github.com/ollama/ollama/api"
 )
 
 // Config holds the configuration for the summarizer
 type Config struct {
-	Model     string
+	Model string
+	// Fallbacks are the models tried in order when generating with Model,
+	// or the previous fallback, fails
+	Fallbacks []string
 	OllamaURL string
+	// EmbeddingModel computes embeddings; defaults to Model
+	EmbeddingModel string
+	// AutoPull makes New pull the models that are missing on the Ollama
+	// host instead of failing at the first generation
+	AutoPull bool
+	// MaxLength limits summaries to this many characters; longer ones are
+	// cut at a word boundary and end with TruncationMarker. 0 is unlimited.
+	MaxLength int
+	// MaxTokens stops the generation of summaries after this many tokens;
+	// 0 is unlimited
+	MaxTokens int
+	// Language is the language summaries are written in, such as Japanese;
+	// empty leaves it to the model
+	Language string
+	// Concurrency limits the generations running at once on each model;
+	// further ones wait by priority, see WithPriority. 0 is unlimited.
+	Concurrency int
+	// ModelConcurrency overrides Concurrency by model name
+	ModelConcurrency map[string]int
+	// Timeout limits each generation with a model, not counting the wait
+	// for the model; 0 is unlimited
+	Timeout time.Duration
+}
+
+// LanguagePlaceholder in a prompt template is replaced with the configured
+// language. Summary prompts without it get an instruction appended.
+const LanguagePlaceholder = "{{language}}"
+
+// TruncationMarker ends summaries cut to Config.MaxLength
+const TruncationMarker = " […]"
+
+// ollamaClient is the part of the Ollama API client the summarizer uses
+type ollamaClient interface {
+	Generate(ctx context.Context, req *api.GenerateRequest, fn api.GenerateResponseFunc) error
+	Embed(ctx context.Context, req *api.EmbedRequest) (*api.EmbedResponse, error)
+	List(ctx context.Context) (*api.ListResponse, error)
+	Pull(ctx context.Context, req *api.PullRequest, fn api.PullProgressFunc) error
 }
 
 // Summarizer provides methods to generate summaries using Ollama
 type Summarizer struct {
-	client *api.Client
+	client ollamaClient
 	config Config
+	queues *queues
 }
 
 // New creates a new instance of Summarizer with the given configuration
@@ -30,6 +75,9 @@ func New(config Config) (*Summarizer, error) {
 		config.Model = "mistral" // Default to mistral model
 		log.Printf("No model specified, using default model: %s", config.Model)
 	}
+	if len(config.Fallbacks) > 0 {
+		log.Printf("Falling back to models: %s", strings.Join(config.Fallbacks, ", "))
+	}
 
 	log.Printf("Initializing Ollama client")
 	client, err := api.ClientFromEnvironment()
@@ -39,10 +87,67 @@ func New(config Config) (*Summarizer, error) {
 	}
 	log.Printf("Ollama client initialized successfully")
 
-	return &Summarizer{
+	s := &Summarizer{
 		client: client,
 		config: config,
-	}, nil
+		queues: newQueues(config.Concurrency, config.ModelConcurrency, config.Timeout),
+	}
+	if config.AutoPull {
+		if err := s.pullModels(context.Background()); err != nil {
+			log.Printf("Failed to pull models: %v", err)
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// WithLanguage returns a summarizer writing summaries in language, sharing
+// the Ollama client and the model queues of s. An empty language returns s.
+func (s *Summarizer) WithLanguage(language string) *Summarizer {
+	if language == "" || language == s.config.Language {
+		return s
+	}
+	c := *s
+	c.config.Language = language
+	return &c
+}
+
+// models returns the models to try, in order
+func (s *Summarizer) models() []string {
+	models := []string{s.config.Model}
+	for _, m := range s.config.Fallbacks {
+		if m != "" && m != s.config.Model {
+			models = append(models, m)
+		}
+	}
+	return models
+}
+
+// withFallback calls gen with each model in turn until one succeeds, once
+// the model is free. It stops early when ctx is done, as the next model would
+// fail the same way, or gen returns a *finalError.
+func (s *Summarizer) withFallback(ctx context.Context, gen func(ctx context.Context, model string) (string, error)) (string, error) {
+	var errs []error
+	for i, model := range s.models() {
+		out, err := s.queues.run(ctx, model, func(ctx context.Context) (string, error) { return gen(ctx, model) })
+		if err == nil && strings.TrimSpace(out) == "" {
+			err = fmt.Errorf("empty response")
+		}
+		if err == nil {
+			log.Printf("Generated response with model: %s", model)
+			return out, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", model, err))
+		var final *finalError
+		// A timed out model is not retried with the next one either
+		if ctx.Err() != nil || errors.Is(err, context.DeadlineExceeded) || errors.As(err, &final) {
+			break
+		}
+		if i < len(s.models())-1 {
+			log.Printf("Model %s failed, falling back to the next model: %v", model, err)
+		}
+	}
+	return "", errors.Join(errs...)
 }
 
 // SummarizeChanges generates a summary of the provided changes
@@ -60,64 +165,17 @@ Please format the response as follows:
 `, changes)
 
 	log.Printf("Created prompt for summarization")
-	request := &api.GenerateRequest{
-		Model:  s.config.Model,
-		Prompt: prompt,
-	}
-
-	var fullResponse strings.Builder
-	stream := make(chan api.GenerateResponse)
-	errChan := make(chan error, 1)
-
-	log.Printf("Starting generation goroutine")
-	go func() {
-		defer close(stream)
-		if err := s.client.Generate(ctx, request, func(response api.GenerateResponse) error {
-			select {
-			case stream <- response:
-				log.Printf("Generated content: %s", response.Response)
-				return nil
-			case <-ctx.Done():
-				log.Printf("Context cancelled during generation")
-				return ctx.Err()
-			}
-		}); err != nil {
-			log.Printf("Error during generation: %v", err)
-			errChan <- err
-		}
-		close(errChan)
-		log.Printf("Generation goroutine completed")
-	}()
-
-	log.Printf("Collecting responses from stream")
-	for {
-		select {
-		case err := <-errChan:
-			if err != nil {
-				log.Printf("Error received from error channel: %v", err)
-				return "", fmt.Errorf("failed to generate summary: %w", err)
-			}
-		case response, ok := <-stream:
-			if !ok {
-				log.Printf("Summary generation complete. Final length: %d characters", fullResponse.Len())
-				return fullResponse.String(), nil
-			}
-			log.Printf("Appending response chunk to full response")
-			fullResponse.WriteString(response.Response)
-		case <-ctx.Done():
-			log.Printf("Context deadline exceeded or cancelled")
-			return "", ctx.Err()
-		}
-	}
+	return s.stream(ctx, prompt, nil, true)
 }
 
 // SummarizeWithCustomPrompt generates a summary using a custom prompt template
 func (s *Summarizer) SummarizeWithCustomPrompt(ctx context.Context, content, promptTemplate string) (string, error) {
 	log.Printf("Starting custom prompt summarization with model: %s", s.config.Model)
-	// If no custom prompt is provided, use a default one for GitHub to Jira conversion
-	if promptTemplate == "" {
-		log.Printf("No custom prompt provided, using default prompt")
-		promptTemplate = `Please analyze this GitHub issue description and create a clear, structured summary for Jira:
+	return s.SummarizeStream(ctx, content, promptTemplate, nil)
+}
+
+// defaultPrompt is used when no custom prompt is provided
+const defaultPrompt = `Please analyze this GitHub issue description and create a clear, structured summary for Jira:
 
 %s
 
@@ -127,56 +185,308 @@ Please format the response as follows:
 3. Technical Requirements (if any)
 4. Dependencies and Impact (if mentioned)
 `
+
+// SummarizeStream generates a summary like SummarizeWithCustomPrompt and
+// passes each chunk of the response to fn as it arrives, so that progress
+// can be shown while the model is working. An error from fn stops the
+// generation. Fallback models are only tried until the first chunk was
+// passed on.
+func (s *Summarizer) SummarizeStream(ctx context.Context, content, promptTemplate string, fn func(chunk string) error) (string, error) {
+	// If no custom prompt is provided, use a default one for GitHub to Jira conversion
+	if promptTemplate == "" {
+		log.Printf("No custom prompt provided, using default prompt")
+		promptTemplate = defaultPrompt
 	}
+	return s.stream(ctx, fmt.Sprintf(promptTemplate, content), fn, true)
+}
 
+// stream generates the response to prompt with fallback models, passing it
+// to fn as it arrives. Summaries are held to the configured length budget:
+// the model is asked to respect it and the result is truncated, while fn
+// may see more than the returned summary.
+func (s *Summarizer) stream(ctx context.Context, prompt string, fn func(chunk string) error, summary bool) (string, error) {
+	var options map[string]interface{}
+	if summary {
+		switch {
+		case strings.Contains(prompt, LanguagePlaceholder):
+			language := s.config.Language
+			if language == "" {
+				language = "the language of the input"
+			}
+			prompt = strings.ReplaceAll(prompt, LanguagePlaceholder, language)
+		case s.config.Language != "":
+			prompt += fmt.Sprintf("\n\nWrite the response in %s.", s.config.Language)
+		}
+		if s.config.MaxLength > 0 {
+			prompt += fmt.Sprintf("\n\nKeep the response under %d characters.", s.config.MaxLength)
+		}
+		if s.config.MaxTokens > 0 {
+			options = map[string]interface{}{"num_predict": s.config.MaxTokens}
+		}
+	}
 	log.Printf("Creating generation request")
-	request := &api.GenerateRequest{
-		Model:  s.config.Model,
-		Prompt: fmt.Sprintf(promptTemplate, content),
+	var onChunk func(string) error
+	streamed := false
+	if fn != nil {
+		onChunk = func(chunk string) error {
+			streamed = true
+			return fn(chunk)
+		}
+	}
+	out, err := s.withFallback(ctx, func(ctx context.Context, model string) (string, error) {
+		out, err := s.generate(ctx, &api.GenerateRequest{
+			Model:   model,
+			Prompt:  prompt,
+			Options: options,
+		}, onChunk)
+		if err != nil && streamed {
+			// The consumer already has part of this response
+			return out, &finalError{err: err}
+		}
+		return out, err
+	})
+	if err != nil || !summary {
+		return out, err
+	}
+	return Truncate(out, s.config.MaxLength), nil
+}
+
+// Truncate cuts text to at most max characters, ending it with
+// TruncationMarker at a word boundary. A max of 0 or less leaves text alone.
+func Truncate(text string, max int) string {
+	r := []rune(text)
+	if max <= 0 || len(r) <= max {
+		return text
+	}
+	marker := []rune(TruncationMarker)
+	if max <= len(marker) {
+		return string(r[:max])
 	}
+	cut := string(r[:max-len(marker)])
+	if i := strings.LastIndexAny(cut, " \n\t"); i > len(cut)/2 {
+		cut = cut[:i]
+	}
+	log.Printf("Truncated summary of %d characters to %d", len(r), max)
+	return strings.TrimRight(cut, " \n\t") + TruncationMarker
+}
+
+// finalError stops withFallback from trying the next model
+type finalError struct {
+	err error
+}
+
+func (e *finalError) Error() string { return e.err.Error() }
+func (e *finalError) Unwrap() error { return e.err }
 
+// generate streams the response to request and returns it once complete.
+// onChunk, if not nil, is called with each chunk. The chunks are collected
+// in the callback of the Ollama client, so the generation ends with the
+// call: an error of the client, of onChunk or of ctx is returned with the
+// response received so far, and nothing keeps running after a return.
+func (s *Summarizer) generate(ctx context.Context, request *api.GenerateRequest, onChunk func(string) error) (string, error) {
 	var fullResponse strings.Builder
-	stream := make(chan api.GenerateResponse)
-	errChan := make(chan error, 1)
-
-	log.Printf("Starting generation goroutine")
-	go func() {
-		defer close(stream)
-		if err := s.client.Generate(ctx, request, func(response api.GenerateResponse) error {
-			select {
-			case stream <- response:
-				log.Printf("Generated content: %s", response.Response)
-				return nil
-			case <-ctx.Done():
-				log.Printf("Context cancelled during generation")
-				return ctx.Err()
-			}
-		}); err != nil {
-			log.Printf("Error during generation: %v", err)
-			errChan <- err
-		}
-		close(errChan)
-		log.Printf("Generation goroutine completed")
-	}()
-
-	log.Printf("Collecting responses from stream")
-	for {
-		select {
-		case err := <-errChan:
-			if err != nil {
-				log.Printf("Error received from error channel: %v", err)
-				return "", fmt.Errorf("failed to generate summary: %w", err)
-			}
-		case response, ok := <-stream:
-			if !ok {
-				log.Printf("Summary generation complete. Final length: %d characters", fullResponse.Len())
-				return fullResponse.String(), nil
+	// chunkErr is the error of onChunk, returned as is
+	var chunkErr error
+	err := s.client.Generate(ctx, request, func(response api.GenerateResponse) error {
+		// A client that keeps calling back after ctx is done is stopped
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fullResponse.WriteString(response.Response)
+		if response.Done {
+			s.queues.stats.observeEval(request.Model, response.Metrics)
+		}
+		if onChunk != nil && response.Response != "" {
+			if chunkErr = onChunk(response.Response); chunkErr != nil {
+				return chunkErr
 			}
-			log.Printf("Appending response chunk to full response")
-			fullResponse.WriteString(response.Response)
-		case <-ctx.Done():
-			log.Printf("Context deadline exceeded or cancelled")
-			return "", ctx.Err()
 		}
+		return nil
+	})
+	switch {
+	case chunkErr != nil:
+		return fullResponse.String(), chunkErr
+	case err != nil:
+		log.Printf("Error during generation after %d characters: %v", fullResponse.Len(), err)
+		return fullResponse.String(), fmt.Errorf("failed to generate summary: %w", err)
+	}
+	log.Printf("Summary generation complete. Final length: %d characters", fullResponse.Len())
+	return fullResponse.String(), nil
+}
+
+// discussionPrompt asks for the state of a discussion rather than its history
+const discussionPrompt = `Please read this GitHub issue and its comment thread. Each comment starts with its author and date:
+
+%s
+
+Please summarize where the discussion stands, formatted as follows:
+1. Current State (1-3 sentences)
+2. Decisions So Far (bullet points)
+3. Open Questions (bullet points, if any)
+`
+
+// SummarizeDiscussion summarizes the current state of and the decisions
+// made in the comment thread of an issue
+func (s *Summarizer) SummarizeDiscussion(ctx context.Context, thread string) (string, error) {
+	log.Printf("Summarizing discussion with model: %s", s.config.Model)
+	return s.SummarizeWithCustomPrompt(ctx, thread, discussionPrompt)
+}
+
+// maxStructuredAttempts limits the generations of SummarizeStructured when
+// the model answers with invalid JSON
+const maxStructuredAttempts = 3
+
+// SummarizeStructured asks the model to answer content, a prompt, with JSON
+// matching schema and decodes the answer into out. Answers that aren't
+// valid JSON or don't match the schema are asked for again, quoting the
+// problem, up to three times.
+func (s *Summarizer) SummarizeStructured(ctx context.Context, content string, schema *Schema, out interface{}) error {
+	log.Printf("Starting structured generation with model: %s", s.config.Model)
+	schemaJSON, err := json.Marshal(schema)
+	if err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+	prompt := fmt.Sprintf("%s\n\nRespond with a JSON value matching this JSON schema, and nothing else:\n%s\n", content, schemaJSON)
+
+	var lastErr error
+	for attempt := 1; attempt <= maxStructuredAttempts; attempt++ {
+		p := prompt
+		if lastErr != nil {
+			p += fmt.Sprintf("\nYour previous answer was rejected: %v. Answer again with valid JSON.\n", lastErr)
+		}
+		answer, err := s.generateJSON(ctx, p)
+		if err != nil {
+			return fmt.Errorf("failed to generate structured output: %w", err)
+		}
+		var v interface{}
+		if err := json.Unmarshal([]byte(answer), &v); err != nil {
+			lastErr = fmt.Errorf("invalid JSON: %w", err)
+		} else if err := schema.Validate(v); err != nil {
+			lastErr = err
+		} else if err := json.Unmarshal([]byte(answer), out); err != nil {
+			lastErr = err
+		} else {
+			return nil
+		}
+		log.Printf("Model answer %d/%d does not match the schema: %v", attempt, maxStructuredAttempts, lastErr)
+	}
+	return fmt.Errorf("model returned no valid answer in %d attempts: %w", maxStructuredAttempts, lastErr)
+}
+
+// generateJSON generates a complete answer to prompt in JSON mode
+func (s *Summarizer) generateJSON(ctx context.Context, prompt string) (string, error) {
+	return s.withFallback(ctx, func(ctx context.Context, model string) (string, error) {
+		stream := false
+		request := &api.GenerateRequest{
+			Model:  model,
+			Prompt: prompt,
+			Format: json.RawMessage(`"json"`),
+			Stream: &stream,
+		}
+		var response strings.Builder
+		err := s.client.Generate(ctx, request, func(r api.GenerateResponse) error {
+			response.WriteString(r.Response)
+			if r.Done {
+				s.queues.stats.observeEval(model, r.Metrics)
+			}
+			return nil
+		})
+		return response.String(), err
+	})
+}
+
+// enrichmentPrompt asks for acceptance criteria and an estimate
+const enrichmentPrompt = `Please read this GitHub issue and propose acceptance criteria and a story-point estimate for the work it describes:
+
+%s
+
+Write 2 to 6 testable acceptance criteria.`
+
+// enrichmentSchema is the JSON an Enrichment is decoded from
+var enrichmentSchema = &Schema{
+	Type:     "object",
+	Required: []string{"acceptance_criteria", "story_points"},
+	Properties: map[string]*Schema{
+		"acceptance_criteria": {Type: "array", Items: &Schema{Type: "string"}, MinItems: 1},
+		"story_points":        {Type: "number", Enum: []interface{}{1, 2, 3, 5, 8, 13, 21}},
+	},
+}
+
+// Enrichment is proposed planning data for an issue
+type Enrichment struct {
+	AcceptanceCriteria []string `json:"acceptance_criteria"`
+	StoryPoints        float64  `json:"story_points"`
+}
+
+// Enrich proposes acceptance criteria and a story-point estimate for an
+// issue
+func (s *Summarizer) Enrich(ctx context.Context, content string) (*Enrichment, error) {
+	log.Printf("Generating acceptance criteria and estimate with model: %s", s.config.Model)
+	var e Enrichment
+	if err := s.SummarizeStructured(ctx, fmt.Sprintf(enrichmentPrompt, content), enrichmentSchema, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Embed returns the embedding of text
+func (s *Summarizer) Embed(ctx context.Context, text string) ([]float64, error) {
+	model := s.config.EmbeddingModel
+	if model == "" {
+		model = s.config.Model
+	}
+	var resp *api.EmbedResponse
+	_, err := s.queues.run(ctx, model, func(ctx context.Context) (string, error) {
+		var err error
+		resp, err = s.client.Embed(ctx, &api.EmbedRequest{Model: model, Input: text})
+		return "", err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute embedding: %w", err)
+	}
+	if len(resp.Embeddings) == 0 || len(resp.Embeddings[0]) == 0 {
+		return nil, fmt.Errorf("model %s returned an empty embedding", model)
 	}
+	embedding := make([]float64, len(resp.Embeddings[0]))
+	for i, v := range resp.Embeddings[0] {
+		embedding[i] = float64(v)
+	}
+	return embedding, nil
+}
+
+// Similarity returns the cosine similarity of two embeddings, or 0 if their
+// dimensions differ
+func Similarity(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// releaseNotesPrompt asks for release notes grouped by the kind of change
+const releaseNotesPrompt = `Please write release notes in Markdown for the following merged pull requests. Each pull request starts with its number and title, followed by its labels and description:
+
+%s
+
+Please format the response as follows:
+1. A one paragraph highlight of the most important changes
+2. The changes grouped under the headings "Features", "Bug Fixes", "Documentation" and "Other Changes", omitting empty groups
+3. One bullet per pull request, ending with its number as (#123)
+`
+
+// GenerateReleaseNotes generates grouped release notes from a description
+// of the merged pull requests
+func (s *Summarizer) GenerateReleaseNotes(ctx context.Context, changes string) (string, error) {
+	log.Printf("Generating release notes with model: %s", s.config.Model)
+	// Release notes are not held to the summary length budget
+	return s.stream(ctx, fmt.Sprintf(releaseNotesPrompt, changes), nil, false)
 }
@@ -0,0 +1,243 @@
+package summarizer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// fakeOllama streams the chunks of the model of each request, then fails
+// with its error or, if block is set, waits for the context to be done
+type fakeOllama struct {
+	chunks map[string][]string
+	err    map[string]error
+	block  map[string]bool
+	// ignoreCancel keeps streaming after the context is done, like a client
+	// that only checks it between requests
+	ignoreCancel bool
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func (f *fakeOllama) Generate(ctx context.Context, req *api.GenerateRequest, fn api.GenerateResponseFunc) error {
+	f.mu.Lock()
+	f.calls = append(f.calls, req.Model)
+	f.mu.Unlock()
+	for _, c := range f.chunks[req.Model] {
+		if !f.ignoreCancel && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := fn(api.GenerateResponse{Model: req.Model, Response: c}); err != nil {
+			return err
+		}
+	}
+	if err := f.err[req.Model]; err != nil {
+		return err
+	}
+	if f.block[req.Model] {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return fn(api.GenerateResponse{Model: req.Model, Done: true, Metrics: api.Metrics{EvalCount: len(f.chunks[req.Model])}})
+}
+
+func (f *fakeOllama) Embed(ctx context.Context, req *api.EmbedRequest) (*api.EmbedResponse, error) {
+	return &api.EmbedResponse{Embeddings: [][]float32{{1}}}, nil
+}
+
+func (f *fakeOllama) List(ctx context.Context) (*api.ListResponse, error) {
+	return &api.ListResponse{}, nil
+}
+
+func (f *fakeOllama) Pull(ctx context.Context, req *api.PullRequest, fn api.PullProgressFunc) error {
+	return nil
+}
+
+func newTestSummarizer(client ollamaClient, config Config) *Summarizer {
+	return &Summarizer{
+		client: client,
+		config: config,
+		queues: newQueues(config.Concurrency, config.ModelConcurrency, config.Timeout),
+	}
+}
+
+func TestSummarizeStreamCompletes(t *testing.T) {
+	client := &fakeOllama{chunks: map[string][]string{"m": {"Crash ", "on ", "save"}}}
+	s := newTestSummarizer(client, Config{Model: "m"})
+
+	var chunks []string
+	out, err := s.SummarizeStream(context.Background(), "body", "%s", func(chunk string) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("SummarizeStream: %v", err)
+	}
+	if out != "Crash on save" {
+		t.Errorf("summary = %q, want %q", out, "Crash on save")
+	}
+	if got := strings.Join(chunks, "|"); got != "Crash |on |save" {
+		t.Errorf("chunks = %q", got)
+	}
+	m := s.Metrics()
+	if len(m) != 1 || m[0].Generations != 1 || m[0].Failures != 0 || m[0].Tokens != 3 || m[0].Running != 0 {
+		t.Errorf("metrics = %+v", m)
+	}
+}
+
+func TestGenerateMidStreamError(t *testing.T) {
+	boom := errors.New("connection reset")
+	client := &fakeOllama{
+		chunks: map[string][]string{"m": {"partial"}},
+		err:    map[string]error{"m": boom},
+	}
+	s := newTestSummarizer(client, Config{Model: "m"})
+
+	out, err := s.generate(context.Background(), &api.GenerateRequest{Model: "m"}, nil)
+	if !errors.Is(err, boom) {
+		t.Fatalf("err = %v, want %v", err, boom)
+	}
+	if out != "partial" {
+		t.Errorf("out = %q, want the partial response", out)
+	}
+}
+
+func TestGenerateChunkError(t *testing.T) {
+	stop := errors.New("consumer gone")
+	client := &fakeOllama{chunks: map[string][]string{"m": {"a", "b", "c"}}}
+	s := newTestSummarizer(client, Config{Model: "m"})
+
+	calls := 0
+	_, err := s.generate(context.Background(), &api.GenerateRequest{Model: "m"}, func(string) error {
+		calls++
+		return stop
+	})
+	if err != stop {
+		t.Fatalf("err = %v, want the error of onChunk unwrapped", err)
+	}
+	if calls != 1 {
+		t.Errorf("onChunk called %d times after failing", calls)
+	}
+}
+
+func TestGenerateCancelledMidStream(t *testing.T) {
+	for _, ignoreCancel := range []bool{false, true} {
+		client := &fakeOllama{chunks: map[string][]string{"m": {"a", "b", "c"}}, ignoreCancel: ignoreCancel}
+		s := newTestSummarizer(client, Config{Model: "m"})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var chunks []string
+		out, err := s.generate(ctx, &api.GenerateRequest{Model: "m"}, func(chunk string) error {
+			chunks = append(chunks, chunk)
+			cancel()
+			return nil
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("ignoreCancel %v: err = %v, want context.Canceled", ignoreCancel, err)
+		}
+		if out != "a" || len(chunks) != 1 {
+			t.Errorf("ignoreCancel %v: out = %q, chunks = %q; want nothing after the cancellation", ignoreCancel, out, chunks)
+		}
+	}
+}
+
+func TestFallbackBeforeStreaming(t *testing.T) {
+	client := &fakeOllama{
+		chunks: map[string][]string{"fallback": {"ok"}},
+		err:    map[string]error{"m": errors.New("model not found")},
+	}
+	s := newTestSummarizer(client, Config{Model: "m", Fallbacks: []string{"fallback"}})
+
+	out, err := s.SummarizeStream(context.Background(), "body", "%s", func(string) error { return nil })
+	if err != nil || out != "ok" {
+		t.Fatalf("SummarizeStream = %q, %v; want the response of the fallback", out, err)
+	}
+}
+
+func TestNoFallbackAfterStreaming(t *testing.T) {
+	client := &fakeOllama{
+		chunks: map[string][]string{"m": {"half"}, "fallback": {"ok"}},
+		err:    map[string]error{"m": errors.New("connection reset")},
+	}
+	s := newTestSummarizer(client, Config{Model: "m", Fallbacks: []string{"fallback"}})
+
+	if _, err := s.SummarizeStream(context.Background(), "body", "%s", func(string) error { return nil }); err == nil {
+		t.Fatal("SummarizeStream succeeded after a mid-stream error")
+	}
+	if strings.Join(client.calls, ",") != "m" {
+		t.Errorf("models called = %v, want only m", client.calls)
+	}
+}
+
+func TestTimeoutStopsGeneration(t *testing.T) {
+	client := &fakeOllama{
+		chunks: map[string][]string{"m": {"slow"}, "fallback": {"ok"}},
+		block:  map[string]bool{"m": true},
+	}
+	s := newTestSummarizer(client, Config{Model: "m", Fallbacks: []string{"fallback"}, Timeout: 20 * time.Millisecond})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.SummarizeChanges(context.Background(), "body")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("err = %v, want context.DeadlineExceeded", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("generation did not stop at the timeout")
+	}
+	if strings.Join(client.calls, ",") != "m" {
+		t.Errorf("models called = %v, want no fallback after a timeout", client.calls)
+	}
+	if m := s.Metrics(); len(m) != 1 || m[0].Running != 0 || m[0].Failures != 1 {
+		t.Errorf("metrics = %+v", m)
+	}
+}
+
+func TestCancelWhileWaitingForModel(t *testing.T) {
+	client := &fakeOllama{chunks: map[string][]string{"m": {"x"}}}
+	s := newTestSummarizer(client, Config{Model: "m", Concurrency: 1})
+
+	busy, stopBusy := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	go func() {
+		s.queues.run(busy, "m", func(ctx context.Context) (string, error) {
+			close(started)
+			<-ctx.Done()
+			return "", ctx.Err()
+		})
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := s.SummarizeChanges(ctx, "body"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+	stopBusy()
+
+	// The slot of the cancelled waiter is free again
+	q := s.queues.queue("m")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		q.mu.Lock()
+		running, waiting := q.running, q.waitingLocked()
+		q.mu.Unlock()
+		if running == 0 && waiting == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d generations running and %d waiting after all returned", running, waiting)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,425 @@
+// Package sync holds the core steps of syncing GitHub issues to Jira:
+// listing the issues of a repository, looking up their mappings,
+// summarizing them and creating their Jira issues. The services it talks to
+// are injected as interfaces, so the steps can be tested with fakes.
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/jira"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+// GitHub lists the issues of repositories. The Issues service of a
+// *github.Client implements it.
+type GitHub interface {
+	ListByRepo(ctx context.Context, owner, repo string, opts *github.IssueListByRepoOptions) ([]*github.Issue, *github.Response, error)
+}
+
+// Jira creates issues in a Jira instance. *jira.Client implements it.
+type Jira interface {
+	BaseURL() string
+	CreateIssue(ctx context.Context, fields map[string]interface{}) (*jira.CreatedIssue, error)
+}
+
+// Searcher finds Jira issues by JQL. *jira.Client implements it; the
+// issues created through clients that don't aren't marked.
+type Searcher interface {
+	Search(ctx context.Context, jql string, fields []string, fn func(*jira.Issue) error) error
+}
+
+// JiraClients returns the client of a Jira instance by name, the main
+// instance being ""
+type JiraClients interface {
+	Client(instance string) (Jira, error)
+}
+
+// JiraClientsFunc adapts a function to JiraClients
+type JiraClientsFunc func(instance string) (Jira, error)
+
+// Client calls f
+func (f JiraClientsFunc) Client(instance string) (Jira, error) { return f(instance) }
+
+// Summarizer generates the summary of an issue. *summarizer.Summarizer
+// implements it.
+type Summarizer interface {
+	SummarizeStream(ctx context.Context, content, promptTemplate string, fn func(chunk string) error) (string, error)
+}
+
+// RateLimiter paces GitHub calls
+type RateLimiter interface {
+	// Wait blocks until the next GitHub call may be made
+	Wait(ctx context.Context) error
+	// Observe records the rate-limit state of a GitHub response
+	Observe(resp *github.Response, err error)
+}
+
+// Options configures an Engine
+type Options struct {
+	// IssueState is the state of the issues listed, one of the
+	// config.Issues* values
+	IssueState string
+	// ForceLabel marks issues listed regardless of their state; empty
+	// disables it
+	ForceLabel string
+	// RateLimiter paces the GitHub calls; nil doesn't
+	RateLimiter RateLimiter
+	// Redact masks secrets in issue text before it is summarized; nil
+	// leaves the text alone
+	Redact func(string) string
+	// MarkerLabel prefixes the label marking each created Jira issue with
+	// the ID of its GitHub issue, so that the Jira issue of a sync
+	// interrupted before recording it is found again rather than created
+	// twice; empty doesn't mark issues
+	MarkerLabel string
+}
+
+// StageError records which step of a sync failed
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string { return e.Err.Error() }
+func (e *StageError) Unwrap() error { return e.Err }
+
+// Engine runs the sync steps against the injected services
+type Engine struct {
+	github GitHub
+	jira   JiraClients
+	sum    Summarizer
+	store  state.Store
+	opts   Options
+}
+
+// New returns an Engine using the given services. Steps not needing a
+// service may be used with a nil one.
+func New(gh GitHub, jc JiraClients, sum Summarizer, store state.Store, opts Options) *Engine {
+	return &Engine{github: gh, jira: jc, sum: sum, store: store, opts: opts}
+}
+
+// WithSummarizer returns a copy of e summarizing with sum, such as one
+// writing in another language
+func (e *Engine) WithSummarizer(sum Summarizer) *Engine {
+	c := *e
+	c.sum = sum
+	return &c
+}
+
+// wait waits for the rate limiter, if any
+func (e *Engine) wait(ctx context.Context) error {
+	if e.opts.RateLimiter == nil {
+		return nil
+	}
+	return e.opts.RateLimiter.Wait(ctx)
+}
+
+// observe records a GitHub response with the rate limiter, if any
+func (e *Engine) observe(resp *github.Response, err error) {
+	if e.opts.RateLimiter != nil {
+		e.opts.RateLimiter.Observe(resp, err)
+	}
+}
+
+// ListIssues fetches the issues of a repository in the configured state
+// and, regardless of their age or state, the issues labelled for forced sync
+func (e *Engine) ListIssues(ctx context.Context, repo config.RepoConfig) ([]*github.Issue, error) {
+	if err := e.wait(ctx); err != nil {
+		return nil, err
+	}
+	// Closed issues are listed by update so that recently closed ones come
+	// first; historical ones are imported with backfill
+	sort := "created"
+	if e.opts.IssueState != config.IssuesOpen {
+		sort = "updated"
+	}
+	log.Printf("Fetching %s issues from GitHub repository %s", e.opts.IssueState, repo.FullName())
+	issues, resp, err := e.github.ListByRepo(ctx, repo.Owner, repo.Name, &github.IssueListByRepoOptions{
+		State: e.opts.IssueState,
+		Sort:  sort,
+	})
+	e.observe(resp, err)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.opts.ForceLabel == "" {
+		return issues, nil
+	}
+	if err := e.wait(ctx); err != nil {
+		return nil, err
+	}
+	log.Printf("Fetching issues labelled %s from GitHub repository %s", e.opts.ForceLabel, repo.FullName())
+	forced, resp, err := e.github.ListByRepo(ctx, repo.Owner, repo.Name, &github.IssueListByRepoOptions{
+		State:       "all",
+		Labels:      []string{e.opts.ForceLabel},
+		ListOptions: github.ListOptions{PerPage: 100},
+	})
+	e.observe(resp, err)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int64]bool, len(issues))
+	for _, issue := range issues {
+		seen[issue.GetID()] = true
+	}
+	for _, issue := range forced {
+		if !seen[issue.GetID()] {
+			issues = append(issues, issue)
+		}
+	}
+	return issues, nil
+}
+
+// Lookup returns the synced mapping of key, following merges. Mappings left
+// pending by an interrupted sync are reported as state.ErrNotFound so the
+// sync is retried.
+func (e *Engine) Lookup(ctx context.Context, key string) (*state.Mapping, error) {
+	m, err := state.Resolve(ctx, e.store, key)
+	if err == nil && m.JiraKey == "" {
+		if _, ok := e.searcher(m); ok {
+			log.Printf("Previous sync of %s was interrupted, retrying with the Jira issue labelled %s if it was created",
+				m.Key, e.Marker(m))
+			return nil, state.ErrNotFound
+		}
+		where := "Jira"
+		if jc, err := e.jira.Client(m.JiraInstance); err == nil {
+			where = jc.BaseURL()
+		}
+		log.Printf("Previous sync of %s was interrupted, retrying; check %s for a duplicate Jira issue created at %s",
+			m.Key, where, m.CreatedAt.Format(time.RFC3339))
+		return nil, state.ErrNotFound
+	}
+	return m, err
+}
+
+// Summarize generates the summary of an issue description with prompt,
+// after masking its secrets. onChunk, if not nil, receives the summary while
+// it is generated.
+func (e *Engine) Summarize(ctx context.Context, prompt, body string, onChunk func(string) error) (string, error) {
+	if e.opts.Redact != nil {
+		body = e.opts.Redact(body)
+	}
+	return e.sum.SummarizeStream(ctx, body, prompt, onChunk)
+}
+
+// Create creates a Jira issue with fields for the issue of a pending
+// mapping: the mapping is recorded as pending, the Jira issue created with
+// its marker label and the mapping recorded as synced with the hash of the
+// synced issue body, or removed again if the creation failed. The Jira
+// issue of an interrupted sync of the issue is recorded instead of creating
+// another one. A failure to record the synced mapping is returned with the
+// key of the created Jira issue.
+func (e *Engine) Create(ctx context.Context, m *state.Mapping, fields map[string]interface{}, bodyHash string) (string, error) {
+	jiraKey, err := e.Recover(ctx, m)
+	if err != nil {
+		return "", err
+	}
+	if jiraKey == "" {
+		if err := e.RecordPending(ctx, m); err != nil {
+			return "", err
+		}
+		jiraKey, err = e.createIssue(ctx, m, e.Mark(m, fields))
+		if err != nil {
+			e.Abandon(ctx, m, err)
+			return "", err
+		}
+	}
+	return jiraKey, e.RecordSynced(ctx, m, jiraKey, bodyHash)
+}
+
+// markerChars are the characters of IDs not kept in marker labels
+var markerChars = regexp.MustCompile(`[^A-Za-z0-9_.=-]+`)
+
+// Marker returns the label marking the Jira issue of m: MarkerLabel and the
+// node ID of the GitHub issue, or its database ID if it has none. It is
+// empty if issues aren't marked.
+func (e *Engine) Marker(m *state.Mapping) string {
+	if e.opts.MarkerLabel == "" {
+		return ""
+	}
+	id := m.NodeID
+	if id == "" {
+		id = strconv.FormatInt(m.IssueID, 10)
+	}
+	return e.opts.MarkerLabel + "-" + markerChars.ReplaceAllString(id, "-")
+}
+
+// Mark returns fields with the marker label of m added, if the Jira
+// instance of m can be searched for it. fields is left unchanged, so that
+// payloads queued for a retry aren't marked twice.
+func (e *Engine) Mark(m *state.Mapping, fields map[string]interface{}) map[string]interface{} {
+	if _, ok := e.searcher(m); !ok {
+		return fields
+	}
+	marker := e.Marker(m)
+	var labels []interface{}
+	switch l := fields["labels"].(type) {
+	case []string:
+		for _, label := range l {
+			labels = append(labels, label)
+		}
+	case []interface{}:
+		labels = append(labels, l...)
+	}
+	for _, label := range labels {
+		if label == marker {
+			return fields
+		}
+	}
+	marked := make(map[string]interface{}, len(fields)+1)
+	for k, v := range fields {
+		marked[k] = v
+	}
+	marked["labels"] = append(labels, marker)
+	return marked
+}
+
+// Recover returns the key of the Jira issue created for the issue of m by
+// an earlier sync that was interrupted before recording it, found by its
+// marker label, or "" if the store holds no pending mapping of the issue or
+// no Jira issue has the label. m is moved to the instance of the found
+// issue. Failures are *StageError of stage "recover".
+func (e *Engine) Recover(ctx context.Context, m *state.Mapping) (string, error) {
+	prev, err := e.store.Get(ctx, m.Key)
+	if errors.Is(err, state.ErrNotFound) {
+		return "", nil
+	} else if err != nil {
+		return "", &StageError{Stage: "recover", Err: err}
+	}
+	if prev.JiraKey != "" || prev.SyncStatus != state.StatusPending {
+		return "", nil
+	}
+	s, ok := e.searcher(prev)
+	if !ok {
+		return "", nil
+	}
+	marker := e.Marker(prev)
+	var jiraKey string
+	err = s.Search(ctx, fmt.Sprintf("labels = %q ORDER BY created ASC", marker), []string{"summary"}, func(issue *jira.Issue) error {
+		if jiraKey == "" {
+			jiraKey = issue.Key
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to look up the Jira issue labelled %s of interrupted sync %s: %v", marker, m.Key, err)
+		return "", &StageError{Stage: "recover", Err: err}
+	}
+	if jiraKey == "" {
+		return "", nil
+	}
+	log.Printf("Found Jira issue %s created by the interrupted sync of %s, recording it", jiraKey, m.Key)
+	m.JiraInstance = prev.JiraInstance
+	m.CreatedAt = prev.CreatedAt
+	return jiraKey, nil
+}
+
+// Abandon removes the pending mapping of a failed creation, unless the Jira
+// issue may have been created nonetheless and can be found by its marker
+// label: then the mapping is kept for Recover.
+func (e *Engine) Abandon(ctx context.Context, m *state.Mapping, err error) {
+	var jerr *jira.Error
+	rejected := errors.As(err, &jerr) && jerr.StatusCode < http.StatusInternalServerError
+	if _, ok := e.searcher(m); ok && !rejected {
+		log.Printf("Keeping pending mapping %s, the Jira issue may have been created: %v", m.Key, err)
+		return
+	}
+	e.DropPending(ctx, m.Key)
+}
+
+// searcher returns the client of the Jira instance of m if its issues are
+// marked
+func (e *Engine) searcher(m *state.Mapping) (Searcher, bool) {
+	if e.opts.MarkerLabel == "" || e.jira == nil {
+		return nil, false
+	}
+	jc, err := e.jira.Client(m.JiraInstance)
+	if err != nil {
+		return nil, false
+	}
+	s, ok := jc.(Searcher)
+	return s, ok
+}
+
+// RecordPending records the mapping of an issue whose Jira issue is about to
+// be created, so that a sync interrupted by a crash can be told apart from
+// an issue that was never synced. Failures are *StageError of stage
+// "record".
+func (e *Engine) RecordPending(ctx context.Context, m *state.Mapping) error {
+	if err := e.store.Put(ctx, m); err != nil {
+		log.Printf("Failed to record pending mapping %s: %v", m.Key, err)
+		return &StageError{Stage: "record", Err: err}
+	}
+	return nil
+}
+
+// DropPending removes the pending mapping of a failed creation
+func (e *Engine) DropPending(ctx context.Context, key string) {
+	if err := e.store.Delete(ctx, key); err != nil {
+		log.Printf("Failed to remove pending mapping %s: %v", key, err)
+	}
+}
+
+// RecordSynced records a pending mapping as synced to the Jira issue
+// jiraKey. Failures are *StageError of stage "record".
+func (e *Engine) RecordSynced(ctx context.Context, m *state.Mapping, jiraKey, bodyHash string) error {
+	m.JiraKey = jiraKey
+	m.SyncStatus = state.StatusSynced
+	m.BodyHash = bodyHash
+	m.LastSyncedAt = time.Now().UTC()
+	m.UpdatedAt = m.LastSyncedAt
+	if err := e.store.Put(ctx, m); err != nil {
+		log.Printf("Failed to record mapping %s -> %s: %v", m.Key, jiraKey, err)
+		return &StageError{Stage: "record", Err: err}
+	}
+	return nil
+}
+
+// createIssue creates the Jira issue of a mapping in its instance
+func (e *Engine) createIssue(ctx context.Context, m *state.Mapping, fields map[string]interface{}) (string, error) {
+	jc, err := e.jira.Client(m.JiraInstance)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("Sending request to Jira API for issue #%d", m.IssueNumber)
+	created, err := jc.CreateIssue(ctx, fields)
+	if err != nil {
+		log.Printf("Failed to create Jira issue for GitHub issue #%d: %v", m.IssueNumber, err)
+		return "", err
+	}
+	if created == nil || created.Key == "" {
+		return "", errors.New("Jira returned no key for the created issue")
+	}
+	log.Printf("Jira issue %s created successfully for GitHub issue #%d", created.Key, m.IssueNumber)
+	return created.Key, nil
+}
+
+// PendingMapping returns the mapping recorded while the Jira issue of an
+// issue of repo is created in a Jira instance
+func PendingMapping(repo config.RepoConfig, issue *github.Issue, key, instance string) *state.Mapping {
+	now := time.Now().UTC()
+	return &state.Mapping{
+		Key:          key,
+		Namespace:    repo.NamespaceName(),
+		Repo:         repo.FullName(),
+		IssueNumber:  issue.GetNumber(),
+		IssueID:      issue.GetID(),
+		NodeID:       issue.GetNodeID(),
+		JiraInstance: instance,
+		SyncStatus:   state.StatusPending,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+}
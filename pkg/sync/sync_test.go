@@ -0,0 +1,288 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/jira"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+// fakeGitHub returns the issues of each list request by the label asked
+// for, "" for unlabelled requests
+type fakeGitHub struct {
+	issues   map[string][]*github.Issue
+	requests []*github.IssueListByRepoOptions
+}
+
+func (f *fakeGitHub) ListByRepo(ctx context.Context, owner, repo string, opts *github.IssueListByRepoOptions) ([]*github.Issue, *github.Response, error) {
+	f.requests = append(f.requests, opts)
+	return f.issues[strings.Join(opts.Labels, ",")], nil, nil
+}
+
+// fakeJira creates issues with increasing keys, or fails with err
+type fakeJira struct {
+	err     error
+	created []map[string]interface{}
+}
+
+func (f *fakeJira) BaseURL() string { return "https://jira.example.com" }
+
+func (f *fakeJira) CreateIssue(ctx context.Context, fields map[string]interface{}) (*jira.CreatedIssue, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.created = append(f.created, fields)
+	return &jira.CreatedIssue{Key: fmt.Sprintf("PROJ-%d", len(f.created))}, nil
+}
+
+// searchableJira is a fakeJira searching the created issues by label
+type searchableJira struct {
+	fakeJira
+	searches []string
+}
+
+func (f *searchableJira) Search(ctx context.Context, jql string, fields []string, fn func(*jira.Issue) error) error {
+	f.searches = append(f.searches, jql)
+	for i, created := range f.created {
+		labels, _ := created["labels"].([]interface{})
+		for _, label := range labels {
+			if strings.Contains(jql, fmt.Sprintf("%q", label)) {
+				if err := fn(&jira.Issue{Key: fmt.Sprintf("PROJ-%d", i+1)}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// fakeSummarizer echoes the content it is given
+type fakeSummarizer struct{}
+
+func (fakeSummarizer) SummarizeStream(ctx context.Context, content, promptTemplate string, fn func(string) error) (string, error) {
+	return "summary of " + content, nil
+}
+
+// failingStore fails to put mappings after the given number of puts
+type failingStore struct {
+	state.Store
+	puts int
+}
+
+func (s *failingStore) Put(ctx context.Context, m *state.Mapping) error {
+	if s.puts == 0 {
+		return errors.New("disk full")
+	}
+	s.puts--
+	return s.Store.Put(ctx, m)
+}
+
+func newStore(t *testing.T) state.Store {
+	t.Helper()
+	store, err := state.Open("memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func jiraClients(jc Jira) JiraClients {
+	return JiraClientsFunc(func(instance string) (Jira, error) {
+		if instance != "" {
+			return nil, errors.New("unknown instance")
+		}
+		return jc, nil
+	})
+}
+
+var (
+	repo  = config.RepoConfig{Owner: "octo", Name: "app"}
+	issue = &github.Issue{ID: github.Ptr(int64(100)), Number: github.Ptr(7), Title: github.Ptr("Crash")}
+)
+
+func TestListIssuesAddsForcedIssuesOnce(t *testing.T) {
+	gh := &fakeGitHub{issues: map[string][]*github.Issue{
+		"":     {{ID: github.Ptr(int64(1))}, {ID: github.Ptr(int64(2))}},
+		"sync": {{ID: github.Ptr(int64(2))}, {ID: github.Ptr(int64(3))}},
+	}}
+	e := New(gh, nil, nil, nil, Options{IssueState: config.IssuesOpen, ForceLabel: "sync"})
+
+	issues, err := e.ListIssues(context.Background(), repo)
+	if err != nil {
+		t.Fatalf("ListIssues: %v", err)
+	}
+	var ids []int64
+	for _, i := range issues {
+		ids = append(ids, i.GetID())
+	}
+	if len(ids) != 3 || ids[0] != 1 || ids[1] != 2 || ids[2] != 3 {
+		t.Errorf("issues = %v, want [1 2 3]", ids)
+	}
+	if len(gh.requests) != 2 || gh.requests[0].Sort != "created" || gh.requests[1].State != "all" {
+		t.Errorf("unexpected list requests %+v", gh.requests)
+	}
+}
+
+func TestCreateRecordsSyncedMapping(t *testing.T) {
+	store := newStore(t)
+	jc := &fakeJira{}
+	e := New(nil, jiraClients(jc), nil, store, Options{})
+	ctx := context.Background()
+
+	m := PendingMapping(repo, issue, "octo/app#7", "")
+	key, err := e.Create(ctx, m, map[string]interface{}{"summary": "Crash"}, "hash")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if key != "PROJ-1" || len(jc.created) != 1 {
+		t.Fatalf("created %q, %d issues", key, len(jc.created))
+	}
+	got, err := e.Lookup(ctx, "octo/app#7")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if got.JiraKey != "PROJ-1" || got.SyncStatus != state.StatusSynced || got.BodyHash != "hash" || got.LastSyncedAt.IsZero() {
+		t.Errorf("mapping = %+v", got)
+	}
+}
+
+func TestCreateFailureDropsPendingMapping(t *testing.T) {
+	store := newStore(t)
+	jiraErr := errors.New("Jira unavailable")
+	e := New(nil, jiraClients(&fakeJira{err: jiraErr}), nil, store, Options{})
+	ctx := context.Background()
+
+	_, err := e.Create(ctx, PendingMapping(repo, issue, "octo/app#7", ""), nil, "hash")
+	if !errors.Is(err, jiraErr) {
+		t.Fatalf("err = %v, want %v", err, jiraErr)
+	}
+	if _, err := store.Get(ctx, "octo/app#7"); !errors.Is(err, state.ErrNotFound) {
+		t.Errorf("pending mapping left behind: %v", err)
+	}
+}
+
+func TestCreateRecordFailure(t *testing.T) {
+	store := &failingStore{Store: newStore(t), puts: 1}
+	e := New(nil, jiraClients(&fakeJira{}), nil, store, Options{})
+
+	key, err := e.Create(context.Background(), PendingMapping(repo, issue, "octo/app#7", ""), nil, "hash")
+	var stageErr *StageError
+	if !errors.As(err, &stageErr) || stageErr.Stage != "record" {
+		t.Fatalf("err = %v, want a record StageError", err)
+	}
+	if key != "PROJ-1" {
+		t.Errorf("key = %q, want the key of the created issue", key)
+	}
+}
+
+func TestLookupTreatsPendingAsNotFound(t *testing.T) {
+	store := newStore(t)
+	e := New(nil, jiraClients(&fakeJira{}), nil, store, Options{})
+	ctx := context.Background()
+
+	m := PendingMapping(repo, issue, "octo/app#7", "")
+	m.CreatedAt = time.Now().Add(-time.Hour)
+	if err := e.RecordPending(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Lookup(ctx, "octo/app#7"); !errors.Is(err, state.ErrNotFound) {
+		t.Errorf("err = %v, want state.ErrNotFound for an interrupted sync", err)
+	}
+}
+
+func TestCreateMarksIssue(t *testing.T) {
+	jc := &searchableJira{}
+	e := New(nil, jiraClients(jc), nil, newStore(t), Options{MarkerLabel: "gh-jira"})
+	marked := &github.Issue{ID: github.Ptr(int64(100)), NodeID: github.Ptr("I_kwDO42"), Number: github.Ptr(7)}
+
+	fields := map[string]interface{}{"summary": "Crash", "labels": []string{"bug"}}
+	if _, err := e.Create(context.Background(), PendingMapping(repo, marked, "octo/app#7", ""), fields, "hash"); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	labels, _ := jc.created[0]["labels"].([]interface{})
+	if len(labels) != 2 || labels[0] != "bug" || labels[1] != "gh-jira-I_kwDO42" {
+		t.Errorf("labels = %v, want [bug gh-jira-I_kwDO42]", labels)
+	}
+	if l := fields["labels"].([]string); len(l) != 1 {
+		t.Errorf("the payload was changed: %v", l)
+	}
+	if len(jc.searches) != 0 {
+		t.Errorf("searched %v without an interrupted sync", jc.searches)
+	}
+}
+
+func TestCreateRecoversInterruptedSync(t *testing.T) {
+	store := newStore(t)
+	jc := &searchableJira{}
+	e := New(nil, jiraClients(jc), nil, store, Options{MarkerLabel: "gh-jira"})
+	ctx := context.Background()
+
+	// A sync that crashed after creating the Jira issue left its mapping
+	// pending
+	m := PendingMapping(repo, issue, "octo/app#7", "")
+	if err := e.RecordPending(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jc.CreateIssue(ctx, e.Mark(m, map[string]interface{}{"summary": "Crash"})); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := e.Create(ctx, PendingMapping(repo, issue, "octo/app#7", ""), map[string]interface{}{"summary": "Crash"}, "hash")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if key != "PROJ-1" || len(jc.created) != 1 {
+		t.Errorf("created %q, %d issues, want PROJ-1 reused", key, len(jc.created))
+	}
+	if got, err := e.Lookup(ctx, "octo/app#7"); err != nil || got.JiraKey != "PROJ-1" {
+		t.Errorf("Lookup = %+v, %v", got, err)
+	}
+}
+
+func TestCreateFailureKeepsPendingMappingIfMarked(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		kept bool
+	}{
+		{"timeout", context.DeadlineExceeded, true},
+		{"server error", &jira.Error{Status: "502 Bad Gateway", StatusCode: 502}, true},
+		{"rejected", &jira.Error{Status: "400 Bad Request", StatusCode: 400}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newStore(t)
+			jc := &searchableJira{fakeJira: fakeJira{err: tc.err}}
+			e := New(nil, jiraClients(jc), nil, store, Options{MarkerLabel: "gh-jira"})
+			ctx := context.Background()
+
+			if _, err := e.Create(ctx, PendingMapping(repo, issue, "octo/app#7", ""), nil, "hash"); !errors.Is(err, tc.err) {
+				t.Fatalf("err = %v, want %v", err, tc.err)
+			}
+			_, err := store.Get(ctx, "octo/app#7")
+			if kept := err == nil; kept != tc.kept {
+				t.Errorf("pending mapping kept = %v, want %v", kept, tc.kept)
+			}
+		})
+	}
+}
+
+func TestSummarizeRedacts(t *testing.T) {
+	e := New(nil, nil, fakeSummarizer{}, nil, Options{
+		Redact: func(s string) string { return strings.ReplaceAll(s, "hunter2", "[REDACTED]") },
+	})
+	out, err := e.Summarize(context.Background(), "%s", "password hunter2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "summary of password [REDACTED]" {
+		t.Errorf("summary = %q", out)
+	}
+}
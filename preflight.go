@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/savitaashture/gh-jira/pkg/summarizer"
+)
+
+// preflight runs the online checks of `validate` before the first poll
+// cycle: the GitHub token and its scopes, the Jira projects, issue types,
+// fields and permissions, the sinks, and the Ollama models. A failed check stops the
+// startup with what to fix, instead of failing the API calls of every
+// issue.
+func preflight(ctx context.Context, sum *summarizer.Summarizer) error {
+	pc := cfg().Preflight
+	if !pc.Enabled {
+		return nil
+	}
+	if pc.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, pc.Timeout)
+		defer cancel()
+	}
+	log.Printf("Running preflight checks of GitHub, Jira and Ollama")
+	report := &validateReport{}
+	validateGitHub(ctx, report)
+	validateJira(ctx, report)
+	validateSinks(ctx, report)
+	validateOllama(ctx, sum, report)
+
+	var problems []string
+	for _, c := range report.Checks {
+		if !c.OK {
+			log.Printf("Preflight check %s failed: %s", c.Check, c.Problem)
+			problems = append(problems, c.Check+": "+c.Problem)
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d of %d preflight checks failed (set preflight.enabled to false to skip them):\n  %s",
+			len(problems), len(report.Checks), strings.Join(problems, "\n  "))
+	}
+	log.Printf("Passed %d preflight checks", len(report.Checks))
+	return nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/jira"
+	"github.com/savitaashture/gh-jira/pkg/state"
+	"github.com/savitaashture/gh-jira/pkg/summarizer"
+)
+
+// publishPrompt asks the model to turn the description of a Jira issue into
+// the body of a GitHub issue
+const publishPrompt = `Please rewrite this Jira issue description as the body of a GitHub issue in GitHub Flavored Markdown.
+Convert Jira wiki markup such as {code}, {noformat}, h2. headings and *bold* to Markdown, keep code snippets, links and @mentions as they are, and do not add information that is not in the description:
+
+%s`
+
+// publishCursorPrefix prefixes the cursors recording the GitHub issues that
+// Jira issues were published as
+const publishCursorPrefix = "publish:"
+
+// publishPending prefixes the cursor value of a Jira issue whose GitHub
+// issue is being created, followed by the time the creation started
+const publishPending = "pending:"
+
+// publishJiraIssues creates a GitHub issue for each Jira issue matching the
+// publish query that wasn't published yet, and maps the two, so that the
+// GitHub issue is synced like one that was opened on GitHub
+func publishJiraIssues(ctx context.Context, client *github.Client, sum *summarizer.Summarizer, result *cycleResult) error {
+	conf := cfg()
+	repo, err := selectRepo(conf.Jira.Publish.Repo)
+	if err != nil {
+		result.fail("", 0, "publish", err)
+		return nil
+	}
+	jc, err := jiraFor("")
+	if err != nil {
+		return err
+	}
+	log.Printf("Searching Jira issues to publish to %s", repo.FullName())
+	var issues []*jira.Issue
+	err = jc.Search(ctx, conf.Jira.Publish.JQL, []string{"summary", "description"}, func(ji *jira.Issue) error {
+		issues = append(issues, ji)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error searching Jira issues to publish: %v", err)
+		result.fail(repo.FullName(), 0, "publish", fmt.Errorf("failed to search Jira issues to publish: %w", err))
+		return nil
+	}
+	for _, ji := range issues {
+		if ctx.Err() != nil {
+			return nil
+		}
+		published, err := publishJiraIssue(ctx, client, jc, repo, ji, sum)
+		switch {
+		case err != nil:
+			log.Printf("Failed to publish Jira issue %s to %s: %v", ji.Key, repo.FullName(), err)
+			if isAuthError(err) {
+				return fmt.Errorf("GitHub authentication failed: %w", err)
+			}
+			result.fail(repo.FullName(), 0, "publish", fmt.Errorf("%s: %w", ji.Key, err))
+		case published:
+			result.inc(&result.Published)
+		}
+	}
+	return nil
+}
+
+// publishJiraIssue creates the GitHub issue of a Jira issue unless it was
+// already published, and reports whether it did. The cursor of the Jira
+// issue is marked pending before the GitHub issue is created, so that the
+// issue of a publishing interrupted before the cursor was set is found
+// again by its footer instead of created twice.
+func publishJiraIssue(ctx context.Context, client *github.Client, jc *jira.Client, repo config.RepoConfig, ji *jira.Issue, sum *summarizer.Summarizer) (bool, error) {
+	cursor := publishCursorPrefix + ji.Key
+	value, err := store.GetCursor(ctx, cursor)
+	if err != nil {
+		return false, err
+	}
+	var issue *github.Issue
+	switch {
+	case strings.HasPrefix(value, publishPending):
+		since, err := time.Parse(time.RFC3339, strings.TrimPrefix(value, publishPending))
+		if err != nil {
+			return false, fmt.Errorf("invalid pending cursor %s: %q", cursor, value)
+		}
+		if issue, err = findPublished(ctx, client, repo, ji.Key, since); err != nil {
+			return false, err
+		}
+		if issue != nil {
+			log.Printf("Found GitHub issue %s#%d of the interrupted publishing of %s, recording it", repo.FullName(), issue.GetNumber(), ji.Key)
+		}
+	case value != "":
+		return false, nil
+	}
+	if issue == nil {
+		if issue, err = createPublished(ctx, client, repo, ji, sum, cursor); err != nil {
+			return false, err
+		}
+	}
+
+	if err := store.SetCursor(ctx, cursor, issue.GetHTMLURL()); err != nil {
+		return true, fmt.Errorf("failed to record publishing of %s: %w", ji.Key, err)
+	}
+	if err := recordPublished(ctx, repo, issue, ji.Key); err != nil {
+		return true, err
+	}
+
+	comment := fmt.Sprintf("Published to GitHub: %s", issue.GetHTMLURL())
+	if id, err := jc.AddComment(ctx, ji.Key, comment); err != nil {
+		log.Printf("Failed to comment the GitHub issue on Jira issue %s: %v", ji.Key, err)
+	} else {
+		recordAudit(jiraAudit("create_comment", ji.Key, map[string]interface{}{"comment_id": id}))
+	}
+	return true, nil
+}
+
+// publishedFooter returns the start of the footer linking the GitHub issue
+// of a Jira issue back to it
+func publishedFooter(jiraKey string) string {
+	return fmt.Sprintf("Published from Jira: [%s](", jiraKey)
+}
+
+// createPublished marks the cursor of a Jira issue pending and creates its
+// GitHub issue
+func createPublished(ctx context.Context, client *github.Client, repo config.RepoConfig, ji *jira.Issue, sum *summarizer.Summarizer, cursor string) (*github.Issue, error) {
+	conf := cfg()
+	log.Printf("Publishing Jira issue %s to %s", ji.Key, repo.FullName())
+
+	body := mentionsToGitHub(ji.Fields.Description)
+	if strings.TrimSpace(body) != "" {
+		formatted, err := summarizeText(ctx, sum, publishPrompt, body, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reformat description: %w", err)
+		}
+		body = formatted + "\n\n"
+	}
+	body += "---\n" + publishedFooter(ji.Key) + jiraBrowseURL("", ji.Key) + ")"
+
+	req := &github.IssueRequest{Title: github.Ptr(ji.Fields.Summary), Body: &body}
+	if len(conf.Jira.Publish.Labels) > 0 {
+		req.Labels = &conf.Jira.Publish.Labels
+	}
+	// The start is recorded a little early, as GitHub may date the issue
+	// before this clock does
+	pending := publishPending + time.Now().UTC().Add(-time.Minute).Format(time.RFC3339)
+	if err := store.SetCursor(ctx, cursor, pending); err != nil {
+		return nil, fmt.Errorf("failed to record publishing of %s: %w", ji.Key, err)
+	}
+	if err := ghRateLimit.wait(ctx); err != nil {
+		return nil, err
+	}
+	issue, resp, err := client.Issues.Create(ctx, repo.Owner, repo.Name, req)
+	ghRateLimit.observe(resp, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GitHub issue: %w", err)
+	}
+	log.Printf("Created GitHub issue %s#%d for Jira issue %s", repo.FullName(), issue.GetNumber(), ji.Key)
+	recordAudit(githubAudit("create_issue", repo, issue.GetNumber(), map[string]interface{}{"jira_key": ji.Key}))
+	return issue, nil
+}
+
+// findPublished returns the GitHub issue created for a Jira issue since a
+// publishing of it started, found by its footer, or nil if there is none.
+// The issues are listed rather than searched, as the search index lags
+// behind new issues.
+func findPublished(ctx context.Context, client *github.Client, repo config.RepoConfig, jiraKey string, since time.Time) (*github.Issue, error) {
+	footer := publishedFooter(jiraKey)
+	opt := &github.IssueListByRepoOptions{
+		State:       "all",
+		Since:       since,
+		Sort:        "created",
+		Direction:   "asc",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		if err := ghRateLimit.wait(ctx); err != nil {
+			return nil, err
+		}
+		issues, resp, err := client.Issues.ListByRepo(ctx, repo.Owner, repo.Name, opt)
+		ghRateLimit.observe(resp, err)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up the GitHub issue of the interrupted publishing of %s: %w", jiraKey, err)
+		}
+		for _, issue := range issues {
+			if !issue.IsPullRequest() && strings.Contains(issue.GetBody(), footer) {
+				return issue, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return nil, nil
+		}
+		opt.ListOptions.Page = resp.NextPage
+	}
+}
+
+// recordPublished records the mapping of a GitHub issue created for a Jira
+// issue
+func recordPublished(ctx context.Context, repo config.RepoConfig, issue *github.Issue, jiraKey string) error {
+	key, err := issueKey(repo, issue)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	mapping := &state.Mapping{
+		Key:          key,
+		Namespace:    repo.NamespaceName(),
+		Repo:         repo.FullName(),
+		IssueNumber:  issue.GetNumber(),
+		IssueID:      issue.GetID(),
+		NodeID:       issue.GetNodeID(),
+		JiraKey:      jiraKey,
+		SyncStatus:   state.StatusSynced,
+		BodyHash:     bodyHash(issue),
+		LastSyncedAt: now,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := store.Put(ctx, mapping); err != nil {
+		return fmt.Errorf("failed to record mapping %s -> %s: %w", key, jiraKey, err)
+	}
+	return nil
+}
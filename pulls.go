@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/jira"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+// linkedPull is a pull request referencing a GitHub issue
+type linkedPull struct {
+	// Repo is the owner/name of the repository of the pull request
+	Repo   string
+	Number int
+	Title  string
+	URL    string
+	// State is "open", "closed" or "merged"
+	State string
+	// Branch is the head branch, only known with the GraphQL fetch mode
+	Branch string
+}
+
+// linkedCommit is a commit referencing a GitHub issue
+type linkedCommit struct {
+	// Repo is the owner/name of the repository of the commit
+	Repo string
+	SHA  string
+	URL  string
+	// Message is the first line of the commit message, only known with the
+	// GraphQL fetch mode
+	Message string
+	Date    time.Time
+}
+
+// issueTimeline is what references a GitHub issue on its timeline, most
+// recent last
+type issueTimeline struct {
+	Pulls   []linkedPull
+	Commits []linkedCommit
+}
+
+// ref returns the pull request as owner/name#number
+func (p linkedPull) ref() string {
+	return fmt.Sprintf("%s#%d", strings.ToLower(p.Repo), p.Number)
+}
+
+// pullRequests is what was last written to Jira for the pull requests
+// referencing a synced issue
+type pullRequests struct {
+	// States are the states of the linked pull requests, by reference
+	States map[string]string `json:"states"`
+	// InReview is set once the Jira issue was transitioned for an open
+	// pull request; it is transitioned only once
+	InReview bool `json:"in_review,omitempty"`
+}
+
+// pullRequestsCursor names the state cursor holding the pull requests of a
+// synced issue as JSON
+func pullRequestsCursor(key string) string {
+	return "pulls:" + key
+}
+
+// listTimeline returns the pull requests and commits referencing an issue
+// on its timeline. References fetched with the issue or listed before in
+// this poll are used without asking GitHub again.
+func listTimeline(ctx context.Context, client *github.Client, repo config.RepoConfig, issue *github.Issue) (*issueTimeline, error) {
+	if t, ok := fetchedIssues.timeline(repo.FullName(), issue.GetNumber()); ok {
+		return t, nil
+	}
+	// Commit links point to the web host of the issue, which differs from
+	// the API host
+	webURL, _, _ := strings.Cut(issue.GetHTMLURL(), "/"+repo.FullName()+"/")
+	t := &issueTimeline{}
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		if err := ghRateLimit.wait(ctx); err != nil {
+			return nil, err
+		}
+		events, resp, err := client.Issues.ListIssueTimeline(ctx, repo.Owner, repo.Name, issue.GetNumber(), opt)
+		ghRateLimit.observe(resp, err)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the timeline: %w", err)
+		}
+		for _, e := range events {
+			switch src := e.GetSource().GetIssue(); {
+			case e.GetEvent() == "cross-referenced" && src != nil && src.IsPullRequest():
+				state := src.GetState()
+				if !src.PullRequestLinks.GetMergedAt().IsZero() {
+					state = "merged"
+				}
+				t.Pulls = append(t.Pulls, linkedPull{
+					Repo:   src.GetRepository().GetFullName(),
+					Number: src.GetNumber(),
+					Title:  src.GetTitle(),
+					URL:    src.GetHTMLURL(),
+					State:  state,
+				})
+			case e.GetEvent() == "referenced" && e.GetCommitID() != "":
+				// The commit URL is .../repos/owner/name/commits/sha
+				_, path, _ := strings.Cut(e.GetCommitURL(), "/repos/")
+				name, _, _ := strings.Cut(path, "/commits/")
+				t.Commits = append(t.Commits, linkedCommit{
+					Repo: name,
+					SHA:  e.GetCommitID(),
+					URL:  webURL + "/" + name + "/commit/" + e.GetCommitID(),
+					Date: e.GetCreatedAt().Time,
+				})
+			}
+		}
+		if resp.NextPage == 0 {
+			fetchedIssues.setTimeline(repo.FullName(), issue.GetNumber(), t)
+			return t, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// syncPullRequests adds a Jira remote link for each pull request that
+// references a synced issue, updates the link when the pull request is
+// closed or merged, and moves the Jira issue through the configured
+// transition once an open pull request references it
+func syncPullRequests(ctx context.Context, client *github.Client, repo config.RepoConfig, issue *github.Issue, m *state.Mapping) error {
+	pc := cfg().Jira.PullRequests
+	if !pc.Enabled || m.JiraKey == "" {
+		return nil
+	}
+	timeline, err := listTimeline(ctx, client, repo, issue)
+	if err != nil {
+		return err
+	}
+	last := pullRequests{States: map[string]string{}}
+	if stored, err := store.GetCursor(ctx, pullRequestsCursor(m.Key)); err != nil {
+		return err
+	} else if stored != "" {
+		if err := json.Unmarshal([]byte(stored), &last); err != nil {
+			return fmt.Errorf("invalid pull requests of %s: %w", m.Key, err)
+		}
+	}
+
+	jc, err := jiraFor(m.JiraInstance)
+	if err != nil {
+		return err
+	}
+	changed, open := false, false
+	for _, p := range timeline.Pulls {
+		if p.State == "open" {
+			open = true
+		}
+		if last.States[p.ref()] == p.State {
+			continue
+		}
+		link := jira.RemoteLink{
+			GlobalID: "gh-jira:pull:" + p.URL,
+			URL:      p.URL,
+			Title:    fmt.Sprintf("Pull request %s#%d: %s", p.Repo, p.Number, p.Title),
+			Summary:  p.State,
+			Resolved: p.State != "open",
+		}
+		if err := jc.AddRemoteLink(ctx, m.JiraKey, link); err != nil {
+			return fmt.Errorf("failed to link pull request %s to %s: %w", p.ref(), m.JiraKey, err)
+		}
+		log.Printf("Linked %s pull request %s referencing GitHub issue #%d to %s", p.State, p.ref(), issue.GetNumber(), m.JiraKey)
+		e := jiraAudit("add_remote_link", m.JiraKey, map[string]interface{}{"pull_request": p.ref(), "state": p.State})
+		e.Repo, e.Issue = repo.FullName(), issue.GetNumber()
+		recordAudit(e)
+		last.States[p.ref()] = p.State
+		changed = true
+	}
+
+	if open && !last.InReview && pc.Transition.Name != "" {
+		t, err := transitionByName(ctx, jc, repo, issue, m.JiraKey, pc.Transition)
+		if err != nil {
+			return err
+		}
+		if t == nil {
+			log.Printf("Jira issue %s has no transition %q in its current status, leaving it unchanged", m.JiraKey, pc.Transition.Name)
+		} else {
+			log.Printf("Moved Jira issue %s of GitHub issue #%d with an open pull request to %s", m.JiraKey, issue.GetNumber(), t.To.Name)
+		}
+		// Not retried, as the issue may simply have moved on in Jira
+		last.InReview = true
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	data, _ := json.Marshal(last)
+	return store.SetCursor(ctx, pullRequestsCursor(m.Key), string(data))
+}
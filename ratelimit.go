@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v75/github"
+)
+
+// rateLimiter tracks the GitHub rate-limit headers seen on API responses and
+// slows down or pauses polling when the remaining budget runs low
+type rateLimiter struct {
+	mu        sync.Mutex
+	threshold int
+	rate      github.Rate
+	known     bool
+	calls     int
+	lastCalls int
+	pausedTo  time.Time
+}
+
+func newRateLimiter(threshold int) *rateLimiter {
+	return &rateLimiter{threshold: threshold}
+}
+
+// observe records the rate-limit state from a GitHub response and error
+func (r *rateLimiter) observe(resp *github.Response, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls++
+	if resp != nil && resp.Rate.Limit > 0 {
+		r.rate = resp.Rate
+		r.known = true
+	}
+
+	var rateErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	switch {
+	case errors.As(err, &rateErr):
+		r.rate = rateErr.Rate
+		r.known = true
+		r.pausedTo = rateErr.Rate.Reset.Time
+		log.Printf("GitHub rate limit exceeded, pausing until %s", r.pausedTo.Format(time.RFC3339))
+	case errors.As(err, &abuseErr):
+		retry := time.Minute
+		if abuseErr.RetryAfter != nil {
+			retry = *abuseErr.RetryAfter
+		}
+		r.pausedTo = time.Now().Add(retry)
+		log.Printf("GitHub secondary rate limit hit, pausing for %s", retry)
+	}
+}
+
+// wait blocks until it is safe to make another GitHub call, pausing until
+// the rate-limit reset when the remaining budget is below the threshold
+func (r *rateLimiter) wait(ctx context.Context) error {
+	r.mu.Lock()
+	until := r.pausedTo
+	if r.known && r.rate.Remaining < r.threshold && r.rate.Reset.Time.After(until) {
+		until = r.rate.Reset.Time
+	}
+	remaining := r.rate.Remaining
+	r.mu.Unlock()
+
+	d := time.Until(until)
+	if d <= 0 {
+		return nil
+	}
+	log.Printf("GitHub rate limit low (%d remaining), pausing for %s", remaining, d.Round(time.Second))
+	select {
+	case <-time.After(d):
+		log.Printf("Resuming GitHub calls after rate-limit pause")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// endCycle marks the end of a poll cycle so that the number of calls it
+// made can be used to pace the next one
+func (r *rateLimiter) endCycle() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastCalls = r.calls
+	r.calls = 0
+}
+
+// adjustDelay stretches the poll delay so that the remaining budget, at the
+// rate of calls made during the last cycle, lasts until the next reset
+func (r *rateLimiter) adjustDelay(delay time.Duration) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.known || r.lastCalls == 0 {
+		return delay
+	}
+	untilReset := time.Until(r.rate.Reset.Time)
+	if untilReset <= 0 {
+		return delay
+	}
+
+	budget := r.rate.Remaining - r.threshold
+	if budget < r.lastCalls {
+		log.Printf("GitHub rate limit nearly exhausted (%d/%d remaining), waiting for reset in %s",
+			r.rate.Remaining, r.rate.Limit, untilReset.Round(time.Second))
+		return untilReset
+	}
+
+	cycles := budget / r.lastCalls
+	if paced := untilReset / time.Duration(cycles); paced > delay {
+		log.Printf("Slowing down polling to every %s to stay within the GitHub rate limit (%d/%d remaining)",
+			paced.Round(time.Second), r.rate.Remaining, r.rate.Limit)
+		return paced
+	}
+	return delay
+}
+
+// rateLimitStatus is the rate-limit state reported by /debug/state
+type rateLimitStatus struct {
+	Limit     int        `json:"limit"`
+	Remaining int        `json:"remaining"`
+	Reset     *time.Time `json:"reset,omitempty"`
+	// PausedUntil is set while GitHub calls are paused after hitting a
+	// rate limit
+	PausedUntil *time.Time `json:"paused_until,omitempty"`
+	// Calls are the GitHub calls of the current cycle so far
+	Calls int `json:"calls"`
+}
+
+// status returns the rate-limit state, or nil before the first response
+func (r *rateLimiter) status() *rateLimitStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.known && r.pausedTo.IsZero() {
+		return nil
+	}
+	st := &rateLimitStatus{Limit: r.rate.Limit, Remaining: r.rate.Remaining, Calls: r.calls}
+	if reset := r.rate.Reset.Time; !reset.IsZero() {
+		st.Reset = &reset
+	}
+	if time.Now().Before(r.pausedTo) {
+		paused := r.pausedTo
+		st.PausedUntil = &paused
+	}
+	return st
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+// reactions is what was last written to Jira for the 👍 reactions of a
+// synced issue
+type reactions struct {
+	PlusOnes int `json:"plus_ones"`
+	// Raised is set once the Jira issue was raised to the configured
+	// priority; it is not lowered again when reactions are removed
+	Raised bool `json:"raised,omitempty"`
+}
+
+// reactionsCursor names the state cursor holding the reactions of a synced
+// issue as JSON
+func reactionsCursor(key string) string {
+	return "reactions:" + key
+}
+
+// plusOnes returns the number of 👍 reactions of an issue
+func plusOnes(issue *github.Issue) int {
+	if issue.Reactions == nil {
+		return 0
+	}
+	return issue.Reactions.GetPlusOne()
+}
+
+// syncReactions writes the 👍 count of an issue to the configured Jira field
+// and raises the priority of its Jira issue once the count reaches the
+// threshold
+func syncReactions(ctx context.Context, repo config.RepoConfig, issue *github.Issue, m *state.Mapping) error {
+	rc := cfg().Jira.Reactions
+	if !rc.Enabled || m.JiraKey == "" {
+		return nil
+	}
+	var last reactions
+	if stored, err := store.GetCursor(ctx, reactionsCursor(m.Key)); err != nil {
+		return err
+	} else if stored != "" {
+		if err := json.Unmarshal([]byte(stored), &last); err != nil {
+			return fmt.Errorf("invalid reactions of %s: %w", m.Key, err)
+		}
+	}
+
+	now := reactions{PlusOnes: plusOnes(issue), Raised: last.Raised}
+	fields := make(map[string]interface{})
+	if rc.Field != "" && now.PlusOnes != last.PlusOnes {
+		fields[rc.Field] = now.PlusOnes
+	}
+	if rc.Threshold > 0 && !last.Raised && now.PlusOnes >= rc.Threshold {
+		fields["priority"] = map[string]string{"name": rc.Priority}
+		now.Raised = true
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	jc, err := jiraFor(m.JiraInstance)
+	if err != nil {
+		return err
+	}
+	if err := jc.UpdateIssue(ctx, m.JiraKey, fields); err != nil {
+		return fmt.Errorf("failed to update the reactions of %s: %w", m.JiraKey, err)
+	}
+	if now.Raised && !last.Raised {
+		log.Printf("GitHub issue #%d has %d 👍 reactions, raised %s to priority %s", issue.GetNumber(), now.PlusOnes, m.JiraKey, rc.Priority)
+	} else {
+		log.Printf("GitHub issue #%d has %d 👍 reactions, updated %s", issue.GetNumber(), now.PlusOnes, m.JiraKey)
+	}
+	e := jiraAudit("update_issue", m.JiraKey, map[string]interface{}{"fields": fieldNames(fields), "plus_ones": now.PlusOnes})
+	e.Repo, e.Issue = repo.FullName(), issue.GetNumber()
+	recordAudit(e)
+
+	data, _ := json.Marshal(now)
+	return store.SetCursor(ctx, reactionsCursor(m.Key), string(data))
+}
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/jira"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+// Kinds of drift found by reconcile
+const (
+	// driftUnsynced is an open GitHub issue without a Jira issue
+	driftUnsynced = "unsynced"
+	// driftJiraMissing is a mapping whose Jira issue no longer exists
+	driftJiraMissing = "jira_missing"
+	// driftJiraHidden is a mapping whose Jira issue can't be read because
+	// its project isn't visible to the Jira user, so whether it still
+	// exists is unknown
+	driftJiraHidden = "jira_not_visible"
+	// driftGitHubMissing is a mapping whose GitHub issue no longer exists
+	driftGitHubMissing = "github_missing"
+	// driftGitHubHidden is a mapping whose GitHub issue can't be read
+	// because its repository can't be read, so whether it still exists is
+	// unknown
+	driftGitHubHidden = "github_not_visible"
+	// driftUntracked is a Jira issue created for a GitHub issue but missing
+	// from the state store
+	driftUntracked = "untracked_jira"
+	// driftDuplicate is a Jira issue created for a GitHub issue that is
+	// mapped to another Jira issue
+	driftDuplicate = "duplicate_jira"
+)
+
+// importedFromPattern finds the GitHub issue in the description of a Jira
+// issue created by gh-jira
+var importedFromPattern = regexp.MustCompile(`Imported from GitHub: https?://[^/\s]+/([^/\s]+)/([^/\s]+)/issues/(\d+)`)
+
+// drift is a difference between GitHub, Jira and the state store
+type drift struct {
+	Kind    string `json:"kind"`
+	Repo    string `json:"repo,omitempty"`
+	Issue   int    `json:"issue,omitempty"`
+	Key     string `json:"key,omitempty"`
+	JiraKey string `json:"jira_key,omitempty"`
+	Detail  string `json:"detail"`
+	// Repaired is set when --repair fixed the drift
+	Repaired bool `json:"repaired"`
+	// RepairError is set when the repair failed
+	RepairError string `json:"repair_error,omitempty"`
+}
+
+// reconcileOptions are the repairs `reconcile` may make
+type reconcileOptions struct {
+	// Repair repairs the drift that can be repaired safely
+	Repair bool
+	// RecreateMissing removes the mappings of deleted Jira issues on
+	// repair, so the next poll creates them again
+	RecreateMissing bool
+	// DeleteOrphans confirms the orphan action delete on repair; without
+	// it the Jira issues of deleted GitHub issues are only reported
+	DeleteOrphans bool
+}
+
+// reconcileReport is the output of `reconcile`
+type reconcileReport struct {
+	CheckedMappings int     `json:"checked_mappings"`
+	CheckedIssues   int     `json:"checked_issues"`
+	CheckedJira     int     `json:"checked_jira"`
+	Drift           []drift `json:"drift"`
+}
+
+// runReconcileCommand implements `gh-jira reconcile`
+func runReconcileCommand(args []string) int {
+	fs := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("GH_JIRA_CONFIG"), "Path to an optional YAML configuration file")
+	jql := fs.String("jql", "", "JQL selecting the Jira issues created by gh-jira in every Jira instance (defaults to the configured projects)")
+	repair := fs.Bool("repair", false, "Repair the drift that can be repaired safely")
+	recreateMissing := fs.Bool("recreate-missing", false, "With --repair, remove the mappings of deleted Jira issues so the next poll recreates them")
+	deleteOrphans := fs.Bool("delete-orphans", false, "With --repair, confirm the orphan action delete on the Jira issues of deleted GitHub issues")
+	output := outputFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return exitFatal
+	}
+	if err := validOutput(*output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+
+	if _, err := setup(*configPath, 0, -1); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	opts := reconcileOptions{Repair: *repair, RecreateMissing: *recreateMissing, DeleteOrphans: *deleteOrphans}
+	report, err := reconcile(ctx, newGitHubClient(ctx), *jql, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	if err := writeOutput(os.Stdout, *output, report, report.writeTable); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	for _, d := range report.Drift {
+		if !d.Repaired {
+			return exitPartialFailure
+		}
+	}
+	return exitOK
+}
+
+// defaultReconcileJQL selects the issues created by gh-jira in the
+// configured projects of a Jira instance
+func defaultReconcileJQL(instance string) string {
+	conf := cfg()
+	inst, _ := conf.Jira.Instance(instance)
+	projects := []string{inst.ProjectKey}
+	// Routes without an instance keep the instance of the repository
+	usedByRepo := instance == ""
+	for _, r := range conf.GitHub.Repos {
+		usedByRepo = usedByRepo || r.Jira == instance
+	}
+	for _, r := range conf.Jira.Routes {
+		if r.Instance == instance || (r.Instance == "" && usedByRepo) {
+			if !slices.Contains(projects, r.ProjectKey) {
+				projects = append(projects, r.ProjectKey)
+			}
+		}
+	}
+	return fmt.Sprintf(`project in (%s) AND description ~ "\"Imported from GitHub\""`, strings.Join(projects, ", "))
+}
+
+// reconcile cross-checks the state store against GitHub and Jira. An empty
+// jql searches the configured projects of each Jira instance.
+func reconcile(ctx context.Context, client *github.Client, jql string, opts reconcileOptions) (*reconcileReport, error) {
+	report := &reconcileReport{Drift: []drift{}}
+	repos, err := repositories(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]config.RepoConfig, len(repos))
+	for _, r := range repos {
+		byName[r.FullName()] = r
+	}
+
+	mappings, err := store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byIssue := make(map[string]*state.Mapping)
+	readable := make(map[string]bool)
+	for _, m := range mappings {
+		if m.MergedInto != "" || m.JiraKey == "" {
+			continue
+		}
+		if !isDiscussion(m) && !fromSource(m.Repo) {
+			byIssue[fmt.Sprintf("%s#%d", m.Repo, m.IssueNumber)] = m
+		}
+		report.CheckedMappings++
+		if err := checkMapping(ctx, client, m, opts, readable, report); err != nil {
+			return nil, err
+		}
+	}
+
+	// Without automatic sync, open issues are only synced on request
+	if cfg().GitHub.AutoSync {
+		for _, repo := range repos {
+			if err := checkRepo(ctx, client, repo, opts.Repair, report); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, instance := range jiraInstanceNames() {
+		q := jql
+		if q == "" {
+			q = defaultReconcileJQL(instance)
+		}
+		if err := searchUntracked(ctx, client, instance, q, byName, byIssue, opts.Repair, report); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// searchUntracked reports the Jira issues of an instance that were created
+// by gh-jira but are missing from the state store or duplicate a mapping
+func searchUntracked(ctx context.Context, client *github.Client, instance, jql string, byName map[string]config.RepoConfig, byIssue map[string]*state.Mapping, repair bool, report *reconcileReport) error {
+	jc, err := jiraFor(instance)
+	if err != nil {
+		return err
+	}
+	if instance != "" {
+		log.Printf("Searching Jira instance %s for issues created by gh-jira: %s", instance, jql)
+	} else {
+		log.Printf("Searching Jira for issues created by gh-jira: %s", jql)
+	}
+	err = jc.Search(ctx, jql, []string{"summary", "description"}, func(ji *jira.Issue) error {
+		report.CheckedJira++
+		match := importedFromPattern.FindStringSubmatch(ji.Fields.Description)
+		if match == nil {
+			return nil
+		}
+		repoName := match[1] + "/" + match[2]
+		number, _ := strconv.Atoi(match[3])
+		m, ok := byIssue[fmt.Sprintf("%s#%d", repoName, number)]
+		switch {
+		case ok && m.JiraKey == ji.Key && m.JiraInstance == instance:
+			return nil
+		case ok:
+			report.Drift = append(report.Drift, drift{
+				Kind: driftDuplicate, Repo: repoName, Issue: number, Key: m.Key, JiraKey: ji.Key,
+				Detail: fmt.Sprintf("GitHub issue is synced to %s; close %s as duplicate", m.JiraKey, ji.Key),
+			})
+			return nil
+		}
+		d := drift{Kind: driftUntracked, Repo: repoName, Issue: number, JiraKey: ji.Key,
+			Detail: "Jira issue was created for the GitHub issue but is missing from the state store"}
+		if repo, ok := byName[repoName]; ok && repair {
+			key, aerr := adoptJiraIssue(ctx, client, repo, number, instance, ji.Key)
+			d.Key, d.Repaired = key, aerr == nil
+			if aerr != nil {
+				d.RepairError = aerr.Error()
+			}
+		}
+		report.Drift = append(report.Drift, d)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to search Jira: %w", err)
+	}
+	return nil
+}
+
+// checkMapping verifies that both sides of a mapping still exist. A mapping
+// whose Jira issue is gone is removed on repair with RecreateMissing, so the
+// next poll recreates it; a Jira issue that is only invisible to the Jira
+// user is reported and kept. The Jira issue of a GitHub issue that is gone
+// gets the configured orphan actions on repair, delete only with
+// DeleteOrphans. A GitHub issue is gone if GitHub answers 410, or 404 while
+// its repository can be read; readable caches the repositories checked. The
+// issues of sinks aren't checked.
+func checkMapping(ctx context.Context, client *github.Client, m *state.Mapping, opts reconcileOptions, readable map[string]bool, report *reconcileReport) error {
+	if isSink(m.JiraInstance) {
+		return nil
+	}
+	jc, err := jiraFor(m.JiraInstance)
+	if err != nil {
+		return fmt.Errorf("mapping %s: %w", m.Key, err)
+	}
+	if _, err := jc.GetIssue(ctx, m.JiraKey, []string{"summary"}); err != nil {
+		var jerr *jira.Error
+		if !errors.As(err, &jerr) || jerr.StatusCode != http.StatusNotFound {
+			return fmt.Errorf("failed to get Jira issue %s: %w", m.JiraKey, err)
+		}
+		// Jira answers 404 for issues the user may not browse as well
+		project, _, _ := strings.Cut(m.JiraKey, "-")
+		visible, err := projectVisible(ctx, jc, project)
+		if err != nil {
+			return fmt.Errorf("failed to check the permissions of project %s: %w", project, err)
+		}
+		if !visible {
+			report.Drift = append(report.Drift, drift{Kind: driftJiraHidden, Repo: m.Repo, Issue: m.IssueNumber, Key: m.Key, JiraKey: m.JiraKey,
+				Detail: fmt.Sprintf("the Jira user can't browse project %s; the mapping is kept", project)})
+			return nil
+		}
+		d := drift{Kind: driftJiraMissing, Repo: m.Repo, Issue: m.IssueNumber, Key: m.Key, JiraKey: m.JiraKey,
+			Detail: "Jira issue was deleted; repair with --recreate-missing removes the mapping so the next poll recreates it"}
+		if opts.Repair && opts.RecreateMissing {
+			err := store.Delete(ctx, m.Key)
+			d.Repaired = err == nil
+			if err != nil {
+				d.RepairError = err.Error()
+			}
+		}
+		report.Drift = append(report.Drift, d)
+		return nil
+	}
+
+	owner, name, ok := strings.Cut(m.Repo, "/")
+	if !ok || isDiscussion(m) || fromSource(m.Repo) {
+		return nil
+	}
+	if err := ghRateLimit.wait(ctx); err != nil {
+		return err
+	}
+	issue, resp, err := client.Issues.Get(ctx, owner, name, m.IssueNumber)
+	ghRateLimit.observe(resp, err)
+	reason := ""
+	if err != nil {
+		if resp == nil || (resp.StatusCode != http.StatusNotFound && resp.StatusCode != http.StatusGone) {
+			return fmt.Errorf("failed to get GitHub issue %s#%d: %w", m.Repo, m.IssueNumber, err)
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			// GitHub answers 404 for every issue of a repository the
+			// token lost access to as well
+			ok, known := readable[m.Repo]
+			if !known {
+				if ok, err = repoReadable(ctx, client, owner, name); err != nil {
+					return err
+				}
+				readable[m.Repo] = ok
+			}
+			if !ok {
+				report.Drift = append(report.Drift, drift{Kind: driftGitHubHidden, Repo: m.Repo, Issue: m.IssueNumber, Key: m.Key, JiraKey: m.JiraKey,
+					Detail: fmt.Sprintf("gh-jira can't read repository %s; the mapping is kept", m.Repo)})
+				return nil
+			}
+		}
+		// Issues transferred to repositories gh-jira can't read are
+		// missing just like deleted ones
+		reason = "deleted or transferred"
+	} else if to := transferredTo(m.Repo, issue); to != "" {
+		reason = "transferred to " + to
+	}
+	if reason == "" {
+		return nil
+	}
+
+	d := drift{Kind: driftGitHubMissing, Repo: m.Repo, Issue: m.IssueNumber, Key: m.Key, JiraKey: m.JiraKey,
+		Detail: fmt.Sprintf("GitHub issue was %s; review and close %s", reason, m.JiraKey)}
+	orphans := cfg().Jira.Orphans
+	if opts.Repair && orphans.Has(config.OrphanDelete) && !opts.DeleteOrphans {
+		d.Detail = fmt.Sprintf("GitHub issue was %s; repair with --delete-orphans deletes %s", reason, m.JiraKey)
+	} else if opts.Repair && len(orphans.Actions) > 0 {
+		taken, err := handleOrphan(ctx, m, reason)
+		d.Repaired = err == nil
+		if err != nil {
+			d.RepairError = err.Error()
+		}
+		if len(taken) > 0 {
+			d.Detail = fmt.Sprintf("GitHub issue was %s; Jira issue handled: %s", reason, strings.Join(taken, ", "))
+		}
+	}
+	report.Drift = append(report.Drift, d)
+	return nil
+}
+
+// projectVisible reports whether the Jira user may browse a project. A
+// project that doesn't exist isn't visible either.
+func projectVisible(ctx context.Context, jc *jira.Client, project string) (bool, error) {
+	have, err := jc.MyPermissions(ctx, project, "BROWSE_PROJECTS")
+	var jerr *jira.Error
+	if errors.As(err, &jerr) && jerr.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return have["BROWSE_PROJECTS"], nil
+}
+
+// repoReadable reports whether the GitHub token can read a repository
+func repoReadable(ctx context.Context, client *github.Client, owner, name string) (bool, error) {
+	if err := ghRateLimit.wait(ctx); err != nil {
+		return false, err
+	}
+	_, resp, err := client.Repositories.Get(ctx, owner, name)
+	ghRateLimit.observe(resp, err)
+	if err != nil {
+		if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get repository %s/%s: %w", owner, name, err)
+	}
+	return true, nil
+}
+
+// checkRepo reports open issues that should have been synced but weren't.
+// Repair adds the force label so the next poll syncs them.
+func checkRepo(ctx context.Context, client *github.Client, repo config.RepoConfig, repair bool, report *reconcileReport) error {
+	conf := cfg()
+	opt := &github.IssueListByRepoOptions{State: "open", ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		if err := ghRateLimit.wait(ctx); err != nil {
+			return err
+		}
+		issues, resp, err := client.Issues.ListByRepo(ctx, repo.Owner, repo.Name, opt)
+		ghRateLimit.observe(resp, err)
+		if err != nil {
+			return fmt.Errorf("failed to list issues of %s: %w", repo.FullName(), err)
+		}
+
+		for _, issue := range issues {
+			if issue.IsPullRequest() || (conf.GitHub.SkipLabel != "" && hasLabel(issue, conf.GitHub.SkipLabel)) {
+				continue
+			}
+			report.CheckedIssues++
+			key, err := issueKey(repo, issue)
+			if err != nil {
+				return err
+			}
+			if _, err := lookupMapping(ctx, key); err == nil {
+				continue
+			} else if !errors.Is(err, state.ErrNotFound) {
+				return err
+			}
+			if filteredOut(repo, issue) != "" {
+				continue
+			}
+			if conf.Approval.Required {
+				if a, err := findApproval(ctx, key); err != nil {
+					return err
+				} else if a != nil {
+					continue
+				}
+			}
+
+			d := drift{Kind: driftUnsynced, Repo: repo.FullName(), Issue: issue.GetNumber(), Key: key,
+				Detail: "open GitHub issue has no Jira issue"}
+			if repair && conf.GitHub.ForceLabel != "" && !hasLabel(issue, conf.GitHub.ForceLabel) {
+				if err := ghRateLimit.wait(ctx); err != nil {
+					return err
+				}
+				_, resp, err := client.Issues.AddLabelsToIssue(ctx, repo.Owner, repo.Name, issue.GetNumber(), []string{conf.GitHub.ForceLabel})
+				ghRateLimit.observe(resp, err)
+				d.Repaired = err == nil
+				if err != nil {
+					d.RepairError = err.Error()
+				} else {
+					recordAudit(githubAudit("add_label", repo, issue.GetNumber(), map[string]interface{}{"label": conf.GitHub.ForceLabel}))
+					d.Detail += fmt.Sprintf("; labelled %s for the next poll", conf.GitHub.ForceLabel)
+				}
+			}
+			report.Drift = append(report.Drift, d)
+		}
+
+		if resp.NextPage == 0 {
+			return nil
+		}
+		opt.ListOptions.Page = resp.NextPage
+	}
+}
+
+// adoptJiraIssue records the mapping of a Jira issue that was created for
+// a GitHub issue but is missing from the state store
+func adoptJiraIssue(ctx context.Context, client *github.Client, repo config.RepoConfig, number int, instance, jiraKey string) (string, error) {
+	if err := ghRateLimit.wait(ctx); err != nil {
+		return "", err
+	}
+	issue, resp, err := client.Issues.Get(ctx, repo.Owner, repo.Name, number)
+	ghRateLimit.observe(resp, err)
+	if err != nil {
+		return "", err
+	}
+	key, err := issueKey(repo, issue)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	log.Printf("Adopting Jira issue %s for GitHub issue %s#%d", jiraKey, repo.FullName(), number)
+	return key, store.Put(ctx, &state.Mapping{
+		Key:          key,
+		Namespace:    repo.NamespaceName(),
+		Repo:         repo.FullName(),
+		IssueNumber:  number,
+		IssueID:      issue.GetID(),
+		NodeID:       issue.GetNodeID(),
+		JiraKey:      jiraKey,
+		JiraInstance: instance,
+		SyncStatus:   state.StatusSynced,
+		BodyHash:     bodyHash(issue),
+		LastSyncedAt: now,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	})
+}
+
+// writeTable renders the reconcile report for humans
+func (r *reconcileReport) writeTable(out io.Writer) error {
+	fmt.Fprintf(out, "Checked %d mappings, %d open GitHub issues and %d Jira issues\n", r.CheckedMappings, r.CheckedIssues, r.CheckedJira)
+	if len(r.Drift) == 0 {
+		fmt.Fprintln(out, "No drift found")
+		return nil
+	}
+	fmt.Fprintln(out)
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tISSUE\tJIRA\tREPAIRED\tDETAIL")
+	for _, d := range r.Drift {
+		repaired := "no"
+		if d.Repaired {
+			repaired = "yes"
+		} else if d.RepairError != "" {
+			repaired = "failed: " + d.RepairError
+		}
+		fmt.Fprintf(w, "%s\t%s#%d\t%s\t%s\t%s\n", d.Kind, d.Repo, d.Issue, d.JiraKey, repaired, d.Detail)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/state"
+	"github.com/savitaashture/gh-jira/pkg/summarizer"
+)
+
+// summaryState is when the summary of a synced issue was last generated
+type summaryState struct {
+	// Comments is the number of comments the issue had at the time
+	Comments int       `json:"comments"`
+	At       time.Time `json:"at"`
+}
+
+// summaryStateCursor names the state cursor holding the summary state of a
+// synced issue as JSON
+func summaryStateCursor(key string) string {
+	return "summary:" + key
+}
+
+// recordSummaryRefresh stores that the summary of a synced issue was just
+// regenerated. Failures are only logged as they merely delay the next
+// refresh.
+func recordSummaryRefresh(ctx context.Context, m *state.Mapping, issue *github.Issue) {
+	data, _ := json.Marshal(summaryState{Comments: issue.GetComments(), At: time.Now().UTC()})
+	if err := store.SetCursor(ctx, summaryStateCursor(m.Key), string(data)); err != nil {
+		log.Printf("Failed to record the summary refresh of %s: %v", m.Key, err)
+	}
+}
+
+// staleSummary returns why the summary described by last is stale given the
+// issue's comments now, or "" if it isn't
+func staleSummary(rc config.RefreshConfig, last summaryState, comments int, now time.Time) string {
+	added := comments - last.Comments
+	switch {
+	case added <= 0:
+		return ""
+	case rc.NewComments > 0 && added >= rc.NewComments:
+		return fmt.Sprintf("%d comments were added since", added)
+	case rc.MaxAge > 0 && now.Sub(last.At) >= rc.MaxAge:
+		return fmt.Sprintf("it is %s old and %d comments were added since", now.Sub(last.At).Round(time.Hour), added)
+	}
+	return ""
+}
+
+// refreshSummary regenerates the summary of a synced issue from its
+// description and recent comments once enough discussion accumulated
+// since the last summary, and updates the Jira description. Issues synced
+// before refreshes were enabled start counting from the comments they have
+// when first seen.
+func refreshSummary(ctx context.Context, client *github.Client, repo config.RepoConfig, issue *github.Issue, m *state.Mapping, sum *summarizer.Summarizer) error {
+	conf := cfg()
+	rc := conf.Summarizer.Refresh
+	if !rc.Enabled() || m.JiraKey == "" {
+		return nil
+	}
+	stored, err := store.GetCursor(ctx, summaryStateCursor(m.Key))
+	if err != nil {
+		return err
+	}
+	if stored == "" {
+		data, _ := json.Marshal(summaryState{Comments: issue.GetComments(), At: m.LastSyncedAt})
+		return store.SetCursor(ctx, summaryStateCursor(m.Key), string(data))
+	}
+	var last summaryState
+	if err := json.Unmarshal([]byte(stored), &last); err != nil {
+		return fmt.Errorf("invalid summary state of %s: %w", m.Key, err)
+	}
+	why := staleSummary(rc, last, issue.GetComments(), time.Now())
+	if why == "" {
+		return nil
+	}
+
+	comments, err := listComments(ctx, client, repo, issue.GetNumber())
+	if err != nil {
+		return err
+	}
+	if n := conf.Summarizer.Discussion.MaxComments; len(comments) > n {
+		comments = comments[len(comments)-n:]
+	}
+	log.Printf("Refreshing the summary of GitHub issue #%d as %s", issue.GetNumber(), why)
+	return resyncIssue(ctx, client, repo, issue, m, sum, comments)
+}
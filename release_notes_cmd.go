@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/audit"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/summarizer"
+)
+
+// releasePR is a merged pull request included in release notes
+type releasePR struct {
+	Number int      `json:"number"`
+	Title  string   `json:"title"`
+	Author string   `json:"author,omitempty"`
+	Labels []string `json:"labels,omitempty"`
+	URL    string   `json:"url"`
+	// Body is the description of the pull request, only sent to the model
+	Body string `json:"-"`
+}
+
+// releaseNotes is the output of `release-notes`
+type releaseNotes struct {
+	Repo         string      `json:"repo"`
+	Range        string      `json:"range,omitempty"`
+	Milestone    string      `json:"milestone,omitempty"`
+	PullRequests []releasePR `json:"pull_requests"`
+	Notes        string      `json:"notes"`
+	// GitHubRelease is the URL of the created draft release
+	GitHubRelease string `json:"github_release,omitempty"`
+	// JiraVersion is the Jira version whose description was set
+	JiraVersion string `json:"jira_version,omitempty"`
+}
+
+// releaseBodyLimit caps the description of each pull request sent to the
+// model so that large templates don't crowd out the other changes
+const releaseBodyLimit = 1000
+
+// runReleaseNotesCommand implements `gh-jira release-notes`
+func runReleaseNotesCommand(args []string) int {
+	fs := flag.NewFlagSet("release-notes", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("GH_JIRA_CONFIG"), "Path to an optional YAML configuration file")
+	repoName := fs.String("repo", "", "Repository as owner/name (defaults to the only configured repository)")
+	milestone := fs.String("milestone", "", "Collect the pull requests of this milestone instead of a tag range")
+	githubRelease := fs.Bool("github-release", false, "Publish the notes as a draft GitHub release")
+	tag := fs.String("tag", "", "Tag of the GitHub release (defaults to the end of the tag range)")
+	jiraVersion := fs.String("jira-version", "", "Set the notes as the description of this Jira version")
+	jiraProject := fs.String("jira-project", "", "Project of --jira-version (defaults to the project of the repository)")
+	output := outputFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: gh-jira release-notes [flags] FROM..TO\n")
+		fmt.Fprintf(os.Stderr, "       gh-jira release-notes [flags] --milestone NAME\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitFatal
+	}
+	if err := validOutput(*output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+
+	var from, to string
+	switch {
+	case *milestone != "" && fs.NArg() == 0:
+	case *milestone == "" && fs.NArg() == 1:
+		var ok bool
+		from, to, ok = strings.Cut(fs.Arg(0), "..")
+		if !ok || from == "" || to == "" {
+			fmt.Fprintf(os.Stderr, "Error: invalid tag range %q, expected FROM..TO\n", fs.Arg(0))
+			return exitFatal
+		}
+		if *tag == "" {
+			*tag = to
+		}
+	default:
+		fs.Usage()
+		return exitFatal
+	}
+	if *githubRelease && *tag == "" {
+		fmt.Fprintf(os.Stderr, "Error: --github-release with --milestone requires --tag\n")
+		return exitFatal
+	}
+
+	sum, err := setup(*configPath, 0, -1)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	defer store.Close()
+	repo, err := selectRepo(*repoName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+
+	ctx := context.Background()
+	client := newGitHubClient(ctx)
+	notes := &releaseNotes{Repo: repo.FullName(), Milestone: *milestone}
+	if *milestone != "" {
+		notes.PullRequests, err = milestonePullRequests(ctx, client, repo, *milestone)
+	} else {
+		notes.Range = from + ".." + to
+		notes.PullRequests, err = rangePullRequests(ctx, client, repo, from, to)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	if len(notes.PullRequests) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no merged pull requests found\n")
+		return exitFatal
+	}
+
+	if notes.Notes, err = generateReleaseNotes(ctx, sum, notes.PullRequests); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+
+	code := exitOK
+	if *githubRelease {
+		if notes.GitHubRelease, err = createDraftRelease(ctx, client, repo, *tag, notes.Notes); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			code = exitPartialFailure
+		}
+	}
+	if *jiraVersion != "" {
+		if *jiraProject == "" {
+			inst, _ := cfg().Jira.Instance(repo.Jira)
+			*jiraProject = inst.ProjectKey
+		}
+		if err := describeJiraVersion(ctx, repo.Jira, *jiraProject, *jiraVersion, notes.Notes); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			code = exitPartialFailure
+		} else {
+			notes.JiraVersion = *jiraProject + "/" + *jiraVersion
+		}
+	}
+
+	if err := writeOutput(os.Stdout, *output, notes, notes.writeTable); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	return code
+}
+
+// rangePullRequests returns the pull requests whose merge commits are
+// between the tags from and to
+func rangePullRequests(ctx context.Context, client *github.Client, repo config.RepoConfig, from, to string) ([]releasePR, error) {
+	if err := ghRateLimit.wait(ctx); err != nil {
+		return nil, err
+	}
+	cmp, resp, err := client.Repositories.CompareCommits(ctx, repo.Owner, repo.Name, from, to, nil)
+	ghRateLimit.observe(resp, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare %s..%s: %w", from, to, err)
+	}
+	if cmp.GetTotalCommits() > len(cmp.Commits) {
+		log.Printf("Warning: %s..%s has %d commits, only the first %d are considered", from, to, cmp.GetTotalCommits(), len(cmp.Commits))
+	}
+	shas := make(map[string]bool, len(cmp.Commits))
+	for _, c := range cmp.Commits {
+		shas[c.GetSHA()] = true
+	}
+	since := cmp.GetMergeBaseCommit().GetCommit().GetCommitter().GetDate()
+	log.Printf("Looking up the pull requests of %d commits in %s..%s", len(shas), from, to)
+
+	// Pull requests are listed by their last update, so those updated before
+	// the merge base can't have been merged in the range
+	var prs []releasePR
+	opt := &github.PullRequestListOptions{State: "closed", Sort: "updated", Direction: "desc", ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		if err := ghRateLimit.wait(ctx); err != nil {
+			return nil, err
+		}
+		page, resp, err := client.PullRequests.List(ctx, repo.Owner, repo.Name, opt)
+		ghRateLimit.observe(resp, err)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pull requests of %s: %w", repo.FullName(), err)
+		}
+		for _, pr := range page {
+			if pr.GetUpdatedAt().Before(since.Time) {
+				return sortReleasePRs(prs), nil
+			}
+			if pr.MergedAt == nil || !shas[pr.GetMergeCommitSHA()] {
+				continue
+			}
+			labels := make([]string, 0, len(pr.Labels))
+			for _, l := range pr.Labels {
+				labels = append(labels, l.GetName())
+			}
+			prs = append(prs, releasePR{
+				Number: pr.GetNumber(),
+				Title:  pr.GetTitle(),
+				Author: pr.GetUser().GetLogin(),
+				Labels: labels,
+				URL:    pr.GetHTMLURL(),
+				Body:   pr.GetBody(),
+			})
+		}
+		if resp.NextPage == 0 {
+			return sortReleasePRs(prs), nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// milestonePullRequests returns the merged pull requests of a milestone
+func milestonePullRequests(ctx context.Context, client *github.Client, repo config.RepoConfig, milestone string) ([]releasePR, error) {
+	query := fmt.Sprintf("repo:%s is:pr is:merged milestone:%q", repo.FullName(), milestone)
+	log.Printf("Searching pull requests: %s", query)
+	var prs []releasePR
+	opt := &github.SearchOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		if err := ghRateLimit.wait(ctx); err != nil {
+			return nil, err
+		}
+		result, resp, err := client.Search.Issues(ctx, query, opt)
+		ghRateLimit.observe(resp, err)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search the pull requests of milestone %q: %w", milestone, err)
+		}
+		for _, issue := range result.Issues {
+			labels := make([]string, 0, len(issue.Labels))
+			for _, l := range issue.Labels {
+				labels = append(labels, l.GetName())
+			}
+			prs = append(prs, releasePR{
+				Number: issue.GetNumber(),
+				Title:  issue.GetTitle(),
+				Author: issue.GetUser().GetLogin(),
+				Labels: labels,
+				URL:    issue.GetHTMLURL(),
+				Body:   issue.GetBody(),
+			})
+		}
+		if resp.NextPage == 0 {
+			return sortReleasePRs(prs), nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// sortReleasePRs orders pull requests by number
+func sortReleasePRs(prs []releasePR) []releasePR {
+	sort.Slice(prs, func(i, j int) bool { return prs[i].Number < prs[j].Number })
+	return prs
+}
+
+// generateReleaseNotes summarizes the pull requests into release notes
+func generateReleaseNotes(ctx context.Context, sum *summarizer.Summarizer, prs []releasePR) (string, error) {
+	var b strings.Builder
+	for _, pr := range prs {
+		fmt.Fprintf(&b, "#%d %s\n", pr.Number, pr.Title)
+		if len(pr.Labels) > 0 {
+			fmt.Fprintf(&b, "Labels: %s\n", strings.Join(pr.Labels, ", "))
+		}
+		body := strings.TrimSpace(pr.Body)
+		if len(body) > releaseBodyLimit {
+			body = body[:releaseBodyLimit] + "..."
+		}
+		if body != "" {
+			fmt.Fprintf(&b, "%s\n", body)
+		}
+		b.WriteString("\n")
+	}
+
+	log.Printf("Generating release notes for %d pull requests", len(prs))
+	notes, err := sum.GenerateReleaseNotes(ctx, b.String())
+	if err != nil {
+		return "", fmt.Errorf("failed to generate release notes: %w", err)
+	}
+	return strings.TrimSpace(notes), nil
+}
+
+// createDraftRelease creates a draft GitHub release for tag and returns its URL
+func createDraftRelease(ctx context.Context, client *github.Client, repo config.RepoConfig, tag, notes string) (string, error) {
+	if err := ghRateLimit.wait(ctx); err != nil {
+		return "", err
+	}
+	release, resp, err := client.Repositories.CreateRelease(ctx, repo.Owner, repo.Name, &github.RepositoryRelease{
+		TagName: github.Ptr(tag),
+		Name:    github.Ptr(tag),
+		Body:    github.Ptr(notes),
+		Draft:   github.Ptr(true),
+	})
+	ghRateLimit.observe(resp, err)
+	if err != nil {
+		return "", fmt.Errorf("failed to create draft release %s of %s: %w", tag, repo.FullName(), err)
+	}
+	log.Printf("Created draft release %s of %s", tag, repo.FullName())
+	recordAudit(audit.Entry{
+		System:  audit.SystemGitHub,
+		Action:  "create_release",
+		Target:  repo.FullName() + "@" + tag,
+		Repo:    repo.FullName(),
+		Details: map[string]interface{}{"draft": true, "url": release.GetHTMLURL()},
+	})
+	return release.GetHTMLURL(), nil
+}
+
+// describeJiraVersion sets the description of the named version of a
+// project of a Jira instance
+func describeJiraVersion(ctx context.Context, instance, project, name, notes string) error {
+	jc, err := jiraFor(instance)
+	if err != nil {
+		return err
+	}
+	versions, err := jc.ProjectVersions(ctx, project)
+	if err != nil {
+		return fmt.Errorf("failed to list the versions of Jira project %s: %w", project, err)
+	}
+	for _, v := range versions {
+		if v.Name != name {
+			continue
+		}
+		if err := jc.UpdateVersion(ctx, v.ID, map[string]interface{}{"description": notes}); err != nil {
+			return fmt.Errorf("failed to update Jira version %s: %w", name, err)
+		}
+		log.Printf("Set the description of Jira version %s of %s", name, project)
+		recordAudit(audit.Entry{
+			System:  audit.SystemJira,
+			Action:  "update_version",
+			Target:  project + "/" + name,
+			Details: map[string]interface{}{"fields": []string{"description"}},
+		})
+		return nil
+	}
+	return fmt.Errorf("Jira project %s has no version %q", project, name)
+}
+
+// writeTable prints the notes followed by where they were published
+func (n *releaseNotes) writeTable(w io.Writer) error {
+	fmt.Fprintf(w, "%s\n", n.Notes)
+	if n.GitHubRelease != "" || n.JiraVersion != "" {
+		fmt.Fprintln(w)
+	}
+	if n.GitHubRelease != "" {
+		fmt.Fprintf(w, "Draft GitHub release: %s\n", n.GitHubRelease)
+	}
+	if n.JiraVersion != "" {
+		fmt.Fprintf(w, "Jira version: %s\n", n.JiraVersion)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/audit"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/summarizer"
+)
+
+// releasesPerPoll is the number of most recent releases each poll looks at
+const releasesPerPoll = 20
+
+// releasesCursor names the state cursor holding the time from which the
+// releases of a repository are watched
+func releasesCursor(repo config.RepoConfig) string {
+	return "releases:" + repo.FullName()
+}
+
+// releaseCursor names the state cursor recording that the Jira version of
+// a release was handled
+func releaseCursor(repo config.RepoConfig, r *github.RepositoryRelease) string {
+	return fmt.Sprintf("release:%s#%d", repo.FullName(), r.GetID())
+}
+
+// syncReleases releases the Jira versions of the GitHub releases of a
+// repository published since the last poll. Releases published before the
+// repository was first polled are left alone.
+func syncReleases(ctx context.Context, client *github.Client, repo config.RepoConfig, sum *summarizer.Summarizer, result *cycleResult) error {
+	cursor := releasesCursor(repo)
+	stored, err := store.GetCursor(ctx, cursor)
+	if err != nil {
+		return err
+	}
+	if stored == "" {
+		log.Printf("Watching the releases of %s from now on", repo.FullName())
+		return store.SetCursor(ctx, cursor, time.Now().UTC().Format(time.RFC3339))
+	}
+	since, err := time.Parse(time.RFC3339, stored)
+	if err != nil {
+		return fmt.Errorf("invalid releases cursor of %s: %w", repo.FullName(), err)
+	}
+
+	if err := ghRateLimit.wait(ctx); err != nil {
+		return err
+	}
+	releases, resp, err := client.Repositories.ListReleases(ctx, repo.Owner, repo.Name, &github.ListOptions{PerPage: releasesPerPoll})
+	ghRateLimit.observe(resp, err)
+	if err != nil {
+		log.Printf("Error fetching releases of %s: %v", repo.FullName(), err)
+		if isAuthError(err) {
+			return fmt.Errorf("GitHub authentication failed: %w", err)
+		}
+		result.fail(repo.FullName(), 0, "releases", err)
+		return nil
+	}
+	published := releases[:0]
+	for _, r := range releases {
+		if !r.GetDraft() && r.PublishedAt != nil {
+			published = append(published, r)
+		}
+	}
+	sort.Slice(published, func(i, j int) bool { return published[i].GetPublishedAt().Before(published[j].GetPublishedAt().Time) })
+
+	for i, r := range published {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if r.GetPublishedAt().Before(since) {
+			continue
+		}
+		if done, err := store.GetCursor(ctx, releaseCursor(repo, r)); err != nil {
+			return err
+		} else if done != "" {
+			continue
+		}
+		var previous *github.RepositoryRelease
+		if i > 0 {
+			previous = published[i-1]
+		}
+		if err := releaseJiraVersion(ctx, client, repo, r, previous, sum); err != nil {
+			log.Printf("Failed to release the Jira version of release %s of %s: %v", r.GetTagName(), repo.FullName(), err)
+			// Attempted again on the next poll
+			result.fail(repo.FullName(), 0, "release", err)
+			continue
+		}
+		if err := store.SetCursor(ctx, releaseCursor(repo, r), r.GetTagName()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseJiraVersion marks the Jira version of a GitHub release as released
+// on its publication date and, if enabled, describes it with release notes
+// of the pull requests merged since the previous release
+func releaseJiraVersion(ctx context.Context, client *github.Client, repo config.RepoConfig, r, previous *github.RepositoryRelease, sum *summarizer.Summarizer) error {
+	conf := cfg()
+	name := conf.Jira.Releases.VersionName(r.GetTagName())
+	inst, _ := conf.Jira.Instance(repo.Jira)
+	project := inst.ProjectKey
+	jc, err := jiraFor(repo.Jira)
+	if err != nil {
+		return err
+	}
+	versions, err := jc.ProjectVersions(ctx, project)
+	if err != nil {
+		return fmt.Errorf("failed to list the versions of Jira project %s: %w", project, err)
+	}
+	var id string
+	for _, v := range versions {
+		if v.Name != name {
+			continue
+		}
+		if v.Released {
+			log.Printf("Jira version %s of %s is already released", name, project)
+			return nil
+		}
+		id = v.ID
+	}
+	if id == "" {
+		log.Printf("Jira project %s has no version %q for release %s of %s, skipping it", project, name, r.GetTagName(), repo.FullName())
+		return nil
+	}
+
+	fields := map[string]interface{}{
+		"released":    true,
+		"releaseDate": r.GetPublishedAt().Format("2006-01-02"),
+	}
+	if conf.Jira.Releases.Notes {
+		if notes := releaseVersionNotes(ctx, client, repo, r, previous, sum); notes != "" {
+			fields["description"] = notes
+		}
+	}
+	if err := jc.UpdateVersion(ctx, id, fields); err != nil {
+		return fmt.Errorf("failed to release Jira version %s: %w", name, err)
+	}
+	log.Printf("Released Jira version %s of %s for GitHub release %s", name, project, r.GetTagName())
+	recordAudit(audit.Entry{
+		System:  audit.SystemJira,
+		Action:  "release_version",
+		Target:  project + "/" + name,
+		Repo:    repo.FullName(),
+		Details: map[string]interface{}{"fields": fieldNames(fields), "release": r.GetHTMLURL()},
+	})
+	return nil
+}
+
+// releaseVersionNotes generates the release notes of the pull requests
+// merged between the previous release and r. Without a previous release or
+// pull requests, or if generation fails, the body of the release is used.
+func releaseVersionNotes(ctx context.Context, client *github.Client, repo config.RepoConfig, r, previous *github.RepositoryRelease, sum *summarizer.Summarizer) string {
+	if previous == nil {
+		return r.GetBody()
+	}
+	prs, err := rangePullRequests(ctx, client, repo, previous.GetTagName(), r.GetTagName())
+	if err != nil {
+		log.Printf("Failed to collect the pull requests of release %s of %s: %v", r.GetTagName(), repo.FullName(), err)
+		return r.GetBody()
+	}
+	if len(prs) == 0 {
+		return r.GetBody()
+	}
+	notes, err := generateReleaseNotes(ctx, sum, prs)
+	if err != nil {
+		log.Printf("Failed to generate the release notes of %s of %s: %v", r.GetTagName(), repo.FullName(), err)
+		return r.GetBody()
+	}
+	return notes
+}
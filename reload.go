@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/httpclient"
+	"github.com/savitaashture/gh-jira/pkg/idmap"
+)
+
+// reloadDebounce is how long the configuration file must be left alone
+// before a change reloads it, so that editors writing it in several steps
+// trigger a single reload
+const reloadDebounce = time.Second
+
+// configReloader reloads the configuration the daemon was started with on
+// SIGHUP or when the configuration file changes
+type configReloader struct {
+	path     string
+	interval time.Duration
+	jitter   float64
+	// requests holds a pending reload, with its reason
+	requests chan string
+}
+
+// reloader is the configReloader of the daemon, nil for one-shot runs and
+// subcommands
+var reloader *configReloader
+
+// newConfigReloader returns a reloader applying the -interval and -jitter
+// flags like setup
+func newConfigReloader(path string, interval time.Duration, jitter float64) *configReloader {
+	return &configReloader{path: path, interval: interval, jitter: jitter, requests: make(chan string, 1)}
+}
+
+// request asks the poll loop to reload the configuration. Requests made
+// while one is pending are merged into it.
+func (r *configReloader) request(reason string) {
+	select {
+	case r.requests <- reason:
+	default:
+	}
+}
+
+// pending returns the channel of reload requests, or nil, which never
+// receives, without a reloader
+func (r *configReloader) pending() <-chan string {
+	if r == nil {
+		return nil
+	}
+	return r.requests
+}
+
+// watch requests reloads on SIGHUP and on changes of the configuration file
+func (r *configReloader) watch() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for sig := range signals {
+			r.request("received " + sig.String())
+		}
+	}()
+	if r.path == "" {
+		return
+	}
+	if err := r.watchFile(); err != nil {
+		log.Printf("Not watching the configuration file for changes, reload with SIGHUP: %v", err)
+	}
+}
+
+// watchFile requests a reload when the configuration file is written,
+// replaced or, as Kubernetes does with mounted ConfigMaps, swapped through
+// a symlink. The directory is watched since editors and ConfigMap updates
+// replace the file rather than write it.
+func (r *configReloader) watchFile() error {
+	path, err := filepath.Abs(r.path)
+	if err != nil {
+		return err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return err
+	}
+	log.Printf("Watching %s for configuration changes", path)
+
+	go func() {
+		defer watcher.Close()
+		target, _ := filepath.EvalSymlinks(path)
+		var debounce <-chan time.Time
+		for {
+			select {
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if ev.Has(fsnotify.Chmod) {
+					continue
+				}
+				// A new symlink target is the only sign of a ConfigMap
+				// update; the events are about its data directory
+				current, _ := filepath.EvalSymlinks(path)
+				if filepath.Clean(ev.Name) != path && current == target {
+					continue
+				}
+				target = current
+				debounce = time.After(reloadDebounce)
+			case <-debounce:
+				debounce = nil
+				r.request("configuration file changed")
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("Error watching the configuration file: %v", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// reload loads the configuration again and applies the settings that can
+// change while the daemon runs: the poll interval, jitter and back-off, the
+// Jira routes and templates, the watched repositories with their prompts,
+// templates, issue types and filters, the GitHub filter, the field-mapping
+// rules and the HTTP debug logging. The other settings take effect after a
+// restart. Nothing changes if the new configuration is invalid. The new
+// settings are published at once, so syncs and requests running meanwhile
+// keep the settings they started with.
+func (r *configReloader) reload(reason string) error {
+	log.Printf("Reloading the configuration: %s", reason)
+	next, err := config.Load(r.path)
+	if err != nil {
+		return err
+	}
+	if r.interval > 0 {
+		next.Poll.Interval = r.interval
+	}
+	if r.jitter >= 0 {
+		next.Poll.Jitter = r.jitter
+	}
+	secretsCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := next.ResolveSecrets(secretsCtx); err != nil {
+		return err
+	}
+	if err := next.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	merged := *cfg()
+	merged.Poll.Interval = next.Poll.Interval
+	merged.Poll.Jitter = next.Poll.Jitter
+	merged.Poll.Adaptive = next.Poll.Adaptive
+	merged.Jira.Routes = next.Jira.Routes
+	merged.Jira.SummaryTemplate = next.Jira.SummaryTemplate
+	merged.Jira.DescriptionTemplate = next.Jira.DescriptionTemplate
+	merged.GitHub.Repos = next.GitHub.Repos
+	merged.GitHub.Filter = next.GitHub.Filter
+	merged.RulesFile = next.RulesFile
+	merged.HTTP.Debug = next.HTTP.Debug
+	// The routes and repositories must fit the settings kept
+	if err := merged.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	for _, repo := range merged.GitHub.WatchedRepos() {
+		if _, err := idmap.Lookup(merged.GitHub.IDStrategy(repo.NamespaceName())); err != nil {
+			return fmt.Errorf("invalid configuration: %w", err)
+		}
+	}
+	s, err := loadSettings(&merged)
+	if err != nil {
+		return err
+	}
+	active.Store(s)
+	httpclient.SetDebug(merged.HTTP.Debug)
+
+	log.Printf("Reloaded the configuration: poll interval %s (jitter %.0f%%), %d Jira routes, %d repositories",
+		merged.Poll.Interval, merged.Poll.Jitter*100, len(merged.Jira.Routes), len(merged.GitHub.WatchedRepos()))
+	if !reflect.DeepEqual(&merged, next) {
+		log.Printf("Warning: the configuration has other changes, which take effect after a restart")
+	}
+	return nil
+}
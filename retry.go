@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/hooks"
+	"github.com/savitaashture/gh-jira/pkg/notify"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+// newRetry prepares the retry entry of a Jira creation; it is only stored
+// once the creation fails
+func newRetry(repo config.RepoConfig, issue *github.Issue, key, summary string, fields map[string]interface{}, warnings []string) *state.Retry {
+	now := time.Now().UTC()
+	return &state.Retry{
+		Key:         key,
+		Repo:        repo.FullName(),
+		IssueNumber: issue.GetNumber(),
+		Title:       issue.GetTitle(),
+		Summary:     summary,
+		JiraFields:  fields,
+		Warnings:    warnings,
+		Status:      state.RetryPending,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+}
+
+// createWithRetry creates the Jira issue from the payload of r with
+// attemptCreate and completes its sync
+func createWithRetry(ctx context.Context, client *github.Client, repo config.RepoConfig, issue *github.Issue, r *state.Retry) (*state.Mapping, error) {
+	mapping, err := attemptCreate(ctx, repo, issue, r)
+	if err != nil {
+		return nil, err
+	}
+	return mapping, publishSync(ctx, client, repo, issue, mapping, r.Warnings)
+}
+
+// attemptCreate creates the Jira issue from the payload of r and records its
+// mapping. A failed creation is queued for retry with backoff and a
+// successful one removes r from the queue.
+func attemptCreate(ctx context.Context, repo config.RepoConfig, issue *github.Issue, r *state.Retry) (*state.Mapping, error) {
+	mapping, err := createFromPayload(ctx, repo, issue, r.Key, r.Summary, r.JiraFields)
+	if err == nil {
+		retrySucceeded(ctx, r)
+		return mapping, nil
+	}
+	retryFailed(ctx, issue, r, err)
+	return nil, err
+}
+
+// retrySucceeded removes r from the retry queue once its Jira issue was
+// created
+func retrySucceeded(ctx context.Context, r *state.Retry) {
+	if r.Attempts == 0 {
+		return
+	}
+	log.Printf("GitHub issue #%d synced after %d failed attempts", r.IssueNumber, r.Attempts)
+	if err := store.DeleteRetry(ctx, r.Key); err != nil {
+		log.Printf("Failed to remove retry of %s: %v", r.Key, err)
+	}
+}
+
+// retryFailed queues r for retry after a failed creation, unless the error
+// stops the sync altogether or a hook vetoed it. When r ran out of attempts
+// it notifies and marks the GitHub issue as a dead letter.
+func retryFailed(ctx context.Context, issue *github.Issue, r *state.Retry, err error) {
+	var fatal *fatalError
+	if errors.As(err, &fatal) {
+		return
+	}
+	if errors.Is(err, hooks.ErrVeto) {
+		// Vetoed issues are considered again when they come up next time
+		if r.Attempts > 0 {
+			if err := store.DeleteRetry(ctx, r.Key); err != nil {
+				log.Printf("Failed to remove retry of %s: %v", r.Key, err)
+			}
+		}
+		return
+	}
+	scheduleRetry(ctx, r, err)
+	if r.Status == state.RetryFailed {
+		sendNotification(ctx, notify.Event{
+			Kind:     notify.EventFailed,
+			Repo:     r.Repo,
+			Issue:    r.IssueNumber,
+			IssueURL: issue.GetHTMLURL(),
+			Title:    r.Title,
+			Attempts: r.Attempts,
+			Error:    r.LastError,
+		})
+		markDeadLetter(ctx, issue, r)
+	}
+}
+
+// scheduleRetry records a failed attempt of r and schedules the next one,
+// or marks r as permanently failing once it ran out of attempts
+func scheduleRetry(ctx context.Context, r *state.Retry, cause error) {
+	conf := cfg()
+	now := time.Now().UTC()
+	r.Attempts++
+	r.LastError = cause.Error()
+	r.UpdatedAt = now
+	if r.Attempts >= conf.Retry.MaxAttempts {
+		r.Status = state.RetryFailed
+		log.Printf("GitHub issue #%d permanently failed to sync after %d attempts: %v", r.IssueNumber, r.Attempts, cause)
+	} else {
+		r.Status = state.RetryPending
+		r.NextAttemptAt = now.Add(conf.Retry.Delay(r.Attempts))
+		log.Printf("Queued Jira creation of GitHub issue #%d for retry at %s (attempt %d of %d failed)",
+			r.IssueNumber, r.NextAttemptAt.Format(time.RFC3339), r.Attempts, conf.Retry.MaxAttempts)
+	}
+	if err := store.PutRetry(ctx, r); err != nil {
+		log.Printf("Failed to queue retry of %s: %v", r.Key, err)
+	}
+}
+
+// processRetries retries the due Jira creations of a repository with the
+// summary generated by the failed attempt, and counts the permanently
+// failing ones
+func processRetries(ctx context.Context, client *github.Client, repo config.RepoConfig, result *cycleResult) error {
+	retries, err := store.ListRetries(ctx)
+	if err != nil {
+		result.fail(repo.FullName(), 0, "retry", err)
+		return nil
+	}
+
+	now := time.Now()
+	for _, r := range retries {
+		if r.Repo != repo.FullName() {
+			continue
+		}
+		if r.Status == state.RetryFailed {
+			log.Printf("GitHub issue #%d is permanently failing after %d attempts, last error: %s",
+				r.IssueNumber, r.Attempts, r.LastError)
+			result.inc(&result.PermanentlyFailed)
+			continue
+		}
+		if now.Before(r.NextAttemptAt) {
+			continue
+		}
+		log.Printf("Retrying Jira creation for GitHub issue #%d (attempt %d of %d)", r.IssueNumber, r.Attempts+1, cfg().Retry.MaxAttempts)
+
+		if err := ghRateLimit.wait(ctx); err != nil {
+			return nil
+		}
+		issue, resp, err := client.Issues.Get(ctx, repo.Owner, repo.Name, r.IssueNumber)
+		ghRateLimit.observe(resp, err)
+		if err != nil {
+			if isAuthError(err) {
+				return fmt.Errorf("GitHub authentication failed: %w", err)
+			}
+			if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone) {
+				log.Printf("GitHub issue #%d no longer exists, dropping its retry", r.IssueNumber)
+				if err := store.DeleteRetry(ctx, r.Key); err != nil {
+					log.Printf("Failed to remove retry of %s: %v", r.Key, err)
+				}
+				continue
+			}
+			result.fail(repo.FullName(), r.IssueNumber, "retry", err)
+			continue
+		}
+
+		if m, err := lookupMapping(ctx, r.Key); err == nil {
+			log.Printf("GitHub issue #%d was already synced to %s, dropping its retry", r.IssueNumber, m.JiraKey)
+			if err := store.DeleteRetry(ctx, r.Key); err != nil {
+				log.Printf("Failed to remove retry of %s: %v", r.Key, err)
+			}
+			continue
+		}
+
+		claimed, unlock, err := claimIssue(ctx, r.Key)
+		if errors.Is(err, errIssueBusy) || errors.Is(err, errIssueSynced) {
+			log.Printf("Skipping the retry of GitHub issue #%d: %v", r.IssueNumber, err)
+			continue
+		} else if err != nil {
+			result.fail(repo.FullName(), r.IssueNumber, "lock", err)
+			continue
+		}
+		_, err = createWithRetry(claimed, client, repo, issue, r)
+		unlock()
+		if err != nil {
+			var fatal *fatalError
+			if errors.As(err, &fatal) {
+				return err
+			}
+			var stageErr *syncStageError
+			stage := "create"
+			if errors.As(err, &stageErr) {
+				stage = stageErr.stage
+			}
+			result.fail(repo.FullName(), r.IssueNumber, stage, err)
+			continue
+		}
+		result.inc(&result.Created)
+		result.inc(&result.Retried)
+	}
+	return nil
+}
+
+// resetRetry makes a retry due immediately with all attempts available
+func resetRetry(ctx context.Context, s state.Store, key string) (*state.Retry, error) {
+	r, err := s.GetRetry(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("retry of %s: %w", key, err)
+	}
+	r.Status = state.RetryPending
+	r.Attempts = 0
+	r.NextAttemptAt = time.Now().UTC()
+	r.UpdatedAt = r.NextAttemptAt
+	if err := s.PutRetry(ctx, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+const retriesUsage = `Usage: gh-jira retries <subcommand> [--output table|json|yaml] [flags]
+
+Subcommands:
+  list [--status STATUS]   List failed Jira creations, optionally only pending or failed ones
+  retry KEY...             Retry on the next poll with a fresh set of attempts
+  drop KEY...              Remove from the queue; the next poll summarizes the issue again
+`
+
+// retryList is the output of the retries subcommands
+type retryList struct {
+	Retries []*state.Retry `json:"retries"`
+}
+
+// runRetriesCommand implements `gh-jira retries`
+func runRetriesCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, retriesUsage)
+		return exitFatal
+	}
+
+	fs := flag.NewFlagSet("retries "+args[0], flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("GH_JIRA_CONFIG"), "Path to an optional YAML configuration file")
+	output := outputFlag(fs)
+	status := fs.String("status", "", "Only list retries with this status")
+	if err := fs.Parse(args[1:]); err != nil {
+		return exitFatal
+	}
+	if err := validOutput(*output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+
+	c, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	s, err := state.Open(c.State.Backend, c.State.DSN)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	defer s.Close()
+
+	ctx := context.Background()
+	keys := fs.Args()
+	switch {
+	case args[0] == "list" && len(keys) == 0:
+		err = listRetries(ctx, s, *status, *output)
+	case args[0] == "retry" && len(keys) > 0:
+		err = resetRetries(ctx, s, keys, *output)
+	case args[0] == "drop" && len(keys) > 0:
+		err = dropRetries(ctx, s, keys, *output)
+	default:
+		fmt.Fprint(os.Stderr, retriesUsage)
+		return exitFatal
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitPartialFailure
+	}
+	return exitOK
+}
+
+func listRetries(ctx context.Context, s state.Store, status, output string) error {
+	all, err := s.ListRetries(ctx)
+	if err != nil {
+		return err
+	}
+	list := retryList{Retries: make([]*state.Retry, 0, len(all))}
+	for _, r := range all {
+		if status == "" || r.Status == status {
+			list.Retries = append(list.Retries, r)
+		}
+	}
+	return writeOutput(os.Stdout, output, list, list.writeTable)
+}
+
+// resetRetries makes retries due immediately with all attempts available
+func resetRetries(ctx context.Context, s state.Store, keys []string, output string) error {
+	list := retryList{Retries: make([]*state.Retry, 0, len(keys))}
+	for _, key := range keys {
+		r, err := resetRetry(ctx, s, key)
+		if err != nil {
+			return err
+		}
+		list.Retries = append(list.Retries, r)
+	}
+	return writeOutput(os.Stdout, output, list, list.writeTable)
+}
+
+func dropRetries(ctx context.Context, s state.Store, keys []string, output string) error {
+	list := retryList{Retries: make([]*state.Retry, 0, len(keys))}
+	for _, key := range keys {
+		r, err := s.GetRetry(ctx, key)
+		if err != nil {
+			return fmt.Errorf("retry of %s: %w", key, err)
+		}
+		if err := s.DeleteRetry(ctx, key); err != nil {
+			return err
+		}
+		list.Retries = append(list.Retries, r)
+	}
+	return writeOutput(os.Stdout, output, list, list.writeTable)
+}
+
+// writeTable renders the retries for humans
+func (l retryList) writeTable(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tSTATUS\tISSUE\tATTEMPTS\tNEXT ATTEMPT\tLAST ERROR")
+	for _, r := range l.Retries {
+		next := r.NextAttemptAt.Format(time.RFC3339)
+		if r.Status == state.RetryFailed {
+			next = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s#%d\t%d\t%s\t%s\n", r.Key, r.Status, r.Repo, r.IssueNumber, r.Attempts, next, r.LastError)
+	}
+	return w.Flush()
+}
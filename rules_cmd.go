@@ -0,0 +1,202 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/rules"
+)
+
+// fixtureResult is the outcome of evaluating the rules against a fixture
+type fixtureResult struct {
+	Path        string            `json:"path"`
+	Number      int               `json:"number"`
+	Title       string            `json:"title"`
+	Sections    []string          `json:"sections"`
+	Matched     []string          `json:"matched"`
+	Priority    string            `json:"priority,omitempty"`
+	FixVersions []string          `json:"fix_versions,omitempty"`
+	Labels      []string          `json:"labels,omitempty"`
+	Fields      map[string]string `json:"fields,omitempty"`
+	// Status is "pass", "fail" or "unchecked" for fixtures without expectations
+	Status   string   `json:"status"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+// rulesReport is the output of `rules test`
+type rulesReport struct {
+	RulesFile string          `json:"rules_file"`
+	Rules     []string        `json:"rules"`
+	Fixtures  []fixtureResult `json:"fixtures"`
+	Failed    int             `json:"failed"`
+}
+
+// runRulesCommand implements `gh-jira rules test`
+func runRulesCommand(args []string) int {
+	if len(args) == 0 || args[0] != "test" {
+		fmt.Fprintf(os.Stderr, "Usage: gh-jira rules test [--rules FILE] [--output table|json|yaml] FIXTURE...\n")
+		return exitFatal
+	}
+
+	fs := flag.NewFlagSet("rules test", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("GH_JIRA_CONFIG"), "Path to an optional YAML configuration file")
+	rulesPath := fs.String("rules", "", "Path to the rules file (defaults to rulesFile from the configuration)")
+	output := outputFlag(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return exitFatal
+	}
+	if err := validOutput(*output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+
+	if *rulesPath == "" {
+		c, err := config.Load(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitFatal
+		}
+		*rulesPath = c.RulesFile
+	}
+	if *rulesPath == "" {
+		fmt.Fprintf(os.Stderr, "Error: no rules file given, use --rules or set rulesFile/RULES_FILE\n")
+		return exitFatal
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "Error: at least one fixture file is required\n")
+		return exitFatal
+	}
+
+	engine, err := rules.Load(*rulesPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+
+	report := &rulesReport{RulesFile: *rulesPath, Rules: engine.Rules(), Fixtures: []fixtureResult{}}
+	for _, path := range fs.Args() {
+		fixture, err := rules.LoadFixture(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitFatal
+		}
+		res, err := engine.Evaluate(fixture.Issue)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error evaluating %s: %v\n", path, err)
+			return exitFatal
+		}
+
+		fr := fixtureResult{
+			Path:        path,
+			Number:      fixture.Issue.Number,
+			Title:       fixture.Issue.Title,
+			Sections:    rules.SectionNames(fixture.Issue.Body),
+			Matched:     res.Matched,
+			Priority:    res.Priority,
+			FixVersions: res.FixVersions,
+			Labels:      res.Labels,
+			Fields:      res.Fields,
+		}
+		if fr.Sections == nil {
+			fr.Sections = []string{}
+		}
+		if fr.Matched == nil {
+			fr.Matched = []string{}
+		}
+		switch problems := fixture.Check(res); {
+		case fixture.Expect == nil:
+			fr.Status = "unchecked"
+		case len(problems) == 0:
+			fr.Status = "pass"
+		default:
+			fr.Status = "fail"
+			fr.Problems = problems
+			report.Failed++
+		}
+		report.Fixtures = append(report.Fixtures, fr)
+	}
+
+	if err := writeOutput(os.Stdout, *output, report, report.writeTable); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	if report.Failed > 0 {
+		return exitPartialFailure
+	}
+	return exitOK
+}
+
+// writeTable renders the rules test report for humans
+func (r *rulesReport) writeTable(w io.Writer) error {
+	fmt.Fprintf(w, "Loaded %d rules from %s: %s\n\n", len(r.Rules), r.RulesFile, strings.Join(r.Rules, ", "))
+	for _, f := range r.Fixtures {
+		fmt.Fprintf(w, "%s (#%d %s)\n", f.Path, f.Number, f.Title)
+		if len(f.Sections) > 0 {
+			fmt.Fprintf(w, "  sections:    %s\n", strings.Join(f.Sections, ", "))
+		}
+		if len(f.Matched) == 0 {
+			fmt.Fprintf(w, "  matched:     (none)\n")
+		} else {
+			fmt.Fprintf(w, "  matched:     %s\n", strings.Join(f.Matched, ", "))
+		}
+		if f.Priority != "" {
+			fmt.Fprintf(w, "  priority:    %s\n", f.Priority)
+		}
+		if len(f.FixVersions) > 0 {
+			fmt.Fprintf(w, "  fixVersions: %s\n", strings.Join(f.FixVersions, ", "))
+		}
+		if len(f.Labels) > 0 {
+			fmt.Fprintf(w, "  labels:      %s\n", strings.Join(f.Labels, ", "))
+		}
+		names := make([]string, 0, len(f.Fields))
+		for name := range f.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(w, "  %s: %q\n", name, f.Fields[name])
+		}
+
+		switch f.Status {
+		case "unchecked":
+			fmt.Fprintf(w, "  (no expectations)\n")
+		case "pass":
+			fmt.Fprintf(w, "  PASS\n")
+		default:
+			for _, p := range f.Problems {
+				fmt.Fprintf(w, "  FAIL %s\n", p)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	if r.Failed > 0 {
+		fmt.Fprintf(w, "%d of %d fixtures failed\n", r.Failed, len(r.Fixtures))
+	}
+	return nil
+}
+
+// ruleIssue converts a GitHub issue into the view used by the rules engine,
+// with its title and body redacted
+func ruleIssue(issue *github.Issue) rules.Issue {
+	ri := rules.Issue{
+		Number: issue.GetNumber(),
+		Title:  redactor.Redact(issue.GetTitle()),
+		Body:   redactor.Redact(issue.GetBody()),
+	}
+	for _, l := range issue.Labels {
+		ri.Labels = append(ri.Labels, l.GetName())
+	}
+	if issue.Milestone != nil {
+		ri.Milestone = issue.Milestone.GetTitle()
+	}
+	if issue.User != nil {
+		ri.Author = issue.User.GetLogin()
+	}
+	return ri
+}
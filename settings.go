@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log"
+	"sync/atomic"
+	"text/template"
+
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/filter"
+	"github.com/savitaashture/gh-jira/pkg/rules"
+)
+
+// settings are the configuration in effect with the templates, filters and
+// field-mapping rules loaded from it. A configuration reload publishes new
+// settings as a whole and never modifies published ones, so syncs and
+// requests running meanwhile keep reading consistent settings.
+type settings struct {
+	cfg *config.Config
+	// summaryTemplate and descriptionTemplate render the Jira summary and
+	// description
+	summaryTemplate     *template.Template
+	descriptionTemplate *template.Template
+	// repoOverrides holds the templates of the repositories overriding the
+	// prompt or the description template, by lower-case owner/name
+	repoOverrides map[string]*repoTemplates
+	// issueFilter is the global filter expression; nil matches every issue
+	issueFilter *filter.Expr
+	// repoFilters are the filter expressions of the configured repositories
+	// by owner/name
+	repoFilters map[string]*filter.Expr
+	// rules are the field-mapping rules, nil without a rules file
+	rules *rules.Engine
+}
+
+// active holds the settings in effect
+var active atomic.Pointer[settings]
+
+// current returns the settings in effect. Code using several of them takes
+// one snapshot, so that a reload in between can't mix two configurations.
+func current() *settings {
+	return active.Load()
+}
+
+// cfg returns the configuration in effect
+func cfg() *config.Config {
+	return current().cfg
+}
+
+// loadSettings loads the templates, filters and field-mapping rules of c
+func loadSettings(c *config.Config) (*settings, error) {
+	s := &settings{cfg: c}
+	if c.RulesFile != "" {
+		log.Printf("Loading field-mapping rules from %s", c.RulesFile)
+		var err error
+		if s.rules, err = rules.Load(c.RulesFile); err != nil {
+			return nil, err
+		}
+		log.Printf("Loaded %d field-mapping rules", len(s.rules.Rules()))
+	}
+	if err := loadTemplates(s); err != nil {
+		return nil, err
+	}
+	if err := loadFilters(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
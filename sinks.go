@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/sink"
+)
+
+// sinks holds the trackers other than Jira issues are created in, by name.
+// Mappings name their sink in place of a Jira instance.
+var sinks map[string]sink.Sink
+
+// loadSinks creates the clients of the configured sinks
+func loadSinks() error {
+	conf := cfg()
+	sinks = make(map[string]sink.Sink, len(conf.Sinks))
+	for _, s := range conf.Sinks {
+		// http.DefaultClient carries the proxy and TLS settings
+		switch s.Type {
+		case config.SinkLinear:
+			sinks[s.Name] = &sink.Linear{APIURL: s.BaseURL, Token: s.Token, Team: s.Team, Workspace: s.Workspace, HTTPClient: http.DefaultClient}
+			log.Printf("Using Linear sink %s, team %s", s.Name, s.Team)
+		case config.SinkAzureDevOps:
+			sinks[s.Name] = &sink.AzureDevOps{URL: s.BaseURL, Organization: s.Organization, Project: s.Project,
+				WorkItemType: s.WorkItemType, Token: s.Token, HTTPClient: http.DefaultClient}
+			log.Printf("Using Azure DevOps sink %s, project %s/%s", s.Name, s.Organization, s.Project)
+		case config.SinkYouTrack:
+			sinks[s.Name] = &sink.YouTrack{URL: s.BaseURL, Token: s.Token, Project: s.Project,
+				IssueTypes: s.IssueTypes, IssueType: s.IssueType, HTTPClient: http.DefaultClient}
+			log.Printf("Using YouTrack sink %s at %s, project %s", s.Name, s.BaseURL, s.Project)
+		default:
+			return fmt.Errorf("unsupported sink type %q", s.Type)
+		}
+	}
+	return nil
+}
+
+// validateSinks checks the credentials and target of each sink
+func validateSinks(ctx context.Context, report *validateReport) {
+	for _, s := range cfg().Sinks {
+		c, ok := sinks[s.Name].(sink.Checker)
+		if !ok {
+			continue
+		}
+		err := c.Check(ctx)
+		if err != nil {
+			switch s.Type {
+			case config.SinkLinear:
+				err = fmt.Errorf("%w; check the API key and the team key %s", err, s.Team)
+			case config.SinkAzureDevOps:
+				err = fmt.Errorf("%w; check that the personal access token has the Work Items (Read & Write) scope in %s/%s", err, s.Organization, s.Project)
+			case config.SinkYouTrack:
+				err = fmt.Errorf("%w; check the permanent token and that its user can see project %s", err, s.Project)
+			}
+		}
+		report.add("sink "+s.Name, err)
+	}
+}
+
+// isSink reports whether the instance of a mapping is a sink rather than a
+// Jira instance. Jira-only steps, such as epics, sprints, transitions and
+// comments, are skipped for the issues of sinks.
+func isSink(instance string) bool {
+	_, ok := sinks[instance]
+	return ok
+}
+
+// trackerFor returns the client of a Jira instance or sink by name
+func trackerFor(instance string) (sink.Sink, error) {
+	if s, ok := sinks[instance]; ok {
+		return s, nil
+	}
+	jc, err := jiraFor(instance)
+	if err != nil {
+		return nil, err
+	}
+	return jc, nil
+}
+
+// trackerName returns the name of the kind of tracker of an instance, for
+// messages on GitHub
+func trackerName(instance string) string {
+	s, ok := cfg().Sink(instance)
+	switch {
+	case !ok:
+		return "Jira"
+	case s.Type == config.SinkLinear:
+		return "Linear"
+	case s.Type == config.SinkAzureDevOps:
+		return "Azure DevOps"
+	case s.Type == config.SinkYouTrack:
+		return "YouTrack"
+	}
+	return s.Name
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/state"
+	"github.com/savitaashture/gh-jira/pkg/summarizer"
+)
+
+// commandReplyMarker identifies replies to comment commands
+const commandReplyMarker = "<!-- gh-jira:command-reply -->"
+
+// commandCursor is the persisted progress of the comment command scanner
+type commandCursor struct {
+	Since  time.Time `json:"since"`
+	LastID int64     `json:"last_id"`
+}
+
+// processCommands looks for new comment commands (e.g. `/jira`) in a
+// repository and creates or re-syncs the Jira issue of each commented issue
+func processCommands(ctx context.Context, client *github.Client, repo config.RepoConfig, sum *summarizer.Summarizer, result *cycleResult) error {
+	conf := cfg()
+	if conf.GitHub.Command == "" {
+		return nil
+	}
+
+	cursorName := "commands:" + repo.FullName()
+	raw, err := store.GetCursor(ctx, cursorName)
+	if err != nil {
+		result.fail(repo.FullName(), 0, "command", err)
+		return nil
+	}
+	var cursor commandCursor
+	if raw == "" {
+		// Only react to commands issued from now on
+		log.Printf("Listening for %s commands in %s", conf.GitHub.Command, repo.FullName())
+		cursor.Since = time.Now().UTC()
+		return saveCommandCursor(ctx, cursorName, cursor, result, repo)
+	}
+	if err := json.Unmarshal([]byte(raw), &cursor); err != nil {
+		result.fail(repo.FullName(), 0, "command", fmt.Errorf("invalid command cursor: %w", err))
+		return nil
+	}
+
+	// The cursor moves while the pages are read, the listing must not
+	since := cursor.Since
+	opt := &github.IssueListCommentsOptions{
+		Sort:        github.Ptr("created"),
+		Direction:   github.Ptr("asc"),
+		Since:       &since,
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		if err := ghRateLimit.wait(ctx); err != nil {
+			return nil
+		}
+		comments, resp, err := client.Issues.ListComments(ctx, repo.Owner, repo.Name, 0, opt)
+		ghRateLimit.observe(resp, err)
+		if err != nil {
+			log.Printf("Error fetching comments of %s: %v", repo.FullName(), err)
+			if isAuthError(err) {
+				return fmt.Errorf("GitHub authentication failed: %w", err)
+			}
+			result.fail(repo.FullName(), 0, "command", err)
+			return nil
+		}
+
+		for _, c := range comments {
+			if c.GetID() <= cursor.LastID {
+				continue
+			}
+			if isCommand(c.GetBody()) {
+				if err := handleCommand(ctx, client, repo, c, sum, result); err != nil {
+					return err
+				}
+			}
+			cursor.LastID = c.GetID()
+			cursor.Since = c.GetCreatedAt().Time
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return saveCommandCursor(ctx, cursorName, cursor, result, repo)
+}
+
+func saveCommandCursor(ctx context.Context, name string, cursor commandCursor, result *cycleResult, repo config.RepoConfig) error {
+	data, err := json.Marshal(cursor)
+	if err == nil {
+		err = store.SetCursor(ctx, name, string(data))
+	}
+	if err != nil {
+		log.Printf("Failed to save command cursor for %s: %v", repo.FullName(), err)
+		result.fail(repo.FullName(), 0, "command", err)
+	}
+	return nil
+}
+
+// isCommand reports whether the first line of a comment is the command
+func isCommand(body string) bool {
+	conf := cfg()
+	line := strings.TrimSpace(strings.SplitN(body, "\n", 2)[0])
+	return line == conf.GitHub.Command || strings.HasPrefix(line, conf.GitHub.Command+" ")
+}
+
+// handleCommand creates or re-syncs the Jira issue of the commented issue
+// and replies with the result. Only fatal errors are returned.
+func handleCommand(ctx context.Context, client *github.Client, repo config.RepoConfig, c *github.IssueComment, sum *summarizer.Summarizer, result *cycleResult) error {
+	number, err := issueNumberFromURL(c.GetIssueURL())
+	if err != nil {
+		log.Printf("Ignoring command comment %d: %v", c.GetID(), err)
+		return nil
+	}
+	author := c.GetUser().GetLogin()
+	log.Printf("Received %s command from @%s on %s#%d", cfg().GitHub.Command, author, repo.FullName(), number)
+	if !commandAllowed(c) {
+		log.Printf("Ignoring command of @%s on %s#%d: author association %s is not allowed", author, repo.FullName(), number, c.GetAuthorAssociation())
+		replyToCommand(ctx, client, repo, number, author, "Only maintainers of this repository can sync issues to Jira.")
+		return nil
+	}
+
+	if err := ghRateLimit.wait(ctx); err != nil {
+		return nil
+	}
+	issue, resp, err := client.Issues.Get(ctx, repo.Owner, repo.Name, number)
+	ghRateLimit.observe(resp, err)
+	if err != nil {
+		result.fail(repo.FullName(), number, "command", err)
+		return nil
+	}
+	if issue.IsPullRequest() {
+		replyToCommand(ctx, client, repo, number, author, "Jira sync is only available for issues, not pull requests.")
+		return nil
+	}
+
+	key, err := issueKey(repo, issue)
+	if err != nil {
+		result.fail(repo.FullName(), number, "command", err)
+		return nil
+	}
+
+	reply, err := syncOnDemand(ctx, client, repo, issue, key, sum, result)
+	if err != nil {
+		var fatal *fatalError
+		if errors.As(err, &fatal) {
+			return err
+		}
+		log.Printf("Command on GitHub issue #%d failed: %v", number, err)
+		result.fail(repo.FullName(), number, "command", err)
+		if reply == "" {
+			// The error may reveal Jira or state store details
+			reply = "Jira sync failed. The maintainers can find the details in the service log."
+		}
+	}
+	replyToCommand(ctx, client, repo, number, author, reply)
+	return nil
+}
+
+// commandAllowed reports whether the author of a command comment is allowed
+// to use it
+func commandAllowed(c *github.IssueComment) bool {
+	for _, a := range cfg().GitHub.CommandAssociations {
+		if strings.EqualFold(a, c.GetAuthorAssociation()) {
+			return true
+		}
+	}
+	return false
+}
+
+// syncOnDemand creates or re-syncs the Jira issue of a GitHub issue on
+// request and describes the outcome in Markdown. With the approval gate, a
+// missing Jira issue is queued for approval instead. Issues with the skip
+// label are left alone, and new issues must pass the filter. The
+// description may be set even if an error is returned.
+func syncOnDemand(ctx context.Context, client *github.Client, repo config.RepoConfig, issue *github.Issue, key string, sum *summarizer.Summarizer, result *cycleResult) (string, error) {
+	conf := cfg()
+	number := issue.GetNumber()
+	if conf.GitHub.SkipLabel != "" && hasLabel(issue, conf.GitHub.SkipLabel) {
+		log.Printf("Not syncing GitHub issue #%d labelled %s on request", number, conf.GitHub.SkipLabel)
+		result.inc(&result.Skipped)
+		return fmt.Sprintf("The issue is labelled `%s` and not synced to Jira.", conf.GitHub.SkipLabel), nil
+	}
+	var reply string
+	mapping, err := lookupMapping(ctx, key)
+	if errors.Is(err, state.ErrNotFound) {
+		if why := filteredOut(repo, issue); why != "" {
+			log.Printf("Not syncing GitHub issue #%d on request as %s", number, why)
+			result.inc(&result.Skipped)
+			return "The issue doesn't match the Jira sync filter.", nil
+		}
+	}
+	switch {
+	case err == nil:
+		log.Printf("Re-syncing GitHub issue #%d to %s on request", number, mapping.JiraKey)
+		if err = resyncIssue(ctx, client, repo, issue, mapping, sum, nil); err == nil {
+			reply = fmt.Sprintf("Re-synced %s issue [%s](%s).", trackerName(mapping.JiraInstance), mapping.JiraKey, jiraBrowseURL(mapping.JiraInstance, mapping.JiraKey))
+		}
+	case errors.Is(err, state.ErrNotFound) && conf.Approval.Required:
+		var a *state.Approval
+		if a, err = findApproval(ctx, key); err == nil && a == nil {
+			a, err = queueApproval(ctx, repo, issue, key, sum)
+			if err == nil {
+				result.inc(&result.Queued)
+			}
+		}
+		if a != nil {
+			reply = approvalReply(a)
+		}
+	case errors.Is(err, state.ErrNotFound):
+		log.Printf("Creating Jira issue for GitHub issue #%d on request", number)
+		mapping, err = claimAndCreate(ctx, client, repo, issue, key, sum)
+		switch {
+		case errors.Is(err, errIssueBusy):
+			reply, err = "The issue is being synced already; the Jira issue will be linked here once it is created.", nil
+		case errors.Is(err, errIssueSynced):
+			if mapping, err = lookupMapping(ctx, key); err == nil {
+				reply = fmt.Sprintf("Synced to Jira issue [%s](%s) meanwhile.", mapping.JiraKey, jiraBrowseURL(mapping.JiraInstance, mapping.JiraKey))
+			}
+		case mapping != nil:
+			reply = fmt.Sprintf("Created Jira issue [%s](%s).", mapping.JiraKey, jiraBrowseURL(mapping.JiraInstance, mapping.JiraKey))
+			if err == nil {
+				result.inc(&result.Created)
+			}
+		}
+	}
+	return reply, err
+}
+
+// claimAndCreate claims the issue of key and creates its Jira issue with
+// createAndRecord. It fails with errIssueBusy or errIssueSynced if the issue
+// is being or was synced elsewhere.
+func claimAndCreate(ctx context.Context, client *github.Client, repo config.RepoConfig, issue *github.Issue, key string, sum *summarizer.Summarizer) (*state.Mapping, error) {
+	ctx, unlock, err := claimIssue(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return createAndRecord(ctx, client, repo, issue, key, sum)
+}
+
+// approvalReply describes the state of an approval in a command reply
+func approvalReply(a *state.Approval) string {
+	switch a.Status {
+	case state.ApprovalApproved:
+		return fmt.Sprintf("The Jira issue was approved (request %d) and will be created on the next poll.", a.ID)
+	case state.ApprovalRejected:
+		if a.Reason != "" {
+			return fmt.Sprintf("The Jira issue was rejected by %s (request %d): %s", a.DecidedBy, a.ID, a.Reason)
+		}
+		return fmt.Sprintf("The Jira issue was rejected by %s (request %d).", a.DecidedBy, a.ID)
+	default:
+		return fmt.Sprintf("The Jira issue is awaiting approval (request %d).", a.ID)
+	}
+}
+
+// replyToCommand posts the result of a command on the issue
+func replyToCommand(ctx context.Context, client *github.Client, repo config.RepoConfig, number int, author, text string) {
+	body := fmt.Sprintf("%s\n@%s %s", commandReplyMarker, author, text)
+	if err := ghRateLimit.wait(ctx); err != nil {
+		return
+	}
+	_, resp, err := client.Issues.CreateComment(ctx, repo.Owner, repo.Name, number, &github.IssueComment{Body: &body})
+	ghRateLimit.observe(resp, err)
+	if err != nil {
+		log.Printf("Failed to reply to command on GitHub issue #%d: %v", number, err)
+		return
+	}
+	recordAudit(githubAudit("create_comment", repo, number, map[string]interface{}{"reply_to": author}))
+}
+
+// issueNumberFromURL extracts the issue number from a GitHub API issue URL
+func issueNumberFromURL(u string) (int, error) {
+	i := strings.LastIndex(u, "/")
+	if i < 0 {
+		return 0, fmt.Errorf("unexpected issue URL %q", u)
+	}
+	return strconv.Atoi(u[i+1:])
+}
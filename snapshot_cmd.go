@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+const snapshotsUsage = `Usage: gh-jira snapshots <subcommand> [--output table|json|yaml] [flags]
+
+Subcommands:
+  list [KEY]              List the recorded sync actions, optionally of one mapping key
+  diff ID                 Show the snapshots before and after the sync action ID
+`
+
+// snapshotList is the output of `snapshots list`
+type snapshotList struct {
+	Snapshots []*state.Snapshot `json:"snapshots"`
+}
+
+// snapshotDiff is the output of `snapshots diff`. Before is the previous
+// snapshot of the same issue and is null for the first sync action.
+type snapshotDiff struct {
+	Before *state.Snapshot `json:"before"`
+	After  *state.Snapshot `json:"after"`
+}
+
+// runSnapshotsCommand implements `gh-jira snapshots`
+func runSnapshotsCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, snapshotsUsage)
+		return exitFatal
+	}
+
+	fs := flag.NewFlagSet("snapshots "+args[0], flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("GH_JIRA_CONFIG"), "Path to an optional YAML configuration file")
+	output := outputFlag(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return exitFatal
+	}
+	if err := validOutput(*output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+
+	c, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	s, err := state.Open(c.State.Backend, c.State.DSN)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	defer s.Close()
+
+	ctx := context.Background()
+	switch {
+	case args[0] == "list" && fs.NArg() <= 1:
+		err = listSnapshots(ctx, s, fs.Arg(0), *output)
+	case args[0] == "diff" && fs.NArg() == 1:
+		id, perr := strconv.ParseInt(fs.Arg(0), 10, 64)
+		if perr != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid snapshot ID %q\n", fs.Arg(0))
+			return exitFatal
+		}
+		err = diffSnapshot(ctx, s, id, *output)
+	default:
+		fmt.Fprint(os.Stderr, snapshotsUsage)
+		return exitFatal
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitPartialFailure
+	}
+	return exitOK
+}
+
+func listSnapshots(ctx context.Context, s state.Store, key, output string) error {
+	snaps, err := s.ListSnapshots(ctx, key)
+	if err != nil {
+		return err
+	}
+	return writeOutput(os.Stdout, output, snapshotList{Snapshots: snaps}, func(out io.Writer) error {
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tACTION\tISSUE\tJIRA\tKEY\tCREATED")
+		for _, sn := range snaps {
+			fmt.Fprintf(w, "%d\t%s\t%s#%d\t%s\t%s\t%s\n", sn.ID, sn.Action, sn.Repo, sn.IssueNumber, sn.JiraKey, sn.Key, sn.CreatedAt.Format(time.RFC3339))
+		}
+		return w.Flush()
+	})
+}
+
+func diffSnapshot(ctx context.Context, s state.Store, id int64, output string) error {
+	after, err := s.GetSnapshot(ctx, id)
+	if err != nil {
+		return fmt.Errorf("snapshot %d: %w", id, err)
+	}
+	before, err := state.PreviousSnapshot(ctx, s, after)
+	if err != nil {
+		return err
+	}
+	d := snapshotDiff{Before: before, After: after}
+	return writeOutput(os.Stdout, output, d, d.writeTable)
+}
+
+// writeTable renders the snapshot diff for humans
+func (d snapshotDiff) writeTable(w io.Writer) error {
+	a := d.After
+	fmt.Fprintf(w, "Snapshot %d: %s of %s for %s#%d at %s\n", a.ID, a.Action, a.JiraKey, a.Repo, a.IssueNumber, a.CreatedAt.Format(time.RFC3339))
+	prev := &state.Snapshot{}
+	if d.Before != nil {
+		prev = d.Before
+		fmt.Fprintf(w, "Compared to snapshot %d: %s at %s\n", prev.ID, prev.Action, prev.CreatedAt.Format(time.RFC3339))
+	} else {
+		fmt.Fprintf(w, "First sync action of this issue\n")
+	}
+
+	fmt.Fprintf(w, "\nGitHub body (issue updated at %s):\n", a.GitHubUpdatedAt.Format(time.RFC3339))
+	writeLineDiff(w, "  ", prev.GitHubBody, a.GitHubBody)
+	fmt.Fprintf(w, "\nGenerated summary:\n")
+	writeLineDiff(w, "  ", prev.Summary, a.Summary)
+	fmt.Fprintf(w, "\nJira payload:\n")
+	writeLineDiff(w, "  ", jsonText(prev.JiraFields), jsonText(a.JiraFields))
+	return nil
+}
+
+// jsonText formats fields as indented JSON for diffing
+func jsonText(fields map[string]interface{}) string {
+	if fields == nil {
+		return ""
+	}
+	data, err := json.MarshalIndent(fields, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("%v", fields)
+	}
+	return string(data)
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/audit"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/source"
+	"github.com/savitaashture/gh-jira/pkg/state"
+	"github.com/savitaashture/gh-jira/pkg/summarizer"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// sourceProject is a watched project of a source other than GitHub
+type sourceProject struct {
+	source   config.SourceConfig
+	provider source.Provider
+	// path is the path of the project in the source, e.g. group/project
+	path string
+	// repo stands for the project in the sync, named source:group/project
+	repo config.RepoConfig
+}
+
+// sourceProjects are the watched projects of the configured sources
+var sourceProjects []*sourceProject
+
+// loadSources creates the providers of the configured sources
+func loadSources() error {
+	sourceProjects = nil
+	for _, src := range cfg().Sources {
+		var provider source.Provider
+		switch src.Type {
+		case config.SourceGitLab:
+			// http.DefaultClient carries the proxy and TLS settings
+			provider = &source.GitLab{BaseURL: src.BaseURL, Token: src.Token, HTTPClient: http.DefaultClient}
+		default:
+			return fmt.Errorf("unsupported source type %q", src.Type)
+		}
+		for _, path := range src.Projects {
+			sourceProjects = append(sourceProjects, &sourceProject{
+				source:   src,
+				provider: provider,
+				path:     path,
+				repo:     sourceRepo(src, path),
+			})
+		}
+		log.Printf("Watching %s projects of source %s: %s", src.Type, src.Name, strings.Join(src.Projects, ", "))
+	}
+	return nil
+}
+
+// sourceRepo returns the repository standing for a project of src. Its name
+// is prefixed with the name of the source, which no GitHub repository can
+// have, so that mappings, logs and the audit log tell the trackers apart.
+func sourceRepo(src config.SourceConfig, path string) config.RepoConfig {
+	i := strings.LastIndex(path, "/")
+	return config.RepoConfig{Owner: src.Name + ":" + path[:i], Name: path[i+1:], Jira: src.Jira}
+}
+
+// fromSource reports whether a repository name is the one of a project of
+// a source other than GitHub
+func fromSource(repo string) bool {
+	return strings.Contains(repo, ":")
+}
+
+// issueSource returns the name of the tracker of the issues of repo
+func issueSource(repo config.RepoConfig) string {
+	name, _, ok := strings.Cut(repo.Owner, ":")
+	if !ok {
+		return "GitHub"
+	}
+	for _, src := range cfg().Sources {
+		if src.Name == name && src.Type == config.SourceGitLab {
+			return "GitLab"
+		}
+	}
+	return name
+}
+
+// findSourceProject returns the watched project of a source, or nil
+func findSourceProject(sourceName, path string) *sourceProject {
+	for _, p := range sourceProjects {
+		if p.source.Name == sourceName && strings.EqualFold(p.path, path) {
+			return p
+		}
+	}
+	return nil
+}
+
+// sourceIssue returns an issue of a source as a GitHub issue, so that it is
+// summarized and mapped to Jira fields like one
+func sourceIssue(i *source.Issue) *github.Issue {
+	issue := &github.Issue{
+		ID:        github.Ptr(i.ID),
+		NodeID:    github.Ptr(i.GlobalID),
+		Number:    github.Ptr(i.Number),
+		Title:     github.Ptr(i.Title),
+		Body:      github.Ptr(i.Body),
+		HTMLURL:   github.Ptr(i.URL),
+		State:     github.Ptr(i.State),
+		CreatedAt: &github.Timestamp{Time: i.CreatedAt},
+	}
+	if i.Author != "" {
+		issue.User = &github.User{Login: github.Ptr(i.Author)}
+	}
+	for _, l := range i.Labels {
+		issue.Labels = append(issue.Labels, &github.Label{Name: github.Ptr(l)})
+	}
+	if i.Milestone != "" {
+		issue.Milestone = &github.Milestone{Title: github.Ptr(i.Milestone)}
+	}
+	return issue
+}
+
+// syncSources creates the Jira issues of the new issues of the watched
+// projects of all sources
+func syncSources(ctx context.Context, sum *summarizer.Summarizer, result *cycleResult) {
+	for _, p := range sourceProjects {
+		if ctx.Err() != nil {
+			return
+		}
+		syncSourceProject(ctx, p, sum, result)
+	}
+}
+
+// syncSourceProject creates the Jira issues of the new issues of a project
+func syncSourceProject(ctx context.Context, p *sourceProject, sum *summarizer.Summarizer, result *cycleResult) {
+	ctx, span := startSpan(ctx, "poll_repo", attribute.String("github.repo", p.repo.FullName()))
+	defer span.End()
+
+	log.Printf("Fetching issues from %s project %s", p.source.Name, p.path)
+	issues, err := p.provider.ListIssues(ctx, p.path)
+	if err != nil {
+		log.Printf("Error fetching issues of %s: %v", p.repo.FullName(), err)
+		result.fail(p.repo.FullName(), 0, "fetch", err)
+		return
+	}
+	log.Printf("Found %d issues in %s", len(issues), p.repo.FullName())
+	result.add(&result.IssuesSeen, len(issues))
+	for _, issue := range issues {
+		if ctx.Err() != nil {
+			return
+		}
+		created, err := syncSourceIssue(ctx, p, issue, sum)
+		switch {
+		case err != nil:
+			stage := "create"
+			var stageErr *syncStageError
+			if errors.As(err, &stageErr) {
+				stage = stageErr.stage
+			}
+			result.fail(p.repo.FullName(), issue.Number, stage, err)
+		case created:
+			result.inc(&result.Created)
+		}
+	}
+}
+
+// syncSourceIssue creates the Jira issue of an issue of a source unless it
+// was already synced or is excluded, and reports whether it did. Like
+// discussions, these issues bypass the approval gate and the retry queue.
+func syncSourceIssue(ctx context.Context, p *sourceProject, si *source.Issue, sum *summarizer.Summarizer) (bool, error) {
+	conf := cfg()
+	repo, issue := p.repo, sourceIssue(si)
+	if conf.GitHub.SkipLabel != "" && hasLabel(issue, conf.GitHub.SkipLabel) {
+		return false, nil
+	}
+	key, err := issueKey(repo, issue)
+	if err != nil {
+		return false, &syncStageError{stage: "key", err: err}
+	}
+	if _, err := lookupMapping(ctx, key); err == nil {
+		return false, nil
+	} else if !errors.Is(err, state.ErrNotFound) {
+		return false, &syncStageError{stage: "lookup", err: err}
+	}
+	if si.State == "closed" {
+		return false, nil
+	}
+	if why := filteredOut(repo, issue); why != "" {
+		log.Printf("Skipping issue %s#%d as %s", repo.FullName(), si.Number, why)
+		return false, nil
+	}
+	log.Printf("New issue detected: %s#%d - %s", repo.FullName(), si.Number, si.Title)
+
+	ctx, unlock, err := claimIssue(ctx, key)
+	if errors.Is(err, errIssueBusy) || errors.Is(err, errIssueSynced) {
+		log.Printf("Skipping issue %s#%d: %v", repo.FullName(), si.Number, err)
+		return false, nil
+	} else if err != nil {
+		return false, &syncStageError{stage: "lock", err: err}
+	}
+	defer unlock()
+	ctx, span := startSpan(ctx, "sync_issue", issueAttrs(repo.FullName(), si.Number)...)
+	defer span.End()
+	mapping, warnings, err := createDirect(ctx, repo, issue, key, sum)
+	if err != nil {
+		return false, err
+	}
+	if err := writeSourceBacklink(ctx, p, si.Number, mapping, warnings); err != nil {
+		log.Printf("Failed to write back-link for issue %s#%d: %v", repo.FullName(), si.Number, err)
+		return true, &syncStageError{stage: "backlink", err: err}
+	}
+	afterSync(ctx, repo, issue, mapping)
+	return true, nil
+}
+
+// writeSourceBacklink publishes the sync status comment on an issue of a
+// source, unless back-links are disabled
+func writeSourceBacklink(ctx context.Context, p *sourceProject, number int, m *state.Mapping, warnings []string) error {
+	if p.repo.BacklinkMode(cfg().GitHub.Backlink) == "none" {
+		return nil
+	}
+	body := renderStatusComment(m, syncStatus{State: "Synced", Warnings: warnings})
+	if m.StatusCommentID != 0 {
+		err := p.provider.EditComment(ctx, p.path, number, m.StatusCommentID, body)
+		if err == nil || !source.IsNotFound(err) {
+			return err
+		}
+	}
+	log.Printf("Creating sync status comment on issue %s#%d", p.repo.FullName(), number)
+	id, err := p.provider.CreateComment(ctx, p.path, number, body)
+	if err != nil {
+		return fmt.Errorf("failed to create sync status comment: %w", err)
+	}
+	e := githubAudit("create_comment", p.repo, number, map[string]interface{}{"comment_id": id})
+	e.System = audit.SystemGitLab
+	recordAudit(e)
+	return recordStatusComment(ctx, m, id)
+}
+
+// sourceWebhookTimeout limits the sync started by a webhook delivery
+const sourceWebhookTimeout = 10 * time.Minute
+
+// handleSourceWebhook syncs the issues opened in the projects of a source as
+// their webhook events arrive, ahead of the next poll
+func (d *dashboard) handleSourceWebhook(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("source")
+	var p *sourceProject
+	for _, sp := range sourceProjects {
+		if sp.source.Name == name {
+			p = sp
+			break
+		}
+	}
+	if p == nil || p.source.WebhookSecret == "" {
+		http.NotFound(w, r)
+		return
+	}
+	hooks, ok := p.provider.(source.Webhooks)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	event, err := hooks.ParseWebhook(r, p.source.WebhookSecret)
+	if err != nil {
+		log.Printf("Rejected webhook delivery of source %s: %v", name, err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	if event == nil || (event.Action != "open" && event.Action != "reopen") {
+		return
+	}
+	if p = findSourceProject(name, event.Project); p == nil {
+		log.Printf("Ignoring webhook event of unwatched project %s of source %s", event.Project, name)
+		return
+	}
+	if isFollower() {
+		log.Printf("Not the leader, leaving issue %s#%d to the leader", p.repo.FullName(), event.Number)
+		return
+	}
+
+	// The delivery is acknowledged right away, as summaries take longer
+	// than webhooks wait
+	go func() {
+		d.actionMu.Lock()
+		defer d.actionMu.Unlock()
+		ctx, cancel := context.WithTimeout(context.Background(), sourceWebhookTimeout)
+		defer cancel()
+		issue, err := p.provider.GetIssue(ctx, p.path, event.Number)
+		if err != nil {
+			log.Printf("Failed to get issue %s#%d of webhook event: %v", p.repo.FullName(), event.Number, err)
+			return
+		}
+		if _, err := syncSourceIssue(ctx, p, issue, d.sum); err != nil {
+			log.Printf("Failed to sync issue %s#%d of webhook event: %v", p.repo.FullName(), event.Number, err)
+		}
+	}()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+// assignSprint places the new Jira issue of a mapping in the active sprint
+// of the board of its project, or in the backlog if no sprint is active.
+// With parallel sprints, the one that started first is used.
+func assignSprint(ctx context.Context, repo config.RepoConfig, issue *github.Issue, m *state.Mapping) error {
+	conf := cfg()
+	if !conf.Jira.Sprints.Enabled || m.JiraKey == "" {
+		return nil
+	}
+	project, _, _ := strings.Cut(m.JiraKey, "-")
+	board := conf.Jira.Sprints.BoardFor(project)
+	if board == 0 {
+		return nil
+	}
+	jc, err := jiraFor(m.JiraInstance)
+	if err != nil {
+		return err
+	}
+	sprints, err := jc.ActiveSprints(ctx, board)
+	if err != nil {
+		return fmt.Errorf("failed to list the active sprints of board %d: %w", board, err)
+	}
+
+	e := jiraAudit("move_to_backlog", m.JiraKey, map[string]interface{}{"board": board})
+	if len(sprints) == 0 {
+		if err := jc.MoveToBacklog(ctx, m.JiraKey); err != nil {
+			return fmt.Errorf("failed to move %s to the backlog: %w", m.JiraKey, err)
+		}
+		log.Printf("Board %d has no active sprint, moved Jira issue %s to the backlog", board, m.JiraKey)
+	} else {
+		sort.SliceStable(sprints, func(i, j int) bool { return sprints[i].StartDate < sprints[j].StartDate })
+		sprint := sprints[0]
+		if err := jc.MoveToSprint(ctx, sprint.ID, m.JiraKey); err != nil {
+			return fmt.Errorf("failed to move %s to sprint %s: %w", m.JiraKey, sprint.Name, err)
+		}
+		log.Printf("Moved Jira issue %s to sprint %s of board %d", m.JiraKey, sprint.Name, board)
+		e = jiraAudit("move_to_sprint", m.JiraKey, map[string]interface{}{"board": board, "sprint": sprint.Name})
+	}
+	e.Repo, e.Issue = repo.FullName(), issue.GetNumber()
+	recordAudit(e)
+	return nil
+}
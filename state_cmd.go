@@ -0,0 +1,387 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/idmap"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+const stateUsage = `Usage: gh-jira state <subcommand> [--output table|json|yaml] [flags]
+
+Subcommands:
+  list                    List all GitHub to Jira mappings
+  history [KEY]           Show the recorded changes of all mappings or of one mapping
+  duplicates              Show mappings that are the same logical issue under the current namespace config
+  merge [--dry-run]       Merge all duplicates, keeping the oldest Jira issue of each group
+  merge KEEP DUP...       Merge the mappings DUP... into KEEP
+  export [--format json|csv] [--file PATH]
+                          Write all state (json) or the mappings (csv) to PATH or stdout
+  import [--format json|csv] [--overwrite] [--dry-run] FILE
+                          Load an export or a CSV of repo,issue_number,jira_key; FILE may be -
+  migrate --to-backend B [--to-dsn DSN] [--overwrite] [--dry-run]
+                          Copy all state into another backend
+`
+
+// mappingList is the output of `state list`
+type mappingList struct {
+	Mappings []*state.Mapping `json:"mappings"`
+}
+
+// historyList is the output of `state history`
+type historyList struct {
+	History []*state.HistoryEntry `json:"history"`
+}
+
+// duplicateGroup is a set of mappings of the same logical issue
+type duplicateGroup struct {
+	Key      string           `json:"key"`
+	Mappings []*state.Mapping `json:"mappings"`
+}
+
+// duplicateReport is the output of `state duplicates`
+type duplicateReport struct {
+	Groups []duplicateGroup `json:"groups"`
+}
+
+// mergedMapping is a mapping merged into another one
+type mergedMapping struct {
+	Key     string `json:"key"`
+	JiraKey string `json:"jira_key"`
+}
+
+// mergeGroup describes the mappings merged into a surviving mapping
+type mergeGroup struct {
+	Into    string          `json:"into"`
+	JiraKey string          `json:"jira_key"`
+	Issue   string          `json:"issue,omitempty"`
+	Merged  []mergedMapping `json:"merged"`
+}
+
+// mergeReport is the output of `state merge`
+type mergeReport struct {
+	DryRun bool         `json:"dry_run"`
+	Groups []mergeGroup `json:"groups"`
+	// ObsoleteJiraKeys are duplicate Jira issues that can be closed
+	ObsoleteJiraKeys []string `json:"obsolete_jira_keys"`
+}
+
+// runStateCommand implements `gh-jira state`
+func runStateCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, stateUsage)
+		return exitFatal
+	}
+
+	fs := flag.NewFlagSet("state "+args[0], flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("GH_JIRA_CONFIG"), "Path to an optional YAML configuration file")
+	dryRun := fs.Bool("dry-run", false, "Only report what merge, import or migrate would change")
+	output := outputFlag(fs)
+	format := fs.String("format", "json", "Export or import format: json or csv")
+	file := fs.String("file", "", "File to export to instead of stdout")
+	overwrite := fs.Bool("overwrite", false, "Replace existing mappings and cursors on import")
+	toBackend := fs.String("to-backend", "", "State backend to migrate to")
+	toDSN := fs.String("to-dsn", "", "DSN of the state backend to migrate to")
+	if err := fs.Parse(args[1:]); err != nil {
+		return exitFatal
+	}
+	if err := validOutput(*output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+
+	c, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	s, err := state.Open(c.State.Backend, c.State.DSN)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	defer s.Close()
+
+	ctx := context.Background()
+	switch args[0] {
+	case "list":
+		err = listMappings(ctx, s, *output)
+	case "history":
+		err = showHistory(ctx, s, fs.Arg(0), *output)
+	case "duplicates":
+		err = showDuplicates(ctx, c, s, *output)
+	case "merge":
+		report := &mergeReport{DryRun: *dryRun, Groups: []mergeGroup{}, ObsoleteJiraKeys: []string{}}
+		if fs.NArg() > 0 {
+			var group *mergeGroup
+			if group, err = mergeMappings(ctx, s, fs.Arg(0), fs.Args()[1:], *dryRun); err == nil {
+				report.Groups = append(report.Groups, *group)
+			}
+		} else {
+			err = mergeDuplicates(ctx, c, s, report)
+		}
+		if err == nil {
+			err = writeOutput(os.Stdout, *output, report, report.writeTable)
+		}
+	case "export":
+		err = exportState(ctx, s, *format, *file)
+	case "import":
+		if fs.NArg() != 1 {
+			fmt.Fprint(os.Stderr, stateUsage)
+			return exitFatal
+		}
+		err = importState(ctx, c, s, *format, fs.Arg(0), *overwrite, *dryRun, *output)
+	case "migrate":
+		err = migrateState(ctx, s, *toBackend, *toDSN, *overwrite, *dryRun, *output)
+	default:
+		fmt.Fprint(os.Stderr, stateUsage)
+		return exitFatal
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitPartialFailure
+	}
+	return exitOK
+}
+
+func listMappings(ctx context.Context, s state.Store, output string) error {
+	ms, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+	if ms == nil {
+		ms = []*state.Mapping{}
+	}
+	return writeOutput(os.Stdout, output, mappingList{Mappings: ms}, func(out io.Writer) error {
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tISSUE\tJIRA\tSTATUS\tLAST SYNCED\tMERGED INTO\tCREATED")
+		for _, m := range ms {
+			fmt.Fprintf(w, "%s\t%s#%d\t%s\t%s\t%s\t%s\t%s\n", m.Key, m.Repo, m.IssueNumber, m.JiraKey, m.SyncStatus,
+				formatTime(m.LastSyncedAt), m.MergedInto, m.CreatedAt.Format(time.RFC3339))
+		}
+		return w.Flush()
+	})
+}
+
+func showHistory(ctx context.Context, s state.Store, key, output string) error {
+	hs, err := s.History(ctx, key)
+	if err != nil {
+		return err
+	}
+	return writeOutput(os.Stdout, output, historyList{History: hs}, func(out io.Writer) error {
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "CHANGED\tKEY\tJIRA\tSTATUS\tBODY HASH\tMERGED INTO")
+		for _, h := range hs {
+			hash := h.BodyHash
+			if len(hash) > 12 {
+				hash = hash[:12]
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", h.ChangedAt.Format(time.RFC3339), h.Key, h.JiraKey, h.SyncStatus, hash, h.MergedInto)
+		}
+		return w.Flush()
+	})
+}
+
+// formatTime formats t for tables, leaving unset times empty
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// duplicateGroups groups the active mappings by the canonical key they
+// would get under the current namespace configuration and returns the
+// groups whose members are stored under more than one key
+func duplicateGroups(ctx context.Context, c *config.Config, s state.Store) (map[string][]*state.Mapping, error) {
+	ms, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	namespaces := repoNamespaces(c)
+	groups := make(map[string][]*state.Mapping)
+	for _, m := range ms {
+		if m.MergedInto != "" || m.JiraKey == "" {
+			continue
+		}
+		key, err := canonicalKey(c, namespaces, m)
+		if err != nil {
+			return nil, fmt.Errorf("mapping %s: %w", m.Key, err)
+		}
+		groups[key] = append(groups[key], m)
+	}
+
+	for key, group := range groups {
+		if len(group) == 1 && group[0].Key == key {
+			delete(groups, key)
+			continue
+		}
+		sort.Slice(group, func(i, j int) bool { return group[i].CreatedAt.Before(group[j].CreatedAt) })
+	}
+	return groups, nil
+}
+
+// repoNamespaces returns the namespace of each watched repository by name
+func repoNamespaces(c *config.Config) map[string]string {
+	namespaces := make(map[string]string)
+	for _, r := range c.GitHub.WatchedRepos() {
+		namespaces[r.FullName()] = r.NamespaceName()
+	}
+	return namespaces
+}
+
+// canonicalKey returns the key of a mapping under the current namespace
+// configuration. Repositories that aren't watched are their own namespace.
+func canonicalKey(c *config.Config, namespaces map[string]string, m *state.Mapping) (string, error) {
+	ns, ok := namespaces[m.Repo]
+	if !ok {
+		ns = m.Repo
+	}
+	return idmap.Key(ns, c.GitHub.IDStrategy(ns), idmap.Issue{
+		Repo:   m.Repo,
+		Number: m.IssueNumber,
+		ID:     m.IssueID,
+		NodeID: m.NodeID,
+	})
+}
+
+func showDuplicates(ctx context.Context, c *config.Config, s state.Store, output string) error {
+	groups, err := duplicateGroups(ctx, c, s)
+	if err != nil {
+		return err
+	}
+	report := duplicateReport{Groups: []duplicateGroup{}}
+	for _, key := range sortedKeys(groups) {
+		report.Groups = append(report.Groups, duplicateGroup{Key: key, Mappings: groups[key]})
+	}
+	return writeOutput(os.Stdout, output, report, func(w io.Writer) error {
+		if len(report.Groups) == 0 {
+			fmt.Fprintln(w, "No duplicates found")
+			return nil
+		}
+		for _, g := range report.Groups {
+			fmt.Fprintf(w, "%s\n", g.Key)
+			for _, m := range g.Mappings {
+				fmt.Fprintf(w, "  %-40s %s#%d -> %s\n", m.Key, m.Repo, m.IssueNumber, m.JiraKey)
+			}
+		}
+		return nil
+	})
+}
+
+// mergeDuplicates stores every duplicate group under its canonical key,
+// pointing at the oldest Jira issue, and marks the other members as merged
+func mergeDuplicates(ctx context.Context, c *config.Config, s state.Store, report *mergeReport) error {
+	groups, err := duplicateGroups(ctx, c, s)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range sortedKeys(groups) {
+		group := groups[key]
+		keep := group[0]
+
+		var dups []string
+		if keep.Key != key {
+			canonical := *keep
+			canonical.Key = key
+			if !report.DryRun {
+				if err := s.Put(ctx, &canonical); err != nil {
+					return err
+				}
+			}
+			dups = append(dups, keep.Key)
+		}
+		for _, m := range group[1:] {
+			dups = append(dups, m.Key)
+			if m.JiraKey != keep.JiraKey {
+				report.ObsoleteJiraKeys = append(report.ObsoleteJiraKeys, m.JiraKey)
+			}
+		}
+		merged, err := mergeMappings(ctx, s, key, dups, report.DryRun)
+		if err != nil {
+			return err
+		}
+		merged.JiraKey = keep.JiraKey
+		merged.Issue = fmt.Sprintf("%s#%d", keep.Repo, keep.IssueNumber)
+		report.Groups = append(report.Groups, *merged)
+	}
+	return nil
+}
+
+// mergeMappings marks the mappings stored under dups as merged into keep
+func mergeMappings(ctx context.Context, s state.Store, keep string, dups []string, dryRun bool) (*mergeGroup, error) {
+	target, err := state.Resolve(ctx, s, keep)
+	if errors.Is(err, state.ErrNotFound) && dryRun {
+		// The canonical mapping is only written when not in dry-run mode
+		target = &state.Mapping{Key: keep}
+	} else if err != nil {
+		return nil, fmt.Errorf("mapping %s: %w", keep, err)
+	}
+
+	group := &mergeGroup{Into: target.Key, JiraKey: target.JiraKey, Merged: []mergedMapping{}}
+	if target.Repo != "" {
+		group.Issue = fmt.Sprintf("%s#%d", target.Repo, target.IssueNumber)
+	}
+	for _, key := range dups {
+		m, err := s.Get(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("mapping %s: %w", key, err)
+		}
+		if key == target.Key {
+			continue
+		}
+		group.Merged = append(group.Merged, mergedMapping{Key: key, JiraKey: m.JiraKey})
+		if dryRun {
+			continue
+		}
+		m.MergedInto = target.Key
+		m.UpdatedAt = time.Now().UTC()
+		if err := s.Put(ctx, m); err != nil {
+			return nil, err
+		}
+	}
+	return group, nil
+}
+
+// writeTable renders the merge report for humans
+func (r *mergeReport) writeTable(w io.Writer) error {
+	if len(r.Groups) == 0 {
+		fmt.Fprintln(w, "No duplicates found")
+		return nil
+	}
+	for _, g := range r.Groups {
+		if g.Issue != "" {
+			fmt.Fprintf(w, "%s: keeping %s (%s)\n", g.Into, g.JiraKey, g.Issue)
+		} else {
+			fmt.Fprintf(w, "%s:\n", g.Into)
+		}
+		for _, m := range g.Merged {
+			fmt.Fprintf(w, "  merging %s (%s) into %s\n", m.Key, m.JiraKey, g.Into)
+		}
+	}
+	if len(r.ObsoleteJiraKeys) > 0 {
+		fmt.Fprintf(w, "\nDuplicate Jira issues that can be closed: %s\n", strings.Join(r.ObsoleteJiraKeys, ", "))
+	}
+	return nil
+}
+
+func sortedKeys(groups map[string][]*state.Mapping) []string {
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
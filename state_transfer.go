@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+// mappingCSVColumns are the columns written by `state export --format csv`.
+// Imports only require repo, issue_number and jira_key; the key is derived
+// from the namespace configuration when missing.
+var mappingCSVColumns = []string{
+	"key", "namespace", "repo", "issue_number", "issue_id", "node_id", "jira_key",
+	"sync_status", "last_synced_at", "merged_into", "created_at",
+}
+
+// exportState writes the content of the store to path, or stdout if path
+// is "" or "-"
+func exportState(ctx context.Context, s state.Store, format, path string) error {
+	d, err := state.Export(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	if path == "" || path == "-" {
+		return writeDump(os.Stdout, d, format)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeDump(f, d, format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeDump(out io.Writer, d *state.Dump, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	case "csv":
+		return writeMappingsCSV(out, d.Mappings)
+	default:
+		return fmt.Errorf("invalid export format %q, must be json or csv", format)
+	}
+}
+
+func writeMappingsCSV(out io.Writer, ms []*state.Mapping) error {
+	w := csv.NewWriter(out)
+	if err := w.Write(mappingCSVColumns); err != nil {
+		return err
+	}
+	for _, m := range ms {
+		err := w.Write([]string{
+			m.Key, m.Namespace, m.Repo, strconv.Itoa(m.IssueNumber), strconv.FormatInt(m.IssueID, 10), m.NodeID,
+			m.JiraKey, m.SyncStatus, formatTime(m.LastSyncedAt), m.MergedInto, formatTime(m.CreatedAt),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// importState reads a dump from path, or stdin if path is "-", into the store
+func importState(ctx context.Context, c *config.Config, s state.Store, format, path string, overwrite, dryRun bool, output string) error {
+	in := io.Reader(os.Stdin)
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var d state.Dump
+	switch format {
+	case "json":
+		if err := json.NewDecoder(in).Decode(&d); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	case "csv":
+		ms, err := readMappingsCSV(c, in)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		d.Mappings = ms
+	default:
+		return fmt.Errorf("invalid import format %q, must be json or csv", format)
+	}
+
+	stats, err := state.Import(ctx, s, &d, overwrite, dryRun)
+	if err != nil {
+		return err
+	}
+	return writeImportStats(stats, dryRun, output)
+}
+
+// migrateState copies the content of the configured store into another backend
+func migrateState(ctx context.Context, s state.Store, backend, dsn string, overwrite, dryRun bool, output string) error {
+	if backend == "" {
+		return fmt.Errorf("--to-backend is required")
+	}
+	d, err := state.Export(ctx, s)
+	if err != nil {
+		return err
+	}
+	target, err := state.Open(backend, dsn)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	stats, err := state.Import(ctx, target, d, overwrite, dryRun)
+	if err != nil {
+		return err
+	}
+	return writeImportStats(stats, dryRun, output)
+}
+
+func writeImportStats(stats *state.ImportStats, dryRun bool, output string) error {
+	return writeOutput(os.Stdout, output, stats, func(w io.Writer) error {
+		verb := "Imported"
+		if dryRun {
+			verb = "Would import"
+		}
+		fmt.Fprintf(w, "%s %d mappings (%d already present), %d cursors, %d snapshots, %d approvals, %d retries\n",
+			verb, stats.Mappings, stats.SkippedMappings, stats.Cursors, stats.Snapshots, stats.Approvals, stats.Retries)
+		if stats.SkippedSnapshots > 0 || stats.SkippedApprovals > 0 {
+			fmt.Fprintf(w, "Skipped %d snapshots and %d approvals as the target already has some\n",
+				stats.SkippedSnapshots, stats.SkippedApprovals)
+		}
+		return nil
+	})
+}
+
+// readMappingsCSV reads mappings from a CSV file with a header row
+func readMappingsCSV(c *config.Config, in io.Reader) ([]*state.Mapping, error) {
+	r := csv.NewReader(in)
+	header, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	cols := make(map[string]int, len(header))
+	for i, name := range header {
+		cols[strings.TrimSpace(strings.ToLower(name))] = i
+	}
+	for _, required := range []string{"repo", "issue_number", "jira_key"} {
+		if _, ok := cols[required]; !ok {
+			return nil, fmt.Errorf("missing column %q", required)
+		}
+	}
+
+	namespaces := repoNamespaces(c)
+	now := time.Now().UTC()
+	var ms []*state.Mapping
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := r.FieldPos(0)
+		get := func(name string) string {
+			if i, ok := cols[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		m := &state.Mapping{
+			Key:        get("key"),
+			Namespace:  get("namespace"),
+			Repo:       get("repo"),
+			NodeID:     get("node_id"),
+			JiraKey:    get("jira_key"),
+			SyncStatus: get("sync_status"),
+			MergedInto: get("merged_into"),
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+		if m.IssueNumber, err = strconv.Atoi(get("issue_number")); err != nil {
+			return nil, fmt.Errorf("line %d: invalid issue_number: %w", line, err)
+		}
+		if v := get("issue_id"); v != "" {
+			if m.IssueID, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return nil, fmt.Errorf("line %d: invalid issue_id: %w", line, err)
+			}
+		}
+		if m.LastSyncedAt, err = parseCSVTime(get("last_synced_at")); err != nil {
+			return nil, fmt.Errorf("line %d: invalid last_synced_at: %w", line, err)
+		}
+		if v := get("created_at"); v != "" {
+			if m.CreatedAt, err = parseCSVTime(v); err != nil {
+				return nil, fmt.Errorf("line %d: invalid created_at: %w", line, err)
+			}
+		}
+		if m.Repo == "" || m.JiraKey == "" {
+			return nil, fmt.Errorf("line %d: repo and jira_key are required", line)
+		}
+		if m.Namespace == "" {
+			if m.Namespace = namespaces[m.Repo]; m.Namespace == "" {
+				m.Namespace = m.Repo
+			}
+		}
+		if m.SyncStatus == "" {
+			m.SyncStatus = state.StatusSynced
+		}
+		if m.Key == "" {
+			if m.Key, err = canonicalKey(c, namespaces, m); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		ms = append(ms, m)
+	}
+	return ms, nil
+}
+
+func parseCSVTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
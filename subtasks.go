@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/jira"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+// taskItemPattern matches a task list item such as "- [x] Write docs"
+var taskItemPattern = regexp.MustCompile(`^\s*[-*+]\s+\[([ xX])\]\s+(.+?)\s*$`)
+
+// maxSummaryLength is the longest summary Jira accepts
+const maxSummaryLength = 255
+
+// taskItem is an item of a GitHub task list
+type taskItem struct {
+	Text string
+	Done bool
+}
+
+// subtask is the Jira subtask of a task list item
+type subtask struct {
+	Text string `json:"text"`
+	Key  string `json:"key"`
+	Done bool   `json:"done"`
+}
+
+// parseTaskList returns the task list items of an issue body, ignoring
+// code blocks
+func parseTaskList(body string) []taskItem {
+	var items []taskItem
+	inCode := false
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+		if m := taskItemPattern.FindStringSubmatch(line); m != nil {
+			items = append(items, taskItem{Text: m[2], Done: m[1] != " "})
+		}
+	}
+	return items
+}
+
+// subtasksCursor names the state cursor holding the subtasks of a synced
+// issue as JSON
+func subtasksCursor(key string) string {
+	return "subtasks:" + key
+}
+
+// syncSubtasks creates a Jira subtask for each new task list item of the
+// GitHub issue and completes or reopens the subtasks whose item was checked
+// or unchecked. Subtasks of removed items are left alone.
+func syncSubtasks(ctx context.Context, repo config.RepoConfig, issue *github.Issue, m *state.Mapping) error {
+	if !cfg().Jira.Subtasks.Enabled || m.JiraKey == "" {
+		return nil
+	}
+	items := parseTaskList(redactor.Redact(issue.GetBody()))
+	stored, err := store.GetCursor(ctx, subtasksCursor(m.Key))
+	if err != nil {
+		return err
+	}
+	var tasks []*subtask
+	if stored != "" {
+		if err := json.Unmarshal([]byte(stored), &tasks); err != nil {
+			return fmt.Errorf("invalid subtasks of %s: %w", m.Key, err)
+		}
+	}
+	if len(items) == 0 && len(tasks) == 0 {
+		return nil
+	}
+	jc, err := jiraFor(m.JiraInstance)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	defer func() {
+		if !changed {
+			return
+		}
+		data, _ := json.Marshal(tasks)
+		if err := store.SetCursor(ctx, subtasksCursor(m.Key), string(data)); err != nil {
+			log.Printf("Failed to record subtasks of %s: %v", m.JiraKey, err)
+		}
+	}()
+
+	used := make(map[*subtask]bool)
+	for _, item := range items {
+		t := matchSubtask(tasks, used, item.Text)
+		if t == nil {
+			key, err := createSubtask(ctx, jc, repo, issue, m, item.Text)
+			if err != nil {
+				return err
+			}
+			t = &subtask{Text: item.Text, Key: key}
+			tasks = append(tasks, t)
+			used[t] = true
+			changed = true
+		}
+		if t.Done == item.Done {
+			continue
+		}
+		if err := setSubtaskDone(ctx, jc, repo, issue, t.Key, item.Done); err != nil {
+			return err
+		}
+		t.Done = item.Done
+		changed = true
+	}
+	return nil
+}
+
+// matchSubtask returns the first subtask with the given text that wasn't
+// matched to another item yet
+func matchSubtask(tasks []*subtask, used map[*subtask]bool, text string) *subtask {
+	for _, t := range tasks {
+		if !used[t] && t.Text == text {
+			used[t] = true
+			return t
+		}
+	}
+	return nil
+}
+
+// createSubtask creates the subtask of a task list item under the Jira issue
+// of a mapping
+func createSubtask(ctx context.Context, jc *jira.Client, repo config.RepoConfig, issue *github.Issue, m *state.Mapping, text string) (string, error) {
+	project, _, _ := strings.Cut(m.JiraKey, "-")
+	summary := truncateSummary(text)
+	fields := map[string]interface{}{
+		"project":   map[string]string{"key": project},
+		"parent":    map[string]string{"key": m.JiraKey},
+		"issuetype": map[string]string{"name": cfg().Jira.Subtasks.IssueType},
+		"summary":   summary,
+	}
+	created, err := jc.CreateIssue(ctx, fields)
+	if err != nil {
+		return "", fmt.Errorf("failed to create subtask %q of %s: %w", summary, m.JiraKey, err)
+	}
+	log.Printf("Created subtask %s of %s for task %q of GitHub issue #%d", created.Key, m.JiraKey, summary, issue.GetNumber())
+	e := jiraAudit("create_issue", created.Key, map[string]interface{}{"fields": fieldNames(fields), "parent": m.JiraKey})
+	e.Repo, e.Issue = repo.FullName(), issue.GetNumber()
+	recordAudit(e)
+	return created.Key, nil
+}
+
+// setSubtaskDone moves a subtask to a done status, or back to a to-do
+// status, through the first transition leading there
+func setSubtaskDone(ctx context.Context, jc *jira.Client, repo config.RepoConfig, issue *github.Issue, key string, done bool) error {
+	category, resolution := "new", ""
+	if done {
+		category, resolution = "done", cfg().Jira.Subtasks.Resolution
+	}
+	t, err := transitionToCategory(ctx, jc, repo, issue, key, category, resolution)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return fmt.Errorf("subtask %s has no transition to a %s status", key, category)
+	}
+	log.Printf("Transitioned subtask %s to %s", key, t.To.Name)
+	return nil
+}
+
+// transitionToCategory moves a Jira issue through the first transition to a
+// status of the category ("new", "indeterminate" or "done"), setting the
+// resolution if one is given. It returns the transition, or nil if there is
+// none.
+func transitionToCategory(ctx context.Context, jc *jira.Client, repo config.RepoConfig, issue *github.Issue, key, category, resolution string) (*jira.Transition, error) {
+	transitions, err := jc.Transitions(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the transitions of %s: %w", key, err)
+	}
+	for _, t := range transitions {
+		if t.To.StatusCategory.Key != category {
+			continue
+		}
+		var fields map[string]interface{}
+		if resolution != "" {
+			fields = map[string]interface{}{"resolution": map[string]string{"name": resolution}}
+		}
+		if err := jc.TransitionIssue(ctx, key, t.ID, fields); err != nil {
+			return nil, fmt.Errorf("failed to transition %s to %s: %w", key, t.To.Name, err)
+		}
+		e := jiraAudit("transition", key, map[string]interface{}{"transition": t.Name, "status": t.To.Name})
+		e.Repo, e.Issue = repo.FullName(), issue.GetNumber()
+		recordAudit(e)
+		return t, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/savitaashture/gh-jira/pkg/summarizer"
+)
+
+// summaryOutput is the output of `summarize`
+type summaryOutput struct {
+	Repo    string `json:"repo,omitempty"`
+	Issue   int    `json:"issue,omitempty"`
+	Model   string `json:"model"`
+	Summary string `json:"summary"`
+}
+
+// runSummarizeCommand implements `gh-jira summarize`
+func runSummarizeCommand(args []string) int {
+	conf := cfg()
+	fs := flag.NewFlagSet("summarize", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("GH_JIRA_CONFIG"), "Path to an optional YAML configuration file")
+	repoName := fs.String("repo", "", "Repository as owner/name (defaults to the only configured repository)")
+	number := fs.Int("issue", 0, "Number of the GitHub issue to summarize")
+	stdin := fs.Bool("stdin", false, "Summarize the issue description read from standard input")
+	model := fs.String("model", "", "Ollama model generating the summary, without fallbacks (default: summarizer.model)")
+	stream := fs.Bool("stream", false, "Print the summary while it is generated (table output only)")
+	output := outputFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return exitFatal
+	}
+	if err := validOutput(*output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	if *stream && *output != outputTable {
+		fmt.Fprintf(os.Stderr, "Error: --stream only works with table output\n")
+		return exitFatal
+	}
+	if (*number > 0) == *stdin || fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "Error: pass either --issue N or --stdin\n")
+		return exitFatal
+	}
+
+	if _, err := setup(*configPath, 0, -1); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	defer store.Close()
+	if *model == "" {
+		*model = conf.Summarizer.Model
+	}
+	sum, err := summarizer.New(summarizer.Config{
+		Model:     *model,
+		AutoPull:  conf.Summarizer.AutoPull,
+		MaxLength: conf.Summarizer.MaxLength,
+		MaxTokens: conf.Summarizer.MaxTokens,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+
+	ctx := context.Background()
+	out := &summaryOutput{Model: *model}
+	body, prompt := "", issuePrompt
+	if *stdin {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to read standard input: %v\n", err)
+			return exitFatal
+		}
+		body = string(data)
+	} else {
+		repo, err := selectRepo(*repoName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitFatal
+		}
+		if err := ghRateLimit.wait(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitFatal
+		}
+		client := newGitHubClient(ctx)
+		issue, resp, err := client.Issues.Get(ctx, repo.Owner, repo.Name, *number)
+		ghRateLimit.observe(resp, err)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to get issue #%d of %s: %v\n", *number, repo.FullName(), err)
+			return exitFatal
+		}
+		out.Repo, out.Issue = repo.FullName(), *number
+		if prompt, body = issueSummaryInput(repo, issue, issueBody(issue)); body == "" {
+			fmt.Fprintf(os.Stderr, "Error: issue #%d of %s has neither a description nor a title to summarize\n", *number, repo.FullName())
+			return exitFatal
+		}
+	}
+
+	log.Printf("Summarizing %d characters with model %s", len(body), *model)
+	var onChunk func(string) error
+	if *stream {
+		onChunk = func(chunk string) error {
+			_, err := io.WriteString(os.Stdout, chunk)
+			return err
+		}
+	}
+	if out.Summary, err = summarizeText(ctx, sum, prompt, body, onChunk); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to generate summary: %v\n", err)
+		return exitFatal
+	}
+	if *stream {
+		fmt.Println()
+		return exitOK
+	}
+	if err := writeOutput(os.Stdout, *output, out, out.writeTable); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	return exitOK
+}
+
+// writeTable prints the summary alone so it can be diffed between models
+func (s *summaryOutput) writeTable(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "%s\n", s.Summary)
+	return err
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+)
+
+// repoTemplates holds the prompt and Jira description template a
+// repository uses instead of the built-in ones
+type repoTemplates struct {
+	prompt      string
+	description *template.Template
+}
+
+// templateFuncs are the functions available in Jira templates besides the
+// text/template built-ins
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// issueTemplateData is the data Jira templates are executed with
+type issueTemplateData struct {
+	// Source is the tracker of the issue, GitHub or e.g. GitLab
+	Source string
+	// Repo is the owner/name of the repository
+	Repo   string
+	Number int
+	Title  string
+	URL    string
+	Body   string
+	// Author is the GitHub login of the author of the issue
+	Author string
+	// AuthorInJira is set when the author is mapped to a Jira user, who is
+	// set as the reporter
+	AuthorInJira bool
+	Labels       []string
+	// PlusOnes is the number of 👍 reactions
+	PlusOnes int
+	// Summary is the AI summary of the description
+	Summary string
+	// Issue is the GitHub issue with all its fields, not redacted
+	Issue *github.Issue
+}
+
+// newIssueTemplateData returns the template data of an issue of repo
+func newIssueTemplateData(repo config.RepoConfig, issue *github.Issue, summary string) *issueTemplateData {
+	author := issue.GetUser().GetLogin()
+	return &issueTemplateData{
+		Source:       issueSource(repo),
+		Repo:         repo.FullName(),
+		Number:       issue.GetNumber(),
+		Title:        redactor.Redact(issue.GetTitle()),
+		URL:          issue.GetHTMLURL(),
+		Body:         redactor.Redact(issueBody(issue)),
+		Author:       author,
+		AuthorInJira: author != "" && cfg().JiraUser(author) != "",
+		Labels:       ruleIssue(issue).Labels,
+		PlusOnes:     plusOnes(issue),
+		Summary:      summary,
+		Issue:        issue,
+	}
+}
+
+// The built-in Jira templates, used when executing the configured ones
+// fails
+var (
+	builtinSummary     = template.Must(newTemplate("summary").Parse(config.DefaultSummaryTemplate))
+	builtinDescription = template.Must(newTemplate("description").Parse(config.DefaultDescriptionTemplate))
+)
+
+// newTemplate returns an empty Jira template with templateFuncs
+func newTemplate(name string) *template.Template {
+	return template.New(name).Funcs(templateFuncs)
+}
+
+// loadTemplates parses the Jira summary and description templates of the
+// settings and reads the prompt and description templates of their
+// repositories
+func loadTemplates(s *settings) error {
+	var err error
+	if s.summaryTemplate, err = newTemplate("summary").Parse(s.cfg.Jira.SummaryTemplate); err != nil {
+		return fmt.Errorf("invalid Jira summary template: %w", err)
+	}
+	if s.descriptionTemplate, err = newTemplate("description").Parse(s.cfg.Jira.DescriptionTemplate); err != nil {
+		return fmt.Errorf("invalid Jira description template: %w", err)
+	}
+	warnUntraceable(s.descriptionTemplate, "the Jira description template")
+
+	s.repoOverrides = make(map[string]*repoTemplates)
+	for _, r := range s.cfg.GitHub.WatchedRepos() {
+		if r.PromptFile == "" && r.DescriptionTemplate == "" {
+			continue
+		}
+		t := &repoTemplates{}
+		if r.PromptFile != "" {
+			data, err := os.ReadFile(r.PromptFile)
+			if err != nil {
+				return fmt.Errorf("failed to read the prompt of %s: %w", r.FullName(), err)
+			}
+			if !strings.Contains(string(data), "%s") {
+				return fmt.Errorf("prompt file %s of %s has no %%s for the issue description", r.PromptFile, r.FullName())
+			}
+			t.prompt = string(data)
+			log.Printf("Summarizing the issues of %s with the prompt in %s", r.FullName(), r.PromptFile)
+		}
+		if r.DescriptionTemplate != "" {
+			tmpl, err := newTemplate(filepath.Base(r.DescriptionTemplate)).ParseFiles(r.DescriptionTemplate)
+			if err != nil {
+				return fmt.Errorf("invalid description template of %s: %w", r.FullName(), err)
+			}
+			t.description = tmpl
+			log.Printf("Writing the Jira descriptions of %s with the template in %s", r.FullName(), r.DescriptionTemplate)
+			warnUntraceable(tmpl, "the description template of "+r.FullName())
+		}
+		s.repoOverrides[strings.ToLower(r.FullName())] = t
+	}
+	return nil
+}
+
+// warnUntraceable warns about description templates without the line
+// reconcile finds the Jira issues created by gh-jira by
+func warnUntraceable(t *template.Template, what string) {
+	if text := t.Root.String(); !strings.Contains(text, "Imported from GitHub") && !strings.Contains(text, "Imported from {{.Source}}") {
+		log.Printf("Warning: %s has no \"Imported from GitHub\" line, so reconcile won't find its Jira issues", what)
+	}
+}
+
+// executeTemplate renders t with data, or the built-in template if that
+// fails
+func executeTemplate(t, builtin *template.Template, data *issueTemplateData) string {
+	var b strings.Builder
+	err := t.Execute(&b, data)
+	if err == nil {
+		return b.String()
+	}
+	log.Printf("Failed to execute the Jira %s template for GitHub issue %s#%d, using the built-in one: %v", t.Name(), data.Repo, data.Number, err)
+	b.Reset()
+	if err := builtin.Execute(&b, data); err != nil {
+		log.Printf("Failed to execute the built-in Jira %s template: %v", builtin.Name(), err)
+	}
+	return b.String()
+}
+
+// jiraSummary renders the summary of the Jira issue of a GitHub issue: a
+// single line of at most maxSummaryLength characters
+func (s *settings) jiraSummary(repo config.RepoConfig, issue *github.Issue, summary string) string {
+	line := strings.Join(strings.Fields(executeTemplate(s.summaryTemplate, builtinSummary, newIssueTemplateData(repo, issue, summary))), " ")
+	return truncateSummary(line)
+}
+
+// truncateSummary shortens a Jira summary to maxSummaryLength characters
+func truncateSummary(summary string) string {
+	if r := []rune(summary); len(r) > maxSummaryLength {
+		return string(r[:maxSummaryLength-1]) + "…"
+	}
+	return summary
+}
+
+// jiraDescription renders the Jira description of a synced GitHub issue
+// with the description template of its repository, or the configured one
+func (s *settings) jiraDescription(repo config.RepoConfig, issue *github.Issue, summary string) string {
+	t := s.descriptionTemplate
+	if rt := s.repoTemplates(repo); rt != nil && rt.description != nil {
+		t = rt.description
+	}
+	return executeTemplate(t, builtinDescription, newIssueTemplateData(repo, issue, summary))
+}
+
+// repoTemplatesFor returns the templates of repo, or nil if it uses the
+// built-in ones
+func repoTemplatesFor(repo config.RepoConfig) *repoTemplates {
+	return current().repoTemplates(repo)
+}
+
+// repoTemplates returns the templates of repo in s, or nil if it uses the
+// built-in ones
+func (s *settings) repoTemplates(repo config.RepoConfig) *repoTemplates {
+	return s.repoOverrides[strings.ToLower(repo.FullName())]
+}
+
+// issuePromptFor returns the prompt summarizing the issues of repo
+func issuePromptFor(repo config.RepoConfig) string {
+	if t := repoTemplatesFor(repo); t != nil && t.prompt != "" {
+		return t.prompt
+	}
+	return issuePrompt
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/savitaashture/gh-jira/pkg/httpclient"
+	"github.com/savitaashture/gh-jira/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer records the spans of the sync pipeline. It discards them unless
+// initTracing installed an exporter.
+var tracer = otel.Tracer("github.com/savitaashture/gh-jira")
+
+// initTracing exports traces if a collector is configured and returns the
+// function flushing them on exit
+func initTracing() (func(), error) {
+	conf := cfg()
+	if !tracing.Enabled(conf.Tracing.Endpoint) {
+		return func() {}, nil
+	}
+	// The exporter gets an untraced client so exports don't create spans
+	exportHTTP, err := httpclient.New(httpOptions())
+	if err != nil {
+		return nil, err
+	}
+	shutdown, err := tracing.Setup(context.Background(), tracing.Config{
+		Endpoint:    conf.Tracing.Endpoint,
+		SampleRatio: conf.Tracing.SampleRatio,
+		HTTPClient:  exportHTTP,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	log.Printf("Exporting traces (sample ratio %v)", conf.Tracing.SampleRatio)
+
+	// Record the requests to GitHub, Jira and Ollama as child spans
+	http.DefaultClient.Transport = tracing.Transport(http.DefaultClient.Transport)
+	ghHTTP.Transport = tracing.Transport(ghHTTP.Transport)
+	jiraHTTP.Transport = tracing.Transport(jiraHTTP.Transport)
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			log.Printf("Failed to flush traces: %v", err)
+		}
+	}, nil
+}
+
+// startSpan starts a span of the sync pipeline
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends span, marking it failed if err is set
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		tracing.Fail(span, err)
+	}
+	span.End()
+}
+
+// issueAttrs identifies the GitHub issue of a span
+func issueAttrs(repo string, number int) []attribute.KeyValue {
+	return []attribute.KeyValue{attribute.String("github.repo", repo), attribute.Int("github.issue", number)}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+// isTransferOf reports whether a GitHub issue is the issue of a mapping that
+// was transferred from another repository. Transferred issues keep their ID
+// and node ID but get a new number in their new repository.
+func isTransferOf(m *state.Mapping, repo config.RepoConfig, issue *github.Issue) bool {
+	if m.Repo == repo.FullName() || isDiscussion(m) || fromSource(m.Repo) {
+		return false
+	}
+	return (m.IssueID != 0 && m.IssueID == issue.GetID()) || (m.NodeID != "" && m.NodeID == issue.GetNodeID())
+}
+
+// findTransferred returns the mapping of a GitHub issue that was synced in
+// another repository and has been transferred to repo since, or nil
+func findTransferred(ctx context.Context, repo config.RepoConfig, issue *github.Issue) (*state.Mapping, error) {
+	mappings, err := store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range mappings {
+		if m.MergedInto == "" && m.JiraKey != "" && isTransferOf(m, repo, issue) {
+			return m, nil
+		}
+	}
+	return nil, nil
+}
+
+// moveTransferred points the mapping of a transferred GitHub issue at its
+// new repository and number, under key, so that its Jira issue is kept
+// instead of a new one being created. A mapping moving to another key is
+// merged into the new one, and the per-issue cursors move along.
+func moveTransferred(ctx context.Context, repo config.RepoConfig, issue *github.Issue, key string, old *state.Mapping) (*state.Mapping, error) {
+	log.Printf("GitHub issue %s#%d was transferred to %s#%d, moving its mapping to %s", old.Repo, old.IssueNumber, repo.FullName(), issue.GetNumber(), old.JiraKey)
+	now := time.Now().UTC()
+	moved := *old
+	moved.Key = key
+	moved.Namespace = repo.NamespaceName()
+	moved.Repo = repo.FullName()
+	moved.IssueNumber = issue.GetNumber()
+	moved.IssueID = issue.GetID()
+	moved.NodeID = issue.GetNodeID()
+	moved.UpdatedAt = now
+	if err := store.Put(ctx, &moved); err != nil {
+		return nil, fmt.Errorf("failed to move mapping %s to %s: %w", old.Key, key, err)
+	}
+	if key != old.Key {
+		for _, cursor := range []func(string) string{commentsCursor, issueStateCursor, triageCursor} {
+			v, err := store.GetCursor(ctx, cursor(old.Key))
+			if err != nil {
+				return nil, err
+			}
+			if v != "" {
+				if err := store.SetCursor(ctx, cursor(key), v); err != nil {
+					return nil, err
+				}
+			}
+		}
+		old.MergedInto = key
+		old.UpdatedAt = now
+		if err := store.Put(ctx, old); err != nil {
+			return nil, fmt.Errorf("failed to merge mapping %s into %s: %w", old.Key, key, err)
+		}
+	}
+	recordAudit(githubAudit("transfer_issue", repo, issue.GetNumber(), map[string]interface{}{
+		"from": fmt.Sprintf("%s#%d", old.Repo, old.IssueNumber), "jira_key": old.JiraKey,
+	}))
+
+	if err := relinkJiraIssue(ctx, &moved, issue); err != nil {
+		// The mapping is moved, so the issue won't be synced twice
+		log.Printf("Failed to update the GitHub link of Jira issue %s: %v", moved.JiraKey, err)
+	}
+	return &moved, nil
+}
+
+// relinkJiraIssue points the "Imported from GitHub" line of the description
+// of a Jira issue at the new location of its transferred GitHub issue
+func relinkJiraIssue(ctx context.Context, m *state.Mapping, issue *github.Issue) error {
+	if isSink(m.JiraInstance) {
+		return nil
+	}
+	jc, err := jiraFor(m.JiraInstance)
+	if err != nil {
+		return err
+	}
+	ji, err := jc.GetIssue(ctx, m.JiraKey, []string{"description"})
+	if err != nil {
+		return fmt.Errorf("failed to get Jira issue %s: %w", m.JiraKey, err)
+	}
+	loc := importedFromPattern.FindStringIndex(ji.Fields.Description)
+	if loc == nil {
+		log.Printf("Jira issue %s has no \"Imported from GitHub\" line to update", m.JiraKey)
+		return nil
+	}
+	desc := ji.Fields.Description[:loc[0]] + "Imported from GitHub: " + issue.GetHTMLURL() + ji.Fields.Description[loc[1]:]
+	if err := jc.UpdateIssue(ctx, m.JiraKey, map[string]interface{}{"description": desc}); err != nil {
+		return fmt.Errorf("failed to update the description of %s: %w", m.JiraKey, err)
+	}
+	e := jiraAudit("update_issue", m.JiraKey, map[string]interface{}{"fields": []string{"description"}})
+	e.Repo, e.Issue = m.Repo, m.IssueNumber
+	recordAudit(e)
+	log.Printf("Pointed Jira issue %s at %s", m.JiraKey, issue.GetHTMLURL())
+	return nil
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/jira"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+// States of GitHub issues tracked for transitions
+const (
+	issueOpen       = "open"
+	issueCompleted  = "completed"
+	issueNotPlanned = "not_planned"
+)
+
+// transitionSampleSize is the number of recently updated issues of a Jira
+// project whose transitions are checked at startup
+const transitionSampleSize = 100
+
+// stateIssue is a GitHub issue with the reason it was closed for, which the
+// vendored go-github doesn't decode
+type stateIssue struct {
+	github.Issue
+	StateReason string `json:"state_reason"`
+}
+
+// state returns issueOpen, issueCompleted or issueNotPlanned
+func (i *stateIssue) state() string {
+	switch {
+	case i.GetState() != "closed":
+		return issueOpen
+	case i.StateReason == "not_planned":
+		return issueNotPlanned
+	default:
+		return issueCompleted
+	}
+}
+
+// transitionsCursor names the state cursor holding the time the issues of a
+// repository were last checked for state changes
+func transitionsCursor(repo config.RepoConfig) string {
+	return "transitions:" + repo.FullName()
+}
+
+// issueStateCursor names the state cursor holding the last seen state of
+// the GitHub issue of a mapping
+func issueStateCursor(key string) string {
+	return "issue-state:" + key
+}
+
+// syncTransitions applies the configured Jira transitions to the Jira
+// issues of the GitHub issues of a repository closed or reopened since the
+// last poll. Issues are listed by update, regardless of the issue state the
+// sync watches.
+func syncTransitions(ctx context.Context, client *github.Client, repo config.RepoConfig, result *cycleResult) error {
+	cursor := transitionsCursor(repo)
+	stored, err := store.GetCursor(ctx, cursor)
+	if err != nil {
+		return err
+	}
+	started := time.Now().UTC()
+	if stored == "" {
+		log.Printf("Watching the issues of %s for state changes from now on", repo.FullName())
+		return store.SetCursor(ctx, cursor, started.Format(time.RFC3339))
+	}
+	since, err := time.Parse(time.RFC3339, stored)
+	if err != nil {
+		return fmt.Errorf("invalid transitions cursor of %s: %w", repo.FullName(), err)
+	}
+
+	issues, err := listUpdatedIssues(ctx, client, repo, since)
+	if err != nil {
+		log.Printf("Error fetching updated issues of %s: %v", repo.FullName(), err)
+		if isAuthError(err) {
+			return fmt.Errorf("GitHub authentication failed: %w", err)
+		}
+		result.fail(repo.FullName(), 0, "transitions", err)
+		return nil
+	}
+	failed := false
+	for _, issue := range issues {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if issue.IsPullRequest() {
+			continue
+		}
+		if err := transitionIssue(ctx, repo, issue); err != nil {
+			log.Printf("Failed to transition the Jira issue of GitHub issue %s#%d: %v", repo.FullName(), issue.GetNumber(), err)
+			result.fail(repo.FullName(), issue.GetNumber(), "transition", err)
+			failed = true
+		}
+	}
+	if failed {
+		// The failed issues are listed again on the next poll
+		return nil
+	}
+	return store.SetCursor(ctx, cursor, started.Format(time.RFC3339))
+}
+
+// transitionIssue applies the transition of the state change of a GitHub
+// issue, if any, to its Jira issue
+func transitionIssue(ctx context.Context, repo config.RepoConfig, issue *stateIssue) error {
+	key, err := issueKey(repo, &issue.Issue)
+	if err != nil {
+		return err
+	}
+	m, err := lookupMapping(ctx, key)
+	if errors.Is(err, state.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	current := issue.state()
+	last, err := store.GetCursor(ctx, issueStateCursor(m.Key))
+	if err != nil {
+		return err
+	}
+	if last == "" {
+		last = issueOpen
+		if current != issueOpen && issue.ClosedAt != nil && m.CreatedAt.After(issue.ClosedAt.Time) {
+			// Synced while closed, as the closed issue policy decided
+			last = current
+		}
+	}
+	if last == current {
+		return nil
+	}
+
+	t := cfg().Jira.Transitions
+	var tc config.TransitionConfig
+	switch {
+	case current == issueOpen:
+		tc = t.Reopened
+	case last != issueOpen:
+		// Closed for another reason; the Jira issue stays where it is
+	case current == issueNotPlanned && t.NotPlanned.Name != "":
+		tc = t.NotPlanned
+	default:
+		tc = t.Closed
+	}
+	if tc.Name != "" && m.JiraKey != "" && !isSink(m.JiraInstance) {
+		jc, err := jiraFor(m.JiraInstance)
+		if err != nil {
+			return err
+		}
+		tr, err := transitionByName(ctx, jc, repo, &issue.Issue, m.JiraKey, tc)
+		if err != nil {
+			return err
+		}
+		if tr == nil {
+			log.Printf("Jira issue %s has no transition %q in its current status, leaving it unchanged", m.JiraKey, tc.Name)
+		} else {
+			log.Printf("Moved Jira issue %s of %s GitHub issue #%d to %s", m.JiraKey, stateVerb(current), issue.GetNumber(), tr.To.Name)
+		}
+	}
+	return store.SetCursor(ctx, issueStateCursor(m.Key), current)
+}
+
+// stateVerb describes a state change to state for logs
+func stateVerb(state string) string {
+	switch state {
+	case issueOpen:
+		return "reopened"
+	case issueNotPlanned:
+		return "closed as not planned"
+	default:
+		return "closed"
+	}
+}
+
+// transitionByName applies the transition of a Jira issue named like tc or
+// leading to a status named like it. It returns nil if the issue has no
+// such transition in its current status.
+func transitionByName(ctx context.Context, jc *jira.Client, repo config.RepoConfig, issue *github.Issue, key string, tc config.TransitionConfig) (*jira.Transition, error) {
+	transitions, err := jc.Transitions(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the transitions of %s: %w", key, err)
+	}
+	for _, t := range transitions {
+		if !matchesTransition(t, tc.Name) {
+			continue
+		}
+		var fields map[string]interface{}
+		if tc.Resolution != "" {
+			fields = map[string]interface{}{"resolution": map[string]string{"name": tc.Resolution}}
+		}
+		if err := jc.TransitionIssue(ctx, key, t.ID, fields); err != nil {
+			return nil, fmt.Errorf("failed to transition %s to %s: %w", key, t.To.Name, err)
+		}
+		e := jiraAudit("transition", key, map[string]interface{}{"transition": t.Name, "status": t.To.Name})
+		e.Repo, e.Issue = repo.FullName(), issue.GetNumber()
+		recordAudit(e)
+		return t, nil
+	}
+	return nil, nil
+}
+
+// matchesTransition reports whether a transition or the status it leads to
+// is named name
+func matchesTransition(t *jira.Transition, name string) bool {
+	return strings.EqualFold(t.Name, name) || strings.EqualFold(t.To.Name, name)
+}
+
+// listUpdatedIssues returns the issues and pull requests of a repository
+// updated since a time, in any state
+func listUpdatedIssues(ctx context.Context, client *github.Client, repo config.RepoConfig, since time.Time) ([]*stateIssue, error) {
+	query := url.Values{
+		"state":     {"all"},
+		"sort":      {"updated"},
+		"direction": {"asc"},
+		"since":     {since.Format(time.RFC3339)},
+		"per_page":  {"100"},
+	}
+	var all []*stateIssue
+	for page := 1; page != 0; {
+		query.Set("page", fmt.Sprint(page))
+		u := fmt.Sprintf("repos/%s/%s/issues?%s", url.PathEscape(repo.Owner), url.PathEscape(repo.Name), query.Encode())
+		if err := ghRateLimit.wait(ctx); err != nil {
+			return nil, err
+		}
+		req, err := client.NewRequest("GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		var issues []*stateIssue
+		resp, err := client.Do(ctx, req, &issues)
+		ghRateLimit.observe(resp, err)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list updated issues of %s: %w", repo.FullName(), err)
+		}
+		all = append(all, issues...)
+		page = resp.NextPage
+	}
+	return all, nil
+}
+
+// transitionEvent is a GitHub issue event with a configured transition
+type transitionEvent struct {
+	name string
+	tc   config.TransitionConfig
+	// from is the status category of the Jira issues the transition
+	// applies to: "done" or, for any other, ""
+	from string
+}
+
+// errSampled stops the sample search of validateTransitions
+var errSampled = errors.New("sampled")
+
+// validateTransitions checks that the configured transitions exist in the
+// workflows of the Jira projects issues are created in. Jira lists the
+// transitions of issues, not of workflows, so the transitions available
+// from the statuses of recently updated issues of each project are checked.
+func validateTransitions(ctx context.Context) error {
+	t := cfg().Jira.Transitions
+	var events []transitionEvent
+	for _, e := range []transitionEvent{
+		{name: "closed", tc: t.Closed},
+		{name: "not planned", tc: t.NotPlanned},
+		{name: "reopened", tc: t.Reopened, from: "done"},
+	} {
+		if e.tc.Name != "" {
+			events = append(events, e)
+		}
+	}
+
+	for _, target := range jiraTargets() {
+		jc, err := jiraFor(target.Instance)
+		if err != nil {
+			return err
+		}
+		// One issue per status, as transitions depend on the status only
+		byStatus := make(map[string]*jira.Issue)
+		n := 0
+		jql := fmt.Sprintf("project = %s ORDER BY updated DESC", jqlString(target.ProjectKey))
+		err = jc.Search(ctx, jql, []string{"status"}, func(ji *jira.Issue) error {
+			if ji.Fields.Status != nil && byStatus[ji.Fields.Status.Name] == nil {
+				byStatus[ji.Fields.Status.Name] = ji
+			}
+			if n++; n >= transitionSampleSize {
+				return errSampled
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errSampled) {
+			return fmt.Errorf("failed to search issues of Jira project %s: %w", target.ProjectKey, err)
+		}
+
+		available := map[string][]*jira.Transition{}
+		for _, ji := range byStatus {
+			transitions, err := jc.Transitions(ctx, ji.Key)
+			if err != nil {
+				return fmt.Errorf("failed to list the transitions of %s: %w", ji.Key, err)
+			}
+			from := ""
+			if ji.Fields.Status.StatusCategory.Key == "done" {
+				from = "done"
+			}
+			available[from] = append(available[from], transitions...)
+		}
+		for _, e := range events {
+			if _, sampled := available[e.from]; !sampled {
+				log.Printf("Cannot validate the %s transition %q: Jira project %s has no recent issue to take it from", e.name, e.tc.Name, target.ProjectKey)
+				continue
+			}
+			found := false
+			for _, tr := range available[e.from] {
+				if matchesTransition(tr, e.tc.Name) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("invalid configuration: the workflow of Jira project %s has no %s transition %q", target.ProjectKey, e.name, e.tc.Name)
+			}
+		}
+		log.Printf("Validated the transitions of Jira project %s against %d statuses", target.ProjectKey, len(byStatus))
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/jira"
+	"github.com/savitaashture/gh-jira/pkg/notify"
+	"github.com/savitaashture/gh-jira/pkg/state"
+)
+
+// triageCheckInterval is the time between two checks of the triage SLA
+const triageCheckInterval = time.Hour
+
+// triageCommentMarker starts the comments on overdue GitHub issues
+const triageCommentMarker = "<!-- gh-jira:triage -->"
+
+// lastTriageCheck is when the triage SLA was last checked; only the poll
+// loop reads and writes it
+var lastTriageCheck time.Time
+
+// triageCursor names the state cursor recording when the Jira issue of a
+// mapping was flagged as overdue
+func triageCursor(key string) string {
+	return "triage:" + key
+}
+
+// checkTriage flags the Jira issues of synced issues that had no Jira
+// activity within the triage SLA, at most once per triageCheckInterval.
+// Jira is searched for stale issues of the projects issues are created in,
+// and the results are matched against the mapping store, so that only
+// issues created by gh-jira are flagged.
+func checkTriage(ctx context.Context, client *github.Client, result *cycleResult) {
+	conf := cfg()
+	if time.Since(lastTriageCheck) < triageCheckInterval {
+		return
+	}
+	lastTriageCheck = time.Now()
+
+	mappings, err := store.List(ctx)
+	if err != nil {
+		log.Printf("Failed to list mappings for the triage SLA: %v", err)
+		result.fail("", 0, "triage", err)
+		return
+	}
+	byKey := make(map[string]*state.Mapping, len(mappings))
+	for _, m := range mappings {
+		if m.JiraKey != "" && m.MergedInto == "" {
+			byKey[m.JiraInstance+"/"+m.JiraKey] = m
+		}
+	}
+
+	projects := map[string][]string{}
+	for _, t := range jiraTargets() {
+		projects[t.Instance] = append(projects[t.Instance], jqlString(t.ProjectKey))
+	}
+	sla := conf.Jira.Triage.SLA
+	for instance, keys := range projects {
+		jc, err := jiraFor(instance)
+		if err != nil {
+			result.fail("", 0, "triage", err)
+			continue
+		}
+		jql := fmt.Sprintf(`project in (%s) AND updated <= "-%dm"`, strings.Join(keys, ", "), int(sla.Minutes()))
+		if conf.Jira.Triage.JQL != "" {
+			jql += " AND (" + conf.Jira.Triage.JQL + ")"
+		}
+		var overdue []*state.Mapping
+		err = jc.Search(ctx, jql, []string{"summary"}, func(ji *jira.Issue) error {
+			if m := byKey[instance+"/"+ji.Key]; m != nil {
+				overdue = append(overdue, m)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Failed to search Jira issues past the triage SLA: %v", err)
+			result.fail("", 0, "triage", err)
+			continue
+		}
+		for _, m := range overdue {
+			if ctx.Err() != nil {
+				return
+			}
+			if err := flagOverdue(ctx, client, m); err != nil {
+				log.Printf("Failed to flag overdue Jira issue %s: %v", m.JiraKey, err)
+				result.fail(m.Repo, m.IssueNumber, "triage", err)
+			}
+		}
+	}
+}
+
+// flagOverdue comments on the GitHub issue of an overdue Jira issue and
+// sends the overdue notification, unless the issue was flagged before or
+// was closed on GitHub in the meantime
+func flagOverdue(ctx context.Context, client *github.Client, m *state.Mapping) error {
+	conf := cfg()
+	cursor := triageCursor(m.Key)
+	if flagged, err := store.GetCursor(ctx, cursor); err != nil || flagged != "" {
+		return err
+	}
+	idle := formatSLA(conf.Jira.Triage.SLA)
+	e := notify.Event{
+		Kind:    notify.EventOverdue,
+		Repo:    m.Repo,
+		Issue:   m.IssueNumber,
+		JiraKey: m.JiraKey,
+		JiraURL: jiraBrowseURL(m.JiraInstance, m.JiraKey),
+		Idle:    idle,
+	}
+
+	// Comments are only posted on GitHub issues
+	if !fromSource(m.Repo) && !isDiscussion(m) {
+		repo, err := selectRepo(m.Repo)
+		if err != nil {
+			return err
+		}
+		if err := ghRateLimit.wait(ctx); err != nil {
+			return err
+		}
+		issue, resp, err := client.Issues.Get(ctx, repo.Owner, repo.Name, m.IssueNumber)
+		ghRateLimit.observe(resp, err)
+		if err != nil {
+			return fmt.Errorf("failed to get GitHub issue #%d: %w", m.IssueNumber, err)
+		}
+		if issue.GetState() == "closed" {
+			return store.SetCursor(ctx, cursor, "closed")
+		}
+		e.IssueURL, e.Title = issue.GetHTMLURL(), issue.GetTitle()
+
+		if conf.Jira.Triage.Comment {
+			body := fmt.Sprintf("%s\nJira issue [%s](%s) has had no activity for %s since it was synced and is still waiting for triage.",
+				triageCommentMarker, m.JiraKey, e.JiraURL, idle)
+			if err := ghRateLimit.wait(ctx); err != nil {
+				return err
+			}
+			created, resp, err := client.Issues.CreateComment(ctx, repo.Owner, repo.Name, m.IssueNumber, &github.IssueComment{Body: &body})
+			ghRateLimit.observe(resp, err)
+			if err != nil {
+				return fmt.Errorf("failed to comment on GitHub issue #%d: %w", m.IssueNumber, err)
+			}
+			recordAudit(githubAudit("create_comment", repo, m.IssueNumber, map[string]interface{}{"comment_id": created.GetID(), "overdue": m.JiraKey}))
+		}
+	}
+	log.Printf("Jira issue %s of %s#%d has had no activity for %s", m.JiraKey, m.Repo, m.IssueNumber, idle)
+	sendNotification(ctx, e)
+	return store.SetCursor(ctx, cursor, time.Now().UTC().Format(time.RFC3339))
+}
+
+// formatSLA formats a duration in whole hours where possible, such as 48h
+// instead of 48h0m0s
+func formatSLA(d time.Duration) string {
+	if d%time.Hour == 0 {
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+	return d.String()
+}
@@ -0,0 +1,529 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/google/go-github/v75/github"
+	"github.com/savitaashture/gh-jira/pkg/config"
+	"github.com/savitaashture/gh-jira/pkg/jira"
+	"github.com/savitaashture/gh-jira/pkg/summarizer"
+)
+
+// validateTimeout limits the online checks of `validate`
+const validateTimeout = 2 * time.Minute
+
+// validateCheck is the outcome of one check of `validate`
+type validateCheck struct {
+	Check string `json:"check"`
+	OK    bool   `json:"ok"`
+	// Problem says what is wrong and how to fix it
+	Problem string `json:"problem,omitempty"`
+}
+
+// validateReport is the output of `validate`
+type validateReport struct {
+	Valid  bool            `json:"valid"`
+	Checks []validateCheck `json:"checks"`
+}
+
+// add records the outcome of a check. A nil err passes it.
+func (r *validateReport) add(check string, err error) {
+	c := validateCheck{Check: check, OK: err == nil}
+	if err != nil {
+		// Keep multi-line errors such as YAML ones on one table row
+		lines := strings.Split(err.Error(), "\n")
+		for i := range lines {
+			lines[i] = strings.TrimSpace(lines[i])
+		}
+		c.Problem = strings.Join(lines, " ")
+	}
+	r.Checks = append(r.Checks, c)
+}
+
+// runValidateCommand implements `gh-jira validate`
+func runValidateCommand(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("GH_JIRA_CONFIG"), "Path to an optional YAML configuration file")
+	offline := fs.Bool("offline", false, "Only check the configuration and templates, without contacting GitHub, Jira or Ollama")
+	output := outputFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return exitFatal
+	}
+	if err := validOutput(*output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+
+	report, loaded := validate(*configPath, *offline)
+	if err := writeOutput(os.Stdout, *output, report, report.writeTable); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFatal
+	}
+	if !loaded {
+		return exitFatal
+	}
+	if !report.Valid {
+		return exitPartialFailure
+	}
+	return exitOK
+}
+
+// validate checks the configuration file, the templates and, unless
+// offline, the credentials and the Jira projects, issue types and fields
+// the configuration refers to. loaded is false if the configuration could
+// not be loaded.
+func validate(configPath string, offline bool) (report *validateReport, loaded bool) {
+	report = &validateReport{}
+	defer func() {
+		report.Valid = true
+		for _, c := range report.Checks {
+			report.Valid = report.Valid && c.OK
+		}
+	}()
+
+	if configPath != "" {
+		data, err := os.ReadFile(configPath)
+		if err == nil {
+			if err = config.CheckSchema(data); err != nil {
+				err = fmt.Errorf("%w; check the spelling and nesting of the setting against the README", err)
+			}
+		}
+		report.add("config file schema", err)
+	}
+	sum, err := setup(configPath, 0, -1)
+	report.add("configuration", err)
+	if err != nil {
+		// Everything else depends on a loaded configuration
+		return report, false
+	}
+	defer store.Close()
+
+	validateTemplates(report)
+	if offline {
+		return report, true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), validateTimeout)
+	defer cancel()
+	validateGitHub(ctx, report)
+	validateJira(ctx, report)
+	validateSinks(ctx, report)
+	validateOllama(ctx, sum, report)
+	return report, true
+}
+
+// sampleIssue is the GitHub issue the templates are exercised with
+func sampleIssue(repo config.RepoConfig) *github.Issue {
+	return &github.Issue{
+		Number:    github.Ptr(42),
+		Title:     github.Ptr("Crash when saving settings"),
+		Body:      github.Ptr("Steps to reproduce:\n1. Open settings\n2. Click save\n\nThe app crashes with a panic."),
+		HTMLURL:   github.Ptr(fmt.Sprintf("https://github.com/%s/issues/42", repo.FullName())),
+		User:      &github.User{Login: github.Ptr("octocat")},
+		Labels:    []*github.Label{{Name: github.Ptr("bug")}},
+		Reactions: &github.Reactions{PlusOne: github.Ptr(3)},
+		State:     github.Ptr("open"),
+	}
+}
+
+// validateTemplates executes the Jira summary and description templates and
+// the prompts of the repositories with a sample issue
+func validateTemplates(report *validateReport) {
+	s := current()
+	repos := s.cfg.GitHub.WatchedRepos()
+	if len(repos) == 0 {
+		repos = []config.RepoConfig{{Owner: "octo-org", Name: "octo-repo"}}
+	}
+	data := newIssueTemplateData(repos[0], sampleIssue(repos[0]), "Saving the settings crashes the app.")
+	report.add("Jira summary template", checkTemplate(s.summaryTemplate, data))
+	report.add("Jira description template", checkTemplate(s.descriptionTemplate, data))
+
+	for _, repo := range repos {
+		rt := repoTemplatesFor(repo)
+		if rt == nil {
+			continue
+		}
+		if rt.description != nil {
+			data := newIssueTemplateData(repo, sampleIssue(repo), "Saving the settings crashes the app.")
+			report.add("description template of "+repo.FullName(), checkTemplate(rt.description, data))
+		}
+		if rt.prompt != "" {
+			var err error
+			if prompt := fmt.Sprintf(rt.prompt, sampleIssue(repo).GetBody()); strings.Contains(prompt, "%!") {
+				err = fmt.Errorf("prompt file %s has format verbs besides the one %%s; write a literal %% as %%%%", repo.PromptFile)
+			}
+			report.add("prompt of "+repo.FullName(), err)
+		}
+	}
+}
+
+// checkTemplate executes t with data and fails if that fails or renders
+// nothing
+func checkTemplate(t *template.Template, data *issueTemplateData) error {
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return fmt.Errorf("%w; the fields available are listed in the README", err)
+	}
+	if strings.TrimSpace(b.String()) == "" {
+		return fmt.Errorf("template %s renders nothing for a sample issue", t.Name())
+	}
+	return nil
+}
+
+// validateGitHub checks the scopes of the GitHub token and that the
+// GitHub credentials can read the watched repositories
+func validateGitHub(ctx context.Context, report *validateReport) {
+	conf := cfg()
+	if len(conf.GitHub.WatchedRepos()) == 0 && conf.GitHub.Org.Name == "" {
+		return
+	}
+	client := newGitHubClient(ctx)
+	scopes, err := githubScopes(ctx, client)
+	if err != nil {
+		if isAuthError(err) {
+			err = fmt.Errorf("%w; the GitHub token is invalid or expired, check GITHUB_TOKEN or the GitHub App settings", err)
+		}
+		report.add("GitHub credentials", err)
+		return
+	}
+	if scopes != nil {
+		var err error
+		if !scopes["repo"] && !scopes["public_repo"] {
+			err = fmt.Errorf("the token has the scopes %q but needs repo, or public_repo for public repositories only; regenerate it with the repo scope", scopeNames(scopes))
+		}
+		report.add("GitHub token scopes", err)
+	}
+	repos, err := repositories(ctx, client)
+	if err != nil {
+		report.add("GitHub credentials", fmt.Errorf("%w; check GITHUB_TOKEN or the GitHub App settings", err))
+		return
+	}
+	if conf.GitHub.Org.Name != "" {
+		report.add(fmt.Sprintf("GitHub organization %s", conf.GitHub.Org.Name), nil)
+		return
+	}
+	for _, repo := range repos {
+		if err := ghRateLimit.wait(ctx); err != nil {
+			report.add("GitHub repository "+repo.FullName(), err)
+			return
+		}
+		r, resp, err := client.Repositories.Get(ctx, repo.Owner, repo.Name)
+		ghRateLimit.observe(resp, err)
+		switch {
+		case isAuthError(err):
+			err = fmt.Errorf("%w; the GitHub token is invalid or expired", err)
+		case resp != nil && resp.StatusCode == http.StatusNotFound:
+			err = fmt.Errorf("repository not found; check its name and that the token can read it")
+		case err == nil && r.GetPrivate() && scopes != nil && !scopes["repo"]:
+			err = fmt.Errorf("the repository is private and the token only has the public_repo scope; regenerate it with the repo scope")
+		}
+		report.add("GitHub repository "+repo.FullName(), err)
+	}
+}
+
+// githubScopes returns the OAuth scopes of a classic personal access token,
+// or nil for fine-grained tokens and GitHub Apps, which don't report their
+// permissions
+func githubScopes(ctx context.Context, client *github.Client) (map[string]bool, error) {
+	if err := ghRateLimit.wait(ctx); err != nil {
+		return nil, err
+	}
+	_, resp, err := client.RateLimit.Get(ctx)
+	ghRateLimit.observe(resp, err)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		// GitHub Enterprise Server without rate limits
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	header := resp.Header.Values("X-OAuth-Scopes")
+	if len(header) == 0 {
+		return nil, nil
+	}
+	scopes := map[string]bool{}
+	for _, s := range strings.Split(strings.Join(header, ","), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			scopes[s] = true
+		}
+	}
+	return scopes, nil
+}
+
+// scopeNames lists OAuth scopes
+func scopeNames(scopes map[string]bool) string {
+	names := make([]string, 0, len(scopes))
+	for s := range scopes {
+		names = append(names, s)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// validateJira checks the credentials of each Jira instance, that the
+// projects, issue types and fields the configuration refers to exist and
+// that the Jira user has the permissions syncing needs in the projects
+func validateJira(ctx context.Context, report *validateReport) {
+	authenticated := map[string]bool{}
+	for _, instance := range jiraInstanceNames() {
+		name := "Jira credentials"
+		if instance != "" {
+			name += " of instance " + instance
+		}
+		jc, err := jiraFor(instance)
+		if err == nil {
+			if _, err = jc.Myself(ctx); isJiraStatus(err, http.StatusUnauthorized, http.StatusForbidden) {
+				err = fmt.Errorf("%w; check JIRA_USERNAME and JIRA_API_TOKEN or the OAuth settings", err)
+			}
+		}
+		report.add(name, err)
+		authenticated[instance] = err == nil
+	}
+
+	for _, target := range jiraTargets() {
+		if !authenticated[target.Instance] {
+			continue
+		}
+		jc, _ := jiraFor(target.Instance)
+		project, err := jc.Project(ctx, target.ProjectKey)
+		if isJiraStatus(err, http.StatusNotFound) {
+			err = fmt.Errorf("project not found; check the project key and that the Jira user can browse it")
+		}
+		report.add("Jira project "+target.ProjectKey, err)
+		if err != nil {
+			continue
+		}
+		perms := jiraPermissions()
+		have, err := jc.MyPermissions(ctx, target.ProjectKey, perms...)
+		if err == nil {
+			var missing []string
+			for _, p := range perms {
+				if !have[p] {
+					missing = append(missing, p)
+				}
+			}
+			if len(missing) > 0 {
+				err = fmt.Errorf("the Jira user lacks %s; grant them in the permission scheme of %s", strings.Join(missing, ", "), target.ProjectKey)
+			}
+		}
+		report.add("Jira permissions in "+target.ProjectKey, err)
+		for _, issueType := range issueTypesOf(target) {
+			var err error
+			if !hasIssueType(project, issueType) {
+				err = fmt.Errorf("issue type %q does not exist in %s; available: %s", issueType, target.ProjectKey, issueTypeNames(project))
+			}
+			report.add(fmt.Sprintf("Jira issue type %s of %s", issueType, target.ProjectKey), err)
+		}
+	}
+
+	for _, instance := range jiraInstanceNames() {
+		if !authenticated[instance] {
+			continue
+		}
+		ids := configuredFields(instance)
+		if len(ids) == 0 {
+			continue
+		}
+		jc, _ := jiraFor(instance)
+		fields, err := jc.Fields(ctx)
+		if err != nil {
+			report.add("Jira fields", err)
+			continue
+		}
+		for _, id := range ids {
+			var err error
+			if !hasField(fields, id) {
+				err = fmt.Errorf("field %q does not exist; use the ID of a field, such as customfield_10050, from /rest/api/2/field", id)
+			}
+			report.add("Jira field "+id, err)
+		}
+	}
+}
+
+// isJiraStatus reports whether err is a Jira API error with one of the
+// given statuses
+func isJiraStatus(err error, statuses ...int) bool {
+	var jerr *jira.Error
+	if !errors.As(err, &jerr) {
+		return false
+	}
+	for _, s := range statuses {
+		if jerr.StatusCode == s {
+			return true
+		}
+	}
+	return false
+}
+
+// jiraPermissions returns the project permissions the configured sync needs
+func jiraPermissions() []string {
+	conf := cfg()
+	perms := []string{"BROWSE_PROJECTS", "CREATE_ISSUES", "EDIT_ISSUES"}
+	j := conf.Jira
+	if d := conf.Summarizer.Discussion; j.Comments.ToJira() || (d.MinComments > 0 && d.Target == config.DiscussionComment) {
+		perms = append(perms, "ADD_COMMENTS")
+	}
+	if j.Transitions.Enabled() || (j.PullRequests.Enabled && j.PullRequests.Transition.Name != "") {
+		perms = append(perms, "TRANSITION_ISSUES")
+	}
+	if j.Links.Enabled || j.PullRequests.Enabled {
+		perms = append(perms, "LINK_ISSUES")
+	}
+	if j.DescriptionLimit.MaxLength > 0 && j.DescriptionLimit.AttachFullBody {
+		perms = append(perms, "CREATE_ATTACHMENTS")
+	}
+	return perms
+}
+
+// issueTypesOf returns the issue types created in a Jira target
+func issueTypesOf(target config.JiraTarget) []string {
+	conf := cfg()
+	var types []string
+	add := func(t string) {
+		if t != "" && !containsFold(types, t) {
+			types = append(types, t)
+		}
+	}
+	inst, _ := conf.Jira.Instance(target.Instance)
+	main := target.ProjectKey == inst.ProjectKey
+	if main {
+		add(inst.IssueType)
+	}
+	for _, r := range conf.Jira.Routes {
+		if r.ProjectKey == target.ProjectKey && r.Instance == target.Instance {
+			add(r.IssueType)
+		}
+	}
+	for _, repo := range conf.GitHub.WatchedRepos() {
+		if main && repo.Jira == target.Instance {
+			for _, t := range repo.IssueTypes {
+				add(t)
+			}
+		}
+	}
+	if conf.Jira.Epics.Enabled {
+		add(conf.Jira.Epics.IssueType)
+	}
+	if conf.Jira.Subtasks.Enabled {
+		add(conf.Jira.Subtasks.IssueType)
+	}
+	return types
+}
+
+// configuredFields returns the IDs of the Jira fields the configuration
+// writes to on an instance
+func configuredFields(instance string) []string {
+	conf := cfg()
+	var ids []string
+	add := func(id string) {
+		if id != "" && !containsFold(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	if e := conf.Jira.Epics; e.Enabled {
+		if e.LinkField != "parent" {
+			add(e.LinkField)
+		}
+		add(e.NameField)
+	}
+	if conf.Jira.Reactions.Enabled {
+		add(conf.Jira.Reactions.Field)
+	}
+	if e := conf.Summarizer.Enrichment; e.Enabled {
+		add(e.AcceptanceCriteriaField)
+		add(e.StoryPointsField)
+	}
+	for _, f := range conf.Jira.FormFields {
+		if f.Type != config.FormLabels {
+			add(f.Field)
+		}
+	}
+	return ids
+}
+
+// containsFold reports whether list contains s, ignoring case
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasIssueType reports whether a project offers an issue type
+func hasIssueType(p *jira.Project, name string) bool {
+	for _, t := range p.IssueTypes {
+		if strings.EqualFold(t.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// issueTypeNames lists the issue types of a project
+func issueTypeNames(p *jira.Project) string {
+	names := make([]string, len(p.IssueTypes))
+	for i, t := range p.IssueTypes {
+		names[i] = t.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// hasField reports whether a field with the ID id exists
+func hasField(fields []*jira.Field, id string) bool {
+	for _, f := range fields {
+		if f.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// validateOllama checks that Ollama is reachable and has the configured
+// models
+func validateOllama(ctx context.Context, sum *summarizer.Summarizer, report *validateReport) {
+	missing, err := sum.MissingModels(ctx)
+	if err != nil {
+		report.add("Ollama", fmt.Errorf("%w; check that Ollama runs at OLLAMA_HOST", err))
+		return
+	}
+	report.add("Ollama", nil)
+	if len(missing) > 0 {
+		report.add("Ollama models", fmt.Errorf("%s not pulled; run `ollama pull` or enable summarizer.autoPull", strings.Join(missing, ", ")))
+	} else {
+		report.add("Ollama models", nil)
+	}
+}
+
+// writeTable renders the validation report for humans
+func (r *validateReport) writeTable(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tRESULT")
+	for _, c := range r.Checks {
+		result := "ok"
+		if !c.OK {
+			result = "FAILED: " + c.Problem
+		}
+		fmt.Fprintf(w, "%s\t%s\n", c.Check, result)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if r.Valid {
+		fmt.Fprintln(out, "\nThe configuration is valid")
+	} else {
+		fmt.Fprintln(out, "\nThe configuration has problems")
+	}
+	return nil
+}